@@ -0,0 +1,67 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+const defaultActivePresenceCooldown = 30 * time.Second
+
+// markActivePresence marks the user as online on WhatsApp because they're sending a message or typing.
+// The user is marked offline again once they haven't been active for the configured cooldown.
+// This does nothing unless the active presence mode is enabled.
+func (user *User) markActivePresence() {
+	cfg := user.bridge.Config.Bridge.ActivePresence
+	if !cfg.Enabled || !user.IsLoggedIn() {
+		return
+	}
+	cooldown := cfg.Cooldown
+	if cooldown == 0 {
+		cooldown = defaultActivePresenceCooldown
+	}
+	user.activePresenceLock.Lock()
+	defer user.activePresenceLock.Unlock()
+	if user.activePresenceTimer != nil {
+		user.activePresenceTimer.Reset(cooldown)
+		return
+	}
+	user.zlog.Debug().Msg("Marking online because of activity")
+	user.lastPresence = types.PresenceAvailable
+	err := user.Client.SendPresence(types.PresenceAvailable)
+	if err != nil {
+		user.zlog.Warn().Err(err).Msg("Failed to set presence on activity")
+	}
+	user.activePresenceTimer = time.AfterFunc(cooldown, user.clearActivePresence)
+}
+
+func (user *User) clearActivePresence() {
+	user.activePresenceLock.Lock()
+	defer user.activePresenceLock.Unlock()
+	user.activePresenceTimer = nil
+	user.lastPresence = types.PresenceUnavailable
+	if !user.IsLoggedIn() {
+		return
+	}
+	user.zlog.Debug().Msg("Marking offline after activity cooldown")
+	err := user.Client.SendPresence(types.PresenceUnavailable)
+	if err != nil {
+		user.zlog.Warn().Err(err).Msg("Failed to clear presence after activity cooldown")
+	}
+}
@@ -0,0 +1,482 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/beeper/libserv/pkg/requestlog"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/element-hq/mautrix-go/bridge/status"
+	"github.com/element-hq/mautrix-go/id"
+
+	"github.com/element-hq/mautrix-whatsapp/database"
+)
+
+// AdminAPI is a separate HTTP listener for bridge operators, which allows managing all users and portals
+// without being logged into the bridge or having access to management rooms.
+type AdminAPI struct {
+	bridge *WABridge
+	log    zerolog.Logger
+	server *http.Server
+
+	startTime time.Time
+}
+
+func NewAdminAPI(br *WABridge) *AdminAPI {
+	admin := &AdminAPI{
+		bridge: br,
+		log:    br.ZLog.With().Str("component", "admin api").Logger(),
+	}
+	r := mux.NewRouter()
+	r.Use(hlog.NewHandler(admin.log))
+	r.Use(requestlog.AccessLogger(true))
+	r.Use(admin.AuthMiddleware)
+	r.HandleFunc("/v1/health", admin.Health).Methods(http.MethodGet)
+	r.HandleFunc("/v1/users", admin.ListUsers).Methods(http.MethodGet)
+	r.HandleFunc("/v1/users/{mxid}/reconnect", admin.ReconnectUser).Methods(http.MethodPost)
+	r.HandleFunc("/v1/users/{mxid}/logout", admin.LogoutUser).Methods(http.MethodPost)
+	r.HandleFunc("/v1/users/{mxid}/export", admin.ExportUserData).Methods(http.MethodPost)
+	r.HandleFunc("/v1/users/import", admin.ImportUserData).Methods(http.MethodPost)
+	r.HandleFunc("/v1/users/{mxid}/whatsapp", admin.GetUserWhatsAppState).Methods(http.MethodGet)
+	r.HandleFunc("/v1/users/{mxid}/whatsapp/app_state/{name}", admin.ClearUserAppState).Methods(http.MethodDelete)
+	r.HandleFunc("/v1/users/{mxid}/whatsapp/app_state/{name}/sync", admin.SyncUserAppState).Methods(http.MethodPost)
+	r.HandleFunc("/v1/devices/stale", admin.ListStaleDevices).Methods(http.MethodGet)
+	r.HandleFunc("/v1/devices/{jid}", admin.DeleteStaleDevice).Methods(http.MethodDelete)
+	r.HandleFunc("/v1/portals", admin.ListPortals).Methods(http.MethodGet)
+	r.HandleFunc("/v1/portals/{roomID}/resync", admin.ResyncPortal).Methods(http.MethodPost)
+	r.HandleFunc("/v1/puppets/activity", admin.GetPuppetActivity).Methods(http.MethodGet)
+	r.HandleFunc("/v1/puppets/{jid}/resync", admin.ResyncPuppet).Methods(http.MethodPost)
+	r.HandleFunc("/v1/announcements", admin.CreateAnnouncement).Methods(http.MethodPost)
+	r.HandleFunc("/v1/announcements/{id}", admin.GetAnnouncement).Methods(http.MethodGet)
+	admin.server = &http.Server{Addr: br.Config.AdminAPI.Listen, Handler: r}
+	return admin
+}
+
+func (admin *AdminAPI) Start() {
+	admin.startTime = time.Now()
+	admin.log.Info().Str("address", admin.server.Addr).Msg("Starting admin API listener")
+	err := admin.server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		admin.log.Err(err).Msg("Error in admin API listener")
+	}
+}
+
+func (admin *AdminAPI) Stop() {
+	err := admin.server.Close()
+	if err != nil {
+		admin.log.Err(err).Msg("Failed to close admin API listener")
+	}
+}
+
+func (admin *AdminAPI) AuthMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if auth == "" || subtle.ConstantTimeCompare([]byte(auth), []byte(admin.bridge.Config.AdminAPI.Token)) != 1 {
+			hlog.FromRequest(r).Debug().Msg("Authentication token does not match admin API token")
+			jsonResponse(w, http.StatusForbidden, Error{
+				Error:   "Authentication token does not match admin API token",
+				ErrCode: "M_FORBIDDEN",
+			})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (admin *AdminAPI) getUser(w http.ResponseWriter, r *http.Request) *User {
+	userID := id.UserID(mux.Vars(r)["mxid"])
+	user := admin.bridge.GetUserByMXIDIfExists(userID)
+	if user == nil {
+		jsonResponse(w, http.StatusNotFound, Error{
+			Error:   "User not found",
+			ErrCode: "M_NOT_FOUND",
+		})
+	}
+	return user
+}
+
+type AdminUserInfo struct {
+	MXID           id.UserID `json:"mxid"`
+	JID            string    `json:"jid,omitempty"`
+	HasSession     bool      `json:"has_session"`
+	Connected      bool      `json:"connected"`
+	LoggedIn       bool      `json:"logged_in"`
+	ManagementRoom id.RoomID `json:"management_room,omitempty"`
+	BridgeState    string    `json:"bridge_state,omitempty"`
+}
+
+func (admin *AdminAPI) ListUsers(w http.ResponseWriter, r *http.Request) {
+	users := admin.bridge.GetAllUsers()
+	resp := make([]AdminUserInfo, 0, len(users))
+	for _, user := range users {
+		info := AdminUserInfo{
+			MXID:           user.MXID,
+			HasSession:     user.Session != nil,
+			Connected:      user.IsConnected(),
+			LoggedIn:       user.IsLoggedIn(),
+			ManagementRoom: user.ManagementRoom,
+		}
+		if !user.JID.IsEmpty() {
+			info.JID = user.JID.String()
+		}
+		if prev := user.BridgeState.GetPrev(); prev.StateEvent != "" {
+			info.BridgeState = string(prev.StateEvent)
+		}
+		resp = append(resp, info)
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
+
+func (admin *AdminAPI) ReconnectUser(w http.ResponseWriter, r *http.Request) {
+	user := admin.getUser(w, r)
+	if user == nil {
+		return
+	} else if user.Session == nil {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   "User is not logged in",
+			ErrCode: "not logged in",
+		})
+		return
+	}
+	hlog.FromRequest(r).Info().Stringer("user_id", user.MXID).Msg("Reconnecting user")
+	if user.Client != nil {
+		user.DeleteConnection()
+		user.BridgeState.Send(status.BridgeState{StateEvent: status.StateTransientDisconnect, Error: WANotConnected})
+	}
+	go user.Connect()
+	jsonResponse(w, http.StatusAccepted, Response{true, "Reconnecting to WhatsApp"})
+}
+
+func (admin *AdminAPI) LogoutUser(w http.ResponseWriter, r *http.Request) {
+	user := admin.getUser(w, r)
+	if user == nil {
+		return
+	} else if user.Session == nil {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   "User is not logged in",
+			ErrCode: "not logged in",
+		})
+		return
+	}
+	hlog.FromRequest(r).Info().Stringer("user_id", user.MXID).Msg("Logging out user")
+	if user.Client != nil {
+		err := user.Client.Logout()
+		if err != nil {
+			hlog.FromRequest(r).Warn().Err(err).Msg("Error while logging out, deleting session anyway")
+		}
+		user.DeleteConnection()
+	}
+	user.bridge.Metrics.TrackConnectionState(user.JID, false)
+	user.removeFromJIDMap(status.BridgeState{StateEvent: status.StateLoggedOut})
+	user.DeleteSession(r.Context())
+	jsonResponse(w, http.StatusOK, Response{true, "Logged out successfully"})
+}
+
+func (admin *AdminAPI) ExportUserData(w http.ResponseWriter, r *http.Request) {
+	user := admin.getUser(w, r)
+	if user == nil {
+		return
+	}
+	hlog.FromRequest(r).Info().Stringer("user_id", user.MXID).Msg("Exporting user data")
+	export, err := admin.bridge.ExportData(r.Context(), user)
+	if errors.Is(err, errExportUserNotLoggedIn) {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   "User is not logged in",
+			ErrCode: "not logged in",
+		})
+		return
+	} else if err != nil {
+		hlog.FromRequest(r).Err(err).Msg("Failed to export user data")
+		jsonResponse(w, http.StatusInternalServerError, Error{
+			Error:   "Failed to export user data",
+			ErrCode: "M_UNKNOWN",
+		})
+		return
+	}
+	jsonResponse(w, http.StatusOK, export)
+}
+
+func (admin *AdminAPI) ImportUserData(w http.ResponseWriter, r *http.Request) {
+	var data DataExport
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil || data.UserID == "" || data.JID.IsEmpty() {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   "Malformed data export",
+			ErrCode: "M_BAD_JSON",
+		})
+		return
+	}
+	log := hlog.FromRequest(r).With().Stringer("user_id", data.UserID).Stringer("jid", data.JID).Logger()
+	log.Info().Msg("Importing user data")
+	_, err = admin.bridge.ImportData(r.Context(), &data)
+	if errors.Is(err, errImportUserLoggedIn) {
+		jsonResponse(w, http.StatusConflict, Error{
+			Error:   "User is already logged in",
+			ErrCode: "already logged in",
+		})
+		return
+	} else if errors.Is(err, errImportVersion) || errors.Is(err, errImportInvalidColumn) {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   err.Error(),
+			ErrCode: "M_BAD_JSON",
+		})
+		return
+	} else if err != nil {
+		log.Err(err).Msg("Failed to import user data")
+		jsonResponse(w, http.StatusInternalServerError, Error{
+			Error:   "Failed to import user data",
+			ErrCode: "M_UNKNOWN",
+		})
+		return
+	}
+	jsonResponse(w, http.StatusOK, Response{true, "Imported user data successfully"})
+}
+
+type AdminPortalInfo struct {
+	JID      types.JID `json:"jid"`
+	Receiver types.JID `json:"receiver,omitempty"`
+	RoomID   id.RoomID `json:"room_id,omitempty"`
+	Name     string    `json:"name,omitempty"`
+	Type     string    `json:"type"`
+}
+
+func (admin *AdminAPI) ListPortals(w http.ResponseWriter, r *http.Request) {
+	portals := admin.bridge.GetAllPortals()
+	resp := make([]AdminPortalInfo, 0, len(portals))
+	for _, portal := range portals {
+		info := AdminPortalInfo{
+			JID:    portal.Key.JID,
+			RoomID: portal.MXID,
+			Name:   portal.Name,
+		}
+		switch {
+		case portal.IsPrivateChat():
+			info.Type = "dm"
+			info.Receiver = portal.Key.Receiver
+		case portal.IsNewsletter():
+			info.Type = "newsletter"
+		case portal.IsBroadcastList():
+			info.Type = "broadcast"
+		default:
+			info.Type = "group"
+		}
+		resp = append(resp, info)
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
+
+// getSourceUser finds a logged-in user who can be used to fetch info for the given portal.
+// The user can be chosen explicitly with the user_id query parameter.
+func (admin *AdminAPI) getSourceUser(r *http.Request, portal *Portal) *User {
+	if userID := r.URL.Query().Get("user_id"); userID != "" {
+		return admin.bridge.GetUserByMXIDIfExists(id.UserID(userID))
+	} else if portal != nil && portal.IsPrivateChat() {
+		return admin.bridge.GetUserByJID(portal.Key.Receiver)
+	}
+	for _, user := range admin.bridge.GetAllUsers() {
+		if !user.IsLoggedIn() {
+			continue
+		}
+		if portal == nil || admin.bridge.AS.StateStore.IsInRoom(r.Context(), portal.MXID, user.MXID) {
+			return user
+		}
+	}
+	return nil
+}
+
+func (admin *AdminAPI) ResyncPortal(w http.ResponseWriter, r *http.Request) {
+	portal := admin.bridge.GetPortalByMXID(id.RoomID(mux.Vars(r)["roomID"]))
+	if portal == nil {
+		jsonResponse(w, http.StatusNotFound, Error{
+			Error:   "Portal not found",
+			ErrCode: "M_NOT_FOUND",
+		})
+		return
+	}
+	user := admin.getSourceUser(r, portal)
+	if user == nil || !user.IsLoggedIn() {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   "No logged-in user found to resync the portal with",
+			ErrCode: "no source user",
+		})
+		return
+	}
+	ctx := portal.zlog.With().Str("action", "admin api resync").Logger().WithContext(context.Background())
+	go portal.UpdateMatrixRoom(ctx, user, nil, nil)
+	jsonResponse(w, http.StatusAccepted, Response{true, "Portal resync started"})
+}
+
+func (admin *AdminAPI) ResyncPuppet(w http.ResponseWriter, r *http.Request) {
+	jid, err := types.ParseJID(mux.Vars(r)["jid"])
+	if err != nil || jid.Server != types.DefaultUserServer {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   "Invalid user JID",
+			ErrCode: "M_INVALID_PARAM",
+		})
+		return
+	}
+	puppet := admin.bridge.GetPuppetByJID(jid)
+	user := admin.getSourceUser(r, nil)
+	if user == nil || !user.IsLoggedIn() {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   "No logged-in user found to resync the puppet with",
+			ErrCode: "no source user",
+		})
+		return
+	}
+	ctx := puppet.zlog.With().Str("action", "admin api resync").Logger().WithContext(context.Background())
+	go puppet.SyncContact(ctx, user, false, false, "admin api")
+	jsonResponse(w, http.StatusAccepted, Response{true, "Puppet resync started"})
+}
+
+func (admin *AdminAPI) GetPuppetActivity(w http.ResponseWriter, r *http.Request) {
+	report, err := admin.bridge.GetPuppetActivityReport(r.Context())
+	if err != nil {
+		hlog.FromRequest(r).Err(err).Msg("Failed to get puppet activity")
+		jsonResponse(w, http.StatusInternalServerError, Error{
+			Error:   "Failed to get puppet activity",
+			ErrCode: "M_UNKNOWN",
+		})
+		return
+	}
+	jsonResponse(w, http.StatusOK, report)
+}
+
+func (admin *AdminAPI) Health(w http.ResponseWriter, r *http.Request) {
+	var connected, loggedIn, withSession int
+	for _, user := range admin.bridge.GetAllUsers() {
+		if user.Session != nil {
+			withSession++
+		}
+		if user.IsConnected() {
+			connected++
+		}
+		if user.IsLoggedIn() {
+			loggedIn++
+		}
+	}
+	dbErr := admin.bridge.DB.RawDB.PingContext(r.Context())
+	resp := map[string]interface{}{
+		"uptime_seconds":     int64(time.Since(admin.startTime).Seconds()),
+		"database_ok":        dbErr == nil,
+		"users_with_session": withSession,
+		"users_connected":    connected,
+		"users_logged_in":    loggedIn,
+		"puppet_limit_hit":   admin.bridge.PuppetActivity.isBlocked,
+	}
+	statusCode := http.StatusOK
+	if dbErr != nil {
+		resp["database_error"] = dbErr.Error()
+		statusCode = http.StatusServiceUnavailable
+	}
+	jsonResponse(w, statusCode, resp)
+}
+
+type ReqCreateAnnouncement struct {
+	Message string    `json:"message"`
+	Sender  id.UserID `json:"sender,omitempty"`
+}
+
+type AdminAnnouncementInfo struct {
+	ID        int       `json:"id"`
+	Sender    id.UserID `json:"sender"`
+	Message   string    `json:"message"`
+	CreatedAt int64     `json:"created_at"`
+	SentCount int       `json:"sent_count"`
+	Completed bool      `json:"completed"`
+}
+
+func announcementToInfo(ann *database.Announcement) AdminAnnouncementInfo {
+	return AdminAnnouncementInfo{
+		ID:        ann.ID,
+		Sender:    ann.Sender,
+		Message:   ann.Message,
+		CreatedAt: ann.CreatedAt.UnixMilli(),
+		SentCount: ann.SentCount,
+		Completed: ann.Completed,
+	}
+}
+
+func (admin *AdminAPI) CreateAnnouncement(w http.ResponseWriter, r *http.Request) {
+	var req ReqCreateAnnouncement
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   "Failed to parse request JSON",
+			ErrCode: "bad json",
+		})
+		return
+	} else if strings.TrimSpace(req.Message) == "" {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   "Announcement message can't be empty",
+			ErrCode: "M_INVALID_PARAM",
+		})
+		return
+	}
+	if req.Sender == "" {
+		req.Sender = admin.bridge.Bot.UserID
+	}
+	ann, err := admin.bridge.StartAnnouncement(r.Context(), req.Sender, req.Message)
+	if err != nil {
+		hlog.FromRequest(r).Err(err).Msg("Failed to create announcement")
+		jsonResponse(w, http.StatusInternalServerError, Error{
+			Error:   "Failed to create announcement",
+			ErrCode: "M_UNKNOWN",
+		})
+		return
+	}
+	hlog.FromRequest(r).Info().Int("announcement_id", ann.ID).Msg("Started sending announcement")
+	jsonResponse(w, http.StatusAccepted, announcementToInfo(ann))
+}
+
+func (admin *AdminAPI) GetAnnouncement(w http.ResponseWriter, r *http.Request) {
+	announcementID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   "Invalid announcement ID",
+			ErrCode: "M_INVALID_PARAM",
+		})
+		return
+	}
+	ann, err := admin.bridge.DB.Announcement.GetByID(r.Context(), announcementID)
+	if err != nil {
+		hlog.FromRequest(r).Err(err).Msg("Failed to get announcement")
+		jsonResponse(w, http.StatusInternalServerError, Error{
+			Error:   "Failed to get announcement",
+			ErrCode: "M_UNKNOWN",
+		})
+	} else if ann == nil {
+		jsonResponse(w, http.StatusNotFound, Error{
+			Error:   "Announcement not found",
+			ErrCode: "M_NOT_FOUND",
+		})
+	} else {
+		jsonResponse(w, http.StatusOK, announcementToInfo(ann))
+	}
+}
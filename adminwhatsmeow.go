@@ -0,0 +1,253 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/hlog"
+	"go.mau.fi/whatsmeow/appstate"
+	"go.mau.fi/whatsmeow/types"
+)
+
+type AdminKeepAliveInfo struct {
+	Failing     bool       `json:"failing"`
+	ErrorCount  int        `json:"error_count"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+}
+
+type AdminWhatsAppState struct {
+	JID             string             `json:"jid,omitempty"`
+	Platform        string             `json:"platform,omitempty"`
+	PushName        string             `json:"push_name,omitempty"`
+	BusinessName    string             `json:"business_name,omitempty"`
+	Connected       bool               `json:"connected"`
+	LoggedIn        bool               `json:"logged_in"`
+	PhoneLastSeen   *time.Time         `json:"phone_last_seen,omitempty"`
+	KeepAlive       AdminKeepAliveInfo `json:"keepalive"`
+	AppStateVersion map[string]uint64  `json:"app_state_versions,omitempty"`
+}
+
+// GetUserWhatsAppState returns the whatsmeow device info of a user.
+func (admin *AdminAPI) GetUserWhatsAppState(w http.ResponseWriter, r *http.Request) {
+	user := admin.getUser(w, r)
+	if user == nil {
+		return
+	}
+	resp := AdminWhatsAppState{
+		Connected: user.IsConnected(),
+		LoggedIn:  user.IsLoggedIn(),
+	}
+	user.keepAliveLock.Lock()
+	errorCount, lastSuccess := user.keepAliveErrorCount, user.lastKeepAliveSuccess
+	user.keepAliveLock.Unlock()
+	resp.KeepAlive = AdminKeepAliveInfo{
+		Failing:    errorCount > 0,
+		ErrorCount: errorCount,
+	}
+	if !lastSuccess.IsZero() {
+		resp.KeepAlive.LastSuccess = &lastSuccess
+	}
+	if phoneLastSeen := user.PhoneLastSeen; !phoneLastSeen.IsZero() {
+		resp.PhoneLastSeen = &phoneLastSeen
+	}
+	// Devices that haven't finished pairing don't have an ID or app state yet
+	if device := user.Session; device != nil && device.ID != nil {
+		if device.ID != nil {
+			resp.JID = device.ID.String()
+		}
+		resp.Platform = device.Platform
+		resp.PushName = device.PushName
+		resp.BusinessName = device.BusinessName
+		resp.AppStateVersion = make(map[string]uint64, len(appstate.AllPatchNames))
+		for _, name := range appstate.AllPatchNames {
+			version, _, err := device.AppState.GetAppStateVersion(string(name))
+			if err != nil {
+				hlog.FromRequest(r).Warn().Err(err).Str("app_state_name", string(name)).Msg("Failed to get app state version")
+				continue
+			}
+			resp.AppStateVersion[string(name)] = version
+		}
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
+
+func (admin *AdminAPI) getUserAppStateName(w http.ResponseWriter, r *http.Request) (*User, appstate.WAPatchName) {
+	user := admin.getUser(w, r)
+	if user == nil {
+		return nil, ""
+	} else if user.Session == nil {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   "User is not logged in",
+			ErrCode: "not logged in",
+		})
+		return nil, ""
+	}
+	nameStr := mux.Vars(r)["name"]
+	name, ok := parseAppStatePatchName(nameStr)
+	if !ok {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   fmt.Sprintf("'%s' is not a valid app state patch name", nameStr),
+			ErrCode: "invalid-name-param",
+		})
+		return nil, ""
+	}
+	return user, name
+}
+
+// ClearUserAppState deletes the stored snapshot of an app state collection, which is useful when it's corrupted
+// and patches fail to apply. Unless ?resync=false is passed, the collection is then fully re-synced.
+func (admin *AdminAPI) ClearUserAppState(w http.ResponseWriter, r *http.Request) {
+	user, name := admin.getUserAppStateName(w, r)
+	if user == nil {
+		return
+	}
+	log := hlog.FromRequest(r).With().Stringer("user_id", user.MXID).Str("app_state_name", string(name)).Logger()
+	log.Info().Msg("Clearing app state snapshot")
+	err := user.Session.AppState.DeleteAppStateVersion(string(name))
+	if err != nil {
+		log.Err(err).Msg("Failed to clear app state snapshot")
+		jsonResponse(w, http.StatusInternalServerError, Error{
+			Error:   fmt.Sprintf("Failed to clear app state: %v", err),
+			ErrCode: "clear-fail",
+		})
+		return
+	}
+	if strings.ToLower(r.URL.Query().Get("resync")) == "false" || !user.IsLoggedIn() {
+		jsonResponse(w, http.StatusOK, Response{true, fmt.Sprintf("Cleared app state %s", name)})
+		return
+	}
+	err = user.Client.FetchAppState(name, true, false)
+	if err != nil {
+		log.Err(err).Msg("Failed to re-sync app state after clearing it")
+		jsonResponse(w, http.StatusInternalServerError, Error{
+			Error:   fmt.Sprintf("Cleared app state, but re-syncing failed: %v", err),
+			ErrCode: "sync-fail",
+		})
+		return
+	}
+	jsonResponse(w, http.StatusOK, Response{true, fmt.Sprintf("Cleared and re-synced app state %s", name)})
+}
+
+// SyncUserAppState forces a re-sync of a single app state collection. Pass ?full=true for a full sync.
+func (admin *AdminAPI) SyncUserAppState(w http.ResponseWriter, r *http.Request) {
+	user, name := admin.getUserAppStateName(w, r)
+	if user == nil {
+		return
+	} else if !user.IsLoggedIn() {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   "User is not connected to WhatsApp",
+			ErrCode: "not connected",
+		})
+		return
+	}
+	fullSync := strings.ToLower(r.URL.Query().Get("full")) == "true"
+	hlog.FromRequest(r).Info().
+		Stringer("user_id", user.MXID).
+		Str("app_state_name", string(name)).
+		Bool("full_sync", fullSync).
+		Msg("Re-syncing app state")
+	err := user.Client.FetchAppState(name, fullSync, false)
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, Error{false, err.Error(), "sync-fail"})
+	} else {
+		jsonResponse(w, http.StatusOK, Response{true, fmt.Sprintf("Synced app state %s", name)})
+	}
+}
+
+type AdminStaleDevice struct {
+	JID      string `json:"jid"`
+	Platform string `json:"platform,omitempty"`
+	PushName string `json:"push_name,omitempty"`
+}
+
+// ListStaleDevices lists device registrations in the whatsmeow store that don't belong to any bridge user.
+func (admin *AdminAPI) ListStaleDevices(w http.ResponseWriter, r *http.Request) {
+	devices, err := admin.bridge.WAContainer.GetAllDevices()
+	if err != nil {
+		hlog.FromRequest(r).Err(err).Msg("Failed to get devices")
+		jsonResponse(w, http.StatusInternalServerError, Error{
+			Error:   "Failed to get devices",
+			ErrCode: "M_UNKNOWN",
+		})
+		return
+	}
+	owners := admin.bridge.GetDeviceOwners()
+	resp := make([]AdminStaleDevice, 0)
+	for _, device := range devices {
+		if device.ID == nil {
+			continue
+		} else if _, inUse := owners[*device.ID]; inUse {
+			continue
+		}
+		resp = append(resp, AdminStaleDevice{
+			JID:      device.ID.String(),
+			Platform: device.Platform,
+			PushName: device.PushName,
+		})
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
+
+// DeleteStaleDevice deletes a device registration that isn't used by any bridge user.
+func (admin *AdminAPI) DeleteStaleDevice(w http.ResponseWriter, r *http.Request) {
+	jid, err := types.ParseJID(mux.Vars(r)["jid"])
+	if err != nil || jid.Server != types.DefaultUserServer {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   "Invalid device JID",
+			ErrCode: "M_INVALID_PARAM",
+		})
+		return
+	}
+	if owner, inUse := admin.bridge.GetDeviceOwners()[jid]; inUse {
+		jsonResponse(w, http.StatusConflict, Error{
+			Error:   fmt.Sprintf("Device is in use by %s, log the user out instead", owner.MXID),
+			ErrCode: "device in use",
+		})
+		return
+	}
+	device, err := admin.bridge.WAContainer.GetDevice(jid)
+	if err != nil {
+		hlog.FromRequest(r).Err(err).Stringer("device_jid", jid).Msg("Failed to get device")
+		jsonResponse(w, http.StatusInternalServerError, Error{
+			Error:   "Failed to get device",
+			ErrCode: "M_UNKNOWN",
+		})
+		return
+	} else if device == nil {
+		jsonResponse(w, http.StatusNotFound, Error{
+			Error:   "Device not found",
+			ErrCode: "M_NOT_FOUND",
+		})
+		return
+	}
+	hlog.FromRequest(r).Info().Stringer("device_jid", jid).Msg("Deleting stale device")
+	err = device.Delete()
+	if err != nil {
+		hlog.FromRequest(r).Err(err).Stringer("device_jid", jid).Msg("Failed to delete device")
+		jsonResponse(w, http.StatusInternalServerError, Error{
+			Error:   fmt.Sprintf("Failed to delete device: %v", err),
+			ErrCode: "M_UNKNOWN",
+		})
+		return
+	}
+	jsonResponse(w, http.StatusOK, Response{true, "Deleted device"})
+}
@@ -18,43 +18,110 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"regexp"
+	"sync"
 
 	"github.com/rs/zerolog"
+	"go.mau.fi/whatsmeow/types"
 
 	"github.com/element-hq/mautrix-go/id"
 )
 
 type AnalyticsClient struct {
-	url    string
-	key    string
-	userID string
-	log    zerolog.Logger
-	client http.Client
+	url      string
+	aliasURL string
+	key      string
+	userID   string
+	salt     string
+	log      zerolog.Logger
+	client   http.Client
+
+	optOut     map[id.UserID]struct{}
+	optOutLock sync.RWMutex
+
+	disabledEvents map[string]struct{}
 }
 
 var Analytics AnalyticsClient
 
-func (sc *AnalyticsClient) trackSync(userID id.UserID, event string, properties map[string]interface{}) error {
-	var buf bytes.Buffer
-	var analyticsUserID string
-	if Analytics.userID != "" {
-		analyticsUserID = Analytics.userID
-	} else {
-		analyticsUserID = userID.String()
-	}
-	err := json.NewEncoder(&buf).Encode(map[string]interface{}{
-		"userId":     analyticsUserID,
-		"event":      event,
-		"properties": properties,
+// pseudonymize hashes an identifier with the per-instance salt, so that events from the same user can be
+// correlated without revealing who the user is.
+func (sc *AnalyticsClient) pseudonymize(value string) string {
+	mac := hmac.New(sha256.New, []byte(sc.salt))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+func (sc *AnalyticsClient) PseudonymizeUserID(userID id.UserID) string {
+	return sc.pseudonymize(userID.String())
+}
+
+func (sc *AnalyticsClient) PseudonymizeJID(jid types.JID) string {
+	return sc.pseudonymize(jid.ToNonAD().String())
+}
+
+var (
+	identifierJIDRegex  = regexp.MustCompile(`[0-9-]+(?:[.:][0-9]+)*@(?:s\.whatsapp\.net|c\.us|g\.us|lid|newsletter|broadcast)`)
+	identifierMXIDRegex = regexp.MustCompile(`@[a-zA-Z0-9._=/+-]+:[a-zA-Z0-9.-]+(?::[0-9]+)?`)
+)
+
+// PseudonymizeText replaces all WhatsApp JIDs and Matrix user IDs in the given text with pseudonymized IDs.
+func (sc *AnalyticsClient) PseudonymizeText(text string) string {
+	text = identifierJIDRegex.ReplaceAllStringFunc(text, func(jid string) string {
+		return "jid:" + sc.pseudonymize(jid)
+	})
+	return identifierMXIDRegex.ReplaceAllStringFunc(text, func(mxid string) string {
+		return "mxid:" + sc.pseudonymize(mxid)
 	})
+}
+
+type pseudonymizedError struct {
+	wrapped error
+	message string
+}
+
+func (err *pseudonymizedError) Error() string {
+	return err.message
+}
+
+func (err *pseudonymizedError) Unwrap() error {
+	return err.wrapped
+}
+
+// PseudonymizeError wraps the error so that its message doesn't contain any user identifiers.
+func (sc *AnalyticsClient) PseudonymizeError(err error) error {
+	if err == nil {
+		return nil
+	}
+	message := sc.PseudonymizeText(err.Error())
+	if message == err.Error() {
+		return err
+	}
+	return &pseudonymizedError{wrapped: err, message: message}
+}
+
+func (sc *AnalyticsClient) getAnalyticsUserID(userID id.UserID) string {
+	if sc.userID != "" {
+		return sc.userID
+	}
+	return sc.PseudonymizeUserID(userID)
+}
+
+func (sc *AnalyticsClient) post(url string, payload map[string]interface{}) error {
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(payload)
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, sc.url, &buf)
+	req, err := http.NewRequest(http.MethodPost, url, &buf)
 	if err != nil {
 		return err
 	}
@@ -70,12 +137,63 @@ func (sc *AnalyticsClient) trackSync(userID id.UserID, event string, properties
 	return nil
 }
 
+func (sc *AnalyticsClient) trackSync(userID id.UserID, event string, properties map[string]interface{}) error {
+	return sc.post(sc.url, map[string]interface{}{
+		"userId":     sc.getAnalyticsUserID(userID),
+		"event":      event,
+		"properties": properties,
+	})
+}
+
+// Alias links the raw Matrix user ID that older versions sent to analytics with the pseudonymized ID.
+func (sc *AnalyticsClient) Alias(userID id.UserID) error {
+	return sc.post(sc.aliasURL, map[string]interface{}{
+		"previousId": userID.String(),
+		"userId":     sc.PseudonymizeUserID(userID),
+	})
+}
+
 func (sc *AnalyticsClient) IsEnabled() bool {
 	return len(sc.key) > 0
 }
 
+// SetOptOut marks whether events for the given user should be dropped instead of being tracked.
+func (sc *AnalyticsClient) SetOptOut(userID id.UserID, optOut bool) {
+	sc.optOutLock.Lock()
+	defer sc.optOutLock.Unlock()
+	if !optOut {
+		delete(sc.optOut, userID)
+		return
+	} else if sc.optOut == nil {
+		sc.optOut = make(map[id.UserID]struct{})
+	}
+	sc.optOut[userID] = struct{}{}
+}
+
+func (sc *AnalyticsClient) IsOptedOut(userID id.UserID) bool {
+	sc.optOutLock.RLock()
+	defer sc.optOutLock.RUnlock()
+	_, optedOut := sc.optOut[userID]
+	return optedOut
+}
+
+// SetEventsEnabled configures which event types are tracked. Events that aren't in the map are enabled.
+func (sc *AnalyticsClient) SetEventsEnabled(events map[string]bool) {
+	sc.disabledEvents = make(map[string]struct{})
+	for event, enabled := range events {
+		if !enabled {
+			sc.disabledEvents[event] = struct{}{}
+		}
+	}
+}
+
+func (sc *AnalyticsClient) IsEventEnabled(event string) bool {
+	_, disabled := sc.disabledEvents[event]
+	return !disabled
+}
+
 func (sc *AnalyticsClient) Track(userID id.UserID, event string, properties ...map[string]interface{}) {
-	if !sc.IsEnabled() {
+	if !sc.IsEnabled() || sc.IsOptedOut(userID) || !sc.IsEventEnabled(event) {
 		return
 	} else if len(properties) > 1 {
 		panic("Track should be called with at most one property map")
@@ -95,3 +213,29 @@ func (sc *AnalyticsClient) Track(userID id.UserID, event string, properties ...m
 		}
 	}()
 }
+
+// MigrateAnalyticsIDs links the raw Matrix user IDs that were sent to analytics before user IDs were
+// pseudonymized to the new IDs, so that the history of existing users isn't split in two. Aliasing sends
+// the raw user IDs to the analytics server once more, so it's only done if explicitly enabled in the config.
+func (br *WABridge) MigrateAnalyticsIDs() {
+	if !Analytics.IsEnabled() || Analytics.userID != "" || !br.Config.Analytics.AliasLegacyIDs {
+		return
+	}
+	log := br.ZLog.With().Str("action", "migrate analytics ids").Logger()
+	ctx := log.WithContext(context.Background())
+	for _, user := range br.GetAllUsers() {
+		if user.AnalyticsAliased || user.AnalyticsOptOut {
+			continue
+		}
+		err := Analytics.Alias(user.MXID)
+		if err != nil {
+			log.Err(err).Stringer("user_id", user.MXID).Msg("Failed to alias analytics user ID")
+			continue
+		}
+		user.AnalyticsAliased = true
+		err = user.Update(ctx)
+		if err != nil {
+			log.Err(err).Stringer("user_id", user.MXID).Msg("Failed to save analytics alias status")
+		}
+	}
+}
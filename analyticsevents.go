@@ -0,0 +1,125 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"github.com/element-hq/mautrix-go/id"
+)
+
+// The catalog of lifecycle events sent to the analytics endpoint. All events also have the "bridge" property set to
+// "whatsapp", and user identifiers are always pseudonymized. Any event can be disabled with analytics.events in
+// the config.
+const (
+	// AnalyticsLoginStart is sent when a login is started.
+	// Properties: source ("command", "provisioning" or "bulk"), method ("qr" or "phone_code").
+	AnalyticsLoginStart = "$login_start"
+	// AnalyticsQRCodeRetrieved is sent when a QR code is shown during a login. Properties: source, method.
+	AnalyticsQRCodeRetrieved = "$qrcode_retrieved"
+	// AnalyticsLoginSuccess is sent when a login succeeds.
+	// Properties: source, method, platform (the platform of the phone as reported by WhatsApp).
+	AnalyticsLoginSuccess = "$login_success"
+	// AnalyticsLoginFailure is sent when a login fails.
+	// Properties: source, method, error (a machine-readable reason like "login timed out" or "too many devices").
+	AnalyticsLoginFailure = "$login_failure"
+	// AnalyticsFirstMessageBridged is sent for the first message bridged after a login.
+	// Properties: direction ("to_matrix" or "to_whatsapp"), chat_type ("private", "group", "broadcast" or "newsletter").
+	AnalyticsFirstMessageBridged = "$first_message_bridged"
+	// AnalyticsBackfillComplete is sent when the backfill of a chat is finished.
+	// Properties: chat_type, message_count (the number of messages in the last backfill batch).
+	AnalyticsBackfillComplete = "$backfill_complete"
+	// AnalyticsLogout is sent when a user is logged out.
+	// Properties: reason ("user" if the user logged out through the bridge, otherwise the WhatsApp logout reason).
+	AnalyticsLogout = "$logout"
+	// AnalyticsPermanentDisconnect is sent when the connection is lost in a way that the bridge won't recover from
+	// without user action. Properties: category (the stream error category, like "conflict").
+	AnalyticsPermanentDisconnect = "$permanent_disconnect"
+)
+
+const (
+	AnalyticsSourceCommand      = "command"
+	AnalyticsSourceProvisioning = "provisioning"
+	AnalyticsSourceBulk         = "bulk"
+)
+
+// loginAnalytics tracks the lifecycle events of a single login attempt.
+type loginAnalytics struct {
+	userID id.UserID
+	source string
+	method string
+}
+
+func newLoginAnalytics(userID id.UserID, source, phoneNumber string) *loginAnalytics {
+	method := "qr"
+	if phoneNumber != "" {
+		method = "phone_code"
+	}
+	return &loginAnalytics{userID: userID, source: source, method: method}
+}
+
+func (la *loginAnalytics) track(event string, extra map[string]interface{}) {
+	props := map[string]interface{}{
+		"source": la.source,
+		"method": la.method,
+	}
+	for key, value := range extra {
+		props[key] = value
+	}
+	Analytics.Track(la.userID, event, props)
+}
+
+func (la *loginAnalytics) Start() {
+	la.track(AnalyticsLoginStart, nil)
+}
+
+func (la *loginAnalytics) QRCodeRetrieved() {
+	la.track(AnalyticsQRCodeRetrieved, nil)
+}
+
+func (la *loginAnalytics) Success(platform string) {
+	la.track(AnalyticsLoginSuccess, map[string]interface{}{"platform": platform})
+}
+
+func (la *loginAnalytics) Failure(errCode string) {
+	la.track(AnalyticsLoginFailure, map[string]interface{}{"error": errCode})
+}
+
+func (portal *Portal) analyticsChatType() string {
+	switch {
+	case portal.IsPrivateChat():
+		return "private"
+	case portal.IsGroupChat():
+		return "group"
+	case portal.IsNewsletter():
+		return "newsletter"
+	case portal.IsBroadcastList():
+		return "broadcast"
+	default:
+		return "unknown"
+	}
+}
+
+// trackFirstMessageBridged sends the first message event if this is the first message bridged since the user
+// logged in.
+func (user *User) trackFirstMessageBridged(portal *Portal, direction string) {
+	if !user.firstMessagePending.CompareAndSwap(true, false) {
+		return
+	}
+	Analytics.Track(user.MXID, AnalyticsFirstMessageBridged, map[string]interface{}{
+		"direction": direction,
+		"chat_type": portal.analyticsChatType(),
+	})
+}
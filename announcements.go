@@ -0,0 +1,99 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/element-hq/mautrix-go/event"
+	"github.com/element-hq/mautrix-go/format"
+	"github.com/element-hq/mautrix-go/id"
+
+	"github.com/element-hq/mautrix-whatsapp/database"
+)
+
+// StartAnnouncement saves a new announcement and starts sending it to all management rooms in the background.
+// The returned announcement is a snapshot, as the original is modified by the sender goroutine.
+func (br *WABridge) StartAnnouncement(ctx context.Context, sender id.UserID, message string) (*database.Announcement, error) {
+	ann := br.DB.Announcement.New()
+	ann.Sender = sender
+	ann.Message = message
+	ann.CreatedAt = time.Now()
+	err := ann.Insert(ctx)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := *ann
+	go br.runAnnouncement(ann)
+	return &snapshot, nil
+}
+
+// ResumeAnnouncements continues sending any announcements that were interrupted by a restart.
+func (br *WABridge) ResumeAnnouncements() {
+	announcements, err := br.DB.Announcement.GetIncomplete(context.Background())
+	if err != nil {
+		br.ZLog.Err(err).Msg("Failed to get incomplete announcements")
+		return
+	}
+	for _, ann := range announcements {
+		br.runAnnouncement(ann)
+	}
+}
+
+func (br *WABridge) runAnnouncement(ann *database.Announcement) {
+	log := br.ZLog.With().Str("action", "send announcement").Int("announcement_id", ann.ID).Logger()
+	ctx := log.WithContext(context.Background())
+	br.announcementLock.Lock()
+	defer br.announcementLock.Unlock()
+
+	users := br.GetAllUsers()
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].MXID < users[j].MXID
+	})
+	content := format.RenderMarkdown(ann.Message, true, false)
+	content.MsgType = event.MsgNotice
+	log.Info().Int("user_count", len(users)).Stringer("last_user", ann.LastUser).Msg("Sending announcement")
+	for _, user := range users {
+		if ann.LastUser != "" && user.MXID <= ann.LastUser {
+			continue
+		} else if len(user.ManagementRoom) > 0 {
+			_, err := br.Bot.SendMessageEvent(ctx, user.ManagementRoom, event.EventMessage, &content)
+			if err != nil {
+				log.Warn().Err(err).Stringer("user_id", user.MXID).Msg("Failed to send announcement to user")
+			} else {
+				ann.SentCount++
+			}
+			time.Sleep(br.Config.Bridge.Announcements.Interval)
+		}
+		ann.LastUser = user.MXID
+		br.saveAnnouncement(ctx, ann)
+	}
+	ann.Completed = true
+	br.saveAnnouncement(ctx, ann)
+	log.Info().Int("sent_count", ann.SentCount).Msg("Finished sending announcement")
+}
+
+func (br *WABridge) saveAnnouncement(ctx context.Context, ann *database.Announcement) {
+	err := ann.Update(ctx)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to save announcement progress")
+	}
+}
@@ -0,0 +1,241 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/element-hq/mautrix-go"
+	"github.com/element-hq/mautrix-go/bridge/commands"
+	"github.com/element-hq/mautrix-go/event"
+	"github.com/element-hq/mautrix-go/id"
+
+	"github.com/element-hq/mautrix-whatsapp/database"
+)
+
+const archivedRoomNameSuffix = " (archived)"
+
+// shouldArchiveDeparted checks if the portal should be turned into a read-only archive
+// instead of removing the source user when they leave a group.
+func (portal *Portal) shouldArchiveDeparted(ctx context.Context, source *User, jids []types.JID) bool {
+	if !portal.bridge.Config.Bridge.ArchiveDepartedGroups || source == nil || source.JID.IsEmpty() ||
+		!portal.IsGroupChat() || len(portal.MXID) == 0 {
+		return false
+	}
+	var sourceLeft bool
+	for _, jid := range jids {
+		if jid.User == source.JID.User {
+			sourceLeft = true
+			break
+		}
+	}
+	if !sourceLeft {
+		return false
+	}
+	users, err := portal.GetMatrixUsers(ctx)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to get Matrix users to check if departed group can be archived")
+		return false
+	}
+	for _, userID := range users {
+		if userID == source.MXID {
+			continue
+		}
+		// Other logged-in users still use the portal, so it can't be unlinked from the chat.
+		if user := portal.bridge.GetUserByMXIDIfExists(userID); user != nil && user.IsLoggedIn() {
+			return false
+		}
+	}
+	return true
+}
+
+// ArchiveDeparted turns the portal of a group the user has left into a read-only archive room.
+// The room keeps its history, but is unlinked from the chat and moved to the user's archive space.
+func (portal *Portal) ArchiveDeparted(ctx context.Context, source *User) {
+	log := zerolog.Ctx(ctx)
+	log.Info().Msg("User left group, archiving portal")
+	roomID := portal.MXID
+	name := portal.Name
+	if name == "" {
+		name = portal.Key.JID.User
+	}
+	intent := portal.MainIntent()
+	_, err := intent.SetRoomName(ctx, roomID, name+archivedRoomNameSuffix)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to rename archived room")
+	}
+	portal.archive(ctx, "you are no longer in the group", true)
+
+	if source.SpaceRoom != "" {
+		_, err = portal.bridge.Bot.SendStateEvent(ctx, source.SpaceRoom, event.StateSpaceChild, roomID.String(), &event.SpaceChildEventContent{})
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to remove archived room from personal filtering space")
+		}
+	}
+	if archiveSpace := source.GetArchiveSpace(ctx); archiveSpace != "" {
+		_, err = portal.bridge.Bot.SendStateEvent(ctx, archiveSpace, event.StateSpaceChild, roomID.String(), &event.SpaceChildEventContent{
+			Via: []string{portal.bridge.Config.Homeserver.Domain},
+		})
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to add archived room to archive space")
+		}
+	}
+
+	archived := portal.bridge.DB.ArchivedRoom.New()
+	archived.RoomID = roomID
+	archived.UserMXID = source.MXID
+	archived.ChatJID = portal.Key.JID
+	archived.Name = name
+	archived.ArchivedAt = time.Now()
+	err = archived.Insert(ctx)
+	if err != nil {
+		log.Err(err).Msg("Failed to save archived room to database")
+	}
+}
+
+// GetArchiveSpace returns the space that contains the user's archived groups, creating it if necessary.
+func (user *User) GetArchiveSpace(ctx context.Context) id.RoomID {
+	user.archiveSpaceCreateLock.Lock()
+	defer user.archiveSpaceCreateLock.Unlock()
+	if len(user.ArchiveSpaceRoom) > 0 {
+		return user.ArchiveSpaceRoom
+	}
+	resp, err := user.bridge.Bot.CreateRoom(ctx, &mautrix.ReqCreateRoom{
+		Visibility: "private",
+		Name:       "WhatsApp Archive",
+		Topic:      "WhatsApp groups you are no longer in",
+		CreationContent: map[string]interface{}{
+			"type": event.RoomTypeSpace,
+		},
+		PowerLevelOverride: &event.PowerLevelsEventContent{
+			Users: map[id.UserID]int{
+				user.bridge.Bot.UserID: 9001,
+				user.MXID:              50,
+			},
+		},
+	})
+	if err != nil {
+		user.zlog.Err(err).Msg("Failed to create archive space")
+		return ""
+	}
+	user.ArchiveSpaceRoom = resp.RoomID
+	err = user.Update(ctx)
+	if err != nil {
+		user.zlog.Err(err).Msg("Failed to save user after creating archive space")
+	}
+	user.ensureInvited(ctx, user.bridge.Bot, user.ArchiveSpaceRoom, false)
+	return user.ArchiveSpaceRoom
+}
+
+// PurgeArchivedRoom deletes an archived room entirely and removes it from the archive space.
+func (br *WABridge) PurgeArchivedRoom(ctx context.Context, archived *database.ArchivedRoom) error {
+	log := zerolog.Ctx(ctx).With().Stringer("room_id", archived.RoomID).Logger()
+	intent := br.Bot
+	deleted := false
+	if br.SpecVersions.Supports(mautrix.BeeperFeatureRoomYeeting) {
+		err := intent.BeeperDeleteRoom(ctx, archived.RoomID)
+		if err == nil || errors.Is(err, mautrix.MNotFound) {
+			deleted = true
+		} else {
+			log.Warn().Err(err).Msg("Failed to delete archived room using beeper yeet endpoint, falling back to normal behavior")
+		}
+	}
+	if !deleted {
+		members, err := intent.JoinedMembers(ctx, archived.RoomID)
+		if err != nil {
+			return fmt.Errorf("failed to get room members: %w", err)
+		}
+		for member := range members.Joined {
+			if member == intent.UserID {
+				continue
+			}
+			_, err = intent.KickUser(ctx, archived.RoomID, &mautrix.ReqKickUser{UserID: member, Reason: "Purging archived room"})
+			if err != nil {
+				log.Err(err).Stringer("user_mxid", member).Msg("Failed to kick user while purging archived room")
+			}
+		}
+		_, err = intent.LeaveRoom(ctx, archived.RoomID)
+		if err != nil {
+			log.Err(err).Msg("Failed to leave archived room")
+		}
+	}
+	if user := br.GetUserByMXIDIfExists(archived.UserMXID); user != nil && user.ArchiveSpaceRoom != "" {
+		_, err := intent.SendStateEvent(ctx, user.ArchiveSpaceRoom, event.StateSpaceChild, archived.RoomID.String(), &event.SpaceChildEventContent{})
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to remove purged room from archive space")
+		}
+	}
+	return archived.Delete(ctx)
+}
+
+var cmdPurgeArchive = &commands.FullHandler{
+	Func: wrapCommand(fnPurgeArchive),
+	Name: "purge-archive",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionPortalManagement,
+		Description: "Delete an archived group room. Without arguments, lists your archived rooms or purges the current room if it's archived.",
+		Args:        "[room ID]",
+	},
+}
+
+func fnPurgeArchive(ce *WrappedCommandEvent) {
+	roomID := ce.RoomID
+	if len(ce.Args) > 0 {
+		roomID = id.RoomID(ce.Args[0])
+	}
+	archived, err := ce.Bridge.DB.ArchivedRoom.GetByRoomID(ce.Ctx, roomID)
+	if err != nil {
+		ce.ZLog.Err(err).Msg("Failed to get archived room")
+		ce.Reply("Failed to get archived room: %v", err)
+		return
+	} else if archived == nil && len(ce.Args) > 0 {
+		ce.Reply("That room is not an archived group")
+		return
+	} else if archived == nil {
+		archivedRooms, err := ce.Bridge.DB.ArchivedRoom.GetAllByUser(ce.Ctx, ce.User.MXID)
+		if err != nil {
+			ce.ZLog.Err(err).Msg("Failed to get archived rooms")
+			ce.Reply("Failed to get archived rooms: %v", err)
+		} else if len(archivedRooms) == 0 {
+			ce.Reply("You don't have any archived groups")
+		} else {
+			lines := make([]string, len(archivedRooms))
+			for i, room := range archivedRooms {
+				lines[i] = fmt.Sprintf("* %s (`%s`) - archived %s", room.Name, room.RoomID, room.ArchivedAt.Format(time.DateOnly))
+			}
+			ce.Reply("Archived groups:\n\n%s\n\nUse `$cmdprefix purge-archive <room ID>` to delete one.", strings.Join(lines, "\n"))
+		}
+		return
+	} else if archived.UserMXID != ce.User.MXID && !ce.User.Admin {
+		ce.Reply("Only the owner of the archived room or a bridge admin can purge it")
+		return
+	}
+	err = ce.Bridge.PurgeArchivedRoom(ce.Ctx, archived)
+	if err != nil {
+		ce.ZLog.Err(err).Stringer("room_id", archived.RoomID).Msg("Failed to purge archived room")
+		ce.Reply("Failed to purge archived room: %v", err)
+	} else if archived.RoomID != ce.RoomID {
+		ce.Reply("Purged archived room %s", archived.Name)
+	}
+}
@@ -0,0 +1,82 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/element-hq/mautrix-go"
+)
+
+// SyncAuxiliaryUsers makes sure all configured auxiliary users are invited to existing portals
+// and have the configured power levels.
+func (br *WABridge) SyncAuxiliaryUsers() {
+	log := br.ZLog.With().Str("action", "sync auxiliary users").Logger()
+	ctx := log.WithContext(context.Background())
+	portals := br.GetAllPortals()
+	log.Info().Int("portal_count", len(portals)).Msg("Syncing auxiliary users to existing portals")
+	updated := 0
+	for _, portal := range portals {
+		if len(portal.MXID) == 0 {
+			continue
+		}
+		if portal.ensureAuxiliaryUsers(ctx) {
+			updated++
+			// Don't flood the homeserver with invites and power level changes
+			time.Sleep(1 * time.Second)
+		}
+	}
+	log.Info().Int("updated_portals", updated).Msg("Finished syncing auxiliary users")
+}
+
+func (portal *Portal) ensureAuxiliaryUsers(ctx context.Context) bool {
+	log := zerolog.Ctx(ctx).With().Stringer("room_id", portal.MXID).Logger()
+	levels, err := portal.MainIntent().PowerLevels(ctx, portal.MXID)
+	if err != nil {
+		log.Err(err).Msg("Failed to get power levels")
+		return false
+	}
+	updated := false
+	if portal.applyPowerLevelFixes(levels) {
+		_, err = portal.MainIntent().SetPowerLevels(ctx, portal.MXID, levels)
+		if err != nil {
+			log.Err(err).Msg("Failed to set power levels for auxiliary users")
+		} else {
+			updated = true
+		}
+	}
+	for userID := range portal.bridge.Config.Bridge.AuxiliaryUsers.Users {
+		// Only invite users who have never been in the room, so that auxiliary users who left
+		// or were kicked or banned by room admins aren't pulled back in on every startup.
+		if member, err := portal.bridge.StateStore.TryGetMember(ctx, portal.MXID, userID); err != nil {
+			log.Err(err).Stringer("user_id", userID).Msg("Failed to get membership of auxiliary user")
+			continue
+		} else if member != nil {
+			continue
+		}
+		_, err = portal.MainIntent().InviteUser(ctx, portal.MXID, &mautrix.ReqInviteUser{UserID: userID})
+		if err != nil {
+			log.Err(err).Stringer("user_id", userID).Msg("Failed to invite auxiliary user")
+		} else {
+			updated = true
+		}
+	}
+	return updated
+}
@@ -0,0 +1,245 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/socket"
+	"go.mau.fi/whatsmeow/types/events"
+	"go.mau.fi/whatsmeow/util/cbcutil"
+	"go.mau.fi/whatsmeow/util/hkdfutil"
+
+	"github.com/element-hq/mautrix-go/appservice"
+	"github.com/element-hq/mautrix-go/event"
+)
+
+// bandwidthLimiter spreads out transfers so that their average speed stays under a limit.
+// The zero value is ready to use.
+type bandwidthLimiter struct {
+	lock sync.Mutex
+	next time.Time
+}
+
+// wait reserves n bytes of bandwidth and sleeps until the transfer fits within the limit.
+func (bl *bandwidthLimiter) wait(n int, bytesPerSecond int64) {
+	if bytesPerSecond <= 0 || n <= 0 {
+		return
+	}
+	bl.lock.Lock()
+	now := time.Now()
+	if bl.next.Before(now) {
+		bl.next = now
+	}
+	sleepUntil := bl.next
+	bl.next = bl.next.Add(time.Duration(int64(n) * int64(time.Second) / bytesPerSecond))
+	bl.lock.Unlock()
+	time.Sleep(time.Until(sleepUntil))
+}
+
+// throttledReader limits how fast a download is read, so the limit applies while the transfer is in progress.
+type throttledReader struct {
+	reader         io.Reader
+	limiter        *bandwidthLimiter
+	bytesPerSecond int64
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	// Read in small chunks so a single read can't burst far past the limit.
+	if maxChunk := int(tr.bytesPerSecond / 4); maxChunk > 0 && len(p) > maxChunk {
+		p = p[:maxChunk]
+	}
+	n, err := tr.reader.Read(p)
+	tr.limiter.wait(n, tr.bytesPerSecond)
+	return n, err
+}
+
+var backfillMediaHTTPClient = &http.Client{Timeout: 10 * time.Minute}
+
+// downloadBackfillMedia downloads the media of a backfilled message, throttled to the configured
+// history sync download speed. Media that only has a direct path goes through whatsmeow, which
+// needs the media connection hosts, so the bandwidth is reserved before the download starts instead.
+func (portal *Portal) downloadBackfillMedia(ctx context.Context, source *User, msg MediaMessage) ([]byte, error) {
+	bytesPerSecond := portal.bridge.Config.Bridge.HistorySync.Media.MaxDownloadKBps * 1024
+	if bytesPerSecond <= 0 {
+		return source.Client.Download(msg)
+	}
+	var url string
+	if urlable, ok := msg.(interface{ GetUrl() string }); ok {
+		url = urlable.GetUrl()
+	}
+	if len(url) == 0 || strings.HasPrefix(url, "https://web.whatsapp.net") || len(msg.GetMediaKey()) == 0 {
+		portal.bridge.backfillMediaLimiter.wait(int(msg.GetFileLength()), bytesPerSecond)
+		return source.Client.Download(msg)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare request: %w", err)
+	}
+	req.Header.Set("Origin", socket.Origin)
+	req.Header.Set("Referer", socket.Origin+"/")
+	resp, err := backfillMediaHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, whatsmeow.DownloadHTTPError{Response: resp}
+	}
+	encrypted, err := io.ReadAll(&throttledReader{
+		reader:         resp.Body,
+		limiter:        &portal.bridge.backfillMediaLimiter,
+		bytesPerSecond: bytesPerSecond,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return decryptWhatsAppMedia(msg, encrypted)
+}
+
+// decryptWhatsAppMedia validates and decrypts downloaded media the same way whatsmeow's Client.Download does.
+func decryptWhatsAppMedia(msg MediaMessage, encrypted []byte) ([]byte, error) {
+	if len(encrypted) <= 10 {
+		return nil, whatsmeow.ErrTooShortFile
+	} else if encSHA256 := msg.GetFileEncSha256(); len(encSHA256) == 32 && sha256.Sum256(encrypted) != *(*[32]byte)(encSHA256) {
+		return nil, whatsmeow.ErrInvalidMediaEncSHA256
+	}
+	file, mac := encrypted[:len(encrypted)-10], encrypted[len(encrypted)-10:]
+	mediaKeyExpanded := hkdfutil.SHA256(msg.GetMediaKey(), nil, []byte(whatsmeow.GetMediaType(msg)), 112)
+	iv, cipherKey, macKey := mediaKeyExpanded[:16], mediaKeyExpanded[16:48], mediaKeyExpanded[48:80]
+	h := hmac.New(sha256.New, macKey)
+	h.Write(iv)
+	h.Write(file)
+	if !hmac.Equal(h.Sum(nil)[:10], mac) {
+		return nil, whatsmeow.ErrInvalidMediaHMAC
+	}
+	data, err := cbcutil.Decrypt(cipherKey, iv, file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt file: %w", err)
+	} else if len(data) != int(msg.GetFileLength()) {
+		return data, fmt.Errorf("%w: expected %d, got %d", whatsmeow.ErrFileLengthMismatch, msg.GetFileLength(), len(data))
+	} else if fileSHA256 := msg.GetFileSha256(); len(fileSHA256) == 32 && sha256.Sum256(data) != *(*[32]byte)(fileSHA256) {
+		return data, whatsmeow.ErrInvalidMediaSHA256
+	}
+	return data, nil
+}
+
+func isMediaMessage(waMsg *waProto.Message) bool {
+	return waMsg.ImageMessage != nil || waMsg.StickerMessage != nil || waMsg.VideoMessage != nil ||
+		waMsg.PtvMessage != nil || waMsg.AudioMessage != nil || waMsg.DocumentMessage != nil
+}
+
+// backfillMessage is a parsed history sync message that is waiting to be converted.
+type backfillMessage struct {
+	ctx       context.Context
+	raw       *waProto.WebMessageInfo
+	evt       *events.Message
+	intent    *appservice.IntentAPI
+	converted *ConvertedMessage
+}
+
+// convertBackfillMessages converts a batch of history sync messages. Media messages are converted by a bounded
+// pool of workers, as downloading, converting and uploading media is by far the slowest part of backfilling.
+func (portal *Portal) convertBackfillMessages(source *User, messages []*backfillMessage) {
+	workers := portal.bridge.Config.Bridge.HistorySync.Media.Workers
+	if workers <= 1 {
+		for _, msg := range messages {
+			msg.converted = portal.convertMessage(msg.ctx, msg.intent, source, &msg.evt.Info, msg.evt.Message, true)
+		}
+		return
+	}
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for _, msg := range messages {
+		if !isMediaMessage(msg.evt.Message) {
+			msg.converted = portal.convertMessage(msg.ctx, msg.intent, source, &msg.evt.Info, msg.evt.Message, true)
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(msg *backfillMessage) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			msg.converted = portal.convertMessage(msg.ctx, msg.intent, source, &msg.evt.Info, msg.evt.Message, true)
+		}(msg)
+	}
+	wg.Wait()
+}
+
+func (portal *Portal) canDeduplicateMedia(fileSHA256 []byte) bool {
+	return portal.bridge.Config.Bridge.HistorySync.Media.Deduplicate && !portal.Encrypted && len(fileSHA256) > 0
+}
+
+// getCachedMedia fills the content of a backfilled media message from a previous upload of the same file.
+func (portal *Portal) getCachedMedia(ctx context.Context, fileSHA256 []byte, content *event.MessageEventContent) bool {
+	if !portal.canDeduplicateMedia(fileSHA256) {
+		return false
+	}
+	cached, err := portal.bridge.DB.MediaCache.Get(ctx, hex.EncodeToString(fileSHA256))
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to get cached media")
+		return false
+	} else if cached == nil {
+		return false
+	}
+	content.URL = cached.MXC
+	content.Info.Size = cached.Size
+	if cached.MimeType != "" {
+		content.Info.MimeType = cached.MimeType
+	}
+	if content.Info.Width == 0 && content.Info.Height == 0 {
+		content.Info.Width, content.Info.Height = cached.Width, cached.Height
+	}
+	if strings.HasPrefix(content.Info.MimeType, "image/") && content.Info.ThumbnailInfo == nil {
+		infoCopy := *content.Info
+		content.Info.ThumbnailInfo = &infoCopy
+		content.Info.ThumbnailURL = content.URL
+	}
+	zerolog.Ctx(ctx).Debug().Str("mxc", string(cached.MXC)).Msg("Reusing previous upload of backfilled media")
+	return true
+}
+
+func (portal *Portal) cacheMedia(ctx context.Context, fileSHA256 []byte, content *event.MessageEventContent) {
+	if !portal.canDeduplicateMedia(fileSHA256) || content.URL == "" {
+		return
+	}
+	cached := portal.bridge.DB.MediaCache.New()
+	cached.FileSHA256 = hex.EncodeToString(fileSHA256)
+	cached.MXC = content.URL
+	cached.MimeType = content.Info.MimeType
+	cached.Size = content.Info.Size
+	cached.Width, cached.Height = content.Info.Width, content.Info.Height
+	cached.CreatedAt = time.Now()
+	err := cached.Upsert(ctx)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to cache uploaded media")
+	}
+}
@@ -18,18 +18,109 @@ package main
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog"
+	"golang.org/x/sync/semaphore"
 
 	"github.com/element-hq/mautrix-go/id"
 
 	"github.com/element-hq/mautrix-whatsapp/database"
 )
 
+// BackfillScheduler limits how many backfill tasks are processed at the same time across all users,
+// and how quickly new tasks are started, so that backfilling doesn't overload the homeserver.
+type BackfillScheduler struct {
+	sem       *semaphore.Weighted
+	taskDelay time.Duration
+
+	nextStart     time.Time
+	nextStartLock sync.Mutex
+}
+
+func NewBackfillScheduler(maxConcurrent int, taskDelay time.Duration) *BackfillScheduler {
+	bs := &BackfillScheduler{taskDelay: taskDelay}
+	if maxConcurrent > 0 {
+		bs.sem = semaphore.NewWeighted(int64(maxConcurrent))
+	}
+	return bs
+}
+
+func (bs *BackfillScheduler) Acquire(ctx context.Context) error {
+	if bs.sem != nil {
+		err := bs.sem.Acquire(ctx, 1)
+		if err != nil {
+			return err
+		}
+	}
+	bs.nextStartLock.Lock()
+	wait := time.Until(bs.nextStart)
+	if wait < 0 {
+		wait = 0
+	}
+	bs.nextStart = time.Now().Add(wait + bs.taskDelay)
+	bs.nextStartLock.Unlock()
+	if wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			bs.Release()
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (bs *BackfillScheduler) Release() {
+	if bs.sem != nil {
+		bs.sem.Release(1)
+	}
+}
+
 type BackfillQueue struct {
 	BackfillQuery   *database.BackfillTaskQuery
+	SchedulerQuery  *database.BackfillSchedulerQuery
 	reCheckChannels []chan bool
+
+	paused atomic.Bool
+}
+
+func (bq *BackfillQueue) LoadState(ctx context.Context, userID id.UserID) {
+	state, err := bq.SchedulerQuery.GetByUser(ctx, userID)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to get backfill scheduler state")
+	} else if state != nil {
+		bq.paused.Store(state.Paused)
+	}
+	// This is called before the user's backfill workers are started, so any task that was dispatched
+	// until now belongs to a worker that died with the previous bridge process.
+	err = bq.BackfillQuery.ResetInFlight(ctx, userID, time.Now())
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to reset interrupted backfill tasks")
+	}
+}
+
+func (bq *BackfillQueue) IsPaused() bool {
+	return bq.paused.Load()
+}
+
+func (bq *BackfillQueue) SetPaused(ctx context.Context, userID id.UserID, paused bool) error {
+	state := bq.SchedulerQuery.New(userID)
+	state.Paused = paused
+	if paused {
+		state.PausedAt = time.Now()
+	}
+	err := state.Upsert(ctx)
+	if err != nil {
+		return err
+	}
+	bq.paused.Store(paused)
+	if !paused {
+		bq.ReCheck()
+	}
+	return nil
 }
 
 func (bq *BackfillQueue) ReCheck() {
@@ -42,7 +133,7 @@ func (bq *BackfillQueue) ReCheck() {
 
 func (bq *BackfillQueue) GetNextBackfill(ctx context.Context, userID id.UserID, backfillTypes []database.BackfillType, waitForBackfillTypes []database.BackfillType, reCheckChannel chan bool) *database.BackfillTask {
 	for {
-		if !bq.BackfillQuery.HasUnstartedOrInFlightOfType(ctx, userID, waitForBackfillTypes) {
+		if !bq.IsPaused() && !bq.BackfillQuery.HasUnstartedOrInFlightOfType(ctx, userID, waitForBackfillTypes) {
 			// check for immediate when dealing with deferred
 			if backfill, err := bq.BackfillQuery.GetNext(ctx, userID, backfillTypes); err != nil {
 				zerolog.Ctx(ctx).Err(err).Msg("Failed to get next backfill task")
@@ -128,7 +219,21 @@ func (user *User) HandleBackfillRequestsLoop(backfillTypes []database.BackfillTy
 			}
 		}
 
+		err = user.bridge.BackfillScheduler.Acquire(ctx)
+		if err != nil {
+			log.Err(err).Msg("Failed to wait for backfill scheduler")
+			continue
+		}
 		user.backfillInChunks(ctx, req, conv, portal)
+		user.bridge.BackfillScheduler.Release()
+		if user.BackfillQueue.IsPaused() {
+			// Leave the task unfinished so that the rest of it is backfilled after resuming
+			err = req.MarkUndispatched(ctx)
+			if err != nil {
+				log.Err(err).Msg("Failed to reset backfill request after pausing")
+			}
+			continue
+		}
 		err = req.MarkDone(ctx)
 		if err != nil {
 			log.Err(err).Msg("Failed to mark backfill request as done after backfilling")
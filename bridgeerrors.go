@@ -0,0 +1,171 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rs/zerolog"
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/element-hq/mautrix-go/event"
+	"github.com/element-hq/mautrix-go/id"
+
+	"github.com/element-hq/mautrix-whatsapp/database"
+)
+
+// TypeBridgeError is a machine-readable event sent alongside error notices, so that bots in the room
+// can react to bridging failures without parsing the human-readable notice text.
+var TypeBridgeError = event.Type{Type: "fi.mau.whatsapp.error", Class: event.MessageEventType}
+
+type BridgeErrorDirection string
+
+const (
+	BridgeErrorToWhatsApp BridgeErrorDirection = "matrix_to_whatsapp"
+	BridgeErrorToMatrix   BridgeErrorDirection = "whatsapp_to_matrix"
+)
+
+const (
+	BridgeErrorCodeDecryptionFailed event.MessageStatusReason = "fi.mau.whatsapp.decryption_failed"
+	BridgeErrorCodeMediaNotFound    event.MessageStatusReason = "fi.mau.whatsapp.media_not_found"
+	BridgeErrorCodeMediaTooLarge    event.MessageStatusReason = "fi.mau.whatsapp.media_too_large"
+	BridgeErrorCodeMediaFailed      event.MessageStatusReason = "fi.mau.whatsapp.media_failed"
+)
+
+// userFacingBridgeErrors are errors whose text is safe to show to users as-is.
+// Any other error is described with a generic message based on its status reason.
+var userFacingBridgeErrors = []error{
+	errUserNotConnected,
+	errSendsPaused,
+	errMNoticeDisabled,
+	errInvalidGeoURI,
+	errUnknownMsgType,
+	errMediaUnsupportedType,
+	errMediaBlocked,
+	errMediaTooLarge,
+	errPollMissingQuestion,
+	errPollDuplicateOption,
+	errEditUnknownTarget,
+	errEditUnknownTargetType,
+	errEditDifferentSender,
+	errEditTooOld,
+	errBroadcastReactionNotSupported,
+	errBroadcastSendDisabled,
+	errReactionRateLimited,
+	errNewsletterNotAdmin,
+	errNewsletterUnsupportedType,
+	errMessageQueued,
+	errMessageQueueExpired,
+	errMessageTakingLong,
+	errTimeoutBeforeHandling,
+}
+
+func bridgeErrorMessage(err error, reason event.MessageStatusReason) string {
+	for _, knownErr := range userFacingBridgeErrors {
+		if errors.Is(err, knownErr) {
+			return knownErr.Error()
+		}
+	}
+	switch reason {
+	case event.MessageStatusUnsupported:
+		return "this type of message is not supported"
+	case event.MessageStatusNoPermission:
+		return "you don't have permission to send this message"
+	case event.MessageStatusTooOld:
+		return "the message took too long to bridge"
+	default:
+		return "the message could not be bridged"
+	}
+}
+
+type BridgeErrorEventContent struct {
+	Code      event.MessageStatusReason `json:"code"`
+	Direction BridgeErrorDirection      `json:"direction"`
+	Retryable bool                      `json:"retryable"`
+	Certain   bool                      `json:"certain"`
+	Message   string                    `json:"message,omitempty"`
+
+	Sender    id.UserID        `json:"sender,omitempty"`
+	MessageID types.MessageID  `json:"whatsapp_message_id,omitempty"`
+	RelatesTo *event.RelatesTo `json:"m.relates_to,omitempty"`
+}
+
+func (portal *Portal) sendBridgeErrorEvent(ctx context.Context, content *BridgeErrorEventContent) {
+	if !portal.bridge.Config.Bridge.MessageErrorEvents || len(portal.MXID) == 0 {
+		return
+	}
+	intent := portal.MainIntent()
+	wrappedContent := event.Content{Parsed: content}
+	eventType, err := portal.encrypt(ctx, intent, &wrappedContent, TypeBridgeError)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to encrypt bridge error event")
+		return
+	}
+	_, err = intent.SendMessageEvent(ctx, portal.MXID, eventType, &wrappedContent)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to send bridge error event")
+	}
+}
+
+// sendMatrixBridgeError sends a bridge error event for a Matrix event that failed to bridge to WhatsApp.
+func (portal *Portal) sendMatrixBridgeError(ctx context.Context, evt *event.Event, evtID id.EventID, err error) {
+	reason, statusCode, isCertain, _, _ := errorToStatusReason(err)
+	portal.sendBridgeErrorEvent(ctx, &BridgeErrorEventContent{
+		Code:      reason,
+		Direction: BridgeErrorToWhatsApp,
+		Retryable: statusCode == event.MessageStatusRetriable && canRetryEventType(evt.Type),
+		Certain:   isCertain,
+		Message:   bridgeErrorMessage(err, reason),
+		Sender:    evt.Sender,
+		RelatesTo: &event.RelatesTo{
+			Type:    event.RelReference,
+			EventID: evtID,
+		},
+	})
+}
+
+// sendMediaBridgeError sends a bridge error event for a WhatsApp media message that was bridged as an error notice.
+func (portal *Portal) sendMediaBridgeError(ctx context.Context, converted *ConvertedMessage, sender id.UserID, msgID types.MessageID, evtID id.EventID) {
+	content := &BridgeErrorEventContent{
+		Direction: BridgeErrorToMatrix,
+		Certain:   true,
+		Sender:    sender,
+		MessageID: msgID,
+		RelatesTo: &event.RelatesTo{
+			Type:    event.RelReference,
+			EventID: evtID,
+		},
+	}
+	switch {
+	case converted.Error == database.MsgErrMediaNotFound:
+		content.Code = BridgeErrorCodeMediaNotFound
+		content.Retryable = true
+		content.Message = "the media is no longer available on the WhatsApp servers and must be requested from the phone"
+	case errors.Is(converted.MediaError, errMediaTooLarge):
+		content.Code = BridgeErrorCodeMediaTooLarge
+		content.Message = errMediaTooLarge.Error()
+	case errors.Is(converted.MediaError, errMediaBlocked):
+		content.Code = event.MessageStatusNoPermission
+		content.Message = errMediaBlocked.Error()
+	default:
+		content.Code = BridgeErrorCodeMediaFailed
+		content.Certain = false
+		content.Message = "the media could not be bridged"
+	}
+	portal.sendBridgeErrorEvent(ctx, content)
+}
@@ -34,6 +34,8 @@ const (
 	WAPhoneOffline     status.BridgeStateErrorCode = "wa-phone-offline"
 	WAConnectionFailed status.BridgeStateErrorCode = "wa-connection-failed"
 	WADisconnected     status.BridgeStateErrorCode = "wa-transient-disconnect"
+	WAServiceDown      status.BridgeStateErrorCode = "wa-service-unavailable"
+	WATemporaryBan     status.BridgeStateErrorCode = "wa-temporary-ban"
 )
 
 func init() {
@@ -47,6 +49,8 @@ func init() {
 		WAPhoneOffline:     "Your phone hasn't been seen in over 12 days. The bridge is currently connected, but will get disconnected if you don't open the app soon.",
 		WAConnectionFailed: "Connecting to the WhatsApp web servers failed.",
 		WADisconnected:     "Disconnected from WhatsApp. Trying to reconnect.",
+		WAServiceDown:      "The WhatsApp web servers are temporarily unavailable. The bridge will try to reconnect.",
+		WATemporaryBan:     "Your WhatsApp account is temporarily banned. Sending messages is paused until the ban expires.",
 	})
 }
 
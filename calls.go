@@ -0,0 +1,208 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"github.com/element-hq/mautrix-whatsapp/database"
+)
+
+type ongoingCall struct {
+	ID         string
+	Creator    types.JID
+	Media      string
+	OfferedAt  time.Time
+	AcceptedAt time.Time
+}
+
+func (call *ongoingCall) describe(callType string) string {
+	parts := make([]string, 0, 3)
+	if callType != "" {
+		parts = append(parts, callType)
+	}
+	if call.Media != "" {
+		parts = append(parts, call.Media)
+	}
+	return strings.Join(append(parts, "call"), " ")
+}
+
+// ongoingCallMaxAge is how long calls are tracked if the terminate event is never received.
+const ongoingCallMaxAge = 24 * time.Hour
+
+func (portal *Portal) trackCallOffer(callID string, creator types.JID, media string, ts time.Time) *ongoingCall {
+	portal.ongoingCallsLock.Lock()
+	defer portal.ongoingCallsLock.Unlock()
+	for id, call := range portal.ongoingCalls {
+		if time.Since(call.OfferedAt) > ongoingCallMaxAge {
+			delete(portal.ongoingCalls, id)
+		}
+	}
+	call, ok := portal.ongoingCalls[callID]
+	if !ok {
+		call = &ongoingCall{
+			ID:        callID,
+			Creator:   creator,
+			OfferedAt: ts,
+		}
+		portal.ongoingCalls[callID] = call
+	}
+	if media != "" {
+		call.Media = media
+	}
+	return call
+}
+
+func (portal *Portal) trackCallAccept(callID string, ts time.Time) {
+	portal.ongoingCallsLock.Lock()
+	defer portal.ongoingCallsLock.Unlock()
+	call, ok := portal.ongoingCalls[callID]
+	if ok && call.AcceptedAt.IsZero() {
+		call.AcceptedAt = ts
+	}
+}
+
+func (portal *Portal) popCall(callID string) *ongoingCall {
+	portal.ongoingCallsLock.Lock()
+	defer portal.ongoingCallsLock.Unlock()
+	call, ok := portal.ongoingCalls[callID]
+	if ok {
+		delete(portal.ongoingCalls, callID)
+	}
+	return call
+}
+
+func getCallMedia(evt *events.CallOffer) string {
+	if evt.Data == nil {
+		return ""
+	} else if _, ok := evt.Data.GetOptionalChildByTag("video"); ok {
+		return "video"
+	}
+	return "audio"
+}
+
+const callEventMaxAge = 15 * time.Minute
+
+// getCallPortal finds the existing portal of the chat a call belongs to. Calls placed from the
+// user's own phone have the user as the creator, in which case the peer is in From.
+func (user *User) getCallPortal(meta types.BasicCallMeta) *Portal {
+	chat := meta.CallCreator
+	if meta.From.Server == types.GroupServer || chat.User == user.JID.User {
+		chat = meta.From
+	}
+	if chat.IsEmpty() || chat.User == user.JID.User {
+		return nil
+	}
+	return user.bridge.GetExistingPortalByJID(database.NewPortalKey(chat.ToNonAD(), user.JID))
+}
+
+func (user *User) handleCallStart(meta types.BasicCallMeta, media, callType string) {
+	sender, id, ts := meta.CallCreator, meta.CallID, meta.Timestamp
+	if ts.Add(callEventMaxAge).Before(time.Now()) {
+		return
+	}
+	sendStartNotice := user.bridge.Config.Bridge.CallStartNotices && sender.User != user.JID.User
+	if !sendStartNotice && !user.bridge.Config.Bridge.CallSummaryNotices {
+		return
+	}
+	portal := user.getCallPortal(meta)
+	if portal == nil {
+		return
+	}
+	call := portal.trackCallOffer(id, sender, media, ts)
+	if !sendStartNotice {
+		return
+	}
+	locale := portal.getLocale(user)
+	text := formatNotice(locale, NoticeCallIncoming, call.describeLocalized(locale, callType))
+	var htmlText string
+	if link := user.bridge.Config.Bridge.FormatCallJoinLink(portal.MXID, id); link != "" {
+		htmlText = fmt.Sprintf("%s<br>%s", html.EscapeString(text), formatNotice(locale, NoticeCallJoinLinkHTML, html.EscapeString(link)))
+		text = fmt.Sprintf("%s\n%s", text, formatNotice(locale, NoticeCallJoinLink, link))
+	}
+	portal.events <- &PortalEvent{
+		Message: &PortalMessage{
+			fake: &fakeMessage{
+				Sender:    sender,
+				Text:      text,
+				HTML:      htmlText,
+				ID:        id,
+				Time:      ts,
+				Important: true,
+			},
+			source: user,
+		},
+	}
+}
+
+func (user *User) handleCallAccept(meta types.BasicCallMeta) {
+	if !user.bridge.Config.Bridge.CallSummaryNotices {
+		return
+	}
+	portal := user.getCallPortal(meta)
+	if portal != nil {
+		portal.trackCallAccept(meta.CallID, meta.Timestamp)
+	}
+}
+
+func (user *User) handleCallEnd(meta types.BasicCallMeta, reason string) {
+	id, ts := meta.CallID, meta.Timestamp
+	if !user.bridge.Config.Bridge.CallSummaryNotices {
+		return
+	}
+	portal := user.getCallPortal(meta)
+	if portal == nil {
+		return
+	}
+	call := portal.popCall(id)
+	if call == nil || ts.Add(callEventMaxAge).Before(time.Now()) {
+		return
+	}
+	var text string
+	locale := portal.getLocale(user)
+	if !call.AcceptedAt.IsZero() {
+		duration := ts.Sub(call.AcceptedAt).Round(time.Second)
+		text = formatNotice(locale, NoticeCallEnded, call.describeLocalized(locale, ""), duration)
+	} else if call.Creator.User == user.JID.User {
+		text = formatNotice(locale, NoticeCallNotAnswered, call.describeLocalized(locale, ""))
+	} else {
+		text = formatNotice(locale, NoticeCallMissed, call.describeLocalized(locale, ""))
+	}
+	user.zlog.Debug().
+		Str("call_id", id).
+		Str("reason", reason).
+		Stringer("call_creator", call.Creator).
+		Msg("Call ended")
+	portal.events <- &PortalEvent{
+		Message: &PortalMessage{
+			fake: &fakeMessage{
+				Sender:    call.Creator,
+				Text:      text,
+				ID:        id + "-end",
+				Time:      ts,
+				Important: call.AcceptedAt.IsZero() && call.Creator.User != user.JID.User,
+			},
+			source: user,
+		},
+	}
+}
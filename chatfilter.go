@@ -0,0 +1,139 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/element-hq/mautrix-whatsapp/database"
+)
+
+func (user *User) loadChatFilters(ctx context.Context) map[types.JID]database.ChatFilterAction {
+	if user.chatFilters != nil {
+		return user.chatFilters
+	}
+	filters, err := user.bridge.DB.ChatFilter.GetAll(ctx, user.MXID)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to load chat filters")
+		// Don't cache the result so that loading is retried next time
+		return nil
+	}
+	user.chatFilters = make(map[types.JID]database.ChatFilterAction, len(filters))
+	for _, filter := range filters {
+		user.chatFilters[filter.ChatJID] = filter.Action
+	}
+	return user.chatFilters
+}
+
+// GetChatFilters returns the user's allowlisted and ignored chats.
+func (user *User) GetChatFilters(ctx context.Context) (allowed, denied []types.JID) {
+	user.chatFiltersLock.Lock()
+	defer user.chatFiltersLock.Unlock()
+	for jid, action := range user.loadChatFilters(ctx) {
+		switch action {
+		case database.ChatFilterAllow:
+			allowed = append(allowed, jid)
+		case database.ChatFilterDeny:
+			denied = append(denied, jid)
+		}
+	}
+	return
+}
+
+// IsChatFiltered returns true if the user has excluded the given chat from bridging, either by ignoring it
+// explicitly, or by allowlisting other chats. Groups with a pending invite are also filtered until accepted.
+func (user *User) IsChatFiltered(ctx context.Context, chat types.JID) bool {
+	chat = chat.ToNonAD()
+	if user.HasPendingGroupInvite(ctx, chat) {
+		return true
+	}
+	user.chatFiltersLock.Lock()
+	defer user.chatFiltersLock.Unlock()
+	filters := user.loadChatFilters(ctx)
+	if len(filters) == 0 {
+		return false
+	}
+	action, ok := filters[chat]
+	if ok {
+		return action == database.ChatFilterDeny
+	}
+	for _, otherAction := range filters {
+		if otherAction == database.ChatFilterAllow {
+			return true
+		}
+	}
+	return false
+}
+
+// SetChatFilter adds the chat to the user's allowlist or ignore list, or removes it from both if action is empty.
+func (user *User) SetChatFilter(ctx context.Context, chat types.JID, action database.ChatFilterAction) error {
+	chat = chat.ToNonAD()
+	user.chatFiltersLock.Lock()
+	defer user.chatFiltersLock.Unlock()
+	var err error
+	if action == "" {
+		err = user.bridge.DB.ChatFilter.Delete(ctx, user.MXID, chat)
+	} else {
+		filter := user.bridge.DB.ChatFilter.New()
+		filter.UserMXID = user.MXID
+		filter.ChatJID = chat
+		filter.Action = action
+		err = filter.Upsert(ctx)
+	}
+	// Reload the filters from the database next time they're needed
+	user.chatFilters = nil
+	return err
+}
+
+// ClearChatFilters removes all chats with the given action from the user's filters.
+func (user *User) ClearChatFilters(ctx context.Context, action database.ChatFilterAction) error {
+	user.chatFiltersLock.Lock()
+	defer user.chatFiltersLock.Unlock()
+	user.chatFilters = nil
+	return user.bridge.DB.ChatFilter.DeleteAllWithAction(ctx, user.MXID, action)
+}
+
+// resolveChatFilterTarget parses a chat JID, phone number or group invite link.
+func (user *User) resolveChatFilterTarget(target string) (types.JID, error) {
+	if strings.HasPrefix(target, whatsmeow.InviteLinkPrefix) {
+		if !user.IsLoggedIn() {
+			return types.EmptyJID, fmt.Errorf("you must be logged in to resolve invite links")
+		}
+		group, err := user.Client.GetGroupInfoFromLink(target)
+		if err != nil {
+			return types.EmptyJID, fmt.Errorf("failed to resolve invite link: %w", err)
+		}
+		return group.JID, nil
+	} else if strings.ContainsRune(target, '@') {
+		jid, err := types.ParseJID(target)
+		if err != nil {
+			return types.EmptyJID, fmt.Errorf("invalid JID: %w", err)
+		}
+		return jid.ToNonAD(), nil
+	}
+	phone := strings.TrimLeft(strings.NewReplacer(" ", "", "-", "", "(", "", ")", "").Replace(target), "+")
+	if len(phone) == 0 || strings.IndexFunc(phone, func(r rune) bool { return r < '0' || r > '9' }) >= 0 {
+		return types.EmptyJID, fmt.Errorf("%q is not a JID, phone number or invite link", target)
+	}
+	return types.NewJID(phone, types.DefaultUserServer), nil
+}
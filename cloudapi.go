@@ -0,0 +1,1064 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.mau.fi/util/variationselector"
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/element-hq/mautrix-go"
+	"github.com/element-hq/mautrix-go/bridge/commands"
+	"github.com/element-hq/mautrix-go/event"
+	"github.com/element-hq/mautrix-go/id"
+
+	"github.com/element-hq/mautrix-whatsapp/database"
+)
+
+const (
+	defaultCloudAPIGraphURL    = "https://graph.facebook.com/v19.0"
+	cloudAPIMaxWebhookBodySize = 1024 * 1024
+	cloudAPIRequestTimeout     = 2 * time.Minute
+)
+
+var (
+	errCloudAPINotOwner          = errors.New("only the owner of the Cloud API login can send messages to this chat")
+	errCloudAPIEditUnsupported   = errors.New("editing messages is not supported for WhatsApp Business Cloud API chats")
+	errCloudAPIDeleteUnsupported = errors.New("deleting messages is not supported for WhatsApp Business Cloud API chats")
+)
+
+// CloudAPIConnector bridges WhatsApp Business Cloud API numbers. Instead of pairing a phone, users connect a
+// phone number ID and access token, incoming messages arrive through Graph API webhooks and outgoing messages
+// are sent through the Graph API. The portals of a login use the business number as the receiver.
+//
+// The Cloud API only covers private chats. Matrix messages, reactions and read receipts are sent through it,
+// while edits, deletions and typing notifications have no Cloud API equivalent and aren't bridged.
+type CloudAPIConnector struct {
+	bridge *WABridge
+	log    zerolog.Logger
+	client *http.Client
+
+	loginsLock       sync.RWMutex
+	loginsByNumberID map[string]*database.CloudAPILogin
+	loginsByPhone    map[string]*database.CloudAPILogin
+	loginsByMXID     map[id.UserID]*database.CloudAPILogin
+}
+
+// NewCloudAPIConnector creates the Cloud API connector, or returns nil if Cloud API logins are disabled.
+func NewCloudAPIConnector(br *WABridge) *CloudAPIConnector {
+	if !br.Config.Bridge.CloudAPI.Enabled {
+		return nil
+	}
+	return &CloudAPIConnector{
+		bridge: br,
+		log:    br.ZLog.With().Str("component", "cloud api").Logger(),
+		client: &http.Client{Timeout: cloudAPIRequestTimeout},
+
+		loginsByNumberID: make(map[string]*database.CloudAPILogin),
+		loginsByPhone:    make(map[string]*database.CloudAPILogin),
+		loginsByMXID:     make(map[id.UserID]*database.CloudAPILogin),
+	}
+}
+
+// Start loads the stored logins and registers the webhook endpoint on the appservice HTTP server.
+func (cc *CloudAPIConnector) Start() {
+	logins, err := cc.bridge.DB.CloudAPILogin.GetAll(context.Background())
+	if err != nil {
+		cc.log.Err(err).Msg("Failed to load Cloud API logins")
+	}
+	for _, login := range logins {
+		cc.addLogin(login)
+	}
+	path := cc.bridge.Config.Bridge.CloudAPI.WebhookPath
+	cc.bridge.AS.Router.HandleFunc(path, cc.handleWebhookVerification).Methods(http.MethodGet)
+	cc.bridge.AS.Router.HandleFunc(path, cc.handleWebhook).Methods(http.MethodPost)
+	cc.log.Info().Int("login_count", len(logins)).Str("webhook_path", path).Msg("Cloud API webhook listener registered")
+}
+
+func (cc *CloudAPIConnector) graphURL(parts ...string) string {
+	base := cc.bridge.Config.Bridge.CloudAPI.GraphURL
+	if base == "" {
+		base = defaultCloudAPIGraphURL
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.Join(parts, "/")
+}
+
+func (cc *CloudAPIConnector) addLogin(login *database.CloudAPILogin) {
+	cc.loginsLock.Lock()
+	defer cc.loginsLock.Unlock()
+	if old, ok := cc.loginsByMXID[login.UserMXID]; ok {
+		delete(cc.loginsByNumberID, old.PhoneNumberID)
+		delete(cc.loginsByPhone, old.PhoneNumber)
+	}
+	cc.loginsByNumberID[login.PhoneNumberID] = login
+	cc.loginsByPhone[login.PhoneNumber] = login
+	cc.loginsByMXID[login.UserMXID] = login
+}
+
+func (cc *CloudAPIConnector) removeLogin(login *database.CloudAPILogin) {
+	cc.loginsLock.Lock()
+	defer cc.loginsLock.Unlock()
+	delete(cc.loginsByNumberID, login.PhoneNumberID)
+	delete(cc.loginsByPhone, login.PhoneNumber)
+	delete(cc.loginsByMXID, login.UserMXID)
+}
+
+func (cc *CloudAPIConnector) GetLoginByMXID(userID id.UserID) *database.CloudAPILogin {
+	cc.loginsLock.RLock()
+	defer cc.loginsLock.RUnlock()
+	return cc.loginsByMXID[userID]
+}
+
+func (cc *CloudAPIConnector) GetLoginByNumberID(numberID string) *database.CloudAPILogin {
+	cc.loginsLock.RLock()
+	defer cc.loginsLock.RUnlock()
+	return cc.loginsByNumberID[numberID]
+}
+
+func (cc *CloudAPIConnector) GetLoginByPhone(phone string) *database.CloudAPILogin {
+	cc.loginsLock.RLock()
+	defer cc.loginsLock.RUnlock()
+	return cc.loginsByPhone[phone]
+}
+
+// getCloudAPILogin returns the Cloud API login whose number is the receiver of this portal, if there is one.
+func (portal *Portal) getCloudAPILogin() *database.CloudAPILogin {
+	if portal.bridge.CloudAPI == nil || !portal.IsPrivateChat() {
+		return nil
+	}
+	return portal.bridge.CloudAPI.GetLoginByPhone(portal.Key.Receiver.User)
+}
+
+type cloudAPIError struct {
+	Message   string `json:"message"`
+	Type      string `json:"type"`
+	Code      int    `json:"code"`
+	FBTraceID string `json:"fbtrace_id"`
+}
+
+func (err *cloudAPIError) Error() string {
+	return fmt.Sprintf("graph API error %d (%s): %s", err.Code, err.Type, err.Message)
+}
+
+func (cc *CloudAPIConnector) doRequest(ctx context.Context, login *database.CloudAPILogin, req *http.Request, into any) error {
+	req.Header.Set("Authorization", "Bearer "+login.AccessToken)
+	resp, err := cc.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var errResp struct {
+			Error *cloudAPIError `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil && errResp.Error != nil {
+			return errResp.Error
+		}
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	if into == nil {
+		return nil
+	}
+	if data, ok := into.(*[]byte); ok {
+		*data, err = io.ReadAll(resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(into)
+}
+
+func (cc *CloudAPIConnector) getJSON(ctx context.Context, login *database.CloudAPILogin, url string, into any) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	return cc.doRequest(ctx, login, req, into)
+}
+
+func (cc *CloudAPIConnector) postJSON(ctx context.Context, login *database.CloudAPILogin, url string, body, into any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return cc.doRequest(ctx, login, req, into)
+}
+
+// fetchPhoneNumber checks that the access token can use the phone number ID and returns the number
+// in international format without the leading +.
+func (cc *CloudAPIConnector) fetchPhoneNumber(ctx context.Context, login *database.CloudAPILogin) (string, error) {
+	var resp struct {
+		DisplayPhoneNumber string `json:"display_phone_number"`
+	}
+	err := cc.getJSON(ctx, login, cc.graphURL(login.PhoneNumberID)+"?fields=display_phone_number", &resp)
+	if err != nil {
+		return "", err
+	}
+	phone := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, resp.DisplayPhoneNumber)
+	if phone == "" {
+		return "", fmt.Errorf("graph API didn't return a phone number")
+	}
+	return phone, nil
+}
+
+func (cc *CloudAPIConnector) downloadMedia(ctx context.Context, login *database.CloudAPILogin, mediaID string) ([]byte, string, error) {
+	var meta struct {
+		URL      string `json:"url"`
+		MimeType string `json:"mime_type"`
+	}
+	err := cc.getJSON(ctx, login, cc.graphURL(mediaID), &meta)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get media URL: %w", err)
+	}
+	var data []byte
+	err = cc.getJSON(ctx, login, meta.URL, &data)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to download media: %w", err)
+	}
+	return data, meta.MimeType, nil
+}
+
+func (cc *CloudAPIConnector) uploadMedia(ctx context.Context, login *database.CloudAPILogin, data []byte, mimeType, fileName string) (string, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	_ = writer.WriteField("messaging_product", "whatsapp")
+	_ = writer.WriteField("type", mimeType)
+	if fileName == "" {
+		fileName = "file"
+	}
+	part, err := writer.CreatePart(map[string][]string{
+		"Content-Disposition": {fmt.Sprintf(`form-data; name="file"; filename=%q`, fileName)},
+		"Content-Type":        {mimeType},
+	})
+	if err != nil {
+		return "", err
+	}
+	_, _ = part.Write(data)
+	if err = writer.Close(); err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, cc.graphURL(login.PhoneNumberID, "media"), &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	var resp struct {
+		ID string `json:"id"`
+	}
+	err = cc.doRequest(ctx, login, req, &resp)
+	return resp.ID, err
+}
+
+type cloudAPIText struct {
+	Body string `json:"body"`
+}
+
+type cloudAPIMedia struct {
+	ID       string `json:"id"`
+	MimeType string `json:"mime_type,omitempty"`
+	Caption  string `json:"caption,omitempty"`
+	Filename string `json:"filename,omitempty"`
+}
+
+type cloudAPIContext struct {
+	From string `json:"from,omitempty"`
+	ID   string `json:"id,omitempty"`
+}
+
+type cloudAPISendRequest struct {
+	MessagingProduct string `json:"messaging_product"`
+	RecipientType    string `json:"recipient_type"`
+	To               string `json:"to"`
+	Type             string `json:"type"`
+
+	Context  *cloudAPISendContext `json:"context,omitempty"`
+	Text     *cloudAPIText        `json:"text,omitempty"`
+	Image    *cloudAPIMedia       `json:"image,omitempty"`
+	Video    *cloudAPIMedia       `json:"video,omitempty"`
+	Audio    *cloudAPIMedia       `json:"audio,omitempty"`
+	Document *cloudAPIMedia       `json:"document,omitempty"`
+	Sticker  *cloudAPIMedia       `json:"sticker,omitempty"`
+	Reaction *cloudAPIReaction    `json:"reaction,omitempty"`
+}
+
+type cloudAPIReaction struct {
+	MessageID string `json:"message_id"`
+	Emoji     string `json:"emoji"`
+}
+
+type cloudAPISendContext struct {
+	MessageID string `json:"message_id"`
+}
+
+func (cc *CloudAPIConnector) sendMessage(ctx context.Context, login *database.CloudAPILogin, req *cloudAPISendRequest) (types.MessageID, error) {
+	var resp struct {
+		Messages []struct {
+			ID string `json:"id"`
+		} `json:"messages"`
+	}
+	err := cc.postJSON(ctx, login, cc.graphURL(login.PhoneNumberID, "messages"), req, &resp)
+	if err != nil {
+		return "", err
+	} else if len(resp.Messages) == 0 {
+		return "", fmt.Errorf("graph API didn't return a message ID")
+	}
+	return resp.Messages[0].ID, nil
+}
+
+// markRead marks the given incoming message and all messages before it in the same chat as read.
+func (cc *CloudAPIConnector) markRead(ctx context.Context, login *database.CloudAPILogin, messageID types.MessageID) error {
+	return cc.postJSON(ctx, login, cc.graphURL(login.PhoneNumberID, "messages"), map[string]string{
+		"messaging_product": "whatsapp",
+		"status":            "read",
+		"message_id":        messageID,
+	}, nil)
+}
+
+type cloudAPIWebhook struct {
+	Object string `json:"object"`
+	Entry  []struct {
+		ID      string `json:"id"`
+		Changes []struct {
+			Field string               `json:"field"`
+			Value cloudAPIWebhookValue `json:"value"`
+		} `json:"changes"`
+	} `json:"entry"`
+}
+
+type cloudAPIWebhookValue struct {
+	Metadata struct {
+		DisplayPhoneNumber string `json:"display_phone_number"`
+		PhoneNumberID      string `json:"phone_number_id"`
+	} `json:"metadata"`
+	Contacts []struct {
+		Profile struct {
+			Name string `json:"name"`
+		} `json:"profile"`
+		WAID string `json:"wa_id"`
+	} `json:"contacts"`
+	Messages []*cloudAPIMessage `json:"messages"`
+	Statuses []*cloudAPIStatus  `json:"statuses"`
+}
+
+type cloudAPIMessage struct {
+	From      string           `json:"from"`
+	ID        string           `json:"id"`
+	Timestamp string           `json:"timestamp"`
+	Type      string           `json:"type"`
+	Context   *cloudAPIContext `json:"context,omitempty"`
+	Text      *cloudAPIText    `json:"text,omitempty"`
+	Image     *cloudAPIMedia   `json:"image,omitempty"`
+	Video     *cloudAPIMedia   `json:"video,omitempty"`
+	Audio     *cloudAPIMedia   `json:"audio,omitempty"`
+	Document  *cloudAPIMedia   `json:"document,omitempty"`
+	Sticker   *cloudAPIMedia   `json:"sticker,omitempty"`
+}
+
+type cloudAPIStatus struct {
+	ID          string `json:"id"`
+	Status      string `json:"status"`
+	RecipientID string `json:"recipient_id"`
+	Errors      []struct {
+		Code  int    `json:"code"`
+		Title string `json:"title"`
+	} `json:"errors"`
+}
+
+func (cc *CloudAPIConnector) handleWebhookVerification(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	verifyToken := cc.bridge.Config.Bridge.CloudAPI.VerifyToken
+	if verifyToken == "" || query.Get("hub.mode") != "subscribe" ||
+		subtle.ConstantTimeCompare([]byte(query.Get("hub.verify_token")), []byte(verifyToken)) != 1 {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte(query.Get("hub.challenge")))
+}
+
+func (cc *CloudAPIConnector) verifySignature(body []byte, header string) bool {
+	secret := cc.bridge.Config.Bridge.CloudAPI.AppSecret
+	sig, ok := strings.CutPrefix(header, "sha256=")
+	if secret == "" || !ok {
+		return false
+	}
+	sigBytes, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), sigBytes)
+}
+
+func (cc *CloudAPIConnector) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, cloudAPIMaxWebhookBodySize))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	} else if !cc.verifySignature(body, r.Header.Get("X-Hub-Signature-256")) {
+		cc.log.Warn().Str("remote_addr", r.RemoteAddr).Msg("Rejecting Cloud API webhook with invalid signature")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var payload cloudAPIWebhook
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	// Meta retries webhooks that aren't acknowledged quickly, so the payload is handled in the background.
+	w.WriteHeader(http.StatusOK)
+	go cc.handleWebhookPayload(&payload)
+}
+
+func (cc *CloudAPIConnector) handleWebhookPayload(payload *cloudAPIWebhook) {
+	ctx := cc.log.WithContext(context.Background())
+	for _, entry := range payload.Entry {
+		for _, change := range entry.Changes {
+			if change.Field != "messages" {
+				continue
+			}
+			login := cc.GetLoginByNumberID(change.Value.Metadata.PhoneNumberID)
+			if login == nil {
+				cc.log.Debug().
+					Str("phone_number_id", change.Value.Metadata.PhoneNumberID).
+					Msg("Ignoring webhook for unknown phone number ID")
+				continue
+			}
+			names := make(map[string]string, len(change.Value.Contacts))
+			for _, contact := range change.Value.Contacts {
+				names[contact.WAID] = contact.Profile.Name
+			}
+			for _, msg := range change.Value.Messages {
+				cc.queueIncomingMessage(login, msg, names[msg.From])
+			}
+			for _, status := range change.Value.Statuses {
+				cc.handleStatus(ctx, login, status)
+			}
+		}
+	}
+}
+
+func (cc *CloudAPIConnector) getPortal(login *database.CloudAPILogin, phone string) *Portal {
+	jid := types.NewJID(phone, types.DefaultUserServer)
+	return cc.bridge.GetPortalByJID(database.NewPortalKey(jid, login.JID()))
+}
+
+type cloudAPIPortalMessage struct {
+	login       *database.CloudAPILogin
+	msg         *cloudAPIMessage
+	contactName string
+}
+
+func (cc *CloudAPIConnector) queueIncomingMessage(login *database.CloudAPILogin, msg *cloudAPIMessage, contactName string) {
+	portal := cc.getPortal(login, msg.From)
+	if portal == nil {
+		return
+	}
+	portal.events <- &PortalEvent{
+		CloudAPIMessage: &cloudAPIPortalMessage{login: login, msg: msg, contactName: contactName},
+	}
+}
+
+func (cc *CloudAPIConnector) handleStatus(ctx context.Context, login *database.CloudAPILogin, status *cloudAPIStatus) {
+	portal := cc.getPortal(login, status.RecipientID)
+	if portal == nil || portal.MXID == "" {
+		return
+	}
+	msg, err := cc.bridge.DB.Message.GetByJID(ctx, portal.Key, status.ID)
+	if err != nil {
+		cc.log.Err(err).Str("message_id", status.ID).Msg("Failed to get message for Cloud API status")
+		return
+	} else if msg == nil {
+		return
+	}
+	switch status.Status {
+	case "delivered":
+		portal.sendStatusEvent(ctx, msg.MXID, "", nil, &[]id.UserID{portal.MainIntent().UserID})
+	case "read":
+		err = portal.MainIntent().SetReadMarkers(ctx, portal.MXID, &mautrix.ReqSetReadMarkers{Read: msg.MXID})
+		if err != nil {
+			cc.log.Err(err).Stringer("event_id", msg.MXID).Msg("Failed to bridge Cloud API read status")
+		}
+	case "failed":
+		reason := "unknown error"
+		if len(status.Errors) > 0 {
+			reason = fmt.Sprintf("%s (%d)", status.Errors[0].Title, status.Errors[0].Code)
+		}
+		cc.log.Warn().Str("message_id", status.ID).Str("reason", reason).Msg("Cloud API reported message delivery failure")
+		portal.sendStatusEvent(ctx, msg.MXID, "", fmt.Errorf("WhatsApp failed to deliver the message: %s", reason), nil)
+	}
+}
+
+// syncCloudAPIContact updates the ghost's name using the profile name included in Cloud API webhooks,
+// as there is no contact store for Cloud API logins.
+func (puppet *Puppet) syncCloudAPIContact(ctx context.Context, source *User, name string) {
+	err := puppet.DefaultIntent().EnsureRegistered(ctx)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to ensure ghost is registered")
+	}
+	if name == "" {
+		return
+	}
+	if puppet.UpdateName(ctx, source, types.ContactInfo{Found: true, PushName: name}, false) {
+		err = puppet.Update(ctx)
+		if err != nil {
+			zerolog.Ctx(ctx).Err(err).Msg("Failed to save ghost after updating name")
+		}
+	}
+}
+
+// createCloudAPIRoom creates the Matrix room for a Cloud API private chat. It's a reduced version of
+// CreateMatrixRoom, as everything other than the contact's name and number is unavailable through the Cloud API.
+func (portal *Portal) createCloudAPIRoom(ctx context.Context, user *User) error {
+	portal.roomCreateLock.Lock()
+	defer portal.roomCreateLock.Unlock()
+	if len(portal.MXID) > 0 {
+		return nil
+	}
+	defer portal.bridge.lockPortalCreation(portal.Key)()
+	log := zerolog.Ctx(ctx)
+
+	intent := portal.MainIntent()
+	if err := intent.EnsureRegistered(ctx); err != nil {
+		return err
+	}
+	puppet := portal.bridge.GetPuppetByJID(portal.Key.JID)
+	portal.Name = puppet.Displayname
+	portal.Topic = PrivateChatTopic
+
+	bridgeInfoStateKey, bridgeInfo := portal.getBridgeInfo()
+	initialState := []*event.Event{{
+		Type:    event.StatePowerLevels,
+		Content: event.Content{Parsed: portal.GetBasePowerLevels()},
+	}, {
+		Type:     event.StateBridge,
+		Content:  event.Content{Parsed: bridgeInfo},
+		StateKey: &bridgeInfoStateKey,
+	}, {
+		// TODO remove this once https://github.com/matrix-org/matrix-doc/pull/2346 is in spec
+		Type:     event.StateHalfShotBridge,
+		Content:  event.Content{Parsed: bridgeInfo},
+		StateKey: &bridgeInfoStateKey,
+	}}
+	var invite []id.UserID
+	if portal.bridge.Config.Bridge.Encryption.Default {
+		initialState = append(initialState, &event.Event{
+			Type:    event.StateEncryption,
+			Content: event.Content{Parsed: portal.GetEncryptionEventContent()},
+		})
+		portal.Encrypted = true
+		invite = append(invite, portal.bridge.Bot.UserID)
+	}
+	creationContent := make(map[string]interface{})
+	if !portal.bridge.Config.Bridge.FederateRooms {
+		creationContent["m.federate"] = false
+	}
+	req := &mautrix.ReqCreateRoom{
+		Visibility:      "private",
+		Name:            portal.Name,
+		Topic:           portal.Topic,
+		Invite:          invite,
+		Preset:          "private_chat",
+		IsDirect:        true,
+		InitialState:    initialState,
+		CreationContent: creationContent,
+		RoomVersion:     portal.bridge.Config.Bridge.RoomCreation.RoomVersion,
+	}
+	if !portal.shouldSetDMRoomMetadata() {
+		req.Name = ""
+	}
+	resp, err := intent.CreateRoom(ctx, req)
+	if err != nil {
+		return err
+	}
+	log.Info().Stringer("room_id", resp.RoomID).Msg("Matrix room created for Cloud API chat")
+	portal.NameSet = len(req.Name) > 0
+	portal.TopicSet = true
+	portal.MXID = resp.RoomID
+	portal.updateLogger()
+	portal.bridge.portalsLock.Lock()
+	portal.bridge.portalsByMXID[portal.MXID] = portal
+	portal.bridge.portalsLock.Unlock()
+	err = portal.Update(ctx)
+	if err != nil {
+		log.Err(err).Msg("Failed to save portal after creating room")
+	}
+	for _, userID := range invite {
+		err = portal.bridge.StateStore.SetMembership(ctx, portal.MXID, userID, event.MembershipInvite)
+		if err != nil {
+			log.Err(err).Stringer("user_id", userID).Msg("Failed to update membership in state store")
+		}
+	}
+	portal.ensureUserInvited(ctx, user)
+	if portal.Encrypted {
+		err = portal.bridge.Bot.EnsureJoined(ctx, portal.MXID)
+		if err != nil {
+			log.Err(err).Msg("Failed to ensure bridge bot is joined to created portal")
+		}
+	}
+	user.UpdateDirectChats(ctx, map[id.UserID][]id.RoomID{puppet.MXID: {portal.MXID}})
+	return nil
+}
+
+func (portal *Portal) handleCloudAPIMessageLoopItem(item *cloudAPIPortalMessage) {
+	msg := item.msg
+	log := portal.zlog.With().
+		Str("action", "handle cloud api message").
+		Str("message_id", msg.ID).
+		Str("message_type", msg.Type).
+		Logger()
+	ctx := log.WithContext(context.Background())
+	user := portal.bridge.GetUserByMXID(item.login.UserMXID)
+	if user == nil {
+		return
+	}
+	puppet := portal.bridge.GetPuppetByJID(portal.Key.JID)
+	puppet.syncCloudAPIContact(ctx, user, item.contactName)
+	if len(portal.MXID) == 0 {
+		err := portal.createCloudAPIRoom(ctx, user)
+		if err != nil {
+			log.Err(err).Msg("Failed to create portal room")
+			return
+		}
+	}
+	existing, err := portal.bridge.DB.Message.GetByJID(ctx, portal.Key, msg.ID)
+	if err != nil {
+		log.Err(err).Msg("Failed to check if message is duplicate")
+	} else if existing != nil {
+		log.Debug().Msg("Ignoring duplicate message")
+		return
+	}
+
+	content, err := portal.convertCloudAPIMessage(ctx, item.login, msg)
+	if err != nil {
+		log.Err(err).Msg("Failed to convert message")
+		content = &event.MessageEventContent{
+			MsgType: event.MsgNotice,
+			Body:    "Failed to bridge media from WhatsApp",
+		}
+	} else if content == nil {
+		log.Debug().Msg("Ignoring unsupported message type")
+		return
+	}
+	if msg.Context != nil && msg.Context.ID != "" {
+		replyTo, err := portal.bridge.DB.Message.GetByJID(ctx, portal.Key, msg.Context.ID)
+		if err == nil && replyTo != nil && len(replyTo.MXID) > 0 {
+			content.RelatesTo = (&event.RelatesTo{}).SetReplyTo(replyTo.MXID)
+		}
+	}
+
+	ts := time.Now()
+	if unix, err := strconv.ParseInt(msg.Timestamp, 10, 64); err == nil {
+		ts = time.Unix(unix, 0)
+	}
+	intent := portal.MainIntent()
+	resp, err := portal.sendMessage(ctx, intent, event.EventMessage, content, nil, ts.UnixMilli())
+	if err != nil {
+		log.Err(err).Msg("Failed to send message to Matrix")
+		return
+	}
+	info := &types.MessageInfo{
+		MessageSource: types.MessageSource{Chat: portal.Key.JID, Sender: portal.Key.JID},
+		ID:            msg.ID,
+		Timestamp:     ts,
+	}
+	portal.finishHandling(ctx, nil, info, resp.EventID, intent.UserID, database.MsgNormal, 0, database.MsgNoError)
+}
+
+func (portal *Portal) convertCloudAPIMessage(ctx context.Context, login *database.CloudAPILogin, msg *cloudAPIMessage) (*event.MessageEventContent, error) {
+	var media *cloudAPIMedia
+	content := &event.MessageEventContent{}
+	switch msg.Type {
+	case "text":
+		if msg.Text == nil {
+			return nil, nil
+		}
+		content.MsgType = event.MsgText
+		content.Body = msg.Text.Body
+		portal.bridge.Formatter.ParseWhatsApp(ctx, portal.MXID, content, nil, false, false)
+		return content, nil
+	case "image":
+		media, content.MsgType = msg.Image, event.MsgImage
+	case "video":
+		media, content.MsgType = msg.Video, event.MsgVideo
+	case "audio":
+		media, content.MsgType = msg.Audio, event.MsgAudio
+	case "document":
+		media, content.MsgType = msg.Document, event.MsgFile
+	case "sticker":
+		media, content.MsgType = msg.Sticker, event.MsgImage
+	default:
+		return nil, nil
+	}
+	if media == nil {
+		return nil, nil
+	}
+	data, mimeType, err := portal.bridge.CloudAPI.downloadMedia(ctx, login, media.ID)
+	if err != nil {
+		return nil, err
+	}
+	content.Info = &event.FileInfo{MimeType: mimeType, Size: len(data)}
+	content.Body = media.Filename
+	if content.Body == "" {
+		content.Body = msg.Type
+	}
+	if media.Caption != "" {
+		content.FileName = content.Body
+		content.Body = media.Caption
+	}
+	err = portal.reuploadIncomingMedia(ctx, portal.MainIntent(), data, content, portal.Key.JID)
+	if errors.Is(err, errMediaBlocked) {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to upload media to Matrix: %w", err)
+	}
+	return content, nil
+}
+
+// handleCloudAPIMatrixMessage sends a Matrix message through the Cloud API login that owns the portal.
+func (portal *Portal) handleCloudAPIMatrixMessage(ctx context.Context, sender *User, login *database.CloudAPILogin, evt *event.Event, ms *metricSender) {
+	if sender.MXID != login.UserMXID {
+		go ms.sendMessageMetrics(ctx, evt, errCloudAPINotOwner, "Ignoring", true)
+		return
+	}
+	content, ok := evt.Content.Parsed.(*event.MessageEventContent)
+	if !ok || (evt.Type != event.EventMessage && evt.Type != event.EventSticker) {
+		go ms.sendMessageMetrics(ctx, evt, errUnexpectedParsedContentType, "Ignoring", true)
+		return
+	} else if content.RelatesTo.GetReplaceID() != "" {
+		go ms.sendMessageMetrics(ctx, evt, errCloudAPIEditUnsupported, "Ignoring", true)
+		return
+	}
+	cc := portal.bridge.CloudAPI
+	req := &cloudAPISendRequest{
+		MessagingProduct: "whatsapp",
+		RecipientType:    "individual",
+		To:               portal.Key.JID.User,
+	}
+	if replyTo := content.RelatesTo.GetReplyTo(); replyTo != "" {
+		target, err := portal.bridge.DB.Message.GetByMXID(ctx, replyTo)
+		if err == nil && target != nil && target.Chat == portal.Key {
+			req.Context = &cloudAPISendContext{MessageID: target.JID}
+		}
+	}
+	msgType := content.MsgType
+	if evt.Type == event.EventSticker {
+		msgType = event.MessageType(event.EventSticker.Type)
+	}
+	switch msgType {
+	case event.MsgText, event.MsgNotice, event.MsgEmote:
+		if msgType == event.MsgNotice && !portal.bridge.Config.Bridge.BridgeNotices {
+			go ms.sendMessageMetrics(ctx, evt, errMNoticeDisabled, "Ignoring", true)
+			return
+		}
+		text := content.Body
+		if content.Format == event.FormatHTML {
+			text, _ = portal.bridge.Formatter.ParseMatrix(content.FormattedBody, content.Mentions)
+		}
+		if msgType == event.MsgEmote {
+			text = "/me " + text
+		}
+		req.Type = "text"
+		req.Text = &cloudAPIText{Body: text}
+	case event.MsgImage, event.MsgVideo, event.MsgAudio, event.MsgFile, event.MessageType(event.EventSticker.Type):
+		data, _, err := portal.downloadMatrixFile(ctx, content)
+		if err != nil {
+			go ms.sendMessageMetrics(ctx, evt, err, "Error downloading media in", true)
+			return
+		}
+		mimeType := content.GetInfo().MimeType
+		if mimeType == "" {
+			mimeType = http.DetectContentType(data)
+		}
+		if portal.scanMedia(ctx, data, mimeType, "outgoing", sender.MXID.String()) {
+			go ms.sendMessageMetrics(ctx, evt, errMediaBlocked, "Error scanning media in", true)
+			return
+		}
+		fileName := content.FileName
+		if fileName == "" {
+			fileName = content.Body
+		}
+		mediaID, err := cc.uploadMedia(ctx, login, data, mimeType, fileName)
+		if err != nil {
+			go ms.sendMessageMetrics(ctx, evt, fmt.Errorf("%w: %w", errMediaWhatsAppUploadFailed, err), "Error uploading media in", true)
+			return
+		}
+		media := &cloudAPIMedia{ID: mediaID}
+		if content.FileName != "" && content.Body != content.FileName {
+			media.Caption = content.Body
+		}
+		switch msgType {
+		case event.MsgImage:
+			req.Type, req.Image = "image", media
+		case event.MsgVideo:
+			req.Type, req.Video = "video", media
+		case event.MsgAudio:
+			media.Caption = ""
+			req.Type, req.Audio = "audio", media
+		case event.MsgFile:
+			media.Filename = fileName
+			req.Type, req.Document = "document", media
+		default:
+			media.Caption = ""
+			if mimeType == "image/webp" {
+				req.Type, req.Sticker = "sticker", media
+			} else {
+				req.Type, req.Image = "image", media
+			}
+		}
+	default:
+		go ms.sendMessageMetrics(ctx, evt, errUnknownMsgType, "Ignoring", true)
+		return
+	}
+
+	msgID, err := cc.sendMessage(ctx, login, req)
+	if err != nil {
+		go ms.sendMessageMetrics(ctx, evt, err, "Error sending", true)
+		return
+	}
+	info := &types.MessageInfo{
+		MessageSource: types.MessageSource{Chat: portal.Key.JID, Sender: login.JID(), IsFromMe: true},
+		ID:            msgID,
+		Timestamp:     time.Now(),
+	}
+	portal.markHandled(ctx, nil, info, evt.ID, evt.Sender, true, true, database.MsgNormal, 0, database.MsgNoError)
+	zerolog.Ctx(ctx).Debug().Str("wa_message_id", msgID).Msg("Sent message through Cloud API")
+	go ms.sendMessageMetrics(ctx, evt, nil, "", true)
+}
+
+// handleCloudAPIMatrixReaction sends a Matrix reaction through the Cloud API login that owns the portal.
+func (portal *Portal) handleCloudAPIMatrixReaction(ctx context.Context, sender *User, login *database.CloudAPILogin, evt *event.Event) error {
+	if sender.MXID != login.UserMXID {
+		return errCloudAPINotOwner
+	}
+	content, ok := evt.Content.Parsed.(*event.ReactionEventContent)
+	if !ok {
+		return fmt.Errorf("unexpected parsed content type %T", evt.Content.Parsed)
+	}
+	target, err := portal.bridge.DB.Message.GetByMXID(ctx, content.RelatesTo.EventID)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to get target message from database")
+		return fmt.Errorf("failed to get target event")
+	} else if target == nil || target.Type == database.MsgReaction {
+		return fmt.Errorf("unknown target event %s", content.RelatesTo.EventID)
+	}
+	msgID, err := portal.bridge.CloudAPI.sendMessage(ctx, login, &cloudAPISendRequest{
+		MessagingProduct: "whatsapp",
+		RecipientType:    "individual",
+		To:               portal.Key.JID.User,
+		Type:             "reaction",
+		Reaction:         &cloudAPIReaction{MessageID: target.JID, Emoji: variationselector.Remove(content.RelatesTo.Key)},
+	})
+	if err != nil {
+		return err
+	}
+	info := &types.MessageInfo{
+		MessageSource: types.MessageSource{Chat: portal.Key.JID, Sender: login.JID(), IsFromMe: true},
+		ID:            msgID,
+		Timestamp:     time.Now(),
+	}
+	portal.markHandled(ctx, nil, info, evt.ID, evt.Sender, true, true, database.MsgReaction, 0, database.MsgNoError)
+	portal.upsertReaction(ctx, nil, target.JID, login.JID(), evt.ID, msgID)
+	return nil
+}
+
+// handleCloudAPIMatrixRedaction removes reactions through the Cloud API. Messages can't be deleted through the
+// Cloud API, so redactions of messages are rejected.
+func (portal *Portal) handleCloudAPIMatrixRedaction(ctx context.Context, sender *User, login *database.CloudAPILogin, evt *event.Event) error {
+	if sender.MXID != login.UserMXID {
+		return errCloudAPINotOwner
+	}
+	msg, err := portal.bridge.DB.Message.GetByMXID(ctx, evt.Redacts)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to get redaction target event from database")
+		return errTargetNotFound
+	} else if msg == nil {
+		return errTargetNotFound
+	} else if msg.Type != database.MsgReaction {
+		return errCloudAPIDeleteUnsupported
+	} else if msg.Sender.User != login.PhoneNumber {
+		return errReactionSentBySomeoneElse
+	}
+	reaction, err := portal.bridge.DB.Reaction.GetByMXID(ctx, evt.Redacts)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to get target reaction from database")
+		return errReactionDatabaseNotFound
+	} else if reaction == nil {
+		return errReactionDatabaseNotFound
+	}
+	_, err = portal.bridge.CloudAPI.sendMessage(ctx, login, &cloudAPISendRequest{
+		MessagingProduct: "whatsapp",
+		RecipientType:    "individual",
+		To:               portal.Key.JID.User,
+		Type:             "reaction",
+		Reaction:         &cloudAPIReaction{MessageID: reaction.TargetJID},
+	})
+	return err
+}
+
+// handleCloudAPIReadReceipt marks the latest incoming message up to the read event as read through the Cloud API.
+func (portal *Portal) handleCloudAPIReadReceipt(ctx context.Context, sender *User, login *database.CloudAPILogin, eventID id.EventID) {
+	log := zerolog.Ctx(ctx)
+	if sender.MXID != login.UserMXID {
+		return
+	}
+	message, err := portal.bridge.DB.Message.GetByMXID(ctx, eventID)
+	if err != nil {
+		log.Err(err).Msg("Failed to get read receipt target message")
+		return
+	} else if message == nil {
+		return
+	}
+	prevTimestamp := sender.GetLastReadTS(ctx, portal.Key)
+	if prevTimestamp.IsZero() {
+		prevTimestamp = message.Timestamp.Add(-2 * time.Second)
+	}
+	messages, err := portal.bridge.DB.Message.GetMessagesBetween(ctx, portal.Key, prevTimestamp, message.Timestamp)
+	if err != nil {
+		log.Err(err).Msg("Failed to get messages that need receipts")
+		return
+	}
+	var target *database.Message
+	for _, msg := range messages {
+		if !msg.IsFakeJID() && msg.Sender.User != login.PhoneNumber {
+			target = msg
+		}
+	}
+	if len(messages) > 0 {
+		sender.SetLastReadTS(ctx, portal.Key, messages[len(messages)-1].Timestamp)
+	}
+	if target == nil || !sender.IsDeliveryEnabled(database.DeliverySendReadReceipts) {
+		return
+	}
+	// The Cloud API marks all earlier messages as read too, so only the latest one needs a receipt.
+	err = portal.bridge.CloudAPI.markRead(ctx, login, target.JID)
+	if err != nil {
+		log.Err(err).Str("message_id", target.JID).Msg("Failed to send read receipt through Cloud API")
+	}
+}
+
+var cmdLoginCloud = &commands.FullHandler{
+	Func: wrapCommand(fnLoginCloud),
+	Name: "login-cloud",
+	Help: commands.HelpMeta{
+		Section: commands.HelpSectionAuth,
+		Description: "Connect a WhatsApp Business Cloud API phone number instead of linking a phone. " +
+			"The access token must have the whatsapp_business_messaging permission.",
+		Args: "<_phone number ID_> <_access token_>",
+	},
+}
+
+func fnLoginCloud(ce *WrappedCommandEvent) {
+	// The access token shouldn't stay in the room history, even if the login fails.
+	ce.Redact()
+	if ce.Bridge.CloudAPI == nil {
+		ce.Reply("WhatsApp Business Cloud API logins are not enabled on this bridge.")
+		return
+	} else if len(ce.Args) != 2 {
+		ce.Reply("**Usage:** `login-cloud <phone number ID> <access token>`")
+		return
+	} else if ce.User.Session != nil {
+		ce.Reply("You're already logged in with a linked device. Log out first to connect a Cloud API number.")
+		return
+	}
+	login := ce.Bridge.DB.CloudAPILogin.New()
+	login.UserMXID = ce.User.MXID
+	login.PhoneNumberID = ce.Args[0]
+	login.AccessToken = ce.Args[1]
+	if existing := ce.Bridge.CloudAPI.GetLoginByNumberID(login.PhoneNumberID); existing != nil && existing.UserMXID != ce.User.MXID {
+		ce.Reply("That phone number is already connected by another user.")
+		return
+	}
+	phone, err := ce.Bridge.CloudAPI.fetchPhoneNumber(ce.Ctx, login)
+	if err != nil {
+		ce.ZLog.Err(err).Msg("Failed to verify Cloud API login")
+		ce.Reply("Failed to verify the phone number ID and access token: %v", err)
+		return
+	}
+	login.PhoneNumber = phone
+	if existing := ce.Bridge.CloudAPI.GetLoginByPhone(phone); existing != nil && existing.UserMXID != ce.User.MXID {
+		ce.Reply("That phone number is already connected by another user.")
+		return
+	} else if other := ce.Bridge.GetUserByJID(login.JID()); other != nil {
+		ce.Reply("That phone number is already logged in with a linked device.")
+		return
+	}
+	err = login.Upsert(ce.Ctx)
+	if err != nil {
+		ce.ZLog.Err(err).Msg("Failed to save Cloud API login")
+		ce.Reply("Failed to save login: %v", err)
+		return
+	}
+	ce.Bridge.CloudAPI.addLogin(login)
+	ce.Reply("Successfully connected +%s. Incoming messages will be bridged once the webhook is configured.", phone)
+}
+
+var cmdLogoutCloud = &commands.FullHandler{
+	Func: wrapCommand(fnLogoutCloud),
+	Name: "logout-cloud",
+	Help: commands.HelpMeta{
+		Section:     commands.HelpSectionAuth,
+		Description: "Disconnect your WhatsApp Business Cloud API phone number.",
+	},
+}
+
+func fnLogoutCloud(ce *WrappedCommandEvent) {
+	if ce.Bridge.CloudAPI == nil {
+		ce.Reply("WhatsApp Business Cloud API logins are not enabled on this bridge.")
+		return
+	}
+	login := ce.Bridge.CloudAPI.GetLoginByMXID(ce.User.MXID)
+	if login == nil {
+		ce.Reply("You don't have a Cloud API number connected.")
+		return
+	}
+	err := login.Delete(ce.Ctx)
+	if err != nil {
+		ce.ZLog.Err(err).Msg("Failed to delete Cloud API login")
+		ce.Reply("Failed to delete login: %v", err)
+		return
+	}
+	ce.Bridge.CloudAPI.removeLogin(login)
+	ce.Reply("Disconnected +%s.", login.PhoneNumber)
+}
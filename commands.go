@@ -17,7 +17,9 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -27,11 +29,13 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/skip2/go-qrcode"
 	"github.com/tidwall/gjson"
+	"go.mau.fi/util/dbutil"
 
 	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/appstate"
@@ -42,6 +46,8 @@ import (
 	"github.com/element-hq/mautrix-go/bridge/status"
 	"github.com/element-hq/mautrix-go/event"
 	"github.com/element-hq/mautrix-go/id"
+
+	"github.com/element-hq/mautrix-whatsapp/database"
 )
 
 type WrappedCommandEvent struct {
@@ -49,6 +55,9 @@ type WrappedCommandEvent struct {
 	Bridge *WABridge
 	User   *User
 	Portal *Portal
+
+	threadRoot     id.EventID
+	threadRootOnce sync.Once
 }
 
 func (br *WABridge) RegisterCommands() {
@@ -63,6 +72,8 @@ func (br *WABridge) RegisterCommands() {
 		cmdCreate,
 		cmdLogin,
 		cmdLogout,
+		cmdLoginCloud,
+		cmdLogoutCloud,
 		cmdTogglePresence,
 		cmdDeleteSession,
 		cmdReconnect,
@@ -76,9 +87,59 @@ func (br *WABridge) RegisterCommands() {
 		cmdPM,
 		cmdSync,
 		cmdDisappearingTimer,
+		cmdBackfill,
+		cmdDisplaynamePreference,
+		cmdParticipants,
+		cmdLabel,
+		cmdAdmin,
+		cmdRelayFormat,
+		cmdStats,
+		cmdDB,
+		cmdDeliverySettings,
+		cmdCleanup,
+		cmdPrivacy,
+		cmdBridgeOnly,
+		cmdIgnore,
+		cmdInvitePolicy,
+		cmdRetry,
+		cmdJoinRequests,
+		cmdKeepDisappearing,
+		cmdTranslate,
+		cmdTranscribe,
+		cmdLocale,
+		cmdRoomLocale,
+		cmdLastSeen,
+		cmdUnlinkDevice,
+		cmdHistoryVisibility,
+		cmdShare,
+		cmdUnshare,
+		cmdMigrateNumber,
+		cmdSetManagementRoom,
+		cmdPurgeArchive,
+		cmdInitialSync,
 	)
 }
 
+// isPortalAdmin checks if the command sender is a bridge admin or is allowed to change the power levels
+// of the portal room.
+func (ce *WrappedCommandEvent) isPortalAdmin() bool {
+	if ce.User.Admin {
+		return true
+	} else if ce.Portal == nil {
+		return false
+	}
+	return ce.Portal.isRoomAdmin(ce.Ctx, ce.User)
+}
+
+// requirePortalAdmin replies with an error and returns false if the command sender isn't a portal or bridge admin.
+func (ce *WrappedCommandEvent) requirePortalAdmin() bool {
+	if !ce.isPortalAdmin() {
+		ce.Reply("Only room admins and bridge admins can change this setting")
+		return false
+	}
+	return true
+}
+
 func wrapCommand(handler func(*WrappedCommandEvent)) func(*commands.Event) {
 	return func(ce *commands.Event) {
 		user := ce.User.(*User)
@@ -87,7 +148,7 @@ func wrapCommand(handler func(*WrappedCommandEvent)) func(*commands.Event) {
 			portal = ce.Portal.(*Portal)
 		}
 		br := ce.Bridge.Child.(*WABridge)
-		handler(&WrappedCommandEvent{ce, br, user, portal})
+		handler(&WrappedCommandEvent{Event: ce, Bridge: br, User: user, Portal: portal})
 	}
 }
 
@@ -104,7 +165,8 @@ var cmdSetRelay = &commands.FullHandler{
 	Name: "set-relay",
 	Help: commands.HelpMeta{
 		Section:     HelpSectionPortalManagement,
-		Description: "Relay messages in this room through your WhatsApp account.",
+		Description: "Relay messages in this room through your WhatsApp account, or another user's account (admin only).",
+		Args:        "[_Matrix user ID_]",
 	},
 	RequiresPortal: true,
 	RequiresLogin:  true,
@@ -116,12 +178,27 @@ func fnSetRelay(ce *WrappedCommandEvent) {
 	} else if ce.Bridge.Config.Bridge.Relay.AdminOnly && !ce.User.Admin {
 		ce.Reply("Only bridge admins are allowed to enable relay mode on this instance of the bridge")
 	} else {
-		ce.Portal.RelayUserID = ce.User.MXID
-		err := ce.Portal.Update(ce.Ctx)
+		relayUser := ce.User
+		if len(ce.Args) > 0 && id.UserID(ce.Args[0]) != ce.User.MXID {
+			if !ce.User.Admin {
+				ce.Reply("Only bridge admins are allowed to set other users as the relay")
+				return
+			}
+			relayUser = ce.Bridge.GetUserByMXIDIfExists(id.UserID(ce.Args[0]))
+			if relayUser == nil || !relayUser.IsLoggedIn() {
+				ce.Reply("That user is not logged into the bridge")
+				return
+			}
+		}
+		err := ce.Portal.SetRelayUser(ce.Ctx, relayUser)
 		if err != nil {
 			ce.ZLog.Err(err).Msg("Failed to save portal after setting relay user")
 		}
-		ce.Reply("Messages from non-logged-in users in this room will now be bridged through your WhatsApp account")
+		if relayUser == ce.User {
+			ce.Reply("Messages from non-logged-in users in this room will now be bridged through your WhatsApp account")
+		} else {
+			ce.Reply("Messages from non-logged-in users in this room will now be bridged through the WhatsApp account of %s", relayUser.MXID)
+		}
 	}
 }
 
@@ -141,8 +218,7 @@ func fnUnsetRelay(ce *WrappedCommandEvent) {
 	} else if ce.Bridge.Config.Bridge.Relay.AdminOnly && !ce.User.Admin {
 		ce.Reply("Only bridge admins are allowed to enable relay mode on this instance of the bridge")
 	} else {
-		ce.Portal.RelayUserID = ""
-		err := ce.Portal.Update(ce.Ctx)
+		err := ce.Portal.SetRelayUser(ce.Ctx, nil)
 		if err != nil {
 			ce.ZLog.Err(err).Msg("Failed to save portal after clearing relay user")
 		}
@@ -310,12 +386,28 @@ var cmdAccept = &commands.FullHandler{
 		Section:     HelpSectionInvites,
 		Description: "Accept a group invite. This can only be used in reply to a group invite message.",
 	},
-	RequiresLogin:  true,
-	RequiresPortal: true,
+	RequiresLogin: true,
+}
+
+func getRepliedGroupInvite(ce *WrappedCommandEvent) *database.PendingGroupInvite {
+	if ce.Portal != nil || len(ce.ReplyTo) == 0 {
+		return nil
+	}
+	invite, err := ce.Bridge.DB.PendingGroupInvite.GetByNotice(ce.Ctx, ce.User.MXID, ce.ReplyTo)
+	if err != nil {
+		ce.ZLog.Err(err).Stringer("reply_to_mxid", ce.ReplyTo).Msg("Failed to get pending group invite")
+	}
+	return invite
 }
 
 func fnAccept(ce *WrappedCommandEvent) {
-	if len(ce.ReplyTo) == 0 {
+	if invite := getRepliedGroupInvite(ce); invite != nil {
+		if err := ce.User.AcceptPendingGroupInvite(ce.Ctx, invite); err != nil {
+			ce.Reply("Failed to accept invite to %s: %v", invite.GroupName, err)
+		} else {
+			ce.Reply("Accepted **%s**, the portal should be created momentarily", invite.GroupName)
+		}
+	} else if len(ce.ReplyTo) == 0 || ce.Portal == nil {
 		ce.Reply("You must reply to a group invite message when using this command.")
 	} else if evt, err := ce.Portal.MainIntent().GetEvent(ce.Ctx, ce.RoomID, ce.ReplyTo); err != nil {
 		ce.ZLog.Err(err).Stringer("reply_to_mxid", ce.ReplyTo).Msg("Failed to get reply target event to handle !wa accept command")
@@ -498,12 +590,15 @@ func fnLogin(ce *WrappedCommandEvent) {
 		ce.Reply("Failed to log in: %v", err)
 		return
 	}
+	loginEvents := newLoginAnalytics(ce.User.MXID, AnalyticsSourceCommand, phoneNumber)
+	loginEvents.Start()
 
 	if phoneNumber != "" {
 		pairingCode, err := ce.User.Client.PairPhone(phoneNumber, true, whatsmeow.PairClientChrome, "Chrome (Linux)")
 		if err != nil {
 			ce.ZLog.Err(err).Msg("Failed to start phone code login")
 			ce.Reply("Failed to start phone code login: %v", err)
+			loginEvents.Failure("code error")
 			go ce.User.DeleteConnection()
 			return
 		}
@@ -515,18 +610,27 @@ func fnLogin(ce *WrappedCommandEvent) {
 		switch item.Event {
 		case whatsmeow.QRChannelSuccess.Event:
 			jid := ce.User.Client.Store.ID
+			loginEvents.Success(ce.User.Client.Store.Platform)
 			ce.Reply("Successfully logged in as +%s (device #%d)", jid.User, jid.Device)
 		case whatsmeow.QRChannelTimeout.Event:
-			ce.Reply("Login timed out. Please restart the login.")
+			loginEvents.Failure("login timed out")
+			ce.Reply("Login timed out. Please restart the login.%s", ce.User.getUnusedCompanionsHint(ce))
 		case whatsmeow.QRChannelErrUnexpectedEvent.Event:
+			loginEvents.Failure("unexpected event")
 			ce.Reply("Failed to log in: unexpected connection event from server")
 		case whatsmeow.QRChannelClientOutdated.Event:
+			loginEvents.Failure("bridge outdated")
 			ce.Reply("Failed to log in: outdated client. The bridge must be updated to continue.")
 		case whatsmeow.QRChannelScannedWithoutMultidevice.Event:
+			loginEvents.Failure("multidevice not enabled")
 			ce.Reply("Please enable the WhatsApp multidevice beta and scan the QR code again.")
 		case "error":
+			loginEvents.Failure("fatal error")
 			ce.Reply("Failed to log in: %v", item.Error)
 		case "code":
+			if qrEventID == "" {
+				loginEvents.QRCodeRetrieved()
+			}
 			qrEventID = ce.User.sendQR(ce, item.Code, qrEventID)
 		}
 	}
@@ -605,6 +709,7 @@ func fnLogout(ce *WrappedCommandEvent) {
 	ce.User.removeFromJIDMap(status.BridgeState{StateEvent: status.StateLoggedOut})
 	ce.User.DeleteConnection()
 	ce.User.DeleteSession(ce.Ctx)
+	Analytics.Track(ce.User.MXID, AnalyticsLogout, map[string]interface{}{"reason": "user"})
 	ce.Reply("Logged out successfully.")
 }
 
@@ -1172,7 +1277,7 @@ func fnSync(ce *WrappedCommandEvent) {
 		}
 	}
 	if space {
-		if !ce.Bridge.Config.Bridge.PersonalFilteringSpaces {
+		if !ce.Bridge.Config.Bridge.PersonalSpacesEnabled() {
 			ce.Reply("Personal filtering spaces are not enabled on this instance of the bridge")
 			return
 		}
@@ -1241,3 +1346,1191 @@ func fnDisappearingTimer(ce *WrappedCommandEvent) {
 	}
 	ce.React("✅")
 }
+
+var cmdBackfill = &commands.FullHandler{
+	Func: wrapCommand(fnBackfill),
+	Name: "backfill",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionMiscellaneous,
+		Description: "View or control the history backfill queue. `prioritize` must be used in a portal room.",
+		Args:        "<status/pause/resume/prioritize>",
+	},
+	RequiresLogin: true,
+}
+
+func fnBackfill(ce *WrappedCommandEvent) {
+	if len(ce.Args) == 0 {
+		ce.Reply("**Usage:** `backfill <status/pause/resume/prioritize>`")
+		return
+	}
+	bq := ce.User.BackfillQueue
+	if bq == nil {
+		ce.Reply("Backfilling is not enabled for your account")
+		return
+	}
+	switch strings.ToLower(ce.Args[0]) {
+	case "status":
+		counts, err := ce.Bridge.DB.BackfillQueue.CountPending(ce.Ctx, ce.User.MXID)
+		if err != nil {
+			ce.ZLog.Err(err).Msg("Failed to count pending backfill tasks")
+			ce.Reply("Failed to get backfill queue status")
+			return
+		}
+		state := "running"
+		if bq.IsPaused() {
+			state = "paused"
+		}
+		ce.Reply("Backfill queue is %s. Pending tasks: %d immediate, %d forward, %d deferred",
+			state, counts[database.BackfillImmediate], counts[database.BackfillForward], counts[database.BackfillDeferred])
+	case "pause", "resume":
+		paused := strings.ToLower(ce.Args[0]) == "pause"
+		if bq.IsPaused() == paused {
+			ce.Reply("Backfill queue is already %sd", strings.ToLower(ce.Args[0]))
+			return
+		}
+		err := bq.SetPaused(ce.Ctx, ce.User.MXID, paused)
+		if err != nil {
+			ce.ZLog.Err(err).Msg("Failed to update backfill queue state")
+			ce.Reply("Failed to update backfill queue state")
+			return
+		}
+		ce.React("✅")
+	case "prioritize":
+		if ce.Portal == nil {
+			ce.Reply("`backfill prioritize` can only be used in portal rooms")
+			return
+		}
+		err := ce.Bridge.DB.BackfillQueue.SetPortalPriority(ce.Ctx, ce.User.MXID, ce.Portal.Key, -1)
+		if err != nil {
+			ce.ZLog.Err(err).Msg("Failed to prioritize backfill tasks")
+			ce.Reply("Failed to prioritize backfill tasks")
+			return
+		}
+		bq.ReCheck()
+		ce.React("✅")
+	default:
+		ce.Reply("**Usage:** `backfill <status/pause/resume/prioritize>`")
+	}
+}
+
+var cmdDisplaynamePreference = &commands.FullHandler{
+	Func: wrapCommand(fnDisplaynamePreference),
+	Name: "displayname-preference",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionMiscellaneous,
+		Description: "View or change which name is used for your private chat rooms.",
+		Args:        "[preference]",
+	},
+	RequiresLogin: true,
+}
+
+func fnDisplaynamePreference(ce *WrappedCommandEvent) {
+	available := make([]string, 0, len(ce.Bridge.Config.Bridge.DisplaynamePreferenceTemplates))
+	for pref := range ce.Bridge.Config.Bridge.DisplaynamePreferenceTemplates {
+		available = append(available, pref)
+	}
+	sort.Strings(available)
+	available = append([]string{"default"}, available...)
+	if len(ce.Args) == 0 {
+		current := ce.User.NamePreference
+		if current == "" {
+			current = "default"
+		}
+		ce.Reply("Your current displayname preference is `%s`. Available preferences: `%s`", current, strings.Join(available, "`, `"))
+		return
+	}
+	pref := strings.ToLower(ce.Args[0])
+	if pref == "default" {
+		pref = ""
+	} else if !ce.Bridge.Config.Bridge.HasDisplaynamePreference(pref) {
+		ce.Reply("Unknown displayname preference `%s`. Available preferences: `%s`", ce.Args[0], strings.Join(available, "`, `"))
+		return
+	}
+	ce.User.NamePreference = pref
+	err := ce.User.Update(ce.Ctx)
+	if err != nil {
+		ce.ZLog.Err(err).Msg("Failed to save displayname preference")
+		ce.Reply("Failed to save displayname preference")
+		return
+	}
+	ce.Reply("Displayname preference updated, re-rendering private chat names in the background")
+	go ce.User.resyncPrivateChatNames()
+}
+
+var cmdParticipants = &commands.FullHandler{
+	Func: wrapCommand(fnParticipants),
+	Name: "participants",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionPortalManagement,
+		Description: "List the members of the WhatsApp group, optionally as a CSV file.",
+		Args:        "[--csv]",
+	},
+	RequiresLogin:  true,
+	RequiresPortal: true,
+}
+
+type participantInfo struct {
+	Phone  string
+	LID    string
+	Role   string
+	Puppet *Puppet
+}
+
+func fnParticipants(ce *WrappedCommandEvent) {
+	if !ce.Portal.IsGroupChat() {
+		ce.Reply("This is not a group portal")
+		return
+	}
+	groupInfo, err := ce.User.Client.GetGroupInfo(ce.Portal.Key.JID)
+	if err != nil {
+		ce.ZLog.Err(err).Msg("Failed to get group info")
+		ce.Reply("Failed to get group info: %v", err)
+		return
+	}
+	participants := make([]participantInfo, len(groupInfo.Participants))
+	for i, participant := range groupInfo.Participants {
+		info := participantInfo{Role: "member"}
+		if participant.JID.Server == types.HiddenUserServer {
+			info.LID = participant.JID.User
+		} else {
+			info.Phone = "+" + participant.JID.User
+			info.Puppet = ce.Bridge.GetPuppetByJID(participant.JID)
+		}
+		if participant.IsSuperAdmin {
+			info.Role = "super admin"
+		} else if participant.IsAdmin {
+			info.Role = "admin"
+		}
+		participants[i] = info
+	}
+	sort.Slice(participants, func(i, j int) bool {
+		return participants[i].Phone+participants[i].LID < participants[j].Phone+participants[j].LID
+	})
+
+	if len(ce.Args) > 0 && strings.ToLower(ce.Args[0]) == "--csv" {
+		sendParticipantsCSV(ce, groupInfo.Name, participants)
+		return
+	}
+
+	lines := make([]string, len(participants))
+	for i, info := range participants {
+		identifier := info.Phone
+		if identifier == "" {
+			identifier = "LID " + info.LID
+		}
+		line := fmt.Sprintf("* `%s` - %s", identifier, info.Role)
+		if info.Puppet != nil {
+			line += fmt.Sprintf(" - [%s](https://matrix.to/#/%s)", escapeMarkdown(info.Puppet.Displayname), info.Puppet.MXID)
+		}
+		lines[i] = line
+	}
+	ce.Reply("**%s** has %d participants:\n\n%s", escapeMarkdown(groupInfo.Name), len(participants), strings.Join(lines, "\n"))
+}
+
+func sendParticipantsCSV(ce *WrappedCommandEvent, groupName string, participants []participantInfo) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	_ = writer.Write([]string{"phone", "lid", "role", "displayname", "matrix_id"})
+	for _, info := range participants {
+		var displayname, mxid string
+		if info.Puppet != nil {
+			displayname = info.Puppet.Displayname
+			mxid = info.Puppet.MXID.String()
+		}
+		_ = writer.Write([]string{info.Phone, info.LID, info.Role, displayname, mxid})
+	}
+	writer.Flush()
+	data := buf.Bytes()
+	content := &event.MessageEventContent{
+		MsgType:  event.MsgFile,
+		Body:     "participants.csv",
+		FileName: "participants.csv",
+		Info: &event.FileInfo{
+			MimeType: "text/csv",
+			Size:     len(data),
+		},
+	}
+	err := ce.Portal.uploadMedia(ce.Ctx, ce.Portal.MainIntent(), data, content)
+	if err != nil {
+		ce.ZLog.Err(err).Msg("Failed to upload participant list")
+		ce.Reply("Failed to upload participant list: %v", err)
+		return
+	}
+	_, err = ce.Portal.sendMainIntentMessage(ce.Ctx, content)
+	if err != nil {
+		ce.ZLog.Err(err).Msg("Failed to send participant list")
+		ce.Reply("Failed to send participant list: %v", err)
+	} else {
+		ce.ZLog.Debug().Str("group_name", groupName).Int("participant_count", len(participants)).Msg("Sent participant list CSV")
+	}
+}
+
+var cmdLabel = &commands.FullHandler{
+	Func: wrapCommand(fnLabel),
+	Name: "label",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionPortalManagement,
+		Description: "List WhatsApp Business labels, or add/remove a label on the current chat.",
+		Args:        "<list/add/remove> [_label name_]",
+	},
+	RequiresLogin: true,
+}
+
+func fnLabel(ce *WrappedCommandEvent) {
+	if len(ce.Args) == 0 {
+		ce.Reply("**Usage:** `label <list/add/remove> [label name]`")
+		return
+	}
+	action := strings.ToLower(ce.Args[0])
+	switch action {
+	case "list":
+		labels, err := ce.Bridge.DB.Label.GetAll(ce.Ctx, ce.User.MXID)
+		if err != nil {
+			ce.ZLog.Err(err).Msg("Failed to get labels")
+			ce.Reply("Failed to get labels")
+			return
+		} else if len(labels) == 0 {
+			ce.Reply("You don't have any labels")
+			return
+		}
+		var portalLabels map[string]struct{}
+		if ce.Portal != nil {
+			labelsInPortal, err := ce.Bridge.DB.Label.GetForPortal(ce.Ctx, ce.User.MXID, ce.Portal.Key)
+			if err != nil {
+				ce.ZLog.Err(err).Msg("Failed to get portal labels")
+			}
+			portalLabels = make(map[string]struct{}, len(labelsInPortal))
+			for _, label := range labelsInPortal {
+				portalLabels[label.ID] = struct{}{}
+			}
+		}
+		lines := make([]string, len(labels))
+		for i, label := range labels {
+			lines[i] = fmt.Sprintf("* %s", label.Name)
+			if _, ok := portalLabels[label.ID]; ok {
+				lines[i] += " (applied to this chat)"
+			}
+		}
+		ce.Reply("Labels:\n\n%s", strings.Join(lines, "\n"))
+	case "add", "remove":
+		if len(ce.Args) < 2 {
+			ce.Reply("**Usage:** `label %s <label name>`", action)
+			return
+		} else if ce.Portal == nil {
+			ce.Reply("This is not a portal room")
+			return
+		}
+		name := strings.Join(ce.Args[1:], " ")
+		label, err := ce.Bridge.DB.Label.GetByName(ce.Ctx, ce.User.MXID, name)
+		if err != nil {
+			ce.ZLog.Err(err).Msg("Failed to get label")
+			ce.Reply("Failed to get label")
+			return
+		} else if label == nil {
+			ce.Reply("Label `%s` not found", name)
+			return
+		}
+		labeled := action == "add"
+		err = ce.User.Client.SendAppState(appstate.BuildLabelChat(ce.Portal.Key.JID, label.ID, labeled))
+		if err != nil {
+			ce.ZLog.Err(err).Msg("Failed to send label change to WhatsApp")
+			ce.Reply("Failed to update label on WhatsApp: %v", err)
+			return
+		}
+		ce.User.setPortalLabel(ce.Ctx, ce.Portal, label.ID, labeled)
+		ce.React("✅")
+	default:
+		ce.Reply("**Usage:** `label <list/add/remove> [label name]`")
+	}
+}
+
+var cmdAdmin = &commands.FullHandler{
+	Func: wrapCommand(fnAdmin),
+	Name: "admin",
+	Help: commands.HelpMeta{
+		Section:     commands.HelpSectionAdmin,
+		Description: "Bridge administration commands. `announce` sends a notice to the management rooms of all users.",
+		Args:        "announce <_message_>",
+	},
+	RequiresAdmin: true,
+}
+
+func fnAdmin(ce *WrappedCommandEvent) {
+	if len(ce.Args) < 2 || strings.ToLower(ce.Args[0]) != "announce" {
+		ce.Reply("**Usage:** `admin announce <message>`")
+		return
+	}
+	message := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(ce.RawArgs), ce.Args[0]))
+	ann, err := ce.Bridge.StartAnnouncement(ce.Ctx, ce.User.MXID, message)
+	if err != nil {
+		ce.ZLog.Err(err).Msg("Failed to create announcement")
+		ce.Reply("Failed to create announcement")
+		return
+	}
+	ce.Reply("Started sending announcement #%d to all management rooms", ann.ID)
+}
+
+var cmdRelayFormat = &commands.FullHandler{
+	Func: wrapCommand(fnRelayFormat),
+	Name: "relay-format",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionPortalManagement,
+		Description: "View or change the relaybot message format for a msgtype in this room. Use `reset` to go back to the default format.",
+		Args:        "<_msgtype_> [_template_ | reset]",
+	},
+	RequiresPortal: true,
+}
+
+func fnRelayFormat(ce *WrappedCommandEvent) {
+	if !ce.Bridge.Config.Bridge.Relay.Enabled {
+		ce.Reply("Relay mode is not enabled on this instance of the bridge")
+		return
+	} else if ce.Bridge.Config.Bridge.Relay.AdminOnly && !ce.User.Admin {
+		ce.Reply("Only bridge admins are allowed to change relay formats on this instance of the bridge")
+		return
+	} else if len(ce.Args) == 0 {
+		ce.Reply("**Usage:** `relay-format <msgtype> [template | reset]`")
+		return
+	}
+	msgType := ce.Args[0]
+	if len(ce.Args) == 1 {
+		if format, ok := ce.Portal.RelayFormats[msgType]; ok {
+			ce.Reply("Relay format for `%s` in this room: `%s`", msgType, format)
+		} else if format, ok = ce.Bridge.Config.Bridge.Relay.MessageFormats[event.MessageType(msgType)]; ok {
+			ce.Reply("This room uses the default relay format for `%s`: `%s`", msgType, format)
+		} else {
+			ce.Reply("There is no relay format for `%s`", msgType)
+		}
+		return
+	}
+	if !ce.requirePortalAdmin() {
+		return
+	}
+	format := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(ce.RawArgs), msgType))
+	if strings.ToLower(format) == "reset" {
+		format = ""
+	}
+	err := ce.Portal.SetRelayFormat(ce.Ctx, msgType, format)
+	if err != nil {
+		ce.ZLog.Err(err).Msg("Failed to set relay format")
+		ce.Reply("Failed to set relay format: %v", err)
+		return
+	}
+	ce.React("✅")
+}
+
+var cmdStats = &commands.FullHandler{
+	Func: wrapCommand(fnStats),
+	Name: "stats",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionMiscellaneous,
+		Description: "Show statistics about your bridged messages and connection.",
+	},
+	RequiresLogin: true,
+}
+
+func formatByteSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func fnStats(ce *WrappedCommandEvent) {
+	periods := []struct {
+		name string
+		days int
+	}{{"Today", 0}, {"Last 7 days", 6}, {"Last 30 days", 29}}
+	lines := make([]string, 0, len(periods))
+	var monthTotals *database.UserStats
+	for _, period := range periods {
+		totals, err := ce.Bridge.DB.UserStats.GetTotals(ce.Ctx, ce.User.MXID, time.Now().AddDate(0, 0, -period.days))
+		if err != nil {
+			ce.ZLog.Err(err).Msg("Failed to get usage statistics")
+			ce.Reply("Failed to get usage statistics")
+			return
+		} else if totals == nil {
+			totals = &database.UserStats{}
+		}
+		monthTotals = totals
+		lines = append(lines, fmt.Sprintf(
+			"* %s: %d messages from WhatsApp, %d messages to WhatsApp, %s of media, %d failed sends",
+			period.name, totals.MessagesIn, totals.MessagesOut, formatByteSize(totals.MediaBytes), totals.FailedSends,
+		))
+	}
+
+	connectedSince := ce.User.GetConnectedSince()
+	connectedSecs := monthTotals.ConnectedSecs
+	if !connectedSince.IsZero() {
+		connectedSecs += int64(time.Since(connectedSince).Seconds())
+		lines = append(lines, fmt.Sprintf("\nConnected since %s", connectedSince.Format(time.RFC1123)))
+	} else {
+		lines = append(lines, "\nNot currently connected")
+	}
+	lines = append(lines, fmt.Sprintf("Connected for %.1f hours in the last 30 days", float64(connectedSecs)/3600))
+
+	topChats, err := ce.Bridge.DB.UserStats.GetTopChats(ce.Ctx, ce.User.MXID, time.Now().AddDate(0, 0, -29), 5)
+	if err != nil {
+		ce.ZLog.Err(err).Msg("Failed to get top chats")
+	} else if len(topChats) > 0 {
+		lines = append(lines, "\n**Top chats in the last 30 days:**\n")
+		for _, chat := range topChats {
+			name := chat.Portal.JID.String()
+			if portal := ce.Bridge.GetExistingPortalByJID(chat.Portal); portal != nil && portal.Name != "" {
+				name = portal.Name
+			}
+			lines = append(lines, fmt.Sprintf("* %s: %d messages", name, chat.MessagesIn+chat.MessagesOut))
+		}
+	}
+	ce.Reply("**Usage statistics:**\n\n%s", strings.Join(lines, "\n"))
+}
+
+var cmdDB = &commands.FullHandler{
+	Func: wrapCommand(fnDB),
+	Name: "db",
+	Help: commands.HelpMeta{
+		Section:     commands.HelpSectionAdmin,
+		Description: "Inspect the bridge database. `inspect` shows the schema version and table sizes, `doctor` checks for known inconsistencies and deletes the broken rows if `--fix` is passed.",
+		Args:        "<inspect | doctor [--fix]>",
+	},
+	RequiresAdmin: true,
+}
+
+func fnDB(ce *WrappedCommandEvent) {
+	if len(ce.Args) == 0 {
+		ce.Reply("**Usage:** `db <inspect | doctor [--fix]>`")
+		return
+	}
+	switch strings.ToLower(ce.Args[0]) {
+	case "inspect":
+		info, err := ce.Bridge.DB.Inspect(ce.Ctx)
+		if err != nil {
+			ce.ZLog.Err(err).Msg("Failed to inspect database")
+			ce.Reply("Failed to inspect database: %v", err)
+			return
+		}
+		ce.Reply(formatSchemaInfo(info, ce.Bridge.DB.Dialect))
+	case "doctor":
+		fix := len(ce.Args) > 1 && ce.Args[1] == "--fix"
+		results, err := ce.Bridge.DB.Doctor(ce.Ctx, fix)
+		if err != nil {
+			ce.ZLog.Err(err).Msg("Failed to run database doctor")
+			ce.Reply("Failed to check database: %v", err)
+			return
+		}
+		var out strings.Builder
+		foundIssues := false
+		for _, result := range results {
+			if result.Count == 0 {
+				continue
+			}
+			foundIssues = true
+			_, _ = fmt.Fprintf(&out, "* %s (`%s`): %d", result.Check.Description, result.Check.Name, result.Count)
+			if result.Fixed {
+				out.WriteString(" - fixed")
+			}
+			out.WriteByte('\n')
+		}
+		if !foundIssues {
+			ce.Reply("No inconsistencies found")
+		} else if !fix {
+			ce.Reply("Found inconsistencies:\n\n%s\nRun `db doctor --fix` to delete the inconsistent rows.", out.String())
+		} else {
+			ce.Reply("Found inconsistencies:\n\n%s", out.String())
+		}
+	default:
+		ce.Reply("**Usage:** `db <inspect | doctor [--fix]>`")
+	}
+}
+
+func formatSchemaInfo(info *database.SchemaInfo, dialect dbutil.Dialect) string {
+	var out strings.Builder
+	_, _ = fmt.Fprintf(&out, "**Schema version:** %d (compatible with v%d+, latest v%d)\n", info.Version, info.Compat, info.Latest)
+	if pending := info.PendingMigrations(); pending > 0 {
+		_, _ = fmt.Fprintf(&out, "**Pending migrations:** %d\n", pending)
+	}
+	out.WriteString("\n**Tables:**\n\n")
+	for _, table := range info.Tables {
+		_, _ = fmt.Fprintf(&out, "* `%s`: %d rows\n", strings.Trim(table.Name, `"`), table.Rows)
+	}
+	if dialect == dbutil.Postgres {
+		if len(info.UnusedIndexes) > 0 {
+			_, _ = fmt.Fprintf(&out, "\n**Unused indexes:** `%s`\n", strings.Join(info.UnusedIndexes, "`, `"))
+		} else {
+			out.WriteString("\nAll indexes have been used\n")
+		}
+	} else {
+		_, _ = fmt.Fprintf(&out, "\n**Integrity check:** %s\n", info.IntegrityCheck)
+	}
+	return out.String()
+}
+
+var cmdDeliverySettings = &commands.FullHandler{
+	Func: wrapCommand(fnDeliverySettings),
+	Name: "delivery-settings",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionMiscellaneous,
+		Description: "View or change which read receipts, delivery receipts and typing notifications are bridged.",
+		Args:        "[<setting> <on/off>]",
+	},
+	RequiresLogin: true,
+}
+
+func fnDeliverySettings(ce *WrappedCommandEvent) {
+	if len(ce.Args) == 0 {
+		var out strings.Builder
+		out.WriteString("Your current delivery settings:\n\n")
+		for _, setting := range deliverySettings {
+			state := "on"
+			if !ce.User.IsDeliveryEnabled(setting.Flag) {
+				state = "off"
+			}
+			_, _ = fmt.Fprintf(&out, "* `%s`: **%s** - %s\n", setting.Name, state, setting.Description)
+		}
+		ce.Reply(out.String())
+		return
+	} else if len(ce.Args) != 2 {
+		ce.Reply("**Usage:** `delivery-settings [<setting> <on/off>]`")
+		return
+	}
+	flag, ok := getDeliverySetting(strings.ToLower(ce.Args[0]))
+	if !ok {
+		ce.Reply("Unknown setting `%s`. Use `delivery-settings` without arguments to see the available settings.", ce.Args[0])
+		return
+	}
+	var enabled bool
+	switch strings.ToLower(ce.Args[1]) {
+	case "on", "true", "enable":
+		enabled = true
+	case "off", "false", "disable":
+		enabled = false
+	default:
+		ce.Reply("**Usage:** `delivery-settings [<setting> <on/off>]`")
+		return
+	}
+	ce.User.SetDeliveryEnabled(flag, enabled)
+	err := ce.User.Update(ce.Ctx)
+	if err != nil {
+		ce.ZLog.Err(err).Msg("Failed to save delivery settings")
+		ce.Reply("Failed to save delivery settings")
+		return
+	}
+	ce.React("✅")
+}
+
+var cmdCleanup = &commands.FullHandler{
+	Func: wrapCommand(fnCleanup),
+	Name: "cleanup",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionPortalManagement,
+		Description: "Archive or delete portals whose WhatsApp chat no longer exists or which have been inactive.",
+		Args:        "[--dry-run]",
+	},
+	RequiresAdmin: true,
+}
+
+func fnCleanup(ce *WrappedCommandEvent) {
+	dryRun := len(ce.Args) > 0 && ce.Args[0] == "--dry-run"
+	if len(ce.Args) > 1 || (len(ce.Args) == 1 && !dryRun) {
+		ce.Reply("**Usage:** `cleanup [--dry-run]`")
+		return
+	}
+	candidates, err := ce.Bridge.FindPortalsToCleanup(ce.Ctx)
+	if err != nil {
+		ce.ZLog.Err(err).Msg("Failed to find portals to clean up")
+		ce.Reply("Failed to find portals to clean up: %v", err)
+		return
+	} else if len(candidates) == 0 {
+		ce.Reply("Didn't find any portals to clean up")
+		return
+	}
+	action := ce.Bridge.Config.Bridge.PortalCleanup.Action
+	if action != PortalCleanupActionDelete {
+		action = PortalCleanupActionArchive
+	}
+	lines := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		name := candidate.Portal.Name
+		if name == "" {
+			name = candidate.Portal.Key.JID.String()
+		}
+		lines[i] = fmt.Sprintf("* [%s](%s) - %s", name, candidate.Portal.MXID.URI(ce.Bridge.Config.Homeserver.Domain).MatrixToURL(), candidate.Reason)
+	}
+	if dryRun {
+		ce.Reply("Would %s %d portals:\n\n%s", action, len(candidates), strings.Join(lines, "\n"))
+		return
+	}
+	ce.Reply("Found %d portals to %s:\n\n%s", len(candidates), action, strings.Join(lines, "\n"))
+	go func() {
+		ce.Bridge.CleanupPortals(ce.Ctx, candidates)
+		ce.Reply("Finished cleaning up %d portals", len(candidates))
+	}()
+}
+
+var cmdPrivacy = &commands.FullHandler{
+	Func: wrapCommand(fnPrivacy),
+	Name: "privacy",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionMiscellaneous,
+		Description: "View or change whether analytics and activity tracking is enabled for your account.",
+		Args:        "[analytics <on/off>]",
+	},
+}
+
+func fnPrivacy(ce *WrappedCommandEvent) {
+	if len(ce.Args) == 0 {
+		if ce.User.IsTrackingAllowed() {
+			ce.Reply("Analytics and activity tracking is **enabled** for your account.")
+		} else {
+			ce.Reply("Analytics and activity tracking is **disabled** for your account.")
+		}
+		return
+	} else if len(ce.Args) != 2 || strings.ToLower(ce.Args[0]) != "analytics" {
+		ce.Reply("**Usage:** `privacy [analytics <on/off>]`")
+		return
+	}
+	var optOut bool
+	switch strings.ToLower(ce.Args[1]) {
+	case "on", "true", "enable":
+		optOut = false
+	case "off", "false", "disable":
+		optOut = true
+	default:
+		ce.Reply("**Usage:** `privacy [analytics <on/off>]`")
+		return
+	}
+	err := ce.User.SetAnalyticsOptOut(ce.Ctx, optOut)
+	if err != nil {
+		ce.ZLog.Err(err).Msg("Failed to save analytics opt-out")
+		ce.Reply("Failed to save privacy settings")
+		return
+	}
+	ce.React("✅")
+}
+
+var cmdBridgeOnly = &commands.FullHandler{
+	Func: wrapCommand(fnBridgeOnly),
+	Name: "bridge-only",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionPortalManagement,
+		Description: "Only bridge the given chats. Without arguments, lists the chats that are currently allowed.",
+		Args:        "[--remove | --clear] [_JID, phone number or invite link_...]",
+	},
+}
+
+func fnBridgeOnly(ce *WrappedCommandEvent) {
+	fnChatFilter(ce, database.ChatFilterAllow, "bridge-only")
+}
+
+var cmdIgnore = &commands.FullHandler{
+	Func: wrapCommand(fnIgnore),
+	Name: "ignore",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionPortalManagement,
+		Description: "Stop bridging the given chats, or ignore the pending group invite being replied to. Without arguments, lists the chats that are currently ignored.",
+		Args:        "[--remove | --clear] [_JID, phone number or invite link_...]",
+	},
+}
+
+func fnIgnore(ce *WrappedCommandEvent) {
+	if len(ce.Args) == 0 {
+		if invite := getRepliedGroupInvite(ce); invite != nil {
+			if err := ce.User.IgnorePendingGroupInvite(ce.Ctx, invite); err != nil {
+				ce.Reply("Failed to ignore invite to %s: %v", invite.GroupName, err)
+			} else {
+				ce.Reply("Ignored **%s**", invite.GroupName)
+			}
+			return
+		}
+	}
+	fnChatFilter(ce, database.ChatFilterDeny, "ignore")
+}
+
+func fnChatFilter(ce *WrappedCommandEvent, action database.ChatFilterAction, command string) {
+	if len(ce.Args) == 0 {
+		allowed, denied := ce.User.GetChatFilters(ce.Ctx)
+		list := denied
+		if action == database.ChatFilterAllow {
+			list = allowed
+		}
+		if len(list) == 0 && action == database.ChatFilterAllow {
+			ce.Reply("You haven't limited bridging to any specific chats")
+		} else if len(list) == 0 {
+			ce.Reply("You haven't ignored any chats")
+		} else {
+			lines := make([]string, len(list))
+			for i, jid := range list {
+				lines[i] = fmt.Sprintf("* `%s`", jid)
+			}
+			ce.Reply(strings.Join(lines, "\n"))
+		}
+		return
+	}
+	switch ce.Args[0] {
+	case "--clear":
+		err := ce.User.ClearChatFilters(ce.Ctx, action)
+		if err != nil {
+			ce.ZLog.Err(err).Msg("Failed to clear chat filters")
+			ce.Reply("Failed to clear chat filters")
+		} else {
+			ce.React("✅")
+		}
+		return
+	case "--remove":
+		action = ""
+		ce.Args = ce.Args[1:]
+	}
+	if len(ce.Args) == 0 {
+		ce.Reply("**Usage:** `%s [--remove | --clear] [JID, phone number or invite link...]`", command)
+		return
+	}
+	for _, target := range ce.Args {
+		jid, err := ce.User.resolveChatFilterTarget(target)
+		if err != nil {
+			ce.Reply("Failed to parse `%s`: %v", target, err)
+			return
+		}
+		err = ce.User.SetChatFilter(ce.Ctx, jid, action)
+		if err != nil {
+			ce.ZLog.Err(err).Stringer("chat_jid", jid).Msg("Failed to save chat filter")
+			ce.Reply("Failed to save chat filter for `%s`", jid)
+			return
+		}
+	}
+	ce.React("✅")
+}
+
+var cmdInvitePolicy = &commands.FullHandler{
+	Func: wrapCommand(fnInvitePolicy),
+	Name: "invite-policy",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionInvites,
+		Description: "View or change what happens when you're added to a new WhatsApp group, and list pending group invites.",
+		Args:        "[always | ask | ignore]",
+	},
+	RequiresLogin: true,
+}
+
+func fnInvitePolicy(ce *WrappedCommandEvent) {
+	if len(ce.Args) == 0 {
+		invites, err := ce.Bridge.DB.PendingGroupInvite.GetAll(ce.Ctx, ce.User.MXID)
+		if err != nil {
+			ce.ZLog.Err(err).Msg("Failed to get pending group invites")
+		}
+		lines := []string{fmt.Sprintf("Your group invite policy is `%s`", ce.User.GetGroupInvitePolicy())}
+		if len(invites) > 0 {
+			lines = append(lines, "", "Pending group invites:")
+			for _, invite := range invites {
+				lines = append(lines, fmt.Sprintf("* %s (`%s`), expires %s", invite.GroupName, invite.GroupJID, invite.ExpiresAt.Format(time.RFC1123)))
+			}
+		}
+		ce.Reply(strings.Join(lines, "\n"))
+		return
+	}
+	policy, ok := parseGroupInvitePolicy(strings.ToLower(ce.Args[0]))
+	if !ok {
+		ce.Reply("**Usage:** `invite-policy [always | ask | ignore]`")
+		return
+	}
+	ce.User.GroupInvitePolicy = policy
+	err := ce.User.Update(ce.Ctx)
+	if err != nil {
+		ce.ZLog.Err(err).Msg("Failed to save group invite policy")
+		ce.Reply("Failed to save group invite policy")
+	} else {
+		ce.React("✅")
+	}
+}
+
+var cmdRetry = &commands.FullHandler{
+	Func: wrapCommand(fnRetry),
+	Name: "retry",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionPortalManagement,
+		Description: "Try sending a message that failed to bridge to WhatsApp again. Reply to the message or pass its event ID.",
+		Args:        "[_event ID_]",
+	},
+	RequiresLogin:  true,
+	RequiresPortal: true,
+}
+
+func fnRetry(ce *WrappedCommandEvent) {
+	target := ce.ReplyTo
+	if len(ce.Args) > 0 {
+		target = id.EventID(ce.Args[0])
+	}
+	if len(target) == 0 {
+		ce.Reply("**Usage:** `retry <event ID>` or reply to the failed message with `retry`")
+		return
+	}
+	err := ce.Portal.RetryFailedMatrixMessage(ce.Ctx, ce.User, target)
+	if err != nil {
+		ce.ZLog.Debug().Err(err).Stringer("target_event_id", target).Msg("Failed to retry message")
+		ce.Reply("Failed to retry message: %v", err)
+	} else {
+		ce.React("✅")
+	}
+}
+
+var cmdJoinRequests = &commands.FullHandler{
+	Func: wrapCommand(fnJoinRequests),
+	Name: "join-requests",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionPortalManagement,
+		Description: "List pending requests to join the current group. React to each request with ✅ to approve or ❌ to reject it.",
+	},
+	RequiresLogin:  true,
+	RequiresPortal: true,
+}
+
+func fnJoinRequests(ce *WrappedCommandEvent) {
+	if !ce.Portal.IsGroupChat() {
+		ce.Reply("This is not a group portal")
+		return
+	}
+	groupJID := ce.Portal.Key.JID
+	requests, err := ce.User.Client.GetGroupRequestParticipants(groupJID)
+	if err != nil {
+		ce.Reply("Failed to get join requests: %v", err)
+		return
+	} else if len(requests) == 0 {
+		ce.Reply("There are no pending join requests")
+		return
+	}
+	for _, requester := range requests {
+		text := fmt.Sprintf("%s wants to join this group. React with ✅ to approve or ❌ to reject.", ce.Portal.describeJoinRequester(requester))
+		_, err = ce.User.SendPrompt(ce.Ctx, ce.Portal.MainIntent(), ce.RoomID, text, PromptJoinRequest, requester.String())
+		if err != nil {
+			ce.ZLog.Warn().Err(err).Stringer("requester_jid", requester).Msg("Failed to send join request prompt")
+		}
+	}
+}
+
+// describeJoinRequester returns the escaped name and phone number of a user who requested to join the group.
+func (portal *Portal) describeJoinRequester(requester types.JID) string {
+	name := requester.User
+	if puppet := portal.bridge.GetPuppetByJID(requester); puppet != nil && len(puppet.Displayname) > 0 {
+		name = puppet.Displayname
+	}
+	return fmt.Sprintf("%s (+%s)", escapeMarkdown(name), requester.User)
+}
+
+// answerJoinRequestPrompt approves or rejects a join request that was listed by the join-requests command.
+func (portal *Portal) answerJoinRequestPrompt(ctx context.Context, user *User, requester types.JID, accepted bool) (string, error) {
+	if !user.IsLoggedIn() {
+		return "", fmt.Errorf("you're not logged in")
+	}
+	action, verb := whatsmeow.ParticipantChangeReject, "Rejected"
+	if accepted {
+		action, verb = whatsmeow.ParticipantChangeApprove, "Approved"
+	}
+	_, err := user.Client.UpdateGroupRequestParticipants(portal.Key.JID, []types.JID{requester}, action)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s join request from %s", verb, portal.describeJoinRequester(requester)), nil
+}
+
+var cmdKeepDisappearing = &commands.FullHandler{
+	Func: wrapCommand(fnKeepDisappearing),
+	Name: "keep-disappearing",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionPortalManagement,
+		Description: "Choose whether disappearing messages should be kept on Matrix in the current chat.",
+		Args:        "<on|off>",
+	},
+	RequiresPortal: true,
+}
+
+func fnKeepDisappearing(ce *WrappedCommandEvent) {
+	if !ce.requirePortalAdmin() {
+		return
+	} else if len(ce.Args) == 0 {
+		ce.Reply("**Usage:** `keep-disappearing <on|off>`")
+		return
+	}
+	var keep bool
+	switch strings.ToLower(ce.Args[0]) {
+	case "on", "true", "yes":
+		keep = true
+	case "off", "false", "no":
+		keep = false
+	default:
+		ce.Reply("**Usage:** `keep-disappearing <on|off>`")
+		return
+	}
+	err := ce.Portal.SetKeepDisappearing(ce.Ctx, keep)
+	if err != nil {
+		ce.ZLog.Err(err).Msg("Failed to update keep disappearing setting")
+		ce.Reply("Failed to update setting: %v", err)
+	} else {
+		ce.React("✅")
+	}
+}
+
+var cmdTranslate = &commands.FullHandler{
+	Func: wrapCommand(fnTranslate),
+	Name: "translate",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionPortalManagement,
+		Description: "Translate incoming WhatsApp messages or outgoing Matrix messages in the current chat to the given language.",
+		Args:        "[<incoming|outgoing> <_language code_|off>]",
+	},
+	RequiresPortal: true,
+}
+
+func fnTranslate(ce *WrappedCommandEvent) {
+	if ce.User.bridge.Translator == nil {
+		ce.Reply("Translation is not enabled on this bridge")
+		return
+	} else if len(ce.Args) == 0 {
+		incoming, outgoing := ce.Portal.TranslateIncoming, ce.Portal.TranslateOutgoing
+		if incoming == "" {
+			incoming = "off"
+		}
+		if outgoing == "" {
+			outgoing = "off"
+		}
+		ce.Reply("Incoming messages: `%s`, outgoing messages: `%s`", incoming, outgoing)
+		return
+	} else if len(ce.Args) < 2 {
+		ce.Reply("**Usage:** `translate <incoming|outgoing> <language code|off>`")
+		return
+	} else if !ce.requirePortalAdmin() {
+		return
+	}
+	lang := strings.ToLower(ce.Args[1])
+	if lang == "off" {
+		lang = ""
+	}
+	switch strings.ToLower(ce.Args[0]) {
+	case "incoming", "in":
+		ce.Portal.TranslateIncoming = lang
+	case "outgoing", "out":
+		ce.Portal.TranslateOutgoing = lang
+	default:
+		ce.Reply("**Usage:** `translate <incoming|outgoing> <language code|off>`")
+		return
+	}
+	err := ce.Portal.Update(ce.Ctx)
+	if err != nil {
+		ce.ZLog.Err(err).Msg("Failed to save portal after changing translation settings")
+		ce.Reply("Failed to save translation settings: %v", err)
+	} else {
+		ce.React("✅")
+	}
+}
+
+var cmdTranscribe = &commands.FullHandler{
+	Func: wrapCommand(fnTranscribe),
+	Name: "transcribe",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionMiscellaneous,
+		Description: "Enable or disable transcriptions of incoming voice messages, optionally with a language hint.",
+		Args:        "<on|off> [_language code_]",
+	},
+}
+
+func fnTranscribe(ce *WrappedCommandEvent) {
+	if ce.User.bridge.Transcriber == nil {
+		ce.Reply("Voice message transcription is not enabled on this bridge")
+		return
+	} else if len(ce.Args) == 0 {
+		if !ce.User.TranscribeVoice {
+			ce.Reply("Voice message transcription is disabled")
+		} else if ce.User.TranscriptionLanguage != "" {
+			ce.Reply("Voice message transcription is enabled with language `%s`", ce.User.TranscriptionLanguage)
+		} else {
+			ce.Reply("Voice message transcription is enabled with automatic language detection")
+		}
+		return
+	}
+	switch strings.ToLower(ce.Args[0]) {
+	case "on", "true", "yes":
+		ce.User.TranscribeVoice = true
+		ce.User.TranscriptionLanguage = ""
+		if len(ce.Args) > 1 {
+			ce.User.TranscriptionLanguage = strings.ToLower(ce.Args[1])
+		}
+	case "off", "false", "no":
+		ce.User.TranscribeVoice = false
+	default:
+		ce.Reply("**Usage:** `transcribe <on|off> [language code]`")
+		return
+	}
+	err := ce.User.Update(ce.Ctx)
+	if err != nil {
+		ce.ZLog.Err(err).Msg("Failed to save transcription settings")
+		ce.Reply("Failed to save transcription settings: %v", err)
+	} else {
+		ce.React("✅")
+	}
+}
+
+var cmdLocale = &commands.FullHandler{
+	Func: wrapCommand(fnLocale),
+	Name: "locale",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionMiscellaneous,
+		Description: "Set the language of notices the bridge sends into your portal rooms.",
+		Args:        "<_language code_|default>",
+	},
+}
+
+func fnLocale(ce *WrappedCommandEvent) {
+	if len(ce.Args) == 0 {
+		ce.Reply("**Usage:** `locale <language code|default>`\n\nSupported languages: %s", strings.Join(supportedLocales(), ", "))
+		return
+	}
+	locale, ok := parseLocaleArg(ce)
+	if !ok {
+		return
+	}
+	ce.User.Locale = locale
+	err := ce.User.Update(ce.Ctx)
+	if err != nil {
+		ce.ZLog.Err(err).Msg("Failed to save user locale")
+		ce.Reply("Failed to save locale: %v", err)
+	} else {
+		ce.React("✅")
+	}
+}
+
+var cmdRoomLocale = &commands.FullHandler{
+	Func: wrapCommand(fnRoomLocale),
+	Name: "room-locale",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionPortalManagement,
+		Description: "Set the language of notices the bridge sends into the current room, overriding the user's locale.",
+		Args:        "<_language code_|default>",
+	},
+	RequiresPortal: true,
+}
+
+func fnRoomLocale(ce *WrappedCommandEvent) {
+	if len(ce.Args) == 0 {
+		ce.Reply("**Usage:** `room-locale <language code|default>`\n\nSupported languages: %s", strings.Join(supportedLocales(), ", "))
+		return
+	}
+	locale, ok := parseLocaleArg(ce)
+	if !ok {
+		return
+	}
+	ce.Portal.Locale = locale
+	err := ce.Portal.Update(ce.Ctx)
+	if err != nil {
+		ce.ZLog.Err(err).Msg("Failed to save portal locale")
+		ce.Reply("Failed to save locale: %v", err)
+	} else {
+		ce.React("✅")
+	}
+}
+
+func parseLocaleArg(ce *WrappedCommandEvent) (string, bool) {
+	if strings.ToLower(ce.Args[0]) == "default" {
+		return "", true
+	}
+	locale := normalizeLocale(ce.Args[0])
+	if locale == "" {
+		ce.Reply("Unsupported language `%s`. Supported languages: %s", ce.Args[0], strings.Join(supportedLocales(), ", "))
+		return "", false
+	}
+	return locale, true
+}
+
+var cmdLastSeen = &commands.FullHandler{
+	Func: wrapCommand(fnLastSeen),
+	Name: "lastseen",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionMiscellaneous,
+		Description: "Check when a contact was last online, if their privacy settings allow it. Defaults to the contact of the current private chat.",
+		Args:        "[_international phone number_|_Matrix user ID_]",
+	},
+	RequiresLogin: true,
+}
+
+func fnLastSeen(ce *WrappedCommandEvent) {
+	var jid types.JID
+	if len(ce.Args) == 0 {
+		if ce.Portal == nil || !ce.Portal.IsPrivateChat() {
+			ce.Reply("**Usage:** `lastseen <international phone number|Matrix user ID>`")
+			return
+		}
+		jid = ce.Portal.Key.JID
+	} else if puppetJID, ok := ce.Bridge.ParsePuppetMXID(id.UserID(ce.Args[0])); ok {
+		jid = puppetJID
+	} else {
+		number := strings.TrimPrefix(strings.Join(ce.Args, ""), "+")
+		resp, err := ce.User.Client.IsOnWhatsApp([]string{"+" + number})
+		if err != nil {
+			ce.Reply("Failed to check if user is on WhatsApp: %v", err)
+			return
+		} else if len(resp) == 0 || !resp[0].IsIn {
+			ce.Reply("The server said +%s is not on WhatsApp", number)
+			return
+		}
+		jid = resp[0].JID
+	}
+	info, ok := ce.User.fetchLastSeen(ce.Ctx, jid)
+	if !ok {
+		ce.Reply("WhatsApp didn't send any presence information for +%s. Their privacy settings may be hiding it, "+
+			"or your account may need to be marked as online to receive it.", jid.User)
+	} else if info.Online {
+		ce.Reply("+%s is online", jid.User)
+	} else if info.LastSeen.IsZero() {
+		ce.Reply("+%s is offline, but their last seen time is hidden", jid.User)
+	} else {
+		ago := formatDuration(DefaultLocale, time.Since(info.LastSeen).Truncate(time.Minute))
+		if ago == "" {
+			ago = "less than a minute"
+		}
+		ce.Reply("+%s was last seen at %s (%s ago)", jid.User, info.LastSeen.UTC().Format("2006-01-02 15:04 MST"), ago)
+	}
+}
+
+var cmdUnlinkDevice = &commands.FullHandler{
+	Func: wrapCommand(fnUnlinkDevice),
+	Name: "unlink-device",
+	Help: commands.HelpMeta{
+		Section:     commands.HelpSectionAuth,
+		Description: "Log out an old linked device that the bridge no longer uses, to make room for a new login.",
+		Args:        "<_device JID_>",
+	},
+}
+
+func fnUnlinkDevice(ce *WrappedCommandEvent) {
+	if len(ce.Args) == 0 {
+		companions, err := ce.User.GetUnusedCompanions()
+		if err != nil {
+			ce.ZLog.Err(err).Msg("Failed to get unused companion devices")
+			ce.Reply("Failed to get old devices: %v", err)
+		} else if len(companions) == 0 {
+			ce.Reply("**Usage:** `unlink-device <device JID>`\n\nThe bridge doesn't have any old devices of your account.")
+		} else {
+			ce.Reply("**Usage:** `unlink-device <device JID>`\n\nOld devices of your account:\n\n%s", formatCompanionList(companions))
+		}
+		return
+	}
+	jid, err := types.ParseJID(strings.Trim(ce.Args[0], "`"))
+	if err != nil || jid.Server != types.DefaultUserServer || jid.Device == 0 {
+		ce.Reply("That doesn't look like a device JID")
+		return
+	}
+	err = ce.User.UnlinkCompanion(ce.Ctx, jid)
+	if errors.Is(err, ErrCompanionNotFound) {
+		ce.Reply("That device isn't an old device of your account")
+	} else if errors.Is(err, ErrCompanionInUse) {
+		ce.Reply("That device is still in use by the bridge, use `logout` instead")
+	} else if err != nil {
+		ce.ZLog.Err(err).Stringer("device_jid", jid).Msg("Failed to unlink companion device")
+		ce.Reply("Failed to unlink device: %v", err)
+	} else {
+		ce.Reply("Unlinked device `%s`, you can now try to log in again", jid)
+	}
+}
@@ -0,0 +1,80 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/element-hq/mautrix-go"
+	"github.com/element-hq/mautrix-go/event"
+	"github.com/element-hq/mautrix-go/format"
+	"github.com/element-hq/mautrix-go/id"
+)
+
+// Reply sends a reply to the command as a notice, with optional string formatting and automatic $cmdprefix replacement.
+// In portal rooms, the reply is put in a thread under the command if thread_command_replies is enabled.
+func (ce *WrappedCommandEvent) Reply(msg string, args ...interface{}) {
+	msg = strings.ReplaceAll(msg, "$cmdprefix ", ce.Bridge.Config.Bridge.GetCommandPrefix()+" ")
+	if len(args) > 0 {
+		msg = fmt.Sprintf(msg, args...)
+	}
+	ce.ReplyAdvanced(msg, true, false)
+}
+
+// ReplyAdvanced sends a reply to the command as a notice, threaded like Reply.
+// It allows using HTML and disabling markdown, but doesn't have built-in string formatting.
+func (ce *WrappedCommandEvent) ReplyAdvanced(msg string, allowMarkdown, allowHTML bool) {
+	content := format.RenderMarkdown(msg, allowMarkdown, allowHTML)
+	content.MsgType = event.MsgNotice
+	if threadRoot := ce.getThreadRoot(); threadRoot != "" {
+		content.RelatesTo = (&event.RelatesTo{}).SetThread(threadRoot, ce.EventID)
+	}
+	_, err := ce.MainIntent().SendMessageEvent(ce.Ctx, ce.RoomID, event.EventMessage, content)
+	if err != nil {
+		ce.ZLog.Err(err).Msg("Failed to reply to command")
+	}
+}
+
+// getThreadRoot returns the event that command replies should be threaded under,
+// or an empty string if replies should be sent directly in the room.
+func (ce *WrappedCommandEvent) getThreadRoot() id.EventID {
+	ce.threadRootOnce.Do(func() {
+		if ce.Portal == nil || ce.EventID == "" || !ce.Bridge.Config.Bridge.ThreadCommandReplies ||
+			!ce.Bridge.SpecVersions.ContainsGreaterOrEqual(mautrix.SpecV14) {
+			return
+		}
+		ce.threadRoot = ce.EventID
+		// Threads can't be started from events that are in a thread themselves,
+		// so continue the existing thread if the command was sent in one.
+		evt, err := ce.MainIntent().GetEvent(ce.Ctx, ce.RoomID, ce.EventID)
+		if err != nil {
+			ce.ZLog.Warn().Err(err).Msg("Failed to get command event to check if it's in a thread")
+			return
+		}
+		var content struct {
+			RelatesTo *event.RelatesTo `json:"m.relates_to,omitempty"`
+		}
+		if json.Unmarshal(evt.Content.VeryRaw, &content) == nil {
+			if threadParent := content.RelatesTo.GetThreadParent(); threadParent != "" {
+				ce.threadRoot = threadParent
+			}
+		}
+	})
+	return ce.threadRoot
+}
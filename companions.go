@@ -0,0 +1,249 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/hlog"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+const companionUnlinkTimeout = 30 * time.Second
+
+var ErrCompanionInUse = errors.New("device is in use by a bridge user")
+var ErrCompanionNotFound = errors.New("device not found")
+
+// GetDeviceOwners returns the bridge users of all device JIDs that are currently in use.
+func (br *WABridge) GetDeviceOwners() map[types.JID]*User {
+	owners := make(map[types.JID]*User)
+	for _, user := range br.GetAllUsers() {
+		if user.Session != nil && user.Session.ID != nil {
+			owners[*user.Session.ID] = user
+		} else if !user.JID.IsEmpty() {
+			owners[user.JID] = user
+		}
+	}
+	return owners
+}
+
+// getOwnPhoneNumber returns the phone number the user is or was most recently logged in with, if known.
+// Numbers that are currently logged in by another bridge user aren't returned.
+func (user *User) getOwnPhoneNumber() string {
+	if !user.JID.IsEmpty() {
+		return user.JID.User
+	} else if user.PreviousJID.IsEmpty() {
+		return ""
+	} else if owner := user.bridge.GetUserByJID(user.PreviousJID); owner != nil && owner != user && owner.JID.User == user.PreviousJID.User {
+		return ""
+	}
+	return user.PreviousJID.User
+}
+
+// GetUnusedCompanions returns the companion devices of the user's own phone number that are registered in the
+// bridge's device store, but aren't used by any bridge user. Those are typically leftovers of previous
+// logins that weren't cleanly logged out, and still count towards the phone's linked device limit.
+func (user *User) GetUnusedCompanions() ([]*store.Device, error) {
+	phone := user.getOwnPhoneNumber()
+	if phone == "" {
+		return nil, nil
+	}
+	devices, err := user.bridge.WAContainer.GetAllDevices()
+	if err != nil {
+		return nil, err
+	}
+	owners := user.bridge.GetDeviceOwners()
+	companions := make([]*store.Device, 0)
+	for _, device := range devices {
+		if device.ID == nil || device.ID.User != phone {
+			continue
+		} else if _, inUse := owners[*device.ID]; inUse {
+			continue
+		}
+		companions = append(companions, device)
+	}
+	return companions, nil
+}
+
+// UnlinkCompanion logs out an unused companion device of the user's phone, which frees up a slot in the phone's
+// linked device list.
+func (user *User) UnlinkCompanion(ctx context.Context, jid types.JID) error {
+	companions, err := user.GetUnusedCompanions()
+	if err != nil {
+		return fmt.Errorf("failed to get companion devices: %w", err)
+	}
+	var device *store.Device
+	for _, companion := range companions {
+		if *companion.ID == jid {
+			device = companion
+			break
+		}
+	}
+	if device == nil {
+		if _, inUse := user.bridge.GetDeviceOwners()[jid]; inUse {
+			return ErrCompanionInUse
+		}
+		return ErrCompanionNotFound
+	}
+	log := user.zlog.With().Str("action", "unlink companion").Stringer("device_jid", jid).Logger()
+	client := whatsmeow.NewClient(device, waLog.Zerolog(log.With().Str("component", "whatsmeow").Logger()))
+	connected := make(chan error, 1)
+	client.AddEventHandler(func(rawEvt interface{}) {
+		var result error
+		switch evt := rawEvt.(type) {
+		case *events.Connected:
+		case *events.LoggedOut:
+			result = fmt.Errorf("device was already logged out (%s)", evt.Reason)
+		case *events.ConnectFailure:
+			result = fmt.Errorf("connect failure: %d %s", evt.Reason, evt.Message)
+		default:
+			return
+		}
+		select {
+		case connected <- result:
+		default:
+		}
+	})
+	err = client.Connect()
+	if err == nil {
+		select {
+		case err = <-connected:
+		case <-time.After(companionUnlinkTimeout):
+			err = fmt.Errorf("timed out waiting for connection")
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	if err == nil {
+		err = client.Logout()
+		if err == nil {
+			log.Info().Msg("Logged out unused companion device")
+			return nil
+		}
+	}
+	client.Disconnect()
+	// If the device can't be logged out cleanly, it has most likely already been removed on the phone,
+	// so just make sure it's gone from the store.
+	log.Warn().Err(err).Msg("Failed to log out companion device, deleting it from the store")
+	err = device.Delete()
+	if err != nil {
+		return fmt.Errorf("failed to delete device: %w", err)
+	}
+	return nil
+}
+
+func formatCompanionList(companions []*store.Device) string {
+	var buf strings.Builder
+	for _, device := range companions {
+		name := device.PushName
+		if name == "" {
+			name = "unnamed device"
+		}
+		if device.Platform != "" {
+			_, _ = fmt.Fprintf(&buf, "* `%s` - %s (%s)\n", device.ID, name, device.Platform)
+		} else {
+			_, _ = fmt.Fprintf(&buf, "* `%s` - %s\n", device.ID, name)
+		}
+	}
+	return buf.String()
+}
+
+// getUnusedCompanionsHint returns a message listing the bridge's unused devices of the user's account, if there are any.
+// WhatsApp doesn't tell the bridge if the phone refused to link because it already has the maximum number of
+// linked devices, so this is shown whenever a login times out.
+func (user *User) getUnusedCompanionsHint(ce *WrappedCommandEvent) string {
+	companions, err := user.GetUnusedCompanions()
+	if err != nil {
+		ce.ZLog.Err(err).Msg("Failed to get unused companion devices")
+		return ""
+	} else if len(companions) == 0 {
+		return ""
+	}
+	return "\n\nIf your phone couldn't link the bridge because it already has the maximum number of linked devices, " +
+		"note that the bridge has the following old devices of your account that are no longer in use:\n\n" +
+		formatCompanionList(companions) +
+		"\nYou can use `unlink-device <jid>` to log one of them out and then try to log in again."
+}
+
+type CompanionInfo struct {
+	JID      types.JID `json:"jid"`
+	Platform string    `json:"platform,omitempty"`
+	PushName string    `json:"push_name,omitempty"`
+}
+
+func (prov *ProvisioningAPI) getUnusedCompanions(user *User) []CompanionInfo {
+	companions, err := user.GetUnusedCompanions()
+	if err != nil {
+		user.zlog.Err(err).Msg("Failed to get unused companion devices")
+	}
+	resp := make([]CompanionInfo, len(companions))
+	for i, device := range companions {
+		resp[i] = CompanionInfo{
+			JID:      *device.ID,
+			Platform: device.Platform,
+			PushName: device.PushName,
+		}
+	}
+	return resp
+}
+
+func (prov *ProvisioningAPI) ListCompanions(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(*User)
+	jsonResponse(w, http.StatusOK, prov.getUnusedCompanions(user))
+}
+
+func (prov *ProvisioningAPI) UnlinkCompanion(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(*User)
+	jid, err := types.ParseJID(mux.Vars(r)["jid"])
+	if err != nil || jid.Server != types.DefaultUserServer || jid.Device == 0 {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   "Invalid device JID",
+			ErrCode: "bad jid",
+		})
+		return
+	}
+	err = user.UnlinkCompanion(r.Context(), jid)
+	if errors.Is(err, ErrCompanionNotFound) {
+		jsonResponse(w, http.StatusNotFound, Error{
+			Error:   "Device not found",
+			ErrCode: "not found",
+		})
+	} else if errors.Is(err, ErrCompanionInUse) {
+		jsonResponse(w, http.StatusConflict, Error{
+			Error:   "Device is in use by the bridge",
+			ErrCode: "device in use",
+		})
+	} else if err != nil {
+		hlog.FromRequest(r).Err(err).Stringer("device_jid", jid).Msg("Failed to unlink companion device")
+		jsonResponse(w, http.StatusInternalServerError, Error{
+			Error:   fmt.Sprintf("Failed to unlink device: %v", err),
+			ErrCode: "unlink failed",
+		})
+	} else {
+		jsonResponse(w, http.StatusOK, Response{true, "Device unlinked"})
+	}
+}
@@ -17,6 +17,8 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"strings"
@@ -36,6 +38,19 @@ type DeferredConfig struct {
 	BatchDelay     int `yaml:"batch_delay"`
 }
 
+type RoomCreationConfig struct {
+	RoomVersion     string                 `yaml:"room_version"`
+	CreationContent map[string]interface{} `yaml:"creation_content"`
+	InitialState    []InitialStateConfig   `yaml:"initial_state"`
+	ExtraInvites    []id.UserID            `yaml:"extra_invites"`
+}
+
+type InitialStateConfig struct {
+	Type     string                 `yaml:"type"`
+	StateKey string                 `yaml:"state_key"`
+	Content  map[string]interface{} `yaml:"content"`
+}
+
 type MediaRequestMethod string
 
 const (
@@ -47,14 +62,25 @@ type BridgeConfig struct {
 	UsernameTemplate    string `yaml:"username_template"`
 	DisplaynameTemplate string `yaml:"displayname_template"`
 
-	PersonalFilteringSpaces bool `yaml:"personal_filtering_spaces"`
+	DisplaynamePreferenceTemplates map[string]string `yaml:"displayname_preference_templates"`
 
-	DeliveryReceipts      bool `yaml:"delivery_receipts"`
-	MessageStatusEvents   bool `yaml:"message_status_events"`
-	MessageErrorNotices   bool `yaml:"message_error_notices"`
-	PortalMessageBuffer   int  `yaml:"portal_message_buffer"`
-	CallStartNotices      bool `yaml:"call_start_notices"`
-	IdentityChangeNotices bool `yaml:"identity_change_notices"`
+	PersonalFilteringSpaces bool `yaml:"personal_filtering_spaces"`
+	WelcomeSpace            struct {
+		Enabled bool                `yaml:"enabled"`
+		Name    string              `yaml:"name"`
+		Topic   string              `yaml:"topic"`
+		Avatar  id.ContentURIString `yaml:"avatar"`
+	} `yaml:"welcome_space"`
+
+	DeliveryReceipts      bool   `yaml:"delivery_receipts"`
+	MessageStatusEvents   bool   `yaml:"message_status_events"`
+	MessageErrorNotices   bool   `yaml:"message_error_notices"`
+	MessageErrorEvents    bool   `yaml:"message_error_events"`
+	PortalMessageBuffer   int    `yaml:"portal_message_buffer"`
+	CallStartNotices      bool   `yaml:"call_start_notices"`
+	CallSummaryNotices    bool   `yaml:"call_summary_notices"`
+	CallJoinLink          string `yaml:"call_join_link"`
+	IdentityChangeNotices bool   `yaml:"identity_change_notices"`
 
 	HistorySync struct {
 		Backfill bool `yaml:"backfill"`
@@ -69,6 +95,11 @@ type BridgeConfig struct {
 		MessageCount            int `yaml:"message_count"`
 		UnreadHoursThreshold    int `yaml:"unread_hours_threshold"`
 
+		InitialSyncSummary struct {
+			Enabled     bool `yaml:"enabled"`
+			RecentChats int  `yaml:"recent_chats"`
+		} `yaml:"initial_sync_summary"`
+
 		Immediate struct {
 			WorkerCount int `yaml:"worker_count"`
 			MaxEvents   int `yaml:"max_events"`
@@ -81,56 +112,202 @@ type BridgeConfig struct {
 			MaxAsyncHandle   int64              `yaml:"max_async_handle"`
 		} `yaml:"media_requests"`
 
+		Media struct {
+			Workers         int   `yaml:"workers"`
+			MaxDownloadKBps int64 `yaml:"max_download_kbps"`
+			Deduplicate     bool  `yaml:"deduplicate"`
+		} `yaml:"media"`
+
 		Deferred []DeferredConfig `yaml:"deferred"`
+
+		Scheduler struct {
+			MaxConcurrent  int           `yaml:"max_concurrent"`
+			TaskDelayStr   string        `yaml:"task_delay"`
+			TaskDelay      time.Duration `yaml:"-"`
+			MaxBatchEvents int           `yaml:"max_batch_events"`
+		} `yaml:"scheduler"`
 	} `yaml:"history_sync"`
-	UserAvatarSync    bool `yaml:"user_avatar_sync"`
-	BridgeMatrixLeave bool `yaml:"bridge_matrix_leave"`
+	MediaRetry struct {
+		Enabled     bool          `yaml:"enabled"`
+		IntervalStr string        `yaml:"interval"`
+		Interval    time.Duration `yaml:"-"`
+		MaxAttempts int           `yaml:"max_attempts"`
+	} `yaml:"media_retry"`
+	DisappearingMessages struct {
+		Action   string `yaml:"action"`
+		Backfill bool   `yaml:"backfill"`
+	} `yaml:"disappearing_messages"`
+	ProcessingIndicator struct {
+		Mode                string `yaml:"mode"`
+		MinBackfillMessages int    `yaml:"min_backfill_messages"`
+	} `yaml:"processing_indicator"`
+	MessageRetention struct {
+		Days             int `yaml:"days"`
+		DisappearingDays int `yaml:"disappearing_days"`
+	} `yaml:"message_retention"`
+	DatabaseMaintenance bool `yaml:"database_maintenance"`
+	PortalCleanup       struct {
+		Enabled      bool   `yaml:"enabled"`
+		InactiveDays int    `yaml:"inactive_days"`
+		Action       string `yaml:"action"`
+	} `yaml:"portal_cleanup"`
+	ArchiveDepartedGroups bool      `yaml:"archive_departed_groups"`
+	ModerationRoom        id.RoomID `yaml:"moderation_room"`
+	GroupInvites          struct {
+		DefaultPolicy string        `yaml:"default_policy"`
+		ExpiryStr     string        `yaml:"expiry"`
+		Expiry        time.Duration `yaml:"-"`
+	} `yaml:"group_invites"`
+	OutgoingQueue struct {
+		Enabled   bool          `yaml:"enabled"`
+		MaxAgeStr string        `yaml:"max_age"`
+		MaxAge    time.Duration `yaml:"-"`
+		MaxSize   int           `yaml:"max_size"`
+	} `yaml:"outgoing_queue"`
+	Announcements struct {
+		IntervalStr string        `yaml:"interval"`
+		Interval    time.Duration `yaml:"-"`
+	} `yaml:"announcements"`
+	Translation struct {
+		Provider   string        `yaml:"provider"`
+		URL        string        `yaml:"url"`
+		APIKey     string        `yaml:"api_key"`
+		TimeoutStr string        `yaml:"timeout"`
+		Timeout    time.Duration `yaml:"-"`
+	} `yaml:"translation"`
+	CloudAPI struct {
+		Enabled     bool   `yaml:"enabled"`
+		WebhookPath string `yaml:"webhook_path"`
+		VerifyToken string `yaml:"verify_token"`
+		AppSecret   string `yaml:"app_secret"`
+		GraphURL    string `yaml:"graph_url"`
+	} `yaml:"cloud_api"`
+	Transcription struct {
+		URL            string        `yaml:"url"`
+		APIKey         string        `yaml:"api_key"`
+		Model          string        `yaml:"model"`
+		MaxDuration    uint32        `yaml:"max_duration"`
+		NotifyFailures bool          `yaml:"notify_failures"`
+		MaxConcurrent  int           `yaml:"max_concurrent"`
+		TimeoutStr     string        `yaml:"timeout"`
+		Timeout        time.Duration `yaml:"-"`
+	} `yaml:"transcription"`
+	ImageDescriptions struct {
+		URL        string        `yaml:"url"`
+		APIKey     string        `yaml:"api_key"`
+		Backfill   bool          `yaml:"backfill"`
+		TimeoutStr string        `yaml:"timeout"`
+		Timeout    time.Duration `yaml:"-"`
+	} `yaml:"image_descriptions"`
+	MediaScanning struct {
+		HashList       string        `yaml:"hash_list"`
+		URL            string        `yaml:"url"`
+		APIKey         string        `yaml:"api_key"`
+		Action         string        `yaml:"action"`
+		QuarantineRoom id.RoomID     `yaml:"quarantine_room"`
+		FailClosed     bool          `yaml:"fail_closed"`
+		TimeoutStr     string        `yaml:"timeout"`
+		Timeout        time.Duration `yaml:"-"`
+	} `yaml:"media_scanning"`
+	HomeserverRateLimit struct {
+		Enabled           bool    `yaml:"enabled"`
+		RequestsPerSecond float64 `yaml:"requests_per_second"`
+		Burst             int     `yaml:"burst"`
+	} `yaml:"homeserver_rate_limit"`
+	ReactionRateLimit struct {
+		Enabled   bool    `yaml:"enabled"`
+		PerSecond float64 `yaml:"per_second"`
+		Burst     int     `yaml:"burst"`
+		MaxQueue  int     `yaml:"max_queue"`
+	} `yaml:"reaction_rate_limit"`
+	LateJoiners struct {
+		HistoryVisibility string `yaml:"history_visibility"`
+		KeyShareCount     int    `yaml:"key_share_count"`
+	} `yaml:"late_joiners"`
+
+	UserAvatarSync      bool   `yaml:"user_avatar_sync"`
+	FallbackAvatarStyle string `yaml:"fallback_avatar_style"`
+	BridgeMatrixLeave   bool   `yaml:"bridge_matrix_leave"`
 
 	SyncDirectChatList     bool `yaml:"sync_direct_chat_list"`
 	SyncManualMarkedUnread bool `yaml:"sync_manual_marked_unread"`
 	DefaultBridgePresence  bool `yaml:"default_bridge_presence"`
 	SendPresenceOnTyping   bool `yaml:"send_presence_on_typing"`
+	ActivePresence         struct {
+		Enabled     bool          `yaml:"enabled"`
+		CooldownStr string        `yaml:"cooldown"`
+		Cooldown    time.Duration `yaml:"-"`
+	} `yaml:"active_presence"`
+	LastSeenTopic struct {
+		Enabled            bool          `yaml:"enabled"`
+		RefreshIntervalStr string        `yaml:"refresh_interval"`
+		RefreshInterval    time.Duration `yaml:"-"`
+	} `yaml:"last_seen_topic"`
+	GroupResync struct {
+		OfflineThresholdStr string        `yaml:"offline_threshold"`
+		OfflineThreshold    time.Duration `yaml:"-"`
+		AfterStartup        bool          `yaml:"after_startup"`
+		DelayStr            string        `yaml:"delay"`
+		Delay               time.Duration `yaml:"-"`
+	} `yaml:"group_resync"`
 
 	ForceActiveDeliveryReceipts bool `yaml:"force_active_delivery_receipts"`
 
 	DoublePuppetConfig bridgeconfig.DoublePuppetConfig `yaml:",inline"`
 
-	PrivateChatPortalMeta string `yaml:"private_chat_portal_meta"`
-	ParallelMemberSync    bool   `yaml:"parallel_member_sync"`
-	BridgeNotices         bool   `yaml:"bridge_notices"`
-	ResendBridgeInfo      bool   `yaml:"resend_bridge_info"`
-	MuteBridging          bool   `yaml:"mute_bridging"`
-	ArchiveTag            string `yaml:"archive_tag"`
-	PinnedTag             string `yaml:"pinned_tag"`
-	TagOnlyOnCreate       bool   `yaml:"tag_only_on_create"`
-	MarkReadOnlyOnCreate  bool   `yaml:"mark_read_only_on_create"`
-	EnableStatusBroadcast bool   `yaml:"enable_status_broadcast"`
-	MuteStatusBroadcast   bool   `yaml:"mute_status_broadcast"`
-	StatusBroadcastTag    string `yaml:"status_broadcast_tag"`
-	WhatsappThumbnail     bool   `yaml:"whatsapp_thumbnail"`
-	AllowUserInvite       bool   `yaml:"allow_user_invite"`
-	FederateRooms         bool   `yaml:"federate_rooms"`
-	URLPreviews           bool   `yaml:"url_previews"`
-	CaptionInMessage      bool   `yaml:"caption_in_message"`
-	BeeperGalleries       bool   `yaml:"beeper_galleries"`
-	ExtEvPolls            bool   `yaml:"extev_polls"`
-	CrossRoomReplies      bool   `yaml:"cross_room_replies"`
-	DisableReplyFallbacks bool   `yaml:"disable_reply_fallbacks"`
+	DoublePuppetCheckIntervalStr string        `yaml:"double_puppet_check_interval"`
+	DoublePuppetCheckInterval    time.Duration `yaml:"-"`
+
+	PrivateChatPortalMeta string             `yaml:"private_chat_portal_meta"`
+	ParallelMemberSync    bool               `yaml:"parallel_member_sync"`
+	BridgeNotices         bool               `yaml:"bridge_notices"`
+	ResendBridgeInfo      bool               `yaml:"resend_bridge_info"`
+	MuteBridging          bool               `yaml:"mute_bridging"`
+	ArchiveTag            string             `yaml:"archive_tag"`
+	PinnedTag             string             `yaml:"pinned_tag"`
+	LabelTagPrefix        string             `yaml:"label_tag_prefix"`
+	TagOnlyOnCreate       bool               `yaml:"tag_only_on_create"`
+	MarkReadOnlyOnCreate  bool               `yaml:"mark_read_only_on_create"`
+	EnableStatusBroadcast bool               `yaml:"enable_status_broadcast"`
+	MuteStatusBroadcast   bool               `yaml:"mute_status_broadcast"`
+	StatusBroadcastTag    string             `yaml:"status_broadcast_tag"`
+	WhatsappThumbnail     bool               `yaml:"whatsapp_thumbnail"`
+	AllowUserInvite       bool               `yaml:"allow_user_invite"`
+	FederateRooms         bool               `yaml:"federate_rooms"`
+	RoomCreation          RoomCreationConfig `yaml:"room_creation"`
+	URLPreviews           bool               `yaml:"url_previews"`
+	CaptionInMessage      bool               `yaml:"caption_in_message"`
+	ConvertStickers       bool               `yaml:"convert_stickers"`
+	StickerPacks          bool               `yaml:"sticker_packs"`
+	BeeperGalleries       bool               `yaml:"beeper_galleries"`
+	ExtEvPolls            bool               `yaml:"extev_polls"`
+	CrossRoomReplies      bool               `yaml:"cross_room_replies"`
+	DisableReplyFallbacks bool               `yaml:"disable_reply_fallbacks"`
+
+	AuxiliaryUsers struct {
+		Users        map[id.UserID]int `yaml:"users"`
+		SyncExisting bool              `yaml:"sync_existing"`
+	} `yaml:"auxiliary_users"`
 
 	MessageHandlingTimeout struct {
-		ErrorAfterStr string `yaml:"error_after"`
-		DeadlineStr   string `yaml:"deadline"`
+		ErrorAfterStr       string `yaml:"error_after"`
+		DeadlineStr         string `yaml:"deadline"`
+		WhatsAppDeadlineStr string `yaml:"whatsapp_deadline"`
 
-		ErrorAfter time.Duration `yaml:"-"`
-		Deadline   time.Duration `yaml:"-"`
+		ErrorAfter       time.Duration `yaml:"-"`
+		Deadline         time.Duration `yaml:"-"`
+		WhatsAppDeadline time.Duration `yaml:"-"`
 	} `yaml:"message_handling_timeout"`
 
 	DisableStatusBroadcastSend bool `yaml:"disable_status_broadcast_send"`
 
 	DisableBridgeAlerts   bool `yaml:"disable_bridge_alerts"`
+	SharedManagementRooms bool `yaml:"shared_management_rooms"`
 	CrashOnStreamReplaced bool `yaml:"crash_on_stream_replaced"`
 
-	CommandPrefix string `yaml:"command_prefix"`
+	CommandPrefix        string `yaml:"command_prefix"`
+	ThreadCommandReplies bool   `yaml:"thread_command_replies"`
+	DefaultLocale        string `yaml:"default_locale"`
 
 	ManagementRoomText bridgeconfig.ManagementRoomTexts `yaml:"management_room_text"`
 
@@ -148,6 +325,8 @@ type BridgeConfig struct {
 
 	ParsedUsernameTemplate *template.Template `yaml:"-"`
 	displaynameTemplate    *template.Template `yaml:"-"`
+	displaynamePrefs       map[string]*template.Template
+	callJoinLinkTemplate   *template.Template `yaml:"-"`
 }
 
 func (bc BridgeConfig) GetDoublePuppetConfig() bridgeconfig.DoublePuppetConfig {
@@ -166,6 +345,11 @@ func (bc BridgeConfig) EnableMessageErrorNotices() bool {
 	return bc.MessageErrorNotices
 }
 
+// PersonalSpacesEnabled returns true if the bridge should create a personal space for each user.
+func (bc BridgeConfig) PersonalSpacesEnabled() bool {
+	return bc.PersonalFilteringSpaces || bc.WelcomeSpace.Enabled
+}
+
 func (bc BridgeConfig) GetCommandPrefix() string {
 	return bc.CommandPrefix
 }
@@ -215,7 +399,117 @@ func (bc *BridgeConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	if err != nil {
 		return err
 	}
+	bc.displaynamePrefs = make(map[string]*template.Template, len(bc.DisplaynamePreferenceTemplates))
+	for pref, tpl := range bc.DisplaynamePreferenceTemplates {
+		bc.displaynamePrefs[pref], err = template.New("displayname_" + pref).Parse(tpl)
+		if err != nil {
+			return fmt.Errorf("failed to parse displayname template for %q preference: %w", pref, err)
+		}
+	}
+
+	if bc.CallJoinLink != "" {
+		bc.callJoinLinkTemplate, err = template.New("call_join_link").Parse(bc.CallJoinLink)
+		if err != nil {
+			return err
+		}
+	}
 
+	for _, state := range bc.RoomCreation.InitialState {
+		if state.Type == event.StatePowerLevels.Type {
+			return fmt.Errorf("%s can't be set in room_creation.initial_state, use auxiliary_users for custom power levels", state.Type)
+		}
+	}
+
+	switch bc.FallbackAvatarStyle {
+	case "", "initials", "identicon":
+	default:
+		return fmt.Errorf("unknown fallback avatar style %q", bc.FallbackAvatarStyle)
+	}
+
+	if bc.HistorySync.Scheduler.TaskDelayStr != "" {
+		bc.HistorySync.Scheduler.TaskDelay, err = time.ParseDuration(bc.HistorySync.Scheduler.TaskDelayStr)
+		if err != nil {
+			return err
+		}
+	}
+	if bc.MediaRetry.IntervalStr != "" {
+		bc.MediaRetry.Interval, err = time.ParseDuration(bc.MediaRetry.IntervalStr)
+		if err != nil {
+			return err
+		}
+	}
+	if bc.OutgoingQueue.MaxAgeStr != "" {
+		bc.OutgoingQueue.MaxAge, err = time.ParseDuration(bc.OutgoingQueue.MaxAgeStr)
+		if err != nil {
+			return err
+		}
+	}
+	if bc.GroupInvites.ExpiryStr != "" {
+		bc.GroupInvites.Expiry, err = time.ParseDuration(bc.GroupInvites.ExpiryStr)
+		if err != nil {
+			return err
+		}
+	}
+	if bc.Translation.TimeoutStr != "" {
+		bc.Translation.Timeout, err = time.ParseDuration(bc.Translation.TimeoutStr)
+		if err != nil {
+			return err
+		}
+	}
+	if bc.Transcription.TimeoutStr != "" {
+		bc.Transcription.Timeout, err = time.ParseDuration(bc.Transcription.TimeoutStr)
+		if err != nil {
+			return err
+		}
+	}
+	if bc.ImageDescriptions.TimeoutStr != "" {
+		bc.ImageDescriptions.Timeout, err = time.ParseDuration(bc.ImageDescriptions.TimeoutStr)
+		if err != nil {
+			return err
+		}
+	}
+	if bc.MediaScanning.TimeoutStr != "" {
+		bc.MediaScanning.Timeout, err = time.ParseDuration(bc.MediaScanning.TimeoutStr)
+		if err != nil {
+			return err
+		}
+	}
+	if bc.ActivePresence.CooldownStr != "" {
+		bc.ActivePresence.Cooldown, err = time.ParseDuration(bc.ActivePresence.CooldownStr)
+		if err != nil {
+			return err
+		}
+	}
+	if bc.LastSeenTopic.RefreshIntervalStr != "" {
+		bc.LastSeenTopic.RefreshInterval, err = time.ParseDuration(bc.LastSeenTopic.RefreshIntervalStr)
+		if err != nil {
+			return err
+		}
+	}
+	if bc.DoublePuppetCheckIntervalStr != "" {
+		bc.DoublePuppetCheckInterval, err = time.ParseDuration(bc.DoublePuppetCheckIntervalStr)
+		if err != nil {
+			return err
+		}
+	}
+	if bc.GroupResync.OfflineThresholdStr != "" {
+		bc.GroupResync.OfflineThreshold, err = time.ParseDuration(bc.GroupResync.OfflineThresholdStr)
+		if err != nil {
+			return err
+		}
+	}
+	if bc.GroupResync.DelayStr != "" {
+		bc.GroupResync.Delay, err = time.ParseDuration(bc.GroupResync.DelayStr)
+		if err != nil {
+			return err
+		}
+	}
+	if bc.Announcements.IntervalStr != "" {
+		bc.Announcements.Interval, err = time.ParseDuration(bc.Announcements.IntervalStr)
+		if err != nil {
+			return err
+		}
+	}
 	if bc.MessageHandlingTimeout.ErrorAfterStr != "" {
 		bc.MessageHandlingTimeout.ErrorAfter, err = time.ParseDuration(bc.MessageHandlingTimeout.ErrorAfterStr)
 		if err != nil {
@@ -228,6 +522,12 @@ func (bc *BridgeConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 			return err
 		}
 	}
+	if bc.MessageHandlingTimeout.WhatsAppDeadlineStr != "" {
+		bc.MessageHandlingTimeout.WhatsAppDeadline, err = time.ParseDuration(bc.MessageHandlingTimeout.WhatsAppDeadlineStr)
+		if err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -253,9 +553,34 @@ const (
 	NameQualityPhone   = 1
 )
 
+// HasDisplaynamePreference returns true if the given displayname preference has a template configured.
+func (bc BridgeConfig) HasDisplaynamePreference(preference string) bool {
+	_, ok := bc.displaynamePrefs[preference]
+	return ok
+}
+
+// DisplaynameTemplateID returns a short identifier of the template used for the given preference,
+// which can be stored to detect when the template has changed.
+func (bc BridgeConfig) DisplaynameTemplateID(preference string) string {
+	tpl, ok := bc.DisplaynamePreferenceTemplates[preference]
+	if !ok {
+		tpl = bc.DisplaynameTemplate
+	}
+	hash := sha256.Sum256([]byte(tpl))
+	return hex.EncodeToString(hash[:8])
+}
+
 func (bc BridgeConfig) FormatDisplayname(jid types.JID, contact types.ContactInfo) (string, int8) {
+	return bc.FormatDisplaynameWithPreference("", jid, contact)
+}
+
+func (bc BridgeConfig) FormatDisplaynameWithPreference(preference string, jid types.JID, contact types.ContactInfo) (string, int8) {
+	tpl, ok := bc.displaynamePrefs[preference]
+	if !ok {
+		tpl = bc.displaynameTemplate
+	}
 	var buf strings.Builder
-	_ = bc.displaynameTemplate.Execute(&buf, legacyContactInfo{
+	_ = tpl.Execute(&buf, legacyContactInfo{
 		ContactInfo: contact,
 		Notify:      contact.PushName,
 		VName:       contact.BusinessName,
@@ -276,6 +601,23 @@ func (bc BridgeConfig) FormatDisplayname(jid types.JID, contact types.ContactInf
 	return buf.String(), quality
 }
 
+type CallJoinLinkArgs struct {
+	RoomID id.RoomID
+	CallID string
+}
+
+func (bc BridgeConfig) FormatCallJoinLink(roomID id.RoomID, callID string) string {
+	if bc.callJoinLinkTemplate == nil {
+		return ""
+	}
+	var buf strings.Builder
+	_ = bc.callJoinLinkTemplate.Execute(&buf, CallJoinLinkArgs{
+		RoomID: roomID,
+		CallID: callID,
+	})
+	return buf.String()
+}
+
 func (bc BridgeConfig) FormatUsername(username string) string {
 	var buf strings.Builder
 	_ = bc.ParsedUsernameTemplate.Execute(&buf, username)
@@ -283,10 +625,13 @@ func (bc BridgeConfig) FormatUsername(username string) string {
 }
 
 type RelaybotConfig struct {
-	Enabled          bool                         `yaml:"enabled"`
-	AdminOnly        bool                         `yaml:"admin_only"`
-	MessageFormats   map[event.MessageType]string `yaml:"message_formats"`
-	messageTemplates *template.Template           `yaml:"-"`
+	Enabled               bool                         `yaml:"enabled"`
+	AdminOnly             bool                         `yaml:"admin_only"`
+	MessageFormats        map[event.MessageType]string `yaml:"message_formats"`
+	DisplaynameFormat     string                       `yaml:"displayname_format"`
+	AllowIdentityOverride bool                         `yaml:"allow_identity_override"`
+	messageTemplates      *template.Template           `yaml:"-"`
+	displaynameTemplate   *template.Template           `yaml:"-"`
 }
 
 type umRelaybotConfig RelaybotConfig
@@ -297,9 +642,16 @@ func (rc *RelaybotConfig) UnmarshalYAML(unmarshal func(interface{}) error) error
 		return err
 	}
 
-	rc.messageTemplates = template.New("messageTemplates")
+	formats := make(map[string]string, len(rc.MessageFormats))
 	for key, format := range rc.MessageFormats {
-		_, err := rc.messageTemplates.New(string(key)).Parse(format)
+		formats[string(key)] = format
+	}
+	rc.messageTemplates, err = ParseRelayMessageFormats(formats)
+	if err != nil {
+		return err
+	}
+	if rc.DisplaynameFormat != "" {
+		rc.displaynameTemplate, err = template.New("displayname").Parse(rc.DisplaynameFormat)
 		if err != nil {
 			return err
 		}
@@ -308,6 +660,19 @@ func (rc *RelaybotConfig) UnmarshalYAML(unmarshal func(interface{}) error) error
 	return nil
 }
 
+// ParseRelayMessageFormats parses a map of msgtype -> template strings into a single template set.
+// It's used for both the global config and per-portal overrides.
+func ParseRelayMessageFormats(formats map[string]string) (*template.Template, error) {
+	tpl := template.New("messageTemplates")
+	for key, format := range formats {
+		_, err := tpl.New(key).Parse(format)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s format: %w", key, err)
+		}
+	}
+	return tpl, nil
+}
+
 type Sender struct {
 	UserID string
 	event.MemberEventContent
@@ -316,22 +681,41 @@ type Sender struct {
 type formatData struct {
 	Sender  Sender
 	Message string
+	Caption string
 	Content *event.MessageEventContent
 }
 
-func (rc *RelaybotConfig) FormatMessage(content *event.MessageEventContent, sender id.UserID, member event.MemberEventContent) (string, error) {
+// FormatMessage renders the relaybot template for the given message. If portalTemplates is non-nil and contains
+// a template for the msgtype, it's used instead of the global one.
+func (rc *RelaybotConfig) FormatMessage(content *event.MessageEventContent, sender id.UserID, member event.MemberEventContent, portalTemplates *template.Template) (string, error) {
 	if len(member.Displayname) == 0 {
 		member.Displayname = sender.String()
 	}
+	if rc.displaynameTemplate != nil {
+		var displayname strings.Builder
+		err := rc.displaynameTemplate.Execute(&displayname, Sender{UserID: sender.String(), MemberEventContent: member})
+		if err != nil {
+			return "", err
+		}
+		member.Displayname = displayname.String()
+	}
 	member.Displayname = template.HTMLEscapeString(member.Displayname)
-	var output strings.Builder
-	err := rc.messageTemplates.ExecuteTemplate(&output, string(content.MsgType), formatData{
+	data := formatData{
 		Sender: Sender{
 			UserID:             template.HTMLEscapeString(sender.String()),
 			MemberEventContent: member,
 		},
 		Content: content,
 		Message: content.FormattedBody,
-	})
+	}
+	if content.FileName != "" && content.Body != content.FileName {
+		data.Caption = content.FormattedBody
+	}
+	tpl := rc.messageTemplates
+	if portalTemplates != nil && portalTemplates.Lookup(string(content.MsgType)) != nil {
+		tpl = portalTemplates
+	}
+	var output strings.Builder
+	err := tpl.ExecuteTemplate(&output, string(content.MsgType), data)
 	return output.String(), err
 }
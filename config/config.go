@@ -24,16 +24,21 @@ type Config struct {
 	*bridgeconfig.BaseConfig `yaml:",inline"`
 
 	Analytics struct {
-		Host   string `yaml:"host"`
-		Token  string `yaml:"token"`
-		UserID string `yaml:"user_id"`
+		Host   string          `yaml:"host"`
+		Token  string          `yaml:"token"`
+		UserID string          `yaml:"user_id"`
+		Salt   string          `yaml:"salt"`
+		Events map[string]bool `yaml:"events"`
+
+		AliasLegacyIDs bool `yaml:"alias_legacy_ids"`
 	}
 
 	Limits struct {
-		MaxPuppetLimit       uint `yaml:"max_puppet_limit"`
-		MinPuppetActiveDays  uint `yaml:"min_puppet_activity_days"`
-		PuppetInactivityDays uint `yaml:"puppet_inactivity_days"`
-		BlockOnLimitReached  bool `yaml:"block_on_limit_reached"`
+		MaxPuppetLimit       uint   `yaml:"max_puppet_limit"`
+		MinPuppetActiveDays  uint   `yaml:"min_puppet_activity_days"`
+		PuppetInactivityDays uint   `yaml:"puppet_inactivity_days"`
+		BlockOnLimitReached  bool   `yaml:"block_on_limit_reached"`
+		WarningThresholds    []uint `yaml:"warning_thresholds"`
 	} `yaml:"limits"`
 
 	Metrics struct {
@@ -41,6 +46,14 @@ type Config struct {
 		Listen  string `yaml:"listen"`
 	} `yaml:"metrics"`
 
+	AdminAPI struct {
+		Enabled bool   `yaml:"enabled"`
+		Listen  string `yaml:"listen"`
+		Token   string `yaml:"token"`
+	} `yaml:"admin_api"`
+
+	Webhooks []WebhookConfig `yaml:"webhooks"`
+
 	WhatsApp struct {
 		OSName      string `yaml:"os_name"`
 		BrowserName string `yaml:"browser_name"`
@@ -48,3 +61,9 @@ type Config struct {
 
 	Bridge BridgeConfig `yaml:"bridge"`
 }
+
+type WebhookConfig struct {
+	URL    string   `yaml:"url"`
+	Secret string   `yaml:"secret"`
+	Events []string `yaml:"events"`
+}
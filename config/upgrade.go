@@ -31,21 +31,52 @@ func DoUpgrade(helper *up.Helper) {
 	helper.Copy(up.Str|up.Null, "analytics", "host")
 	helper.Copy(up.Str|up.Null, "analytics", "token")
 	helper.Copy(up.Str|up.Null, "analytics", "user_id")
+	helper.Copy(up.Map, "analytics", "events")
+	helper.Copy(up.Bool, "analytics", "alias_legacy_ids")
+	if salt, ok := helper.Get(up.Str, "analytics", "salt"); !ok || salt == "generate" {
+		helper.Set(up.Str, random.String(32), "analytics", "salt")
+	} else {
+		helper.Copy(up.Str, "analytics", "salt")
+	}
+
+	helper.Copy(up.Int, "limits", "max_puppet_limit")
+	helper.Copy(up.Int, "limits", "min_puppet_activity_days")
+	helper.Copy(up.Int, "limits", "puppet_inactivity_days")
+	helper.Copy(up.Bool, "limits", "block_on_limit_reached")
+	helper.Copy(up.List, "limits", "warning_thresholds")
 
 	helper.Copy(up.Bool, "metrics", "enabled")
 	helper.Copy(up.Str, "metrics", "listen")
 
+	helper.Copy(up.Bool, "admin_api", "enabled")
+	helper.Copy(up.Str, "admin_api", "listen")
+	if token, ok := helper.Get(up.Str, "admin_api", "token"); !ok || token == "generate" {
+		helper.Set(up.Str, random.String(64), "admin_api", "token")
+	} else {
+		helper.Copy(up.Str, "admin_api", "token")
+	}
+
+	helper.Copy(up.List, "webhooks")
+
 	helper.Copy(up.Str, "whatsapp", "os_name")
 	helper.Copy(up.Str, "whatsapp", "browser_name")
 
 	helper.Copy(up.Str, "bridge", "username_template")
 	helper.Copy(up.Str, "bridge", "displayname_template")
+	helper.Copy(up.Map, "bridge", "displayname_preference_templates")
 	helper.Copy(up.Bool, "bridge", "personal_filtering_spaces")
+	helper.Copy(up.Bool, "bridge", "welcome_space", "enabled")
+	helper.Copy(up.Str, "bridge", "welcome_space", "name")
+	helper.Copy(up.Str, "bridge", "welcome_space", "topic")
+	helper.Copy(up.Str|up.Null, "bridge", "welcome_space", "avatar")
 	helper.Copy(up.Bool, "bridge", "delivery_receipts")
 	helper.Copy(up.Bool, "bridge", "message_status_events")
 	helper.Copy(up.Bool, "bridge", "message_error_notices")
+	helper.Copy(up.Bool, "bridge", "message_error_events")
 	helper.Copy(up.Int, "bridge", "portal_message_buffer")
 	helper.Copy(up.Bool, "bridge", "call_start_notices")
+	helper.Copy(up.Bool, "bridge", "call_summary_notices")
+	helper.Copy(up.Str|up.Null, "bridge", "call_join_link")
 	helper.Copy(up.Bool, "bridge", "identity_change_notices")
 	helper.Copy(up.Bool, "bridge", "history_sync", "backfill")
 	helper.Copy(up.Bool, "bridge", "history_sync", "request_full_sync")
@@ -56,17 +87,90 @@ func DoUpgrade(helper *up.Helper) {
 	helper.Copy(up.Str, "bridge", "history_sync", "media_requests", "request_method")
 	helper.Copy(up.Int, "bridge", "history_sync", "media_requests", "request_local_time")
 	helper.Copy(up.Int, "bridge", "history_sync", "media_requests", "max_async_handle")
+	helper.Copy(up.Int, "bridge", "history_sync", "media", "workers")
+	helper.Copy(up.Int, "bridge", "history_sync", "media", "max_download_kbps")
+	helper.Copy(up.Bool, "bridge", "history_sync", "media", "deduplicate")
 	helper.Copy(up.Int, "bridge", "history_sync", "max_initial_conversations")
 	helper.Copy(up.Int, "bridge", "history_sync", "message_count")
+	helper.Copy(up.Bool, "bridge", "history_sync", "initial_sync_summary", "enabled")
+	helper.Copy(up.Int, "bridge", "history_sync", "initial_sync_summary", "recent_chats")
 	helper.Copy(up.Int, "bridge", "history_sync", "unread_hours_threshold")
 	helper.Copy(up.Int, "bridge", "history_sync", "immediate", "worker_count")
 	helper.Copy(up.Int, "bridge", "history_sync", "immediate", "max_events")
 	helper.Copy(up.List, "bridge", "history_sync", "deferred")
+	helper.Copy(up.Int, "bridge", "history_sync", "scheduler", "max_concurrent")
+	helper.Copy(up.Str|up.Null, "bridge", "history_sync", "scheduler", "task_delay")
+	helper.Copy(up.Int, "bridge", "history_sync", "scheduler", "max_batch_events")
+	helper.Copy(up.Bool, "bridge", "media_retry", "enabled")
+	helper.Copy(up.Str, "bridge", "media_retry", "interval")
+	helper.Copy(up.Int, "bridge", "media_retry", "max_attempts")
+	helper.Copy(up.Int, "bridge", "message_retention", "days")
+	helper.Copy(up.Int, "bridge", "message_retention", "disappearing_days")
+	helper.Copy(up.Bool, "bridge", "database_maintenance")
+	helper.Copy(up.Bool, "bridge", "portal_cleanup", "enabled")
+	helper.Copy(up.Int, "bridge", "portal_cleanup", "inactive_days")
+	helper.Copy(up.Str, "bridge", "portal_cleanup", "action")
+	helper.Copy(up.Bool, "bridge", "archive_departed_groups")
+	helper.Copy(up.Str|up.Null, "bridge", "moderation_room")
+	helper.Copy(up.Str, "bridge", "group_invites", "default_policy")
+	helper.Copy(up.Str, "bridge", "group_invites", "expiry")
+	helper.Copy(up.Bool, "bridge", "outgoing_queue", "enabled")
+	helper.Copy(up.Str, "bridge", "outgoing_queue", "max_age")
+	helper.Copy(up.Int, "bridge", "outgoing_queue", "max_size")
+	helper.Copy(up.Str, "bridge", "announcements", "interval")
+	helper.Copy(up.Str|up.Null, "bridge", "translation", "provider")
+	helper.Copy(up.Str|up.Null, "bridge", "translation", "url")
+	helper.Copy(up.Str|up.Null, "bridge", "translation", "api_key")
+	helper.Copy(up.Str, "bridge", "translation", "timeout")
+	helper.Copy(up.Bool, "bridge", "cloud_api", "enabled")
+	helper.Copy(up.Str, "bridge", "cloud_api", "webhook_path")
+	helper.Copy(up.Str|up.Null, "bridge", "cloud_api", "verify_token")
+	helper.Copy(up.Str|up.Null, "bridge", "cloud_api", "app_secret")
+	helper.Copy(up.Str, "bridge", "cloud_api", "graph_url")
+	helper.Copy(up.Str|up.Null, "bridge", "transcription", "url")
+	helper.Copy(up.Str|up.Null, "bridge", "transcription", "api_key")
+	helper.Copy(up.Str, "bridge", "transcription", "model")
+	helper.Copy(up.Int, "bridge", "transcription", "max_duration")
+	helper.Copy(up.Bool, "bridge", "transcription", "notify_failures")
+	helper.Copy(up.Int, "bridge", "transcription", "max_concurrent")
+	helper.Copy(up.Str, "bridge", "transcription", "timeout")
+	helper.Copy(up.Str|up.Null, "bridge", "image_descriptions", "url")
+	helper.Copy(up.Str|up.Null, "bridge", "image_descriptions", "api_key")
+	helper.Copy(up.Bool, "bridge", "image_descriptions", "backfill")
+	helper.Copy(up.Str, "bridge", "image_descriptions", "timeout")
+	helper.Copy(up.Str|up.Null, "bridge", "media_scanning", "hash_list")
+	helper.Copy(up.Str|up.Null, "bridge", "media_scanning", "url")
+	helper.Copy(up.Str|up.Null, "bridge", "media_scanning", "api_key")
+	helper.Copy(up.Str, "bridge", "media_scanning", "action")
+	helper.Copy(up.Str|up.Null, "bridge", "media_scanning", "quarantine_room")
+	helper.Copy(up.Bool, "bridge", "media_scanning", "fail_closed")
+	helper.Copy(up.Str, "bridge", "media_scanning", "timeout")
+	helper.Copy(up.Bool, "bridge", "homeserver_rate_limit", "enabled")
+	helper.Copy(up.Float|up.Int, "bridge", "homeserver_rate_limit", "requests_per_second")
+	helper.Copy(up.Int, "bridge", "homeserver_rate_limit", "burst")
+	helper.Copy(up.Bool, "bridge", "reaction_rate_limit", "enabled")
+	helper.Copy(up.Float|up.Int, "bridge", "reaction_rate_limit", "per_second")
+	helper.Copy(up.Int, "bridge", "reaction_rate_limit", "burst")
+	helper.Copy(up.Int, "bridge", "reaction_rate_limit", "max_queue")
+	helper.Copy(up.Str|up.Null, "bridge", "late_joiners", "history_visibility")
+	helper.Copy(up.Int, "bridge", "late_joiners", "key_share_count")
+	helper.Copy(up.Str, "bridge", "disappearing_messages", "action")
+	helper.Copy(up.Bool, "bridge", "disappearing_messages", "backfill")
+	helper.Copy(up.Str, "bridge", "processing_indicator", "mode")
+	helper.Copy(up.Int, "bridge", "processing_indicator", "min_backfill_messages")
 	helper.Copy(up.Bool, "bridge", "user_avatar_sync")
+	helper.Copy(up.Str, "bridge", "fallback_avatar_style")
 	helper.Copy(up.Bool, "bridge", "bridge_matrix_leave")
 	helper.Copy(up.Bool, "bridge", "sync_direct_chat_list")
 	helper.Copy(up.Bool, "bridge", "default_bridge_presence")
 	helper.Copy(up.Bool, "bridge", "send_presence_on_typing")
+	helper.Copy(up.Bool, "bridge", "active_presence", "enabled")
+	helper.Copy(up.Str, "bridge", "active_presence", "cooldown")
+	helper.Copy(up.Bool, "bridge", "last_seen_topic", "enabled")
+	helper.Copy(up.Str, "bridge", "last_seen_topic", "refresh_interval")
+	helper.Copy(up.Str, "bridge", "group_resync", "offline_threshold")
+	helper.Copy(up.Bool, "bridge", "group_resync", "after_startup")
+	helper.Copy(up.Str, "bridge", "group_resync", "delay")
 	helper.Copy(up.Bool, "bridge", "force_active_delivery_receipts")
 	helper.Copy(up.Map, "bridge", "double_puppet_server_map")
 	helper.Copy(up.Bool, "bridge", "double_puppet_allow_discovery")
@@ -78,6 +182,7 @@ func DoUpgrade(helper *up.Helper) {
 		helper.Copy(up.Map, "bridge", "login_shared_secret_map")
 	}
 	helper.Copy(up.Bool, "bridge", "allow_manual_double_puppeting")
+	helper.Copy(up.Str, "bridge", "double_puppet_check_interval")
 	if legacyPrivateChatPortalMeta, ok := helper.Get(up.Bool, "bridge", "private_chat_portal_meta"); ok {
 		updatedPrivateChatPortalMeta := "default"
 		if legacyPrivateChatPortalMeta == "true" {
@@ -93,6 +198,7 @@ func DoUpgrade(helper *up.Helper) {
 	helper.Copy(up.Bool, "bridge", "mute_bridging")
 	helper.Copy(up.Str|up.Null, "bridge", "archive_tag")
 	helper.Copy(up.Str|up.Null, "bridge", "pinned_tag")
+	helper.Copy(up.Str|up.Null, "bridge", "label_tag_prefix")
 	helper.Copy(up.Bool, "bridge", "tag_only_on_create")
 	helper.Copy(up.Bool, "bridge", "enable_status_broadcast")
 	helper.Copy(up.Bool, "bridge", "disable_status_broadcast_send")
@@ -101,11 +207,22 @@ func DoUpgrade(helper *up.Helper) {
 	helper.Copy(up.Bool, "bridge", "whatsapp_thumbnail")
 	helper.Copy(up.Bool, "bridge", "allow_user_invite")
 	helper.Copy(up.Str, "bridge", "command_prefix")
+	helper.Copy(up.Bool, "bridge", "thread_command_replies")
+	helper.Copy(up.Str, "bridge", "default_locale")
 	helper.Copy(up.Bool, "bridge", "federate_rooms")
+	helper.Copy(up.Str|up.Null, "bridge", "room_creation", "room_version")
+	helper.Copy(up.Map, "bridge", "room_creation", "creation_content")
+	helper.Copy(up.List, "bridge", "room_creation", "initial_state")
+	helper.Copy(up.List, "bridge", "room_creation", "extra_invites")
+	helper.Copy(up.Map, "bridge", "auxiliary_users", "users")
+	helper.Copy(up.Bool, "bridge", "auxiliary_users", "sync_existing")
 	helper.Copy(up.Bool, "bridge", "disable_bridge_alerts")
+	helper.Copy(up.Bool, "bridge", "shared_management_rooms")
 	helper.Copy(up.Bool, "bridge", "crash_on_stream_replaced")
 	helper.Copy(up.Bool, "bridge", "url_previews")
 	helper.Copy(up.Bool, "bridge", "caption_in_message")
+	helper.Copy(up.Bool, "bridge", "convert_stickers")
+	helper.Copy(up.Bool, "bridge", "sticker_packs")
 	helper.Copy(up.Bool, "bridge", "beeper_galleries")
 	if intPolls, ok := helper.Get(up.Int, "bridge", "extev_polls"); ok {
 		val := "false"
@@ -120,6 +237,7 @@ func DoUpgrade(helper *up.Helper) {
 	helper.Copy(up.Bool, "bridge", "disable_reply_fallbacks")
 	helper.Copy(up.Str|up.Null, "bridge", "message_handling_timeout", "error_after")
 	helper.Copy(up.Str|up.Null, "bridge", "message_handling_timeout", "deadline")
+	helper.Copy(up.Str|up.Null, "bridge", "message_handling_timeout", "whatsapp_deadline")
 
 	helper.Copy(up.Str, "bridge", "management_room_text", "welcome")
 	helper.Copy(up.Str, "bridge", "management_room_text", "welcome_connected")
@@ -176,6 +294,8 @@ func DoUpgrade(helper *up.Helper) {
 	helper.Copy(up.Bool, "bridge", "relay", "enabled")
 	helper.Copy(up.Bool, "bridge", "relay", "admin_only")
 	helper.Copy(up.Map, "bridge", "relay", "message_formats")
+	helper.Copy(up.Str|up.Null, "bridge", "relay", "displayname_format")
+	helper.Copy(up.Bool, "bridge", "relay", "allow_identity_override")
 }
 
 var SpacedBlocks = [][]string{
@@ -187,6 +307,8 @@ var SpacedBlocks = [][]string{
 	{"appservice", "as_token"},
 	{"analytics"},
 	{"metrics"},
+	{"admin_api"},
+	{"webhooks"},
 	{"whatsapp"},
 	{"bridge"},
 	{"bridge", "command_prefix"},
@@ -0,0 +1,239 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/tidwall/gjson"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/element-hq/mautrix-go/event"
+	"github.com/element-hq/mautrix-go/id"
+)
+
+const contactMetaField = "fi.mau.whatsapp.contact"
+const escapedContactMetaField = `fi\.mau\.whatsapp\.contact`
+const contactsMetaField = "fi.mau.whatsapp.contacts"
+
+type ContactPhoneNumber struct {
+	Number string    `json:"number"`
+	Type   string    `json:"type,omitempty"`
+	WAID   string    `json:"wa_id,omitempty"`
+	MXID   id.UserID `json:"mxid,omitempty"`
+}
+
+// ContactCard is the structured representation of a vCard that is included in bridged contact messages.
+type ContactCard struct {
+	DisplayName  string               `json:"display_name"`
+	Organization string               `json:"organization,omitempty"`
+	PhoneNumbers []ContactPhoneNumber `json:"phone_numbers,omitempty"`
+	Emails       []string             `json:"emails,omitempty"`
+	VCard        string               `json:"vcard"`
+}
+
+var vCardValueUnescaper = strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`)
+
+// parseVCards parses the fields that are relevant for bridging from one or more concatenated vCards.
+func parseVCards(data string) []*ContactCard {
+	var cards []*ContactCard
+	var card *ContactCard
+	var raw strings.Builder
+	// Unfold continuation lines before parsing
+	data = strings.NewReplacer("\r\n ", "", "\r\n\t", "", "\n ", "", "\n\t", "").Replace(data)
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if card != nil {
+			raw.WriteString(line)
+			raw.WriteString("\r\n")
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		params := strings.Split(key, ";")
+		name := strings.ToUpper(params[0])
+		// Strip group prefixes like item1.TEL
+		if dot := strings.LastIndexByte(name, '.'); dot >= 0 {
+			name = name[dot+1:]
+		}
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VCARD"):
+			card = &ContactCard{}
+			raw.Reset()
+			raw.WriteString(line)
+			raw.WriteString("\r\n")
+		case card == nil:
+			continue
+		case name == "END" && strings.EqualFold(value, "VCARD"):
+			card.VCard = raw.String()
+			cards = append(cards, card)
+			card = nil
+		case name == "FN":
+			card.DisplayName = vCardValueUnescaper.Replace(value)
+		case name == "ORG":
+			// Organization units are separated with semicolons
+			card.Organization = strings.TrimSpace(strings.ReplaceAll(vCardValueUnescaper.Replace(value), ";", " "))
+		case name == "EMAIL":
+			card.Emails = append(card.Emails, value)
+		case name == "TEL":
+			phone := ContactPhoneNumber{Number: value}
+			for _, param := range params[1:] {
+				paramKey, paramValue, hasValue := strings.Cut(param, "=")
+				if !hasValue {
+					phone.Type = strings.ToLower(paramKey)
+				} else if strings.EqualFold(paramKey, "waid") {
+					phone.WAID = paramValue
+				} else if strings.EqualFold(paramKey, "type") && phone.Type == "" {
+					phone.Type = strings.ToLower(paramValue)
+				}
+			}
+			card.PhoneNumbers = append(card.PhoneNumbers, phone)
+		}
+	}
+	return cards
+}
+
+// fillContactPuppets adds the Matrix user IDs of existing puppets to phone numbers that are on WhatsApp.
+func (portal *Portal) fillContactPuppets(ctx context.Context, card *ContactCard) {
+	for i, phone := range card.PhoneNumbers {
+		if phone.WAID == "" {
+			continue
+		}
+		jid := types.NewJID(phone.WAID, types.DefaultUserServer)
+		puppet, err := portal.bridge.DB.Puppet.Get(ctx, jid)
+		if err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Stringer("jid", jid).Msg("Failed to check if contact has puppet")
+		} else if puppet != nil {
+			card.PhoneNumbers[i].MXID = portal.bridge.FormatPuppetMXID(jid)
+		}
+	}
+}
+
+// formatContactCard renders a readable summary of a contact card, linking phone numbers to puppets when possible.
+func formatContactCard(card *ContactCard) (string, string) {
+	var plain, formatted strings.Builder
+	plain.WriteString(card.DisplayName)
+	_, _ = fmt.Fprintf(&formatted, "<strong>%s</strong>", html.EscapeString(card.DisplayName))
+	if card.Organization != "" {
+		_, _ = fmt.Fprintf(&plain, " (%s)", card.Organization)
+		_, _ = fmt.Fprintf(&formatted, " (%s)", html.EscapeString(card.Organization))
+	}
+	for _, phone := range card.PhoneNumbers {
+		plain.WriteString("\n")
+		formatted.WriteString("<br>")
+		if phone.Type != "" {
+			_, _ = fmt.Fprintf(&plain, "%s: ", phone.Type)
+			_, _ = fmt.Fprintf(&formatted, "%s: ", html.EscapeString(phone.Type))
+		}
+		plain.WriteString(phone.Number)
+		if phone.MXID != "" {
+			_, _ = fmt.Fprintf(&plain, " (https://matrix.to/#/%s)", phone.MXID)
+			_, _ = fmt.Fprintf(&formatted, `<a href="https://matrix.to/#/%s">%s</a>`, phone.MXID, html.EscapeString(phone.Number))
+		} else {
+			formatted.WriteString(html.EscapeString(phone.Number))
+		}
+	}
+	for _, email := range card.Emails {
+		_, _ = fmt.Fprintf(&plain, "\n%s", email)
+		_, _ = fmt.Fprintf(&formatted, `<br><a href="mailto:%s">%s</a>`, html.EscapeString(email), html.EscapeString(email))
+	}
+	return plain.String(), formatted.String()
+}
+
+func (portal *Portal) parseWhatsAppContact(ctx context.Context, msg *waProto.ContactMessage) *ContactCard {
+	var card *ContactCard
+	if cards := parseVCards(msg.GetVcard()); len(cards) > 0 {
+		card = cards[0]
+	} else {
+		card = &ContactCard{}
+	}
+	card.VCard = msg.GetVcard()
+	if msg.GetDisplayName() != "" {
+		card.DisplayName = msg.GetDisplayName()
+	}
+	portal.fillContactPuppets(ctx, card)
+	return card
+}
+
+func isVCardFile(content *event.MessageEventContent) bool {
+	switch strings.ToLower(content.GetInfo().MimeType) {
+	case "text/vcard", "text/x-vcard", "text/directory":
+		return true
+	}
+	fileName := content.FileName
+	if fileName == "" {
+		fileName = content.Body
+	}
+	return strings.EqualFold(filepath.Ext(fileName), ".vcf")
+}
+
+func contactCardToWhatsApp(card *ContactCard, fallbackName string, ctxInfo *waProto.ContextInfo) *waProto.ContactMessage {
+	name := card.DisplayName
+	if name == "" {
+		name = fallbackName
+	}
+	return &waProto.ContactMessage{
+		DisplayName: proto.String(name),
+		Vcard:       proto.String(card.VCard),
+		ContextInfo: ctxInfo,
+	}
+}
+
+// convertMatrixContact converts an uploaded vCard file or a forwarded contact message into a WhatsApp contact
+// or contact array message.
+func (portal *Portal) convertMatrixContact(ctx context.Context, evt *event.Event, content *event.MessageEventContent, ctxInfo *waProto.ContextInfo) (*waProto.Message, error) {
+	var data []byte
+	if forwardedVCard := gjson.GetBytes(evt.Content.VeryRaw, escapedContactMetaField+".vcard"); forwardedVCard.Type == gjson.String {
+		data = []byte(forwardedVCard.Str)
+	} else {
+		var err error
+		data, _, err = portal.downloadMatrixFile(ctx, content)
+		if err != nil {
+			return nil, err
+		}
+	}
+	fileName := content.FileName
+	if fileName == "" {
+		fileName = content.Body
+	}
+	fallbackName := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	cards := parseVCards(string(data))
+	switch len(cards) {
+	case 0:
+		return nil, errInvalidVCard
+	case 1:
+		return &waProto.Message{ContactMessage: contactCardToWhatsApp(cards[0], fallbackName, ctxInfo)}, nil
+	default:
+		contacts := make([]*waProto.ContactMessage, len(cards))
+		for i, card := range cards {
+			contacts[i] = contactCardToWhatsApp(card, fallbackName, nil)
+		}
+		return &waProto.Message{ContactsArrayMessage: &waProto.ContactsArrayMessage{
+			DisplayName: proto.String(fmt.Sprintf("%d contacts", len(contacts))),
+			Contacts:    contacts,
+			ContextInfo: ctxInfo,
+		}}, nil
+	}
+}
@@ -0,0 +1,95 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mau.fi/util/dbutil"
+
+	"github.com/element-hq/mautrix-go/id"
+)
+
+type AnnouncementQuery struct {
+	*dbutil.QueryHelper[*Announcement]
+}
+
+func newAnnouncement(qh *dbutil.QueryHelper[*Announcement]) *Announcement {
+	return &Announcement{qh: qh}
+}
+
+func (aq *AnnouncementQuery) New() *Announcement {
+	return &Announcement{qh: aq.QueryHelper}
+}
+
+const (
+	getAnnouncementQuery = `
+		SELECT id, sender, message, created_at, last_user, sent_count, completed FROM announcement WHERE id=$1
+	`
+	getIncompleteAnnouncementsQuery = `
+		SELECT id, sender, message, created_at, last_user, sent_count, completed FROM announcement WHERE completed=false ORDER BY id
+	`
+	insertAnnouncementQuery = `
+		INSERT INTO announcement (sender, message, created_at, last_user, sent_count, completed)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`
+	updateAnnouncementQuery = "UPDATE announcement SET last_user=$2, sent_count=$3, completed=$4 WHERE id=$1"
+)
+
+func (aq *AnnouncementQuery) GetByID(ctx context.Context, announcementID int) (*Announcement, error) {
+	return aq.QueryOne(ctx, getAnnouncementQuery, announcementID)
+}
+
+func (aq *AnnouncementQuery) GetIncomplete(ctx context.Context) ([]*Announcement, error) {
+	return aq.QueryMany(ctx, getIncompleteAnnouncementsQuery)
+}
+
+// Announcement is a notice sent by a bridge admin to the management rooms of all users.
+// LastUser is the last user the notice was delivered to, which allows resuming after a restart.
+type Announcement struct {
+	qh *dbutil.QueryHelper[*Announcement]
+
+	ID        int
+	Sender    id.UserID
+	Message   string
+	CreatedAt time.Time
+	LastUser  id.UserID
+	SentCount int
+	Completed bool
+}
+
+func (ann *Announcement) Scan(row dbutil.Scannable) (*Announcement, error) {
+	var createdAt int64
+	err := row.Scan(&ann.ID, &ann.Sender, &ann.Message, &createdAt, &ann.LastUser, &ann.SentCount, &ann.Completed)
+	if err != nil {
+		return nil, err
+	}
+	ann.CreatedAt = time.UnixMilli(createdAt)
+	return ann, nil
+}
+
+func (ann *Announcement) Insert(ctx context.Context) error {
+	return ann.qh.GetDB().
+		QueryRow(ctx, insertAnnouncementQuery, ann.Sender, ann.Message, ann.CreatedAt.UnixMilli(), ann.LastUser, ann.SentCount, ann.Completed).
+		Scan(&ann.ID)
+}
+
+func (ann *Announcement) Update(ctx context.Context) error {
+	return ann.qh.Exec(ctx, updateAnnouncementQuery, ann.ID, ann.LastUser, ann.SentCount, ann.Completed)
+}
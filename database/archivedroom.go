@@ -0,0 +1,90 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mau.fi/util/dbutil"
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/element-hq/mautrix-go/id"
+)
+
+type ArchivedRoomQuery struct {
+	*dbutil.QueryHelper[*ArchivedRoom]
+}
+
+func newArchivedRoom(qh *dbutil.QueryHelper[*ArchivedRoom]) *ArchivedRoom {
+	return &ArchivedRoom{qh: qh}
+}
+
+func (arq *ArchivedRoomQuery) New() *ArchivedRoom {
+	return &ArchivedRoom{qh: arq.QueryHelper}
+}
+
+const (
+	getArchivedRoomBaseQuery     = "SELECT room_id, user_mxid, chat_jid, name, archived_at FROM archived_room"
+	getArchivedRoomByRoomIDQuery = getArchivedRoomBaseQuery + " WHERE room_id=$1"
+	getArchivedRoomsByUserQuery  = getArchivedRoomBaseQuery + " WHERE user_mxid=$1 ORDER BY archived_at"
+	insertArchivedRoomQuery      = `
+		INSERT INTO archived_room (room_id, user_mxid, chat_jid, name, archived_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (room_id) DO UPDATE SET user_mxid=excluded.user_mxid, chat_jid=excluded.chat_jid,
+		                                    name=excluded.name, archived_at=excluded.archived_at
+	`
+	deleteArchivedRoomQuery = "DELETE FROM archived_room WHERE room_id=$1"
+)
+
+func (arq *ArchivedRoomQuery) GetByRoomID(ctx context.Context, roomID id.RoomID) (*ArchivedRoom, error) {
+	return arq.QueryOne(ctx, getArchivedRoomByRoomIDQuery, roomID)
+}
+
+func (arq *ArchivedRoomQuery) GetAllByUser(ctx context.Context, userID id.UserID) ([]*ArchivedRoom, error) {
+	return arq.QueryMany(ctx, getArchivedRoomsByUserQuery, userID)
+}
+
+// ArchivedRoom is a former group portal that was kept as a read-only room after the user left the group.
+type ArchivedRoom struct {
+	qh *dbutil.QueryHelper[*ArchivedRoom]
+
+	RoomID     id.RoomID
+	UserMXID   id.UserID
+	ChatJID    types.JID
+	Name       string
+	ArchivedAt time.Time
+}
+
+func (ar *ArchivedRoom) Scan(row dbutil.Scannable) (*ArchivedRoom, error) {
+	var chatJID string
+	var archivedAt int64
+	err := row.Scan(&ar.RoomID, &ar.UserMXID, &chatJID, &ar.Name, &archivedAt)
+	if err != nil {
+		return nil, err
+	}
+	ar.ChatJID, _ = types.ParseJID(chatJID)
+	ar.ArchivedAt = time.Unix(archivedAt, 0)
+	return ar, nil
+}
+
+func (ar *ArchivedRoom) Insert(ctx context.Context) error {
+	return ar.qh.Exec(ctx, insertArchivedRoomQuery, ar.RoomID, ar.UserMXID, ar.ChatJID.String(), ar.Name, ar.ArchivedAt.Unix())
+}
+
+func (ar *ArchivedRoom) Delete(ctx context.Context) error {
+	return ar.qh.Exec(ctx, deleteArchivedRoomQuery, ar.RoomID)
+}
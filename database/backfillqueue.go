@@ -115,8 +115,22 @@ const (
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 		RETURNING queue_id
 	`
-	markBackfillTaskDispatchedQuery = "UPDATE backfill_queue SET dispatch_time=$1 WHERE queue_id=$2"
-	markBackfillTaskDoneQuery       = "UPDATE backfill_queue SET completed_at=$1 WHERE queue_id=$2"
+	markBackfillTaskDispatchedQuery   = "UPDATE backfill_queue SET dispatch_time=$1 WHERE queue_id=$2"
+	markBackfillTaskDoneQuery         = "UPDATE backfill_queue SET completed_at=$1 WHERE queue_id=$2"
+	markBackfillTaskUndispatchedQuery = "UPDATE backfill_queue SET dispatch_time=NULL WHERE queue_id=$1 AND completed_at IS NULL"
+	resetInFlightBackfillTasksQuery   = `
+		UPDATE backfill_queue SET dispatch_time=NULL
+		WHERE user_mxid=$1 AND dispatch_time IS NOT NULL AND dispatch_time<$2 AND completed_at IS NULL
+	`
+	setBackfillPortalPriorityQuery = `
+		UPDATE backfill_queue SET priority=$4
+		WHERE user_mxid=$1 AND portal_jid=$2 AND portal_receiver=$3 AND completed_at IS NULL
+	`
+	countPendingBackfillTasksQuery = `
+		SELECT type, COUNT(*) FROM backfill_queue
+		WHERE user_mxid=$1 AND completed_at IS NULL
+		GROUP BY type
+	`
 )
 
 func typesToString(backfillTypes []BackfillType) string {
@@ -155,6 +169,39 @@ func (bq *BackfillTaskQuery) HasUnstartedOrInFlightOfType(ctx context.Context, u
 	return
 }
 
+// ResetInFlight marks unfinished tasks of the user that were dispatched before the given time as not dispatched,
+// so that backfills interrupted by a bridge restart are picked up again immediately. The time should be when
+// the current backfill workers were started, so that tasks which are still being processed aren't reset.
+func (bq *BackfillTaskQuery) ResetInFlight(ctx context.Context, userID id.UserID, dispatchedBefore time.Time) error {
+	return bq.Exec(ctx, resetInFlightBackfillTasksQuery, userID, dispatchedBefore)
+}
+
+// SetPortalPriority changes the priority of all unfinished tasks for the given portal.
+// Lower numbers are handled first within each backfill type.
+func (bq *BackfillTaskQuery) SetPortalPriority(ctx context.Context, userID id.UserID, portalKey PortalKey, priority int) error {
+	return bq.Exec(ctx, setBackfillPortalPriorityQuery, userID, portalKey.JID, portalKey.Receiver, priority)
+}
+
+// CountPending returns the number of unfinished tasks of the user grouped by backfill type.
+func (bq *BackfillTaskQuery) CountPending(ctx context.Context, userID id.UserID) (map[BackfillType]int, error) {
+	rows, err := bq.GetDB().Query(ctx, countPendingBackfillTasksQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := make(map[BackfillType]int)
+	for rows.Next() {
+		var backfillType BackfillType
+		var count int
+		err = rows.Scan(&backfillType, &count)
+		if err != nil {
+			return nil, err
+		}
+		counts[backfillType] = count
+	}
+	return counts, rows.Err()
+}
+
 func (bq *BackfillTaskQuery) DeleteAll(ctx context.Context, userID id.UserID) error {
 	//bq.backfillQueryLock.Lock()
 	//defer bq.backfillQueryLock.Unlock()
@@ -242,6 +289,14 @@ func (b *BackfillTask) MarkDispatched(ctx context.Context) error {
 	return b.qh.Exec(ctx, markBackfillTaskDispatchedQuery, time.Now(), b.QueueID)
 }
 
+// MarkUndispatched marks the task as not dispatched, so that it's picked up again later.
+func (b *BackfillTask) MarkUndispatched(ctx context.Context) error {
+	if b.QueueID == 0 {
+		return fmt.Errorf("can't mark backfill as undispatched without queue_id")
+	}
+	return b.qh.Exec(ctx, markBackfillTaskUndispatchedQuery, b.QueueID)
+}
+
 func (b *BackfillTask) MarkDone(ctx context.Context) error {
 	//b.db.Backfill.backfillQueryLock.Lock()
 	//defer b.db.Backfill.backfillQueryLock.Unlock()
@@ -0,0 +1,87 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"go.mau.fi/util/dbutil"
+
+	"github.com/element-hq/mautrix-go/id"
+)
+
+type BackfillSchedulerQuery struct {
+	*dbutil.QueryHelper[*BackfillSchedulerState]
+}
+
+func newBackfillSchedulerState(qh *dbutil.QueryHelper[*BackfillSchedulerState]) *BackfillSchedulerState {
+	return &BackfillSchedulerState{qh: qh}
+}
+
+func (bsq *BackfillSchedulerQuery) New(userID id.UserID) *BackfillSchedulerState {
+	return &BackfillSchedulerState{
+		qh: bsq.QueryHelper,
+
+		UserID: userID,
+	}
+}
+
+const (
+	getBackfillSchedulerStateQuery    = "SELECT user_mxid, paused, paused_at FROM backfill_scheduler WHERE user_mxid=$1"
+	upsertBackfillSchedulerStateQuery = `
+		INSERT INTO backfill_scheduler (user_mxid, paused, paused_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_mxid)
+		DO UPDATE SET
+			paused=excluded.paused,
+			paused_at=excluded.paused_at
+	`
+)
+
+func (bsq *BackfillSchedulerQuery) GetByUser(ctx context.Context, userID id.UserID) (*BackfillSchedulerState, error) {
+	return bsq.QueryOne(ctx, getBackfillSchedulerStateQuery, userID)
+}
+
+type BackfillSchedulerState struct {
+	qh *dbutil.QueryHelper[*BackfillSchedulerState]
+
+	UserID   id.UserID
+	Paused   bool
+	PausedAt time.Time
+}
+
+func (bss *BackfillSchedulerState) Scan(row dbutil.Scannable) (*BackfillSchedulerState, error) {
+	var pausedAt sql.NullInt64
+	err := row.Scan(&bss.UserID, &bss.Paused, &pausedAt)
+	if err != nil {
+		return nil, err
+	}
+	if pausedAt.Valid {
+		bss.PausedAt = time.UnixMilli(pausedAt.Int64)
+	}
+	return bss, nil
+}
+
+func (bss *BackfillSchedulerState) sqlVariables() []any {
+	return []any{bss.UserID, bss.Paused, dbutil.UnixMilliPtr(bss.PausedAt)}
+}
+
+func (bss *BackfillSchedulerState) Upsert(ctx context.Context) error {
+	return bss.qh.Exec(ctx, upsertBackfillSchedulerStateQuery, bss.sqlVariables()...)
+}
@@ -43,7 +43,7 @@ func (bq *BackfillStateQuery) NewBackfillState(userID id.UserID, portalKey Porta
 
 const (
 	getBackfillStateQuery = `
-		SELECT user_mxid, portal_jid, portal_receiver, processing_batch, backfill_complete, first_expected_ts
+		SELECT user_mxid, portal_jid, portal_receiver, processing_batch, backfill_complete, first_expected_ts, message_count
 		FROM backfill_state
 		WHERE user_mxid=$1
 			AND portal_jid=$2
@@ -51,13 +51,14 @@ const (
 	`
 	upsertBackfillStateQuery = `
 		INSERT INTO backfill_state
-			(user_mxid, portal_jid, portal_receiver, processing_batch, backfill_complete, first_expected_ts)
-		VALUES ($1, $2, $3, $4, $5, $6)
+			(user_mxid, portal_jid, portal_receiver, processing_batch, backfill_complete, first_expected_ts, message_count)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		ON CONFLICT (user_mxid, portal_jid, portal_receiver)
 		DO UPDATE SET
 			processing_batch=EXCLUDED.processing_batch,
 			backfill_complete=EXCLUDED.backfill_complete,
-			first_expected_ts=EXCLUDED.first_expected_ts
+			first_expected_ts=EXCLUDED.first_expected_ts,
+			message_count=EXCLUDED.message_count
 	`
 )
 
@@ -73,16 +74,18 @@ type BackfillState struct {
 	ProcessingBatch        bool
 	BackfillComplete       bool
 	FirstExpectedTimestamp uint64
+	// MessageCount is the total number of messages backfilled into the chat across all backfill tasks.
+	MessageCount int
 }
 
 func (b *BackfillState) Scan(row dbutil.Scannable) (*BackfillState, error) {
 	return dbutil.ValueOrErr(b, row.Scan(
-		&b.UserID, &b.Portal.JID, &b.Portal.Receiver, &b.ProcessingBatch, &b.BackfillComplete, &b.FirstExpectedTimestamp,
+		&b.UserID, &b.Portal.JID, &b.Portal.Receiver, &b.ProcessingBatch, &b.BackfillComplete, &b.FirstExpectedTimestamp, &b.MessageCount,
 	))
 }
 
 func (b *BackfillState) sqlVariables() []any {
-	return []any{b.UserID, b.Portal.JID, b.Portal.Receiver, b.ProcessingBatch, b.BackfillComplete, b.FirstExpectedTimestamp}
+	return []any{b.UserID, b.Portal.JID, b.Portal.Receiver, b.ProcessingBatch, b.BackfillComplete, b.FirstExpectedTimestamp, b.MessageCount}
 }
 
 func (b *BackfillState) Upsert(ctx context.Context) error {
@@ -0,0 +1,88 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"context"
+
+	"go.mau.fi/util/dbutil"
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/element-hq/mautrix-go/id"
+)
+
+// ChatFilterAction is the action of a per-user chat filter entry.
+type ChatFilterAction string
+
+const (
+	// ChatFilterAllow means the chat is on the user's allowlist. If a user has any allowlisted chats,
+	// all other chats are ignored.
+	ChatFilterAllow ChatFilterAction = "allow"
+	// ChatFilterDeny means the chat is ignored.
+	ChatFilterDeny ChatFilterAction = "deny"
+)
+
+type ChatFilterQuery struct {
+	*dbutil.QueryHelper[*ChatFilter]
+}
+
+func newChatFilter(qh *dbutil.QueryHelper[*ChatFilter]) *ChatFilter {
+	return &ChatFilter{qh: qh}
+}
+
+func (cfq *ChatFilterQuery) New() *ChatFilter {
+	return &ChatFilter{qh: cfq.QueryHelper}
+}
+
+const (
+	getUserChatFiltersQuery = `SELECT user_mxid, chat_jid, action FROM user_chat_filter WHERE user_mxid=$1`
+	upsertChatFilterQuery   = `
+		INSERT INTO user_chat_filter (user_mxid, chat_jid, action) VALUES ($1, $2, $3)
+		ON CONFLICT (user_mxid, chat_jid) DO UPDATE SET action=excluded.action
+	`
+	deleteChatFilterQuery          = "DELETE FROM user_chat_filter WHERE user_mxid=$1 AND chat_jid=$2"
+	deleteChatFiltersByActionQuery = "DELETE FROM user_chat_filter WHERE user_mxid=$1 AND action=$2"
+)
+
+func (cfq *ChatFilterQuery) GetAll(ctx context.Context, userID id.UserID) ([]*ChatFilter, error) {
+	return cfq.QueryMany(ctx, getUserChatFiltersQuery, userID)
+}
+
+func (cfq *ChatFilterQuery) Delete(ctx context.Context, userID id.UserID, chat types.JID) error {
+	return cfq.Exec(ctx, deleteChatFilterQuery, userID, chat)
+}
+
+func (cfq *ChatFilterQuery) DeleteAllWithAction(ctx context.Context, userID id.UserID, action ChatFilterAction) error {
+	return cfq.Exec(ctx, deleteChatFiltersByActionQuery, userID, action)
+}
+
+// ChatFilter is a per-user rule for whether a WhatsApp chat should be bridged.
+type ChatFilter struct {
+	qh *dbutil.QueryHelper[*ChatFilter]
+
+	UserMXID id.UserID
+	ChatJID  types.JID
+	Action   ChatFilterAction
+}
+
+func (cf *ChatFilter) Scan(row dbutil.Scannable) (*ChatFilter, error) {
+	return dbutil.ValueOrErr(cf, row.Scan(&cf.UserMXID, &cf.ChatJID, &cf.Action))
+}
+
+func (cf *ChatFilter) Upsert(ctx context.Context) error {
+	return cf.qh.Exec(ctx, upsertChatFilterQuery, cf.UserMXID, cf.ChatJID, cf.Action)
+}
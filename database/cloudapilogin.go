@@ -0,0 +1,83 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"context"
+
+	"go.mau.fi/util/dbutil"
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/element-hq/mautrix-go/id"
+)
+
+type CloudAPILoginQuery struct {
+	*dbutil.QueryHelper[*CloudAPILogin]
+}
+
+func newCloudAPILogin(qh *dbutil.QueryHelper[*CloudAPILogin]) *CloudAPILogin {
+	return &CloudAPILogin{qh: qh}
+}
+
+func (clq *CloudAPILoginQuery) New() *CloudAPILogin {
+	return &CloudAPILogin{qh: clq.QueryHelper}
+}
+
+const (
+	getAllCloudAPILoginsQuery = `
+		SELECT user_mxid, phone_number_id, phone_number, access_token FROM cloud_api_login
+	`
+	upsertCloudAPILoginQuery = `
+		INSERT INTO cloud_api_login (user_mxid, phone_number_id, phone_number, access_token) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_mxid) DO UPDATE
+			SET phone_number_id=excluded.phone_number_id, phone_number=excluded.phone_number, access_token=excluded.access_token
+	`
+	deleteCloudAPILoginQuery = "DELETE FROM cloud_api_login WHERE user_mxid=$1"
+)
+
+func (clq *CloudAPILoginQuery) GetAll(ctx context.Context) ([]*CloudAPILogin, error) {
+	return clq.QueryMany(ctx, getAllCloudAPILoginsQuery)
+}
+
+// CloudAPILogin is a WhatsApp Business Cloud API number that a Matrix user has connected to the bridge
+// instead of pairing a phone.
+type CloudAPILogin struct {
+	qh *dbutil.QueryHelper[*CloudAPILogin]
+
+	UserMXID      id.UserID
+	PhoneNumberID string
+	// PhoneNumber is the business phone number in international format without the leading +.
+	PhoneNumber string
+	AccessToken string
+}
+
+// JID returns the WhatsApp JID of the business phone number, which is used as the receiver of the login's portals.
+func (cl *CloudAPILogin) JID() types.JID {
+	return types.NewJID(cl.PhoneNumber, types.DefaultUserServer)
+}
+
+func (cl *CloudAPILogin) Scan(row dbutil.Scannable) (*CloudAPILogin, error) {
+	return dbutil.ValueOrErr(cl, row.Scan(&cl.UserMXID, &cl.PhoneNumberID, &cl.PhoneNumber, &cl.AccessToken))
+}
+
+func (cl *CloudAPILogin) Upsert(ctx context.Context) error {
+	return cl.qh.Exec(ctx, upsertCloudAPILoginQuery, cl.UserMXID, cl.PhoneNumberID, cl.PhoneNumber, cl.AccessToken)
+}
+
+func (cl *CloudAPILogin) Delete(ctx context.Context) error {
+	return cl.qh.Exec(ctx, deleteCloudAPILoginQuery, cl.UserMXID)
+}
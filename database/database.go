@@ -46,8 +46,23 @@ type Database struct {
 	DisappearingMessage  *DisappearingMessageQuery
 	BackfillQueue        *BackfillTaskQuery
 	BackfillState        *BackfillStateQuery
+	BackfillScheduler    *BackfillSchedulerQuery
 	HistorySync          *HistorySyncQuery
 	MediaBackfillRequest *MediaBackfillRequestQuery
+	MediaRetry           *MediaRetryQuery
+	Label                *LabelQuery
+	Announcement         *AnnouncementQuery
+	UserStats            *UserStatsQuery
+	OutgoingQueue        *OutgoingQueueQuery
+	StickerCache         *StickerCacheQuery
+	ChatFilter           *ChatFilterQuery
+	PendingGroupInvite   *PendingGroupInviteQuery
+	Prompt               *PromptQuery
+	MediaCache           *MediaCacheQuery
+	CloudAPILogin        *CloudAPILoginQuery
+	PinnedMessage        *PinnedMessageQuery
+	SharedAccess         *SharedAccessQuery
+	ArchivedRoom         *ArchivedRoomQuery
 }
 
 func New(db *dbutil.Database) *Database {
@@ -63,8 +78,23 @@ func New(db *dbutil.Database) *Database {
 		DisappearingMessage:  &DisappearingMessageQuery{dbutil.MakeQueryHelper(db, newDisappearingMessage)},
 		BackfillQueue:        &BackfillTaskQuery{dbutil.MakeQueryHelper(db, newBackfillTask)},
 		BackfillState:        &BackfillStateQuery{dbutil.MakeQueryHelper(db, newBackfillState)},
+		BackfillScheduler:    &BackfillSchedulerQuery{dbutil.MakeQueryHelper(db, newBackfillSchedulerState)},
 		HistorySync:          &HistorySyncQuery{dbutil.MakeQueryHelper(db, newHistorySyncConversation)},
 		MediaBackfillRequest: &MediaBackfillRequestQuery{dbutil.MakeQueryHelper(db, newMediaBackfillRequest)},
+		MediaRetry:           &MediaRetryQuery{dbutil.MakeQueryHelper(db, newMediaRetry)},
+		Label:                &LabelQuery{dbutil.MakeQueryHelper(db, newLabel)},
+		Announcement:         &AnnouncementQuery{dbutil.MakeQueryHelper(db, newAnnouncement)},
+		UserStats:            &UserStatsQuery{dbutil.MakeQueryHelper(db, newUserStats)},
+		OutgoingQueue:        &OutgoingQueueQuery{dbutil.MakeQueryHelper(db, newQueuedMessage)},
+		StickerCache:         &StickerCacheQuery{dbutil.MakeQueryHelper(db, newCachedSticker)},
+		ChatFilter:           &ChatFilterQuery{dbutil.MakeQueryHelper(db, newChatFilter)},
+		PendingGroupInvite:   &PendingGroupInviteQuery{dbutil.MakeQueryHelper(db, newPendingGroupInvite)},
+		Prompt:               &PromptQuery{dbutil.MakeQueryHelper(db, newPrompt)},
+		MediaCache:           &MediaCacheQuery{dbutil.MakeQueryHelper(db, newCachedMedia)},
+		CloudAPILogin:        &CloudAPILoginQuery{dbutil.MakeQueryHelper(db, newCloudAPILogin)},
+		PinnedMessage:        &PinnedMessageQuery{dbutil.MakeQueryHelper(db, newPinnedMessage)},
+		SharedAccess:         &SharedAccessQuery{dbutil.MakeQueryHelper(db, newSharedAccess)},
+		ArchivedRoom:         &ArchivedRoomQuery{dbutil.MakeQueryHelper(db, newArchivedRoom)},
 	}
 }
 
@@ -49,16 +49,26 @@ func (dmq *DisappearingMessageQuery) NewWithValues(roomID id.RoomID, eventID id.
 }
 
 const (
-	getAllScheduledDisappearingMessagesQuery = `
-		SELECT room_id, event_id, expire_in, expire_at FROM disappearing_message WHERE expire_at IS NOT NULL AND expire_at <= $1
+	getDueDisappearingMessagesQuery = `
+		SELECT room_id, event_id, expire_in, expire_at FROM disappearing_message
+		WHERE expire_at IS NOT NULL AND expire_at <= $1
+		ORDER BY expire_at
+		LIMIT $2
 	`
 	insertDisappearingMessageQuery       = `INSERT INTO disappearing_message (room_id, event_id, expire_in, expire_at) VALUES ($1, $2, $3, $4)`
 	updateDisappearingMessageExpiryQuery = "UPDATE disappearing_message SET expire_at=$1 WHERE room_id=$2 AND event_id=$3"
 	deleteDisappearingMessageQuery       = "DELETE FROM disappearing_message WHERE room_id=$1 AND event_id=$2"
+	deleteRoomDisappearingMessagesQuery  = "DELETE FROM disappearing_message WHERE room_id=$1"
 )
 
-func (dmq *DisappearingMessageQuery) GetUpcomingScheduled(ctx context.Context, duration time.Duration) ([]*DisappearingMessage, error) {
-	return dmq.QueryMany(ctx, getAllScheduledDisappearingMessagesQuery, time.Now().Add(duration).UnixMilli())
+// GetDue returns up to limit messages whose disappearing timer has already elapsed, oldest first.
+func (dmq *DisappearingMessageQuery) GetDue(ctx context.Context, limit int) ([]*DisappearingMessage, error) {
+	return dmq.QueryMany(ctx, getDueDisappearingMessagesQuery, time.Now().UnixMilli(), limit)
+}
+
+// DeleteAllInRoom cancels all pending disappearing messages in the given room.
+func (dmq *DisappearingMessageQuery) DeleteAllInRoom(ctx context.Context, roomID id.RoomID) error {
+	return dmq.Exec(ctx, deleteRoomDisappearingMessagesQuery, roomID)
 }
 
 type DisappearingMessage struct {
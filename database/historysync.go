@@ -199,6 +199,11 @@ const (
 		DELETE FROM history_sync_message
 		WHERE user_mxid=$1 AND conversation_id=$2
 	`
+	countHistorySyncMessagesQuery = `
+		SELECT conversation_id, COUNT(*) FROM history_sync_message
+		WHERE user_mxid=$1
+		GROUP BY conversation_id
+	`
 	conversationHasHistorySyncMessagesQuery = `
 		SELECT EXISTS(
 		    SELECT 1 FROM history_sync_message
@@ -292,6 +297,26 @@ func (hsq *HistorySyncQuery) DeleteAllMessagesForPortal(ctx context.Context, use
 	return hsq.Exec(ctx, deleteHistorySyncMessagesForPortalQuery, userID, portalKey.JID)
 }
 
+// CountMessages returns the number of stored history sync messages in each conversation of the user.
+func (hsq *HistorySyncQuery) CountMessages(ctx context.Context, userID id.UserID) (map[string]int, error) {
+	rows, err := hsq.GetDB().Query(ctx, countHistorySyncMessagesQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := make(map[string]int)
+	for rows.Next() {
+		var conversationID string
+		var count int
+		err = rows.Scan(&conversationID, &count)
+		if err != nil {
+			return nil, err
+		}
+		counts[conversationID] = count
+	}
+	return counts, rows.Err()
+}
+
 func (hsq *HistorySyncQuery) ConversationHasMessages(ctx context.Context, userID id.UserID, portalKey PortalKey) (exists bool, err error) {
 	err = hsq.GetDB().QueryRow(ctx, conversationHasHistorySyncMessagesQuery, userID, portalKey.JID).Scan(&exists)
 	return
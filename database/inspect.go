@@ -0,0 +1,189 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mau.fi/util/dbutil"
+)
+
+// inspectedTables are the bridge tables included in the output of Inspect.
+var inspectedTables = []string{
+	`"user"`, "portal", "puppet", "message", "reaction", "poll_option_id", "disappearing_message", "user_portal",
+	"backfill_queue", "backfill_state", "media_backfill_requests", "media_retry", "history_sync_conversation",
+	"history_sync_message", "whatsapp_label", "portal_label", "announcement", "user_stats",
+}
+
+type TableStats struct {
+	Name string
+	Rows int64
+}
+
+type SchemaInfo struct {
+	Version int
+	Compat  int
+	Latest  int
+	// Tables is sorted by row count, largest first.
+	Tables []TableStats
+	// UnusedIndexes lists Postgres indexes that have never been scanned.
+	UnusedIndexes []string
+	// IntegrityCheck is the result of PRAGMA quick_check on SQLite.
+	IntegrityCheck string
+}
+
+func (si *SchemaInfo) PendingMigrations() int {
+	if si.Latest > si.Version {
+		return si.Latest - si.Version
+	}
+	return 0
+}
+
+func (db *Database) Inspect(ctx context.Context) (*SchemaInfo, error) {
+	info := &SchemaInfo{Latest: len(db.UpgradeTable)}
+	err := db.QueryRow(ctx, fmt.Sprintf("SELECT version, compat FROM %s LIMIT 1", db.VersionTable)).Scan(&info.Version, &info.Compat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schema version: %w", err)
+	}
+	for _, table := range inspectedTables {
+		// The database may not have been upgraded yet, so skip tables that were added by pending migrations
+		exists, err := db.TableExists(ctx, strings.Trim(table, `"`))
+		if err != nil {
+			return nil, fmt.Errorf("failed to check if %s exists: %w", table, err)
+		} else if !exists {
+			continue
+		}
+		stats := TableStats{Name: table}
+		err = db.QueryRow(ctx, "SELECT COUNT(*) FROM "+table).Scan(&stats.Rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count rows in %s: %w", table, err)
+		}
+		info.Tables = append(info.Tables, stats)
+	}
+	sort.Slice(info.Tables, func(i, j int) bool {
+		return info.Tables[i].Rows > info.Tables[j].Rows
+	})
+	if db.Dialect == dbutil.Postgres {
+		scanFn := func(rows dbutil.Scannable) (name string, err error) {
+			err = rows.Scan(&name)
+			return
+		}
+		info.UnusedIndexes, err = dbutil.ConvertRowFn[string](scanFn).
+			NewRowIter(db.Query(ctx, "SELECT indexrelname FROM pg_stat_user_indexes WHERE idx_scan=0 AND schemaname=current_schema() ORDER BY indexrelname")).
+			AsList()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get index usage: %w", err)
+		}
+	} else {
+		err = db.QueryRow(ctx, "PRAGMA quick_check").Scan(&info.IntegrityCheck)
+		if err != nil {
+			return nil, fmt.Errorf("failed to run integrity check: %w", err)
+		}
+	}
+	return info, nil
+}
+
+type DoctorCheck struct {
+	Name        string
+	Description string
+	countQuery  string
+	// fixQuery is empty for checks that are only reported and never fixed automatically.
+	fixQuery string
+}
+
+// DoctorChecks are the known inconsistencies checked by Doctor, in the order they must be fixed in.
+var DoctorChecks = []*DoctorCheck{{
+	Name:        "orphaned_reactions",
+	Description: "Reactions in chats that don't have a Matrix room",
+	countQuery:  "SELECT COUNT(*) FROM reaction WHERE NOT EXISTS (SELECT 1 FROM portal WHERE portal.jid=reaction.chat_jid AND portal.receiver=reaction.chat_receiver AND portal.mxid<>'')",
+	fixQuery:    "DELETE FROM reaction WHERE NOT EXISTS (SELECT 1 FROM portal WHERE portal.jid=reaction.chat_jid AND portal.receiver=reaction.chat_receiver AND portal.mxid<>'')",
+}, {
+	Name:        "orphaned_messages",
+	Description: "Messages in chats that don't have a Matrix room",
+	countQuery:  "SELECT COUNT(*) FROM message WHERE NOT EXISTS (SELECT 1 FROM portal WHERE portal.jid=message.chat_jid AND portal.receiver=message.chat_receiver AND portal.mxid<>'')",
+	fixQuery:    "DELETE FROM message WHERE NOT EXISTS (SELECT 1 FROM portal WHERE portal.jid=message.chat_jid AND portal.receiver=message.chat_receiver AND portal.mxid<>'')",
+}, {
+	Name:        "orphaned_disappearing_messages",
+	Description: "Disappearing message timers in rooms that aren't portals",
+	countQuery:  "SELECT COUNT(*) FROM disappearing_message WHERE room_id NOT IN (SELECT mxid FROM portal WHERE mxid IS NOT NULL)",
+	fixQuery:    "DELETE FROM disappearing_message WHERE room_id NOT IN (SELECT mxid FROM portal WHERE mxid IS NOT NULL)",
+}, {
+	// Portals without rooms are normal for chats that haven't been bridged yet, so they're only reported.
+	Name:        "portals_without_rooms",
+	Description: "Portals that don't have a Matrix room",
+	countQuery:  "SELECT COUNT(*) FROM portal WHERE mxid IS NULL OR mxid=''",
+}}
+
+type DoctorResult struct {
+	Check *DoctorCheck
+	Count int64
+	Fixed bool
+}
+
+// Doctor checks the database for known inconsistencies. If fix is true, the inconsistent rows of checks
+// that have a fix are deleted.
+func (db *Database) Doctor(ctx context.Context, fix bool) ([]DoctorResult, error) {
+	results := make([]DoctorResult, 0, len(DoctorChecks))
+	err := db.DoTxn(ctx, nil, func(ctx context.Context) error {
+		for _, check := range DoctorChecks {
+			result := DoctorResult{Check: check}
+			err := db.QueryRow(ctx, check.countQuery).Scan(&result.Count)
+			if err != nil {
+				return fmt.Errorf("failed to run %s check: %w", check.Name, err)
+			}
+			if fix && result.Count > 0 && check.fixQuery != "" {
+				_, err = db.Exec(ctx, check.fixQuery)
+				if err != nil {
+					return fmt.Errorf("failed to fix %s: %w", check.Name, err)
+				}
+				result.Fixed = true
+			}
+			results = append(results, result)
+		}
+		return nil
+	})
+	return results, err
+}
+
+// messageTableMaintenanceQueries are run by Maintain. On Postgres, autovacuum is made more aggressive for the
+// message tables, since the default thresholds scale with table size and rarely trigger on tables with millions
+// of rows, and the planner statistics are refreshed so that lookups keep using the right indexes.
+var messageTableMaintenanceQueries = map[dbutil.Dialect][]string{
+	dbutil.Postgres: {
+		"ALTER TABLE message SET (autovacuum_vacuum_scale_factor = 0.01, autovacuum_analyze_scale_factor = 0.005)",
+		"ALTER TABLE reaction SET (autovacuum_vacuum_scale_factor = 0.01, autovacuum_analyze_scale_factor = 0.005)",
+		"VACUUM (ANALYZE) message",
+		"VACUUM (ANALYZE) reaction",
+	},
+	dbutil.SQLite: {
+		"PRAGMA optimize",
+	},
+}
+
+// Maintain runs routine maintenance on the message mapping tables.
+func (db *Database) Maintain(ctx context.Context) error {
+	for _, query := range messageTableMaintenanceQueries[db.Dialect] {
+		_, err := db.Exec(ctx, query)
+		if err != nil {
+			return fmt.Errorf("failed to run %q: %w", query, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"context"
+
+	"go.mau.fi/util/dbutil"
+
+	"github.com/element-hq/mautrix-go/id"
+)
+
+type LabelQuery struct {
+	*dbutil.QueryHelper[*Label]
+}
+
+func newLabel(qh *dbutil.QueryHelper[*Label]) *Label {
+	return &Label{qh: qh}
+}
+
+func (lq *LabelQuery) New() *Label {
+	return &Label{qh: lq.QueryHelper}
+}
+
+const (
+	getAllLabelsQuery = `
+		SELECT user_mxid, label_id, name, color, deleted FROM whatsapp_label WHERE user_mxid=$1 AND deleted=false ORDER BY name
+	`
+	getLabelByIDQuery = `
+		SELECT user_mxid, label_id, name, color, deleted FROM whatsapp_label WHERE user_mxid=$1 AND label_id=$2
+	`
+	getLabelByNameQuery = `
+		SELECT user_mxid, label_id, name, color, deleted FROM whatsapp_label WHERE user_mxid=$1 AND LOWER(name)=LOWER($2) AND deleted=false
+	`
+	getPortalLabelsQuery = `
+		SELECT whatsapp_label.user_mxid, whatsapp_label.label_id, name, color, deleted
+		FROM portal_label
+		    INNER JOIN whatsapp_label ON portal_label.user_mxid=whatsapp_label.user_mxid AND portal_label.label_id=whatsapp_label.label_id
+		WHERE portal_label.user_mxid=$1 AND portal_jid=$2 AND portal_receiver=$3 AND deleted=false
+		ORDER BY name
+	`
+	getLabelPortalsQuery = `
+		SELECT portal_jid, portal_receiver FROM portal_label WHERE user_mxid=$1 AND label_id=$2
+	`
+	upsertLabelQuery = `
+		INSERT INTO whatsapp_label (user_mxid, label_id, name, color, deleted)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_mxid, label_id) DO UPDATE SET name=excluded.name, color=excluded.color, deleted=excluded.deleted
+	`
+	addPortalLabelQuery = `
+		INSERT INTO portal_label (user_mxid, label_id, portal_jid, portal_receiver)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_mxid, label_id, portal_jid, portal_receiver) DO NOTHING
+	`
+	removePortalLabelQuery      = "DELETE FROM portal_label WHERE user_mxid=$1 AND label_id=$2 AND portal_jid=$3 AND portal_receiver=$4"
+	clearLabelAssociationsQuery = "DELETE FROM portal_label WHERE user_mxid=$1 AND label_id=$2"
+)
+
+func (lq *LabelQuery) GetAll(ctx context.Context, userID id.UserID) ([]*Label, error) {
+	return lq.QueryMany(ctx, getAllLabelsQuery, userID)
+}
+
+func (lq *LabelQuery) GetByID(ctx context.Context, userID id.UserID, labelID string) (*Label, error) {
+	return lq.QueryOne(ctx, getLabelByIDQuery, userID, labelID)
+}
+
+func (lq *LabelQuery) GetByName(ctx context.Context, userID id.UserID, name string) (*Label, error) {
+	return lq.QueryOne(ctx, getLabelByNameQuery, userID, name)
+}
+
+func (lq *LabelQuery) GetForPortal(ctx context.Context, userID id.UserID, portal PortalKey) ([]*Label, error) {
+	return lq.QueryMany(ctx, getPortalLabelsQuery, userID, portal.JID, portal.Receiver)
+}
+
+func (lq *LabelQuery) GetPortals(ctx context.Context, userID id.UserID, labelID string) ([]PortalKey, error) {
+	scanFn := func(rows dbutil.Scannable) (key PortalKey, err error) {
+		err = rows.Scan(&key.JID, &key.Receiver)
+		return
+	}
+	return dbutil.ConvertRowFn[PortalKey](scanFn).
+		NewRowIter(lq.GetDB().Query(ctx, getLabelPortalsQuery, userID, labelID)).
+		AsList()
+}
+
+func (lq *LabelQuery) SetPortalLabel(ctx context.Context, userID id.UserID, labelID string, portal PortalKey, labeled bool) error {
+	query := removePortalLabelQuery
+	if labeled {
+		query = addPortalLabelQuery
+	}
+	return lq.Exec(ctx, query, userID, labelID, portal.JID, portal.Receiver)
+}
+
+// Label is a WhatsApp Business chat label.
+type Label struct {
+	qh *dbutil.QueryHelper[*Label]
+
+	UserMXID id.UserID
+	ID       string
+	Name     string
+	Color    int32
+	Deleted  bool
+}
+
+func (label *Label) Scan(row dbutil.Scannable) (*Label, error) {
+	return dbutil.ValueOrErr(label, row.Scan(&label.UserMXID, &label.ID, &label.Name, &label.Color, &label.Deleted))
+}
+
+func (label *Label) Upsert(ctx context.Context) error {
+	return label.qh.Exec(ctx, upsertLabelQuery, label.UserMXID, label.ID, label.Name, label.Color, label.Deleted)
+}
+
+func (label *Label) ClearAssociations(ctx context.Context) error {
+	return label.qh.Exec(ctx, clearLabelAssociationsQuery, label.UserMXID, label.ID)
+}
@@ -0,0 +1,84 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mau.fi/util/dbutil"
+
+	"github.com/element-hq/mautrix-go/id"
+)
+
+type MediaCacheQuery struct {
+	*dbutil.QueryHelper[*CachedMedia]
+}
+
+func newCachedMedia(qh *dbutil.QueryHelper[*CachedMedia]) *CachedMedia {
+	return &CachedMedia{qh: qh}
+}
+
+func (mcq *MediaCacheQuery) New() *CachedMedia {
+	return &CachedMedia{qh: mcq.QueryHelper}
+}
+
+const (
+	getCachedMediaQuery = `
+		SELECT file_sha256, mxc, mime_type, size, width, height, created_at FROM media_cache WHERE file_sha256=$1
+	`
+	upsertCachedMediaQuery = `
+		INSERT INTO media_cache (file_sha256, mxc, mime_type, size, width, height, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (file_sha256) DO UPDATE
+			SET mxc=excluded.mxc, mime_type=excluded.mime_type, size=excluded.size, width=excluded.width,
+				height=excluded.height, created_at=excluded.created_at
+	`
+)
+
+func (mcq *MediaCacheQuery) Get(ctx context.Context, fileSHA256 string) (*CachedMedia, error) {
+	return mcq.QueryOne(ctx, getCachedMediaQuery, fileSHA256)
+}
+
+// CachedMedia is a previous unencrypted upload of a WhatsApp media file, identified by the hex-encoded SHA-256
+// of the decrypted file.
+type CachedMedia struct {
+	qh *dbutil.QueryHelper[*CachedMedia]
+
+	FileSHA256 string
+	MXC        id.ContentURIString
+	MimeType   string
+	Size       int
+	Width      int
+	Height     int
+	CreatedAt  time.Time
+}
+
+func (cm *CachedMedia) Scan(row dbutil.Scannable) (*CachedMedia, error) {
+	var createdAt int64
+	err := row.Scan(&cm.FileSHA256, &cm.MXC, &cm.MimeType, &cm.Size, &cm.Width, &cm.Height, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+	cm.CreatedAt = time.UnixMilli(createdAt)
+	return cm, nil
+}
+
+func (cm *CachedMedia) Upsert(ctx context.Context) error {
+	return cm.qh.Exec(ctx, upsertCachedMediaQuery,
+		cm.FileSHA256, cm.MXC, cm.MimeType, cm.Size, cm.Width, cm.Height, cm.CreatedAt.UnixMilli())
+}
@@ -0,0 +1,110 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"go.mau.fi/util/dbutil"
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/element-hq/mautrix-go/id"
+)
+
+type MediaRetryQuery struct {
+	*dbutil.QueryHelper[*MediaRetry]
+}
+
+func newMediaRetry(qh *dbutil.QueryHelper[*MediaRetry]) *MediaRetry {
+	return &MediaRetry{qh: qh}
+}
+
+func (mrq *MediaRetryQuery) New() *MediaRetry {
+	return &MediaRetry{qh: mrq.QueryHelper}
+}
+
+const (
+	getMediaRetryQuery = `
+		SELECT chat_jid, chat_receiver, message_id, user_mxid, event_id, meta, attempts, next_attempt, last_error
+		FROM media_retry WHERE chat_jid=$1 AND chat_receiver=$2 AND message_id=$3
+	`
+	getDueMediaRetriesQuery = `
+		SELECT chat_jid, chat_receiver, message_id, user_mxid, event_id, meta, attempts, next_attempt, last_error
+		FROM media_retry WHERE next_attempt<=$1 ORDER BY next_attempt LIMIT $2
+	`
+	upsertMediaRetryQuery = `
+		INSERT INTO media_retry (chat_jid, chat_receiver, message_id, user_mxid, event_id, meta, attempts, next_attempt, last_error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (chat_jid, chat_receiver, message_id)
+		DO UPDATE SET
+			user_mxid=excluded.user_mxid,
+			event_id=excluded.event_id,
+			meta=excluded.meta,
+			attempts=excluded.attempts,
+			next_attempt=excluded.next_attempt,
+			last_error=excluded.last_error
+	`
+	deleteMediaRetryQuery = "DELETE FROM media_retry WHERE chat_jid=$1 AND chat_receiver=$2 AND message_id=$3"
+)
+
+func (mrq *MediaRetryQuery) GetByMessage(ctx context.Context, chat PortalKey, messageID types.MessageID) (*MediaRetry, error) {
+	return mrq.QueryOne(ctx, getMediaRetryQuery, chat.JID, chat.Receiver, messageID)
+}
+
+func (mrq *MediaRetryQuery) GetDue(ctx context.Context, limit int) ([]*MediaRetry, error) {
+	return mrq.QueryMany(ctx, getDueMediaRetriesQuery, time.Now().UnixMilli(), limit)
+}
+
+// MediaRetry is a media message that failed to download, which should be periodically re-requested from the phone.
+type MediaRetry struct {
+	qh *dbutil.QueryHelper[*MediaRetry]
+
+	Chat        PortalKey
+	MessageID   types.MessageID
+	UserMXID    id.UserID
+	EventID     id.EventID
+	Meta        []byte
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string
+}
+
+func (mr *MediaRetry) Scan(row dbutil.Scannable) (*MediaRetry, error) {
+	var nextAttempt int64
+	var lastError sql.NullString
+	err := row.Scan(&mr.Chat.JID, &mr.Chat.Receiver, &mr.MessageID, &mr.UserMXID, &mr.EventID, &mr.Meta, &mr.Attempts, &nextAttempt, &lastError)
+	if err != nil {
+		return nil, err
+	}
+	mr.NextAttempt = time.UnixMilli(nextAttempt)
+	mr.LastError = lastError.String
+	return mr, nil
+}
+
+func (mr *MediaRetry) sqlVariables() []any {
+	return []any{mr.Chat.JID, mr.Chat.Receiver, mr.MessageID, mr.UserMXID, mr.EventID, string(mr.Meta), mr.Attempts, mr.NextAttempt.UnixMilli(), dbutil.StrPtr(mr.LastError)}
+}
+
+func (mr *MediaRetry) Upsert(ctx context.Context) error {
+	return mr.qh.Exec(ctx, upsertMediaRetryQuery, mr.sqlVariables()...)
+}
+
+func (mr *MediaRetry) Delete(ctx context.Context) error {
+	return mr.qh.Exec(ctx, deleteMediaRetryQuery, mr.Chat.JID, mr.Chat.Receiver, mr.MessageID)
+}
@@ -38,43 +38,154 @@ func newMessage(qh *dbutil.QueryHelper[*Message]) *Message {
 
 const (
 	getAllMessagesQuery = `
-		SELECT chat_jid, chat_receiver, jid, mxid, sender, sender_mxid, timestamp, sent, type, error, broadcast_list_jid FROM message
+		SELECT chat_jid, chat_receiver, jid, mxid, sender, sender_mxid, timestamp, sent, type, error, broadcast_list_jid, failure_reason FROM message
 		WHERE chat_jid=$1 AND chat_receiver=$2
 	`
 	getMessageByJIDQuery = `
-		SELECT chat_jid, chat_receiver, jid, mxid, sender, sender_mxid, timestamp, sent, type, error, broadcast_list_jid FROM message
+		SELECT chat_jid, chat_receiver, jid, mxid, sender, sender_mxid, timestamp, sent, type, error, broadcast_list_jid, failure_reason FROM message
 		WHERE chat_jid=$1 AND chat_receiver=$2 AND jid=$3
 	`
 	getMessageByMXIDQuery = `
-		SELECT chat_jid, chat_receiver, jid, mxid, sender, sender_mxid, timestamp, sent, type, error, broadcast_list_jid FROM message
+		SELECT chat_jid, chat_receiver, jid, mxid, sender, sender_mxid, timestamp, sent, type, error, broadcast_list_jid, failure_reason FROM message
 		WHERE mxid=$1
 	`
 	getLastMessageInChatQuery = `
-		SELECT chat_jid, chat_receiver, jid, mxid, sender, sender_mxid, timestamp, sent, type, error, broadcast_list_jid FROM message
+		SELECT chat_jid, chat_receiver, jid, mxid, sender, sender_mxid, timestamp, sent, type, error, broadcast_list_jid, failure_reason FROM message
 		WHERE chat_jid=$1 AND chat_receiver=$2 AND timestamp<=$3 AND sent=true ORDER BY timestamp DESC LIMIT 1
 	`
 	getFirstMessageInChatQuery = `
-		SELECT chat_jid, chat_receiver, jid, mxid, sender, sender_mxid, timestamp, sent, type, error, broadcast_list_jid FROM message
+		SELECT chat_jid, chat_receiver, jid, mxid, sender, sender_mxid, timestamp, sent, type, error, broadcast_list_jid, failure_reason FROM message
 		WHERE chat_jid=$1 AND chat_receiver=$2 AND sent=true ORDER BY timestamp ASC LIMIT 1
 	`
 	getMessagesBetweenQuery = `
-		SELECT chat_jid, chat_receiver, jid, mxid, sender, sender_mxid, timestamp, sent, type, error, broadcast_list_jid FROM message
+		SELECT chat_jid, chat_receiver, jid, mxid, sender, sender_mxid, timestamp, sent, type, error, broadcast_list_jid, failure_reason FROM message
 		WHERE chat_jid=$1 AND chat_receiver=$2 AND timestamp>$3 AND timestamp<=$4 AND sent=true AND error='' ORDER BY timestamp ASC
 	`
+	getLastMessagesInChatQuery = `
+		SELECT chat_jid, chat_receiver, jid, mxid, sender, sender_mxid, timestamp, sent, type, error, broadcast_list_jid, failure_reason FROM message
+		WHERE chat_jid=$1 AND chat_receiver=$2 AND mxid<>'' AND sent=true ORDER BY timestamp DESC LIMIT $3
+	`
 	insertMessageQuery = `
 		INSERT INTO message
 			(chat_jid, chat_receiver, jid, mxid, sender, sender_mxid, timestamp, sent, type, error, broadcast_list_jid)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 	`
-	markMessageSentQuery   = "UPDATE message SET sent=true, timestamp=$1 WHERE chat_jid=$2 AND chat_receiver=$3 AND jid=$4"
-	updateMessageMXIDQuery = "UPDATE message SET mxid=$1, type=$2, error=$3 WHERE chat_jid=$4 AND chat_receiver=$5 AND jid=$6"
-	deleteMessageQuery     = "DELETE FROM message WHERE chat_jid=$1 AND chat_receiver=$2 AND jid=$3"
+	markMessageSentQuery         = "UPDATE message SET sent=true, timestamp=$1, failure_reason='' WHERE chat_jid=$2 AND chat_receiver=$3 AND jid=$4"
+	updateMessageMXIDQuery       = "UPDATE message SET mxid=$1, type=$2, error=$3 WHERE chat_jid=$4 AND chat_receiver=$5 AND jid=$6"
+	setMessageFailureReasonQuery = "UPDATE message SET failure_reason=$1 WHERE mxid=$2 AND sent=false"
+	deleteMessageQuery           = "DELETE FROM message WHERE chat_jid=$1 AND chat_receiver=$2 AND jid=$3"
+
+	// The newest message in each chat and Matrix polls are never pruned, as they're needed for
+	// backfilling and for bridging poll votes. Reactions are deleted along with their target message.
+	pruneMessagesCondition = `
+		WHERE m.timestamp<$1 AND m.type<>'matrix-poll'
+		  AND m.timestamp<(SELECT MAX(m2.timestamp) FROM message m2 WHERE m2.chat_jid=m.chat_jid AND m2.chat_receiver=m.chat_receiver)
+	`
+	pruneDisappearingChatCondition = `
+		  AND EXISTS(SELECT 1 FROM portal WHERE portal.jid=m.chat_jid AND portal.receiver=m.chat_receiver AND portal.expiration_time>0)
+	`
+	pruneMessagesQueryTemplate = `
+		DELETE FROM message
+		WHERE (chat_jid, chat_receiver, jid) IN (
+			SELECT m.chat_jid, m.chat_receiver, m.jid FROM message m
+			%s
+			LIMIT $2
+		)
+	`
+
+	deleteChatReactionsQuery = "DELETE FROM reaction WHERE chat_jid=$1 AND chat_receiver=$2"
+	moveChatMessagesQuery    = `
+		UPDATE message SET chat_jid=$3, chat_receiver=$4
+		WHERE chat_jid=$1 AND chat_receiver=$2
+		  AND jid NOT IN (SELECT jid FROM message WHERE chat_jid=$3 AND chat_receiver=$4)
+	`
 )
 
 func (mq *MessageQuery) GetAll(ctx context.Context, chat PortalKey) ([]*Message, error) {
 	return mq.QueryMany(ctx, getAllMessagesQuery, chat.JID, chat.Receiver)
 }
 
+const (
+	bulkInsertMessageQueryPrefix = `
+		INSERT INTO message
+			(chat_jid, chat_receiver, jid, mxid, sender, sender_mxid, timestamp, sent, type, error, broadcast_list_jid)
+		VALUES
+	`
+	bulkInsertMessageQuerySuffix = " ON CONFLICT (chat_jid, chat_receiver, jid) DO NOTHING"
+
+	// bulkInsertChunkSize is the number of rows inserted per statement in BulkInsert.
+	// Each row has 11 parameters, so this stays under SQLite's default limit of 999 parameters.
+	bulkInsertChunkSize = 90
+)
+
+// BulkInsert inserts many messages using multi-row INSERT statements, which is significantly faster than
+// inserting them one by one when backfilling large chats. Messages that already exist are skipped.
+func (mq *MessageQuery) BulkInsert(ctx context.Context, msgs []*Message) error {
+	for len(msgs) > 0 {
+		chunk := msgs[:min(len(msgs), bulkInsertChunkSize)]
+		msgs = msgs[len(chunk):]
+		var query strings.Builder
+		query.WriteString(bulkInsertMessageQueryPrefix)
+		params := make([]any, 0, len(chunk)*11)
+		for i, msg := range chunk {
+			if i > 0 {
+				query.WriteByte(',')
+			}
+			query.WriteByte('(')
+			for j := 0; j < 11; j++ {
+				if j > 0 {
+					query.WriteByte(',')
+				}
+				_, _ = fmt.Fprintf(&query, "$%d", len(params)+j+1)
+			}
+			query.WriteByte(')')
+			params = append(params, msg.sqlVariables()...)
+		}
+		query.WriteString(bulkInsertMessageQuerySuffix)
+		_, err := mq.GetDB().Exec(ctx, query.String(), params...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	pruneMessagesQuery                 = fmt.Sprintf(pruneMessagesQueryTemplate, pruneMessagesCondition)
+	pruneDisappearingChatMessagesQuery = fmt.Sprintf(pruneMessagesQueryTemplate, pruneMessagesCondition+pruneDisappearingChatCondition)
+)
+
+// Prune deletes up to limit message mappings older than the given time and returns the number of deleted rows.
+// If onlyDisappearing is true, only chats with disappearing messages enabled are pruned.
+func (mq *MessageQuery) Prune(ctx context.Context, olderThan time.Time, onlyDisappearing bool, limit int) (int64, error) {
+	query := pruneMessagesQuery
+	if onlyDisappearing {
+		query = pruneDisappearingChatMessagesQuery
+	}
+	res, err := mq.GetDB().Exec(ctx, query, olderThan.Unix(), limit)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// MoveToChat moves all message mappings from one chat to another. Messages that already exist in the
+// target chat are left behind. Reaction mappings of the source chat are dropped, as they can't be moved
+// without breaking the foreign key to the message table.
+func (mq *MessageQuery) MoveToChat(ctx context.Context, from, to PortalKey) error {
+	return mq.GetDB().DoTxn(ctx, nil, func(ctx context.Context) error {
+		_, err := mq.GetDB().Exec(ctx, deleteChatReactionsQuery, from.JID, from.Receiver)
+		if err != nil {
+			return fmt.Errorf("failed to delete reactions: %w", err)
+		}
+		_, err = mq.GetDB().Exec(ctx, moveChatMessagesQuery, from.JID, from.Receiver, to.JID, to.Receiver)
+		if err != nil {
+			return fmt.Errorf("failed to move messages: %w", err)
+		}
+		return nil
+	})
+}
+
 func (mq *MessageQuery) GetByJID(ctx context.Context, chat PortalKey, jid types.MessageID) (*Message, error) {
 	return mq.QueryOne(ctx, getMessageByJIDQuery, chat.JID, chat.Receiver, jid)
 }
@@ -83,6 +194,12 @@ func (mq *MessageQuery) GetByMXID(ctx context.Context, mxid id.EventID) (*Messag
 	return mq.QueryOne(ctx, getMessageByMXIDQuery, mxid)
 }
 
+// SetFailureReason stores the reason why sending the given Matrix event to WhatsApp failed.
+// Messages that have already been sent are not affected.
+func (mq *MessageQuery) SetFailureReason(ctx context.Context, mxid id.EventID, reason string) error {
+	return mq.Exec(ctx, setMessageFailureReasonQuery, reason, mxid)
+}
+
 func (mq *MessageQuery) GetLastInChat(ctx context.Context, chat PortalKey) (*Message, error) {
 	return mq.GetLastInChatBefore(ctx, chat, time.Now().Add(60*time.Second))
 }
@@ -96,6 +213,11 @@ func (mq *MessageQuery) GetLastInChatBefore(ctx context.Context, chat PortalKey,
 	return msg, err
 }
 
+// GetLastNInChat returns the latest sent messages in the chat, newest first.
+func (mq *MessageQuery) GetLastNInChat(ctx context.Context, chat PortalKey, limit int) ([]*Message, error) {
+	return mq.QueryMany(ctx, getLastMessagesInChatQuery, chat.JID, chat.Receiver, limit)
+}
+
 func (mq *MessageQuery) GetFirstInChat(ctx context.Context, chat PortalKey) (*Message, error) {
 	return mq.QueryOne(ctx, getFirstMessageInChatQuery, chat.JID, chat.Receiver)
 }
@@ -140,6 +262,9 @@ type Message struct {
 	GalleryPart int
 
 	BroadcastListJID types.JID
+	// FailureReason is the error from the last failed attempt to send a Matrix message to WhatsApp.
+	// It's not included in inserts, as new messages haven't failed yet.
+	FailureReason string
 }
 
 func (msg *Message) IsFakeMXID() bool {
@@ -154,7 +279,7 @@ const fakeGalleryMXIDFormat = "com.beeper.gallery::%d:%s"
 
 func (msg *Message) Scan(row dbutil.Scannable) (*Message, error) {
 	var ts int64
-	err := row.Scan(&msg.Chat.JID, &msg.Chat.Receiver, &msg.JID, &msg.MXID, &msg.Sender, &msg.SenderMXID, &ts, &msg.Sent, &msg.Type, &msg.Error, &msg.BroadcastListJID)
+	err := row.Scan(&msg.Chat.JID, &msg.Chat.Receiver, &msg.JID, &msg.MXID, &msg.Sender, &msg.SenderMXID, &ts, &msg.Sent, &msg.Type, &msg.Error, &msg.BroadcastListJID, &msg.FailureReason)
 	if err != nil {
 		return nil, err
 	}
@@ -185,6 +310,7 @@ func (msg *Message) Insert(ctx context.Context) error {
 func (msg *Message) MarkSent(ctx context.Context, ts time.Time) error {
 	msg.Sent = true
 	msg.Timestamp = ts
+	msg.FailureReason = ""
 	return msg.qh.Exec(ctx, markMessageSentQuery, ts.Unix(), msg.Chat.JID, msg.Chat.Receiver, msg.JID)
 }
 
@@ -0,0 +1,104 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mau.fi/util/dbutil"
+
+	"github.com/element-hq/mautrix-go/id"
+)
+
+type OutgoingQueueQuery struct {
+	*dbutil.QueryHelper[*QueuedMessage]
+}
+
+func newQueuedMessage(qh *dbutil.QueryHelper[*QueuedMessage]) *QueuedMessage {
+	return &QueuedMessage{qh: qh}
+}
+
+func (oqq *OutgoingQueueQuery) New() *QueuedMessage {
+	return &QueuedMessage{qh: oqq.QueryHelper}
+}
+
+const (
+	getQueuedMessagesForUserQuery = `
+		SELECT event_id, room_id, user_mxid, notice_id, queued_at, attempts, next_attempt FROM outgoing_queue
+		WHERE user_mxid=$1 ORDER BY queued_at ASC
+	`
+	countQueuedMessagesForUserQuery       = "SELECT COUNT(*) FROM outgoing_queue WHERE user_mxid=$1"
+	countQueuedMessagesForUserInRoomQuery = "SELECT COUNT(*) FROM outgoing_queue WHERE user_mxid=$1 AND room_id=$2"
+	upsertQueuedMessageQuery              = `
+		INSERT INTO outgoing_queue (event_id, room_id, user_mxid, event, notice_id, queued_at, attempts, next_attempt)
+		VALUES ($1, $2, $3, '', $4, $5, $6, $7)
+		ON CONFLICT (event_id) DO UPDATE
+			SET notice_id=excluded.notice_id, attempts=excluded.attempts, next_attempt=excluded.next_attempt
+	`
+	deleteQueuedMessageQuery = "DELETE FROM outgoing_queue WHERE event_id=$1"
+)
+
+func (oqq *OutgoingQueueQuery) GetAllForUser(ctx context.Context, userID id.UserID) ([]*QueuedMessage, error) {
+	return oqq.QueryMany(ctx, getQueuedMessagesForUserQuery, userID)
+}
+
+func (oqq *OutgoingQueueQuery) CountForUser(ctx context.Context, userID id.UserID) (count int, err error) {
+	err = oqq.GetDB().QueryRow(ctx, countQueuedMessagesForUserQuery, userID).Scan(&count)
+	return
+}
+
+func (oqq *OutgoingQueueQuery) CountForUserInRoom(ctx context.Context, userID id.UserID, roomID id.RoomID) (count int, err error) {
+	err = oqq.GetDB().QueryRow(ctx, countQueuedMessagesForUserInRoomQuery, userID, roomID).Scan(&count)
+	return
+}
+
+// QueuedMessage is a Matrix event that couldn't be sent because the sender wasn't connected to WhatsApp.
+// Only the event ID is stored so that the plaintext of encrypted messages isn't kept at rest; the event
+// is fetched from the homeserver again when it's retried. NoticeID is the error notice that is edited or
+// redacted once the message is finally handled.
+type QueuedMessage struct {
+	qh *dbutil.QueryHelper[*QueuedMessage]
+
+	EventID     id.EventID
+	RoomID      id.RoomID
+	UserID      id.UserID
+	NoticeID    id.EventID
+	QueuedAt    time.Time
+	Attempts    int
+	NextAttempt time.Time
+}
+
+func (qm *QueuedMessage) Scan(row dbutil.Scannable) (*QueuedMessage, error) {
+	var queuedAt, nextAttempt int64
+	err := row.Scan(&qm.EventID, &qm.RoomID, &qm.UserID, &qm.NoticeID, &queuedAt, &qm.Attempts, &nextAttempt)
+	if err != nil {
+		return nil, err
+	}
+	qm.QueuedAt = time.UnixMilli(queuedAt)
+	qm.NextAttempt = time.UnixMilli(nextAttempt)
+	return qm, nil
+}
+
+func (qm *QueuedMessage) Upsert(ctx context.Context) error {
+	return qm.qh.Exec(ctx, upsertQueuedMessageQuery,
+		qm.EventID, qm.RoomID, qm.UserID, qm.NoticeID, qm.QueuedAt.UnixMilli(), qm.Attempts, qm.NextAttempt.UnixMilli())
+}
+
+func (qm *QueuedMessage) Delete(ctx context.Context) error {
+	return qm.qh.Exec(ctx, deleteQueuedMessageQuery, qm.EventID)
+}
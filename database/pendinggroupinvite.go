@@ -0,0 +1,102 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mau.fi/util/dbutil"
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/element-hq/mautrix-go/id"
+)
+
+type PendingGroupInviteQuery struct {
+	*dbutil.QueryHelper[*PendingGroupInvite]
+}
+
+func newPendingGroupInvite(qh *dbutil.QueryHelper[*PendingGroupInvite]) *PendingGroupInvite {
+	return &PendingGroupInvite{qh: qh}
+}
+
+func (pgiq *PendingGroupInviteQuery) New() *PendingGroupInvite {
+	return &PendingGroupInvite{qh: pgiq.QueryHelper}
+}
+
+const (
+	getPendingGroupInvitesBaseQuery = `
+		SELECT user_mxid, group_jid, notice_mxid, group_name, expires_at FROM pending_group_invite
+	`
+	getPendingGroupInviteQuery         = getPendingGroupInvitesBaseQuery + " WHERE user_mxid=$1 AND group_jid=$2"
+	getPendingGroupInviteByNoticeQuery = getPendingGroupInvitesBaseQuery + " WHERE user_mxid=$1 AND notice_mxid=$2"
+	getAllPendingGroupInvitesQuery     = getPendingGroupInvitesBaseQuery + " WHERE user_mxid=$1 ORDER BY expires_at"
+	getExpiredPendingGroupInvitesQuery = getPendingGroupInvitesBaseQuery + " WHERE expires_at<$1"
+	upsertPendingGroupInviteQuery      = `
+		INSERT INTO pending_group_invite (user_mxid, group_jid, notice_mxid, group_name, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_mxid, group_jid) DO UPDATE
+			SET notice_mxid=excluded.notice_mxid, group_name=excluded.group_name, expires_at=excluded.expires_at
+	`
+	deletePendingGroupInviteQuery = "DELETE FROM pending_group_invite WHERE user_mxid=$1 AND group_jid=$2"
+)
+
+func (pgiq *PendingGroupInviteQuery) Get(ctx context.Context, userID id.UserID, group types.JID) (*PendingGroupInvite, error) {
+	return pgiq.QueryOne(ctx, getPendingGroupInviteQuery, userID, group)
+}
+
+func (pgiq *PendingGroupInviteQuery) GetByNotice(ctx context.Context, userID id.UserID, noticeID id.EventID) (*PendingGroupInvite, error) {
+	return pgiq.QueryOne(ctx, getPendingGroupInviteByNoticeQuery, userID, noticeID)
+}
+
+func (pgiq *PendingGroupInviteQuery) GetAll(ctx context.Context, userID id.UserID) ([]*PendingGroupInvite, error) {
+	return pgiq.QueryMany(ctx, getAllPendingGroupInvitesQuery, userID)
+}
+
+func (pgiq *PendingGroupInviteQuery) GetExpired(ctx context.Context) ([]*PendingGroupInvite, error) {
+	return pgiq.QueryMany(ctx, getExpiredPendingGroupInvitesQuery, time.Now().Unix())
+}
+
+// PendingGroupInvite is a WhatsApp group the user was added to, which is waiting for the user to decide
+// whether it should be bridged.
+type PendingGroupInvite struct {
+	qh *dbutil.QueryHelper[*PendingGroupInvite]
+
+	UserMXID   id.UserID
+	GroupJID   types.JID
+	NoticeMXID id.EventID
+	GroupName  string
+	ExpiresAt  time.Time
+}
+
+func (pgi *PendingGroupInvite) Scan(row dbutil.Scannable) (*PendingGroupInvite, error) {
+	var expiresAt int64
+	err := row.Scan(&pgi.UserMXID, &pgi.GroupJID, &pgi.NoticeMXID, &pgi.GroupName, &expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	pgi.ExpiresAt = time.Unix(expiresAt, 0)
+	return pgi, nil
+}
+
+func (pgi *PendingGroupInvite) Upsert(ctx context.Context) error {
+	return pgi.qh.Exec(ctx, upsertPendingGroupInviteQuery, pgi.UserMXID, pgi.GroupJID, pgi.NoticeMXID, pgi.GroupName, pgi.ExpiresAt.Unix())
+}
+
+func (pgi *PendingGroupInvite) Delete(ctx context.Context) error {
+	return pgi.qh.Exec(ctx, deletePendingGroupInviteQuery, pgi.UserMXID, pgi.GroupJID)
+}
@@ -0,0 +1,98 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"go.mau.fi/util/dbutil"
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/element-hq/mautrix-go/id"
+)
+
+type PinnedMessageQuery struct {
+	*dbutil.QueryHelper[*PinnedMessage]
+}
+
+func newPinnedMessage(qh *dbutil.QueryHelper[*PinnedMessage]) *PinnedMessage {
+	return &PinnedMessage{qh: qh}
+}
+
+func (pmq *PinnedMessageQuery) New() *PinnedMessage {
+	return &PinnedMessage{qh: pmq.QueryHelper}
+}
+
+const (
+	getPinnedMessagesBaseQuery = `
+		SELECT chat_jid, chat_receiver, message_id, mxid, expires_at FROM pinned_message
+	`
+	getPinnedMessageQuery          = getPinnedMessagesBaseQuery + " WHERE chat_jid=$1 AND chat_receiver=$2 AND message_id=$3"
+	getUpcomingExpiringPinnedQuery = getPinnedMessagesBaseQuery + " WHERE expires_at IS NOT NULL AND expires_at<=$1"
+	upsertPinnedMessageQuery       = `
+		INSERT INTO pinned_message (chat_jid, chat_receiver, message_id, mxid, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (chat_jid, chat_receiver, message_id) DO UPDATE
+			SET mxid=excluded.mxid, expires_at=excluded.expires_at
+	`
+	deletePinnedMessageQuery = "DELETE FROM pinned_message WHERE chat_jid=$1 AND chat_receiver=$2 AND message_id=$3"
+)
+
+func (pmq *PinnedMessageQuery) Get(ctx context.Context, chat PortalKey, messageID types.MessageID) (*PinnedMessage, error) {
+	return pmq.QueryOne(ctx, getPinnedMessageQuery, chat.JID, chat.Receiver, messageID)
+}
+
+// GetUpcomingExpiring returns timed pins that expire within the given duration.
+func (pmq *PinnedMessageQuery) GetUpcomingExpiring(ctx context.Context, duration time.Duration) ([]*PinnedMessage, error) {
+	return pmq.QueryMany(ctx, getUpcomingExpiringPinnedQuery, time.Now().Add(duration).Unix())
+}
+
+// PinnedMessage is a message that is pinned in a WhatsApp chat. ExpiresAt is zero for pins that don't expire.
+type PinnedMessage struct {
+	qh *dbutil.QueryHelper[*PinnedMessage]
+
+	Chat      PortalKey
+	MessageID types.MessageID
+	MXID      id.EventID
+	ExpiresAt time.Time
+}
+
+func (pm *PinnedMessage) Scan(row dbutil.Scannable) (*PinnedMessage, error) {
+	var expiresAt sql.NullInt64
+	err := row.Scan(&pm.Chat.JID, &pm.Chat.Receiver, &pm.MessageID, &pm.MXID, &expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		pm.ExpiresAt = time.Unix(expiresAt.Int64, 0)
+	}
+	return pm, nil
+}
+
+func (pm *PinnedMessage) Upsert(ctx context.Context) error {
+	var expiresAt sql.NullInt64
+	if !pm.ExpiresAt.IsZero() {
+		expiresAt = sql.NullInt64{Int64: pm.ExpiresAt.Unix(), Valid: true}
+	}
+	return pm.qh.Exec(ctx, upsertPinnedMessageQuery, pm.Chat.JID, pm.Chat.Receiver, pm.MessageID, pm.MXID, expiresAt)
+}
+
+func (pm *PinnedMessage) Delete(ctx context.Context) error {
+	return pm.qh.Exec(ctx, deletePinnedMessageQuery, pm.Chat.JID, pm.Chat.Receiver, pm.MessageID)
+}
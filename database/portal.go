@@ -19,6 +19,8 @@ package database
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"go.mau.fi/whatsmeow/types"
@@ -66,7 +68,8 @@ const (
 	getAllPortalsQuery = `
 		SELECT jid, receiver, mxid, name, name_set, topic, topic_set, avatar, avatar_url, avatar_set,
 		       encrypted, last_sync, is_parent, parent_group, in_space,
-		       first_event_id, next_batch_id, relay_user_id, expiration_time
+		       first_event_id, next_batch_id, relay_user_id, expiration_time, relay_formats, is_default_subgroup,
+		       keep_disappearing, translate_incoming, translate_outgoing, locale, history_visibility, key_share_count
 		FROM portal
 	`
 	getPortalByJIDQuery                   = getAllPortalsQuery + " WHERE jid=$1 AND receiver=$2"
@@ -84,14 +87,17 @@ const (
 		INSERT INTO portal (
 			jid, receiver, mxid, name, name_set, topic, topic_set, avatar, avatar_url, avatar_set,
 			encrypted, last_sync, is_parent, parent_group, in_space,
-			first_event_id, next_batch_id, relay_user_id, expiration_time
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
+			first_event_id, next_batch_id, relay_user_id, expiration_time, relay_formats, is_default_subgroup,
+			keep_disappearing, translate_incoming, translate_outgoing, locale, history_visibility, key_share_count
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27)
 	`
 	updatePortalQuery = `
 		UPDATE portal
 		SET mxid=$3, name=$4, name_set=$5, topic=$6, topic_set=$7, avatar=$8, avatar_url=$9, avatar_set=$10,
 		    encrypted=$11, last_sync=$12, is_parent=$13, parent_group=$14, in_space=$15,
-		    first_event_id=$16, next_batch_id=$17, relay_user_id=$18, expiration_time=$19
+		    first_event_id=$16, next_batch_id=$17, relay_user_id=$18, expiration_time=$19, relay_formats=$20,
+		    is_default_subgroup=$21, keep_disappearing=$22, translate_incoming=$23, translate_outgoing=$24,
+		    locale=$25, history_visibility=$26, key_share_count=$27
 		WHERE jid=$1 AND receiver=$2
 	`
 	clearPortalInSpaceQuery = "UPDATE portal SET in_space=false WHERE parent_group=$1"
@@ -153,21 +159,39 @@ type Portal struct {
 	IsParent    bool
 	ParentGroup types.JID
 	InSpace     bool
+	// IsDefaultSubgroup is true for the announcement group of a community.
+	IsDefaultSubgroup bool
 
 	FirstEventID   id.EventID
 	NextBatchID    id.BatchID
 	RelayUserID    id.UserID
 	ExpirationTime uint32
+	// RelayFormats contains per-portal overrides for the relaybot message format templates, keyed by msgtype.
+	RelayFormats map[string]string
+	// KeepDisappearing disables removing disappearing messages from the Matrix room when they expire.
+	KeepDisappearing bool
+	// TranslateIncoming and TranslateOutgoing are the target languages for translating messages in each direction.
+	TranslateIncoming string
+	TranslateOutgoing string
+	// Locale is the language of bridge notices in the room. Empty means the user's locale is used.
+	Locale string
+	// HistoryVisibility overrides the configured Matrix history visibility of the room. Empty means the default.
+	HistoryVisibility string
+	// KeyShareCount is the number of recent messages whose encryption keys are shared with newly joined
+	// Matrix users. Zero means the config default is used and negative values disable sharing.
+	KeyShareCount int
 }
 
 func (portal *Portal) Scan(row dbutil.Scannable) (*Portal, error) {
-	var mxid, avatarURL, firstEventID, nextBatchID, relayUserID, parentGroupJID sql.NullString
+	var mxid, avatarURL, firstEventID, nextBatchID, relayUserID, parentGroupJID, relayFormats sql.NullString
 	var lastSyncTs int64
 	err := row.Scan(
 		&portal.Key.JID, &portal.Key.Receiver, &mxid, &portal.Name, &portal.NameSet,
 		&portal.Topic, &portal.TopicSet, &portal.Avatar, &avatarURL, &portal.AvatarSet, &portal.Encrypted,
 		&lastSyncTs, &portal.IsParent, &parentGroupJID, &portal.InSpace,
-		&firstEventID, &nextBatchID, &relayUserID, &portal.ExpirationTime,
+		&firstEventID, &nextBatchID, &relayUserID, &portal.ExpirationTime, &relayFormats,
+		&portal.IsDefaultSubgroup, &portal.KeepDisappearing, &portal.TranslateIncoming, &portal.TranslateOutgoing,
+		&portal.Locale, &portal.HistoryVisibility, &portal.KeyShareCount,
 	)
 	if err != nil {
 		return nil, err
@@ -183,6 +207,12 @@ func (portal *Portal) Scan(row dbutil.Scannable) (*Portal, error) {
 	portal.FirstEventID = id.EventID(firstEventID.String)
 	portal.NextBatchID = id.BatchID(nextBatchID.String)
 	portal.RelayUserID = id.UserID(relayUserID.String)
+	if relayFormats.Valid && relayFormats.String != "" {
+		err = json.Unmarshal([]byte(relayFormats.String), &portal.RelayFormats)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse relay formats: %w", err)
+		}
+	}
 	return portal, nil
 }
 
@@ -191,11 +221,18 @@ func (portal *Portal) sqlVariables() []any {
 	if !portal.LastSync.IsZero() {
 		lastSyncTS = portal.LastSync.Unix()
 	}
+	var relayFormats *string
+	if len(portal.RelayFormats) > 0 {
+		relayFormatsBytes, _ := json.Marshal(portal.RelayFormats)
+		relayFormats = dbutil.StrPtr(string(relayFormatsBytes))
+	}
 	return []any{
 		portal.Key.JID, portal.Key.Receiver, dbutil.StrPtr(portal.MXID), portal.Name, portal.NameSet,
 		portal.Topic, portal.TopicSet, portal.Avatar, portal.AvatarURL.String(), portal.AvatarSet, portal.Encrypted,
 		lastSyncTS, portal.IsParent, dbutil.StrPtr(portal.ParentGroup.String()), portal.InSpace,
-		portal.FirstEventID.String(), portal.NextBatchID.String(), dbutil.StrPtr(portal.RelayUserID), portal.ExpirationTime,
+		portal.FirstEventID.String(), portal.NextBatchID.String(), dbutil.StrPtr(portal.RelayUserID), portal.ExpirationTime, relayFormats,
+		portal.IsDefaultSubgroup, portal.KeepDisappearing, portal.TranslateIncoming, portal.TranslateOutgoing,
+		portal.Locale, portal.HistoryVisibility, portal.KeyShareCount,
 	}
 }
 
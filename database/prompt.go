@@ -0,0 +1,93 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mau.fi/util/dbutil"
+
+	"github.com/element-hq/mautrix-go/id"
+)
+
+// PromptType identifies what answering a bridge prompt does.
+type PromptType string
+
+type PromptQuery struct {
+	*dbutil.QueryHelper[*Prompt]
+}
+
+func newPrompt(qh *dbutil.QueryHelper[*Prompt]) *Prompt {
+	return &Prompt{qh: qh}
+}
+
+func (pq *PromptQuery) New() *Prompt {
+	return &Prompt{qh: pq.QueryHelper}
+}
+
+const (
+	getPromptQuery = `
+		SELECT event_id, room_id, user_mxid, type, data, expires_at FROM bridge_prompt
+		WHERE event_id=$1 AND user_mxid=$2 AND expires_at>=$3
+	`
+	insertPromptQuery = `
+		INSERT INTO bridge_prompt (event_id, room_id, user_mxid, type, data, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	deletePromptQuery         = "DELETE FROM bridge_prompt WHERE event_id=$1"
+	deleteExpiredPromptsQuery = "DELETE FROM bridge_prompt WHERE expires_at<$1"
+)
+
+// Get finds an unexpired prompt that the given user can answer.
+func (pq *PromptQuery) Get(ctx context.Context, eventID id.EventID, userID id.UserID) (*Prompt, error) {
+	return pq.QueryOne(ctx, getPromptQuery, eventID, userID, time.Now().Unix())
+}
+
+func (pq *PromptQuery) DeleteExpired(ctx context.Context) error {
+	return pq.Exec(ctx, deleteExpiredPromptsQuery, time.Now().Unix())
+}
+
+// Prompt is a bridge notice that a user can answer by reacting to it.
+type Prompt struct {
+	qh *dbutil.QueryHelper[*Prompt]
+
+	EventID   id.EventID
+	RoomID    id.RoomID
+	UserMXID  id.UserID
+	Type      PromptType
+	Data      string
+	ExpiresAt time.Time
+}
+
+func (p *Prompt) Scan(row dbutil.Scannable) (*Prompt, error) {
+	var expiresAt int64
+	err := row.Scan(&p.EventID, &p.RoomID, &p.UserMXID, &p.Type, &p.Data, &expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	p.ExpiresAt = time.Unix(expiresAt, 0)
+	return p, nil
+}
+
+func (p *Prompt) Insert(ctx context.Context) error {
+	return p.qh.Exec(ctx, insertPromptQuery, p.EventID, p.RoomID, p.UserMXID, p.Type, p.Data, p.ExpiresAt.Unix())
+}
+
+func (p *Prompt) Delete(ctx context.Context) error {
+	return p.qh.Exec(ctx, deletePromptQuery, p.EventID)
+}
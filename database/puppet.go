@@ -44,22 +44,24 @@ func newPuppet(qh *dbutil.QueryHelper[*Puppet]) *Puppet {
 
 const (
 	getAllPuppetsQuery = `
-		SELECT username, avatar, avatar_url, displayname, name_quality, name_set, avatar_set, contact_info_set,
+		SELECT username, avatar, avatar_url, displayname, name_quality, name_template, name_set, avatar_set, contact_info_set,
 		       last_sync, custom_mxid, access_token, next_batch, enable_presence, enable_receipts, first_activity_ts, last_activity_ts
 		FROM puppet
 	`
 	getPuppetByJIDQuery              = getAllPuppetsQuery + " WHERE username=$1"
 	getPuppetByCustomMXIDQuery       = getAllPuppetsQuery + " WHERE custom_mxid=$1"
 	getAllPuppetsWithCustomMXIDQuery = getAllPuppetsQuery + " WHERE custom_mxid<>''"
+	getAllPuppetsWithActivityQuery   = getAllPuppetsQuery + " WHERE first_activity_ts IS NOT NULL ORDER BY last_activity_ts DESC"
 	insertPuppetQuery                = `
 		INSERT INTO puppet (username, avatar, avatar_url, avatar_set, displayname, name_quality, name_set, contact_info_set,
-							last_sync, custom_mxid, access_token, next_batch, enable_presence, enable_receipts)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+							last_sync, custom_mxid, access_token, next_batch, enable_presence, enable_receipts, name_template)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
 	`
 	updatePuppetQuery = `
 		UPDATE puppet
 		SET avatar=$2, avatar_url=$3, avatar_set=$4, displayname=$5, name_quality=$6, name_set=$7, contact_info_set=$8,
-		    last_sync=$9, custom_mxid=$10, access_token=$11, next_batch=$12, enable_presence=$13, enable_receipts=$14
+		    last_sync=$9, custom_mxid=$10, access_token=$11, next_batch=$12, enable_presence=$13, enable_receipts=$14,
+		    name_template=$15
 		WHERE username=$1
 	`
 )
@@ -80,6 +82,10 @@ func (pq *PuppetQuery) GetAllWithCustomMXID(ctx context.Context) ([]*Puppet, err
 	return pq.QueryMany(ctx, getAllPuppetsWithCustomMXIDQuery)
 }
 
+func (pq *PuppetQuery) GetAllWithActivity(ctx context.Context) ([]*Puppet, error) {
+	return pq.QueryMany(ctx, getAllPuppetsWithActivityQuery)
+}
+
 type Puppet struct {
 	qh *dbutil.QueryHelper[*Puppet]
 
@@ -89,6 +95,7 @@ type Puppet struct {
 	AvatarSet      bool
 	Displayname    string
 	NameQuality    int8
+	NameTemplate   string
 	NameSet        bool
 	ContactInfoSet bool
 	LastSync       time.Time
@@ -108,7 +115,7 @@ func (puppet *Puppet) Scan(row dbutil.Scannable) (*Puppet, error) {
 	var quality, firstActivityTs, lastActivityTs, lastSync sql.NullInt64
 	var enablePresence, enableReceipts, nameSet, avatarSet, contactInfoSet sql.NullBool
 	var username string
-	err := row.Scan(&username, &avatar, &avatarURL, &displayname, &quality, &nameSet, &avatarSet, &contactInfoSet, &lastSync, &customMXID, &accessToken, &nextBatch, &enablePresence, &enableReceipts, &firstActivityTs, &lastActivityTs)
+	err := row.Scan(&username, &avatar, &avatarURL, &displayname, &quality, &puppet.NameTemplate, &nameSet, &avatarSet, &contactInfoSet, &lastSync, &customMXID, &accessToken, &nextBatch, &enablePresence, &enableReceipts, &firstActivityTs, &lastActivityTs)
 	if err != nil {
 		return nil, err
 	}
@@ -142,7 +149,7 @@ func (puppet *Puppet) sqlVariables() []any {
 		puppet.JID.User, puppet.Avatar, puppet.AvatarURL.String(), puppet.AvatarSet, puppet.Displayname,
 		puppet.NameQuality, puppet.NameSet, puppet.ContactInfoSet, lastSyncTS,
 		puppet.CustomMXID, puppet.AccessToken, puppet.NextBatch,
-		puppet.EnablePresence, puppet.EnableReceipts,
+		puppet.EnablePresence, puppet.EnableReceipts, puppet.NameTemplate,
 	}
 }
 
@@ -0,0 +1,113 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"context"
+
+	"go.mau.fi/util/dbutil"
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/element-hq/mautrix-go/id"
+)
+
+type SharedAccessQuery struct {
+	*dbutil.QueryHelper[*SharedAccess]
+}
+
+func newSharedAccess(qh *dbutil.QueryHelper[*SharedAccess]) *SharedAccess {
+	return &SharedAccess{qh: qh}
+}
+
+func (saq *SharedAccessQuery) New() *SharedAccess {
+	return &SharedAccess{qh: saq.QueryHelper}
+}
+
+const (
+	getSharedAccessBaseQuery = `
+		SELECT owner_mxid, target_mxid, chat_jid, chat_receiver FROM shared_access
+	`
+	getSharedAccessByOwnerQuery   = getSharedAccessBaseQuery + " WHERE owner_mxid=$1 ORDER BY target_mxid"
+	getSharedAccessByTargetQuery  = getSharedAccessBaseQuery + " WHERE target_mxid=$1"
+	getSharedAccessForPortalQuery = getSharedAccessBaseQuery + `
+		WHERE target_mxid=$1 AND ((chat_jid=$2 AND chat_receiver=$3) OR chat_jid='')
+	`
+	insertSharedAccessQuery = `
+		INSERT INTO shared_access (owner_mxid, target_mxid, chat_jid, chat_receiver) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (owner_mxid, target_mxid, chat_jid, chat_receiver) DO NOTHING
+	`
+	deleteSharedAccessQuery = "DELETE FROM shared_access WHERE owner_mxid=$1 AND target_mxid=$2 AND chat_jid=$3 AND chat_receiver=$4"
+)
+
+func (saq *SharedAccessQuery) GetAllByOwner(ctx context.Context, owner id.UserID) ([]*SharedAccess, error) {
+	return saq.QueryMany(ctx, getSharedAccessByOwnerQuery, owner)
+}
+
+func (saq *SharedAccessQuery) GetAllByTarget(ctx context.Context, target id.UserID) ([]*SharedAccess, error) {
+	return saq.QueryMany(ctx, getSharedAccessByTargetQuery, target)
+}
+
+// GetForPortal returns the access grants that allow the target user to use the given portal,
+// including grants for all portals of the owner.
+func (saq *SharedAccessQuery) GetForPortal(ctx context.Context, target id.UserID, chat PortalKey) ([]*SharedAccess, error) {
+	return saq.QueryMany(ctx, getSharedAccessForPortalQuery, target, chat.JID, chat.Receiver)
+}
+
+// SharedAccess allows a secondary Matrix account to use the owner's portals through the owner's WhatsApp session.
+type SharedAccess struct {
+	qh *dbutil.QueryHelper[*SharedAccess]
+
+	OwnerMXID  id.UserID
+	TargetMXID id.UserID
+	// Portal is the portal the access applies to. If the JID is empty, the access applies to all of the owner's portals.
+	Portal PortalKey
+}
+
+// IsAllPortals returns true if the access applies to all portals of the owner.
+func (sa *SharedAccess) IsAllPortals() bool {
+	return sa.Portal.JID.IsEmpty()
+}
+
+func (sa *SharedAccess) Scan(row dbutil.Scannable) (*SharedAccess, error) {
+	var chatJID, chatReceiver string
+	err := row.Scan(&sa.OwnerMXID, &sa.TargetMXID, &chatJID, &chatReceiver)
+	if err != nil {
+		return nil, err
+	}
+	if chatJID != "" {
+		sa.Portal.JID, _ = types.ParseJID(chatJID)
+		sa.Portal.Receiver, _ = types.ParseJID(chatReceiver)
+	}
+	return sa, nil
+}
+
+func (sa *SharedAccess) portalStrings() (string, string) {
+	if sa.IsAllPortals() {
+		return "", ""
+	}
+	return sa.Portal.JID.String(), sa.Portal.Receiver.String()
+}
+
+func (sa *SharedAccess) Insert(ctx context.Context) error {
+	chatJID, chatReceiver := sa.portalStrings()
+	return sa.qh.Exec(ctx, insertSharedAccessQuery, sa.OwnerMXID, sa.TargetMXID, chatJID, chatReceiver)
+}
+
+func (sa *SharedAccess) Delete(ctx context.Context) error {
+	chatJID, chatReceiver := sa.portalStrings()
+	return sa.qh.Exec(ctx, deleteSharedAccessQuery, sa.OwnerMXID, sa.TargetMXID, chatJID, chatReceiver)
+}
@@ -0,0 +1,90 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mau.fi/util/dbutil"
+
+	"github.com/element-hq/mautrix-go/id"
+)
+
+type StickerCacheQuery struct {
+	*dbutil.QueryHelper[*CachedSticker]
+}
+
+func newCachedSticker(qh *dbutil.QueryHelper[*CachedSticker]) *CachedSticker {
+	return &CachedSticker{qh: qh}
+}
+
+func (scq *StickerCacheQuery) New() *CachedSticker {
+	return &CachedSticker{qh: scq.QueryHelper}
+}
+
+const (
+	getCachedStickerQuery = `
+		SELECT source, mxc, data, mime_type, width, height, is_animated, metadata, created_at FROM sticker_cache WHERE source=$1
+	`
+	upsertCachedStickerQuery = `
+		INSERT INTO sticker_cache (source, mxc, data, mime_type, width, height, is_animated, metadata, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (source) DO UPDATE
+			SET mxc=excluded.mxc, data=excluded.data, mime_type=excluded.mime_type, width=excluded.width,
+				height=excluded.height, is_animated=excluded.is_animated,
+				metadata=excluded.metadata, created_at=excluded.created_at
+	`
+)
+
+func (scq *StickerCacheQuery) Get(ctx context.Context, source string) (*CachedSticker, error) {
+	return scq.QueryOne(ctx, getCachedStickerQuery, source)
+}
+
+// CachedSticker is the result of a previous sticker conversion.
+//
+// For stickers received from WhatsApp, Source is the hex-encoded SHA-256 of the file and MXC is the uploaded
+// Matrix content URI. For stickers sent from Matrix, Source is the original content URI and Data contains
+// the converted WebP file that is uploaded to WhatsApp. Metadata is the raw sticker pack JSON embedded in the file.
+type CachedSticker struct {
+	qh *dbutil.QueryHelper[*CachedSticker]
+
+	Source     string
+	MXC        id.ContentURIString
+	Data       []byte
+	MimeType   string
+	Width      int
+	Height     int
+	IsAnimated bool
+	Metadata   string
+	CreatedAt  time.Time
+}
+
+func (cs *CachedSticker) Scan(row dbutil.Scannable) (*CachedSticker, error) {
+	var createdAt int64
+	err := row.Scan(&cs.Source, &cs.MXC, &cs.Data, &cs.MimeType, &cs.Width, &cs.Height, &cs.IsAnimated, &cs.Metadata, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+	cs.CreatedAt = time.UnixMilli(createdAt)
+	return cs, nil
+}
+
+func (cs *CachedSticker) Upsert(ctx context.Context) error {
+	return cs.qh.Exec(ctx, upsertCachedStickerQuery,
+		cs.Source, cs.MXC, cs.Data, cs.MimeType, cs.Width, cs.Height, cs.IsAnimated, cs.Metadata, cs.CreatedAt.UnixMilli())
+}
@@ -1,4 +1,4 @@
--- v0 -> v58 (compatible with v46+): Latest revision
+-- v0 -> v92 (compatible with v46+): Latest revision
 
 CREATE TABLE "user" (
     mxid     TEXT PRIMARY KEY,
@@ -12,7 +12,21 @@ CREATE TABLE "user" (
     phone_last_seen   BIGINT,
     phone_last_pinged BIGINT,
 
-    timezone TEXT
+    timezone            TEXT,
+    name_preference     TEXT    NOT NULL DEFAULT '',
+    disabled_delivery   INTEGER NOT NULL DEFAULT 0,
+    analytics_opt_out   BOOLEAN NOT NULL DEFAULT false,
+    analytics_aliased   BOOLEAN NOT NULL DEFAULT false,
+    group_invite_policy TEXT    NOT NULL DEFAULT '',
+
+    transcribe_voice       BOOLEAN NOT NULL DEFAULT false,
+    transcription_language TEXT    NOT NULL DEFAULT '',
+    locale                 TEXT    NOT NULL DEFAULT '',
+    previous_username      TEXT    NOT NULL DEFAULT '',
+    archive_space_room     TEXT    NOT NULL DEFAULT '',
+
+    initial_sync_state TEXT    NOT NULL DEFAULT '',
+    initial_sync_limit INTEGER NOT NULL DEFAULT 0
 );
 
 CREATE TABLE portal (
@@ -33,19 +47,35 @@ CREATE TABLE portal (
     parent_group TEXT,
     in_space     BOOLEAN NOT NULL DEFAULT false,
 
+    is_default_subgroup BOOLEAN NOT NULL DEFAULT false,
+
     first_event_id  TEXT,
     next_batch_id   TEXT,
     relay_user_id   TEXT,
+    relay_formats   TEXT,
     expiration_time BIGINT NOT NULL DEFAULT 0 CHECK (expiration_time >= 0 AND expiration_time < 4294967296),
 
+    keep_disappearing BOOLEAN NOT NULL DEFAULT false,
+    translate_incoming TEXT NOT NULL DEFAULT '',
+    translate_outgoing TEXT NOT NULL DEFAULT '',
+    locale             TEXT NOT NULL DEFAULT '',
+    history_visibility TEXT NOT NULL DEFAULT '',
+    key_share_count    INTEGER NOT NULL DEFAULT 0,
+
     PRIMARY KEY (jid, receiver)
 );
 CREATE INDEX portal_parent_group_idx ON portal(parent_group);
+-- only: postgres
+ALTER TABLE portal ADD CONSTRAINT portal_normalized_key CHECK (jid NOT LIKE '%:%@%' AND receiver NOT LIKE '%:%@%' AND jid NOT LIKE '%@c.us' AND receiver NOT LIKE '%@c.us');
+-- only: sqlite
+CREATE TRIGGER portal_normalized_key BEFORE INSERT ON portal WHEN NEW.jid LIKE '%:%@%' OR NEW.receiver LIKE '%:%@%' OR NEW.jid LIKE '%@c.us' OR NEW.receiver LIKE '%@c.us' BEGIN SELECT RAISE(ABORT, 'portal key must not contain device or legacy server JIDs'); END;
+CREATE TRIGGER portal_normalized_key_update BEFORE UPDATE OF jid, receiver ON portal WHEN NEW.jid LIKE '%:%@%' OR NEW.receiver LIKE '%:%@%' OR NEW.jid LIKE '%@c.us' OR NEW.receiver LIKE '%@c.us' BEGIN SELECT RAISE(ABORT, 'portal key must not contain device or legacy server JIDs'); END;
 
 CREATE TABLE puppet (
     username         TEXT PRIMARY KEY,
     displayname      TEXT,
     name_quality     SMALLINT,
+    name_template    TEXT NOT NULL DEFAULT '',
     avatar           TEXT,
     avatar_url       TEXT,
     name_set         BOOLEAN NOT NULL DEFAULT false,
@@ -80,12 +110,15 @@ CREATE TABLE message (
     type          TEXT,
 
     broadcast_list_jid TEXT,
+    failure_reason     TEXT NOT NULL DEFAULT '',
 
     PRIMARY KEY (chat_jid, chat_receiver, jid),
     FOREIGN KEY (chat_jid, chat_receiver) REFERENCES portal(jid, receiver) ON DELETE CASCADE
 );
 
 CREATE INDEX message_timestamp_idx ON message (chat_jid, chat_receiver, timestamp);
+-- only: postgres
+CREATE INDEX message_timestamp_brin_idx ON message USING brin (timestamp);
 
 CREATE TABLE poll_option_id (
     msg_mxid TEXT,
@@ -151,6 +184,13 @@ CREATE TABLE backfill_queue (
     FOREIGN KEY (portal_jid, portal_receiver) REFERENCES portal(jid, receiver) ON DELETE CASCADE
 );
 
+CREATE TABLE backfill_scheduler (
+    user_mxid TEXT PRIMARY KEY,
+    paused    BOOLEAN NOT NULL DEFAULT false,
+    paused_at BIGINT,
+    FOREIGN KEY (user_mxid) REFERENCES "user"(mxid) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
 CREATE TABLE backfill_state (
     user_mxid         TEXT,
     portal_jid        TEXT,
@@ -158,6 +198,7 @@ CREATE TABLE backfill_state (
     processing_batch  BOOLEAN,
     backfill_complete BOOLEAN,
     first_expected_ts BIGINT,
+    message_count     INTEGER NOT NULL DEFAULT 0,
     PRIMARY KEY (user_mxid, portal_jid, portal_receiver),
     FOREIGN KEY (user_mxid) REFERENCES "user" (mxid) ON DELETE CASCADE ON UPDATE CASCADE,
     FOREIGN KEY (portal_jid, portal_receiver) REFERENCES portal (jid, receiver) ON DELETE CASCADE
@@ -176,6 +217,182 @@ CREATE TABLE media_backfill_requests (
     FOREIGN KEY (portal_jid, portal_receiver) REFERENCES portal(jid, receiver) ON UPDATE CASCADE ON DELETE CASCADE
 );
 
+CREATE TABLE media_retry (
+    chat_jid      TEXT,
+    chat_receiver TEXT,
+    message_id    TEXT,
+    user_mxid     TEXT   NOT NULL,
+    event_id      TEXT   NOT NULL,
+    meta          TEXT   NOT NULL,
+    attempts      INTEGER NOT NULL DEFAULT 0,
+    next_attempt  BIGINT NOT NULL,
+    last_error    TEXT,
+
+    PRIMARY KEY (chat_jid, chat_receiver, message_id),
+    FOREIGN KEY (chat_jid, chat_receiver) REFERENCES portal(jid, receiver) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (user_mxid) REFERENCES "user"(mxid) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX media_retry_next_attempt_idx ON media_retry (next_attempt);
+
+CREATE TABLE whatsapp_label (
+    user_mxid TEXT,
+    label_id  TEXT,
+    name      TEXT    NOT NULL,
+    color     INTEGER NOT NULL DEFAULT 0,
+    deleted   BOOLEAN NOT NULL DEFAULT false,
+
+    PRIMARY KEY (user_mxid, label_id),
+    FOREIGN KEY (user_mxid) REFERENCES "user"(mxid) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE portal_label (
+    user_mxid       TEXT,
+    label_id        TEXT,
+    portal_jid      TEXT,
+    portal_receiver TEXT,
+
+    PRIMARY KEY (user_mxid, label_id, portal_jid, portal_receiver),
+    FOREIGN KEY (user_mxid)                   REFERENCES "user"(mxid)          ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (portal_jid, portal_receiver) REFERENCES portal(jid, receiver) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE announcement (
+    id INTEGER PRIMARY KEY
+        -- only: postgres
+        GENERATED ALWAYS AS IDENTITY
+        ,
+    sender     TEXT    NOT NULL,
+    message    TEXT    NOT NULL,
+    created_at BIGINT  NOT NULL,
+    last_user  TEXT    NOT NULL DEFAULT '',
+    sent_count INTEGER NOT NULL DEFAULT 0,
+    completed  BOOLEAN NOT NULL DEFAULT false
+);
+
+CREATE TABLE user_stats (
+    user_mxid       TEXT,
+    day             BIGINT,
+    portal_jid      TEXT    NOT NULL DEFAULT '',
+    portal_receiver TEXT    NOT NULL DEFAULT '',
+    messages_in     INTEGER NOT NULL DEFAULT 0,
+    messages_out    INTEGER NOT NULL DEFAULT 0,
+    media_bytes     BIGINT  NOT NULL DEFAULT 0,
+    failed_sends    INTEGER NOT NULL DEFAULT 0,
+    connected_secs  BIGINT  NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (user_mxid, day, portal_jid, portal_receiver),
+    FOREIGN KEY (user_mxid) REFERENCES "user"(mxid) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE outgoing_queue (
+    event_id     TEXT PRIMARY KEY,
+    room_id      TEXT    NOT NULL,
+    user_mxid    TEXT    NOT NULL,
+    event        TEXT    NOT NULL,
+    notice_id    TEXT    NOT NULL DEFAULT '',
+    queued_at    BIGINT  NOT NULL,
+    attempts     INTEGER NOT NULL DEFAULT 0,
+    next_attempt BIGINT  NOT NULL DEFAULT 0,
+
+    FOREIGN KEY (user_mxid) REFERENCES "user"(mxid) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX outgoing_queue_user_idx ON outgoing_queue (user_mxid, queued_at);
+
+CREATE TABLE sticker_cache (
+    source      TEXT PRIMARY KEY,
+    mxc         TEXT    NOT NULL DEFAULT '',
+    data        bytea,
+    mime_type   TEXT    NOT NULL,
+    width       INTEGER NOT NULL DEFAULT 0,
+    height      INTEGER NOT NULL DEFAULT 0,
+    is_animated BOOLEAN NOT NULL DEFAULT false,
+    metadata    TEXT    NOT NULL DEFAULT '',
+    created_at  BIGINT  NOT NULL
+);
+
+CREATE TABLE media_cache (
+    file_sha256 TEXT PRIMARY KEY,
+    mxc         TEXT    NOT NULL,
+    mime_type   TEXT    NOT NULL,
+    size        BIGINT  NOT NULL,
+    width       INTEGER NOT NULL DEFAULT 0,
+    height      INTEGER NOT NULL DEFAULT 0,
+    created_at  BIGINT  NOT NULL
+);
+
+CREATE TABLE user_chat_filter (
+    user_mxid TEXT,
+    chat_jid  TEXT,
+    action    TEXT NOT NULL,
+
+    PRIMARY KEY (user_mxid, chat_jid),
+    FOREIGN KEY (user_mxid) REFERENCES "user"(mxid) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE pending_group_invite (
+    user_mxid   TEXT,
+    group_jid   TEXT,
+    notice_mxid TEXT   NOT NULL,
+    group_name  TEXT   NOT NULL,
+    expires_at  BIGINT NOT NULL,
+
+    PRIMARY KEY (user_mxid, group_jid),
+    FOREIGN KEY (user_mxid) REFERENCES "user"(mxid) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE pinned_message (
+    chat_jid      TEXT,
+    chat_receiver TEXT,
+    message_id    TEXT,
+    mxid          TEXT   NOT NULL,
+    expires_at    BIGINT,
+
+    PRIMARY KEY (chat_jid, chat_receiver, message_id),
+    FOREIGN KEY (chat_jid, chat_receiver) REFERENCES portal(jid, receiver) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE shared_access (
+    owner_mxid    TEXT,
+    target_mxid   TEXT,
+    chat_jid      TEXT NOT NULL DEFAULT '',
+    chat_receiver TEXT NOT NULL DEFAULT '',
+
+    PRIMARY KEY (owner_mxid, target_mxid, chat_jid, chat_receiver),
+    FOREIGN KEY (owner_mxid) REFERENCES "user"(mxid) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX shared_access_target_idx ON shared_access (target_mxid);
+
+CREATE TABLE archived_room (
+    room_id     TEXT PRIMARY KEY,
+    user_mxid   TEXT   NOT NULL,
+    chat_jid    TEXT   NOT NULL,
+    name        TEXT   NOT NULL DEFAULT '',
+    archived_at BIGINT NOT NULL,
+
+    FOREIGN KEY (user_mxid) REFERENCES "user"(mxid) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX archived_room_user_idx ON archived_room (user_mxid);
+
+CREATE TABLE cloud_api_login (
+    user_mxid       TEXT PRIMARY KEY,
+    phone_number_id TEXT NOT NULL UNIQUE,
+    phone_number    TEXT NOT NULL,
+    access_token    TEXT NOT NULL,
+
+    FOREIGN KEY (user_mxid) REFERENCES "user"(mxid) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE bridge_prompt (
+    event_id   TEXT PRIMARY KEY,
+    room_id    TEXT   NOT NULL,
+    user_mxid  TEXT   NOT NULL,
+    type       TEXT   NOT NULL,
+    data       TEXT   NOT NULL,
+    expires_at BIGINT NOT NULL,
+
+    FOREIGN KEY (user_mxid) REFERENCES "user"(mxid) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
 CREATE TABLE history_sync_conversation (
     user_mxid       TEXT,
     conversation_id TEXT,
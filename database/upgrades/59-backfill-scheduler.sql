@@ -0,0 +1,8 @@
+-- v59 (compatible with v46+): Add table for persisting backfill scheduler state
+
+CREATE TABLE backfill_scheduler (
+    user_mxid TEXT PRIMARY KEY,
+    paused    BOOLEAN NOT NULL DEFAULT false,
+    paused_at BIGINT,
+    FOREIGN KEY (user_mxid) REFERENCES "user"(mxid) ON UPDATE CASCADE ON DELETE CASCADE
+);
@@ -0,0 +1,18 @@
+-- v60 (compatible with v46+): Add table for automatic media retries
+
+CREATE TABLE media_retry (
+    chat_jid      TEXT,
+    chat_receiver TEXT,
+    message_id    TEXT,
+    user_mxid     TEXT   NOT NULL,
+    event_id      TEXT   NOT NULL,
+    meta          TEXT   NOT NULL,
+    attempts      INTEGER NOT NULL DEFAULT 0,
+    next_attempt  BIGINT NOT NULL,
+    last_error    TEXT,
+
+    PRIMARY KEY (chat_jid, chat_receiver, message_id),
+    FOREIGN KEY (chat_jid, chat_receiver) REFERENCES portal(jid, receiver) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (user_mxid) REFERENCES "user"(mxid) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX media_retry_next_attempt_idx ON media_retry (next_attempt);
@@ -0,0 +1,3 @@
+-- v61 (compatible with v46+): Add per-user displayname preference and puppet name template tracking
+ALTER TABLE "user" ADD COLUMN name_preference TEXT NOT NULL DEFAULT '';
+ALTER TABLE puppet ADD COLUMN name_template TEXT NOT NULL DEFAULT '';
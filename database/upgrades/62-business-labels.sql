@@ -0,0 +1,23 @@
+-- v62 (compatible with v46+): Add tables for WhatsApp Business labels
+
+CREATE TABLE whatsapp_label (
+    user_mxid TEXT,
+    label_id  TEXT,
+    name      TEXT    NOT NULL,
+    color     INTEGER NOT NULL DEFAULT 0,
+    deleted   BOOLEAN NOT NULL DEFAULT false,
+
+    PRIMARY KEY (user_mxid, label_id),
+    FOREIGN KEY (user_mxid) REFERENCES "user"(mxid) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE portal_label (
+    user_mxid       TEXT,
+    label_id        TEXT,
+    portal_jid      TEXT,
+    portal_receiver TEXT,
+
+    PRIMARY KEY (user_mxid, label_id, portal_jid, portal_receiver),
+    FOREIGN KEY (user_mxid)                   REFERENCES "user"(mxid)          ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (portal_jid, portal_receiver) REFERENCES portal(jid, receiver) ON UPDATE CASCADE ON DELETE CASCADE
+);
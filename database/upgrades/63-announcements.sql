@@ -0,0 +1,14 @@
+-- v63 (compatible with v46+): Add table for admin announcements
+
+CREATE TABLE announcement (
+    id INTEGER PRIMARY KEY
+        -- only: postgres
+        GENERATED ALWAYS AS IDENTITY
+        ,
+    sender     TEXT    NOT NULL,
+    message    TEXT    NOT NULL,
+    created_at BIGINT  NOT NULL,
+    last_user  TEXT    NOT NULL DEFAULT '',
+    sent_count INTEGER NOT NULL DEFAULT 0,
+    completed  BOOLEAN NOT NULL DEFAULT false
+);
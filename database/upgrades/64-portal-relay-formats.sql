@@ -0,0 +1,2 @@
+-- v64 (compatible with v46+): Add per-portal relay message formats
+ALTER TABLE portal ADD COLUMN relay_formats TEXT;
@@ -0,0 +1,16 @@
+-- v65 (compatible with v46+): Add table for per-user daily usage counters
+
+CREATE TABLE user_stats (
+    user_mxid       TEXT,
+    day             BIGINT,
+    portal_jid      TEXT    NOT NULL DEFAULT '',
+    portal_receiver TEXT    NOT NULL DEFAULT '',
+    messages_in     INTEGER NOT NULL DEFAULT 0,
+    messages_out    INTEGER NOT NULL DEFAULT 0,
+    media_bytes     BIGINT  NOT NULL DEFAULT 0,
+    failed_sends    INTEGER NOT NULL DEFAULT 0,
+    connected_secs  BIGINT  NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (user_mxid, day, portal_jid, portal_receiver),
+    FOREIGN KEY (user_mxid) REFERENCES "user"(mxid) ON UPDATE CASCADE ON DELETE CASCADE
+);
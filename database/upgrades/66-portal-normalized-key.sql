@@ -0,0 +1,6 @@
+-- v66 (compatible with v46+): Prevent creating portals with device or legacy server JIDs in the key
+
+-- only: postgres
+ALTER TABLE portal ADD CONSTRAINT portal_normalized_key CHECK (jid NOT LIKE '%:%@%' AND receiver NOT LIKE '%:%@%' AND jid NOT LIKE '%@c.us' AND receiver NOT LIKE '%@c.us') NOT VALID;
+-- only: sqlite
+CREATE TRIGGER portal_normalized_key BEFORE INSERT ON portal WHEN NEW.jid LIKE '%:%@%' OR NEW.receiver LIKE '%:%@%' OR NEW.jid LIKE '%@c.us' OR NEW.receiver LIKE '%@c.us' BEGIN SELECT RAISE(ABORT, 'portal key must not contain device or legacy server JIDs'); END;
@@ -0,0 +1,2 @@
+-- v67 (compatible with v46+): Store whether a group is the announcement group of its community
+ALTER TABLE portal ADD COLUMN is_default_subgroup BOOLEAN NOT NULL DEFAULT false;
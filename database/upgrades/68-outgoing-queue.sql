@@ -0,0 +1,14 @@
+-- v68 (compatible with v46+): Add table for Matrix messages waiting for the WhatsApp connection
+CREATE TABLE outgoing_queue (
+    event_id     TEXT PRIMARY KEY,
+    room_id      TEXT    NOT NULL,
+    user_mxid    TEXT    NOT NULL,
+    event        TEXT    NOT NULL,
+    notice_id    TEXT    NOT NULL DEFAULT '',
+    queued_at    BIGINT  NOT NULL,
+    attempts     INTEGER NOT NULL DEFAULT 0,
+    next_attempt BIGINT  NOT NULL DEFAULT 0,
+
+    FOREIGN KEY (user_mxid) REFERENCES "user"(mxid) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX outgoing_queue_user_idx ON outgoing_queue (user_mxid, queued_at);
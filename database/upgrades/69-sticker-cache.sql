@@ -0,0 +1,12 @@
+-- v69 (compatible with v46+): Add cache for converted stickers
+CREATE TABLE sticker_cache (
+    source      TEXT PRIMARY KEY,
+    mxc         TEXT    NOT NULL DEFAULT '',
+    data        bytea,
+    mime_type   TEXT    NOT NULL,
+    width       INTEGER NOT NULL DEFAULT 0,
+    height      INTEGER NOT NULL DEFAULT 0,
+    is_animated BOOLEAN NOT NULL DEFAULT false,
+    metadata    TEXT    NOT NULL DEFAULT '',
+    created_at  BIGINT  NOT NULL
+);
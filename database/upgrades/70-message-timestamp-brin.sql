@@ -0,0 +1,3 @@
+-- v70 (compatible with v46+): Add BRIN index on message timestamps for pruning large message tables
+-- only: postgres
+CREATE INDEX message_timestamp_brin_idx ON message USING brin (timestamp);
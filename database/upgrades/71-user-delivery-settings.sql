@@ -0,0 +1,2 @@
+-- v71 (compatible with v46+): Add per-user receipt and typing notification settings
+ALTER TABLE "user" ADD COLUMN disabled_delivery INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+-- v72 (compatible with v46+): Add per-user analytics opt-out
+ALTER TABLE "user" ADD COLUMN analytics_opt_out BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,2 @@
+-- v73 (compatible with v46+): Track which users' raw analytics IDs have been aliased to pseudonymized IDs
+ALTER TABLE "user" ADD COLUMN analytics_aliased BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,9 @@
+-- v74 (compatible with v46+): Add per-user chat filters
+CREATE TABLE user_chat_filter (
+    user_mxid TEXT,
+    chat_jid  TEXT,
+    action    TEXT NOT NULL,
+
+    PRIMARY KEY (user_mxid, chat_jid),
+    FOREIGN KEY (user_mxid) REFERENCES "user"(mxid) ON UPDATE CASCADE ON DELETE CASCADE
+);
@@ -0,0 +1,13 @@
+-- v75 (compatible with v46+): Add per-user group invite policy and pending group invites
+ALTER TABLE "user" ADD COLUMN group_invite_policy TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE pending_group_invite (
+    user_mxid   TEXT,
+    group_jid   TEXT,
+    notice_mxid TEXT   NOT NULL,
+    group_name  TEXT   NOT NULL,
+    expires_at  BIGINT NOT NULL,
+
+    PRIMARY KEY (user_mxid, group_jid),
+    FOREIGN KEY (user_mxid) REFERENCES "user"(mxid) ON UPDATE CASCADE ON DELETE CASCADE
+);
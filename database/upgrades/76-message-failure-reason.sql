@@ -0,0 +1,2 @@
+-- v76 (compatible with v46+): Store why sending a Matrix message to WhatsApp failed
+ALTER TABLE message ADD COLUMN failure_reason TEXT NOT NULL DEFAULT '';
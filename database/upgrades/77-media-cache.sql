@@ -0,0 +1,10 @@
+-- v77 (compatible with v46+): Add cache for deduplicating media uploads
+CREATE TABLE media_cache (
+    file_sha256 TEXT PRIMARY KEY,
+    mxc         TEXT    NOT NULL,
+    mime_type   TEXT    NOT NULL,
+    size        BIGINT  NOT NULL,
+    width       INTEGER NOT NULL DEFAULT 0,
+    height      INTEGER NOT NULL DEFAULT 0,
+    created_at  BIGINT  NOT NULL
+);
@@ -0,0 +1,2 @@
+-- v78 (compatible with v46+): Allow keeping disappearing messages on Matrix per portal
+ALTER TABLE portal ADD COLUMN keep_disappearing BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,3 @@
+-- v79 (compatible with v46+): Add per-portal translation languages
+ALTER TABLE portal ADD COLUMN translate_incoming TEXT NOT NULL DEFAULT '';
+ALTER TABLE portal ADD COLUMN translate_outgoing TEXT NOT NULL DEFAULT '';
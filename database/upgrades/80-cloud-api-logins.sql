@@ -0,0 +1,9 @@
+-- v80 (compatible with v46+): Store WhatsApp Business Cloud API logins
+CREATE TABLE cloud_api_login (
+    user_mxid       TEXT PRIMARY KEY,
+    phone_number_id TEXT NOT NULL UNIQUE,
+    phone_number    TEXT NOT NULL,
+    access_token    TEXT NOT NULL,
+
+    FOREIGN KEY (user_mxid) REFERENCES "user"(mxid) ON UPDATE CASCADE ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+-- v81 (compatible with v46+): Add per-user voice message transcription settings
+ALTER TABLE "user" ADD COLUMN transcribe_voice BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE "user" ADD COLUMN transcription_language TEXT NOT NULL DEFAULT '';
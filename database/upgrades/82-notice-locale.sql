@@ -0,0 +1,3 @@
+-- v82 (compatible with v46+): Add user and portal locales for bridge notices
+ALTER TABLE "user" ADD COLUMN locale TEXT NOT NULL DEFAULT '';
+ALTER TABLE portal ADD COLUMN locale TEXT NOT NULL DEFAULT '';
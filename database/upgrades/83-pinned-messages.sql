@@ -0,0 +1,11 @@
+-- v83 (compatible with v46+): Store pinned messages to unpin timed pins when they expire
+CREATE TABLE pinned_message (
+    chat_jid      TEXT,
+    chat_receiver TEXT,
+    message_id    TEXT,
+    mxid          TEXT   NOT NULL,
+    expires_at    BIGINT,
+
+    PRIMARY KEY (chat_jid, chat_receiver, message_id),
+    FOREIGN KEY (chat_jid, chat_receiver) REFERENCES portal(jid, receiver) ON UPDATE CASCADE ON DELETE CASCADE
+);
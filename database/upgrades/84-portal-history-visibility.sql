@@ -0,0 +1,3 @@
+-- v84 (compatible with v46+): Add per-portal history visibility and late joiner key sharing settings
+ALTER TABLE portal ADD COLUMN history_visibility TEXT NOT NULL DEFAULT '';
+ALTER TABLE portal ADD COLUMN key_share_count INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,11 @@
+-- v85 (compatible with v46+): Store portal access shared with secondary Matrix accounts
+CREATE TABLE shared_access (
+    owner_mxid    TEXT,
+    target_mxid   TEXT,
+    chat_jid      TEXT NOT NULL DEFAULT '',
+    chat_receiver TEXT NOT NULL DEFAULT '',
+
+    PRIMARY KEY (owner_mxid, target_mxid, chat_jid, chat_receiver),
+    FOREIGN KEY (owner_mxid) REFERENCES "user"(mxid) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX shared_access_target_idx ON shared_access (target_mxid);
@@ -0,0 +1,2 @@
+-- v86 (compatible with v46+): Remember the previous phone number of users to detect number changes
+ALTER TABLE "user" ADD COLUMN previous_username TEXT NOT NULL DEFAULT '';
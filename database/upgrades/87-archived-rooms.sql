@@ -0,0 +1,13 @@
+-- v87 (compatible with v46+): Keep read-only archives of groups the user has left
+ALTER TABLE "user" ADD COLUMN archive_space_room TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE archived_room (
+    room_id     TEXT PRIMARY KEY,
+    user_mxid   TEXT   NOT NULL,
+    chat_jid    TEXT   NOT NULL,
+    name        TEXT   NOT NULL DEFAULT '',
+    archived_at BIGINT NOT NULL,
+
+    FOREIGN KEY (user_mxid) REFERENCES "user"(mxid) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX archived_room_user_idx ON archived_room (user_mxid);
@@ -0,0 +1,3 @@
+-- v88 (compatible with v46+): Stop storing the content of queued Matrix messages
+-- The column is kept so that older versions can still insert into the table.
+UPDATE outgoing_queue SET event='';
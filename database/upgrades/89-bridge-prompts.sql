@@ -0,0 +1,11 @@
+-- v89 (compatible with v46+): Store bridge prompts so they can be answered after restarts
+CREATE TABLE bridge_prompt (
+    event_id   TEXT PRIMARY KEY,
+    room_id    TEXT   NOT NULL,
+    user_mxid  TEXT   NOT NULL,
+    type       TEXT   NOT NULL,
+    data       TEXT   NOT NULL,
+    expires_at BIGINT NOT NULL,
+
+    FOREIGN KEY (user_mxid) REFERENCES "user"(mxid) ON UPDATE CASCADE ON DELETE CASCADE
+);
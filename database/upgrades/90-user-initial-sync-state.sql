@@ -0,0 +1,3 @@
+-- v90 (compatible with v46+): Store whether the initial sync is waiting for the user's decision
+ALTER TABLE "user" ADD COLUMN initial_sync_state TEXT NOT NULL DEFAULT '';
+ALTER TABLE "user" ADD COLUMN initial_sync_limit INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+-- v91 (compatible with v46+): Store the total number of backfilled messages per chat
+ALTER TABLE backfill_state ADD COLUMN message_count INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- v92 (compatible with v46+): Also prevent updating portal keys to device or legacy server JIDs on SQLite
+-- only: sqlite
+CREATE TRIGGER portal_normalized_key_update BEFORE UPDATE OF jid, receiver ON portal WHEN NEW.jid LIKE '%:%@%' OR NEW.receiver LIKE '%:%@%' OR NEW.jid LIKE '%@c.us' OR NEW.receiver LIKE '%@c.us' BEGIN SELECT RAISE(ABORT, 'portal key must not contain device or legacy server JIDs'); END;
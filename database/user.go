@@ -43,21 +43,26 @@ func newUser(qh *dbutil.QueryHelper[*User]) *User {
 }
 
 const (
-	getAllUsersQuery       = `SELECT mxid, username, agent, device, management_room, space_room, phone_last_seen, phone_last_pinged, timezone FROM "user"`
+	getAllUsersQuery       = `SELECT mxid, username, agent, device, management_room, space_room, phone_last_seen, phone_last_pinged, timezone, name_preference, disabled_delivery, analytics_opt_out, analytics_aliased, group_invite_policy, transcribe_voice, transcription_language, locale, previous_username, archive_space_room, initial_sync_state, initial_sync_limit FROM "user"`
 	getUserByMXIDQuery     = getAllUsersQuery + ` WHERE mxid=$1`
 	getUserByUsernameQuery = getAllUsersQuery + ` WHERE username=$1`
 	insertUserQuery        = `
 		INSERT INTO "user" (
 			mxid, username, agent, device,
 			management_room, space_room,
-			phone_last_seen, phone_last_pinged, timezone
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			phone_last_seen, phone_last_pinged, timezone, name_preference, disabled_delivery, analytics_opt_out,
+			analytics_aliased, group_invite_policy, transcribe_voice, transcription_language, locale, previous_username,
+			archive_space_room, initial_sync_state, initial_sync_limit
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
 	`
 	updateUserQuery = `
 		UPDATE "user"
 		SET username=$2, agent=$3, device=$4,
 		    management_room=$5, space_room=$6,
-		    phone_last_seen=$7, phone_last_pinged=$8, timezone=$9
+		    phone_last_seen=$7, phone_last_pinged=$8, timezone=$9, name_preference=$10, disabled_delivery=$11,
+		    analytics_opt_out=$12, analytics_aliased=$13, group_invite_policy=$14, transcribe_voice=$15,
+		    transcription_language=$16, locale=$17, previous_username=$18, archive_space_room=$19,
+		    initial_sync_state=$20, initial_sync_limit=$21
 		WHERE mxid=$1
 	`
 	getUserLastAppStateKeyIDQuery = "SELECT key_id FROM whatsmeow_app_state_sync_keys WHERE jid=$1 ORDER BY timestamp DESC LIMIT 1"
@@ -75,6 +80,51 @@ func (uq *UserQuery) GetByUsername(ctx context.Context, username string) (*User,
 	return uq.QueryOne(ctx, getUserByUsernameQuery, username)
 }
 
+// DeliverySetting is a bit flag for a kind of receipt or typing notification that can be disabled per user.
+type DeliverySetting int
+
+const (
+	DeliverySendReadReceipts DeliverySetting = 1 << iota
+	DeliveryReceiveReadReceipts
+	DeliveryReceiveDeliveryReceipts
+	DeliveryReceivePlayedReceipts
+	DeliverySendTyping
+	DeliveryReceiveTyping
+)
+
+// Has returns true if all the given flags are set.
+func (ds DeliverySetting) Has(flag DeliverySetting) bool {
+	return ds&flag == flag
+}
+
+// GroupInvitePolicy is what the bridge does when a user is added to a WhatsApp group they don't have a portal for.
+type GroupInvitePolicy string
+
+const (
+	// GroupInviteAlways creates the portal immediately.
+	GroupInviteAlways GroupInvitePolicy = "always"
+	// GroupInviteAsk holds the invite and asks the user in their management room.
+	GroupInviteAsk GroupInvitePolicy = "ask"
+	// GroupInviteIgnore adds the group to the user's ignore list without asking.
+	GroupInviteIgnore GroupInvitePolicy = "ignore"
+)
+
+// InitialSyncState is the progress of deciding what to backfill from the initial history sync after login.
+type InitialSyncState string
+
+const (
+	// InitialSyncNone means backfilling isn't on hold.
+	InitialSyncNone InitialSyncState = ""
+	// InitialSyncReceiving means the initial history sync is still being received after login.
+	InitialSyncReceiving InitialSyncState = "receiving"
+	// InitialSyncReceived means the whole initial history sync has been received, but the summary hasn't been posted.
+	InitialSyncReceived InitialSyncState = "received"
+	// InitialSyncAwaitingChoice means the summary has been posted and the user hasn't chosen an option yet.
+	InitialSyncAwaitingChoice InitialSyncState = "awaiting_choice"
+	// InitialSyncChosen means the user has chosen an option, which limits the next backfill to InitialSyncLimit chats.
+	InitialSyncChosen InitialSyncState = "chosen"
+)
+
 type User struct {
 	qh *dbutil.QueryHelper[*User]
 
@@ -85,6 +135,32 @@ type User struct {
 	PhoneLastSeen   time.Time
 	PhoneLastPinged time.Time
 	Timezone        string
+	NamePreference  string
+	// DisabledDelivery contains the receipt and typing notification types the user has turned off.
+	DisabledDelivery DeliverySetting
+	// AnalyticsOptOut disables analytics events, per-user metrics and activity tracking for the user.
+	AnalyticsOptOut bool
+	// AnalyticsAliased is set once the raw Matrix user ID that was previously sent to analytics has been
+	// aliased to the pseudonymized ID.
+	AnalyticsAliased bool
+	// GroupInvitePolicy decides what happens when the user is added to a new WhatsApp group.
+	// Empty means the bridge-wide default is used.
+	GroupInvitePolicy GroupInvitePolicy
+	// TranscribeVoice enables posting transcriptions of incoming WhatsApp voice messages.
+	TranscribeVoice bool
+	// TranscriptionLanguage is an optional language hint for voice message transcriptions.
+	TranscriptionLanguage string
+	// Locale is the language of bridge notices in portals that don't have their own locale.
+	Locale string
+	// PreviousJID is the account the user was logged in with before their last logout,
+	// which is used to detect phone number changes.
+	PreviousJID types.JID
+	// ArchiveSpaceRoom is the space that contains the read-only archives of groups the user has left.
+	ArchiveSpaceRoom id.RoomID
+	// InitialSyncState tracks whether backfilling the initial history sync is on hold for the user's decision.
+	InitialSyncState InitialSyncState
+	// InitialSyncLimit is the number of chats the user chose to backfill from the initial sync.
+	InitialSyncLimit int
 
 	lastReadCache     map[PortalKey]time.Time
 	lastReadCacheLock sync.Mutex
@@ -94,9 +170,10 @@ type User struct {
 
 func (user *User) Scan(row dbutil.Scannable) (*User, error) {
 	var username, timezone sql.NullString
+	var previousUsername string
 	var device, agent sql.NullInt16
 	var phoneLastSeen, phoneLastPinged sql.NullInt64
-	err := row.Scan(&user.MXID, &username, &agent, &device, &user.ManagementRoom, &user.SpaceRoom, &phoneLastSeen, &phoneLastPinged, &timezone)
+	err := row.Scan(&user.MXID, &username, &agent, &device, &user.ManagementRoom, &user.SpaceRoom, &phoneLastSeen, &phoneLastPinged, &timezone, &user.NamePreference, &user.DisabledDelivery, &user.AnalyticsOptOut, &user.AnalyticsAliased, &user.GroupInvitePolicy, &user.TranscribeVoice, &user.TranscriptionLanguage, &user.Locale, &previousUsername, &user.ArchiveSpaceRoom, &user.InitialSyncState, &user.InitialSyncLimit)
 	if err != nil {
 		return nil, err
 	}
@@ -108,6 +185,9 @@ func (user *User) Scan(row dbutil.Scannable) (*User, error) {
 			Server: types.DefaultUserServer,
 		}
 	}
+	if len(previousUsername) > 0 {
+		user.PreviousJID = types.NewJID(previousUsername, types.DefaultUserServer)
+	}
 	if phoneLastSeen.Valid {
 		user.PhoneLastSeen = time.Unix(phoneLastSeen.Int64, 0)
 	}
@@ -129,7 +209,9 @@ func (user *User) sqlVariables() []any {
 	return []any{
 		user.MXID, username, agent, device, user.ManagementRoom, user.SpaceRoom,
 		dbutil.UnixPtr(user.PhoneLastSeen), dbutil.UnixPtr(user.PhoneLastPinged),
-		user.Timezone,
+		user.Timezone, user.NamePreference, user.DisabledDelivery, user.AnalyticsOptOut,
+		user.AnalyticsAliased, user.GroupInvitePolicy, user.TranscribeVoice, user.TranscriptionLanguage,
+		user.Locale, user.PreviousJID.User, user.ArchiveSpaceRoom, user.InitialSyncState, user.InitialSyncLimit,
 	}
 }
 
@@ -0,0 +1,131 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mau.fi/util/dbutil"
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/element-hq/mautrix-go/id"
+)
+
+type UserStatsQuery struct {
+	*dbutil.QueryHelper[*UserStats]
+}
+
+func newUserStats(qh *dbutil.QueryHelper[*UserStats]) *UserStats {
+	return &UserStats{qh: qh}
+}
+
+// StatsDay returns the day number used as the key for daily statistics.
+func StatsDay(ts time.Time) int64 {
+	return ts.UTC().Unix() / (24 * 60 * 60)
+}
+
+// New creates a set of counters for today, which can be added to the stored counters with Add.
+// An empty portal key is used for counters that aren't specific to a chat, like connection uptime.
+func (usq *UserStatsQuery) New(userID id.UserID, portal PortalKey) *UserStats {
+	return &UserStats{
+		qh:       usq.QueryHelper,
+		UserMXID: userID,
+		Day:      StatsDay(time.Now()),
+		Portal:   portal,
+	}
+}
+
+const (
+	addUserStatsQuery = `
+		INSERT INTO user_stats (
+			user_mxid, day, portal_jid, portal_receiver, messages_in, messages_out, media_bytes, failed_sends, connected_secs
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (user_mxid, day, portal_jid, portal_receiver) DO UPDATE SET
+			messages_in=user_stats.messages_in+excluded.messages_in,
+			messages_out=user_stats.messages_out+excluded.messages_out,
+			media_bytes=user_stats.media_bytes+excluded.media_bytes,
+			failed_sends=user_stats.failed_sends+excluded.failed_sends,
+			connected_secs=user_stats.connected_secs+excluded.connected_secs
+	`
+	getUserStatsTotalsQuery = `
+		SELECT user_mxid, MIN(day), '', '', SUM(messages_in), SUM(messages_out), SUM(media_bytes), SUM(failed_sends), SUM(connected_secs)
+		FROM user_stats WHERE user_mxid=$1 AND day>=$2
+		GROUP BY user_mxid
+	`
+	getUserStatsTopChatsQuery = `
+		SELECT user_mxid, MIN(day), portal_jid, portal_receiver, SUM(messages_in), SUM(messages_out), SUM(media_bytes), SUM(failed_sends), SUM(connected_secs)
+		FROM user_stats WHERE user_mxid=$1 AND day>=$2 AND portal_jid<>''
+		GROUP BY user_mxid, portal_jid, portal_receiver
+		ORDER BY SUM(messages_in)+SUM(messages_out) DESC
+		LIMIT $3
+	`
+)
+
+// GetTotals returns the sum of all counters of the user since the given time, or nil if there are no counters.
+func (usq *UserStatsQuery) GetTotals(ctx context.Context, userID id.UserID, since time.Time) (*UserStats, error) {
+	return usq.QueryOne(ctx, getUserStatsTotalsQuery, userID, StatsDay(since))
+}
+
+// GetTopChats returns the per-chat counters of the user since the given time, sorted by the number of messages.
+func (usq *UserStatsQuery) GetTopChats(ctx context.Context, userID id.UserID, since time.Time, limit int) ([]*UserStats, error) {
+	return usq.QueryMany(ctx, getUserStatsTopChatsQuery, userID, StatsDay(since), limit)
+}
+
+// UserStats contains lightweight usage counters for a user on a single day, optionally limited to a single chat.
+type UserStats struct {
+	qh *dbutil.QueryHelper[*UserStats]
+
+	UserMXID id.UserID
+	Day      int64
+	Portal   PortalKey
+
+	MessagesIn    int
+	MessagesOut   int
+	MediaBytes    int64
+	FailedSends   int
+	ConnectedSecs int64
+}
+
+func (us *UserStats) Scan(row dbutil.Scannable) (*UserStats, error) {
+	var portalJID, portalReceiver string
+	err := row.Scan(
+		&us.UserMXID, &us.Day, &portalJID, &portalReceiver,
+		&us.MessagesIn, &us.MessagesOut, &us.MediaBytes, &us.FailedSends, &us.ConnectedSecs,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if portalJID != "" {
+		us.Portal.JID, _ = types.ParseJID(portalJID)
+		us.Portal.Receiver, _ = types.ParseJID(portalReceiver)
+	}
+	return us, nil
+}
+
+// Add adds the counters to the stored values for the same user, day and chat.
+func (us *UserStats) Add(ctx context.Context) error {
+	var portalJID, portalReceiver string
+	if !us.Portal.JID.IsEmpty() {
+		portalJID = us.Portal.JID.String()
+		portalReceiver = us.Portal.Receiver.String()
+	}
+	return us.qh.Exec(
+		ctx, addUserStatsQuery, us.UserMXID, us.Day, portalJID, portalReceiver,
+		us.MessagesIn, us.MessagesOut, us.MediaBytes, us.FailedSends, us.ConnectedSecs,
+	)
+}
@@ -0,0 +1,300 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.mau.fi/whatsmeow/types"
+	waLog "go.mau.fi/whatsmeow/util/log"
+
+	"github.com/element-hq/mautrix-go/bridge/status"
+	"github.com/element-hq/mautrix-go/id"
+)
+
+// DataExportVersion is the format version of DataExport bundles.
+const DataExportVersion = 1
+
+// DataExport is a portable bundle of everything needed to move a logged-in user to another bridge instance
+// without scanning a new QR code: the whatsmeow device session, portal and puppet rows and message ID mappings.
+type DataExport struct {
+	Version    int                       `json:"version"`
+	UserID     id.UserID                 `json:"user_id"`
+	JID        types.JID                 `json:"jid"`
+	ExportedAt time.Time                 `json:"exported_at"`
+	Tables     map[string]*ExportedTable `json:"tables"`
+}
+
+type ExportedTable struct {
+	Columns []string          `json:"columns"`
+	Rows    [][]ExportedValue `json:"rows"`
+}
+
+// ExportedValue wraps a database value so that byte slices and timestamps survive the JSON round trip.
+type ExportedValue struct {
+	Value any
+}
+
+func (ev ExportedValue) MarshalJSON() ([]byte, error) {
+	switch val := ev.Value.(type) {
+	case []byte:
+		return json.Marshal(map[string]string{"bytes": base64.StdEncoding.EncodeToString(val)})
+	case time.Time:
+		return json.Marshal(map[string]string{"time": val.Format(time.RFC3339Nano)})
+	default:
+		return json.Marshal(val)
+	}
+}
+
+func (ev *ExportedValue) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var raw any
+	err := dec.Decode(&raw)
+	if err != nil {
+		return err
+	}
+	switch val := raw.(type) {
+	case json.Number:
+		if intVal, err := val.Int64(); err == nil {
+			ev.Value = intVal
+		} else {
+			ev.Value, err = val.Float64()
+			return err
+		}
+	case map[string]any:
+		if b64, ok := val["bytes"].(string); ok {
+			ev.Value, err = base64.StdEncoding.DecodeString(b64)
+		} else if ts, ok := val["time"].(string); ok {
+			ev.Value, err = time.Parse(time.RFC3339Nano, ts)
+		} else {
+			err = fmt.Errorf("unknown object value")
+		}
+		return err
+	default:
+		ev.Value = val
+	}
+	return nil
+}
+
+type exportParam int
+
+const (
+	exportParamDeviceJID exportParam = iota
+	exportParamNonADJID
+	exportParamMXID
+)
+
+type exportTable struct {
+	Name  string
+	Where string
+	// Params are the values of the placeholders in Where, in order.
+	Params []exportParam
+}
+
+var (
+	exportByDevice = []exportParam{exportParamDeviceJID}
+	exportByNonAD  = []exportParam{exportParamNonADJID}
+	exportByMXID   = []exportParam{exportParamMXID}
+	exportByBoth   = []exportParam{exportParamNonADJID, exportParamMXID}
+)
+
+// exportTables lists the tables included in data exports, in the order they must be imported in.
+var exportTables = []exportTable{
+	{"whatsmeow_device", "jid=$1", exportByDevice},
+	{"whatsmeow_identity_keys", "our_jid=$1", exportByDevice},
+	{"whatsmeow_pre_keys", "jid=$1", exportByDevice},
+	{"whatsmeow_sessions", "our_jid=$1", exportByDevice},
+	{"whatsmeow_sender_keys", "our_jid=$1", exportByDevice},
+	{"whatsmeow_app_state_sync_keys", "jid=$1", exportByDevice},
+	{"whatsmeow_app_state_version", "jid=$1", exportByDevice},
+	{"whatsmeow_app_state_mutation_macs", "jid=$1", exportByDevice},
+	{"whatsmeow_contacts", "our_jid=$1", exportByDevice},
+	{"whatsmeow_chat_settings", "our_jid=$1", exportByDevice},
+	{"whatsmeow_message_secrets", "our_jid=$1", exportByDevice},
+	{"whatsmeow_privacy_tokens", "our_jid=$1", exportByDevice},
+	{"portal", "receiver=$1 OR jid IN (SELECT portal_jid FROM user_portal WHERE user_mxid=$2 AND portal_jid=portal_receiver)", exportByBoth},
+	{"puppet", "username || '@s.whatsapp.net' IN (SELECT jid FROM portal WHERE receiver=$1)", exportByNonAD},
+	{"message", "chat_receiver=$1 OR chat_jid IN (SELECT portal_jid FROM user_portal WHERE user_mxid=$2 AND portal_jid=portal_receiver)", exportByBoth},
+	{"user_portal", "user_mxid=$1", exportByMXID},
+}
+
+func (table exportTable) args(user *User) []any {
+	args := make([]any, len(table.Params))
+	for i, param := range table.Params {
+		switch param {
+		case exportParamDeviceJID:
+			args[i] = user.JID.String()
+		case exportParamNonADJID:
+			args[i] = user.JID.ToNonAD().String()
+		case exportParamMXID:
+			args[i] = user.MXID
+		}
+	}
+	return args
+}
+
+var (
+	errExportUserNotLoggedIn = errors.New("user is not logged in")
+	errImportUserLoggedIn    = errors.New("user is already logged in")
+	errImportVersion         = errors.New("unsupported data export version")
+	errImportInvalidColumn   = errors.New("invalid column name in data export")
+)
+
+var validColumnName = regexp.MustCompile(`^[a-z_]+$`)
+
+// ExportData dumps the given user's session and bridge data. The session is removed from this bridge afterwards
+// without logging it out of WhatsApp, as the same session must not be used by two bridge instances at once.
+// Portals and messages are kept, so the user can import the data back if the move is aborted.
+func (br *WABridge) ExportData(ctx context.Context, user *User) (*DataExport, error) {
+	if user.Session == nil || user.JID.IsEmpty() {
+		return nil, errExportUserNotLoggedIn
+	}
+	export := &DataExport{
+		Version:    DataExportVersion,
+		UserID:     user.MXID,
+		JID:        user.JID,
+		ExportedAt: time.Now(),
+		Tables:     make(map[string]*ExportedTable, len(exportTables)),
+	}
+	user.DeleteConnection()
+	for _, table := range exportTables {
+		exported, err := br.exportTable(ctx, table, user)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export %s: %w", table.Name, err)
+		}
+		export.Tables[table.Name] = exported
+	}
+	zerolog.Ctx(ctx).Info().Stringer("user_id", user.MXID).Msg("Exported user data, removing local session")
+	user.removeFromJIDMap(status.BridgeState{StateEvent: status.StateLoggedOut})
+	user.DeleteSession(ctx)
+	return export, nil
+}
+
+func (br *WABridge) exportTable(ctx context.Context, table exportTable, user *User) (*ExportedTable, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE %s", table.Name, table.Where)
+	rows, err := br.DB.RawDB.QueryContext(ctx, query, table.args(user)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var exported ExportedTable
+	exported.Columns, err = rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		values := make([]any, len(exported.Columns))
+		valuePtrs := make([]any, len(values))
+		for i := range values {
+			valuePtrs[i] = &values[i]
+		}
+		err = rows.Scan(valuePtrs...)
+		if err != nil {
+			return nil, err
+		}
+		row := make([]ExportedValue, len(values))
+		for i, val := range values {
+			row[i] = ExportedValue{val}
+		}
+		exported.Rows = append(exported.Rows, row)
+	}
+	return &exported, rows.Err()
+}
+
+// ImportData inserts a bundle created by ExportData and connects the user with the imported session.
+// Rows that already exist in the database are left untouched.
+func (br *WABridge) ImportData(ctx context.Context, data *DataExport) (*User, error) {
+	if data.Version != DataExportVersion {
+		return nil, fmt.Errorf("%w %d", errImportVersion, data.Version)
+	}
+	user := br.GetUserByMXID(data.UserID)
+	if user == nil {
+		return nil, fmt.Errorf("failed to get user %s", data.UserID)
+	} else if user.Session != nil {
+		return nil, errImportUserLoggedIn
+	}
+	err := br.DB.DoTxn(ctx, nil, func(ctx context.Context) error {
+		for _, table := range exportTables {
+			imported, ok := data.Tables[table.Name]
+			if !ok || len(imported.Rows) == 0 {
+				continue
+			}
+			err := br.importTable(ctx, table.Name, imported)
+			if err != nil {
+				return fmt.Errorf("failed to import %s: %w", table.Name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user.Session, err = br.WAContainer.GetDevice(data.JID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load imported session: %w", err)
+	} else if user.Session == nil {
+		return nil, fmt.Errorf("imported data didn't contain a session for %s", data.JID)
+	}
+	user.Session.Log = waLog.Zerolog(user.zlog.With().Str("component", "whatsmeow").Str("db_section", "whatsmeow").Logger())
+	user.JID = data.JID
+	err = user.Update(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save user after importing session: %w", err)
+	}
+	user.addToJIDMap()
+	go user.Connect()
+	return user, nil
+}
+
+func (br *WABridge) importTable(ctx context.Context, name string, table *ExportedTable) error {
+	placeholders := make([]string, len(table.Columns))
+	for i, column := range table.Columns {
+		if !validColumnName.MatchString(column) {
+			return fmt.Errorf("%w: %q", errImportInvalidColumn, column)
+		}
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+	query := fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s) ON CONFLICT DO NOTHING",
+		name, strings.Join(table.Columns, ", "), strings.Join(placeholders, ", "),
+	)
+	for _, row := range table.Rows {
+		if len(row) != len(table.Columns) {
+			return fmt.Errorf("row has %d values, expected %d", len(row), len(table.Columns))
+		}
+		values := make([]any, len(row))
+		for i, val := range row {
+			values[i] = val.Value
+		}
+		_, err := br.DB.Exec(ctx, query, values...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"github.com/element-hq/mautrix-whatsapp/database"
+)
+
+type deliverySettingInfo struct {
+	Flag        database.DeliverySetting
+	Name        string
+	Description string
+}
+
+// deliverySettings lists the user-configurable receipt and typing notification types in the order they're shown
+// to users. Outgoing delivery receipts aren't included, as WhatsApp requires them for the message to be considered
+// received and they're always sent automatically.
+var deliverySettings = []deliverySettingInfo{
+	{database.DeliverySendReadReceipts, "send_read_receipts", "Send read receipts from Matrix to WhatsApp"},
+	{database.DeliveryReceiveReadReceipts, "receive_read_receipts", "Bridge read receipts from WhatsApp to Matrix"},
+	{database.DeliveryReceiveDeliveryReceipts, "receive_delivery_receipts", "Bridge delivery receipts from WhatsApp to Matrix"},
+	{database.DeliveryReceivePlayedReceipts, "receive_played_receipts", "Mark voice messages that were listened to on WhatsApp"},
+	{database.DeliverySendTyping, "send_typing", "Send typing notifications from Matrix to WhatsApp"},
+	{database.DeliveryReceiveTyping, "receive_typing", "Bridge typing notifications from WhatsApp to Matrix"},
+}
+
+func getDeliverySetting(name string) (database.DeliverySetting, bool) {
+	for _, setting := range deliverySettings {
+		if setting.Name == name {
+			return setting.Flag, true
+		}
+	}
+	return 0, false
+}
+
+// DeliverySettings is the provisioning API representation of database.DeliverySetting, where true means enabled.
+type DeliverySettings map[string]bool
+
+func (user *User) GetDeliverySettings() DeliverySettings {
+	settings := make(DeliverySettings, len(deliverySettings))
+	for _, setting := range deliverySettings {
+		settings[setting.Name] = user.IsDeliveryEnabled(setting.Flag)
+	}
+	return settings
+}
+
+func (user *User) IsDeliveryEnabled(flag database.DeliverySetting) bool {
+	return !user.DisabledDelivery.Has(flag)
+}
+
+func (user *User) SetDeliveryEnabled(flag database.DeliverySetting, enabled bool) {
+	if enabled {
+		user.DisabledDelivery &^= flag
+	} else {
+		user.DisabledDelivery |= flag
+	}
+}
@@ -24,13 +24,26 @@ import (
 	"github.com/rs/zerolog"
 
 	"github.com/element-hq/mautrix-go"
+	"github.com/element-hq/mautrix-go/appservice"
 	"github.com/element-hq/mautrix-go/id"
 
 	"github.com/element-hq/mautrix-whatsapp/database"
 )
 
+const (
+	DisappearingActionRedact = "redact"
+	DisappearingActionMark   = "mark"
+	DisappearingActionNone   = "none"
+)
+
+// ExpiredMessageReaction is the reaction used to mark expired messages when the disappearing message action is "mark".
+const ExpiredMessageReaction = "⌛"
+
+const disappearingCheckInterval = 30 * time.Second
+const disappearingBatchSize = 100
+
 func (portal *Portal) MarkDisappearing(ctx context.Context, eventID id.EventID, expiresIn time.Duration, startsAt time.Time) {
-	if expiresIn == 0 {
+	if expiresIn == 0 || portal.bridge.Config.Bridge.DisappearingMessages.Action == DisappearingActionNone || portal.KeepDisappearing {
 		return
 	}
 	expiresAt := startsAt.Add(expiresIn)
@@ -40,63 +53,111 @@ func (portal *Portal) MarkDisappearing(ctx context.Context, eventID id.EventID,
 	if err != nil {
 		zerolog.Ctx(ctx).Err(err).Msg("Failed to insert disappearing message")
 	}
-	if expiresAt.Before(time.Now().Add(1 * time.Hour)) {
-		go portal.sleepAndDelete(context.WithoutCancel(ctx), msg)
-	}
 }
 
-func (br *WABridge) SleepAndDeleteUpcoming(ctx context.Context) {
-	msgs, err := br.DB.DisappearingMessage.GetUpcomingScheduled(ctx, 1*time.Hour)
-	if err != nil {
-		zerolog.Ctx(ctx).Err(err).Msg("Failed to get upcoming disappearing messages")
-		return
-	}
-	for _, msg := range msgs {
-		portal := br.GetPortalByMXID(msg.RoomID)
-		if portal == nil {
+// DisappearingMessageLoop periodically makes messages disappear from Matrix after their WhatsApp timer elapses.
+func (br *WABridge) DisappearingMessageLoop() {
+	log := br.ZLog.With().Str("action", "disappearing message loop").Logger()
+	ctx := log.WithContext(context.Background())
+	for {
+		msgs, err := br.DB.DisappearingMessage.GetDue(ctx, disappearingBatchSize)
+		if err != nil {
+			log.Err(err).Msg("Failed to get expired disappearing messages")
+		}
+		for _, msg := range msgs {
+			portal := br.GetPortalByMXID(msg.RoomID)
+			if portal != nil {
+				portal.expireDisappearingMessage(ctx, msg)
+			}
 			err = msg.Delete(ctx)
 			if err != nil {
-				zerolog.Ctx(ctx).Err(err).
-					Stringer("event_id", msg.EventID).
-					Msg("Failed to delete disappearing message row with no portal")
+				log.Err(err).Stringer("event_id", msg.EventID).Msg("Failed to delete disappearing message row from database")
 			}
-		} else {
-			go portal.sleepAndDelete(ctx, msg)
+		}
+		if len(msgs) < disappearingBatchSize {
+			time.Sleep(disappearingCheckInterval)
 		}
 	}
 }
 
-func (portal *Portal) sleepAndDelete(ctx context.Context, msg *database.DisappearingMessage) {
-	if _, alreadySleeping := portal.currentlySleepingToDelete.LoadOrStore(msg.EventID, true); alreadySleeping {
+func (portal *Portal) expireDisappearingMessage(ctx context.Context, msg *database.DisappearingMessage) {
+	log := zerolog.Ctx(ctx).With().
+		Stringer("room_id", msg.RoomID).
+		Stringer("event_id", msg.EventID).
+		Logger()
+	var err error
+	action := portal.bridge.Config.Bridge.DisappearingMessages.Action
+	if portal.KeepDisappearing {
+		// The user chose to keep disappearing messages after this one was scheduled
+		action = DisappearingActionNone
+	}
+	switch action {
+	case DisappearingActionMark:
+		err = portal.bridge.Bot.EnsureJoined(ctx, msg.RoomID, appservice.EnsureJoinedParams{BotOverride: portal.MainIntent().Client})
+		if err == nil {
+			_, err = portal.bridge.Bot.SendReaction(ctx, msg.RoomID, msg.EventID, ExpiredMessageReaction)
+		}
+	case DisappearingActionNone:
+		log.Debug().Msg("Disappearing messages are disabled, not removing expired event")
 		return
+	default:
+		_, err = portal.MainIntent().RedactEvent(ctx, msg.RoomID, msg.EventID, mautrix.ReqRedact{
+			Reason: "Message expired",
+			TxnID:  fmt.Sprintf("mxwa_disappear_%s", msg.EventID),
+		})
 	}
-	defer portal.currentlySleepingToDelete.Delete(msg.EventID)
-	log := zerolog.Ctx(ctx)
-
-	sleepTime := msg.ExpireAt.Sub(time.Now())
-	log.Debug().
-		Stringer("room_id", portal.MXID).
-		Stringer("event_id", msg.EventID).
-		Dur("sleep_time", sleepTime).
-		Msg("Sleeping before making message disappear")
-	time.Sleep(sleepTime)
-	_, err := portal.MainIntent().RedactEvent(ctx, msg.RoomID, msg.EventID, mautrix.ReqRedact{
-		Reason: "Message expired",
-		TxnID:  fmt.Sprintf("mxwa_disappear_%s", msg.EventID),
-	})
 	if err != nil {
-		log.Err(err).
-			Stringer("room_id", portal.MXID).
-			Stringer("event_id", msg.EventID).
-			Msg("Failed to make event disappear")
+		log.Err(err).Msg("Failed to make event disappear")
 	} else {
-		log.Debug().
-			Stringer("room_id", portal.MXID).
-			Stringer("event_id", msg.EventID).
-			Msg("Disappeared event")
+		log.Debug().Msg("Disappeared event")
+	}
+}
+
+// SetKeepDisappearing changes whether disappearing messages are kept in the Matrix room after they expire.
+// Enabling it also cancels the removal of messages that are already scheduled to disappear.
+func (portal *Portal) SetKeepDisappearing(ctx context.Context, keep bool) error {
+	portal.KeepDisappearing = keep
+	err := portal.Update(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to save portal: %w", err)
+	}
+	if keep && len(portal.MXID) > 0 {
+		err = portal.bridge.DB.DisappearingMessage.DeleteAllInRoom(ctx, portal.MXID)
+		if err != nil {
+			return fmt.Errorf("failed to cancel scheduled disappearing messages: %w", err)
+		}
+	}
+	return nil
+}
+
+// promptKeepDisappearing asks the user whether disappearing messages should be kept on Matrix
+// after the disappearing timer is enabled in the chat.
+func (portal *Portal) promptKeepDisappearing(ctx context.Context, user *User) {
+	if user == nil || portal.ExpirationTime == 0 || portal.KeepDisappearing ||
+		portal.bridge.Config.Bridge.DisappearingMessages.Action == DisappearingActionNone {
+		return
+	}
+	// The bot isn't always in DMs, so let the DM ghost invite it if necessary.
+	err := portal.bridge.Bot.EnsureJoined(ctx, portal.MXID, appservice.EnsureJoinedParams{BotOverride: portal.MainIntent().Client})
+	if err == nil {
+		_, err = user.SendPrompt(ctx, portal.bridge.Bot, portal.MXID,
+			"Disappearing messages will also expire in this room. React with ✅ to keep them on Matrix instead.",
+			PromptKeepDisappearing, "")
+	}
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to send prompt about keeping disappearing messages")
+	}
+}
+
+func (portal *Portal) answerKeepDisappearingPrompt(ctx context.Context, user *User, accepted bool) (string, error) {
+	if !accepted {
+		return "", nil
+	} else if !user.Admin && !portal.isRoomAdmin(ctx, user) {
+		return "Only room admins and bridge admins can change this setting", nil
 	}
-	err = msg.Delete(ctx)
+	err := portal.SetKeepDisappearing(ctx, true)
 	if err != nil {
-		log.Err(err).Msg("Failed to delete disapperaing message row in database after redacting event")
+		return "", err
 	}
+	return "Disappearing messages will be kept in this room", nil
 }
@@ -0,0 +1,80 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/element-hq/mautrix-go"
+)
+
+var errDoublePuppetMismatch = errors.New("access token belongs to a different user")
+
+// DoublePuppetHealthLoop periodically checks that the access tokens of all double puppets still work, so that
+// broken double puppeting doesn't silently degrade read receipts and presence.
+func (br *WABridge) DoublePuppetHealthLoop() {
+	log := br.ZLog.With().Str("action", "double puppet health check").Logger()
+	ctx := log.WithContext(context.Background())
+	for {
+		time.Sleep(br.Config.Bridge.DoublePuppetCheckInterval)
+		puppets := br.GetAllPuppetsWithCustomMXID()
+		log.Debug().Int("puppet_count", len(puppets)).Msg("Checking double puppet access tokens")
+		for _, puppet := range puppets {
+			puppet.checkDoublePuppetHealth(ctx)
+		}
+	}
+}
+
+func (puppet *Puppet) checkDoublePuppetHealth(ctx context.Context) {
+	intent := puppet.customIntent
+	if intent == nil || puppet.CustomMXID == "" {
+		return
+	}
+	mxid := puppet.CustomMXID
+	log := zerolog.Ctx(ctx).With().
+		Stringer("puppet_jid", puppet.JID).
+		Stringer("custom_mxid", mxid).
+		Logger()
+	resp, err := intent.Whoami(ctx)
+	if err != nil && !errors.Is(err, mautrix.MUnknownToken) && !errors.Is(err, mautrix.MMissingToken) {
+		// Network errors and such don't mean the token is broken, so just try again next time.
+		log.Warn().Err(err).Msg("Failed to check double puppet access token")
+		return
+	} else if err == nil && resp.UserID == mxid {
+		return
+	}
+	if err == nil {
+		err = errDoublePuppetMismatch
+	}
+	log.Warn().Err(err).Msg("Double puppet access token is no longer valid, trying to refresh it")
+	// StartCustomMXID logs in again with the shared secret if there is one, and clears the custom MXID if it fails.
+	err = puppet.StartCustomMXID(true)
+	if err == nil {
+		log.Info().Msg("Refreshed double puppet access token")
+		return
+	}
+	log.Warn().Err(err).Msg("Failed to refresh double puppet access token, disabled double puppeting")
+	user := puppet.bridge.GetUserByMXIDIfExists(mxid)
+	if user != nil {
+		user.sendMarkdownBridgeAlert(ctx, "Double puppeting was disabled because your Matrix access token stopped working (%v). "+
+			"Read receipts and presence won't be bridged from your Matrix account until you enable it again with `login-matrix`.", err)
+	}
+}
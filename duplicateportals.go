@@ -0,0 +1,115 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/element-hq/mautrix-go/event"
+
+	"github.com/element-hq/mautrix-whatsapp/database"
+)
+
+// MergeDuplicatePrivateChatPortals finds private chat portals whose key contains a device or legacy server JID
+// (which older versions of the bridge could create next to the normalized portal), moves their message
+// mappings to the normalized portal and tombstones the duplicate rooms.
+func (br *WABridge) MergeDuplicatePrivateChatPortals() {
+	log := br.ZLog.With().Str("action", "merge duplicate private chat portals").Logger()
+	ctx := log.WithContext(context.Background())
+	dbPortals, err := br.DB.Portal.GetAll(ctx)
+	if err != nil {
+		log.Err(err).Msg("Failed to get portals to check for duplicates")
+		return
+	}
+	for _, dbPortal := range dbPortals {
+		if dbPortal.Key.JID.Server != types.DefaultUserServer && dbPortal.Key.JID.Server != types.LegacyUserServer {
+			continue
+		}
+		canonicalKey := database.NewPortalKey(dbPortal.Key.JID, dbPortal.Key.Receiver)
+		if canonicalKey == dbPortal.Key {
+			continue
+		}
+		duplicate := br.GetExistingPortalByJID(dbPortal.Key)
+		canonical := br.GetPortalByJID(canonicalKey)
+		if duplicate == nil || canonical == nil {
+			log.Warn().
+				Str("duplicate_key", dbPortal.Key.String()).
+				Str("canonical_key", canonicalKey.String()).
+				Msg("Failed to load portals for merging")
+			continue
+		}
+		br.mergeDuplicatePortal(ctx, duplicate, canonical)
+	}
+}
+
+func (br *WABridge) mergeDuplicatePortal(ctx context.Context, duplicate, canonical *Portal) {
+	log := zerolog.Ctx(ctx).With().
+		Str("duplicate_key", duplicate.Key.String()).
+		Stringer("duplicate_mxid", duplicate.MXID).
+		Str("canonical_key", canonical.Key.String()).
+		Stringer("canonical_mxid", canonical.MXID).
+		Logger()
+	ctx = log.WithContext(ctx)
+	log.Info().Msg("Merging duplicate private chat portal")
+
+	canonical.roomCreateLock.Lock()
+	defer canonical.roomCreateLock.Unlock()
+	err := br.DB.Message.MoveToChat(ctx, duplicate.Key, canonical.Key)
+	if err != nil {
+		log.Err(err).Msg("Failed to move message mappings to canonical portal")
+		return
+	}
+	if canonical.MXID == "" && duplicate.MXID != "" {
+		// The normalized portal doesn't have a room yet, so just adopt the room of the duplicate.
+		roomID := duplicate.MXID
+		duplicate.Delete(ctx)
+		canonical.MXID = roomID
+		canonical.Name = duplicate.Name
+		canonical.NameSet = duplicate.NameSet
+		canonical.Avatar = duplicate.Avatar
+		canonical.AvatarURL = duplicate.AvatarURL
+		canonical.AvatarSet = duplicate.AvatarSet
+		canonical.Encrypted = duplicate.Encrypted
+		canonical.ExpirationTime = duplicate.ExpirationTime
+		canonical.FirstEventID = duplicate.FirstEventID
+		err = canonical.Update(ctx)
+		if err != nil {
+			log.Err(err).Msg("Failed to save canonical portal after adopting duplicate room")
+			return
+		}
+		br.portalsLock.Lock()
+		br.portalsByMXID[canonical.MXID] = canonical
+		br.portalsLock.Unlock()
+		log.Info().Msg("Moved duplicate portal room to canonical portal")
+		return
+	}
+	if duplicate.MXID != "" {
+		_, err = duplicate.MainIntent().SendStateEvent(ctx, duplicate.MXID, event.StateTombstone, "", &event.TombstoneEventContent{
+			Body:            "This chat has been merged into another room",
+			ReplacementRoom: canonical.MXID,
+		})
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to send tombstone to duplicate portal room")
+		}
+	}
+	duplicate.Delete(ctx)
+	duplicate.Cleanup(ctx, true)
+	log.Info().Msg("Merged duplicate portal into canonical portal")
+}
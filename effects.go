@@ -0,0 +1,118 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"unicode"
+
+	"github.com/element-hq/mautrix-go/event"
+)
+
+// LargeEmojiField marks messages that WhatsApp renders as large (and possibly animated) emoji.
+const LargeEmojiField = "fi.mau.whatsapp.large_emoji"
+
+// WhatsApp renders messages consisting of up to three emoji without any other text in a larger size.
+const largeEmojiMaxCount = 3
+
+// matrixMessageEffects contains the custom msgtypes that Element uses for message effects, along with
+// a fallback body for when the message doesn't have any text. WhatsApp doesn't have message effects,
+// so the text is bridged as a normal message.
+var matrixMessageEffects = map[event.MessageType]string{
+	"nic.custom.confetti":               "🎉",
+	"io.element.effect.snowfall":        "❄️",
+	"io.element.effects.space_invaders": "👾",
+	"io.element.effect.hearts":          "💝",
+	"io.element.effect.rainfall":        "🌧️",
+}
+
+func isEmojiRune(r rune) bool {
+	return unicode.Is(emojiTable, r)
+}
+
+func isEmojiModifierRune(r rune) bool {
+	return r == 0x200D || // Zero width joiner
+		r == 0xFE0F || r == 0xFE0E || // Variation selectors
+		r == 0x20E3 || // Combining enclosing keycap
+		(r >= 0x1F3FB && r <= 0x1F3FF) || // Skin tone modifiers
+		(r >= 0xE0020 && r <= 0xE007F) // Tags (used in subdivision flags)
+}
+
+// countOnlyEmoji returns the number of emoji in the given text, or -1 if it contains anything else.
+func countOnlyEmoji(text string) int {
+	runes := []rune(text)
+	count := 0
+	joined := false
+	regionalIndicators := 0
+	for i, r := range runes {
+		switch {
+		case unicode.IsSpace(r):
+			joined = false
+		case r == 0x200D:
+			joined = true
+		case isEmojiModifierRune(r):
+		case r >= 0x1F1E6 && r <= 0x1F1FF:
+			// Flags are pairs of regional indicators
+			regionalIndicators++
+			if regionalIndicators%2 == 1 {
+				count++
+			}
+		case (r >= '0' && r <= '9') || r == '#' || r == '*':
+			// Digits are only emoji as a part of a keycap sequence
+			next := i + 1
+			if next < len(runes) && runes[next] == 0xFE0F {
+				next++
+			}
+			if next >= len(runes) || runes[next] != 0x20E3 {
+				return -1
+			}
+			count++
+		case isEmojiRune(r):
+			if !joined {
+				count++
+			}
+			joined = false
+		default:
+			return -1
+		}
+	}
+	return count
+}
+
+// addLargeEmojiHint marks emoji-only messages so that clients can enlarge or animate them like WhatsApp does.
+// The body is left as-is, so that the original text is preserved.
+func addLargeEmojiHint(content *event.MessageEventContent, extra map[string]any) {
+	if content.Format != "" {
+		return
+	}
+	count := countOnlyEmoji(content.Body)
+	if count < 1 || count > largeEmojiMaxCount {
+		return
+	}
+	extra[LargeEmojiField] = true
+}
+
+// convertMatrixMessageEffect turns Element message effects into plain text messages.
+func convertMatrixMessageEffect(content *event.MessageEventContent) {
+	fallback, ok := matrixMessageEffects[content.MsgType]
+	if !ok {
+		return
+	}
+	content.MsgType = event.MsgText
+	if content.Body == "" {
+		content.Body = fallback
+	}
+}
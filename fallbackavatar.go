@@ -0,0 +1,157 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"sync"
+	"unicode"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const fallbackAvatarSize = 256
+
+var fallbackAvatarColors = []color.RGBA{
+	{R: 0xe5, G: 0x39, B: 0x35, A: 0xff},
+	{R: 0xd8, G: 0x1b, B: 0x60, A: 0xff},
+	{R: 0x8e, G: 0x24, B: 0xaa, A: 0xff},
+	{R: 0x5e, G: 0x35, B: 0xb1, A: 0xff},
+	{R: 0x39, G: 0x49, B: 0xab, A: 0xff},
+	{R: 0x1e, G: 0x88, B: 0xe5, A: 0xff},
+	{R: 0x00, G: 0x89, B: 0x7b, A: 0xff},
+	{R: 0x43, G: 0xa0, B: 0x47, A: 0xff},
+	{R: 0xf4, G: 0x51, B: 0x1e, A: 0xff},
+	{R: 0x6d, G: 0x4c, B: 0x41, A: 0xff},
+}
+
+var getFallbackAvatarFont = sync.OnceValues(func() (*opentype.Font, error) {
+	return opentype.Parse(gobold.TTF)
+})
+
+// uploadFallbackAvatar generates a placeholder avatar for a puppet whose real avatar
+// is hidden by privacy settings and uploads it as the puppet's avatar URL.
+func (puppet *Puppet) uploadFallbackAvatar(ctx context.Context) bool {
+	log := zerolog.Ctx(ctx)
+	data, err := generateFallbackAvatar(puppet.bridge.Config.Bridge.FallbackAvatarStyle, puppet.JID.User, puppet.Displayname)
+	if err != nil {
+		log.Err(err).Msg("Failed to generate fallback avatar")
+		return false
+	}
+	resp, err := puppet.DefaultIntent().UploadBytes(ctx, data, "image/png")
+	if err != nil {
+		log.Err(err).Msg("Failed to upload fallback avatar")
+		return false
+	}
+	log.Debug().Stringer("avatar_url", resp.ContentURI).Msg("Uploaded fallback avatar")
+	puppet.AvatarURL = resp.ContentURI
+	puppet.AvatarSet = false
+	return true
+}
+
+func generateFallbackAvatar(style, seed, name string) ([]byte, error) {
+	hash := sha256.Sum256([]byte(seed))
+	fg := fallbackAvatarColors[int(hash[0])%len(fallbackAvatarColors)]
+	img := image.NewRGBA(image.Rect(0, 0, fallbackAvatarSize, fallbackAvatarSize))
+	var err error
+	switch style {
+	case "initials":
+		draw.Draw(img, img.Bounds(), image.NewUniform(fg), image.Point{}, draw.Src)
+		err = drawInitial(img, name)
+	case "identicon":
+		draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{R: 0xf0, G: 0xf0, B: 0xf0, A: 0xff}), image.Point{}, draw.Src)
+		drawIdenticon(img, hash, fg)
+	default:
+		err = fmt.Errorf("unknown fallback avatar style %q", style)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = png.Encode(&buf, img)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode avatar: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func drawInitial(img *image.RGBA, name string) error {
+	initial := '#'
+	for _, char := range name {
+		if unicode.IsLetter(char) {
+			initial = unicode.ToUpper(char)
+			break
+		}
+	}
+	parsedFont, err := getFallbackAvatarFont()
+	if err != nil {
+		return fmt.Errorf("failed to parse font: %w", err)
+	}
+	face, err := opentype.NewFace(parsedFont, &opentype.FaceOptions{
+		Size:    fallbackAvatarSize / 2,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create font face: %w", err)
+	}
+	defer face.Close()
+	drawer := &font.Drawer{
+		Dst:  img,
+		Src:  image.White,
+		Face: face,
+	}
+	bounds, _ := drawer.BoundString(string(initial))
+	width := bounds.Max.X - bounds.Min.X
+	height := bounds.Max.Y - bounds.Min.Y
+	drawer.Dot = fixed.Point26_6{
+		X: (fixed.I(fallbackAvatarSize)-width)/2 - bounds.Min.X,
+		Y: (fixed.I(fallbackAvatarSize)-height)/2 - bounds.Min.Y,
+	}
+	drawer.DrawString(string(initial))
+	return nil
+}
+
+// drawIdenticon draws a horizontally symmetric 5x5 grid of cells chosen by the hash.
+func drawIdenticon(img *image.RGBA, hash [sha256.Size]byte, fg color.RGBA) {
+	const cells = 5
+	const padding = fallbackAvatarSize / 8
+	cellSize := (fallbackAvatarSize - 2*padding) / cells
+	fill := image.NewUniform(fg)
+	for y := 0; y < cells; y++ {
+		for x := 0; x < (cells+1)/2; x++ {
+			if hash[1+y*3+x]%2 == 0 {
+				continue
+			}
+			for _, col := range []int{x, cells - 1 - x} {
+				rect := image.Rect(padding+col*cellSize, padding+y*cellSize, padding+(col+1)*cellSize, padding+(y+1)*cellSize)
+				draw.Draw(img, rect, fill, image.Point{}, draw.Src)
+			}
+		}
+	}
+}
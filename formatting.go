@@ -39,6 +39,17 @@ var strikethroughRegex = regexp.MustCompile("([\\s>_*]|^)~(.+?)~([^a-zA-Z\\d]|$)
 var codeBlockRegex = regexp.MustCompile("```(?:.|\n)+?```")
 var inlineURLRegex = regexp.MustCompile(`\[(.+?)]\((.+?)\)`)
 
+var markdownEscaper = strings.NewReplacer(
+	"\\", "\\\\", "*", "\\*", "_", "\\_", "~", "\\~", "`", "\\`", "#", "\\#", "|", "\\|",
+	"[", "\\[", "]", "\\]", "(", "\\(", ")", "\\)", "<", "\\<", ">", "\\>", "!", "\\!",
+)
+
+// escapeMarkdown escapes user-provided text, like WhatsApp names, so that it can be safely inserted into
+// notices that are rendered as markdown.
+func escapeMarkdown(text string) string {
+	return markdownEscaper.Replace(text)
+}
+
 const mentionedJIDsContextKey = "fi.mau.whatsapp.mentioned_jids"
 const allowedMentionsContextKey = "fi.mau.whatsapp.allowed_mentions"
 
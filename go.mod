@@ -21,6 +21,7 @@ require (
 	golang.org/x/net v0.24.0
 	golang.org/x/sync v0.7.0
 	google.golang.org/protobuf v1.33.0
+	maunium.net/go/mauflag v1.0.0
 )
 
 require (
@@ -47,5 +48,4 @@ require (
 	golang.org/x/text v0.14.0 // indirect
 	gopkg.in/natefinch/lumberjack.v2 v2.2.1 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
-	maunium.net/go/mauflag v1.0.0 // indirect
 )
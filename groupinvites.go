@@ -0,0 +1,228 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/element-hq/mautrix-go/id"
+
+	"github.com/element-hq/mautrix-whatsapp/database"
+)
+
+const defaultGroupInviteExpiry = 7 * 24 * time.Hour
+
+func parseGroupInvitePolicy(str string) (database.GroupInvitePolicy, bool) {
+	switch policy := database.GroupInvitePolicy(str); policy {
+	case database.GroupInviteAlways, database.GroupInviteAsk, database.GroupInviteIgnore:
+		return policy, true
+	default:
+		return "", false
+	}
+}
+
+// GetGroupInvitePolicy returns the user's group invite policy, falling back to the bridge-wide default.
+func (user *User) GetGroupInvitePolicy() database.GroupInvitePolicy {
+	if user.GroupInvitePolicy != "" {
+		return user.GroupInvitePolicy
+	}
+	policy, ok := parseGroupInvitePolicy(user.bridge.Config.Bridge.GroupInvites.DefaultPolicy)
+	if !ok {
+		return database.GroupInviteAlways
+	}
+	return policy
+}
+
+func (user *User) loadPendingGroupInvites(ctx context.Context) map[types.JID]struct{} {
+	if user.pendingGroupInvites != nil {
+		return user.pendingGroupInvites
+	}
+	invites, err := user.bridge.DB.PendingGroupInvite.GetAll(ctx, user.MXID)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to load pending group invites")
+		return nil
+	}
+	user.pendingGroupInvites = make(map[types.JID]struct{}, len(invites))
+	for _, invite := range invites {
+		user.pendingGroupInvites[invite.GroupJID] = struct{}{}
+	}
+	return user.pendingGroupInvites
+}
+
+// HasPendingGroupInvite returns true if the user hasn't yet decided whether the given group should be bridged.
+func (user *User) HasPendingGroupInvite(ctx context.Context, chat types.JID) bool {
+	if chat.Server != types.GroupServer {
+		return false
+	}
+	user.pendingGroupInvitesLock.Lock()
+	defer user.pendingGroupInvitesLock.Unlock()
+	_, ok := user.loadPendingGroupInvites(ctx)[chat]
+	return ok
+}
+
+// applyGroupInvitePolicy handles a group the user was added to when the user's policy isn't to bridge it right away.
+func (user *User) applyGroupInvitePolicy(ctx context.Context, info *types.GroupInfo) {
+	log := zerolog.Ctx(ctx)
+	switch user.GetGroupInvitePolicy() {
+	case database.GroupInviteIgnore:
+		log.Debug().Msg("Ignoring joined group as per the user's group invite policy")
+		err := user.SetChatFilter(ctx, info.JID, database.ChatFilterDeny)
+		if err != nil {
+			log.Err(err).Msg("Failed to add joined group to ignore list")
+		}
+	case database.GroupInviteAsk:
+		if user.HasPendingGroupInvite(ctx, info.JID) {
+			return
+		}
+		expiry := user.bridge.Config.Bridge.GroupInvites.Expiry
+		if expiry == 0 {
+			expiry = defaultGroupInviteExpiry
+		}
+		name := info.Name
+		if name == "" {
+			name = info.JID.User
+		}
+		invite := user.bridge.DB.PendingGroupInvite.New()
+		invite.UserMXID = user.MXID
+		invite.GroupJID = info.JID
+		invite.GroupName = name
+		invite.ExpiresAt = time.Now().Add(expiry)
+		var err error
+		invite.NoticeMXID, err = sendPromptNotice(ctx, user.bridge.Bot, user.GetManagementRoom(ctx), fmt.Sprintf(
+			"You were added to the WhatsApp group **%s** (`%s`).\n\n"+
+				"Reply `accept` or react with ✅ to bridge it, or reply `ignore` or react with ❌ to ignore it. "+
+				"If you don't answer by %s, the group will be ignored.",
+			name, info.JID, invite.ExpiresAt.Format(time.RFC1123),
+		))
+		if err != nil {
+			// Bridge the group rather than silently dropping it if we can't ask the user
+			log.Err(err).Msg("Failed to send group invite notice, creating portal instead")
+			portal := user.GetPortalByJID(info.JID)
+			err = portal.CreateMatrixRoom(ctx, user, info, nil, true, true)
+			if err != nil {
+				log.Err(err).Msg("Failed to create Matrix room after join notification")
+			}
+			return
+		}
+		user.pendingGroupInvitesLock.Lock()
+		err = invite.Upsert(ctx)
+		if user.pendingGroupInvites != nil && err == nil {
+			user.pendingGroupInvites[info.JID] = struct{}{}
+		}
+		user.pendingGroupInvitesLock.Unlock()
+		if err != nil {
+			log.Err(err).Msg("Failed to save pending group invite")
+		} else {
+			log.Debug().Stringer("notice_mxid", invite.NoticeMXID).Msg("Asked user whether joined group should be bridged")
+		}
+	}
+}
+
+func (user *User) removePendingGroupInvite(ctx context.Context, invite *database.PendingGroupInvite) error {
+	user.pendingGroupInvitesLock.Lock()
+	defer user.pendingGroupInvitesLock.Unlock()
+	delete(user.pendingGroupInvites, invite.GroupJID)
+	return invite.Delete(ctx)
+}
+
+// AcceptPendingGroupInvite creates the portal for a group that was waiting for the user's decision.
+func (user *User) AcceptPendingGroupInvite(ctx context.Context, invite *database.PendingGroupInvite) error {
+	if !user.IsLoggedIn() {
+		return fmt.Errorf("you're not logged in")
+	}
+	info, err := user.Client.GetGroupInfo(invite.GroupJID)
+	if err != nil {
+		return fmt.Errorf("failed to get group info: %w", err)
+	}
+	err = user.removePendingGroupInvite(ctx, invite)
+	if err != nil {
+		return fmt.Errorf("failed to remove pending invite: %w", err)
+	}
+	portal := user.GetPortalByJID(invite.GroupJID)
+	if len(portal.MXID) > 0 {
+		portal.UpdateMatrixRoom(ctx, user, info, nil)
+		return nil
+	}
+	return portal.CreateMatrixRoom(ctx, user, info, nil, true, true)
+}
+
+// IgnorePendingGroupInvite adds a group that was waiting for the user's decision to the user's ignore list.
+func (user *User) IgnorePendingGroupInvite(ctx context.Context, invite *database.PendingGroupInvite) error {
+	err := user.SetChatFilter(ctx, invite.GroupJID, database.ChatFilterDeny)
+	if err != nil {
+		return fmt.Errorf("failed to add group to ignore list: %w", err)
+	}
+	err = user.removePendingGroupInvite(ctx, invite)
+	if err != nil {
+		return fmt.Errorf("failed to remove pending invite: %w", err)
+	}
+	return nil
+}
+
+// resolveGroupInvitePrompt finds the pending group invite that the given management room notice asked about.
+func (br *WABridge) resolveGroupInvitePrompt(ctx context.Context, user *User, promptID id.EventID) PromptHandler {
+	invite, err := br.DB.PendingGroupInvite.GetByNotice(ctx, user.MXID, promptID)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Stringer("prompt_event_id", promptID).Msg("Failed to get pending group invite")
+		return nil
+	} else if invite == nil {
+		return nil
+	}
+	return func(ctx context.Context, user *User, accepted bool) (string, error) {
+		if !accepted {
+			if err := user.IgnorePendingGroupInvite(ctx, invite); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Ignored **%s**", invite.GroupName), nil
+		} else if err := user.AcceptPendingGroupInvite(ctx, invite); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Accepted **%s**, the portal should be created momentarily", invite.GroupName), nil
+	}
+}
+
+// ExpirePendingGroupInvites ignores all pending group invites that the user didn't answer in time.
+func (br *WABridge) ExpirePendingGroupInvites(ctx context.Context) {
+	log := zerolog.Ctx(ctx)
+	invites, err := br.DB.PendingGroupInvite.GetExpired(ctx)
+	if err != nil {
+		log.Err(err).Msg("Failed to get expired pending group invites")
+		return
+	}
+	for _, invite := range invites {
+		user := br.GetUserByMXIDIfExists(invite.UserMXID)
+		if user == nil {
+			err = invite.Delete(ctx)
+		} else {
+			err = user.IgnorePendingGroupInvite(ctx, invite)
+		}
+		if err != nil {
+			log.Err(err).
+				Stringer("user_mxid", invite.UserMXID).
+				Stringer("group_jid", invite.GroupJID).
+				Msg("Failed to expire pending group invite")
+		}
+	}
+	if len(invites) > 0 {
+		log.Info().Int("count", len(invites)).Msg("Expired pending group invites")
+	}
+}
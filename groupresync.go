@@ -0,0 +1,134 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/element-hq/mautrix-go/bridge/status"
+
+	"github.com/element-hq/mautrix-whatsapp/database"
+)
+
+const (
+	defaultGroupResyncDelay = 5 * time.Second
+	// groupResyncProgressInterval is the number of groups synced between bridge state progress updates.
+	groupResyncProgressInterval = 10
+)
+
+// shouldResyncGroups checks whether the bridge was disconnected long enough that the metadata of group portals
+// may be outdated. It must be called after the connection is established.
+func (user *User) shouldResyncGroups() bool {
+	cfg := &user.bridge.Config.Bridge.GroupResync
+	user.connectedSinceLock.Lock()
+	disconnectedAt, connectedSince := user.disconnectedAt, user.connectedSince
+	user.connectedSinceLock.Unlock()
+	if disconnectedAt.IsZero() {
+		return cfg.AfterStartup
+	}
+	return cfg.OfflineThreshold > 0 && connectedSince.Sub(disconnectedAt) >= cfg.OfflineThreshold
+}
+
+// startGroupResync re-syncs all group portals in the background if the connection was down for a long time.
+func (user *User) startGroupResync() {
+	if !user.shouldResyncGroups() || !user.groupResyncRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer user.groupResyncRunning.Store(false)
+	log := user.zlog.With().Str("action", "resync groups after reconnect").Logger()
+	ctx := log.WithContext(context.Background())
+	err := user.resyncAllGroups(ctx)
+	if err != nil {
+		log.Err(err).Msg("Failed to re-sync group metadata after reconnecting")
+	}
+}
+
+func (user *User) resyncAllGroups(ctx context.Context) error {
+	log := zerolog.Ctx(ctx)
+	groups, err := user.Client.GetJoinedGroups()
+	if err != nil {
+		return fmt.Errorf("failed to get group list from server: %w", err)
+	}
+	user.groupListCacheLock.Lock()
+	user.groupListCache = groups
+	user.groupListCacheTime = time.Now()
+	user.groupListCacheLock.Unlock()
+
+	delay := user.bridge.Config.Bridge.GroupResync.Delay
+	if delay == 0 {
+		delay = defaultGroupResyncDelay
+	}
+	type groupPortal struct {
+		portal *Portal
+		info   *types.GroupInfo
+	}
+	bridged := make([]groupPortal, 0, len(groups))
+	for _, group := range groups {
+		portal := user.bridge.GetExistingPortalByJID(database.NewPortalKey(group.JID, user.JID))
+		if portal != nil && len(portal.MXID) > 0 {
+			bridged = append(bridged, groupPortal{portal, group})
+		}
+	}
+	total := len(bridged)
+	if total == 0 {
+		return nil
+	}
+	log.Info().Int("group_count", total).Dur("delay", delay).Msg("Re-syncing metadata of all group portals")
+	user.sendGroupResyncState(0, total)
+	for i, item := range bridged {
+		if !user.IsLoggedIn() {
+			return fmt.Errorf("connection lost after syncing %d/%d groups", i, total)
+		} else if i > 0 {
+			time.Sleep(delay)
+			if i%groupResyncProgressInterval == 0 {
+				user.sendGroupResyncState(i, total)
+			}
+		}
+		item.portal.UpdateMatrixRoom(ctx, user, item.info, nil)
+	}
+	log.Info().Int("group_count", total).Msg("Finished re-syncing group portal metadata")
+	user.sendGroupResyncState(total, total)
+	return nil
+}
+
+// sendGroupResyncState reports the progress of the group re-sync as a bridge state, unless the bridge has
+// something more important to report, like a disconnection.
+func (user *User) sendGroupResyncState(done, total int) {
+	switch user.BridgeState.GetPrev().StateEvent {
+	case status.StateConnected, status.StateBackfilling:
+	default:
+		return
+	}
+	info := map[string]interface{}{
+		"group_resync_done":  done,
+		"group_resync_total": total,
+	}
+	if done >= total {
+		user.BridgeState.Send(status.BridgeState{StateEvent: status.StateConnected, Info: info})
+	} else {
+		user.BridgeState.Send(status.BridgeState{
+			StateEvent: status.StateBackfilling,
+			Message:    fmt.Sprintf("re-syncing group metadata (%d/%d)", done, total),
+			Info:       info,
+		})
+	}
+}
@@ -66,8 +66,10 @@ func (user *User) handleHistorySyncsLoop() {
 		// Start the backfill queue.
 		user.BackfillQueue = &BackfillQueue{
 			BackfillQuery:   user.bridge.DB.BackfillQueue,
+			SchedulerQuery:  user.bridge.DB.BackfillScheduler,
 			reCheckChannels: []chan bool{},
 		}
+		user.BackfillQueue.LoadState(user.zlog.With().Str("action", "load backfill queue state").Logger().WithContext(context.TODO()), user.MXID)
 
 		forwardAndImmediate := []database.BackfillType{database.BackfillImmediate, database.BackfillForward}
 
@@ -87,6 +89,8 @@ func (user *User) handleHistorySyncsLoop() {
 		go user.dailyMediaRequestLoop()
 	}
 
+	user.resumeInitialSync()
+
 	// Always save the history syncs for the user. If they want to enable
 	// backfilling in the future, we will have it in the database.
 	for {
@@ -97,10 +101,14 @@ func (user *User) handleHistorySyncsLoop() {
 			}
 			user.storeHistorySync(evt.Data)
 		case <-user.enqueueBackfillsTimer.C:
+			limit, hold := user.getInitialBackfillLimit()
+			if hold {
+				continue
+			}
 			if batchSend {
-				user.enqueueAllBackfills()
+				user.enqueueAllBackfills(limit)
 			} else {
-				user.backfillAll()
+				user.backfillAll(limit)
 			}
 		}
 	}
@@ -108,12 +116,12 @@ func (user *User) handleHistorySyncsLoop() {
 
 const EnqueueBackfillsDelay = 30 * time.Second
 
-func (user *User) enqueueAllBackfills() {
+func (user *User) enqueueAllBackfills(limit int) {
 	log := user.zlog.With().
 		Str("method", "User.enqueueAllBackfills").
 		Logger()
 	ctx := log.WithContext(context.TODO())
-	nMostRecent, err := user.bridge.DB.HistorySync.GetRecentConversations(ctx, user.MXID, user.bridge.Config.Bridge.HistorySync.MaxInitialConversations)
+	nMostRecent, err := user.bridge.DB.HistorySync.GetRecentConversations(ctx, user.MXID, limit)
 	if err != nil {
 		log.Err(err).Msg("Failed to get recent history sync conversations from database")
 		return
@@ -142,7 +150,7 @@ func (user *User) enqueueAllBackfills() {
 	user.BackfillQueue.ReCheck()
 }
 
-func (user *User) backfillAll() {
+func (user *User) backfillAll(limit int) {
 	log := user.zlog.With().
 		Str("method", "User.backfillAll").
 		Logger()
@@ -157,7 +165,6 @@ func (user *User) backfillAll() {
 	log.Info().
 		Int("conversation_count", len(conversations)).
 		Msg("Probably received all history sync blobs, now backfilling conversations")
-	limit := user.bridge.Config.Bridge.HistorySync.MaxInitialConversations
 	bridgedCount := 0
 	// Find the portals for all the conversations.
 	for _, conv := range conversations {
@@ -167,6 +174,14 @@ func (user *User) backfillAll() {
 				Str("conversation_id", conv.ConversationID).
 				Msg("Failed to parse chat JID in history sync")
 			continue
+		} else if user.IsChatFiltered(ctx, jid) {
+			log.Debug().Str("chat_jid", jid.String()).Msg("Skipping filtered chat in history sync")
+			err = user.bridge.DB.HistorySync.DeleteConversation(ctx, user.MXID, conv.ConversationID)
+			if err != nil {
+				log.Err(err).Str("chat_jid", jid.String()).
+					Msg("Failed to delete history sync conversation of filtered chat from database")
+			}
+			continue
 		}
 		portal := user.GetPortalByJID(jid)
 		if portal.MXID != "" {
@@ -323,6 +338,7 @@ func (user *User) dailyMediaRequestLoop() {
 }
 
 func (user *User) backfillInChunks(ctx context.Context, req *database.BackfillTask, conv *database.HistorySyncConversation, portal *Portal) {
+	ctx = WithRequestPriority(ctx, PriorityBackfill)
 	portal.backfillLock.Lock()
 	defer portal.backfillLock.Unlock()
 	log := zerolog.Ctx(ctx)
@@ -428,7 +444,7 @@ func (user *User) backfillInChunks(ctx context.Context, req *database.BackfillTa
 			Msg("Sending notice that there are disappeared messages in the chat")
 		resp, err := portal.sendMessage(ctx, portal.MainIntent(), event.EventMessage, &event.MessageEventContent{
 			MsgType: event.MsgNotice,
-			Body:    portal.formatDisappearingMessageNotice(),
+			Body:    portal.formatDisappearingMessageNotice(user),
 		}, nil, conv.LastMessageTimestamp.UnixMilli())
 		if err != nil {
 			log.Err(err).Msg("Failed to send disappeared messages notice event")
@@ -451,32 +467,56 @@ func (user *User) backfillInChunks(ctx context.Context, req *database.BackfillTa
 		return
 	}
 
+	maxBatchEvents := req.MaxBatchEvents
+	if batchCap := user.bridge.Config.Bridge.HistorySync.Scheduler.MaxBatchEvents; batchCap > 0 && (maxBatchEvents < 0 || maxBatchEvents > batchCap) {
+		maxBatchEvents = batchCap
+	}
 	log.Info().
 		Int("message_count", len(allMsgs)).
-		Int("max_batch_events", req.MaxBatchEvents).
+		Int("max_batch_events", maxBatchEvents).
 		Msg("Backfilling messages")
+	var indicator *ProcessingIndicator
+	if len(allMsgs) >= user.bridge.Config.Bridge.ProcessingIndicator.MinBackfillMessages {
+		indicator = portal.StartProcessingIndicator(ctx, fmt.Sprintf("Backfilling %d messages from WhatsApp...", len(allMsgs)))
+	}
 	toBackfill := allMsgs[0:]
 	for len(toBackfill) > 0 {
+		if user.BackfillQueue != nil && user.BackfillQueue.IsPaused() {
+			// The already backfilled batches have been deleted from the history sync store,
+			// so the rest will be picked up when the queue is resumed.
+			log.Info().Int("remaining_message_count", len(toBackfill)).Msg("Backfill queue was paused, stopping backfill")
+			if indicator != nil {
+				indicator.Finish(ctx, "Backfill paused")
+			}
+			return
+		}
 		var msgs []*waProto.WebMessageInfo
-		if len(toBackfill) <= req.MaxBatchEvents || req.MaxBatchEvents < 0 {
+		if len(toBackfill) <= maxBatchEvents || maxBatchEvents < 0 {
 			msgs = toBackfill
 			toBackfill = nil
 		} else {
-			msgs = toBackfill[:req.MaxBatchEvents]
-			toBackfill = toBackfill[req.MaxBatchEvents:]
+			msgs = toBackfill[:maxBatchEvents]
+			toBackfill = toBackfill[maxBatchEvents:]
 		}
 
 		if len(msgs) > 0 {
 			time.Sleep(time.Duration(req.BatchDelay) * time.Second)
 			log.Debug().Int("batch_message_count", len(msgs)).Msg("Backfilling message batch")
 			portal.backfill(ctx, user, msgs, forward, shouldMarkAsRead)
+			backfillState.MessageCount += len(msgs)
+			err = user.bridge.DB.HistorySync.DeleteMessages(ctx, user.MXID, conv.ConversationID, msgs)
+			if err != nil {
+				log.Err(err).Msg("Failed to delete history sync messages after backfilling batch")
+			}
+			if indicator != nil {
+				indicator.Update(ctx, fmt.Sprintf("Backfilling messages from WhatsApp... (%d/%d)", len(allMsgs)-len(toBackfill), len(allMsgs)))
+			}
 		}
 	}
-	log.Debug().Int("message_count", len(allMsgs)).Msg("Finished backfilling messages in queue entry")
-	err = user.bridge.DB.HistorySync.DeleteMessages(ctx, user.MXID, conv.ConversationID, allMsgs)
-	if err != nil {
-		log.Err(err).Msg("Failed to delete history sync messages after backfilling")
+	if indicator != nil {
+		indicator.Finish(ctx, fmt.Sprintf("Finished backfilling %d messages from WhatsApp", len(allMsgs)))
 	}
+	log.Debug().Int("message_count", len(allMsgs)).Msg("Finished backfilling messages in queue entry")
 
 	if req.TimeStart == nil {
 		// If the time start is nil, then there's no more history to backfill.
@@ -500,6 +540,24 @@ func (user *User) backfillInChunks(ctx context.Context, req *database.BackfillTa
 			log.Err(err).Msg("Failed to mark backfill state as completed in database")
 		}
 		portal.updateBackfillStatus(ctx, backfillState)
+
+		// Every backward backfill task ends up here, so only report the chat as finished
+		// once there are no more stored history sync messages left to backfill.
+		hasMore, err := user.bridge.DB.HistorySync.ConversationHasMessages(ctx, user.MXID, portal.Key)
+		if err != nil {
+			log.Err(err).Msg("Failed to check if there are more history sync messages to backfill")
+		} else if !hasMore {
+			user.bridge.Webhooks.Send(WebhookBackfillComplete, map[string]any{
+				"user_id":       user.MXID,
+				"room_id":       portal.MXID,
+				"chat_jid":      portal.Key.JID,
+				"message_count": backfillState.MessageCount,
+			})
+			Analytics.Track(user.MXID, AnalyticsBackfillComplete, map[string]interface{}{
+				"chat_type":     portal.analyticsChatType(),
+				"message_count": backfillState.MessageCount,
+			})
+		}
 	}
 }
 
@@ -550,6 +608,9 @@ func (user *User) storeHistorySync(evt *waProto.HistorySync) {
 		} else if jid.Server == types.HiddenUserServer {
 			log.Debug().Str("chat_jid", jid.String()).Msg("Skipping hidden user JID chat in history sync")
 			continue
+		} else if user.IsChatFiltered(ctx, jid) {
+			log.Debug().Str("chat_jid", jid.String()).Msg("Skipping filtered chat in history sync")
+			continue
 		}
 		totalMessageCount += len(conv.GetMessages())
 		log := log.With().
@@ -664,6 +725,10 @@ func (user *User) storeHistorySync(evt *waProto.HistorySync) {
 		Int("total_message_count", totalMessageCount).
 		Msg("Finished storing history sync")
 
+	if isInitialSyncComplete(evt) {
+		user.markInitialSyncReceived(ctx)
+	}
+
 	// If this was the initial bootstrap, enqueue immediate backfills for the
 	// most recent portals. If it's the last history sync event, start
 	// backfilling the rest of the history of the portals.
@@ -752,9 +817,11 @@ var (
 )
 
 func (portal *Portal) backfill(ctx context.Context, source *User, messages []*waProto.WebMessageInfo, isForward, atomicMarkAsRead bool) {
+	ctx = WithRequestPriority(ctx, PriorityBackfill)
 	log := zerolog.Ctx(ctx)
 	var req mautrix.ReqBeeperBatchSend
 	var infos []*wrappedInfo
+	var toConvert []*backfillMessage
 
 	req.Forward = isForward
 	if atomicMarkAsRead {
@@ -800,18 +867,26 @@ func (portal *Portal) backfill(ctx context.Context, source *User, messages []*wa
 		if puppet == nil {
 			continue
 		}
-
-		converted := portal.convertMessage(ctx, puppet.IntentFor(portal), source, &msgEvt.Info, msgEvt.Message, true)
+		toConvert = append(toConvert, &backfillMessage{
+			ctx:    ctx,
+			raw:    webMsg,
+			evt:    msgEvt,
+			intent: puppet.IntentFor(portal),
+		})
+	}
+	portal.convertBackfillMessages(source, toConvert)
+	for _, msg := range toConvert {
+		converted := msg.converted
 		if converted == nil {
-			log.Debug().Msg("Skipping unsupported message in backfill")
+			zerolog.Ctx(msg.ctx).Debug().Msg("Skipping unsupported message in backfill")
 			continue
 		}
 		if converted.ReplyTo != nil {
-			portal.SetReply(ctx, converted.Content, converted.ReplyTo, true)
+			portal.SetReply(msg.ctx, converted.Content, converted.ReplyTo, true)
 		}
-		err = portal.appendBatchEvents(ctx, source, converted, &msgEvt.Info, webMsg, &req.Events, &infos)
+		err := portal.appendBatchEvents(msg.ctx, source, converted, &msg.evt.Info, msg.raw, &req.Events, &infos)
 		if err != nil {
-			log.Err(err).Msg("Failed to handle message in backfill")
+			zerolog.Ctx(msg.ctx).Err(err).Msg("Failed to handle message in backfill")
 		}
 	}
 	log.Info().Int("event_count", len(req.Events)).Msg("Made Matrix events from messages in batch")
@@ -835,6 +910,12 @@ func (portal *Portal) backfill(ctx context.Context, source *User, messages []*wa
 	log.Info().Msg("Successfully sent backfill batch")
 	if portal.bridge.Config.Bridge.HistorySync.MediaRequests.AutoRequestMedia {
 		go portal.requestMediaRetries(context.TODO(), source, resp.EventIDs, infos)
+	} else if portal.shouldAutoRetryMedia(true) {
+		for i, info := range infos {
+			if info != nil && info.Error == database.MsgErrMediaNotFound {
+				portal.enqueueMediaRetry(ctx, source, info.ID, resp.EventIDs[i])
+			}
+		}
 	}
 }
 
@@ -988,18 +1069,27 @@ func (portal *Portal) wrapBatchEvent(ctx context.Context, info *types.MessageInf
 }
 
 func (portal *Portal) finishBatch(ctx context.Context, eventIDs []id.EventID, infos []*wrappedInfo) error {
+	msgs := make([]*database.Message, 0, len(infos))
+	for i, info := range infos {
+		if info != nil {
+			msgs = append(msgs, portal.newDBMessage(info.MessageInfo, eventIDs[i], info.SenderMXID, true, info.Type, 0, info.Error))
+		}
+	}
+	err := portal.bridge.DB.Message.BulkInsert(ctx, msgs)
+	if err != nil {
+		return fmt.Errorf("failed to insert messages: %w", err)
+	}
 	for i, info := range infos {
 		if info == nil {
 			continue
 		}
 
 		eventID := eventIDs[i]
-		portal.markHandled(ctx, nil, info.MessageInfo, eventID, info.SenderMXID, true, false, info.Type, 0, info.Error)
 		if info.Type == database.MsgReaction {
 			portal.upsertReaction(ctx, nil, info.ReactionTarget, info.Sender, eventID, info.ID)
 		}
 
-		if info.ExpiresIn > 0 {
+		if info.ExpiresIn > 0 && portal.bridge.Config.Bridge.DisappearingMessages.Backfill {
 			portal.MarkDisappearing(ctx, eventID, info.ExpiresIn, info.ExpirationStart)
 		}
 	}
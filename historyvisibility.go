@@ -0,0 +1,251 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/element-hq/mautrix-go/bridge/commands"
+	"github.com/element-hq/mautrix-go/event"
+	"github.com/element-hq/mautrix-go/id"
+)
+
+func isValidHistoryVisibility(visibility event.HistoryVisibility) bool {
+	switch visibility {
+	case event.HistoryVisibilityInvited, event.HistoryVisibilityJoined,
+		event.HistoryVisibilityShared, event.HistoryVisibilityWorldReadable:
+		return true
+	default:
+		return false
+	}
+}
+
+// getHistoryVisibility returns the history visibility that should be used for the room, or an empty string if
+// the homeserver default should be used.
+func (portal *Portal) getHistoryVisibility() event.HistoryVisibility {
+	if portal.HistoryVisibility != "" {
+		return event.HistoryVisibility(portal.HistoryVisibility)
+	}
+	return event.HistoryVisibility(portal.bridge.Config.Bridge.LateJoiners.HistoryVisibility)
+}
+
+func (portal *Portal) getKeyShareCount() int {
+	if portal.KeyShareCount != 0 {
+		return max(portal.KeyShareCount, 0)
+	}
+	return portal.bridge.Config.Bridge.LateJoiners.KeyShareCount
+}
+
+func (portal *Portal) getHistoryVisibilityInitialState() *event.Event {
+	visibility := portal.getHistoryVisibility()
+	if visibility == "" {
+		return nil
+	}
+	return &event.Event{
+		Type: event.StateHistoryVisibility,
+		Content: event.Content{
+			Parsed: &event.HistoryVisibilityEventContent{HistoryVisibility: visibility},
+		},
+	}
+}
+
+// HandleLateJoiner shares the keys of recent messages with Matrix users who join an encrypted portal,
+// so that they can read recent context regardless of when the messages were encrypted.
+func (br *WABridge) HandleLateJoiner(ctx context.Context, evt *event.Event) {
+	content := evt.Content.AsMember()
+	if content.Membership != event.MembershipJoin || evt.StateKey == nil {
+		return
+	}
+	if evt.Unsigned.PrevContent != nil {
+		_ = evt.Unsigned.PrevContent.ParseRaw(evt.Type)
+		if prev, ok := evt.Unsigned.PrevContent.Parsed.(*event.MemberEventContent); ok && prev.Membership == event.MembershipJoin {
+			return
+		}
+	}
+	userID := id.UserID(*evt.StateKey)
+	if userID == br.Bot.UserID || br.IsGhost(userID) {
+		return
+	}
+	portal := br.GetPortalByMXID(evt.RoomID)
+	if portal == nil || !portal.Encrypted || br.Crypto == nil {
+		return
+	}
+	count := portal.getKeyShareCount()
+	if portal.getSharedAccessOwner(ctx, userID) != nil {
+		count = max(count, sharedAccessKeyShareCount)
+	}
+	if count > 0 {
+		go portal.shareRecentKeys(context.WithoutCancel(ctx), userID, count)
+	}
+}
+
+func (portal *Portal) shareRecentKeys(ctx context.Context, userID id.UserID, count int) {
+	log := zerolog.Ctx(ctx).With().
+		Str("action", "share recent keys").
+		Stringer("room_id", portal.MXID).
+		Stringer("target_user_id", userID).
+		Logger()
+	mach := portal.bridge.GetOlmMachine()
+	if mach == nil {
+		log.Warn().Msg("End-to-bridge encryption isn't initialized, can't share keys")
+		return
+	}
+	msgs, err := portal.bridge.DB.Message.GetLastNInChat(ctx, portal.Key, count)
+	if err != nil {
+		log.Err(err).Msg("Failed to get recent messages")
+		return
+	}
+	sessions := make(map[id.SessionID]id.SenderKey)
+	for _, msg := range msgs {
+		evt, err := portal.MainIntent().GetEvent(ctx, portal.MXID, msg.MXID)
+		if err != nil {
+			log.Debug().Err(err).Stringer("event_id", msg.MXID).Msg("Failed to get event to find its session")
+			continue
+		} else if evt.Type != event.EventEncrypted {
+			continue
+		}
+		_ = evt.Content.ParseRaw(evt.Type)
+		encrypted := evt.Content.AsEncrypted()
+		if encrypted.SessionID != "" {
+			sessions[encrypted.SessionID] = encrypted.SenderKey
+		}
+	}
+	if len(sessions) == 0 {
+		log.Debug().Msg("No recent encrypted messages to share keys for")
+		return
+	}
+	devices := mach.LoadDevices(ctx, userID)
+	if len(devices) == 0 {
+		log.Warn().Msg("Didn't find any devices to share keys with")
+		return
+	}
+	shared := 0
+	for sessionID, senderKey := range sessions {
+		if senderKey == "" {
+			senderKey = mach.OwnIdentity().IdentityKey
+		}
+		igs, err := mach.CryptoStore.GetGroupSession(ctx, portal.MXID, senderKey, sessionID)
+		if err != nil || igs == nil {
+			log.Debug().Err(err).Stringer("session_id", sessionID).Msg("Group session not available for sharing")
+			continue
+		}
+		exportedKey, err := igs.Internal.Export(igs.Internal.FirstKnownIndex())
+		if err != nil {
+			log.Err(err).Stringer("session_id", sessionID).Msg("Failed to export group session")
+			continue
+		}
+		content := event.Content{
+			Parsed: &event.ForwardedRoomKeyEventContent{
+				RoomKeyEventContent: event.RoomKeyEventContent{
+					Algorithm:  id.AlgorithmMegolmV1,
+					RoomID:     igs.RoomID,
+					SessionID:  igs.ID(),
+					SessionKey: string(exportedKey),
+				},
+				SenderKey:          senderKey,
+				ForwardingKeyChain: igs.ForwardingChains,
+				SenderClaimedKey:   igs.SigningKey,
+			},
+		}
+		for _, device := range devices {
+			if device.Trust == id.TrustStateBlacklisted {
+				continue
+			}
+			err = mach.SendEncryptedToDevice(ctx, device, event.ToDeviceForwardedRoomKey, content)
+			if err != nil {
+				log.Warn().Err(err).Stringer("device_id", device.DeviceID).Msg("Failed to send forwarded room key")
+			}
+		}
+		shared++
+	}
+	log.Info().Int("session_count", shared).Int("device_count", len(devices)).Msg("Shared recent keys with new member")
+}
+
+var cmdHistoryVisibility = &commands.FullHandler{
+	Func: wrapCommand(fnHistoryVisibility),
+	Name: "history-visibility",
+	Help: commands.HelpMeta{
+		Section: HelpSectionPortalManagement,
+		Description: "View or change who can see the history of the current portal, and how many recent messages " +
+			"newly joined Matrix users receive encryption keys for.",
+		Args: "[<joined|invited|shared|world_readable|default> [_key count_|default|off]]",
+	},
+	RequiresPortal: true,
+}
+
+func fnHistoryVisibility(ce *WrappedCommandEvent) {
+	if len(ce.Args) == 0 {
+		visibility := ce.Portal.getHistoryVisibility()
+		if visibility == "" {
+			visibility = "server default"
+		}
+		ce.Reply("History visibility: `%s`, keys of the last %d messages are shared with new members",
+			visibility, ce.Portal.getKeyShareCount())
+		return
+	}
+	if !ce.requirePortalAdmin() {
+		return
+	}
+	visibility := event.HistoryVisibility(strings.ToLower(ce.Args[0]))
+	if visibility == "default" {
+		visibility = ""
+	} else if !isValidHistoryVisibility(visibility) {
+		ce.Reply("**Usage:** `history-visibility <joined|invited|shared|world_readable|default> [key count|default|off]`")
+		return
+	} else if visibility == event.HistoryVisibilityWorldReadable && !ce.User.Admin {
+		ce.Reply("Only bridge admins can make portal history world readable")
+		return
+	}
+	if len(ce.Args) > 1 {
+		switch strings.ToLower(ce.Args[1]) {
+		case "default":
+			ce.Portal.KeyShareCount = 0
+		case "off", "0":
+			ce.Portal.KeyShareCount = -1
+		default:
+			count, err := strconv.Atoi(ce.Args[1])
+			if err != nil || count < 0 {
+				ce.Reply("Key count must be a non-negative number")
+				return
+			}
+			ce.Portal.KeyShareCount = count
+		}
+	}
+	ce.Portal.HistoryVisibility = string(visibility)
+	err := ce.Portal.Update(ce.Ctx)
+	if err != nil {
+		ce.ZLog.Err(err).Msg("Failed to save portal after changing history visibility")
+		ce.Reply("Failed to save settings: %v", err)
+		return
+	}
+	if newVisibility := ce.Portal.getHistoryVisibility(); newVisibility != "" {
+		_, err = ce.Portal.MainIntent().SendStateEvent(ce.Ctx, ce.Portal.MXID, event.StateHistoryVisibility, "", &event.HistoryVisibilityEventContent{
+			HistoryVisibility: newVisibility,
+		})
+		if err != nil {
+			ce.ZLog.Err(err).Msg("Failed to update history visibility state")
+			ce.Reply("Saved settings, but failed to update the room's history visibility: %v", err)
+			return
+		}
+	}
+	ce.Reply("History visibility set to `%s`, keys of the last %d messages will be shared with new members",
+		ce.Portal.getHistoryVisibility(), ce.Portal.getKeyShareCount())
+}
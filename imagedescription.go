@@ -0,0 +1,115 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const defaultImageDescriptionTimeout = 10 * time.Second
+
+// ImageDescriber sends images to an external endpoint that generates alt text and extracts text from them.
+type ImageDescriber struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+// ImageDescription is the response from the image description endpoint.
+type ImageDescription struct {
+	Description string `json:"description,omitempty"`
+	Text        string `json:"text,omitempty"`
+}
+
+// NewImageDescriber creates an image describer from the config, or returns nil if image descriptions are disabled.
+func NewImageDescriber(br *WABridge) *ImageDescriber {
+	cfg := br.Config.Bridge.ImageDescriptions
+	if cfg.URL == "" {
+		return nil
+	}
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultImageDescriptionTimeout
+	}
+	return &ImageDescriber{
+		url:    cfg.URL,
+		apiKey: cfg.APIKey,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (describer *ImageDescriber) Describe(ctx context.Context, data []byte, mimeType string) (*ImageDescription, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, describer.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", mimeType)
+	if describer.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+describer.apiKey)
+	}
+	resp, err := describer.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	var desc ImageDescription
+	err = json.NewDecoder(resp.Body).Decode(&desc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	desc.Description = strings.TrimSpace(desc.Description)
+	desc.Text = strings.TrimSpace(desc.Text)
+	return &desc, nil
+}
+
+// addImageDescription describes a downloaded image and attaches the result to the converted message.
+// The body is only replaced if the image doesn't have a caption, as the body is used as alt text by clients.
+func (portal *Portal) addImageDescription(ctx context.Context, converted *ConvertedMessage, data []byte, mimeType string) {
+	desc, err := portal.bridge.ImageDescriber.Describe(ctx, data, mimeType)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to get image description")
+		return
+	} else if len(desc.Description) == 0 && len(desc.Text) == 0 {
+		return
+	}
+	if converted.Extra == nil {
+		converted.Extra = map[string]any{}
+	}
+	converted.Extra["fi.mau.whatsapp.image_description"] = desc
+	if converted.Caption != nil {
+		return
+	}
+	var body []string
+	if len(desc.Description) > 0 {
+		body = append(body, desc.Description)
+	}
+	if len(desc.Text) > 0 {
+		body = append(body, "Text in image: "+desc.Text)
+	}
+	converted.Content.Body = strings.Join(body, "\n\n")
+}
@@ -0,0 +1,248 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/element-hq/mautrix-go/bridge/commands"
+
+	"github.com/element-hq/mautrix-whatsapp/database"
+)
+
+type InitialSyncChoice string
+
+const (
+	InitialSyncFull   InitialSyncChoice = "full"
+	InitialSyncRecent InitialSyncChoice = "recent"
+	InitialSyncSkip   InitialSyncChoice = "skip"
+)
+
+var ErrNoInitialSyncPending = errors.New("there's no initial sync waiting for a decision")
+
+// initialSyncStatus guards the initial sync state of the user, which is stored in the database so that the
+// decision survives restarts.
+type initialSyncStatus struct {
+	lock sync.Mutex
+}
+
+// markInitialSyncPending puts backfilling on hold after login until the user decides what to do with the
+// initial sync. The caller is responsible for saving the user.
+func (user *User) markInitialSyncPending() {
+	user.initialSync.lock.Lock()
+	user.InitialSyncState = database.InitialSyncReceiving
+	user.InitialSyncLimit = 0
+	user.initialSync.lock.Unlock()
+}
+
+func (user *User) setInitialSyncState(ctx context.Context, state database.InitialSyncState, limit int) {
+	user.InitialSyncState = state
+	user.InitialSyncLimit = limit
+	err := user.Update(ctx)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Str("initial_sync_state", string(state)).Msg("Failed to save initial sync state")
+	}
+}
+
+// isInitialSyncComplete checks if the given history sync blob is the last part of the initial sync.
+func isInitialSyncComplete(evt *waProto.HistorySync) bool {
+	switch evt.GetSyncType() {
+	case waProto.HistorySync_INITIAL_BOOTSTRAP, waProto.HistorySync_RECENT, waProto.HistorySync_FULL:
+		return evt.GetProgress() >= 100
+	default:
+		return false
+	}
+}
+
+// markInitialSyncReceived allows the summary to be posted once the whole initial sync has been received,
+// so that it doesn't count a partial sync.
+func (user *User) markInitialSyncReceived(ctx context.Context) {
+	user.initialSync.lock.Lock()
+	defer user.initialSync.lock.Unlock()
+	if user.InitialSyncState == database.InitialSyncReceiving {
+		user.setInitialSyncState(ctx, database.InitialSyncReceived, 0)
+	}
+}
+
+// resumeInitialSync continues posting the summary or backfilling the chosen chats if the bridge was restarted
+// in the middle of it.
+func (user *User) resumeInitialSync() {
+	user.initialSync.lock.Lock()
+	state := user.InitialSyncState
+	user.initialSync.lock.Unlock()
+	if state == database.InitialSyncReceived || state == database.InitialSyncChosen {
+		user.enqueueBackfillsTimer.Reset(time.Second)
+	}
+}
+
+// getInitialBackfillLimit returns the maximum number of chats to backfill from the history syncs, and whether
+// backfilling should wait for the user to choose what to do with the initial sync. The summary of the synced
+// chats is posted to the management room once the whole initial sync has been received. The limit chosen by the
+// user only applies to the initial sync, later history syncs use the configured limit.
+func (user *User) getInitialBackfillLimit() (limit int, hold bool) {
+	limit = user.bridge.Config.Bridge.HistorySync.MaxInitialConversations
+	if !user.bridge.Config.Bridge.HistorySync.InitialSyncSummary.Enabled {
+		return limit, false
+	}
+	ctx := user.zlog.With().Str("action", "check initial sync state").Logger().WithContext(context.TODO())
+	user.initialSync.lock.Lock()
+	var sendSummary bool
+	switch user.InitialSyncState {
+	case database.InitialSyncReceiving, database.InitialSyncAwaitingChoice:
+		hold = true
+	case database.InitialSyncReceived:
+		user.setInitialSyncState(ctx, database.InitialSyncAwaitingChoice, 0)
+		sendSummary, hold = true, true
+	case database.InitialSyncChosen:
+		limit = user.InitialSyncLimit
+		user.setInitialSyncState(ctx, database.InitialSyncNone, 0)
+	}
+	user.initialSync.lock.Unlock()
+	if sendSummary {
+		user.sendInitialSyncSummary()
+	}
+	return limit, hold
+}
+
+func (user *User) sendInitialSyncSummary() {
+	log := user.zlog.With().Str("action", "send initial sync summary").Logger()
+	ctx := log.WithContext(context.TODO())
+	conversations, err := user.bridge.DB.HistorySync.GetRecentConversations(ctx, user.MXID, -1)
+	if err != nil {
+		log.Err(err).Msg("Failed to get history sync conversations for summary")
+		return
+	}
+	messageCounts, err := user.bridge.DB.HistorySync.CountMessages(ctx, user.MXID)
+	if err != nil {
+		log.Err(err).Msg("Failed to count history sync messages for summary")
+		return
+	}
+	perChatLimit := user.bridge.Config.Bridge.HistorySync.MessageCount
+	var dms, groups, other, expectedMessages int
+	for _, conv := range conversations {
+		jid, err := types.ParseJID(conv.ConversationID)
+		if err != nil {
+			continue
+		}
+		switch jid.Server {
+		case types.DefaultUserServer:
+			dms++
+		case types.GroupServer:
+			groups++
+		default:
+			other++
+		}
+		count := messageCounts[conv.ConversationID]
+		if perChatLimit >= 0 {
+			count = min(count, perChatLimit)
+		}
+		expectedMessages += count
+	}
+	recentChats := user.bridge.Config.Bridge.HistorySync.InitialSyncSummary.RecentChats
+	prefix := user.bridge.Config.Bridge.CommandPrefix
+	summary := fmt.Sprintf(
+		"Initial sync finished: found **%d** direct chats, **%d** groups and %d other chats with about **%d** messages to backfill.\n\n"+
+			"* React with ✅ or use `%s initial-sync full` to bridge all chats\n"+
+			"* Use `%s initial-sync recent` to only bridge the %d most recent chats\n"+
+			"* React with ❌ or use `%s initial-sync skip` to skip backfilling\n\n"+
+			"Other chats will still be bridged when you receive new messages in them.",
+		dms, groups, other, expectedMessages, prefix, prefix, recentChats, prefix,
+	)
+	log.Info().
+		Int("dm_count", dms).
+		Int("group_count", groups).
+		Int("expected_messages", expectedMessages).
+		Msg("Posting initial sync summary")
+	_, err = user.SendPrompt(ctx, user.bridge.Bot, user.GetManagementRoom(ctx), summary, PromptInitialSync, "")
+	if err != nil {
+		log.Err(err).Msg("Failed to send initial sync summary")
+	}
+}
+
+// ChooseInitialSync applies the user's decision about what to backfill from the initial sync.
+func (user *User) ChooseInitialSync(ctx context.Context, choice InitialSyncChoice) (string, error) {
+	limit := user.bridge.Config.Bridge.HistorySync.MaxInitialConversations
+	switch choice {
+	case InitialSyncFull:
+	case InitialSyncRecent:
+		limit = user.bridge.Config.Bridge.HistorySync.InitialSyncSummary.RecentChats
+	case InitialSyncSkip:
+		limit = 0
+	default:
+		return "", fmt.Errorf("unknown initial sync option %q", choice)
+	}
+	user.initialSync.lock.Lock()
+	if user.InitialSyncState != database.InitialSyncAwaitingChoice {
+		user.initialSync.lock.Unlock()
+		return "", ErrNoInitialSyncPending
+	}
+	if choice == InitialSyncSkip {
+		user.setInitialSyncState(ctx, database.InitialSyncNone, 0)
+	} else {
+		user.setInitialSyncState(ctx, database.InitialSyncChosen, limit)
+	}
+	user.initialSync.lock.Unlock()
+
+	if choice == InitialSyncSkip {
+		err := user.bridge.DB.HistorySync.DeleteAllConversations(ctx, user.MXID)
+		if err != nil {
+			return "", fmt.Errorf("failed to delete history sync data: %w", err)
+		}
+		return "Skipped backfilling the initial sync. New messages will still be bridged.", nil
+	}
+	user.enqueueBackfillsTimer.Reset(time.Second)
+	if choice == InitialSyncRecent {
+		return fmt.Sprintf("Backfilling the %d most recent chats.", limit), nil
+	}
+	return "Backfilling all chats.", nil
+}
+
+var cmdInitialSync = &commands.FullHandler{
+	Func: wrapCommand(fnInitialSync),
+	Name: "initial-sync",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionMiscellaneous,
+		Description: "Choose what to backfill after the initial login: all chats, only recent chats or nothing.",
+		Args:        "<full/recent/skip>",
+	},
+	RequiresLogin: true,
+}
+
+func fnInitialSync(ce *WrappedCommandEvent) {
+	if len(ce.Args) == 0 {
+		ce.Reply("**Usage:** `$cmdprefix initial-sync <full/recent/skip>`")
+		return
+	}
+	reply, err := ce.User.ChooseInitialSync(ce.Ctx, InitialSyncChoice(strings.ToLower(ce.Args[0])))
+	if errors.Is(err, ErrNoInitialSyncPending) {
+		ce.Reply("There's no initial sync waiting for a decision")
+	} else if err != nil {
+		ce.ZLog.Err(err).Msg("Failed to apply initial sync choice")
+		ce.Reply("Failed to apply choice: %v", err)
+	} else {
+		ce.Reply(reply)
+	}
+}
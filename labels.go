@@ -0,0 +1,130 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+
+	"go.mau.fi/whatsmeow/types/events"
+
+	"github.com/element-hq/mautrix-whatsapp/database"
+)
+
+func (user *User) labelTag(name string) string {
+	if len(user.bridge.Config.Bridge.LabelTagPrefix) == 0 || len(name) == 0 {
+		return ""
+	}
+	return user.bridge.Config.Bridge.LabelTagPrefix + name
+}
+
+func (user *User) handleLabelEdit(ctx context.Context, evt *events.LabelEdit) {
+	log := user.zlog.With().Str("action", "handle label edit").Str("label_id", evt.LabelID).Logger()
+	label, err := user.bridge.DB.Label.GetByID(ctx, user.MXID, evt.LabelID)
+	if err != nil {
+		log.Err(err).Msg("Failed to get label from database")
+		return
+	}
+	var oldName string
+	if label == nil {
+		label = user.bridge.DB.Label.New()
+		label.UserMXID = user.MXID
+		label.ID = evt.LabelID
+	} else if !label.Deleted {
+		oldName = label.Name
+	}
+	label.Name = evt.Action.GetName()
+	label.Color = evt.Action.GetColor()
+	label.Deleted = evt.Action.GetDeleted()
+	err = label.Upsert(ctx)
+	if err != nil {
+		log.Err(err).Msg("Failed to save label to database")
+		return
+	}
+	log.Debug().Str("name", label.Name).Bool("deleted", label.Deleted).Msg("Updated label")
+	if oldName == label.Name && !label.Deleted {
+		return
+	}
+	portals, err := user.bridge.DB.Label.GetPortals(ctx, user.MXID, label.ID)
+	if err != nil {
+		log.Err(err).Msg("Failed to get portals with label")
+		return
+	}
+	for _, key := range portals {
+		portal := user.bridge.GetExistingPortalByJID(key)
+		if portal == nil {
+			continue
+		}
+		user.updateChatTag(ctx, nil, portal, user.labelTag(oldName), false)
+		if !label.Deleted {
+			user.updateChatTag(ctx, nil, portal, user.labelTag(label.Name), true)
+		}
+	}
+	if label.Deleted {
+		err = label.ClearAssociations(ctx)
+		if err != nil {
+			log.Err(err).Msg("Failed to clear associations of deleted label")
+		}
+	}
+}
+
+func (user *User) handleLabelAssociation(ctx context.Context, evt *events.LabelAssociationChat) {
+	key := database.NewPortalKey(evt.JID, user.JID)
+	portal := user.bridge.GetExistingPortalByJID(key)
+	if portal == nil {
+		// Remember the association so the tag is applied if the portal is created later
+		err := user.bridge.DB.Label.SetPortalLabel(ctx, user.MXID, evt.LabelID, key, evt.Action.GetLabeled())
+		if err != nil {
+			user.zlog.Err(err).Str("label_id", evt.LabelID).Msg("Failed to save label association to database")
+		}
+		return
+	}
+	user.setPortalLabel(ctx, portal, evt.LabelID, evt.Action.GetLabeled())
+}
+
+func (user *User) setPortalLabel(ctx context.Context, portal *Portal, labelID string, labeled bool) {
+	log := user.zlog.With().
+		Str("action", "set portal label").
+		Str("label_id", labelID).
+		Stringer("portal_jid", portal.Key.JID).
+		Bool("labeled", labeled).
+		Logger()
+	err := user.bridge.DB.Label.SetPortalLabel(ctx, user.MXID, labelID, portal.Key, labeled)
+	if err != nil {
+		log.Err(err).Msg("Failed to save portal label to database")
+		return
+	}
+	label, err := user.bridge.DB.Label.GetByID(ctx, user.MXID, labelID)
+	if err != nil {
+		log.Err(err).Msg("Failed to get label from database")
+	} else if label != nil && !label.Deleted {
+		user.updateChatTag(ctx, nil, portal, user.labelTag(label.Name), labeled)
+	}
+}
+
+func (user *User) syncPortalLabelTags(ctx context.Context, portal *Portal) {
+	if len(user.bridge.Config.Bridge.LabelTagPrefix) == 0 {
+		return
+	}
+	labels, err := user.bridge.DB.Label.GetForPortal(ctx, user.MXID, portal.Key)
+	if err != nil {
+		user.zlog.Err(err).Stringer("portal_jid", portal.Key.JID).Msg("Failed to get portal labels from database")
+		return
+	}
+	for _, label := range labels {
+		user.updateChatTag(ctx, nil, portal, user.labelTag(label.Name), true)
+	}
+}
@@ -0,0 +1,207 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"github.com/element-hq/mautrix-go"
+	"github.com/element-hq/mautrix-go/event"
+
+	"github.com/element-hq/mautrix-whatsapp/database"
+)
+
+const (
+	lastSeenRequestTimeout         = 10 * time.Second
+	defaultLastSeenRefreshInterval = 1 * time.Hour
+	lastSeenSubscribeDelay         = 2 * time.Second
+)
+
+type lastSeenInfo struct {
+	Online   bool
+	LastSeen time.Time
+	Received time.Time
+}
+
+func (user *User) handlePresence(ctx context.Context, evt *events.Presence) {
+	jid := evt.From.ToNonAD()
+	info := lastSeenInfo{
+		Online:   !evt.Unavailable,
+		LastSeen: evt.LastSeen,
+		Received: time.Now(),
+	}
+	user.lastSeenLock.Lock()
+	user.lastSeenCache[jid] = info
+	waiters := user.lastSeenWaiters[jid]
+	delete(user.lastSeenWaiters, jid)
+	user.lastSeenLock.Unlock()
+	for _, ch := range waiters {
+		close(ch)
+	}
+
+	if user.bridge.Config.Bridge.LastSeenTopic.Enabled && !info.Online && !info.LastSeen.IsZero() {
+		portal := user.bridge.GetExistingPortalByJID(database.NewPortalKey(jid, user.JID))
+		if portal != nil && len(portal.MXID) > 0 {
+			portal.updateLastSeenTopic(ctx, info.LastSeen)
+		}
+	}
+}
+
+// fetchLastSeen subscribes to the presence of the given contact and waits for WhatsApp to send it.
+// The returned bool is false if nothing was received before the timeout, which usually means that
+// the contact's privacy settings hide their last seen time.
+func (user *User) fetchLastSeen(ctx context.Context, jid types.JID) (lastSeenInfo, bool) {
+	ch := make(chan struct{})
+	user.lastSeenLock.Lock()
+	user.lastSeenWaiters[jid] = append(user.lastSeenWaiters[jid], ch)
+	user.lastSeenLock.Unlock()
+	err := user.Client.SubscribePresence(jid)
+	if err != nil {
+		user.zlog.Warn().Err(err).Stringer("jid", jid).Msg("Failed to subscribe to presence")
+	}
+	select {
+	case <-ch:
+	case <-time.After(lastSeenRequestTimeout):
+	case <-ctx.Done():
+	}
+	user.lastSeenLock.Lock()
+	defer user.lastSeenLock.Unlock()
+	// The waiter is still in the map if nothing was received in time
+	if waiters := slices.DeleteFunc(user.lastSeenWaiters[jid], func(waiter chan struct{}) bool {
+		return waiter == ch
+	}); len(waiters) > 0 {
+		user.lastSeenWaiters[jid] = waiters
+	} else {
+		delete(user.lastSeenWaiters, jid)
+	}
+	info, ok := user.lastSeenCache[jid]
+	return info, ok
+}
+
+// isLastSeenTopic returns true if the topic is the private chat topic set by the bridge,
+// with or without a last seen annotation.
+func isLastSeenTopic(topic string) bool {
+	return topic == PrivateChatTopic || strings.HasPrefix(topic, PrivateChatTopic+" (last seen ")
+}
+
+// hasBridgeSetTopic checks that the room topic is still the one set by the bridge,
+// so that last seen annotations don't overwrite topics that were changed on Matrix.
+func (portal *Portal) hasBridgeSetTopic(ctx context.Context) bool {
+	if !isLastSeenTopic(portal.Topic) {
+		return false
+	}
+	var content event.TopicEventContent
+	err := portal.MainIntent().StateEvent(ctx, portal.MXID, event.StateTopic, "", &content)
+	if err != nil && !errors.Is(err, mautrix.MNotFound) {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to get current room topic")
+		return false
+	}
+	return content.Topic == portal.Topic
+}
+
+func (portal *Portal) updateLastSeenTopic(ctx context.Context, lastSeen time.Time) {
+	interval := portal.bridge.Config.Bridge.LastSeenTopic.RefreshInterval
+	if interval == 0 {
+		interval = defaultLastSeenRefreshInterval
+	}
+	portal.lastSeenTopicLock.Lock()
+	defer portal.lastSeenTopicLock.Unlock()
+	if time.Since(portal.lastSeenTopicUpdate) < interval || !portal.shouldSetDMRoomMetadata() {
+		return
+	}
+	portal.lastSeenTopicUpdate = time.Now()
+	if !portal.hasBridgeSetTopic(ctx) {
+		zerolog.Ctx(ctx).Debug().Msg("Not updating last seen time in topic that wasn't set by the bridge")
+		return
+	}
+	topic := fmt.Sprintf("%s (last seen %s)", PrivateChatTopic, lastSeen.UTC().Format("2006-01-02 15:04 MST"))
+	portal.UpdateTopic(ctx, topic, types.EmptyJID, true)
+}
+
+// startLastSeenRefreshLoop starts lastSeenRefreshLoop unless it's already running.
+func (user *User) startLastSeenRefreshLoop() {
+	user.lastSeenLock.Lock()
+	defer user.lastSeenLock.Unlock()
+	if user.lastSeenLoopCancel != nil {
+		return
+	}
+	var ctx context.Context
+	ctx, user.lastSeenLoopCancel = context.WithCancel(context.Background())
+	go user.lastSeenRefreshLoop(ctx)
+}
+
+// stopLastSeenRefreshLoop stops lastSeenRefreshLoop if it's running. It's called when the user logs out.
+func (user *User) stopLastSeenRefreshLoop() {
+	user.lastSeenLock.Lock()
+	defer user.lastSeenLock.Unlock()
+	if user.lastSeenLoopCancel != nil {
+		user.lastSeenLoopCancel()
+		user.lastSeenLoopCancel = nil
+	}
+}
+
+// lastSeenRefreshLoop periodically re-subscribes to the presence of all private chat contacts,
+// so that last seen annotations in portal topics stay reasonably fresh.
+func (user *User) lastSeenRefreshLoop(ctx context.Context) {
+	interval := user.bridge.Config.Bridge.LastSeenTopic.RefreshInterval
+	if interval == 0 {
+		interval = defaultLastSeenRefreshInterval
+	}
+	log := user.zlog.With().Str("action", "last seen refresh loop").Logger()
+	ctx = log.WithContext(ctx)
+	sleep := func(d time.Duration) bool {
+		select {
+		case <-time.After(d):
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	for {
+		if user.IsLoggedIn() {
+			privateChats, err := user.bridge.DB.Portal.FindPrivateChats(ctx, user.JID.ToNonAD())
+			if err != nil {
+				log.Err(err).Msg("Failed to get private chats to refresh last seen times")
+			}
+			for _, portal := range privateChats {
+				if len(portal.MXID) == 0 || !user.IsLoggedIn() {
+					continue
+				}
+				err = user.Client.SubscribePresence(portal.Key.JID)
+				if err != nil {
+					log.Debug().Err(err).Stringer("jid", portal.Key.JID).Msg("Failed to subscribe to presence")
+				}
+				if !sleep(lastSeenSubscribeDelay) {
+					break
+				}
+			}
+		}
+		if !sleep(interval) {
+			log.Debug().Msg("Stopping last seen refresh loop")
+			return
+		}
+	}
+}
@@ -0,0 +1,294 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/rs/zerolog"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/element-hq/mautrix-go/appservice"
+	"github.com/element-hq/mautrix-go/event"
+	"github.com/element-hq/mautrix-go/id"
+)
+
+var (
+	TypeMSC3672BeaconInfo = event.Type{Class: event.StateEventType, Type: "org.matrix.msc3672.beacon_info"}
+	TypeMSC3672Beacon     = event.Type{Class: event.MessageEventType, Type: "org.matrix.msc3672.beacon"}
+)
+
+// LiveLocationTimeout is how long a bridged live location share stays live on Matrix.
+// WhatsApp doesn't include the share duration in messages, so this is the longest duration the app allows.
+const LiveLocationTimeout = 8 * time.Hour
+
+type LocationAssetType string
+
+const (
+	LocationAssetSelf LocationAssetType = "m.self"
+	LocationAssetPin  LocationAssetType = "m.pin"
+)
+
+type MSC3488Location struct {
+	URI         string `json:"uri"`
+	Description string `json:"description,omitempty"`
+}
+
+type MSC3488Asset struct {
+	Type LocationAssetType `json:"type"`
+}
+
+type BeaconInfoContent struct {
+	Description string       `json:"description,omitempty"`
+	Live        bool         `json:"live"`
+	Timeout     int64        `json:"timeout"`
+	Timestamp   int64        `json:"org.matrix.msc3488.ts"`
+	Asset       MSC3488Asset `json:"org.matrix.msc3488.asset"`
+}
+
+type BeaconContent struct {
+	RelatesTo *event.RelatesTo `json:"m.relates_to"`
+	Location  MSC3488Location  `json:"org.matrix.msc3488.location"`
+	Timestamp int64            `json:"org.matrix.msc3488.ts"`
+}
+
+func (content *BeaconContent) GetRelatesTo() *event.RelatesTo {
+	if content.RelatesTo == nil {
+		content.RelatesTo = &event.RelatesTo{}
+	}
+	return content.RelatesTo
+}
+
+func (content *BeaconContent) OptionalGetRelatesTo() *event.RelatesTo {
+	return content.RelatesTo
+}
+
+func (content *BeaconContent) SetRelatesTo(rel *event.RelatesTo) {
+	content.RelatesTo = rel
+}
+
+func init() {
+	event.TypeMap[TypeMSC3672BeaconInfo] = reflect.TypeOf(BeaconInfoContent{})
+	event.TypeMap[TypeMSC3672Beacon] = reflect.TypeOf(BeaconContent{})
+}
+
+func makeGeoURI(lat, long float64, accuracy uint32) string {
+	if accuracy > 0 {
+		return fmt.Sprintf("geo:%.5f,%.5f;u=%d", lat, long, accuracy)
+	}
+	return fmt.Sprintf("geo:%.5f,%.5f", lat, long)
+}
+
+func formatCoordinates(lat, long float64) string {
+	latChar := 'N'
+	if lat < 0 {
+		latChar = 'S'
+	}
+	longChar := 'E'
+	if long < 0 {
+		longChar = 'W'
+	}
+	return fmt.Sprintf("%.4f° %c %.4f° %c", math.Abs(lat), latChar, math.Abs(long), longChar)
+}
+
+func makeLocationExtra(geoURI, description, text string, asset LocationAssetType, ts time.Time) map[string]interface{} {
+	extra := map[string]interface{}{
+		"org.matrix.msc3488.location": &MSC3488Location{URI: geoURI, Description: description},
+		"org.matrix.msc3488.asset":    &MSC3488Asset{Type: asset},
+		"org.matrix.msc1767.text":     text,
+	}
+	if !ts.IsZero() {
+		extra["org.matrix.msc3488.ts"] = ts.UnixMilli()
+	}
+	return extra
+}
+
+type liveLocationShare struct {
+	Intent         *appservice.IntentAPI
+	BeaconInfo     id.EventID
+	StartMessageID types.MessageID
+	Description    string
+	Started        time.Time
+}
+
+func (share *liveLocationShare) expired() bool {
+	return time.Since(share.Started) > LiveLocationTimeout
+}
+
+func (share *liveLocationShare) content(live bool) *BeaconInfoContent {
+	return &BeaconInfoContent{
+		Description: share.Description,
+		Live:        live,
+		Timeout:     LiveLocationTimeout.Milliseconds(),
+		Timestamp:   share.Started.UnixMilli(),
+		Asset:       MSC3488Asset{Type: LocationAssetSelf},
+	}
+}
+
+type outgoingLiveLocation struct {
+	Started  time.Time
+	Sequence int64
+}
+
+func (portal *Portal) getLiveLocationShare(ctx context.Context, intent *appservice.IntentAPI, info *types.MessageInfo, msg *waProto.LiveLocationMessage) (*liveLocationShare, error) {
+	portal.liveLocationLock.Lock()
+	defer portal.liveLocationLock.Unlock()
+	if portal.liveLocations == nil {
+		portal.liveLocations = make(map[types.JID]*liveLocationShare)
+	}
+	sender := info.Sender.ToNonAD()
+	share, ok := portal.liveLocations[sender]
+	if ok && !share.expired() {
+		return share, nil
+	} else if ok {
+		portal.sendBeaconInfo(ctx, share, false)
+	}
+	share = &liveLocationShare{
+		Intent:         intent,
+		StartMessageID: info.ID,
+		Description:    msg.GetCaption(),
+		Started:        info.Timestamp,
+	}
+	if time.Since(share.Started) > LiveLocationTimeout || share.Started.IsZero() {
+		share.Started = time.Now()
+	}
+	resp, err := intent.SendStateEvent(ctx, portal.MXID, TypeMSC3672BeaconInfo, intent.UserID.String(), share.content(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send beacon info: %w", err)
+	}
+	share.BeaconInfo = resp.EventID
+	portal.liveLocations[sender] = share
+	zerolog.Ctx(ctx).Debug().
+		Stringer("beacon_info_event_id", share.BeaconInfo).
+		Msg("Started bridging live location share")
+	return share, nil
+}
+
+func (portal *Portal) sendBeaconInfo(ctx context.Context, share *liveLocationShare, live bool) {
+	_, err := share.Intent.SendStateEvent(ctx, portal.MXID, TypeMSC3672BeaconInfo, share.Intent.UserID.String(), share.content(live))
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).
+			Stringer("beacon_info_event_id", share.BeaconInfo).
+			Bool("live", live).
+			Msg("Failed to update beacon info")
+	}
+}
+
+// stopLiveLocation marks the live location share started by the given WhatsApp message as no longer live.
+func (portal *Portal) stopLiveLocation(ctx context.Context, startMessageID types.MessageID) bool {
+	portal.liveLocationLock.Lock()
+	defer portal.liveLocationLock.Unlock()
+	for sender, share := range portal.liveLocations {
+		if share.StartMessageID == startMessageID {
+			portal.sendBeaconInfo(ctx, share, false)
+			delete(portal.liveLocations, sender)
+			return true
+		}
+	}
+	return false
+}
+
+func (portal *Portal) convertLiveLocationMessage(ctx context.Context, intent *appservice.IntentAPI, info *types.MessageInfo, msg *waProto.LiveLocationMessage, isBackfill bool) *ConvertedMessage {
+	geoURI := makeGeoURI(msg.GetDegreesLatitude(), msg.GetDegreesLongitude(), msg.GetAccuracyInMeters())
+	coordinates := formatCoordinates(msg.GetDegreesLatitude(), msg.GetDegreesLongitude())
+	expiresIn := time.Duration(msg.GetContextInfo().GetExpiration()) * time.Second
+	if !isBackfill && len(portal.MXID) > 0 {
+		share, err := portal.getLiveLocationShare(ctx, intent, info, msg)
+		if err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to start live location share, falling back to static location")
+		} else {
+			return &ConvertedMessage{
+				Intent: intent,
+				Type:   TypeMSC3672Beacon,
+				Content: &event.MessageEventContent{
+					Body: fmt.Sprintf("Live location: %s", coordinates),
+					RelatesTo: &event.RelatesTo{
+						Type:    event.RelReference,
+						EventID: share.BeaconInfo,
+					},
+				},
+				Extra:     makeLocationExtra(geoURI, share.Description, "", LocationAssetSelf, info.Timestamp),
+				ExpiresIn: expiresIn,
+			}
+		}
+	}
+	body := fmt.Sprintf("Live location: %s", coordinates)
+	if len(msg.GetCaption()) > 0 {
+		body += "\n" + msg.GetCaption()
+	}
+	return &ConvertedMessage{
+		Intent: intent,
+		Type:   event.EventMessage,
+		Content: &event.MessageEventContent{
+			MsgType: event.MsgLocation,
+			Body:    body,
+			GeoURI:  geoURI,
+		},
+		Extra:     makeLocationExtra(geoURI, msg.GetCaption(), body, LocationAssetSelf, info.Timestamp),
+		ReplyTo:   GetReply(msg.GetContextInfo()),
+		ExpiresIn: expiresIn,
+	}
+}
+
+func (portal *Portal) convertMatrixBeacon(ctx context.Context, sender *User, evt *event.Event) (*waProto.Message, *User, *extraConvertMeta, error) {
+	content, ok := evt.Content.Parsed.(*BeaconContent)
+	if !ok {
+		return nil, sender, nil, fmt.Errorf("%w %T", errUnexpectedParsedContentType, evt.Content.Parsed)
+	} else if content.RelatesTo == nil || content.RelatesTo.Type != event.RelReference {
+		return nil, sender, nil, fmt.Errorf("%w: beacon doesn't reference a beacon info event", errTargetNotFound)
+	}
+	lat, long, err := parseGeoURI(content.Location.URI)
+	if err != nil {
+		return nil, sender, nil, fmt.Errorf("%w: %v", errInvalidGeoURI, err)
+	}
+	portal.liveLocationLock.Lock()
+	if portal.outgoingLiveLocations == nil {
+		portal.outgoingLiveLocations = make(map[id.EventID]*outgoingLiveLocation)
+	}
+	for beaconInfoID, share := range portal.outgoingLiveLocations {
+		if time.Since(share.Started) > LiveLocationTimeout {
+			delete(portal.outgoingLiveLocations, beaconInfoID)
+		}
+	}
+	share, ok := portal.outgoingLiveLocations[content.RelatesTo.EventID]
+	if !ok {
+		share = &outgoingLiveLocation{Started: time.Now()}
+		portal.outgoingLiveLocations[content.RelatesTo.EventID] = share
+	}
+	share.Sequence++
+	sequence := share.Sequence
+	timeOffset := uint32(time.Since(share.Started).Seconds())
+	portal.liveLocationLock.Unlock()
+	msg := &waProto.Message{
+		LiveLocationMessage: &waProto.LiveLocationMessage{
+			DegreesLatitude:  proto.Float64(lat),
+			DegreesLongitude: proto.Float64(long),
+			SequenceNumber:   proto.Int64(sequence),
+			TimeOffset:       proto.Uint32(timeOffset),
+		},
+	}
+	if len(content.Location.Description) > 0 {
+		msg.LiveLocationMessage.Caption = proto.String(content.Location.Description)
+	}
+	return msg, sender, nil, nil
+}
@@ -19,6 +19,7 @@ package main
 import (
 	"context"
 	_ "embed"
+	"fmt"
 	"net/http"
 	"net/url"
 	"os"
@@ -30,6 +31,7 @@ import (
 	"github.com/rs/zerolog"
 	waLog "go.mau.fi/whatsmeow/util/log"
 	"google.golang.org/protobuf/proto"
+	flag "maunium.net/go/mauflag"
 
 	"go.mau.fi/whatsmeow"
 	waProto "go.mau.fi/whatsmeow/binary/proto"
@@ -64,29 +66,49 @@ var ExampleConfig string
 
 type WABridge struct {
 	bridge.Bridge
-	Config       *config.Config
-	DB           *database.Database
-	Provisioning *ProvisioningAPI
-	Formatter    *Formatter
-	Metrics      *MetricsHandler
-	WAContainer  *sqlstore.Container
-	WAVersion    string
-
-	PuppetActivity *PuppetActivity
+	Config         *config.Config
+	DB             *database.Database
+	Provisioning   *ProvisioningAPI
+	AdminAPI       *AdminAPI
+	Formatter      *Formatter
+	Metrics        *MetricsHandler
+	Webhooks       *WebhookSender
+	Translator     Translator
+	CloudAPI       *CloudAPIConnector
+	Transcriber    *TranscriptionClient
+	ImageDescriber *ImageDescriber
+	MediaScanner   *MediaScanner
+	Memberships    *MembershipCache
+	WAContainer    *sqlstore.Container
+	WAVersion      string
+
+	PuppetActivity    *PuppetActivity
+	BackfillScheduler *BackfillScheduler
 
 	usersByMXID         map[id.UserID]*User
 	usersByUsername     map[string]*User
 	usersLock           sync.Mutex
 	spaceRooms          map[id.RoomID]*User
 	spaceRoomsLock      sync.Mutex
-	managementRooms     map[id.RoomID]*User
+	managementRooms     map[id.RoomID][]*User
 	managementRoomsLock sync.Mutex
 	portalsByMXID       map[id.RoomID]*Portal
 	portalsByJID        map[database.PortalKey]*Portal
 	portalsLock         sync.Mutex
+	portalCreateLocks   map[database.PortalKey]*portalCreationLock
+	portalCreateLock    sync.Mutex
 	puppets             map[types.JID]*Puppet
 	puppetsByCustomMXID map[id.UserID]*Puppet
 	puppetsLock         sync.Mutex
+	announcementLock    sync.Mutex
+
+	moderationFeedDedup moderationFeedDedup
+
+	backfillMediaLimiter bandwidthLimiter
+	prompts              promptRegistry
+
+	lastDatabaseMaintenance time.Time
+	lastPortalCleanup       time.Time
 }
 
 func (br *WABridge) Init() {
@@ -96,8 +118,14 @@ func (br *WABridge) Init() {
 	// TODO this is a weird place for this
 	br.EventProcessor.On(event.EphemeralEventPresence, br.HandlePresence)
 	br.EventProcessor.On(TypeMSC3381PollStart, br.MatrixHandler.HandleMessage)
+	br.EventProcessor.On(TypeMSC3672Beacon, br.MatrixHandler.HandleMessage)
 	br.EventProcessor.On(TypeMSC3381PollResponse, br.MatrixHandler.HandleMessage)
 	br.EventProcessor.On(TypeMSC3381V2PollResponse, br.MatrixHandler.HandleMessage)
+	br.EventProcessor.On(event.EventReaction, br.HandleManagementRoomReaction)
+	br.EventProcessor.On(event.StateMember, br.HandleLateJoiner)
+	br.EventProcessor.On(event.StatePinnedEvents, br.HandleMatrixPinnedEvents)
+	br.RegisterPromptResolver(br.resolveStoredPrompt)
+	br.RegisterPromptResolver(br.resolveGroupInvitePrompt)
 
 	Analytics.log = br.ZLog.With().Str("component", "analytics").Logger()
 	Analytics.url = (&url.URL{
@@ -105,13 +133,23 @@ func (br *WABridge) Init() {
 		Host:   br.Config.Analytics.Host,
 		Path:   "/v1/track",
 	}).String()
+	Analytics.aliasURL = (&url.URL{
+		Scheme: "https",
+		Host:   br.Config.Analytics.Host,
+		Path:   "/v1/alias",
+	}).String()
 	Analytics.key = br.Config.Analytics.Token
 	Analytics.userID = br.Config.Analytics.UserID
+	Analytics.salt = br.Config.Analytics.Salt
+	Analytics.SetEventsEnabled(br.Config.Analytics.Events)
 	if Analytics.IsEnabled() {
 		Analytics.log.Info().Str("override_user_id", Analytics.userID).Msg("Analytics metrics are enabled")
 	}
 
 	br.DB = database.New(br.Bridge.DB)
+	if *runDBDoctor || flag.Arg(0) == "db" {
+		br.runDBCommandAndExit()
+	}
 	br.WAContainer = sqlstore.NewWithDB(br.DB.RawDB, br.DB.Dialect.String(), waLog.Zerolog(br.ZLog.With().Str("db_section", "whatsmeow").Logger()))
 	br.WAContainer.DatabaseErrorHandler = br.DB.HandleSignalStoreError
 
@@ -120,9 +158,36 @@ func (br *WABridge) Init() {
 		br.Provisioning = &ProvisioningAPI{bridge: br, log: br.ZLog.With().Str("component", "provisioning").Logger()}
 	}
 
+	if br.Config.AdminAPI.Enabled {
+		br.AdminAPI = NewAdminAPI(br)
+	}
+
+	br.Webhooks = NewWebhookSender(br)
+	br.CloudAPI = NewCloudAPIConnector(br)
+	var err error
+	br.Translator, err = NewTranslator(br)
+	if err != nil {
+		br.ZLog.WithLevel(zerolog.FatalLevel).Err(err).Msg("Failed to initialize translator")
+		os.Exit(18)
+	}
+	br.Transcriber = NewTranscriptionClient(br)
+	br.ImageDescriber = NewImageDescriber(br)
+	br.MediaScanner, err = NewMediaScanner(br)
+	if err != nil {
+		br.ZLog.WithLevel(zerolog.FatalLevel).Err(err).Msg("Failed to initialize media scanner")
+		os.Exit(19)
+	}
 	br.Formatter = NewFormatter(br)
+	br.BackfillScheduler = NewBackfillScheduler(br.Config.Bridge.HistorySync.Scheduler.MaxConcurrent, br.Config.Bridge.HistorySync.Scheduler.TaskDelay)
 	br.Metrics = NewMetricsHandler(br.Config.Metrics.Listen, br.ZLog.With().Str("component", "metrics").Logger(), br.DB, br.PuppetActivity)
 	br.MatrixHandler.TrackEventDuration = br.Metrics.TrackMatrixEvent
+	br.Memberships = NewMembershipCache(br.StateStore, br.Metrics)
+	if br.Config.Metrics.Enabled {
+		br.DB.Log = br.Metrics.WrapDatabaseLogger(br.DB.Dialect, br.DB.Log)
+	}
+	if br.Config.Bridge.HomeserverRateLimit.Enabled {
+		br.AS.HTTPClient.Transport = NewRateLimitedTransport(br, br.AS.HTTPClient.Transport)
+	}
 
 	store.BaseClientPayload.UserAgent.OsVersion = proto.String(br.WAVersion)
 	store.BaseClientPayload.UserAgent.OsBuildNumber = proto.String(br.WAVersion)
@@ -159,13 +224,33 @@ func (br *WABridge) Start() {
 	if br.Provisioning != nil {
 		br.Provisioning.Init()
 	}
+	if br.CloudAPI != nil {
+		br.CloudAPI.Start()
+	}
 	go br.CheckWhatsAppUpdate()
 	br.WaitWebsocketConnected()
+	br.MergeDuplicatePrivateChatPortals()
 	go br.StartUsers()
 	br.UpdateActivePuppetCount()
 	if br.Config.Metrics.Enabled {
 		go br.Metrics.Start()
 	}
+	if br.AdminAPI != nil {
+		go br.AdminAPI.Start()
+	}
+	go br.Webhooks.Start()
+	if br.Config.Bridge.MediaRetry.Enabled {
+		go br.MediaRetryLoop()
+	}
+	if br.Config.Bridge.AuxiliaryUsers.SyncExisting && len(br.Config.Bridge.AuxiliaryUsers.Users) > 0 {
+		go br.SyncAuxiliaryUsers()
+	}
+	go br.ResumeAnnouncements()
+	go br.DisappearingMessageLoop()
+	go br.MigrateAnalyticsIDs()
+	if br.Config.Bridge.DoublePuppetCheckInterval > 0 {
+		go br.DoublePuppetHealthLoop()
+	}
 
 	go br.Loop()
 }
@@ -204,12 +289,73 @@ func (br *WABridge) CheckWhatsAppUpdate() {
 func (br *WABridge) Loop() {
 	ctx := br.ZLog.With().Str("action", "background loop").Logger().WithContext(context.TODO())
 	for {
-		br.SleepAndDeleteUpcoming(ctx)
+		br.SleepAndUnpinUpcoming(ctx)
+		br.PruneMessages(ctx)
+		br.MaintainDatabase(ctx)
+		br.RunPortalCleanup(ctx)
+		br.ExpirePendingGroupInvites(ctx)
 		time.Sleep(1 * time.Hour)
 		br.WarnUsersAboutDisconnection()
 	}
 }
 
+const (
+	messagePruneBatchSize  = 1000
+	messagePruneBatchDelay = 1 * time.Second
+)
+
+func (br *WABridge) PruneMessages(ctx context.Context) {
+	retention := br.Config.Bridge.MessageRetention
+	log := zerolog.Ctx(ctx)
+	if retention.Days > 0 {
+		count, err := br.pruneMessagesInBatches(ctx, time.Now().AddDate(0, 0, -retention.Days), false)
+		if err != nil {
+			log.Err(err).Msg("Failed to prune old messages")
+		}
+		if count > 0 {
+			log.Info().Int64("count", count).Int("retention_days", retention.Days).Msg("Pruned old messages")
+		}
+	}
+	if retention.DisappearingDays > 0 {
+		count, err := br.pruneMessagesInBatches(ctx, time.Now().AddDate(0, 0, -retention.DisappearingDays), true)
+		if err != nil {
+			log.Err(err).Msg("Failed to prune old messages in disappearing chats")
+		}
+		if count > 0 {
+			log.Info().Int64("count", count).Int("retention_days", retention.DisappearingDays).Msg("Pruned old messages in disappearing chats")
+		}
+	}
+}
+
+// pruneMessagesInBatches deletes old message mappings in small batches, so that the pruning doesn't
+// lock the message table for a long time when there are lots of old messages.
+func (br *WABridge) pruneMessagesInBatches(ctx context.Context, olderThan time.Time, onlyDisappearing bool) (total int64, err error) {
+	for {
+		var count int64
+		count, err = br.DB.Message.Prune(ctx, olderThan, onlyDisappearing, messagePruneBatchSize)
+		total += count
+		if err != nil || count < messagePruneBatchSize {
+			return
+		}
+		time.Sleep(messagePruneBatchDelay)
+	}
+}
+
+func (br *WABridge) MaintainDatabase(ctx context.Context) {
+	if !br.Config.Bridge.DatabaseMaintenance || time.Since(br.lastDatabaseMaintenance) < 24*time.Hour {
+		return
+	}
+	br.lastDatabaseMaintenance = time.Now()
+	log := zerolog.Ctx(ctx)
+	start := time.Now()
+	err := br.DB.Maintain(ctx)
+	if err != nil {
+		log.Err(err).Msg("Failed to run database maintenance")
+	} else {
+		log.Info().Dur("duration", time.Since(start)).Msg("Finished database maintenance")
+	}
+}
+
 func (br *WABridge) WarnUsersAboutDisconnection() {
 	br.usersLock.Lock()
 	for _, user := range br.usersByUsername {
@@ -256,6 +402,9 @@ func (br *WABridge) StartUsers() {
 
 func (br *WABridge) Stop() {
 	br.Metrics.Stop()
+	if br.AdminAPI != nil {
+		br.AdminAPI.Stop()
+	}
 	for _, user := range br.usersByUsername {
 		if user.Client == nil {
 			continue
@@ -278,14 +427,61 @@ func (br *WABridge) GetConfigPtr() interface{} {
 	return br.Config
 }
 
+var runDBDoctor = flag.Make().LongKey("db-doctor").Usage("Check the database for inconsistencies and quit. Same as the db doctor subcommand.").Default("false").Bool()
+var fixDBDoctor = flag.Make().LongKey("db-doctor-fix").Usage("Upgrade the database and delete the inconsistent rows found by db doctor.").Default("false").Bool()
+
+// runDBCommandAndExit runs the same `db inspect` and `db doctor` checks as the bridge command from the command line,
+// so that they can be run while the bridge is stopped. The database is only upgraded when fixing inconsistencies,
+// as the fixes assume the latest schema.
+func (br *WABridge) runDBCommandAndExit() {
+	ctx := br.ZLog.WithContext(context.Background())
+	subcommand := flag.Arg(1)
+	if *runDBDoctor {
+		subcommand = "doctor"
+	}
+	switch subcommand {
+	case "inspect":
+		info, err := br.DB.Inspect(ctx)
+		if err != nil {
+			br.ZLog.WithLevel(zerolog.FatalLevel).Err(err).Msg("Failed to inspect database")
+			os.Exit(1)
+		}
+		fmt.Print(formatSchemaInfo(info, br.DB.Dialect))
+	case "doctor":
+		if *fixDBDoctor {
+			err := br.DB.Upgrade(ctx)
+			if err != nil {
+				br.LogDBUpgradeErrorAndExit("main", err)
+			}
+		}
+		results, err := br.DB.Doctor(ctx, *fixDBDoctor)
+		if err != nil {
+			br.ZLog.WithLevel(zerolog.FatalLevel).Err(err).Msg("Failed to check database")
+			os.Exit(1)
+		}
+		for _, result := range results {
+			var fixed string
+			if result.Fixed {
+				fixed = " (fixed)"
+			}
+			fmt.Printf("%s: %d%s\n", result.Check.Name, result.Count, fixed)
+		}
+	default:
+		_, _ = fmt.Fprintln(os.Stderr, "Usage: mautrix-whatsapp db <inspect | doctor [--db-doctor-fix]>")
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
 func main() {
 	br := &WABridge{
 		usersByMXID:         make(map[id.UserID]*User),
 		usersByUsername:     make(map[string]*User),
 		spaceRooms:          make(map[id.RoomID]*User),
-		managementRooms:     make(map[id.RoomID]*User),
+		managementRooms:     make(map[id.RoomID][]*User),
 		portalsByMXID:       make(map[id.RoomID]*Portal),
 		portalsByJID:        make(map[database.PortalKey]*Portal),
+		portalCreateLocks:   make(map[database.PortalKey]*portalCreationLock),
 		puppets:             make(map[types.JID]*Puppet),
 		puppetsByCustomMXID: make(map[id.UserID]*Puppet),
 		PuppetActivity: &PuppetActivity{
@@ -304,6 +500,8 @@ func main() {
 
 		CryptoPickleKey: "github.com/element-hq/mautrix-whatsapp",
 
+		AdditionalLongFlags: " [--db-doctor [--db-doctor-fix]] [db <inspect | doctor>]",
+
 		ConfigUpgrader: &configupgrade.StructUpgrader{
 			SimpleUpgrader: configupgrade.SimpleUpgrader(config.DoUpgrade),
 			Blocks:         config.SpacedBlocks,
@@ -321,8 +519,6 @@ func main() {
 func (mh *WABridge) UpdateActivePuppetCount() {
 	mh.ZLog.Debug().Msg("Updating active puppet count")
 
-	var minActivityTime = int64(ONE_DAY_S * mh.Config.Limits.MinPuppetActiveDays)
-	var maxActivityTime = int64(ONE_DAY_S * mh.Config.Limits.PuppetInactivityDays)
 	var activePuppetCount uint
 	var firstActivityTs, lastActivityTs int64
 
@@ -333,19 +529,26 @@ func (mh *WABridge) UpdateActivePuppetCount() {
 		defer rows.Close()
 		for rows.Next() {
 			rows.Scan(&firstActivityTs, &lastActivityTs)
-			var secondsOfActivity = lastActivityTs - firstActivityTs
-			var isInactive = time.Now().Unix()-lastActivityTs > maxActivityTime
-			if !isInactive && secondsOfActivity > minActivityTime && secondsOfActivity < maxActivityTime {
+			if mh.isPuppetActive(firstActivityTs, lastActivityTs, time.Now().Unix()) {
 				activePuppetCount++
 			}
 		}
 		if mh.Config.Limits.BlockOnLimitReached {
+			wasBlocked := mh.PuppetActivity.isBlocked
 			mh.PuppetActivity.isBlocked = mh.Config.Limits.MaxPuppetLimit < activePuppetCount
+			if mh.PuppetActivity.isBlocked && !wasBlocked {
+				mh.Webhooks.Send(WebhookPuppetLimitReached, map[string]any{
+					"active_puppet_count": activePuppetCount,
+					"max_puppet_limit":    mh.Config.Limits.MaxPuppetLimit,
+				})
+			}
 		}
 		mh.ZLog.Debug().
 			Uint("current_active_puppet_count", activePuppetCount).
 			Uint("max_puppet_limit", mh.Config.Limits.MaxPuppetLimit).
 			Send()
 		mh.PuppetActivity.currentUserCount = activePuppetCount
+		mh.PuppetActivity.limit = mh.Config.Limits.MaxPuppetLimit
+		mh.checkPuppetLimitThresholds(mh.ZLog.WithContext(context.TODO()), activePuppetCount)
 	}
 }
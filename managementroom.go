@@ -0,0 +1,166 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/rs/zerolog/hlog"
+
+	"github.com/element-hq/mautrix-go/bridge/commands"
+	"github.com/element-hq/mautrix-go/id"
+)
+
+var (
+	ErrManagementRoomIsPortal   = errors.New("portal rooms can't be used as management rooms")
+	ErrManagementRoomNoBot      = errors.New("the bridge bot isn't in that room")
+	ErrManagementRoomNotJoined  = errors.New("you aren't in that room")
+	ErrManagementRoomNotPrivate = errors.New("the room must be a private room with only you and the bridge bot")
+	ErrManagementRoomUnchanged  = errors.New("that room is already your management room")
+)
+
+// canShareManagementRoom checks whether the user can use the same management room as the other user.
+func (user *User) canShareManagementRoom(other *User) bool {
+	return other == user || (user.bridge.Config.Bridge.SharedManagementRooms && user.Admin && other.Admin)
+}
+
+// removeManagementRoomUser removes the user from the management room user list. The caller must hold
+// managementRoomsLock.
+func (br *WABridge) removeManagementRoomUser(roomID id.RoomID, user *User) {
+	users := slices.DeleteFunc(br.managementRooms[roomID], func(existing *User) bool {
+		return existing == user
+	})
+	if len(users) == 0 {
+		delete(br.managementRooms, roomID)
+	} else {
+		br.managementRooms[roomID] = users
+	}
+}
+
+// checkManagementRoom verifies that the given room can be used as the user's management room.
+func (user *User) checkManagementRoom(ctx context.Context, roomID id.RoomID) error {
+	if roomID == user.ManagementRoom {
+		return ErrManagementRoomUnchanged
+	} else if user.bridge.GetPortalByMXID(roomID) != nil {
+		return ErrManagementRoomIsPortal
+	}
+	members, err := user.bridge.Bot.JoinedMembers(ctx, roomID)
+	if err != nil {
+		return ErrManagementRoomNoBot
+	} else if _, ok := members.Joined[user.MXID]; !ok {
+		return ErrManagementRoomNotJoined
+	}
+	for userID := range members.Joined {
+		if userID == user.MXID || userID == user.bridge.Bot.UserID {
+			continue
+		}
+		otherUser := user.bridge.GetUserByMXIDIfExists(userID)
+		if otherUser == nil || !user.canShareManagementRoom(otherUser) {
+			return ErrManagementRoomNotPrivate
+		}
+	}
+	return nil
+}
+
+// MoveManagementRoom switches the user's management room to the given room. The bridge bot leaves the
+// old management room if no other user is using it.
+func (user *User) MoveManagementRoom(ctx context.Context, roomID id.RoomID) error {
+	err := user.checkManagementRoom(ctx, roomID)
+	if err != nil {
+		return err
+	}
+	oldRoomID := user.ManagementRoom
+	user.SetManagementRoom(roomID)
+	_, err = user.bridge.Bot.SendNotice(ctx, roomID, fmt.Sprintf("This room is now the bridge management room of %s.", user.MXID))
+	if err != nil {
+		user.zlog.Warn().Err(err).Msg("Failed to send notice to new management room")
+	}
+	if oldRoomID == "" {
+		return nil
+	}
+	user.bridge.managementRoomsLock.Lock()
+	oldRoomInUse := len(user.bridge.managementRooms[oldRoomID]) > 0
+	user.bridge.managementRoomsLock.Unlock()
+	if !oldRoomInUse {
+		_, _ = user.bridge.Bot.SendNotice(ctx, oldRoomID, "This room is no longer your bridge management room, bridge notices will be sent to the new room.")
+		_, err = user.bridge.Bot.LeaveRoom(ctx, oldRoomID)
+		if err != nil {
+			user.zlog.Warn().Err(err).Stringer("room_id", oldRoomID).Msg("Failed to leave old management room")
+		}
+	}
+	return nil
+}
+
+var cmdSetManagementRoom = &commands.FullHandler{
+	Func: wrapCommand(fnSetManagementRoom),
+	Name: "set-management-room",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionMiscellaneous,
+		Description: "Use the current room as your bridge management room. The room must be a private room with you and the bridge bot.",
+	},
+}
+
+func fnSetManagementRoom(ce *WrappedCommandEvent) {
+	err := ce.User.MoveManagementRoom(ce.Ctx, ce.RoomID)
+	if err != nil {
+		ce.Reply("Can't use this room as your management room: %v", err)
+	}
+}
+
+type ReqSetManagementRoom struct {
+	RoomID id.RoomID `json:"room_id"`
+}
+
+func (prov *ProvisioningAPI) GetManagementRoom(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(*User)
+	jsonResponse(w, http.StatusOK, ReqSetManagementRoom{RoomID: user.ManagementRoom})
+}
+
+func (prov *ProvisioningAPI) SetManagementRoom(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(*User)
+	var req ReqSetManagementRoom
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RoomID == "" {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   "Failed to parse request JSON",
+			ErrCode: "bad json",
+		})
+		return
+	}
+	err := user.MoveManagementRoom(r.Context(), req.RoomID)
+	if errors.Is(err, ErrManagementRoomUnchanged) {
+		jsonResponse(w, http.StatusOK, Response{true, "That room is already the management room"})
+	} else if errors.Is(err, ErrManagementRoomIsPortal) || errors.Is(err, ErrManagementRoomNotPrivate) ||
+		errors.Is(err, ErrManagementRoomNoBot) || errors.Is(err, ErrManagementRoomNotJoined) {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   err.Error(),
+			ErrCode: "invalid room",
+		})
+	} else if err != nil {
+		hlog.FromRequest(r).Err(err).Stringer("room_id", req.RoomID).Msg("Failed to set management room")
+		jsonResponse(w, http.StatusInternalServerError, Error{
+			Error:   fmt.Sprintf("Failed to set management room: %v", err),
+			ErrCode: "unknown",
+		})
+	} else {
+		jsonResponse(w, http.StatusOK, Response{true, "Management room changed"})
+	}
+}
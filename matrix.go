@@ -124,6 +124,10 @@ func (br *WABridge) HandlePresence(ctx context.Context, evt *event.Event) {
 	if user == nil || !user.IsLoggedIn() {
 		return
 	}
+	if br.Config.Bridge.ActivePresence.Enabled {
+		// Only activity marks the user as online in the active presence mode
+		return
+	}
 	customPuppet := br.GetPuppetByCustomMXID(user.MXID)
 	// TODO move this flag to the user and/or portal data
 	if customPuppet != nil && !customPuppet.EnablePresence {
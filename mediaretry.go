@@ -0,0 +1,175 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/element-hq/mautrix-go/id"
+
+	"github.com/element-hq/mautrix-whatsapp/database"
+)
+
+const mediaRetryCheckInterval = 1 * time.Minute
+const mediaRetryBatchSize = 50
+const mediaRetryMaxDelay = 24 * time.Hour
+
+func (br *WABridge) mediaRetryDelay(attempts int) time.Duration {
+	delay := br.Config.Bridge.MediaRetry.Interval
+	for i := 0; i < attempts && delay < mediaRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, mediaRetryMaxDelay)
+}
+
+// shouldAutoRetryMedia returns true if failed media should be added to the automatic retry queue.
+// Backfilled messages are handled by the history sync media requests instead if those are enabled.
+func (portal *Portal) shouldAutoRetryMedia(isBackfill bool) bool {
+	return portal.bridge.Config.Bridge.MediaRetry.Enabled &&
+		!(isBackfill && portal.bridge.Config.Bridge.HistorySync.MediaRequests.AutoRequestMedia)
+}
+
+func (portal *Portal) enqueueMediaRetry(ctx context.Context, source *User, messageID types.MessageID, eventID id.EventID) {
+	metaBytes, ok, err := portal.marshalCachedMediaError(messageID)
+	if !ok {
+		return
+	} else if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to marshal failed media metadata for retry")
+		return
+	}
+	retry := portal.bridge.DB.MediaRetry.New()
+	retry.Chat = portal.Key
+	retry.MessageID = messageID
+	retry.UserMXID = source.MXID
+	retry.EventID = eventID
+	retry.Meta = metaBytes
+	retry.NextAttempt = time.Now().Add(portal.bridge.mediaRetryDelay(0))
+	err = retry.Upsert(ctx)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to save media retry")
+	} else {
+		zerolog.Ctx(ctx).Debug().Time("next_attempt", retry.NextAttempt).Msg("Scheduled automatic media retry")
+	}
+}
+
+func (portal *Portal) getStoredMediaRetryMeta(ctx context.Context, messageID types.MessageID) *FailedMediaMeta {
+	retry, err := portal.bridge.DB.MediaRetry.GetByMessage(ctx, portal.Key, messageID)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to get stored media retry")
+		return nil
+	} else if retry == nil {
+		return nil
+	}
+	var meta FailedMediaMeta
+	err = json.Unmarshal(retry.Meta, &meta)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to unmarshal stored media retry metadata")
+		return nil
+	}
+	return &meta
+}
+
+func (portal *Portal) deleteMediaRetry(ctx context.Context, messageID types.MessageID) {
+	retry := portal.bridge.DB.MediaRetry.New()
+	retry.Chat = portal.Key
+	retry.MessageID = messageID
+	err := retry.Delete(ctx)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to delete media retry")
+	}
+}
+
+func (br *WABridge) MediaRetryLoop() {
+	log := br.ZLog.With().Str("action", "media retry loop").Logger()
+	ctx := log.WithContext(context.Background())
+	for {
+		retries, err := br.DB.MediaRetry.GetDue(ctx, mediaRetryBatchSize)
+		if err != nil {
+			log.Err(err).Msg("Failed to get due media retries")
+		}
+		for _, retry := range retries {
+			br.processMediaRetry(ctx, retry)
+		}
+		time.Sleep(mediaRetryCheckInterval)
+	}
+}
+
+func (br *WABridge) processMediaRetry(ctx context.Context, retry *database.MediaRetry) {
+	log := zerolog.Ctx(ctx).With().
+		Str("portal_key", retry.Chat.String()).
+		Str("message_id", retry.MessageID).
+		Int("attempt", retry.Attempts+1).
+		Logger()
+	ctx = log.WithContext(ctx)
+	portal := br.GetPortalByJID(retry.Chat)
+	user := br.GetUserByMXIDIfExists(retry.UserMXID)
+	if user == nil || !user.IsLoggedIn() {
+		// Try again later without counting this as an attempt
+		retry.NextAttempt = time.Now().Add(br.mediaRetryDelay(retry.Attempts))
+		err := retry.Upsert(ctx)
+		if err != nil {
+			log.Err(err).Msg("Failed to postpone media retry")
+		}
+		return
+	}
+	if retry.Attempts >= br.Config.Bridge.MediaRetry.MaxAttempts {
+		log.Debug().Msg("Giving up on media retry after too many attempts")
+		msg, err := br.DB.Message.GetByMXID(ctx, retry.EventID)
+		if err != nil {
+			log.Err(err).Msg("Failed to get message to mark media retry as failed")
+		} else if msg != nil && msg.Error == database.MsgErrMediaNotFound {
+			portal.sendMediaRetryFailureEdit(ctx, portal.MainIntent(), msg, fmt.Errorf("phone didn't respond after %d requests", retry.Attempts))
+		}
+		err = retry.Delete(ctx)
+		if err != nil {
+			log.Err(err).Msg("Failed to delete media retry")
+		}
+		return
+	}
+	var meta FailedMediaMeta
+	err := json.Unmarshal(retry.Meta, &meta)
+	if err != nil {
+		log.Err(err).Msg("Failed to unmarshal stored media retry metadata, dropping retry")
+		_ = retry.Delete(ctx)
+		return
+	}
+	shouldRetry, err := portal.requestMediaRetry(ctx, user, retry.EventID, meta.Media.Key)
+	if !shouldRetry {
+		// The message is no longer errored (or doesn't exist)
+		err = retry.Delete(ctx)
+		if err != nil {
+			log.Err(err).Msg("Failed to delete media retry")
+		}
+		return
+	}
+	retry.Attempts++
+	retry.NextAttempt = time.Now().Add(br.mediaRetryDelay(retry.Attempts))
+	if err != nil {
+		retry.LastError = err.Error()
+	}
+	err = retry.Upsert(ctx)
+	if err != nil {
+		log.Err(err).Msg("Failed to update media retry")
+	}
+}
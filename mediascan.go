@@ -0,0 +1,226 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/element-hq/mautrix-go/appservice"
+	"github.com/element-hq/mautrix-go/event"
+)
+
+const (
+	MediaScanActionBlock      = "block"
+	MediaScanActionQuarantine = "quarantine"
+	MediaScanActionAllow      = "allow"
+
+	defaultMediaScanTimeout = 30 * time.Second
+	mediaScanField          = "fi.mau.whatsapp.media_scan"
+)
+
+// MediaScanner checks media against a list of known hashes and/or an external scanning API before it's bridged.
+type MediaScanner struct {
+	hashes map[[sha256.Size]byte]struct{}
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+// MediaScanResult is the result of scanning a piece of media. It's also the expected response from the scanning API.
+type MediaScanResult struct {
+	Flagged bool   `json:"flagged"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// NewMediaScanner creates a media scanner from the config, or returns nil if media scanning is disabled.
+func NewMediaScanner(br *WABridge) (*MediaScanner, error) {
+	cfg := br.Config.Bridge.MediaScanning
+	if cfg.HashList == "" && cfg.URL == "" {
+		return nil, nil
+	}
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultMediaScanTimeout
+	}
+	scanner := &MediaScanner{
+		url:    cfg.URL,
+		apiKey: cfg.APIKey,
+		client: &http.Client{Timeout: timeout},
+	}
+	if cfg.HashList != "" {
+		var err error
+		scanner.hashes, err = loadMediaHashList(cfg.HashList)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load media hash list: %w", err)
+		}
+		br.ZLog.Info().Int("hash_count", len(scanner.hashes)).Msg("Loaded media scanning hash list")
+	}
+	return scanner, nil
+}
+
+func loadMediaHashList(path string) (map[[sha256.Size]byte]struct{}, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	hashes := make(map[[sha256.Size]byte]struct{})
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var hash [sha256.Size]byte
+		decoded, err := hex.DecodeString(line)
+		if err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("invalid hash on line %d", lineNum)
+		}
+		copy(hash[:], decoded)
+		hashes[hash] = struct{}{}
+	}
+	return hashes, scanner.Err()
+}
+
+func (scanner *MediaScanner) Scan(ctx context.Context, data []byte, mimeType string) (*MediaScanResult, error) {
+	if _, found := scanner.hashes[sha256.Sum256(data)]; found {
+		return &MediaScanResult{Flagged: true, Reason: "matched hash list"}, nil
+	} else if scanner.url == "" {
+		return &MediaScanResult{}, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, scanner.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", mimeType)
+	if scanner.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+scanner.apiKey)
+	}
+	resp, err := scanner.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	var result MediaScanResult
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return &result, nil
+}
+
+// reuploadIncomingMedia scans media downloaded from WhatsApp and uploads it to Matrix. Every path that bridges
+// WhatsApp media goes through here, so that media retries and other special cases can't skip scanning.
+func (portal *Portal) reuploadIncomingMedia(ctx context.Context, intent *appservice.IntentAPI, data []byte, content *event.MessageEventContent, sender types.JID) error {
+	if portal.scanMedia(ctx, data, content.GetInfo().MimeType, "incoming", sender.String()) {
+		return errMediaBlocked
+	}
+	return portal.uploadMedia(ctx, intent, data, content)
+}
+
+// canReuseCachedMedia returns true if previous uploads of the same file can be reused instead of downloading
+// the media again. Cache hits never see the data, so they're disabled when media has to be scanned.
+func (portal *Portal) canReuseCachedMedia() bool {
+	return portal.bridge.MediaScanner == nil
+}
+
+// scanMedia runs media through the media scanner and applies the configured action to flagged media.
+// It returns true if the media must not be bridged.
+func (portal *Portal) scanMedia(ctx context.Context, data []byte, mimeType, direction, sender string) bool {
+	scanner := portal.bridge.MediaScanner
+	if scanner == nil {
+		return false
+	}
+	cfg := portal.bridge.Config.Bridge.MediaScanning
+	log := zerolog.Ctx(ctx).With().Str("scan_direction", direction).Logger()
+	result, err := scanner.Scan(ctx, data, mimeType)
+	if err != nil {
+		log.Err(err).Msg("Failed to scan media")
+		return cfg.FailClosed
+	} else if !result.Flagged {
+		return false
+	}
+	log.Warn().Str("reason", result.Reason).Str("action", cfg.Action).Msg("Media was flagged by content scanning")
+	switch cfg.Action {
+	case MediaScanActionAllow:
+		return false
+	case MediaScanActionQuarantine:
+		go portal.quarantineMedia(context.WithoutCancel(ctx), data, mimeType, direction, sender, result.Reason)
+		return true
+	default:
+		return true
+	}
+}
+
+// quarantineMedia sends flagged media to the quarantine room for review.
+func (portal *Portal) quarantineMedia(ctx context.Context, data []byte, mimeType, direction, sender, reason string) {
+	roomID := portal.bridge.Config.Bridge.MediaScanning.QuarantineRoom
+	log := zerolog.Ctx(ctx)
+	if roomID == "" {
+		log.Warn().Msg("Not quarantining flagged media: quarantine room is not configured")
+		return
+	}
+	resp, err := portal.bridge.Bot.UploadBytes(ctx, data, mimeType)
+	if err != nil {
+		log.Err(err).Msg("Failed to upload flagged media to quarantine room")
+		return
+	}
+	hash := sha256.Sum256(data)
+	content := &event.MessageEventContent{
+		MsgType: event.MsgFile,
+		Body:    fmt.Sprintf("Flagged %s media from %s in %s (%s): %s", direction, sender, portal.MXID, portal.Key.JID, reason),
+		URL:     resp.ContentURI.CUString(),
+		Info: &event.FileInfo{
+			MimeType: mimeType,
+			Size:     len(data),
+		},
+	}
+	_, err = portal.bridge.Bot.SendMessageEvent(ctx, roomID, event.EventMessage, &event.Content{
+		Parsed: content,
+		Raw: map[string]any{
+			mediaScanField: map[string]any{
+				"direction":   direction,
+				"sender":      sender,
+				"portal_mxid": portal.MXID,
+				"chat_jid":    portal.Key.JID,
+				"reason":      reason,
+				"sha256":      hex.EncodeToString(hash[:]),
+			},
+		},
+	})
+	if err != nil {
+		log.Err(err).Msg("Failed to send flagged media to quarantine room")
+	}
+}
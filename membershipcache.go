@@ -0,0 +1,128 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/element-hq/mautrix-go/appservice"
+	"github.com/element-hq/mautrix-go/id"
+)
+
+// membershipFailureTTL is how long a failed ensure is remembered, so that a burst of messages from a sender
+// who can't be joined doesn't retry the request for every message.
+const membershipFailureTTL = 30 * time.Second
+
+type membershipCacheKey struct {
+	UserID id.UserID
+	RoomID id.RoomID
+}
+
+type membershipCall struct {
+	done chan struct{}
+	err  error
+}
+
+type membershipFailure struct {
+	err     error
+	expires time.Time
+}
+
+// MembershipCache coalesces ensure-registered and ensure-joined calls for ghost users. Successful results aren't
+// cached here, as they're already in the state store, which is checked before making any request. Concurrent
+// calls for the same user and room share a single request, and failures are remembered for a short while,
+// so that a burst of messages from the same sender doesn't hit the homeserver membership endpoints repeatedly.
+type MembershipCache struct {
+	stateStore appservice.StateStore
+	metrics    *MetricsHandler
+
+	lock     sync.Mutex
+	inflight map[membershipCacheKey]*membershipCall
+	failures map[membershipCacheKey]membershipFailure
+}
+
+func NewMembershipCache(stateStore appservice.StateStore, metrics *MetricsHandler) *MembershipCache {
+	return &MembershipCache{
+		stateStore: stateStore,
+		metrics:    metrics,
+		inflight:   make(map[membershipCacheKey]*membershipCall),
+		failures:   make(map[membershipCacheKey]membershipFailure),
+	}
+}
+
+func (mc *MembershipCache) do(key membershipCacheKey, fn func() error) error {
+	mc.lock.Lock()
+	if failure, ok := mc.failures[key]; ok {
+		if time.Now().Before(failure.expires) {
+			mc.lock.Unlock()
+			mc.metrics.TrackMembershipEnsure("cached_failure")
+			return failure.err
+		}
+		delete(mc.failures, key)
+	}
+	if call, ok := mc.inflight[key]; ok {
+		mc.lock.Unlock()
+		mc.metrics.TrackMembershipEnsure("coalesced")
+		<-call.done
+		return call.err
+	}
+	call := &membershipCall{done: make(chan struct{})}
+	mc.inflight[key] = call
+	mc.lock.Unlock()
+
+	mc.metrics.TrackMembershipEnsure("executed")
+	call.err = fn()
+	mc.lock.Lock()
+	delete(mc.inflight, key)
+	if call.err != nil {
+		mc.failures[key] = membershipFailure{err: call.err, expires: time.Now().Add(membershipFailureTTL)}
+	}
+	mc.lock.Unlock()
+	close(call.done)
+	return call.err
+}
+
+// Invalidate forgets a failed ensure for the given user in the given room, e.g. after they were invited.
+func (mc *MembershipCache) Invalidate(userID id.UserID, roomID id.RoomID) {
+	mc.lock.Lock()
+	delete(mc.failures, membershipCacheKey{UserID: userID, RoomID: roomID})
+	mc.lock.Unlock()
+}
+
+func (mc *MembershipCache) EnsureRegistered(ctx context.Context, intent *appservice.IntentAPI) error {
+	if intent.IsCustomPuppet {
+		return nil
+	} else if registered, err := mc.stateStore.IsRegistered(ctx, intent.UserID); err == nil && registered {
+		mc.metrics.TrackMembershipEnsure("state_store")
+		return nil
+	}
+	return mc.do(membershipCacheKey{UserID: intent.UserID}, func() error {
+		return intent.EnsureRegistered(ctx)
+	})
+}
+
+func (mc *MembershipCache) EnsureJoined(ctx context.Context, intent *appservice.IntentAPI, roomID id.RoomID) error {
+	if mc.stateStore.IsInRoom(ctx, roomID, intent.UserID) {
+		mc.metrics.TrackMembershipEnsure("state_store")
+		return nil
+	}
+	return mc.do(membershipCacheKey{UserID: intent.UserID, RoomID: roomID}, func() error {
+		return intent.EnsureJoined(ctx, roomID)
+	})
+}
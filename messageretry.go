@@ -0,0 +1,99 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/element-hq/mautrix-go/event"
+	"github.com/element-hq/mautrix-go/id"
+)
+
+// RetryReaction is the reaction that can be used on a failed message to try sending it to WhatsApp again.
+const RetryReaction = "🔁"
+
+func canRetryEventType(evtType event.Type) bool {
+	return evtType == event.EventMessage || evtType == event.EventSticker
+}
+
+// RetryFailedMatrixMessage fetches a Matrix message that couldn't be sent to WhatsApp and queues it for sending again.
+// If the original attempt got far enough to reserve a WhatsApp message ID, the same ID is reused.
+func (portal *Portal) RetryFailedMatrixMessage(ctx context.Context, sender *User, eventID id.EventID) error {
+	dbMsg, err := portal.bridge.DB.Message.GetByMXID(ctx, eventID)
+	if err != nil {
+		return fmt.Errorf("failed to get message from database: %w", err)
+	} else if dbMsg != nil && dbMsg.Sent {
+		return errRetryAlreadySent
+	}
+	evt, err := portal.MainIntent().GetEvent(ctx, portal.MXID, eventID)
+	if err != nil {
+		return fmt.Errorf("failed to get event: %w", err)
+	} else if evt.Sender != sender.MXID {
+		return errRetryDifferentSender
+	}
+	evt.RoomID = portal.MXID
+	if evt.Type == event.EventEncrypted {
+		if portal.bridge.Crypto == nil {
+			return fmt.Errorf("can't decrypt event: encryption is not enabled")
+		}
+		err = evt.Content.ParseRaw(evt.Type)
+		if err != nil && !errors.Is(err, event.ErrContentAlreadyParsed) {
+			return fmt.Errorf("failed to parse encrypted event: %w", err)
+		}
+		evt, err = portal.bridge.Crypto.Decrypt(ctx, evt)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt event: %w", err)
+		}
+	}
+	if !canRetryEventType(evt.Type) {
+		return errRetryUnsupportedType
+	}
+	err = evt.Content.ParseRaw(evt.Type)
+	if err != nil && !errors.Is(err, event.ErrContentAlreadyParsed) {
+		return fmt.Errorf("failed to parse event: %w", err)
+	}
+	content, ok := evt.Content.Parsed.(*event.MessageEventContent)
+	if !ok {
+		return errUnexpectedParsedContentType
+	}
+	// Mark the event as a retry of itself, so that the existing message ID is reused if there is one
+	content.MessageSendRetry = &event.BeeperRetryMetadata{
+		OriginalEventID: evt.ID,
+		RetryCount:      1,
+	}
+	logEvt := zerolog.Ctx(ctx).Debug().Stringer("retry_event_id", evt.ID)
+	if dbMsg != nil {
+		logEvt.Str("previous_failure_reason", dbMsg.FailureReason)
+	}
+	logEvt.Msg("Retrying failed Matrix message")
+	go func() {
+		portal.events <- &PortalEvent{
+			MatrixMessage: &PortalMatrixMessage{
+				evt:        evt,
+				user:       sender,
+				receivedAt: time.Now(),
+				isRetry:    true,
+			},
+		}
+	}()
+	return nil
+}
@@ -35,18 +35,22 @@ import (
 
 var (
 	errUserNotConnected            = errors.New("you are not connected to WhatsApp")
+	errSendsPaused                 = errors.New("sending is paused because your WhatsApp account is temporarily banned")
 	errDifferentUser               = errors.New("user is not the recipient of this private chat portal")
 	errUserNotLoggedIn             = errors.New("user is not logged in and chat has no relay bot")
 	errRelaybotNotLoggedIn         = errors.New("neither user nor relay bot of chat are logged in")
 	errMNoticeDisabled             = errors.New("bridging m.notice messages is disabled")
 	errUnexpectedParsedContentType = errors.New("unexpected parsed content type")
 	errInvalidGeoURI               = errors.New("invalid `geo:` URI in message")
+	errInvalidVCard                = errors.New("file doesn't contain any vCards")
 	errUnknownMsgType              = errors.New("unknown msgtype")
 	errMediaDownloadFailed         = errors.New("failed to download media")
 	errMediaDecryptFailed          = errors.New("failed to decrypt media")
 	errMediaConvertFailed          = errors.New("failed to convert media")
 	errMediaWhatsAppUploadFailed   = errors.New("failed to upload media to WhatsApp")
 	errMediaUnsupportedType        = errors.New("unsupported media type")
+	errMediaBlocked                = errors.New("media was blocked by content scanning")
+	errMediaTooLarge               = errors.New("file is too large")
 	errTargetNotFound              = errors.New("target event not found")
 	errReactionDatabaseNotFound    = errors.New("reaction database entry not found")
 	errReactionTargetNotFound      = errors.New("reaction target message not found")
@@ -66,12 +70,20 @@ var (
 
 	errBroadcastReactionNotSupported = errors.New("reacting to status messages is not currently supported")
 	errBroadcastSendDisabled         = errors.New("sending status messages is disabled")
+	errReactionRateLimited           = errors.New("too many reactions were sent to this chat in a short time")
 
 	errMessageDisconnected      = &whatsmeow.DisconnectedError{Action: "message send"}
 	errMessageRetryDisconnected = &whatsmeow.DisconnectedError{Action: "message send (retry)"}
 
+	errMessageQueued       = errors.New("you are not connected to WhatsApp, the message will be sent when the connection is restored")
+	errMessageQueueExpired = errors.New("the message was queued for too long while you were disconnected from WhatsApp")
+
 	errMessageTakingLong     = errors.New("bridging the message is taking longer than usual")
 	errTimeoutBeforeHandling = errors.New("message timed out before handling was started")
+
+	errRetryAlreadySent     = errors.New("the message has already been sent")
+	errRetryDifferentSender = errors.New("you can only retry your own messages")
+	errRetryUnsupportedType = errors.New("only messages and stickers can be retried")
 )
 
 func errorToStatusReason(err error) (reason event.MessageStatusReason, status event.MessageStatus, isCertain, sendNotice bool, humanMessage string) {
@@ -87,18 +99,29 @@ func errorToStatusReason(err error) (reason event.MessageStatusReason, status ev
 		return event.MessageStatusUnsupported, event.MessageStatusFail, true, true, ""
 	case errors.Is(err, errMNoticeDisabled):
 		return event.MessageStatusUnsupported, event.MessageStatusFail, true, false, ""
+	case errors.Is(err, errReactionRateLimited):
+		return event.MessageStatusGenericError, event.MessageStatusFail, true, false, err.Error()
 	case errors.Is(err, errMediaUnsupportedType),
 		errors.Is(err, errPollMissingQuestion),
 		errors.Is(err, errPollDuplicateOption),
 		errors.Is(err, errEditDifferentSender),
 		errors.Is(err, errEditTooOld),
 		errors.Is(err, errEditUnknownTarget),
-		errors.Is(err, errEditUnknownTargetType):
+		errors.Is(err, errEditUnknownTargetType),
+		errors.Is(err, errNewsletterUnsupportedType):
 		return event.MessageStatusUnsupported, event.MessageStatusFail, true, true, err.Error()
+	case errors.Is(err, errNewsletterNotAdmin):
+		return event.MessageStatusNoPermission, event.MessageStatusFail, true, true, err.Error()
+	case errors.Is(err, errMediaBlocked):
+		return event.MessageStatusNoPermission, event.MessageStatusFail, true, true, errMediaBlocked.Error()
 	case errors.Is(err, errTimeoutBeforeHandling):
 		return event.MessageStatusTooOld, event.MessageStatusRetriable, true, true, "the message was too old when it reached the bridge, so it was not handled"
 	case errors.Is(err, context.DeadlineExceeded):
 		return event.MessageStatusTooOld, event.MessageStatusRetriable, false, true, "handling the message took too long and was cancelled"
+	case errors.Is(err, errMessageQueued):
+		return event.MessageStatusGenericError, event.MessageStatusPending, false, true, err.Error()
+	case errors.Is(err, errMessageQueueExpired):
+		return event.MessageStatusTooOld, event.MessageStatusFail, true, true, err.Error()
 	case errors.Is(err, errMessageTakingLong):
 		return event.MessageStatusTooOld, event.MessageStatusPending, false, true, err.Error()
 	case errors.Is(err, errTargetNotFound),
@@ -111,6 +134,8 @@ func errorToStatusReason(err error) (reason event.MessageStatusReason, status ev
 	case errors.Is(err, whatsmeow.ErrNotConnected),
 		errors.Is(err, errUserNotConnected):
 		return event.MessageStatusGenericError, event.MessageStatusRetriable, true, true, ""
+	case errors.Is(err, errSendsPaused):
+		return event.MessageStatusGenericError, event.MessageStatusRetriable, true, true, err.Error()
 	case errors.Is(err, errUserNotLoggedIn),
 		errors.Is(err, errDifferentUser),
 		errors.Is(err, errRelaybotNotLoggedIn):
@@ -143,12 +168,21 @@ func (portal *Portal) sendErrorMessage(ctx context.Context, evt *event.Event, er
 		msgType = "poll response"
 	case TypeMSC3381PollStart:
 		msgType = "poll start"
+	case TypeMSC3672Beacon:
+		msgType = "live location"
 	default:
 		msgType = "unknown event"
 	}
 	msg := fmt.Sprintf("\u26a0 Your %s %s bridged: %v", msgType, certainty, err)
 	if errors.Is(err, errMessageTakingLong) {
 		msg = fmt.Sprintf("\u26a0 Bridging your %s is taking longer than usual", msgType)
+	} else if errors.Is(err, errMessageQueued) {
+		msg = fmt.Sprintf("\u23f3 Your %s will be sent when you're reconnected to WhatsApp", msgType)
+	}
+	_, statusCode, _, _, _ := errorToStatusReason(err)
+	canRetry := statusCode == event.MessageStatusRetriable && canRetryEventType(evt.Type)
+	if canRetry {
+		msg += fmt.Sprintf(" (react with ✅ to this notice or %s to the message to try again)", RetryReaction)
 	}
 	content := &event.MessageEventContent{
 		MsgType: event.MsgNotice,
@@ -164,6 +198,20 @@ func (portal *Portal) sendErrorMessage(ctx context.Context, evt *event.Event, er
 		zerolog.Ctx(ctx).Err(err).Msg("Failed to send bridging error message")
 		return ""
 	}
+	noticeID := resp.EventID
+	if editID != "" {
+		noticeID = editID
+	}
+	if sender := portal.bridge.GetUserByMXIDIfExists(evt.Sender); canRetry && sender != nil {
+		retryTarget := evt.ID
+		if retryMeta := evt.Content.AsMessage().MessageSendRetry; retryMeta != nil {
+			retryTarget = retryMeta.OriginalEventID
+		}
+		err = sender.RegisterPrompt(ctx, portal.MXID, noticeID, PromptRetryMessage, retryTarget.String())
+		if err != nil {
+			zerolog.Ctx(ctx).Err(err).Msg("Failed to register retry prompt for bridging error message")
+		}
+	}
 	return resp.EventID
 }
 
@@ -222,20 +270,34 @@ func (portal *Portal) sendMessageMetrics(ctx context.Context, evt *event.Event,
 		zerolog.Ctx(ctx).WithLevel(level).Err(err).Msg(part + " Matrix event")
 		reason, statusCode, isCertain, sendNotice, _ := errorToStatusReason(err)
 		checkpointStatus := status.ReasonToCheckpointStatus(reason, statusCode)
-		portal.bridge.SendMessageCheckpoint(evt, status.MsgStepRemote, err, checkpointStatus, ms.getRetryNum())
+		portal.bridge.SendMessageCheckpoint(evt, status.MsgStepRemote, Analytics.PseudonymizeError(err), checkpointStatus, ms.getRetryNum())
+		if statusCode != event.MessageStatusPending {
+			if dbErr := portal.bridge.DB.Message.SetFailureReason(ctx, origEvtID, err.Error()); dbErr != nil {
+				zerolog.Ctx(ctx).Err(dbErr).Msg("Failed to save message failure reason to database")
+			}
+		}
 		if sendNotice {
 			ms.setNoticeID(portal.sendErrorMessage(ctx, evt, err, isCertain, ms.getNoticeID()))
 		}
 		portal.sendStatusEvent(ctx, origEvtID, evt.ID, err, nil)
+		if statusCode != event.MessageStatusPending {
+			portal.sendMatrixBridgeError(ctx, evt, origEvtID, err)
+		}
+		if part != "Ignoring" {
+			portal.bridge.Webhooks.Send(WebhookMessageBridgeFailed, map[string]any{
+				"room_id":  portal.MXID,
+				"event_id": origEvtID,
+				"sender":   evt.Sender,
+				"reason":   reason,
+				"error":    err.Error(),
+			})
+		}
 	} else {
 		zerolog.Ctx(ctx).Debug().Msg("Successfully handled Matrix event")
 		portal.sendDeliveryReceipt(ctx, evt.ID)
 		portal.bridge.SendMessageSuccessCheckpoint(evt, status.MsgStepRemote, ms.getRetryNum())
-		var deliveredTo *[]id.UserID
-		if portal.IsPrivateChat() {
-			deliveredTo = &[]id.UserID{}
-		}
-		portal.sendStatusEvent(ctx, origEvtID, evt.ID, nil, deliveredTo)
+		// The server has acknowledged the message, but it hasn't reached any phones yet
+		portal.sendStatusEvent(ctx, origEvtID, evt.ID, nil, &[]id.UserID{})
 		if prevNotice := ms.popNoticeID(); prevNotice != "" {
 			_, _ = portal.MainIntent().RedactEvent(ctx, portal.MXID, prevNotice, mautrix.ReqRedact{
 				Reason: "error resolved",
@@ -18,10 +18,12 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"net/http"
 	"runtime/debug"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -29,6 +31,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
+	"go.mau.fi/util/dbutil"
 
 	"go.mau.fi/whatsmeow/types"
 
@@ -55,9 +58,12 @@ type MetricsHandler struct {
 	disconnections          *prometheus.CounterVec
 	incomingRetryReceipts   *prometheus.CounterVec
 	connectionFailures      *prometheus.CounterVec
+	streamErrors            *prometheus.CounterVec
 	puppetCount             prometheus.Gauge
 	activePuppetCount       prometheus.Gauge
 	bridgeBlocked           prometheus.Gauge
+	puppetLimit             prometheus.Gauge
+	puppetLimitUsage        prometheus.Gauge
 	userCount               prometheus.Gauge
 	messageCount            prometheus.Gauge
 	portalCount             *prometheus.GaugeVec
@@ -65,6 +71,25 @@ type MetricsHandler struct {
 	encryptedPrivateCount   prometheus.Gauge
 	unencryptedGroupCount   prometheus.Gauge
 	unencryptedPrivateCount prometheus.Gauge
+	portalTypeCount         *prometheus.GaugeVec
+	puppetTypeCount         *prometheus.GaugeVec
+	databaseQueries         *prometheus.HistogramVec
+	databaseQueriesByName   *prometheus.HistogramVec
+	databaseQueryErrors     *prometheus.CounterVec
+	databaseConnections     *prometheus.GaugeVec
+	databasePoolSaturation  prometheus.Gauge
+	deliveryLatency         *prometheus.HistogramVec
+	mediaTransferSize       *prometheus.HistogramVec
+	mediaTransferDuration   *prometheus.HistogramVec
+	backfillTasks           *prometheus.GaugeVec
+	handlerTimeouts         *prometheus.CounterVec
+	homeserverRequestWait   *prometheus.HistogramVec
+	homeserverRateLimited   *prometheus.CounterVec
+	membershipEnsures       *prometheus.CounterVec
+
+	connectionUptime   *prometheus.GaugeVec
+	connectedSince     map[id.UserID]time.Time
+	connectedSinceLock sync.Mutex
 
 	connected          prometheus.Gauge
 	connectedState     map[string]bool
@@ -79,6 +104,18 @@ func NewMetricsHandler(address string, log zerolog.Logger, db *database.Database
 		Name: "whatsapp_portals_total",
 		Help: "Number of portal rooms on Matrix",
 	}, []string{"type", "encrypted"})
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "bridge_database_pool_waits_total",
+		Help: "Total number of times a query had to wait for a free database connection",
+	}, func() float64 {
+		return float64(db.RawDB.Stats().WaitCount)
+	})
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "bridge_database_pool_wait_seconds_total",
+		Help: "Total time spent waiting for a free database connection",
+	}, func() float64 {
+		return db.RawDB.Stats().WaitDuration.Seconds()
+	})
 	return &MetricsHandler{
 		db:             db,
 		server:         &http.Server{Addr: address, Handler: promhttp.Handler()},
@@ -110,6 +147,10 @@ func NewMetricsHandler(address string, log zerolog.Logger, db *database.Database
 			Name: "whatsapp_connection_failures",
 			Help: "Number of times a connection has failed to whatsapp",
 		}, []string{"reason"}),
+		streamErrors: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "whatsapp_stream_errors",
+			Help: "Number of WhatsApp stream errors and connect failures by recovery category",
+		}, []string{"category"}),
 		incomingRetryReceipts: promauto.NewCounterVec(prometheus.CounterOpts{
 			Name: "whatsapp_incoming_retry_receipts",
 			Help: "Number of times a remote WhatsApp user has requested a retry from the bridge. retry_count = 5 is usually the last attempt (and very likely means a failed message)",
@@ -122,6 +163,14 @@ func NewMetricsHandler(address string, log zerolog.Logger, db *database.Database
 			Name: "whatsapp_active_puppets_total",
 			Help: "Number of active WhatsApp users bridged into Matrix",
 		}),
+		puppetLimit: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "whatsapp_puppet_limit",
+			Help: "Maximum number of active WhatsApp users allowed by the bridge limits (0 if unlimited)",
+		}),
+		puppetLimitUsage: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "whatsapp_puppet_limit_usage_ratio",
+			Help: "Ratio of active WhatsApp users to the maximum puppet limit",
+		}),
 		bridgeBlocked: promauto.NewGauge(prometheus.GaugeOpts{
 			Name: "whatsapp_bridge_blocked",
 			Help: "Is the bridge currently blocking messages",
@@ -139,6 +188,77 @@ func NewMetricsHandler(address string, log zerolog.Logger, db *database.Database
 		encryptedPrivateCount:   portalCount.With(prometheus.Labels{"type": "private", "encrypted": "true"}),
 		unencryptedGroupCount:   portalCount.With(prometheus.Labels{"type": "group", "encrypted": "false"}),
 		unencryptedPrivateCount: portalCount.With(prometheus.Labels{"type": "private", "encrypted": "false"}),
+		portalTypeCount: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "whatsapp_portals_by_type",
+			Help: "Number of portal rooms on Matrix by chat type",
+		}, []string{"type"}),
+		puppetTypeCount: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "whatsapp_puppets_by_type",
+			Help: "Number of WhatsApp users bridged into Matrix by custom MXID and contact info state",
+		}, []string{"custom_mxid", "contact_info_set"}),
+		databaseQueries: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "bridge_database_query",
+			Help:    "Time spent executing database queries",
+			Buckets: []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+		}, []string{"dialect", "method"}),
+		databaseQueriesByName: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "bridge_database_query_by_name",
+			Help:    "Time spent executing database queries by statement type and table",
+			Buckets: []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+		}, []string{"dialect", "method", "query"}),
+		databaseQueryErrors: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "bridge_database_query_errors",
+			Help: "Number of database queries that returned an error",
+		}, []string{"dialect", "method", "query"}),
+		databaseConnections: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "bridge_database_connections",
+			Help: "Number of database connections in the pool by state",
+		}, []string{"state"}),
+		databasePoolSaturation: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "bridge_database_pool_saturation",
+			Help: "Fraction of the maximum number of database connections that are currently in use",
+		}),
+		deliveryLatency: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "bridge_message_delivery_latency",
+			Help:    "Time between a message being sent on one side and delivered to the other side",
+			Buckets: []float64{0.1, 0.25, 0.5, 1, 2, 3, 5, 7.5, 10, 20, 30, 60},
+		}, []string{"user_id", "direction"}),
+		mediaTransferSize: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "whatsapp_media_transfer_bytes",
+			Help:    "Size of media uploaded to or downloaded from WhatsApp",
+			Buckets: prometheus.ExponentialBuckets(16*1024, 4, 9),
+		}, []string{"user_id", "direction"}),
+		mediaTransferDuration: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "whatsapp_media_transfer_duration",
+			Help:    "Time spent uploading media to or downloading media from WhatsApp",
+			Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+		}, []string{"user_id", "direction"}),
+		backfillTasks: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "whatsapp_backfill_queue_tasks",
+			Help: "Number of backfill tasks in the queue by state",
+		}, []string{"user_id", "state"}),
+		handlerTimeouts: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "bridge_handler_timeouts",
+			Help: "Number of events whose handling was cancelled because it exceeded the configured deadline",
+		}, []string{"direction"}),
+		homeserverRequestWait: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "bridge_homeserver_request_wait",
+			Help:    "Time homeserver requests spent waiting for the client-side rate limiter",
+			Buckets: []float64{0.001, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		}, []string{"priority"}),
+		homeserverRateLimited: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "bridge_homeserver_rate_limited",
+			Help: "Number of homeserver requests that got a 429 response",
+		}, []string{"priority"}),
+		membershipEnsures: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "bridge_membership_ensures",
+			Help: "Number of ensure-registered and ensure-joined calls for ghost users by whether they were answered by the state store, coalesced, failed recently or executed",
+		}, []string{"result"}),
+		connectionUptime: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "bridge_connection_uptime",
+			Help: "Number of seconds a bridge user has been connected to WhatsApp",
+		}, []string{"user_id"}),
+		connectedSince: make(map[id.UserID]time.Time),
 
 		loggedIn: promauto.NewGauge(prometheus.GaugeOpts{
 			Name: "bridge_logged_in",
@@ -190,6 +310,13 @@ func (mh *MetricsHandler) TrackDisconnection(userID id.UserID) {
 	mh.disconnections.With(prometheus.Labels{"user_id": string(userID)}).Inc()
 }
 
+func (mh *MetricsHandler) TrackHandlerTimeout(direction string) {
+	if !mh.running {
+		return
+	}
+	mh.handlerTimeouts.With(prometheus.Labels{"direction": direction}).Inc()
+}
+
 func (mh *MetricsHandler) TrackConnectionFailure(reason string) {
 	if !mh.running {
 		return
@@ -197,6 +324,34 @@ func (mh *MetricsHandler) TrackConnectionFailure(reason string) {
 	mh.connectionFailures.With(prometheus.Labels{"reason": reason}).Inc()
 }
 
+func (mh *MetricsHandler) TrackStreamError(category StreamErrorCategory) {
+	if !mh.running {
+		return
+	}
+	mh.streamErrors.With(prometheus.Labels{"category": string(category)}).Inc()
+}
+
+func (mh *MetricsHandler) TrackHomeserverRequestWait(priority string, wait time.Duration) {
+	if !mh.running {
+		return
+	}
+	mh.homeserverRequestWait.With(prometheus.Labels{"priority": priority}).Observe(wait.Seconds())
+}
+
+func (mh *MetricsHandler) TrackHomeserverRateLimited(priority string) {
+	if !mh.running {
+		return
+	}
+	mh.homeserverRateLimited.With(prometheus.Labels{"priority": priority}).Inc()
+}
+
+func (mh *MetricsHandler) TrackMembershipEnsure(result string) {
+	if !mh.running {
+		return
+	}
+	mh.membershipEnsures.With(prometheus.Labels{"result": result}).Inc()
+}
+
 func (mh *MetricsHandler) TrackRetryReceipt(count int, found bool) {
 	if !mh.running {
 		return
@@ -241,6 +396,159 @@ func (mh *MetricsHandler) TrackConnectionState(jid types.JID, connected bool) {
 	}
 }
 
+const (
+	MetricsDirectionToMatrix   = "whatsapp_to_matrix"
+	MetricsDirectionToWhatsApp = "matrix_to_whatsapp"
+	MetricsDirectionUpload     = "upload"
+	MetricsDirectionDownload   = "download"
+)
+
+func (mh *MetricsHandler) TrackDeliveryLatency(userID id.UserID, direction string, sentAt time.Time) {
+	if !mh.running || sentAt.IsZero() {
+		return
+	}
+	mh.deliveryLatency.
+		With(prometheus.Labels{"user_id": string(userID), "direction": direction}).
+		Observe(time.Since(sentAt).Seconds())
+}
+
+func (mh *MetricsHandler) TrackMediaTransfer(userID id.UserID, direction string, size int, start time.Time) {
+	if !mh.running {
+		return
+	}
+	labels := prometheus.Labels{"user_id": string(userID), "direction": direction}
+	mh.mediaTransferSize.With(labels).Observe(float64(size))
+	mh.mediaTransferDuration.With(labels).Observe(time.Since(start).Seconds())
+}
+
+// TrackConnectedSince records when the given user's current WhatsApp connection was established.
+// A zero time means the user is currently disconnected.
+func (mh *MetricsHandler) TrackConnectedSince(userID id.UserID, since time.Time) {
+	if !mh.running {
+		return
+	}
+	mh.connectedSinceLock.Lock()
+	defer mh.connectedSinceLock.Unlock()
+	if since.IsZero() {
+		delete(mh.connectedSince, userID)
+		mh.connectionUptime.With(prometheus.Labels{"user_id": string(userID)}).Set(0)
+	} else {
+		mh.connectedSince[userID] = since
+	}
+}
+
+func (mh *MetricsHandler) updateConnectionUptime() {
+	mh.connectedSinceLock.Lock()
+	defer mh.connectedSinceLock.Unlock()
+	for userID, since := range mh.connectedSince {
+		mh.connectionUptime.With(prometheus.Labels{"user_id": string(userID)}).Set(time.Since(since).Seconds())
+	}
+}
+
+func (mh *MetricsHandler) updateBackfillStats() {
+	rows, err := mh.db.Query(mh.ctx, `
+			SELECT
+				user_mxid,
+				COUNT(CASE WHEN dispatch_time IS NULL AND completed_at IS NULL THEN 1 END) AS pending,
+				COUNT(CASE WHEN dispatch_time IS NOT NULL AND completed_at IS NULL THEN 1 END) AS in_flight,
+				COUNT(CASE WHEN completed_at IS NOT NULL THEN 1 END) AS completed
+			FROM backfill_queue GROUP BY user_mxid
+		`)
+	if err != nil {
+		mh.log.Err(err).Msg("Failed to query backfill queue state")
+		return
+	}
+	defer rows.Close()
+	mh.backfillTasks.Reset()
+	for rows.Next() {
+		var userID string
+		var pending, inFlight, completed int
+		if err = rows.Scan(&userID, &pending, &inFlight, &completed); err != nil {
+			mh.log.Err(err).Msg("Failed to scan backfill queue state")
+			return
+		}
+		mh.backfillTasks.With(prometheus.Labels{"user_id": userID, "state": "pending"}).Set(float64(pending))
+		mh.backfillTasks.With(prometheus.Labels{"user_id": userID, "state": "in_flight"}).Set(float64(inFlight))
+		mh.backfillTasks.With(prometheus.Labels{"user_id": userID, "state": "completed"}).Set(float64(completed))
+	}
+}
+
+func (mh *MetricsHandler) TrackDatabaseQuery(dialect dbutil.Dialect, method, query string, duration time.Duration, err error) {
+	if !mh.running {
+		return
+	}
+	mh.databaseQueries.
+		With(prometheus.Labels{"dialect": dialect.String(), "method": method}).
+		Observe(duration.Seconds())
+	labels := prometheus.Labels{"dialect": dialect.String(), "method": method, "query": getDatabaseQueryName(query)}
+	mh.databaseQueriesByName.With(labels).Observe(duration.Seconds())
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		mh.databaseQueryErrors.With(labels).Inc()
+	}
+}
+
+// getDatabaseQueryName returns a low-cardinality name for a query, consisting of the statement type and
+// the first table it touches (e.g. "select message"). Only the words up to the table name are looked at,
+// so the name doesn't depend on the rest of the query, like the number of placeholders.
+func getDatabaseQueryName(query string) string {
+	var statement, prev string
+	for rest := query; ; {
+		var field string
+		rest = strings.TrimLeft(rest, " \t\r\n")
+		if end := strings.IndexAny(rest, " \t\r\n"); end >= 0 {
+			field, rest = rest[:end], rest[end:]
+		} else {
+			field, rest = rest, ""
+		}
+		if field == "" {
+			break
+		}
+		field = strings.ToLower(field)
+		if statement == "" {
+			statement = field
+		} else if (prev == statement && statement == "update") || prev == "from" || prev == "into" {
+			if table := strings.Trim(field, `"(;`); table != "" {
+				return statement + " " + table
+			}
+			break
+		}
+		prev = field
+	}
+	if statement == "" {
+		return "unknown"
+	}
+	return statement
+}
+
+// metricsDatabaseLogger wraps a database logger to record query timings in the database query histogram.
+type metricsDatabaseLogger struct {
+	dbutil.DatabaseLogger
+	mh      *MetricsHandler
+	dialect dbutil.Dialect
+}
+
+func (mh *MetricsHandler) WrapDatabaseLogger(dialect dbutil.Dialect, log dbutil.DatabaseLogger) dbutil.DatabaseLogger {
+	return &metricsDatabaseLogger{DatabaseLogger: log, mh: mh, dialect: dialect}
+}
+
+func (mdl *metricsDatabaseLogger) QueryTiming(ctx context.Context, method, query string, args []any, nrows int, duration time.Duration, err error) {
+	mdl.mh.TrackDatabaseQuery(mdl.dialect, method, query, duration, err)
+	mdl.DatabaseLogger.QueryTiming(ctx, method, query, args, nrows, duration, err)
+}
+
+func (mh *MetricsHandler) updateDatabasePoolStats() {
+	stats := mh.db.RawDB.Stats()
+	mh.databaseConnections.With(prometheus.Labels{"state": "open"}).Set(float64(stats.OpenConnections))
+	mh.databaseConnections.With(prometheus.Labels{"state": "in_use"}).Set(float64(stats.InUse))
+	mh.databaseConnections.With(prometheus.Labels{"state": "idle"}).Set(float64(stats.Idle))
+	mh.databaseConnections.With(prometheus.Labels{"state": "max"}).Set(float64(stats.MaxOpenConnections))
+	if stats.MaxOpenConnections > 0 {
+		mh.databasePoolSaturation.Set(float64(stats.InUse) / float64(stats.MaxOpenConnections))
+	} else {
+		mh.databasePoolSaturation.Set(0)
+	}
+}
+
 func (mh *MetricsHandler) updateStats() {
 	start := time.Now()
 	var puppetCount int
@@ -252,6 +560,12 @@ func (mh *MetricsHandler) updateStats() {
 	}
 
 	mh.activePuppetCount.Set(float64(mh.puppetActivity.currentUserCount))
+	mh.puppetLimit.Set(float64(mh.puppetActivity.limit))
+	if mh.puppetActivity.limit > 0 {
+		mh.puppetLimitUsage.Set(float64(mh.puppetActivity.currentUserCount) / float64(mh.puppetActivity.limit))
+	} else {
+		mh.puppetLimitUsage.Set(0)
+	}
 	if mh.puppetActivity.isBlocked {
 		mh.bridgeBlocked.Set(1)
 	} else {
@@ -289,8 +603,53 @@ func (mh *MetricsHandler) updateStats() {
 		mh.encryptedGroupCount.Set(float64(encryptedGroupCount))
 		mh.encryptedPrivateCount.Set(float64(encryptedPrivateCount))
 		mh.unencryptedGroupCount.Set(float64(unencryptedGroupCount))
-		mh.unencryptedPrivateCount.Set(float64(encryptedPrivateCount))
+		mh.unencryptedPrivateCount.Set(float64(unencryptedPrivateCount))
+	}
+
+	var dmCount, lidDMCount, groupCount, newsletterCount, broadcastCount int
+	err = mh.db.QueryRow(mh.ctx, `
+			SELECT
+				COUNT(CASE WHEN jid LIKE '%@s.whatsapp.net' THEN 1 END) AS dm_portals,
+				COUNT(CASE WHEN jid LIKE '%@lid' THEN 1 END) AS lid_dm_portals,
+				COUNT(CASE WHEN jid LIKE '%@g.us' THEN 1 END) AS group_portals,
+				COUNT(CASE WHEN jid LIKE '%@newsletter' THEN 1 END) AS newsletter_portals,
+				COUNT(CASE WHEN jid LIKE '%@broadcast' THEN 1 END) AS broadcast_portals
+			FROM portal WHERE mxid<>''
+		`).Scan(&dmCount, &lidDMCount, &groupCount, &newsletterCount, &broadcastCount)
+	if err != nil {
+		mh.log.Err(err).Msg("Failed to scan number of portals by type")
+	} else {
+		mh.portalTypeCount.With(prometheus.Labels{"type": "dm"}).Set(float64(dmCount + lidDMCount))
+		mh.portalTypeCount.With(prometheus.Labels{"type": "group"}).Set(float64(groupCount))
+		mh.portalTypeCount.With(prometheus.Labels{"type": "newsletter"}).Set(float64(newsletterCount))
+		mh.portalTypeCount.With(prometheus.Labels{"type": "broadcast"}).Set(float64(broadcastCount))
+	}
+
+	rows, err := mh.db.Query(mh.ctx, `
+			SELECT COALESCE(custom_mxid, '')<>'' AS has_custom_mxid, contact_info_set, COUNT(*)
+			FROM puppet GROUP BY has_custom_mxid, contact_info_set
+		`)
+	if err != nil {
+		mh.log.Err(err).Msg("Failed to query number of puppets by type")
+	} else {
+		mh.puppetTypeCount.Reset()
+		for rows.Next() {
+			var hasCustomMXID, contactInfoSet bool
+			var count int
+			if err = rows.Scan(&hasCustomMXID, &contactInfoSet, &count); err != nil {
+				mh.log.Err(err).Msg("Failed to scan number of puppets by type")
+				break
+			}
+			mh.puppetTypeCount.With(prometheus.Labels{
+				"custom_mxid":      strconv.FormatBool(hasCustomMXID),
+				"contact_info_set": strconv.FormatBool(contactInfoSet),
+			}).Set(float64(count))
+		}
+		_ = rows.Close()
 	}
+	mh.updateBackfillStats()
+	mh.updateConnectionUptime()
+	mh.updateDatabasePoolStats()
 	mh.countCollection.Observe(time.Now().Sub(start).Seconds())
 }
 
@@ -0,0 +1,194 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"github.com/element-hq/mautrix-go/event"
+	"github.com/element-hq/mautrix-go/format"
+	"github.com/element-hq/mautrix-go/id"
+)
+
+const moderationEventField = "fi.mau.whatsapp.moderation_event"
+
+type ModerationAction string
+
+const (
+	ModerationMembersJoined     ModerationAction = "members_joined"
+	ModerationMembersLeft       ModerationAction = "members_left"
+	ModerationAdminsPromoted    ModerationAction = "admins_promoted"
+	ModerationAdminsDemoted     ModerationAction = "admins_demoted"
+	ModerationInviteLinkChanged ModerationAction = "invite_link_changed"
+)
+
+// ModerationEvent is the structured content of a moderation feed notice.
+type ModerationEvent struct {
+	Action     ModerationAction `json:"action"`
+	GroupJID   types.JID        `json:"group_jid"`
+	GroupName  string           `json:"group_name,omitempty"`
+	PortalMXID id.RoomID        `json:"portal_mxid,omitempty"`
+	Actor      *types.JID       `json:"actor,omitempty"`
+	Targets    []types.JID      `json:"targets,omitempty"`
+	JoinReason string           `json:"join_reason,omitempty"`
+	Timestamp  int64            `json:"timestamp"`
+}
+
+// moderationFeedDedupTime is how long sent moderation events are remembered. Every logged-in member of a group
+// receives the same group update, so they need to be deduplicated to only send one notice per change.
+const moderationFeedDedupTime = 10 * time.Minute
+
+type moderationFeedDedup struct {
+	sent map[string]time.Time
+	lock sync.Mutex
+}
+
+func (dedup *moderationFeedDedup) check(key string) bool {
+	dedup.lock.Lock()
+	defer dedup.lock.Unlock()
+	if dedup.sent == nil {
+		dedup.sent = make(map[string]time.Time)
+	}
+	for otherKey, ts := range dedup.sent {
+		if time.Since(ts) > moderationFeedDedupTime {
+			delete(dedup.sent, otherKey)
+		}
+	}
+	if _, alreadySent := dedup.sent[key]; alreadySent {
+		return false
+	}
+	dedup.sent[key] = time.Now()
+	return true
+}
+
+func getModerationEvents(evt *events.GroupInfo) []*ModerationEvent {
+	var output []*ModerationEvent
+	add := func(action ModerationAction, targets []types.JID) {
+		output = append(output, &ModerationEvent{
+			Action:    action,
+			GroupJID:  evt.JID,
+			Actor:     evt.Sender,
+			Targets:   targets,
+			Timestamp: evt.Timestamp.UnixMilli(),
+		})
+	}
+	if len(evt.Join) > 0 {
+		add(ModerationMembersJoined, evt.Join)
+		output[len(output)-1].JoinReason = evt.JoinReason
+	}
+	if len(evt.Leave) > 0 {
+		add(ModerationMembersLeft, evt.Leave)
+	}
+	if len(evt.Promote) > 0 {
+		add(ModerationAdminsPromoted, evt.Promote)
+	}
+	if len(evt.Demote) > 0 {
+		add(ModerationAdminsDemoted, evt.Demote)
+	}
+	if evt.NewInviteLink != nil {
+		add(ModerationInviteLinkChanged, nil)
+	}
+	return output
+}
+
+func (br *WABridge) formatModerationUser(jid types.JID) string {
+	puppet := br.GetPuppetByJID(jid)
+	if puppet == nil {
+		return fmt.Sprintf("`%s`", jid)
+	}
+	name := puppet.Displayname
+	if name == "" {
+		name = "+" + jid.User
+	}
+	return fmt.Sprintf("[%s](%s)", escapeMarkdown(name), puppet.MXID.URI().MatrixToURL())
+}
+
+func (br *WABridge) formatModerationEvent(evt *ModerationEvent) string {
+	group := fmt.Sprintf("`%s`", evt.GroupJID)
+	if evt.GroupName != "" {
+		group = escapeMarkdown(evt.GroupName)
+	}
+	if evt.PortalMXID != "" {
+		group = fmt.Sprintf("[%s](%s)", group, evt.PortalMXID.URI(br.Config.Homeserver.Domain).MatrixToURL())
+	}
+	actor := "Someone"
+	if evt.Actor != nil && !evt.Actor.IsEmpty() {
+		actor = br.formatModerationUser(*evt.Actor)
+	}
+	targets := make([]string, len(evt.Targets))
+	for i, target := range evt.Targets {
+		targets[i] = br.formatModerationUser(target)
+	}
+	targetList := strings.Join(targets, ", ")
+	switch evt.Action {
+	case ModerationMembersJoined:
+		if evt.JoinReason == "invite" || (evt.Actor != nil && len(evt.Targets) == 1 && evt.Targets[0] == *evt.Actor) {
+			return fmt.Sprintf("%s joined %s", targetList, group)
+		}
+		return fmt.Sprintf("%s added %s to %s", actor, targetList, group)
+	case ModerationMembersLeft:
+		if evt.Actor != nil && len(evt.Targets) == 1 && evt.Targets[0] == *evt.Actor {
+			return fmt.Sprintf("%s left %s", targetList, group)
+		}
+		return fmt.Sprintf("%s removed %s from %s", actor, targetList, group)
+	case ModerationAdminsPromoted:
+		return fmt.Sprintf("%s made %s admin in %s", actor, targetList, group)
+	case ModerationAdminsDemoted:
+		return fmt.Sprintf("%s removed admin from %s in %s", actor, targetList, group)
+	case ModerationInviteLinkChanged:
+		return fmt.Sprintf("%s reset the invite link of %s", actor, group)
+	default:
+		return fmt.Sprintf("Unknown moderation event %s in %s", evt.Action, group)
+	}
+}
+
+// SendToModerationFeed sends a notice about membership, admin and invite link changes in a group to the
+// configured moderation room.
+func (br *WABridge) SendToModerationFeed(ctx context.Context, portal *Portal, evt *events.GroupInfo) {
+	roomID := br.Config.Bridge.ModerationRoom
+	if roomID == "" {
+		return
+	}
+	log := zerolog.Ctx(ctx)
+	for _, modEvt := range getModerationEvents(evt) {
+		dedupKey := fmt.Sprintf("%s|%s|%d|%v", modEvt.GroupJID, modEvt.Action, modEvt.Timestamp, modEvt.Targets)
+		if !br.moderationFeedDedup.check(dedupKey) {
+			continue
+		}
+		modEvt.GroupName = portal.Name
+		modEvt.PortalMXID = portal.MXID
+		content := format.RenderMarkdown(br.formatModerationEvent(modEvt), true, false)
+		content.MsgType = event.MsgNotice
+		_, err := br.Bot.SendMessageEvent(ctx, roomID, event.EventMessage, &event.Content{
+			Parsed: &content,
+			Raw: map[string]interface{}{
+				moderationEventField: modEvt,
+			},
+		})
+		if err != nil {
+			log.Err(err).Str("moderation_action", string(modEvt.Action)).Msg("Failed to send notice to moderation feed")
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+)
+
+var (
+	errNewsletterNotAdmin        = errors.New("only channel admins can post to this channel")
+	errNewsletterUnsupportedType = errors.New("this message type can't be posted to channels")
+)
+
+const newsletterRoleCacheTTL = 1 * time.Hour
+
+type newsletterRoleCacheEntry struct {
+	Role      types.NewsletterRole
+	FetchedAt time.Time
+}
+
+func (portal *Portal) cacheNewsletterRole(user *User, role types.NewsletterRole) {
+	portal.newsletterRolesLock.Lock()
+	portal.newsletterRoles[user.MXID] = newsletterRoleCacheEntry{Role: role, FetchedAt: time.Now()}
+	portal.newsletterRolesLock.Unlock()
+}
+
+func (portal *Portal) getNewsletterRole(ctx context.Context, user *User) (types.NewsletterRole, error) {
+	portal.newsletterRolesLock.Lock()
+	cached, ok := portal.newsletterRoles[user.MXID]
+	portal.newsletterRolesLock.Unlock()
+	if ok && time.Since(cached.FetchedAt) < newsletterRoleCacheTTL {
+		return cached.Role, nil
+	}
+	meta, err := user.Client.GetNewsletterInfo(portal.Key.JID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get channel info: %w", err)
+	}
+	var role types.NewsletterRole
+	if meta.ViewerMeta != nil {
+		role = meta.ViewerMeta.Role
+	}
+	zerolog.Ctx(ctx).Debug().Str("newsletter_role", string(role)).Msg("Fetched user's role in channel")
+	portal.cacheNewsletterRole(user, role)
+	return role, nil
+}
+
+// prepareNewsletterMessage checks that the sender is allowed to post in the channel and adjusts
+// the message to the subset of features that channels support.
+func (portal *Portal) prepareNewsletterMessage(ctx context.Context, sender *User, msg *waProto.Message) error {
+	role, err := portal.getNewsletterRole(ctx, sender)
+	if err != nil {
+		return err
+	} else if role != types.NewsletterRoleAdmin && role != types.NewsletterRoleOwner {
+		return errNewsletterNotAdmin
+	}
+	var ctxInfo *waProto.ContextInfo
+	switch {
+	case msg.Conversation != nil, msg.EditedMessage != nil,
+		msg.PollCreationMessage != nil, msg.PollCreationMessageV2 != nil, msg.PollCreationMessageV3 != nil:
+	case msg.ExtendedTextMessage != nil:
+		ctxInfo = msg.ExtendedTextMessage.GetContextInfo()
+	case msg.ImageMessage != nil:
+		ctxInfo = msg.ImageMessage.GetContextInfo()
+	case msg.VideoMessage != nil:
+		ctxInfo = msg.VideoMessage.GetContextInfo()
+	case msg.AudioMessage != nil:
+		ctxInfo = msg.AudioMessage.GetContextInfo()
+	case msg.StickerMessage != nil:
+		ctxInfo = msg.StickerMessage.GetContextInfo()
+	default:
+		return errNewsletterUnsupportedType
+	}
+	if ctxInfo != nil {
+		// Channels don't have replies or mentions
+		ctxInfo.StanzaId = nil
+		ctxInfo.Participant = nil
+		ctxInfo.RemoteJid = nil
+		ctxInfo.QuotedMessage = nil
+		ctxInfo.MentionedJid = nil
+	}
+	return nil
+}
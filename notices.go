@@ -0,0 +1,279 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// NoticeKey identifies a system notice that the bridge renders into portal rooms.
+type NoticeKey string
+
+const (
+	NoticeDisappearingOff      NoticeKey = "disappearing_off"
+	NoticeDisappearingSet      NoticeKey = "disappearing_set"
+	NoticeDisappearingImplicit NoticeKey = "disappearing_implicit"
+
+	NoticeCallIncoming     NoticeKey = "call_incoming"
+	NoticeCallJoinLink     NoticeKey = "call_join_link"
+	NoticeCallJoinLinkHTML NoticeKey = "call_join_link_html"
+	NoticeCallEnded        NoticeKey = "call_ended"
+	NoticeCallNotAnswered  NoticeKey = "call_not_answered"
+	NoticeCallMissed       NoticeKey = "call_missed"
+
+	NoticePinned      NoticeKey = "pinned"
+	NoticePinnedTimed NoticeKey = "pinned_timed"
+	NoticePinExpired  NoticeKey = "pin_expired"
+
+	NoticeAnd NoticeKey = "and"
+
+	NoticeNumberChanged NoticeKey = "number_changed"
+)
+
+// DefaultLocale is used for notices if neither the portal, the user nor the bridge config specify a locale.
+const DefaultLocale = "en"
+
+// noticeLocales contains the translations of system notices. The English strings are used for any key missing
+// from other locales. Call descriptions use keys like "call_video" and duration units use keys like "unit_day".
+var noticeLocales = map[string]map[NoticeKey]string{
+	"en": {
+		NoticeDisappearingOff:      "Turned off disappearing messages",
+		NoticeDisappearingSet:      "Set the disappearing message timer to %s",
+		NoticeDisappearingImplicit: "Automatically enabled disappearing message timer (%s) because incoming message is disappearing",
+		NoticeCallIncoming:         "Incoming %s. Use the WhatsApp app to answer.",
+		NoticeCallJoinLink:         "Matrix users can join the call at %s",
+		NoticeCallJoinLinkHTML:     "Matrix users can join the call <a href=\"%s\">here</a>.",
+		NoticeCallEnded:            "The %s ended after %s.",
+		NoticeCallNotAnswered:      "The outgoing %s was not answered.",
+		NoticeCallMissed:           "Missed %s.",
+		NoticePinned:               "Pinned a message",
+		NoticePinnedTimed:          "Pinned a message for %s",
+		NoticePinExpired:           "The pin on this message expired",
+		NoticeAnd:                  "and",
+		NoticeNumberChanged:        "Changed their WhatsApp phone number from %s to %s",
+
+		"call":             "call",
+		"call_audio":       "audio call",
+		"call_video":       "video call",
+		"call_group":       "group call",
+		"call_group_audio": "group audio call",
+		"call_group_video": "group video call",
+
+		"unit_day": "day", "unit_days": "days",
+		"unit_hour": "hour", "unit_hours": "hours",
+		"unit_minute": "minute", "unit_minutes": "minutes",
+		"unit_second": "second", "unit_seconds": "seconds",
+	},
+	"de": {
+		NoticeDisappearingOff:      "Verschwindende Nachrichten deaktiviert",
+		NoticeDisappearingSet:      "Timer für verschwindende Nachrichten auf %s gesetzt",
+		NoticeDisappearingImplicit: "Timer für verschwindende Nachrichten automatisch aktiviert (%s), da die eingehende Nachricht verschwindet",
+		NoticeCallIncoming:         "Eingehender %s. Verwende die WhatsApp-App, um anzunehmen.",
+		NoticeCallJoinLink:         "Matrix-Nutzer können dem Anruf unter %s beitreten",
+		NoticeCallJoinLinkHTML:     "Matrix-Nutzer können dem Anruf <a href=\"%s\">hier</a> beitreten.",
+		NoticeCallEnded:            "Der %s endete nach %s.",
+		NoticeCallNotAnswered:      "Der ausgehende %s wurde nicht angenommen.",
+		NoticeCallMissed:           "Verpasster %s.",
+		NoticePinned:               "Nachricht angeheftet",
+		NoticePinnedTimed:          "Nachricht für %s angeheftet",
+		NoticePinExpired:           "Die Anheftung dieser Nachricht ist abgelaufen",
+		NoticeAnd:                  "und",
+		NoticeNumberChanged:        "Hat die WhatsApp-Telefonnummer von %s zu %s geändert",
+
+		"call":             "Anruf",
+		"call_audio":       "Audioanruf",
+		"call_video":       "Videoanruf",
+		"call_group":       "Gruppenanruf",
+		"call_group_audio": "Gruppen-Audioanruf",
+		"call_group_video": "Gruppen-Videoanruf",
+
+		"unit_day": "Tag", "unit_days": "Tage",
+		"unit_hour": "Stunde", "unit_hours": "Stunden",
+		"unit_minute": "Minute", "unit_minutes": "Minuten",
+		"unit_second": "Sekunde", "unit_seconds": "Sekunden",
+	},
+	"es": {
+		NoticeDisappearingOff:      "Mensajes temporales desactivados",
+		NoticeDisappearingSet:      "Temporizador de mensajes temporales establecido en %s",
+		NoticeDisappearingImplicit: "Se activó automáticamente el temporizador de mensajes temporales (%s) porque el mensaje entrante es temporal",
+		NoticeCallIncoming:         "%s entrante. Usa la aplicación de WhatsApp para contestar.",
+		NoticeCallJoinLink:         "Los usuarios de Matrix pueden unirse a la llamada en %s",
+		NoticeCallJoinLinkHTML:     "Los usuarios de Matrix pueden unirse a la llamada <a href=\"%s\">aquí</a>.",
+		NoticeCallEnded:            "La %s terminó después de %s.",
+		NoticeCallNotAnswered:      "La %s saliente no fue contestada.",
+		NoticeCallMissed:           "%s perdida.",
+		NoticePinned:               "Fijó un mensaje",
+		NoticePinnedTimed:          "Fijó un mensaje durante %s",
+		NoticePinExpired:           "El mensaje dejó de estar fijado",
+		NoticeAnd:                  "y",
+		NoticeNumberChanged:        "Cambió su número de teléfono de WhatsApp de %s a %s",
+
+		"call":             "llamada",
+		"call_audio":       "llamada de voz",
+		"call_video":       "videollamada",
+		"call_group":       "llamada grupal",
+		"call_group_audio": "llamada grupal de voz",
+		"call_group_video": "videollamada grupal",
+
+		"unit_day": "día", "unit_days": "días",
+		"unit_hour": "hora", "unit_hours": "horas",
+		"unit_minute": "minuto", "unit_minutes": "minutos",
+		"unit_second": "segundo", "unit_seconds": "segundos",
+	},
+	"fr": {
+		NoticeDisappearingOff:      "Messages éphémères désactivés",
+		NoticeDisappearingSet:      "Minuteur des messages éphémères réglé sur %s",
+		NoticeDisappearingImplicit: "Minuteur des messages éphémères activé automatiquement (%s) car le message entrant est éphémère",
+		NoticeCallIncoming:         "%s entrant. Utilisez l'application WhatsApp pour répondre.",
+		NoticeCallJoinLink:         "Les utilisateurs Matrix peuvent rejoindre l'appel sur %s",
+		NoticeCallJoinLinkHTML:     "Les utilisateurs Matrix peuvent rejoindre l'appel <a href=\"%s\">ici</a>.",
+		NoticeCallEnded:            "L'%s s'est terminé après %s.",
+		NoticeCallNotAnswered:      "L'%s sortant n'a pas reçu de réponse.",
+		NoticeCallMissed:           "%s manqué.",
+		NoticePinned:               "A épinglé un message",
+		NoticePinnedTimed:          "A épinglé un message pendant %s",
+		NoticePinExpired:           "L'épinglage de ce message a expiré",
+		NoticeAnd:                  "et",
+		NoticeNumberChanged:        "A changé son numéro de téléphone WhatsApp de %s à %s",
+
+		"call":             "appel",
+		"call_audio":       "appel audio",
+		"call_video":       "appel vidéo",
+		"call_group":       "appel de groupe",
+		"call_group_audio": "appel audio de groupe",
+		"call_group_video": "appel vidéo de groupe",
+
+		"unit_day": "jour", "unit_days": "jours",
+		"unit_hour": "heure", "unit_hours": "heures",
+		"unit_minute": "minute", "unit_minutes": "minutes",
+		"unit_second": "seconde", "unit_seconds": "secondes",
+	},
+	"pt": {
+		NoticeDisappearingOff:      "Mensagens temporárias desativadas",
+		NoticeDisappearingSet:      "Temporizador de mensagens temporárias definido para %s",
+		NoticeDisappearingImplicit: "Temporizador de mensagens temporárias ativado automaticamente (%s) porque a mensagem recebida é temporária",
+		NoticeCallIncoming:         "%s recebida. Use o aplicativo do WhatsApp para atender.",
+		NoticeCallJoinLink:         "Usuários do Matrix podem entrar na chamada em %s",
+		NoticeCallJoinLinkHTML:     "Usuários do Matrix podem entrar na chamada <a href=\"%s\">aqui</a>.",
+		NoticeCallEnded:            "A %s terminou após %s.",
+		NoticeCallNotAnswered:      "A %s realizada não foi atendida.",
+		NoticeCallMissed:           "%s perdida.",
+		NoticePinned:               "Fixou uma mensagem",
+		NoticePinnedTimed:          "Fixou uma mensagem por %s",
+		NoticePinExpired:           "A mensagem deixou de estar fixada",
+		NoticeAnd:                  "e",
+		NoticeNumberChanged:        "Alterou o número de telefone do WhatsApp de %s para %s",
+
+		"call":             "chamada",
+		"call_audio":       "chamada de voz",
+		"call_video":       "chamada de vídeo",
+		"call_group":       "chamada em grupo",
+		"call_group_audio": "chamada de voz em grupo",
+		"call_group_video": "chamada de vídeo em grupo",
+
+		"unit_day": "dia", "unit_days": "dias",
+		"unit_hour": "hora", "unit_hours": "horas",
+		"unit_minute": "minuto", "unit_minutes": "minutos",
+		"unit_second": "segundo", "unit_seconds": "segundos",
+	},
+}
+
+// normalizeLocale converts a locale like "pt-BR" or "de_DE" into the language code used for notices.
+// It returns an empty string if the locale isn't supported.
+func normalizeLocale(locale string) string {
+	lang, _, _ := strings.Cut(strings.ReplaceAll(strings.ToLower(locale), "_", "-"), "-")
+	if _, ok := noticeLocales[lang]; ok {
+		return lang
+	}
+	return ""
+}
+
+func supportedLocales() []string {
+	locales := make([]string, 0, len(noticeLocales))
+	for locale := range noticeLocales {
+		locales = append(locales, locale)
+	}
+	slices.Sort(locales)
+	return locales
+}
+
+// getNoticeString finds the string for the given key in the locale, falling back to English.
+func getNoticeString(locale string, key NoticeKey) (string, bool) {
+	if str, ok := noticeLocales[locale][key]; ok {
+		return str, true
+	}
+	str, ok := noticeLocales[DefaultLocale][key]
+	return str, ok
+}
+
+// formatNotice renders a system notice in the given locale. The first letter is capitalized,
+// as some locales put a lowercase phrase like a call description at the start of the notice.
+func formatNotice(locale string, key NoticeKey, args ...any) string {
+	str, _ := getNoticeString(locale, key)
+	if len(args) > 0 {
+		str = fmt.Sprintf(str, args...)
+	}
+	first, size := utf8.DecodeRuneInString(str)
+	if first != utf8.RuneError && unicode.IsLower(first) {
+		str = string(unicode.ToUpper(first)) + str[size:]
+	}
+	return str
+}
+
+// getLocale returns the locale for notices in the portal: the portal's own locale, then the given user's locale,
+// then the bridge-wide default.
+func (portal *Portal) getLocale(user *User) string {
+	if portal.Locale != "" {
+		return portal.Locale
+	} else if user != nil && user.Locale != "" {
+		return user.Locale
+	} else if locale := normalizeLocale(portal.bridge.Config.Bridge.DefaultLocale); locale != "" {
+		return locale
+	}
+	return DefaultLocale
+}
+
+// describeLocalized describes the call in the given locale, e.g. "video call".
+func (call *ongoingCall) describeLocalized(locale, callType string) string {
+	key := "call"
+	if callType != "" {
+		key += "_" + callType
+	}
+	if call.Media != "" {
+		key += "_" + call.Media
+	}
+	if str, ok := getNoticeString(locale, NoticeKey(key)); ok {
+		return str
+	}
+	return call.describe(callType)
+}
+
+func localizedUnit(locale string, val int, unit string) string {
+	if val == 0 {
+		return ""
+	}
+	key := "unit_" + unit
+	if val != 1 {
+		key += "s"
+	}
+	name, _ := getNoticeString(locale, NoticeKey(key))
+	return fmt.Sprintf("%d %s", val, name)
+}
@@ -0,0 +1,190 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/element-hq/mautrix-go/bridge/commands"
+	"github.com/element-hq/mautrix-go/event"
+
+	"github.com/element-hq/mautrix-whatsapp/database"
+)
+
+// checkNumberChange asks the user whether their chats should be moved over if they logged in with a different
+// phone number than the one they were logged in with before.
+func (user *User) checkNumberChange(ctx context.Context, newJID types.JID) {
+	oldJID := user.PreviousJID
+	if oldJID.IsEmpty() || oldJID.User == newJID.User {
+		return
+	}
+	log := zerolog.Ctx(ctx).With().
+		Stringer("old_jid", oldJID).
+		Stringer("new_jid", newJID.ToNonAD()).
+		Logger()
+	log.Info().Msg("User logged in with a different phone number than before")
+	if user.ManagementRoom == "" {
+		return
+	}
+	text := fmt.Sprintf(
+		"You logged in as +%s, but you were previously logged in as +%s. "+
+			"If you changed your phone number in WhatsApp, react with ✅ to move your private chats to the new number, "+
+			"or ❌ to keep them separate. You can also do it later with the `migrate-number` command.",
+		newJID.User, oldJID.User,
+	)
+	_, err := user.SendPrompt(ctx, user.bridge.Bot, user.ManagementRoom, text, PromptNumberChange, oldJID.String())
+	if err != nil {
+		log.Err(err).Msg("Failed to send number change prompt")
+	}
+}
+
+func (user *User) answerNumberChangePrompt(ctx context.Context, oldJID types.JID, accepted bool) (string, error) {
+	if !accepted {
+		user.PreviousJID = types.EmptyJID
+		return "Okay, your old chats will stay separate.", user.Update(ctx)
+	}
+	migrated, err := user.migrateNumber(ctx, oldJID, user.JID)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Moved %d private chats from +%s to +%s.", migrated, oldJID.User, user.JID.User), nil
+}
+
+// migrateNumber moves the private chat portals and double puppeting of the user's old phone number to the new one.
+func (user *User) migrateNumber(ctx context.Context, oldJID, newJID types.JID) (int, error) {
+	oldJID = oldJID.ToNonAD()
+	newJID = newJID.ToNonAD()
+	if oldJID.IsEmpty() || newJID.IsEmpty() {
+		return 0, fmt.Errorf("missing phone number")
+	} else if oldJID.User == newJID.User {
+		return 0, fmt.Errorf("the old and new phone numbers are the same")
+	} else if oldJID.User != user.PreviousJID.User && !user.Admin {
+		return 0, fmt.Errorf("you can only migrate chats from the number you were previously logged in with")
+	} else if owner := user.bridge.GetUserByJID(oldJID); owner != nil && owner != user && owner.JID.User == oldJID.User {
+		return 0, fmt.Errorf("+%s is currently logged in by another user", oldJID.User)
+	}
+	log := zerolog.Ctx(ctx).With().
+		Str("action", "migrate number").
+		Stringer("old_jid", oldJID).
+		Stringer("new_jid", newJID).
+		Logger()
+	ctx = log.WithContext(ctx)
+	br := user.bridge
+	privateChats, err := br.DB.Portal.FindPrivateChats(ctx, oldJID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get private chats of old number: %w", err)
+	}
+	log.Info().Int("portal_count", len(privateChats)).Msg("Migrating private chats to new phone number")
+	migrated := 0
+	for _, dbPortal := range privateChats {
+		oldPortal := br.GetExistingPortalByJID(dbPortal.Key)
+		if oldPortal == nil {
+			continue
+		}
+		chatJID := dbPortal.Key.JID
+		if chatJID.User == oldJID.User {
+			// The note to self chat moves to the note to self chat of the new number.
+			chatJID = newJID
+		}
+		newPortal := br.GetPortalByJID(database.NewPortalKey(chatJID, newJID))
+		br.mergeDuplicatePortal(ctx, oldPortal, newPortal)
+		if newPortal.MXID != "" {
+			newPortal.sendNumberChangeNotice(ctx, user, oldJID, newJID)
+		}
+		migrated++
+	}
+	user.migrateDoublePuppet(ctx, oldJID, newJID)
+	user.PreviousJID = types.EmptyJID
+	err = user.Update(ctx)
+	if err != nil {
+		log.Err(err).Msg("Failed to save user after migrating number")
+	}
+	log.Info().Int("migrated_count", migrated).Msg("Finished migrating private chats to new phone number")
+	return migrated, nil
+}
+
+func (portal *Portal) sendNumberChangeNotice(ctx context.Context, user *User, oldJID, newJID types.JID) {
+	content := &event.MessageEventContent{
+		MsgType: event.MsgNotice,
+		Body:    formatNotice(portal.getLocale(user), NoticeNumberChanged, "+"+oldJID.User, "+"+newJID.User),
+	}
+	_, err := portal.sendMainIntentMessage(ctx, content)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Stringer("room_id", portal.MXID).Msg("Failed to send number change notice")
+	}
+}
+
+// migrateDoublePuppet moves a manually configured double puppet from the ghost of the old number to the new one.
+func (user *User) migrateDoublePuppet(ctx context.Context, oldJID, newJID types.JID) {
+	oldPuppet := user.bridge.GetPuppetByJID(oldJID)
+	newPuppet := user.bridge.GetPuppetByJID(newJID)
+	if oldPuppet == nil || newPuppet == nil || oldPuppet.CustomMXID != user.MXID || newPuppet.CustomMXID != "" {
+		return
+	}
+	accessToken := oldPuppet.AccessToken
+	oldPuppet.ClearCustomMXID()
+	err := newPuppet.SwitchCustomMXID(accessToken, user.MXID)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to move double puppeting to new phone number")
+	}
+}
+
+var cmdMigrateNumber = &commands.FullHandler{
+	Func: wrapCommand(fnMigrateNumber),
+	Name: "migrate-number",
+	Help: commands.HelpMeta{
+		Section: commands.HelpSectionAuth,
+		Description: "Move your private chats to a new phone number after changing your number in WhatsApp. " +
+			"Only bridge admins can specify a number other than the one you were previously logged in with.",
+		Args: "[_old phone number_]",
+	},
+	RequiresLogin: true,
+}
+
+func fnMigrateNumber(ce *WrappedCommandEvent) {
+	oldJID := ce.User.PreviousJID
+	if len(ce.Args) > 0 {
+		number := "+" + strings.TrimPrefix(strings.Join(ce.Args, ""), "+")
+		if !looksLikeAPhoneRegex.MatchString(number) {
+			ce.Reply("**Usage:** `migrate-number [old phone number]`\n\nThe phone number must be in international format.")
+			return
+		}
+		oldJID = types.NewJID(strings.TrimPrefix(number, "+"), types.DefaultUserServer)
+		if oldJID.User != ce.User.PreviousJID.User && !ce.User.Admin {
+			ce.Reply("You can only migrate chats from the number you were previously logged in with. " +
+				"Ask a bridge admin if you need to migrate chats from a different number.")
+			return
+		}
+	}
+	if oldJID.IsEmpty() {
+		ce.Reply("The bridge doesn't know your old phone number. " +
+			"If you changed your number, log out, log in with the new number and then run `migrate-number <old phone number>`.")
+		return
+	}
+	migrated, err := ce.User.migrateNumber(ce.Ctx, oldJID, ce.User.JID)
+	if err != nil {
+		ce.ZLog.Err(err).Msg("Failed to migrate phone number")
+		ce.Reply("Failed to migrate chats: %v", err)
+		return
+	}
+	ce.Reply("Moved %d private chats from +%s to +%s.", migrated, oldJID.User, ce.User.JID.User)
+}
@@ -0,0 +1,214 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/element-hq/mautrix-go/event"
+	"github.com/element-hq/mautrix-go/id"
+
+	"github.com/element-hq/mautrix-whatsapp/database"
+)
+
+const (
+	outgoingQueueMinBackoff = 5 * time.Second
+	outgoingQueueMaxBackoff = 5 * time.Minute
+)
+
+func outgoingQueueBackoff(attempts int) time.Duration {
+	backoff := outgoingQueueMinBackoff
+	for i := 0; i < attempts && backoff < outgoingQueueMaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, outgoingQueueMaxBackoff)
+}
+
+// spoolOutgoingMessage stores a Matrix message that couldn't be sent because the sender isn't connected,
+// so that it can be retried once the connection is restored. Returns false if the message wasn't queued,
+// in which case the caller should fail the message normally.
+func (portal *Portal) spoolOutgoingMessage(ctx context.Context, sender *User, evt *event.Event, ms *metricSender, queued *database.QueuedMessage) bool {
+	cfg := &portal.bridge.Config.Bridge.OutgoingQueue
+	if !cfg.Enabled || evt.Type != event.EventMessage && evt.Type != event.EventSticker {
+		return false
+	}
+	log := zerolog.Ctx(ctx)
+	if queued == nil {
+		if cfg.MaxSize > 0 {
+			count, err := portal.bridge.DB.OutgoingQueue.CountForUser(ctx, sender.MXID)
+			if err != nil {
+				log.Err(err).Msg("Failed to count queued messages")
+				return false
+			} else if count >= cfg.MaxSize {
+				log.Debug().Int("queue_size", count).Msg("Outgoing queue is full, not queueing message")
+				return false
+			}
+		}
+		queued = portal.bridge.DB.OutgoingQueue.New()
+		queued.EventID = evt.ID
+		queued.RoomID = portal.MXID
+		queued.UserID = sender.MXID
+		queued.QueuedAt = time.Now()
+	} else {
+		queued.Attempts++
+	}
+	if cfg.MaxAge > 0 && time.Since(queued.QueuedAt) > cfg.MaxAge {
+		log.Debug().Time("queued_at", queued.QueuedAt).Msg("Queued message is too old, not queueing again")
+		return false
+	}
+	queued.NextAttempt = time.Now().Add(outgoingQueueBackoff(queued.Attempts))
+	ms.sendMessageMetrics(ctx, evt, errMessageQueued, "Queueing", true)
+	queued.NoticeID = ms.getNoticeID()
+	err := queued.Upsert(ctx)
+	if err != nil {
+		log.Err(err).Msg("Failed to save queued message")
+		return false
+	}
+	log.Debug().
+		Int("attempts", queued.Attempts).
+		Time("next_attempt", queued.NextAttempt).
+		Msg("Queued Matrix message until WhatsApp connection is restored")
+	return true
+}
+
+// hasQueuedMessages returns true if the sender still has messages in the outgoing queue for this portal.
+// New messages must be queued behind them to preserve the order they were sent in.
+func (portal *Portal) hasQueuedMessages(ctx context.Context, sender *User) bool {
+	if !portal.bridge.Config.Bridge.OutgoingQueue.Enabled {
+		return false
+	}
+	count, err := portal.bridge.DB.OutgoingQueue.CountForUserInRoom(ctx, sender.MXID, portal.MXID)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to count queued messages in room")
+		return false
+	}
+	return count > 0
+}
+
+// fetchQueuedEvent gets a queued event from the homeserver, as only the event ID is stored in the database
+// to avoid keeping the plaintext of encrypted messages at rest.
+func (portal *Portal) fetchQueuedEvent(ctx context.Context, qm *database.QueuedMessage) (*event.Event, error) {
+	intent := portal.MainIntent()
+	if portal.Encrypted {
+		intent = portal.bridge.Bot
+	}
+	evt, err := intent.GetEvent(ctx, qm.RoomID, qm.EventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch event: %w", err)
+	}
+	evt.Type.Class = event.MessageEventType
+	err = evt.Content.ParseRaw(evt.Type)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse event content: %w", err)
+	}
+	if evt.Type == event.EventEncrypted {
+		if portal.bridge.Crypto == nil {
+			return nil, errors.New("event is encrypted, but encryption is not enabled")
+		}
+		evt, err = portal.bridge.Crypto.Decrypt(ctx, evt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt event: %w", err)
+		}
+	}
+	return evt, nil
+}
+
+// sendQueuedMessages dispatches the user's queued Matrix messages to their portals. It should be called
+// whenever the WhatsApp connection is established, and keeps running until all messages have been
+// handled or the connection is lost again. Each room only has one queued message in flight at a time,
+// so that messages are sent in the order they were queued even if some of them fail again.
+func (user *User) sendQueuedMessages() {
+	cfg := &user.bridge.Config.Bridge.OutgoingQueue
+	if !cfg.Enabled || !user.outgoingQueueLock.TryLock() {
+		return
+	}
+	defer user.outgoingQueueLock.Unlock()
+	log := user.zlog.With().Str("action", "send queued messages").Logger()
+	ctx := log.WithContext(context.TODO())
+	dispatched := make(map[id.EventID]int)
+	// The connection was just restored, so the backoff of messages that failed while disconnected is skipped.
+	firstPass := true
+	for user.IsLoggedIn() {
+		queued, err := user.bridge.DB.OutgoingQueue.GetAllForUser(ctx, user.MXID)
+		if err != nil {
+			log.Err(err).Msg("Failed to get queued messages")
+			return
+		}
+		var nextAttempt time.Time
+		pending := false
+		busyRooms := make(map[id.RoomID]struct{})
+		for _, qm := range queued {
+			if _, busy := busyRooms[qm.RoomID]; busy {
+				continue
+			} else if attempts, ok := dispatched[qm.EventID]; ok && attempts == qm.Attempts {
+				// Still waiting in the portal's event channel
+				pending = true
+				busyRooms[qm.RoomID] = struct{}{}
+				continue
+			}
+			portal := user.bridge.GetPortalByMXID(qm.RoomID)
+			if portal == nil {
+				log.Debug().Stringer("event_id", qm.EventID).Msg("Dropping queued message in unknown room")
+				_ = qm.Delete(ctx)
+				continue
+			}
+			expired := cfg.MaxAge > 0 && time.Since(qm.QueuedAt) > cfg.MaxAge
+			if !expired && !firstPass && qm.NextAttempt.After(time.Now()) {
+				busyRooms[qm.RoomID] = struct{}{}
+				if nextAttempt.IsZero() || qm.NextAttempt.Before(nextAttempt) {
+					nextAttempt = qm.NextAttempt
+				}
+				continue
+			}
+			evt, err := portal.fetchQueuedEvent(ctx, qm)
+			if err != nil {
+				log.Err(err).Stringer("event_id", qm.EventID).Msg("Dropping queued message that couldn't be fetched")
+				_ = qm.Delete(ctx)
+				continue
+			} else if expired {
+				ms := &metricSender{portal: portal, previousNotice: qm.NoticeID, timings: &messageTimings{}}
+				ms.sendMessageMetrics(ctx, evt, errMessageQueueExpired, "Dropping", true)
+				_ = qm.Delete(ctx)
+				continue
+			}
+			busyRooms[qm.RoomID] = struct{}{}
+			dispatched[qm.EventID] = qm.Attempts
+			pending = true
+			portal.events <- &PortalEvent{
+				MatrixMessage: &PortalMatrixMessage{
+					user:       user,
+					evt:        evt,
+					receivedAt: time.Now(),
+					queued:     qm,
+				},
+			}
+		}
+		firstPass = false
+		if nextAttempt.IsZero() && !pending {
+			log.Debug().Msg("All queued messages handled")
+			return
+		} else if nextAttempt.IsZero() || time.Until(nextAttempt) > outgoingQueueMinBackoff {
+			nextAttempt = time.Now().Add(outgoingQueueMinBackoff)
+		}
+		time.Sleep(time.Until(nextAttempt))
+	}
+}
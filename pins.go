@@ -0,0 +1,326 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/element-hq/mautrix-go"
+	"github.com/element-hq/mautrix-go/appservice"
+	"github.com/element-hq/mautrix-go/event"
+	"github.com/element-hq/mautrix-go/id"
+
+	"github.com/element-hq/mautrix-whatsapp/database"
+)
+
+// HandleMessagePin bridges a WhatsApp pin or unpin to the Matrix room's pinned events. Timed pins are stored
+// in the database, so that the message can be unpinned on Matrix when WhatsApp's pin timer elapses.
+func (portal *Portal) HandleMessagePin(ctx context.Context, source *User, intent *appservice.IntentAPI, info *types.MessageInfo, msg *waProto.Message) {
+	pin := msg.GetPinInChatMessage()
+	log := zerolog.Ctx(ctx).With().
+		Str("pin_target_id", pin.GetKey().GetId()).
+		Stringer("pin_type", pin.GetType()).
+		Logger()
+	target, err := portal.bridge.DB.Message.GetByJID(ctx, portal.Key, pin.GetKey().GetId())
+	if err != nil {
+		log.Err(err).Msg("Failed to get pin target message from database")
+		return
+	} else if target == nil || target.IsFakeMXID() {
+		log.Debug().Msg("Ignoring pin of unknown message")
+		return
+	}
+	switch pin.GetType() {
+	case waProto.PinInChatMessage_PIN_FOR_ALL:
+		pinnedAt := info.Timestamp
+		if pin.GetSenderTimestampMs() > 0 {
+			pinnedAt = time.UnixMilli(pin.GetSenderTimestampMs())
+		}
+		duration := time.Duration(msg.GetMessageContextInfo().GetMessageAddOnDurationInSecs()) * time.Second
+		dbPin := portal.bridge.DB.PinnedMessage.New()
+		dbPin.Chat = portal.Key
+		dbPin.MessageID = target.JID
+		dbPin.MXID = target.MXID
+		if duration > 0 {
+			dbPin.ExpiresAt = pinnedAt.Add(duration)
+			if dbPin.ExpiresAt.Before(time.Now()) {
+				log.Debug().Msg("Ignoring pin that has already expired")
+				return
+			}
+		}
+		portal.setMatrixPinned(ctx, intent, target.MXID, true)
+		err = dbPin.Upsert(ctx)
+		if err != nil {
+			log.Err(err).Msg("Failed to save pinned message")
+		}
+		locale := portal.getLocale(source)
+		body := formatNotice(locale, NoticePinned)
+		if duration > 0 {
+			body = formatNotice(locale, NoticePinnedTimed, formatDuration(locale, duration))
+		}
+		content := &event.MessageEventContent{
+			Body:    body,
+			MsgType: event.MsgNotice,
+		}
+		content.RelatesTo = (&event.RelatesTo{}).SetReplyTo(target.MXID)
+		_, err = portal.sendMessage(ctx, intent, event.EventMessage, content, nil, info.Timestamp.UnixMilli())
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to send pin notice")
+		}
+		portal.scheduleUnpin(context.WithoutCancel(ctx), dbPin)
+	case waProto.PinInChatMessage_UNPIN_FOR_ALL:
+		portal.setMatrixPinned(ctx, intent, target.MXID, false)
+		portal.deletePin(ctx, target.JID)
+	default:
+		log.Debug().Msg("Ignoring pin message with unknown type")
+	}
+}
+
+func (portal *Portal) setMatrixPinned(ctx context.Context, intent *appservice.IntentAPI, eventID id.EventID, pinned bool) {
+	portal.pinnedEventsLock.Lock()
+	defer portal.pinnedEventsLock.Unlock()
+	var content event.PinnedEventsEventContent
+	err := portal.MainIntent().StateEvent(ctx, portal.MXID, event.StatePinnedEvents, "", &content)
+	if err != nil && !errors.Is(err, mautrix.MNotFound) {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to get pinned events")
+		return
+	}
+	isPinned := slices.Contains(content.Pinned, eventID)
+	if isPinned == pinned {
+		return
+	} else if pinned {
+		content.Pinned = append(content.Pinned, eventID)
+	} else {
+		content.Pinned = slices.DeleteFunc(content.Pinned, func(pinnedID id.EventID) bool {
+			return pinnedID == eventID
+		})
+	}
+	if intent == nil {
+		intent = portal.MainIntent()
+	}
+	_, err = intent.SendStateEvent(ctx, portal.MXID, event.StatePinnedEvents, "", &content)
+	if errors.Is(err, mautrix.MForbidden) && intent != portal.MainIntent() {
+		_, err = portal.MainIntent().SendStateEvent(ctx, portal.MXID, event.StatePinnedEvents, "", &content)
+	}
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Stringer("event_id", eventID).Bool("pinned", pinned).Msg("Failed to update pinned events")
+	}
+}
+
+func (br *WABridge) SleepAndUnpinUpcoming(ctx context.Context) {
+	pins, err := br.DB.PinnedMessage.GetUpcomingExpiring(ctx, 1*time.Hour)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to get upcoming expiring pins")
+		return
+	}
+	for _, pin := range pins {
+		portal := br.GetExistingPortalByJID(pin.Chat)
+		if portal == nil || len(portal.MXID) == 0 {
+			err = pin.Delete(ctx)
+			if err != nil {
+				zerolog.Ctx(ctx).Err(err).Str("message_id", pin.MessageID).Msg("Failed to delete pinned message row with no portal")
+			}
+		} else {
+			portal.scheduleUnpin(ctx, pin)
+		}
+	}
+}
+
+// scheduleUnpin starts a timer to unpin the message on Matrix when its pin expires. Any previous timer for the same
+// message is cancelled, so pinning a message again with a different duration replaces the old timer. Pins expiring
+// later than an hour from now are picked up by SleepAndUnpinUpcoming.
+func (portal *Portal) scheduleUnpin(ctx context.Context, pin *database.PinnedMessage) {
+	portal.unpinTimersLock.Lock()
+	defer portal.unpinTimersLock.Unlock()
+	if timer, ok := portal.unpinTimers[pin.MessageID]; ok {
+		timer.Stop()
+		delete(portal.unpinTimers, pin.MessageID)
+	}
+	if pin.ExpiresAt.IsZero() || pin.ExpiresAt.After(time.Now().Add(1*time.Hour)) {
+		return
+	}
+	if portal.unpinTimers == nil {
+		portal.unpinTimers = make(map[types.MessageID]*time.Timer)
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(time.Until(pin.ExpiresAt), func() {
+		portal.unpinTimersLock.Lock()
+		if portal.unpinTimers[pin.MessageID] != timer {
+			portal.unpinTimersLock.Unlock()
+			return
+		}
+		delete(portal.unpinTimers, pin.MessageID)
+		portal.unpinTimersLock.Unlock()
+		portal.unpinExpired(ctx, pin)
+	})
+	portal.unpinTimers[pin.MessageID] = timer
+}
+
+// deletePin cancels the expiry timer of a pinned message and removes it from the database.
+func (portal *Portal) deletePin(ctx context.Context, messageID types.MessageID) {
+	portal.unpinTimersLock.Lock()
+	if timer, ok := portal.unpinTimers[messageID]; ok {
+		timer.Stop()
+		delete(portal.unpinTimers, messageID)
+	}
+	portal.unpinTimersLock.Unlock()
+	dbPin := portal.bridge.DB.PinnedMessage.New()
+	dbPin.Chat = portal.Key
+	dbPin.MessageID = messageID
+	err := dbPin.Delete(ctx)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Str("message_id", messageID).Msg("Failed to delete pinned message")
+	}
+}
+
+func (portal *Portal) unpinExpired(ctx context.Context, pin *database.PinnedMessage) {
+	log := zerolog.Ctx(ctx).With().Str("message_id", pin.MessageID).Stringer("event_id", pin.MXID).Logger()
+	// Make sure the message wasn't unpinned or pinned again with a different timer in the meantime
+	current, err := portal.bridge.DB.PinnedMessage.Get(ctx, pin.Chat, pin.MessageID)
+	if err != nil {
+		log.Err(err).Msg("Failed to get pinned message before unpinning")
+		return
+	} else if current == nil || !current.ExpiresAt.Equal(pin.ExpiresAt) {
+		return
+	}
+	portal.setMatrixPinned(ctx, nil, pin.MXID, false)
+	err = pin.Delete(ctx)
+	if err != nil {
+		log.Err(err).Msg("Failed to delete expired pinned message")
+	}
+	intent := portal.MainIntent()
+	if portal.Encrypted {
+		intent = portal.bridge.Bot
+	}
+	content := &event.MessageEventContent{
+		Body:    formatNotice(portal.getLocale(nil), NoticePinExpired),
+		MsgType: event.MsgNotice,
+	}
+	content.RelatesTo = (&event.RelatesTo{}).SetReplyTo(pin.MXID)
+	_, err = portal.sendMessage(ctx, intent, event.EventMessage, content, nil, 0)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to send pin expiry notice")
+	}
+	log.Debug().Msg("Unpinned message after pin expired")
+}
+
+// defaultMatrixPinDuration is how long messages pinned on Matrix stay pinned on WhatsApp. Matrix pins don't
+// expire, but WhatsApp only allows pinning for up to 30 days, with 7 days being the default in the apps.
+const defaultMatrixPinDuration = 7 * 24 * time.Hour
+
+// HandleMatrixPinnedEvents bridges messages being pinned or unpinned on Matrix to WhatsApp.
+func (br *WABridge) HandleMatrixPinnedEvents(ctx context.Context, evt *event.Event) {
+	if evt.Sender == br.Bot.UserID || br.IsGhost(evt.Sender) {
+		return
+	} else if val, ok := evt.Content.Raw[appservice.DoublePuppetKey]; ok && val == br.Name {
+		return
+	}
+	user := br.GetUserByMXIDIfExists(evt.Sender)
+	portal := br.GetPortalByMXID(evt.RoomID)
+	content, ok := evt.Content.Parsed.(*event.PinnedEventsEventContent)
+	if user == nil || !user.Whitelisted || !user.IsLoggedIn() || portal == nil || !ok {
+		return
+	}
+	var prevPinned []id.EventID
+	if evt.Unsigned.PrevContent != nil {
+		_ = evt.Unsigned.PrevContent.ParseRaw(evt.Type)
+		if prevContent, ok := evt.Unsigned.PrevContent.Parsed.(*event.PinnedEventsEventContent); ok {
+			prevPinned = prevContent.Pinned
+		}
+	}
+	log := portal.zlog.With().
+		Str("action", "handle matrix pins").
+		Stringer("event_id", evt.ID).
+		Stringer("sender", user.MXID).
+		Logger()
+	ctx = log.WithContext(ctx)
+	for _, eventID := range content.Pinned {
+		if !slices.Contains(prevPinned, eventID) {
+			portal.sendPinToWhatsApp(ctx, user, eventID, true)
+		}
+	}
+	for _, eventID := range prevPinned {
+		if !slices.Contains(content.Pinned, eventID) {
+			portal.sendPinToWhatsApp(ctx, user, eventID, false)
+		}
+	}
+}
+
+func (portal *Portal) sendPinToWhatsApp(ctx context.Context, sender *User, eventID id.EventID, pinned bool) {
+	log := zerolog.Ctx(ctx).With().Stringer("pin_target_mxid", eventID).Bool("pinned", pinned).Logger()
+	target, err := portal.bridge.DB.Message.GetByMXID(ctx, eventID)
+	if err != nil {
+		log.Err(err).Msg("Failed to get pin target message from database")
+		return
+	} else if target == nil || target.Chat != portal.Key {
+		log.Debug().Msg("Ignoring pin of unknown message")
+		return
+	}
+	key := &waProto.MessageKey{
+		RemoteJid: proto.String(portal.Key.JID.String()),
+		FromMe:    proto.Bool(target.Sender.User == sender.JID.User),
+		Id:        proto.String(target.JID),
+	}
+	if !portal.IsPrivateChat() {
+		key.Participant = proto.String(target.Sender.ToNonAD().String())
+	}
+	pinType := waProto.PinInChatMessage_UNPIN_FOR_ALL
+	var contextInfo *waProto.MessageContextInfo
+	if pinned {
+		pinType = waProto.PinInChatMessage_PIN_FOR_ALL
+		contextInfo = &waProto.MessageContextInfo{
+			MessageAddOnDurationInSecs: proto.Uint32(uint32(defaultMatrixPinDuration.Seconds())),
+		}
+	}
+	now := time.Now()
+	timedCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	_, err = sender.Client.SendMessage(timedCtx, portal.Key.JID, &waProto.Message{
+		PinInChatMessage: &waProto.PinInChatMessage{
+			Key:               key,
+			Type:              pinType.Enum(),
+			SenderTimestampMs: proto.Int64(now.UnixMilli()),
+		},
+		MessageContextInfo: contextInfo,
+	})
+	if err != nil {
+		log.Err(err).Msg("Failed to send pin to WhatsApp")
+		return
+	}
+	if !pinned {
+		portal.deletePin(ctx, target.JID)
+		return
+	}
+	dbPin := portal.bridge.DB.PinnedMessage.New()
+	dbPin.Chat = portal.Key
+	dbPin.MessageID = target.JID
+	dbPin.MXID = target.MXID
+	dbPin.ExpiresAt = now.Add(defaultMatrixPinDuration)
+	err = dbPin.Upsert(ctx)
+	if err != nil {
+		log.Err(err).Msg("Failed to save pinned message")
+	}
+	portal.scheduleUnpin(context.WithoutCancel(ctx), dbPin)
+	log.Debug().Msg("Sent pin to WhatsApp")
+}
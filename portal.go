@@ -25,6 +25,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
 	"image"
 	"image/color"
 	_ "image/gif"
@@ -32,15 +33,17 @@ import (
 	"image/png"
 	"io"
 	"maps"
-	"math"
 	"mime"
 	"net/http"
 	"reflect"
+	"regexp"
 	"runtime/debug"
 	"strconv"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
+	"unicode"
 
 	"github.com/rs/zerolog"
 	"github.com/tidwall/gjson"
@@ -53,6 +56,8 @@ import (
 	"golang.org/x/exp/slices"
 	"golang.org/x/image/draw"
 	"golang.org/x/image/webp"
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 	"google.golang.org/protobuf/proto"
 
 	"go.mau.fi/util/exerrors"
@@ -72,6 +77,7 @@ import (
 	"github.com/element-hq/mautrix-go/format"
 	"github.com/element-hq/mautrix-go/id"
 
+	"github.com/element-hq/mautrix-whatsapp/config"
 	"github.com/element-hq/mautrix-whatsapp/database"
 )
 
@@ -124,13 +130,23 @@ func (portal *Portal) MarkEncrypted() {
 }
 
 func (portal *Portal) ReceiveMatrixEvent(user bridge.User, evt *event.Event) {
-	if user.GetPermissionLevel() >= bridgeconfig.PermissionLevelUser || portal.HasRelaybot() {
+	if user.GetPermissionLevel() >= bridgeconfig.PermissionLevelUser || portal.HasRelaybot() || portal.getSharedAccessOwner(context.TODO(), user.GetMXID()) != nil {
+		msg := &PortalMatrixMessage{
+			user:       user.(*User),
+			evt:        evt,
+			receivedAt: time.Now(),
+		}
+		if evt.Type == event.EventReaction {
+			if !portal.limitReaction(msg) {
+				return
+			} else if !msg.notBefore.IsZero() {
+				portal.queueDelayedReaction(msg)
+				return
+			}
+		}
+		portal.startOutgoingTranslation(evt)
 		portal.events <- &PortalEvent{
-			MatrixMessage: &PortalMatrixMessage{
-				user:       user.(*User),
-				evt:        evt,
-				receivedAt: time.Now(),
-			},
+			MatrixMessage: msg,
 		}
 	}
 }
@@ -247,6 +263,8 @@ func (br *WABridge) NewPortal(dbPortal *database.Portal) *Portal {
 		bridge:          br,
 		events:          make(chan *PortalEvent, br.Config.Bridge.PortalMessageBuffer),
 		mediaErrorCache: make(map[types.MessageID]*FailedMediaMeta),
+		ongoingCalls:    make(map[string]*ongoingCall),
+		newsletterRoles: make(map[id.UserID]newsletterRoleCacheEntry),
 	}
 	portal.updateLogger()
 	go portal.handleMessageLoop()
@@ -266,14 +284,16 @@ const recentlyHandledLength = 100
 type fakeMessage struct {
 	Sender    types.JID
 	Text      string
+	HTML      string
 	ID        string
 	Time      time.Time
 	Important bool
 }
 
 type PortalEvent struct {
-	Message       *PortalMessage
-	MatrixMessage *PortalMatrixMessage
+	Message         *PortalMessage
+	MatrixMessage   *PortalMatrixMessage
+	CloudAPIMessage *cloudAPIPortalMessage
 }
 
 type PortalMessage struct {
@@ -288,6 +308,12 @@ type PortalMatrixMessage struct {
 	evt        *event.Event
 	user       *User
 	receivedAt time.Time
+	// queued is set when the event is being retried from the outgoing queue
+	queued *database.QueuedMessage
+	// isRetry is set when the user asked to retry a failed event
+	isRetry bool
+	// notBefore is set when a reaction was delayed by the reaction rate limit
+	notBefore time.Time
 }
 
 type recentlyHandledWrapper struct {
@@ -313,12 +339,31 @@ type Portal struct {
 	recentlyHandledLock  sync.Mutex
 	recentlyHandledIndex uint8
 
+	// deliveredTo contains the ghosts whose phones have received recently sent messages.
+	// It's only accessed from the portal's event loop.
+	deliveredTo      map[types.MessageID][]id.UserID
+	deliveredToOrder []types.MessageID
+
 	currentlyTyping     []id.UserID
 	currentlyTypingLock sync.Mutex
 
+	lastSeenTopicUpdate time.Time
+	lastSeenTopicLock   sync.Mutex
+
+	reactionLimiter     reactionRateLimiter
+	reactionQueue       chan *PortalMatrixMessage
+	reactionQueueLoader sync.Once
+
 	events chan *PortalEvent
 
-	mediaErrorCache map[types.MessageID]*FailedMediaMeta
+	mediaErrorCache     map[types.MessageID]*FailedMediaMeta
+	mediaErrorCacheLock sync.Mutex
+
+	sharedAccessCache     map[id.UserID][]*database.SharedAccess
+	sharedAccessCacheLock sync.Mutex
+
+	outgoingTranslations     map[id.EventID]*outgoingTranslation
+	outgoingTranslationsLock sync.Mutex
 
 	galleryCache          []*event.MessageEventContent
 	galleryCacheRootEvent id.EventID
@@ -326,10 +371,25 @@ type Portal struct {
 	galleryCacheReplyTo   *ReplyInfo
 	galleryCacheSender    types.JID
 
-	currentlySleepingToDelete sync.Map
+	unpinTimers      map[types.MessageID]*time.Timer
+	unpinTimersLock  sync.Mutex
+	pinnedEventsLock sync.Mutex
+
+	ongoingCalls     map[string]*ongoingCall
+	ongoingCallsLock sync.Mutex
 
-	relayUser    *User
-	parentPortal *Portal
+	newsletterRoles     map[id.UserID]newsletterRoleCacheEntry
+	newsletterRolesLock sync.Mutex
+
+	stickerPackLock sync.Mutex
+
+	liveLocations         map[types.JID]*liveLocationShare
+	outgoingLiveLocations map[id.EventID]*outgoingLiveLocation
+	liveLocationLock      sync.Mutex
+
+	relayUser      *User
+	relayTemplates *template.Template
+	parentPortal   *Portal
 }
 
 const GalleryMaxTime = 10 * time.Minute
@@ -372,13 +432,31 @@ var (
 	_ bridge.TypingPortal              = (*Portal)(nil)
 )
 
+// withWhatsAppDeadline applies the configured deadline for handling a single WhatsApp event to the context.
+// The returned function must be called once handling is done. It releases the context and tracks timeouts.
+func (br *WABridge) withWhatsAppDeadline(ctx context.Context) (context.Context, func()) {
+	deadline := br.Config.Bridge.MessageHandlingTimeout.WhatsAppDeadline
+	if deadline <= 0 {
+		return ctx, func() {}
+	}
+	ctx, cancel := context.WithTimeout(ctx, deadline)
+	return ctx, func() {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			zerolog.Ctx(ctx).Warn().Dur("deadline", deadline).Msg("Handling WhatsApp event took too long and was cancelled")
+			br.Metrics.TrackHandlerTimeout(MetricsDirectionToMatrix)
+		}
+		cancel()
+	}
+}
+
 func (portal *Portal) handleWhatsAppMessageLoopItem(msg *PortalMessage) {
 	log := portal.zlog.With().
 		Str("action", "handle whatsapp event").
 		Stringer("source_user_jid", msg.source.JID).
 		Stringer("source_user_mxid", msg.source.MXID).
 		Logger()
-	ctx := log.WithContext(context.TODO())
+	ctx, done := portal.bridge.withWhatsAppDeadline(log.WithContext(context.TODO()))
+	defer done()
 	if len(portal.MXID) == 0 {
 		if msg.fake == nil && msg.undecryptable == nil && (msg.evt == nil || !containsSupportedMessage(msg.evt.Message)) {
 			log.Debug().Msg("Not creating portal room for incoming message: message is not a chat message")
@@ -446,12 +524,16 @@ func (portal *Portal) handleMatrixMessageLoopItem(msg *PortalMatrixMessage) {
 		portalQueue:  time.Since(msg.receivedAt),
 		totalReceive: time.Since(evtTS),
 	}
+	if msg.queued != nil || msg.isRetry {
+		// Queued and retried messages are expected to be old, so only count the time since they were taken from the queue
+		timings.totalReceive = time.Since(msg.receivedAt)
+	}
 	implicitRRStart := time.Now()
 	portal.handleMatrixReadReceipt(ctx, msg.user, "", evtTS, false)
 	timings.implicitRR = time.Since(implicitRRStart)
 	switch msg.evt.Type {
-	case event.EventMessage, event.EventSticker, TypeMSC3381V2PollResponse, TypeMSC3381PollResponse, TypeMSC3381PollStart:
-		portal.HandleMatrixMessage(ctx, msg.user, msg.evt, timings)
+	case event.EventMessage, event.EventSticker, TypeMSC3381V2PollResponse, TypeMSC3381PollResponse, TypeMSC3381PollStart, TypeMSC3672Beacon:
+		portal.HandleMatrixMessage(ctx, msg.user, msg.evt, timings, msg.queued)
 	case event.EventRedaction:
 		log.UpdateContext(func(c zerolog.Context) zerolog.Context {
 			return c.Stringer("redaction_target_mxid", msg.evt.Redacts)
@@ -464,29 +546,80 @@ func (portal *Portal) handleMatrixMessageLoopItem(msg *PortalMatrixMessage) {
 	}
 }
 
+// maxTrackedDeliveries is the number of sent messages for which delivery receipts are accumulated.
+const maxTrackedDeliveries = 100
+
+// trackDelivery remembers that the given ghost's phone received the message and returns everyone
+// who has received it so far.
+func (portal *Portal) trackDelivery(msgID types.MessageID, userID id.UserID) []id.UserID {
+	if portal.deliveredTo == nil {
+		portal.deliveredTo = make(map[types.MessageID][]id.UserID)
+	}
+	users, ok := portal.deliveredTo[msgID]
+	if !ok {
+		portal.deliveredToOrder = append(portal.deliveredToOrder, msgID)
+		if len(portal.deliveredToOrder) > maxTrackedDeliveries {
+			delete(portal.deliveredTo, portal.deliveredToOrder[0])
+			portal.deliveredToOrder = portal.deliveredToOrder[1:]
+		}
+	}
+	if !slices.Contains(users, userID) {
+		users = append(users, userID)
+	}
+	portal.deliveredTo[msgID] = users
+	return slices.Clone(users)
+}
+
+// handleDeliveryReceipt updates the status of messages sent from Matrix once they reach the recipients' phones.
+// The status sent after the server acknowledged the message has an empty delivered list, so clients can tell
+// the two states apart.
 func (portal *Portal) handleDeliveryReceipt(ctx context.Context, receipt *events.Receipt, source *User) {
-	if !portal.IsPrivateChat() {
+	log := zerolog.Ctx(ctx)
+	recipient := portal.bridge.GetPuppetByJID(receipt.Sender)
+	if recipient == nil || receipt.Sender.User == source.JID.User {
 		return
 	}
-	log := zerolog.Ctx(ctx)
 	for _, msgID := range receipt.MessageIDs {
 		msg, err := portal.bridge.DB.Message.GetByJID(ctx, portal.Key, msgID)
 		if err != nil {
 			log.Err(err).Str("message_id", msgID).Msg("Failed to get receipt target message")
 			continue
-		} else if msg == nil || msg.IsFakeMXID() {
+		} else if msg == nil || msg.IsFakeMXID() || msg.Sender.User != source.JID.User {
 			continue
 		}
-		if msg.Sender == source.JID {
-			portal.bridge.SendRawMessageCheckpoint(&status.MessageCheckpoint{
-				EventID:    msg.MXID,
-				RoomID:     portal.MXID,
-				Step:       status.MsgStepRemote,
-				Timestamp:  jsontime.UM(receipt.Timestamp),
-				Status:     status.MsgStatusDelivered,
-				ReportedBy: status.MsgReportedByBridge,
-			})
-			portal.sendStatusEvent(ctx, msg.MXID, "", nil, &[]id.UserID{portal.MainIntent().UserID})
+		portal.bridge.SendRawMessageCheckpoint(&status.MessageCheckpoint{
+			EventID:    msg.MXID,
+			RoomID:     portal.MXID,
+			Step:       status.MsgStepRemote,
+			Timestamp:  jsontime.UM(receipt.Timestamp),
+			Status:     status.MsgStatusDelivered,
+			ReportedBy: status.MsgReportedByBridge,
+		})
+		deliveredTo := portal.trackDelivery(msg.JID, recipient.MXID)
+		portal.sendStatusEvent(ctx, msg.MXID, "", nil, &deliveredTo)
+	}
+}
+
+// PlayedReceiptReaction is the reaction used to mark voice messages that have been listened to on WhatsApp.
+const PlayedReceiptReaction = "🎧"
+
+func (portal *Portal) handlePlayedReceipt(ctx context.Context, receipt *events.Receipt, source *User) {
+	log := zerolog.Ctx(ctx)
+	intent := portal.bridge.GetPuppetByJID(receipt.Sender).IntentFor(portal)
+	for _, msgID := range receipt.MessageIDs {
+		msg, err := portal.bridge.DB.Message.GetByJID(ctx, portal.Key, msgID)
+		if err != nil {
+			log.Err(err).Str("message_id", msgID).Msg("Failed to get played receipt target message")
+			continue
+		} else if msg == nil || msg.IsFakeMXID() || msg.Sender.User != source.JID.User {
+			continue
+		}
+		_, err = intent.SendReaction(ctx, portal.MXID, msg.MXID, PlayedReceiptReaction)
+		if err != nil {
+			log.Err(err).
+				Stringer("message_mxid", msg.MXID).
+				Stringer("played_by_user_mxid", intent.UserID).
+				Msg("Failed to mark message as played")
 		}
 	}
 }
@@ -496,9 +629,18 @@ func (portal *Portal) handleReceipt(ctx context.Context, receipt *events.Receipt
 		// TODO handle lids
 		return
 	}
+	ctx = WithRequestPriority(ctx, PriorityReceipt)
 	if receipt.Type == types.ReceiptTypeDelivered {
 		portal.handleDeliveryReceipt(ctx, receipt, source)
 		return
+	} else if receipt.Type == types.ReceiptTypePlayed {
+		if source.IsDeliveryEnabled(database.DeliveryReceivePlayedReceipts) {
+			portal.handlePlayedReceipt(ctx, receipt, source)
+		}
+		// Played receipts also imply that the message was read
+		if !source.IsDeliveryEnabled(database.DeliveryReceiveReadReceipts) {
+			return
+		}
 	}
 	// The order of the message ID array depends on the sender's platform, so we just have to find
 	// the last message based on timestamp. Also, timestamps only have second precision, so if
@@ -528,7 +670,7 @@ func (portal *Portal) handleReceipt(ctx context.Context, receipt *events.Receipt
 			source.SetLastReadTS(ctx, portal.Key, receipt.Timestamp)
 		}
 	}
-	intent := portal.bridge.GetPuppetByJID(receipt.Sender).IntentFor(portal)
+	intent := portal.getOwnMessageIntent(portal.bridge.GetPuppetByJID(receipt.Sender), receipt.IsFromMe)
 	for _, msg := range markAsRead {
 		err := intent.SetReadMarkers(ctx, portal.MXID, source.makeReadMarkerContent(msg.MXID, intent.IsCustomPuppet))
 		if err != nil {
@@ -571,6 +713,8 @@ func (portal *Portal) handleOneMessageLoopItem() {
 			portal.handleWhatsAppMessageLoopItem(msg.Message)
 		} else if msg.MatrixMessage != nil {
 			portal.handleMatrixMessageLoopItem(msg.MatrixMessage)
+		} else if msg.CloudAPIMessage != nil {
+			portal.handleCloudAPIMessageLoopItem(msg.CloudAPIMessage)
 		} else {
 			portal.zlog.Warn().Msg("Unexpected PortalEvent with no data")
 		}
@@ -614,7 +758,7 @@ func getMessageType(waMsg *waProto.Message) string {
 	case waMsg.LocationMessage != nil:
 		return "location"
 	case waMsg.LiveLocationMessage != nil:
-		return "live location start"
+		return "live location"
 	case waMsg.GroupInviteMessage != nil:
 		return "group invite"
 	case waMsg.ReactionMessage != nil:
@@ -625,6 +769,8 @@ func getMessageType(waMsg *waProto.Message) string {
 		return "poll create"
 	case waMsg.PollUpdateMessage != nil:
 		return "poll update"
+	case waMsg.PinInChatMessage != nil:
+		return "pin"
 	case waMsg.ProtocolMessage != nil:
 		switch waMsg.GetProtocolMessage().GetType() {
 		case waProto.ProtocolMessage_REVOKE:
@@ -678,28 +824,20 @@ func getMessageType(waMsg *waProto.Message) string {
 	}
 }
 
-func pluralUnit(val int, name string) string {
-	if val == 1 {
-		return fmt.Sprintf("%d %s", val, name)
-	} else if val == 0 {
-		return ""
-	}
-	return fmt.Sprintf("%d %ss", val, name)
-}
-
-func naturalJoin(parts []string) string {
+func naturalJoin(locale string, parts []string) string {
+	and, _ := getNoticeString(locale, NoticeAnd)
 	if len(parts) == 0 {
 		return ""
 	} else if len(parts) == 1 {
 		return parts[0]
 	} else if len(parts) == 2 {
-		return fmt.Sprintf("%s and %s", parts[0], parts[1])
+		return fmt.Sprintf("%s %s %s", parts[0], and, parts[1])
 	} else {
-		return fmt.Sprintf("%s and %s", strings.Join(parts[:len(parts)-1], ", "), parts[len(parts)-1])
+		return fmt.Sprintf("%s %s %s", strings.Join(parts[:len(parts)-1], ", "), and, parts[len(parts)-1])
 	}
 }
 
-func formatDuration(d time.Duration) string {
+func formatDuration(locale string, d time.Duration) string {
 	const Day = time.Hour * 24
 
 	var days, hours, minutes, seconds int
@@ -710,18 +848,18 @@ func formatDuration(d time.Duration) string {
 
 	parts := make([]string, 0, 4)
 	if days > 0 {
-		parts = append(parts, pluralUnit(days, "day"))
+		parts = append(parts, localizedUnit(locale, days, "day"))
 	}
 	if hours > 0 {
-		parts = append(parts, pluralUnit(hours, "hour"))
+		parts = append(parts, localizedUnit(locale, hours, "hour"))
 	}
 	if minutes > 0 {
-		parts = append(parts, pluralUnit(seconds, "minute"))
+		parts = append(parts, localizedUnit(locale, minutes, "minute"))
 	}
 	if seconds > 0 {
-		parts = append(parts, pluralUnit(seconds, "second"))
+		parts = append(parts, localizedUnit(locale, seconds, "second"))
 	}
-	return naturalJoin(parts)
+	return naturalJoin(locale, parts)
 }
 
 func (portal *Portal) convertMessage(ctx context.Context, intent *appservice.IntentAPI, source *User, info *types.MessageInfo, waMsg *waProto.Message, isBackfill bool) *ConvertedMessage {
@@ -769,7 +907,7 @@ func (portal *Portal) convertMessage(ctx context.Context, intent *appservice.Int
 	case waMsg.LocationMessage != nil:
 		return portal.convertLocationMessage(ctx, intent, waMsg.GetLocationMessage())
 	case waMsg.LiveLocationMessage != nil:
-		return portal.convertLiveLocationMessage(ctx, intent, waMsg.GetLiveLocationMessage())
+		return portal.convertLiveLocationMessage(ctx, intent, info, waMsg.GetLiveLocationMessage(), isBackfill)
 	case waMsg.GroupInviteMessage != nil:
 		return portal.convertGroupInviteMessage(ctx, intent, info, waMsg.GetGroupInviteMessage())
 	case waMsg.ProtocolMessage != nil && waMsg.ProtocolMessage.GetType() == waProto.ProtocolMessage_EPHEMERAL_SETTING:
@@ -782,7 +920,7 @@ func (portal *Portal) convertMessage(ctx context.Context, intent *appservice.Int
 			Intent: intent,
 			Type:   event.EventMessage,
 			Content: &event.MessageEventContent{
-				Body:    portal.formatDisappearingMessageNotice(),
+				Body:    portal.formatDisappearingMessageNotice(source),
 				MsgType: event.MsgNotice,
 			},
 		}
@@ -791,7 +929,7 @@ func (portal *Portal) convertMessage(ctx context.Context, intent *appservice.Int
 	}
 }
 
-func (portal *Portal) implicitlyEnableDisappearingMessages(ctx context.Context, timer time.Duration) {
+func (portal *Portal) implicitlyEnableDisappearingMessages(ctx context.Context, source *User, timer time.Duration) {
 	portal.ExpirationTime = uint32(timer.Seconds())
 	err := portal.Update(ctx)
 	if err != nil {
@@ -801,17 +939,18 @@ func (portal *Portal) implicitlyEnableDisappearingMessages(ctx context.Context,
 	if portal.Encrypted {
 		intent = portal.bridge.Bot
 	}
-	duration := formatDuration(time.Duration(portal.ExpirationTime) * time.Second)
+	locale := portal.getLocale(source)
+	duration := formatDuration(locale, time.Duration(portal.ExpirationTime)*time.Second)
 	_, err = portal.sendMessage(ctx, intent, event.EventMessage, &event.MessageEventContent{
 		MsgType: event.MsgNotice,
-		Body:    fmt.Sprintf("Automatically enabled disappearing message timer (%s) because incoming message is disappearing", duration),
+		Body:    formatNotice(locale, NoticeDisappearingImplicit, duration),
 	}, nil, 0)
 	if err != nil {
 		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to send notice about implicit disappearing timer")
 	}
 }
 
-func (portal *Portal) UpdateGroupDisappearingMessages(ctx context.Context, sender *types.JID, timestamp time.Time, timer uint32) {
+func (portal *Portal) UpdateGroupDisappearingMessages(ctx context.Context, source *User, sender *types.JID, timestamp time.Time, timer uint32) {
 	if portal.ExpirationTime == timer {
 		return
 	}
@@ -827,7 +966,7 @@ func (portal *Portal) UpdateGroupDisappearingMessages(ctx context.Context, sende
 		sender = &types.EmptyJID
 	}
 	_, err = portal.sendMessage(ctx, intent, event.EventMessage, &event.MessageEventContent{
-		Body:    portal.formatDisappearingMessageNotice(),
+		Body:    portal.formatDisappearingMessageNotice(source),
 		MsgType: event.MsgNotice,
 	}, nil, timestamp.UnixMilli())
 	if err != nil {
@@ -838,11 +977,12 @@ func (portal *Portal) UpdateGroupDisappearingMessages(ctx context.Context, sende
 	}
 }
 
-func (portal *Portal) formatDisappearingMessageNotice() string {
+func (portal *Portal) formatDisappearingMessageNotice(user *User) string {
+	locale := portal.getLocale(user)
 	if portal.ExpirationTime == 0 {
-		return "Turned off disappearing messages"
+		return formatNotice(locale, NoticeDisappearingOff)
 	}
-	return fmt.Sprintf("Set the disappearing message timer to %s", formatDuration(time.Duration(portal.ExpirationTime)*time.Second))
+	return formatNotice(locale, NoticeDisappearingSet, formatDuration(locale, time.Duration(portal.ExpirationTime)*time.Second))
 }
 
 const UndecryptableMessageNotice = "Decrypting message from WhatsApp failed, waiting for sender to re-send... " +
@@ -889,6 +1029,19 @@ func (portal *Portal) handleUndecryptableMessage(ctx context.Context, source *Us
 		return
 	}
 	portal.finishHandling(ctx, nil, &evt.Info, resp.EventID, intent.UserID, database.MsgUnknown, 0, database.MsgErrDecryptionFailed)
+	portal.sendBridgeErrorEvent(ctx, &BridgeErrorEventContent{
+		Code:      BridgeErrorCodeDecryptionFailed,
+		Direction: BridgeErrorToMatrix,
+		Retryable: !evt.IsUnavailable,
+		Certain:   true,
+		Message:   UndecryptableMessageNotice,
+		Sender:    intent.UserID,
+		MessageID: evt.Info.ID,
+		RelatesTo: &event.RelatesTo{
+			Type:    event.RelReference,
+			EventID: resp.EventID,
+		},
+	})
 }
 
 func (portal *Portal) handleFakeMessage(ctx context.Context, msg fakeMessage) {
@@ -917,10 +1070,15 @@ func (portal *Portal) handleFakeMessage(ctx context.Context, msg fakeMessage) {
 	if msg.Important {
 		msgType = event.MsgText
 	}
-	resp, err := portal.sendMessage(ctx, intent, event.EventMessage, &event.MessageEventContent{
+	content := &event.MessageEventContent{
 		MsgType: msgType,
 		Body:    msg.Text,
-	}, nil, msg.Time.UnixMilli())
+	}
+	if msg.HTML != "" {
+		content.Format = event.FormatHTML
+		content.FormattedBody = msg.HTML
+	}
+	resp, err := portal.sendMessage(ctx, intent, event.EventMessage, content, nil, msg.Time.UnixMilli())
 	if err != nil {
 		log.Err(err).Msg("Failed to send fake message to Matrix")
 	} else {
@@ -1022,7 +1180,8 @@ func (portal *Portal) handleMessage(ctx context.Context, source *User, evt *even
 			log.Info().
 				Str("timer", converted.ExpiresIn.String()).
 				Msg("Implicitly enabling disappearing messages as incoming message is disappearing")
-			portal.implicitlyEnableDisappearingMessages(ctx, converted.ExpiresIn)
+			portal.implicitlyEnableDisappearingMessages(ctx, source, converted.ExpiresIn)
+			portal.promptKeepDisappearing(ctx, source)
 		}
 		if evt.Info.IsIncomingBroadcast() {
 			if converted.Extra == nil {
@@ -1030,6 +1189,9 @@ func (portal *Portal) handleMessage(ctx context.Context, source *User, evt *even
 			}
 			converted.Extra["fi.mau.whatsapp.source_broadcast_list"] = evt.Info.Chat.String()
 		}
+		if !historical && !evt.Info.IsFromMe && len(portal.TranslateIncoming) > 0 {
+			portal.addIncomingTranslation(ctx, converted)
+		}
 		if portal.bridge.Config.Bridge.CaptionInMessage {
 			converted.MergeCaption()
 		}
@@ -1109,6 +1271,29 @@ func (portal *Portal) handleMessage(ctx context.Context, source *User, evt *even
 		}
 		if len(eventID) != 0 {
 			portal.finishHandling(ctx, existingMsg, &evt.Info, eventID, intent.UserID, dbMsgType, galleryPart, converted.Error)
+			source.trackIncomingStats(ctx, portal, converted)
+			if !historical {
+				source.trackFirstMessageBridged(portal, "to_matrix")
+			}
+			if !historical && evt.Info.IsFromMe {
+				// Sending a message from another device means the user has read the chat up to this point.
+				source.SetLastReadTS(ctx, portal.Key, evt.Info.Timestamp)
+			}
+			if !historical && source.IsTrackingAllowed() {
+				portal.bridge.Metrics.TrackDeliveryLatency(source.MXID, MetricsDirectionToMatrix, evt.Info.Timestamp)
+			}
+			if converted.Error == database.MsgErrMediaNotFound && portal.shouldAutoRetryMedia(historical) {
+				portal.enqueueMediaRetry(ctx, source, evt.Info.ID, eventID)
+			}
+			if converted.MediaError != nil && existingMsg == nil && editTargetMsg == nil {
+				portal.sendMediaBridgeError(ctx, converted, intent.UserID, evt.Info.ID, eventID)
+			}
+			if !historical && evt.Message.GetProtocolMessage().GetType() == waProto.ProtocolMessage_EPHEMERAL_SETTING {
+				portal.promptKeepDisappearing(ctx, source)
+			}
+			if converted.Voice != nil && existingMsg == nil && editTargetMsg == nil {
+				portal.queueTranscription(context.WithoutCancel(ctx), source, eventID, converted.Voice)
+			}
 		}
 	} else if msgType == "reaction" || msgType == "encrypted reaction" {
 		if evt.Message.GetEncReactionMessage() != nil {
@@ -1124,6 +1309,8 @@ func (portal *Portal) handleMessage(ctx context.Context, source *User, evt *even
 		} else {
 			portal.HandleMessageReaction(ctx, intent, source, &evt.Info, evt.Message.GetReactionMessage(), existingMsg)
 		}
+	} else if msgType == "pin" {
+		portal.HandleMessagePin(ctx, source, intent, &evt.Info, evt.Message)
 	} else if msgType == "revoke" {
 		portal.HandleMessageRevoke(ctx, source, &evt.Info, evt.Message.GetProtocolMessage().GetKey())
 		if existingMsg != nil {
@@ -1155,6 +1342,8 @@ func (portal *Portal) handleMessage(ctx context.Context, source *User, evt *even
 	if evt.Info.IsFromMe {
 		// Ignore tracking activity for our own users
 		sender = nil
+	} else if !source.IsTrackingAllowed() || portal.bridge.isActivityTrackingDisabled(evt.Info.Sender) {
+		sender = nil
 	} else if !evt.Info.Sender.IsEmpty() {
 		sender = portal.bridge.GetPuppetByJID(evt.Info.Sender)
 	}
@@ -1182,22 +1371,27 @@ func (portal *Portal) isRecentlyHandled(id types.MessageID, error database.Messa
 	return false
 }
 
+func (portal *Portal) newDBMessage(info *types.MessageInfo, mxid id.EventID, senderMXID id.UserID, isSent bool, msgType database.MessageType, galleryPart int, errType database.MessageErrorType) *database.Message {
+	msg := portal.bridge.DB.Message.New()
+	msg.Chat = portal.Key
+	msg.JID = info.ID
+	msg.MXID = mxid
+	msg.GalleryPart = galleryPart
+	msg.Timestamp = info.Timestamp
+	msg.Sender = info.Sender
+	msg.SenderMXID = senderMXID
+	msg.Sent = isSent
+	msg.Type = msgType
+	msg.Error = errType
+	if info.IsIncomingBroadcast() {
+		msg.BroadcastListJID = info.Chat
+	}
+	return msg
+}
+
 func (portal *Portal) markHandled(ctx context.Context, msg *database.Message, info *types.MessageInfo, mxid id.EventID, senderMXID id.UserID, isSent, recent bool, msgType database.MessageType, galleryPart int, errType database.MessageErrorType) *database.Message {
 	if msg == nil {
-		msg = portal.bridge.DB.Message.New()
-		msg.Chat = portal.Key
-		msg.JID = info.ID
-		msg.MXID = mxid
-		msg.GalleryPart = galleryPart
-		msg.Timestamp = info.Timestamp
-		msg.Sender = info.Sender
-		msg.SenderMXID = senderMXID
-		msg.Sent = isSent
-		msg.Type = msgType
-		msg.Error = errType
-		if info.IsIncomingBroadcast() {
-			msg.BroadcastListJID = info.Chat
-		}
+		msg = portal.newDBMessage(info, mxid, senderMXID, isSent, msgType, galleryPart, errType)
 		err := msg.Insert(ctx)
 		if err != nil {
 			zerolog.Ctx(ctx).Err(err).Msg("Failed to insert message to database")
@@ -1244,14 +1438,29 @@ func (portal *Portal) getMessageIntent(ctx context.Context, user *User, info *ty
 	if puppet == nil {
 		return nil
 	}
-	intent := puppet.IntentFor(portal)
-	if !intent.IsCustomPuppet && portal.IsPrivateChat() && info.Sender.User == portal.Key.Receiver.User && portal.Key.Receiver != portal.Key.JID {
+	intent := portal.getOwnMessageIntent(puppet, info.IsFromMe)
+	if !intent.IsCustomPuppet && portal.IsPrivateChat() && info.Sender.User == portal.Key.Receiver.User && !portal.IsSelfChat() {
 		zerolog.Ctx(ctx).Debug().Msg("Not handling message: user doesn't have double puppeting enabled")
 		return nil
 	}
+	if !intent.IsCustomPuppet && len(portal.MXID) > 0 {
+		err := portal.bridge.Memberships.EnsureJoined(ctx, intent, portal.MXID)
+		if err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to ensure message sender is joined to portal")
+		}
+	}
 	return intent
 }
 
+// getOwnMessageIntent returns the intent for the given puppet, but uses the double puppet for the user's own
+// messages in the self chat, where IntentFor returns the ghost so that it can stay as the other side of the chat.
+func (portal *Portal) getOwnMessageIntent(puppet *Puppet, isFromMe bool) *appservice.IntentAPI {
+	if isFromMe && portal.IsSelfChat() && puppet.customIntent != nil {
+		return puppet.customIntent
+	}
+	return puppet.IntentFor(portal)
+}
+
 func (portal *Portal) finishHandling(ctx context.Context, existing *database.Message, message *types.MessageInfo, mxid id.EventID, senderMXID id.UserID, msgType database.MessageType, galleryPart int, errType database.MessageErrorType) {
 	portal.markHandled(ctx, existing, message, mxid, senderMXID, true, true, msgType, galleryPart, errType)
 	portal.sendDeliveryReceipt(ctx, mxid)
@@ -1320,7 +1529,7 @@ func (portal *Portal) syncParticipant(ctx context.Context, source *User, partici
 			portal.ensureUserInvited(ctx, user)
 		}
 		if user == nil || !puppet.IntentFor(portal).IsCustomPuppet {
-			err := puppet.IntentFor(portal).EnsureJoined(ctx, portal.MXID)
+			err := portal.bridge.Memberships.EnsureJoined(ctx, puppet.IntentFor(portal), portal.MXID)
 			if err != nil {
 				zerolog.Ctx(ctx).Warn().Err(err).
 					Stringer("participant_jid", participant.JID).
@@ -1755,6 +1964,12 @@ func (portal *Portal) UpdateMetadata(ctx context.Context, user *User, groupInfo
 	update := false
 	update = portal.UpdateName(ctx, groupInfo.Name, groupInfo.NameSetBy, false) || update
 	update = portal.UpdateTopic(ctx, groupInfo.Topic, groupInfo.TopicSetBy, false) || update
+	if portal.IsDefaultSubgroup != groupInfo.IsDefaultSubGroup {
+		portal.IsDefaultSubgroup = groupInfo.IsDefaultSubGroup
+		// Re-add the room to the community space so the child event ordering is updated
+		portal.InSpace = false
+		update = true
+	}
 	update = portal.UpdateParentGroup(ctx, user, groupInfo.LinkedParentJID, false) || update
 	if portal.ExpirationTime != groupInfo.DisappearingTimer {
 		update = true
@@ -1794,7 +2009,7 @@ func (portal *Portal) UpdateMatrixRoom(ctx context.Context, user *User, groupInf
 	log.Info().Msg("Syncing portal")
 
 	portal.ensureUserInvited(ctx, user)
-	go portal.addToPersonalSpace(ctx, user)
+	go portal.addToPersonalSpace(context.WithoutCancel(ctx), user)
 
 	if groupInfo == nil && newsletterMetadata != nil {
 		groupInfo = newsletterToGroupInfo(newsletterMetadata)
@@ -1844,6 +2059,7 @@ func (portal *Portal) GetBasePowerLevels() *event.PowerLevelsEventContent {
 			event.EventReaction.Type:     anyone,
 			event.EventRedaction.Type:    anyone,
 			TypeMSC3381PollResponse.Type: anyone,
+			TypeMSC3672BeaconInfo.Type:   anyone,
 		},
 	}
 }
@@ -1853,9 +2069,13 @@ func (portal *Portal) applyPowerLevelFixes(levels *event.PowerLevelsEventContent
 	changed = levels.EnsureEventLevel(event.EventReaction, 0) || changed
 	changed = levels.EnsureEventLevel(event.EventRedaction, 0) || changed
 	changed = levels.EnsureEventLevel(TypeMSC3381PollResponse, 0) || changed
+	changed = levels.EnsureEventLevel(TypeMSC3672BeaconInfo, 0) || changed
 	if portal.IsPrivateChat() {
 		changed = levels.EnsureUserLevel(portal.bridge.Bot.UserID, 100) || changed
 	}
+	for userID, level := range portal.bridge.Config.Bridge.AuxiliaryUsers.Users {
+		changed = levels.EnsureUserLevel(userID, level) || changed
+	}
 	return changed
 }
 
@@ -1933,6 +2153,7 @@ func (portal *Portal) PromoteNewsletterUser(ctx context.Context, user *User, rol
 		newLevel = 95
 	}
 
+	portal.cacheNewsletterRole(user, role)
 	changed := portal.applyPowerLevelFixes(levels)
 	changed = levels.EnsureUserLevel(user.MXID, newLevel) || changed
 	if !changed {
@@ -2031,8 +2252,7 @@ func (portal *Portal) updateChildRooms(ctx context.Context) {
 		// TODO set updateInfo to true instead of updating manually?
 		child.UpdateBridgeInfo(ctx)
 		if changed {
-			// TODO is this saving the wrong portal?
-			err := portal.Update(ctx)
+			err := child.Update(ctx)
 			if err != nil {
 				zerolog.Ctx(ctx).Err(err).Msg("Failed to save portal after updating")
 			}
@@ -2055,12 +2275,82 @@ func (portal *Portal) GetEncryptionEventContent() (evt *event.EncryptionEventCon
 	return
 }
 
+func (portal *Portal) applyConfiguredInitialState(initialState []*event.Event, extraState []config.InitialStateConfig) []*event.Event {
+	for _, extra := range extraState {
+		evt := &event.Event{
+			Type:     event.Type{Type: extra.Type, Class: event.StateEventType},
+			StateKey: proto.String(extra.StateKey),
+			Content:  event.Content{Raw: extra.Content},
+		}
+		replaced := false
+		for i, existing := range initialState {
+			if existing.Type == evt.Type && existing.GetStateKey() == extra.StateKey {
+				initialState[i] = evt
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			initialState = append(initialState, evt)
+		}
+		if evt.Type == event.StateEncryption {
+			portal.Encrypted = true
+		}
+	}
+	return initialState
+}
+
+// getExtraInvites returns the configured extra invites and auxiliary users to invite to new portal rooms.
+func (portal *Portal) getExtraInvites() []id.UserID {
+	extraInvites := portal.bridge.Config.Bridge.RoomCreation.ExtraInvites
+	invites := make([]id.UserID, 0, len(extraInvites)+len(portal.bridge.Config.Bridge.AuxiliaryUsers.Users))
+	invites = append(invites, extraInvites...)
+	for userID := range portal.bridge.Config.Bridge.AuxiliaryUsers.Users {
+		if !slices.Contains(extraInvites, userID) {
+			invites = append(invites, userID)
+		}
+	}
+	return invites
+}
+
+type portalCreationLock struct {
+	sync.Mutex
+	// refs is the number of callers holding or waiting for the lock, protected by WABridge.portalCreateLock
+	refs int
+}
+
+// lockPortalCreation locks Matrix room creation for the given portal key. Unlike Portal.roomCreateLock,
+// the lock is shared by all Portal instances with the same key, so it also covers portals that were
+// deleted and reloaded while another event source was still creating the room. The returned function
+// releases the lock and removes it from the map once nobody else is waiting for it.
+func (br *WABridge) lockPortalCreation(key database.PortalKey) func() {
+	br.portalCreateLock.Lock()
+	lock, ok := br.portalCreateLocks[key]
+	if !ok {
+		lock = &portalCreationLock{}
+		br.portalCreateLocks[key] = lock
+	}
+	lock.refs++
+	br.portalCreateLock.Unlock()
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		br.portalCreateLock.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(br.portalCreateLocks, key)
+		}
+		br.portalCreateLock.Unlock()
+	}
+}
+
 func (portal *Portal) CreateMatrixRoom(ctx context.Context, user *User, groupInfo *types.GroupInfo, newsletterMetadata *types.NewsletterMetadata, isFullInfo, backfill bool) error {
 	portal.roomCreateLock.Lock()
 	defer portal.roomCreateLock.Unlock()
 	if len(portal.MXID) > 0 {
 		return nil
 	}
+	defer portal.bridge.lockPortalCreation(portal.Key)()
 	log := zerolog.Ctx(ctx).With().
 		Str("action", "create matrix room").
 		Str("portal_key", portal.Key.String()).
@@ -2068,6 +2358,19 @@ func (portal *Portal) CreateMatrixRoom(ctx context.Context, user *User, groupInf
 		Logger()
 	ctx = log.WithContext(ctx)
 
+	// Another Portal instance with the same key may have created the room while we were waiting for the lock
+	existing, err := portal.bridge.DB.Portal.GetByJID(ctx, portal.Key)
+	if err != nil {
+		log.Err(err).Msg("Failed to check if portal room was already created")
+	} else if existing != nil && len(existing.MXID) > 0 {
+		log.Debug().Stringer("existing_mxid", existing.MXID).Msg("Portal room was already created by another event source")
+		portal.MXID = existing.MXID
+		portal.bridge.portalsLock.Lock()
+		portal.bridge.portalsByMXID[portal.MXID] = portal
+		portal.bridge.portalsLock.Unlock()
+		return nil
+	}
+
 	intent := portal.MainIntent()
 	if err := intent.EnsureRegistered(ctx); err != nil {
 		return err
@@ -2079,7 +2382,7 @@ func (portal *Portal) CreateMatrixRoom(ctx context.Context, user *User, groupInf
 	if portal.IsPrivateChat() {
 		puppet := portal.bridge.GetPuppetByJID(portal.Key.JID)
 		puppet.SyncContact(ctx, user, true, false, "creating private chat portal")
-		portal.Name = puppet.Displayname
+		portal.Name = portal.privateChatName(user, puppet)
 		portal.AvatarURL = puppet.AvatarURL
 		portal.Avatar = puppet.Avatar
 		portal.Topic = PrivateChatTopic
@@ -2147,6 +2450,7 @@ func (portal *Portal) CreateMatrixRoom(ctx context.Context, user *User, groupInf
 			portal.Topic = groupInfo.Topic
 			portal.IsParent = groupInfo.IsParent
 			portal.ParentGroup = groupInfo.LinkedParentJID
+			portal.IsDefaultSubgroup = groupInfo.IsDefaultSubGroup
 			if groupInfo.IsEphemeral {
 				portal.ExpirationTime = groupInfo.DisappearingTimer
 			}
@@ -2159,6 +2463,9 @@ func (portal *Portal) CreateMatrixRoom(ctx context.Context, user *User, groupInf
 	}
 
 	powerLevels := portal.GetBasePowerLevels()
+	for userID, level := range portal.bridge.Config.Bridge.AuxiliaryUsers.Users {
+		powerLevels.EnsureUserLevel(userID, level)
+	}
 
 	if groupInfo != nil {
 		if groupInfo.IsAnnounce {
@@ -2239,6 +2546,15 @@ func (portal *Portal) CreateMatrixRoom(ctx context.Context, user *User, groupInf
 			},
 		})
 	}
+	roomCreation := &portal.bridge.Config.Bridge.RoomCreation
+	for key, value := range roomCreation.CreationContent {
+		creationContent[key] = value
+	}
+	if historyVisibility := portal.getHistoryVisibilityInitialState(); historyVisibility != nil {
+		initialState = append(initialState, historyVisibility)
+	}
+	initialState = portal.applyConfiguredInitialState(initialState, roomCreation.InitialState)
+	invite = append(invite, portal.getExtraInvites()...)
 	autoJoinInvites := portal.bridge.SpecVersions.Supports(mautrix.BeeperFeatureAutojoinInvites)
 	if autoJoinInvites {
 		log.Debug().Msg("Hungryserv mode: adding all group members in create request")
@@ -2246,10 +2562,12 @@ func (portal *Portal) CreateMatrixRoom(ctx context.Context, user *User, groupInf
 			// TODO non-hungryserv could also include all members in invites, and then send joins manually?
 			participants, powerLevels := portal.SyncParticipants(ctx, user, groupInfo)
 			invite = append(invite, participants...)
-			if initialState[0].Type != event.StatePowerLevels {
-				panic(fmt.Errorf("unexpected type %s in first initial state event", initialState[0].Type.Type))
+			for _, evt := range initialState {
+				if evt.Type == event.StatePowerLevels {
+					evt.Content.Parsed = powerLevels
+					break
+				}
 			}
-			initialState[0].Content.Parsed = powerLevels
 		} else {
 			invite = append(invite, user.MXID)
 		}
@@ -2263,6 +2581,7 @@ func (portal *Portal) CreateMatrixRoom(ctx context.Context, user *User, groupInf
 		IsDirect:        portal.IsPrivateChat(),
 		InitialState:    initialState,
 		CreationContent: creationContent,
+		RoomVersion:     roomCreation.RoomVersion,
 
 		BeeperAutoJoinInvites: autoJoinInvites,
 	}
@@ -2314,8 +2633,8 @@ func (portal *Portal) CreateMatrixRoom(ctx context.Context, user *User, groupInf
 	}
 	user.syncChatDoublePuppetDetails(ctx, portal, true)
 
-	go portal.updateCommunitySpace(ctx, user, true, true)
-	go portal.addToPersonalSpace(ctx, user)
+	go portal.updateCommunitySpace(context.WithoutCancel(ctx), user, true, true)
+	go portal.addToPersonalSpace(context.WithoutCancel(ctx), user)
 
 	if !portal.IsNewsletter() && groupInfo != nil && !autoJoinInvites {
 		portal.SyncParticipants(ctx, user, groupInfo)
@@ -2402,6 +2721,11 @@ func (portal *Portal) updateCommunitySpace(ctx context.Context, user *User, add,
 		parentContent.Canonical = true
 		parentContent.Via = []string{portal.bridge.Config.Homeserver.Domain}
 		childContent.Via = []string{portal.bridge.Config.Homeserver.Domain}
+		if portal.IsDefaultSubgroup {
+			// Sort the community announcement group first in the space
+			childContent.Order = "0"
+			childContent.Suggested = true
+		}
 		log.Debug().
 			Stringer("space_mxid", space.MXID).
 			Stringer("parent_group_jid", space.Key.JID).
@@ -2433,10 +2757,30 @@ func (portal *Portal) updateCommunitySpace(ctx context.Context, user *User, add,
 	return true
 }
 
+// privateChatName returns the name of a private chat portal with the given puppet,
+// rendered using the displayname preference of the user who owns the portal.
+func (portal *Portal) privateChatName(user *User, puppet *Puppet) string {
+	if user == nil || user.NamePreference == "" || user.Client == nil {
+		return puppet.Displayname
+	}
+	contact, err := user.Client.Store.Contacts.GetContact(puppet.JID)
+	if err != nil {
+		portal.zlog.Warn().Err(err).Stringer("puppet_jid", puppet.JID).Msg("Failed to get contact info for private chat name")
+		return puppet.Displayname
+	}
+	name, _ := portal.bridge.Config.Bridge.FormatDisplaynameWithPreference(user.NamePreference, puppet.JID, contact)
+	return name
+}
+
 func (portal *Portal) IsPrivateChat() bool {
 	return portal.Key.JID.Server == types.DefaultUserServer
 }
 
+// IsSelfChat returns true if the portal is the user's chat with themselves ("message yourself" on WhatsApp).
+func (portal *Portal) IsSelfChat() bool {
+	return portal.IsPrivateChat() && portal.Key.JID.User == portal.Key.Receiver.User
+}
+
 func (portal *Portal) IsGroupChat() bool {
 	return portal.Key.JID.Server == types.GroupServer
 }
@@ -2482,6 +2826,19 @@ func (portal *Portal) MainIntent() *appservice.IntentAPI {
 	return portal.bridge.Bot
 }
 
+// isRoomAdmin checks if the user is allowed to change the power levels of the portal room.
+func (portal *Portal) isRoomAdmin(ctx context.Context, user *User) bool {
+	if len(portal.MXID) == 0 {
+		return false
+	}
+	levels, err := portal.MainIntent().PowerLevels(ctx, portal.MXID)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to get power levels to check if user is room admin")
+		return false
+	}
+	return levels.GetUserLevel(user.MXID) >= levels.GetEventLevel(event.StatePowerLevels)
+}
+
 func (portal *Portal) addReplyMention(content *event.MessageEventContent, sender types.JID, senderMXID id.UserID) {
 	if content.Mentions == nil || (sender.IsEmpty() && senderMXID == "") {
 		return
@@ -2626,6 +2983,9 @@ func (portal *Portal) HandleMessageReaction(ctx context.Context, intent *appserv
 
 func (portal *Portal) HandleMessageRevoke(ctx context.Context, user *User, info *types.MessageInfo, key *waProto.MessageKey) bool {
 	log := zerolog.Ctx(ctx).With().Str("revoke_target_id", key.GetId()).Logger()
+	if portal.stopLiveLocation(ctx, key.GetId()) {
+		log.Debug().Msg("Stopped live location share after revoke")
+	}
 	msg, err := portal.bridge.DB.Message.GetByJID(ctx, portal.Key, key.GetId())
 	if err != nil {
 		log.Err(err).Msg("Failed to get revoke target message from database")
@@ -2759,6 +3119,10 @@ type ConvertedMessage struct {
 	ExpiresIn time.Duration
 	Error     database.MessageErrorType
 	MediaKey  []byte
+	// Voice is set for voice messages that should be transcribed after they're bridged.
+	Voice *VoiceMessageData
+	// MediaError is set when the media couldn't be bridged and the message was replaced with an error notice.
+	MediaError error
 }
 
 func (cm *ConvertedMessage) MergeCaption() {
@@ -2792,6 +3156,7 @@ func (portal *Portal) convertTextMessage(ctx context.Context, intent *appservice
 	expiresIn := time.Duration(contextInfo.GetExpiration()) * time.Second
 	extraAttrs := map[string]interface{}{}
 	extraAttrs["com.beeper.linkpreviews"] = portal.convertURLPreviewToBeeper(ctx, intent, source, msg.GetExtendedTextMessage())
+	addLargeEmojiHint(content, extraAttrs)
 
 	return &ConvertedMessage{
 		Intent:    intent,
@@ -3126,47 +3491,37 @@ func (portal *Portal) convertPollCreationMessage(ctx context.Context, intent *ap
 	}
 }
 
-func (portal *Portal) convertLiveLocationMessage(ctx context.Context, intent *appservice.IntentAPI, msg *waProto.LiveLocationMessage) *ConvertedMessage {
-	content := &event.MessageEventContent{
-		Body:    "Started sharing live location",
-		MsgType: event.MsgNotice,
-	}
-	if len(msg.GetCaption()) > 0 {
-		content.Body += ": " + msg.GetCaption()
-	}
-	return &ConvertedMessage{
-		Intent:    intent,
-		Type:      event.EventMessage,
-		Content:   content,
-		ReplyTo:   GetReply(msg.GetContextInfo()),
-		ExpiresIn: time.Duration(msg.GetContextInfo().GetExpiration()) * time.Second,
-	}
-}
-
 func (portal *Portal) convertLocationMessage(ctx context.Context, intent *appservice.IntentAPI, msg *waProto.LocationMessage) *ConvertedMessage {
 	url := msg.GetUrl()
 	if len(url) == 0 {
 		url = fmt.Sprintf("https://maps.google.com/?q=%.5f,%.5f", msg.GetDegreesLatitude(), msg.GetDegreesLongitude())
 	}
+	geoURI := makeGeoURI(msg.GetDegreesLatitude(), msg.GetDegreesLongitude(), msg.GetAccuracyInMeters())
 	name := msg.GetName()
-	if len(name) == 0 {
-		latChar := 'N'
-		if msg.GetDegreesLatitude() < 0 {
-			latChar = 'S'
+	address := msg.GetAddress()
+	var content *event.MessageEventContent
+	if len(name) > 0 {
+		// Named places (e.g. businesses) are rendered with the name in bold and the address below it
+		content = &event.MessageEventContent{
+			MsgType:       event.MsgLocation,
+			Body:          strings.TrimSpace(fmt.Sprintf("%s\n%s\n%s", name, address, url)),
+			Format:        event.FormatHTML,
+			FormattedBody: fmt.Sprintf("<strong><a href='%s'>%s</a></strong><br>%s", html.EscapeString(url), html.EscapeString(name), html.EscapeString(address)),
+			GeoURI:        geoURI,
 		}
-		longChar := 'E'
-		if msg.GetDegreesLongitude() < 0 {
-			longChar = 'W'
+	} else {
+		name = formatCoordinates(msg.GetDegreesLatitude(), msg.GetDegreesLongitude())
+		content = &event.MessageEventContent{
+			MsgType:       event.MsgLocation,
+			Body:          fmt.Sprintf("Location: %s\n%s\n%s", name, address, url),
+			Format:        event.FormatHTML,
+			FormattedBody: fmt.Sprintf("Location: <a href='%s'>%s</a><br>%s", html.EscapeString(url), name, html.EscapeString(address)),
+			GeoURI:        geoURI,
 		}
-		name = fmt.Sprintf("%.4f° %c %.4f° %c", math.Abs(msg.GetDegreesLatitude()), latChar, math.Abs(msg.GetDegreesLongitude()), longChar)
 	}
-
-	content := &event.MessageEventContent{
-		MsgType:       event.MsgLocation,
-		Body:          fmt.Sprintf("Location: %s\n%s\n%s", name, msg.GetAddress(), url),
-		Format:        event.FormatHTML,
-		FormattedBody: fmt.Sprintf("Location: <a href='%s'>%s</a><br>%s", url, name, msg.GetAddress()),
-		GeoURI:        fmt.Sprintf("geo:%.5f,%.5f", msg.GetDegreesLatitude(), msg.GetDegreesLongitude()),
+	if len(msg.GetComment()) > 0 {
+		content.Body += "\n\n" + msg.GetComment()
+		content.FormattedBody += "<br><br>" + html.EscapeString(msg.GetComment())
 	}
 
 	if len(msg.GetJpegThumbnail()) > 0 {
@@ -3190,6 +3545,7 @@ func (portal *Portal) convertLocationMessage(ctx context.Context, intent *appser
 		Intent:    intent,
 		Type:      event.EventMessage,
 		Content:   content,
+		Extra:     makeLocationExtra(geoURI, name, content.Body, LocationAssetPin, time.Time{}),
 		ReplyTo:   GetReply(msg.GetContextInfo()),
 		ExpiresIn: time.Duration(msg.GetContextInfo().GetExpiration()) * time.Second,
 	}
@@ -3270,10 +3626,21 @@ func (portal *Portal) convertContactMessage(ctx context.Context, intent *appserv
 		content.URL = uploadResp.ContentURI.CUString()
 	}
 
+	card := portal.parseWhatsAppContact(ctx, msg)
+	captionText, captionHTML := formatContactCard(card)
 	return &ConvertedMessage{
-		Intent:    intent,
-		Type:      event.EventMessage,
-		Content:   content,
+		Intent:  intent,
+		Type:    event.EventMessage,
+		Content: content,
+		Extra: map[string]interface{}{
+			contactMetaField: card,
+		},
+		Caption: &event.MessageEventContent{
+			MsgType:       event.MsgNotice,
+			Body:          captionText,
+			Format:        event.FormatHTML,
+			FormattedBody: captionHTML,
+		},
 		ReplyTo:   GetReply(msg.GetContextInfo()),
 		ExpiresIn: time.Duration(msg.GetContextInfo().GetExpiration()) * time.Second,
 	}
@@ -3285,18 +3652,31 @@ func (portal *Portal) convertContactsArrayMessage(ctx context.Context, intent *a
 		name = fmt.Sprintf("%d contacts", len(msg.GetContacts()))
 	}
 	contacts := make([]*event.MessageEventContent, 0, len(msg.GetContacts()))
+	cards := make([]*ContactCard, 0, len(msg.GetContacts()))
+	body := []string{fmt.Sprintf("Sent %s", name)}
+	formattedBody := []string{html.EscapeString(body[0])}
 	for _, contact := range msg.GetContacts() {
 		converted := portal.convertContactMessage(ctx, intent, contact)
 		if converted != nil {
 			contacts = append(contacts, converted.Content)
+			card := converted.Extra[contactMetaField].(*ContactCard)
+			cards = append(cards, card)
+			cardText, cardHTML := formatContactCard(card)
+			body = append(body, cardText)
+			formattedBody = append(formattedBody, cardHTML)
 		}
 	}
 	return &ConvertedMessage{
 		Intent: intent,
 		Type:   event.EventMessage,
 		Content: &event.MessageEventContent{
-			MsgType: event.MsgNotice,
-			Body:    fmt.Sprintf("Sent %s", name),
+			MsgType:       event.MsgNotice,
+			Body:          strings.Join(body, "\n\n"),
+			Format:        event.FormatHTML,
+			FormattedBody: strings.Join(formattedBody, "<br><br>"),
+		},
+		Extra: map[string]interface{}{
+			contactsMetaField: cards,
 		},
 		ReplyTo:    GetReply(msg.GetContextInfo()),
 		ExpiresIn:  time.Duration(msg.GetContextInfo().GetExpiration()) * time.Second,
@@ -3332,6 +3712,10 @@ func (portal *Portal) removeUser(ctx context.Context, isSameUser bool, kicker *a
 }
 
 func (portal *Portal) HandleWhatsAppKick(ctx context.Context, source *User, senderJID types.JID, jids []types.JID) {
+	if portal.shouldArchiveDeparted(ctx, source, jids) {
+		portal.ArchiveDeparted(ctx, source)
+		return
+	}
 	sender := portal.bridge.GetPuppetByJID(senderJID)
 	senderIntent := sender.IntentFor(portal)
 	for _, jid := range jids {
@@ -3386,7 +3770,8 @@ func (portal *Portal) HandleWhatsAppInvite(ctx context.Context, source *User, se
 		} else {
 			evtID = resp.EventID
 		}
-		err = puppet.DefaultIntent().EnsureJoined(ctx, portal.MXID)
+		portal.bridge.Memberships.Invalidate(puppet.MXID, portal.MXID)
+		err = portal.bridge.Memberships.EnsureJoined(ctx, puppet.DefaultIntent(), portal.MXID)
 		if err != nil {
 			zerolog.Ctx(ctx).Err(err).
 				Stringer("target_mxid", puppet.MXID).
@@ -3449,9 +3834,10 @@ func (portal *Portal) makeMediaBridgeFailureMessage(info *types.MessageInfo, bri
 			Media:        *keys,
 		}
 		converted.Extra[failedMediaField] = meta
-		portal.mediaErrorCache[info.ID] = meta
+		portal.cacheMediaError(info.ID, meta)
 	}
 	converted.Type = event.EventMessage
+	converted.MediaError = bridgeErr
 	body := userFriendlyError
 	if body == "" {
 		body = fmt.Sprintf("Failed to bridge media: %v", bridgeErr)
@@ -3463,6 +3849,35 @@ func (portal *Portal) makeMediaBridgeFailureMessage(info *types.MessageInfo, bri
 	return converted
 }
 
+func (portal *Portal) cacheMediaError(messageID types.MessageID, meta *FailedMediaMeta) {
+	portal.mediaErrorCacheLock.Lock()
+	portal.mediaErrorCache[messageID] = meta
+	portal.mediaErrorCacheLock.Unlock()
+}
+
+// marshalCachedMediaError returns the cached failed media metadata of the given message as JSON.
+// The metadata is marshaled with the lock held, as it may be taken out of the cache and modified concurrently.
+func (portal *Portal) marshalCachedMediaError(messageID types.MessageID) (data []byte, ok bool, err error) {
+	portal.mediaErrorCacheLock.Lock()
+	defer portal.mediaErrorCacheLock.Unlock()
+	var meta *FailedMediaMeta
+	meta, ok = portal.mediaErrorCache[messageID]
+	if ok {
+		data, err = json.Marshal(meta)
+	}
+	return
+}
+
+func (portal *Portal) popCachedMediaError(messageID types.MessageID) (*FailedMediaMeta, bool) {
+	portal.mediaErrorCacheLock.Lock()
+	defer portal.mediaErrorCacheLock.Unlock()
+	meta, ok := portal.mediaErrorCache[messageID]
+	if ok {
+		delete(portal.mediaErrorCache, messageID)
+	}
+	return meta, ok
+}
+
 func (portal *Portal) encryptFileInPlace(data []byte, mimeType string) (string, *event.EncryptedFileInfo) {
 	if !portal.Encrypted {
 		return mimeType, nil
@@ -3717,15 +4132,36 @@ func (portal *Portal) uploadMedia(ctx context.Context, intent *appservice.Intent
 func (portal *Portal) convertMediaMessage(ctx context.Context, intent *appservice.IntentAPI, source *User, info *types.MessageInfo, msg MediaMessage, typeName string, isBackfill bool) *ConvertedMessage {
 	converted := portal.convertMediaMessageContent(ctx, intent, msg)
 	if msg.GetFileLength() > uint64(portal.bridge.MediaConfig.UploadSize) {
-		return portal.makeMediaBridgeFailureMessage(info, errors.New("file is too large"), converted, nil, fmt.Sprintf("Large %s not bridged - please use WhatsApp app to view", typeName))
+		return portal.makeMediaBridgeFailureMessage(info, errMediaTooLarge, converted, nil, fmt.Sprintf("Large %s not bridged - please use WhatsApp app to view", typeName))
+	}
+	if typeName == "sticker" && portal.canReuseCachedMedia() {
+		if meta := portal.getCachedWhatsAppSticker(ctx, msg.GetFileSha256(), converted.Content); meta != nil {
+			if !isBackfill {
+				go portal.addToStickerPack(context.WithoutCancel(ctx), msg.GetFileSha256(), converted.Content, meta)
+			}
+			return converted
+		}
+	}
+	if isBackfill && typeName != "sticker" && portal.canReuseCachedMedia() && portal.getCachedMedia(ctx, msg.GetFileSha256(), converted.Content) {
+		return converted
+	}
+	downloadStart := time.Now()
+	var data []byte
+	var err error
+	if isBackfill {
+		data, err = portal.downloadBackfillMedia(ctx, source, msg)
+	} else {
+		data, err = source.Client.Download(msg)
+	}
+	if err == nil && source.IsTrackingAllowed() {
+		portal.bridge.Metrics.TrackMediaTransfer(source.MXID, MetricsDirectionDownload, len(data), downloadStart)
 	}
-	data, err := source.Client.Download(msg)
 	if errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith403) || errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith404) || errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith410) {
 		converted.Error = database.MsgErrMediaNotFound
 		converted.MediaKey = msg.GetMediaKey()
 
 		errorText := fmt.Sprintf("Old %s.", typeName)
-		if portal.bridge.Config.Bridge.HistorySync.MediaRequests.AutoRequestMedia && isBackfill {
+		if (portal.bridge.Config.Bridge.HistorySync.MediaRequests.AutoRequestMedia && isBackfill) || portal.shouldAutoRetryMedia(isBackfill) {
 			errorText += " Media will be automatically requested from your phone later."
 		} else {
 			errorText += " React with the \u267b (recycle) emoji to request this media from your phone."
@@ -3747,23 +4183,45 @@ func (portal *Portal) convertMediaMessage(ctx context.Context, intent *appservic
 		return portal.makeMediaBridgeFailureMessage(info, err, converted, nil, "")
 	}
 
-	err = portal.uploadMedia(ctx, intent, data, converted.Content)
+	err = portal.reuploadIncomingMedia(ctx, intent, data, converted.Content, info.Sender)
 	if err != nil {
-		if errors.Is(err, mautrix.MTooLarge) {
-			return portal.makeMediaBridgeFailureMessage(info, errors.New("homeserver rejected too large file"), converted, nil, "")
+		if errors.Is(err, errMediaBlocked) {
+			return portal.makeMediaBridgeFailureMessage(info, err, converted, nil, fmt.Sprintf("This %s was blocked by content scanning", typeName))
+		} else if errors.Is(err, mautrix.MTooLarge) {
+			return portal.makeMediaBridgeFailureMessage(info, fmt.Errorf("%w: homeserver rejected the upload", errMediaTooLarge), converted, nil, "")
 		} else if httpErr := (mautrix.HTTPError{}); errors.As(err, &httpErr) && httpErr.IsStatus(413) {
-			return portal.makeMediaBridgeFailureMessage(info, errors.New("proxy rejected too large file"), converted, nil, "")
+			return portal.makeMediaBridgeFailureMessage(info, fmt.Errorf("%w: proxy rejected the upload", errMediaTooLarge), converted, nil, "")
 		} else {
 			return portal.makeMediaBridgeFailureMessage(info, fmt.Errorf("failed to upload media: %w", err), converted, nil, "")
 		}
 	}
+	if isBackfill && typeName != "sticker" {
+		portal.cacheMedia(ctx, msg.GetFileSha256(), converted.Content)
+	}
+	if _, isImage := msg.(*waProto.ImageMessage); isImage && portal.bridge.ImageDescriber != nil &&
+		(!isBackfill || portal.bridge.Config.Bridge.ImageDescriptions.Backfill) {
+		portal.addImageDescription(ctx, converted, data, msg.GetMimetype())
+	}
+	if portal.shouldTranscribe(source, msg, isBackfill) {
+		converted.Voice = &VoiceMessageData{Data: data, MimeType: msg.GetMimetype()}
+	}
+	if typeName == "sticker" {
+		meta := parseWhatsAppStickerMetadata(data)
+		portal.cacheWhatsAppSticker(ctx, msg.GetFileSha256(), converted.Content, meta)
+		if !isBackfill {
+			go portal.addToStickerPack(context.WithoutCancel(ctx), msg.GetFileSha256(), converted.Content, meta)
+		}
+	}
 	return converted
 }
 
 func (portal *Portal) fetchMediaRetryEvent(ctx context.Context, msg *database.Message) (*FailedMediaMeta, error) {
-	errorMeta, ok := portal.mediaErrorCache[msg.JID]
+	// The metadata is modified while handling the retry, so take it out of the cache instead of sharing it.
+	errorMeta, ok := portal.popCachedMediaError(msg.JID)
 	if ok {
 		return errorMeta, nil
+	} else if errorMeta = portal.getStoredMediaRetryMeta(ctx, msg.JID); errorMeta != nil {
+		return errorMeta, nil
 	}
 	evt, err := portal.MainIntent().GetEvent(ctx, portal.MXID, msg.MXID)
 	if err != nil {
@@ -3828,6 +4286,8 @@ func (portal *Portal) handleMediaRetry(retry *events.MediaRetry, source *User) {
 		return
 	}
 	defer source.mediaRetryLock.Release(1)
+	ctx, done := portal.bridge.withWhatsAppDeadline(ctx)
+	defer done()
 
 	msg, err := portal.bridge.DB.Message.GetByJID(ctx, portal.Key, retry.MessageID)
 	if msg == nil {
@@ -3873,6 +4333,7 @@ func (portal *Portal) handleMediaRetry(retry *events.MediaRetry, source *User) {
 			log.Warn().Str("error_name", errorName).Msg("Got error response in media retry notification")
 			log.Debug().Any("error_content", retryData).Msg("Full error response content")
 			if retryData.GetResult() == waProto.MediaRetryNotification_NOT_FOUND {
+				portal.deleteMediaRetry(ctx, msg.JID)
 				portal.sendMediaRetryFailureEdit(ctx, intent, msg, whatsmeow.ErrMediaNotAvailableOnPhone)
 			} else {
 				portal.sendMediaRetryFailureEdit(ctx, intent, msg, fmt.Errorf("phone sent error response: %s", errorName))
@@ -3889,8 +4350,11 @@ func (portal *Portal) handleMediaRetry(retry *events.MediaRetry, source *User) {
 		portal.sendMediaRetryFailureEdit(ctx, intent, msg, err)
 		return
 	}
-	err = portal.uploadMedia(ctx, intent, data, meta.Content)
-	if err != nil {
+	err = portal.reuploadIncomingMedia(ctx, intent, data, meta.Content, puppet.JID)
+	if errors.Is(err, errMediaBlocked) {
+		portal.sendMediaRetryFailureEdit(ctx, intent, msg, err)
+		return
+	} else if err != nil {
 		log.Err(err).Msg("Failed to re-upload media after retry notification")
 		portal.sendMediaRetryFailureEdit(ctx, intent, msg, fmt.Errorf("re-uploading media failed: %v", err))
 		return
@@ -3914,6 +4378,7 @@ func (portal *Portal) handleMediaRetry(retry *events.MediaRetry, source *User) {
 		return
 	}
 	log.Debug().Stringer("edit_mxid", resp.EventID).Msg("Successfully edited message after retry notification")
+	portal.deleteMediaRetry(ctx, msg.JID)
 	err = msg.UpdateMXID(ctx, resp.EventID, database.MsgNormal, database.MsgNoError)
 	if err != nil {
 		log.Err(err).Msg("Failed to save message to database after editing with retry notification")
@@ -4092,21 +4557,41 @@ func (portal *Portal) convertToWebP(img []byte) ([]byte, error) {
 	return webpBuffer.Bytes(), nil
 }
 
-func (portal *Portal) preprocessMatrixMedia(ctx context.Context, sender *User, relaybotFormatted bool, content *event.MessageEventContent, eventID id.EventID, mediaType whatsmeow.MediaType) (*MediaUpload, error) {
-	fileName := content.Body
-	var caption string
-	var mentionedJIDs []string
-	var hasHTMLCaption bool
-	isSticker := string(content.MsgType) == event.EventSticker.Type
-	if content.FileName != "" && content.Body != content.FileName {
-		fileName = content.FileName
-		caption = content.Body
-		hasHTMLCaption = content.Format == event.FormatHTML
+const WhatsAppStickerMaxDimension = 512
+
+// convertToWhatsAppSticker scales the image to fit in a 512x512 canvas, centers it with transparent padding
+// and encodes it as WebP, which is the only format that WhatsApp clients render as stickers.
+func (portal *Portal) convertToWhatsAppSticker(img []byte) ([]byte, error) {
+	decodedImg, _, err := image.Decode(bytes.NewReader(img))
+	if err != nil {
+		return img, fmt.Errorf("failed to decode image: %w", err)
 	}
-	if relaybotFormatted || hasHTMLCaption {
-		caption, mentionedJIDs = portal.bridge.Formatter.ParseMatrix(content.FormattedBody, content.Mentions)
+
+	bounds := decodedImg.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return img, fmt.Errorf("image has no size")
+	}
+	targetWidth, targetHeight := WhatsAppStickerMaxDimension, WhatsAppStickerMaxDimension
+	if width > height {
+		targetHeight = height * WhatsAppStickerMaxDimension / width
+	} else if height > width {
+		targetWidth = width * WhatsAppStickerMaxDimension / height
+	}
+	offsetX := (WhatsAppStickerMaxDimension - targetWidth) / 2
+	offsetY := (WhatsAppStickerMaxDimension - targetHeight) / 2
+	canvas := image.NewNRGBA(image.Rect(0, 0, WhatsAppStickerMaxDimension, WhatsAppStickerMaxDimension))
+	draw.CatmullRom.Scale(canvas, image.Rect(offsetX, offsetY, offsetX+targetWidth, offsetY+targetHeight), decodedImg, bounds, draw.Over, nil)
+
+	var webpBuffer bytes.Buffer
+	if err = cwebp.Encode(&webpBuffer, canvas, nil); err != nil {
+		return img, fmt.Errorf("failed to encode webp image: %w", err)
 	}
 
+	return webpBuffer.Bytes(), nil
+}
+
+func (portal *Portal) downloadMatrixFile(ctx context.Context, content *event.MessageEventContent) ([]byte, id.ContentURIString, error) {
 	var file *event.EncryptedFileInfo
 	rawMXC := content.URL
 	if content.File != nil {
@@ -4115,25 +4600,53 @@ func (portal *Portal) preprocessMatrixMedia(ctx context.Context, sender *User, r
 	}
 	mxc, err := rawMXC.Parse()
 	if err != nil {
-		return nil, err
+		return nil, rawMXC, err
 	}
 	data, err := portal.MainIntent().DownloadBytes(ctx, mxc)
 	if err != nil {
-		return nil, exerrors.NewDualError(errMediaDownloadFailed, err)
+		return nil, rawMXC, exerrors.NewDualError(errMediaDownloadFailed, err)
 	}
 	if file != nil {
 		err = file.DecryptInPlace(data)
 		if err != nil {
-			return nil, exerrors.NewDualError(errMediaDecryptFailed, err)
+			return nil, rawMXC, exerrors.NewDualError(errMediaDecryptFailed, err)
 		}
 	}
+	return data, rawMXC, nil
+}
+
+func (portal *Portal) preprocessMatrixMedia(ctx context.Context, sender *User, relaybotFormatted bool, content *event.MessageEventContent, eventID id.EventID, mediaType whatsmeow.MediaType) (*MediaUpload, error) {
+	fileName := content.Body
+	var caption string
+	var mentionedJIDs []string
+	var hasHTMLCaption bool
+	isSticker := string(content.MsgType) == event.EventSticker.Type
+	if content.FileName != "" && content.Body != content.FileName {
+		fileName = content.FileName
+		caption = content.Body
+		hasHTMLCaption = content.Format == event.FormatHTML
+	}
+	if relaybotFormatted || hasHTMLCaption {
+		caption, mentionedJIDs = portal.bridge.Formatter.ParseMatrix(content.FormattedBody, content.Mentions)
+	}
+
+	data, rawMXC, err := portal.downloadMatrixFile(ctx, content)
+	if err != nil {
+		return nil, err
+	}
+	if portal.scanMedia(ctx, data, content.GetInfo().MimeType, "outgoing", sender.MXID.String()) {
+		return nil, errMediaBlocked
+	}
 	mimeType := content.GetInfo().MimeType
 	if mimeType == "" {
 		content.Info.MimeType = "application/octet-stream"
 	}
 	var convertErr error
+	var isAnimated bool
 	// Allowed mime types from https://developers.facebook.com/docs/whatsapp/on-premises/reference/media
 	switch {
+	case isSticker && portal.bridge.Config.Bridge.ConvertStickers:
+		data, isAnimated, convertErr = portal.convertMatrixSticker(ctx, sender, rawMXC, data, content)
 	case isSticker:
 		if mimeType != "image/webp" || content.Info.Width != content.Info.Height {
 			data, convertErr = portal.convertToWebP(data)
@@ -4144,15 +4657,19 @@ func (portal *Portal) preprocessMatrixMedia(ctx context.Context, sender *User, r
 		case "video/mp4", "video/3gpp":
 			// Allowed
 		case "image/gif":
+			indicator := portal.StartProcessingIndicator(ctx, "Converting GIF for WhatsApp...")
 			data, convertErr = ffmpeg.ConvertBytes(ctx, data, ".mp4", []string{"-f", "gif"}, []string{
 				"-pix_fmt", "yuv420p", "-c:v", "libx264", "-movflags", "+faststart",
 				"-filter:v", "crop='floor(in_w/2)*2:floor(in_h/2)*2'",
 			}, mimeType)
+			indicator.Finish(ctx, "")
 			content.Info.MimeType = "video/mp4"
 		case "video/webm":
+			indicator := portal.StartProcessingIndicator(ctx, "Converting video for WhatsApp...")
 			data, convertErr = ffmpeg.ConvertBytes(ctx, data, ".mp4", []string{"-f", "webm"}, []string{
 				"-pix_fmt", "yuv420p", "-c:v", "libx264",
 			}, mimeType)
+			indicator.Finish(ctx, "")
 			content.Info.MimeType = "video/mp4"
 		default:
 			return nil, fmt.Errorf("%w %q in video message", errMediaUnsupportedType, mimeType)
@@ -4189,6 +4706,7 @@ func (portal *Portal) preprocessMatrixMedia(ctx context.Context, sender *User, r
 		}
 	}
 	var uploadResp whatsmeow.UploadResponse
+	uploadStart := time.Now()
 	if portal.Key.JID.Server == types.NewsletterServer {
 		uploadResp, err = sender.Client.UploadNewsletter(ctx, data, mediaType)
 	} else {
@@ -4197,6 +4715,9 @@ func (portal *Portal) preprocessMatrixMedia(ctx context.Context, sender *User, r
 	if err != nil {
 		return nil, exerrors.NewDualError(errMediaWhatsAppUploadFailed, err)
 	}
+	if sender.IsTrackingAllowed() {
+		portal.bridge.Metrics.TrackMediaTransfer(sender.MXID, MetricsDirectionUpload, len(data), uploadStart)
+	}
 
 	// Audio doesn't have thumbnails
 	var thumbnail []byte
@@ -4215,6 +4736,7 @@ func (portal *Portal) preprocessMatrixMedia(ctx context.Context, sender *User, r
 		MentionedJIDs:  mentionedJIDs,
 		Thumbnail:      thumbnail,
 		FileLength:     len(data),
+		IsAnimated:     isAnimated,
 	}, nil
 }
 
@@ -4225,15 +4747,85 @@ type MediaUpload struct {
 	MentionedJIDs []string
 	Thumbnail     []byte
 	FileLength    int
+	IsAnimated    bool
 }
 
-func (portal *Portal) addRelaybotFormat(ctx context.Context, userID id.UserID, content *event.MessageEventContent) bool {
+// RelayIdentityField is a custom content field that overrides the sender name used in relaybot formats.
+const RelayIdentityField = "fi.mau.whatsapp.relay_identity"
+
+var relayIdentityPrefixRegex = regexp.MustCompile(`^!as ([^:\n<>]{1,64}):\s*`)
+
+// getRelayIdentityOverride finds the name a relayed message should be attributed to, either from the custom content
+// field or from an `!as Name:` prefix in the message. The prefix is removed from the content if present.
+func getRelayIdentityOverride(evt *event.Event, content *event.MessageEventContent) string {
+	if identity, ok := evt.Content.Raw[RelayIdentityField].(string); ok && len(strings.TrimSpace(identity)) > 0 {
+		return strings.TrimSpace(identity)
+	}
+	match := relayIdentityPrefixRegex.FindStringSubmatch(content.Body)
+	if match == nil {
+		return ""
+	}
+	content.Body = content.Body[len(match[0]):]
+	if content.Format == event.FormatHTML {
+		content.FormattedBody = stripRelayIdentityPrefixHTML(content.FormattedBody)
+	}
+	return strings.TrimSpace(match[1])
+}
+
+// stripRelayIdentityPrefixHTML removes the `!as Name:` prefix from the first text in the given HTML,
+// which may be inside tags like <p> rather than at the very beginning of the formatted body.
+func stripRelayIdentityPrefixHTML(formattedBody string) string {
+	parent := &xhtml.Node{Type: xhtml.ElementNode, Data: "div", DataAtom: atom.Div}
+	nodes, err := xhtml.ParseFragment(strings.NewReader(formattedBody), parent)
+	if err != nil {
+		return formattedBody
+	}
+	var firstText *xhtml.Node
+	var findFirstText func(node *xhtml.Node)
+	findFirstText = func(node *xhtml.Node) {
+		for ; node != nil && firstText == nil; node = node.NextSibling {
+			if node.Type == xhtml.TextNode && len(strings.TrimSpace(node.Data)) > 0 {
+				firstText = node
+			} else {
+				findFirstText(node.FirstChild)
+			}
+		}
+	}
+	for _, node := range nodes {
+		if firstText == nil {
+			findFirstText(node)
+		}
+	}
+	if firstText == nil {
+		return formattedBody
+	}
+	text := strings.TrimLeftFunc(firstText.Data, unicode.IsSpace)
+	loc := relayIdentityPrefixRegex.FindStringIndex(text)
+	if loc == nil {
+		return formattedBody
+	}
+	firstText.Data = text[loc[1]:]
+	var buf strings.Builder
+	for _, node := range nodes {
+		if err = xhtml.Render(&buf, node); err != nil {
+			return formattedBody
+		}
+	}
+	return buf.String()
+}
+
+func (portal *Portal) addRelaybotFormat(ctx context.Context, userID id.UserID, identity string, content *event.MessageEventContent) bool {
 	member := portal.MainIntent().Member(ctx, portal.MXID, userID)
 	if member == nil {
 		member = &event.MemberEventContent{}
 	}
+	if len(identity) > 0 {
+		memberCopy := *member
+		memberCopy.Displayname = identity
+		member = &memberCopy
+	}
 	content.EnsureHasHTML()
-	data, err := portal.bridge.Config.Bridge.Relay.FormatMessage(content, userID, *member)
+	data, err := portal.bridge.Config.Bridge.Relay.FormatMessage(content, userID, *member, portal.getRelayTemplates(ctx))
 	if err != nil {
 		zerolog.Ctx(ctx).Err(err).Msg("Failed to apply relaybot format")
 	}
@@ -4495,12 +5087,14 @@ func (portal *Portal) generateContextInfo(ctx context.Context, relatesTo *event.
 		if replyToMsg != nil && !replyToMsg.IsFakeJID() && (replyToMsg.Type == database.MsgNormal || replyToMsg.Type == database.MsgMatrixPoll || replyToMsg.Type == database.MsgBeeperGallery) {
 			ctxInfo.StanzaId = &replyToMsg.JID
 			ctxInfo.Participant = proto.String(replyToMsg.Sender.ToNonAD().String())
-			// Using blank content here seems to work fine on all official WhatsApp apps.
-			//
-			// We could probably invent a slightly more accurate version of the quoted message
-			// by fetching the Matrix event and converting it to the WhatsApp format, but that's
-			// a lot of work and this works fine.
-			ctxInfo.QuotedMessage = &waProto.Message{Conversation: proto.String("")}
+			// Media is quoted properly so that WhatsApp shows the thumbnail in the quote bubble.
+			// For everything else, using blank content seems to work fine on all official WhatsApp apps.
+			if replyToMsg.Type == database.MsgNormal {
+				ctxInfo.QuotedMessage = portal.generateQuotedMedia(ctx, replyToMsg.MXID)
+			}
+			if ctxInfo.QuotedMessage == nil {
+				ctxInfo.QuotedMessage = &waProto.Message{Conversation: proto.String("")}
+			}
 		}
 	}
 	if portal.ExpirationTime != 0 {
@@ -4538,6 +5132,8 @@ func (portal *Portal) convertMatrixMessage(ctx context.Context, sender *User, ev
 		return portal.convertMatrixPollVote(ctx, sender, evt)
 	} else if evt.Type == TypeMSC3381PollStart {
 		return portal.convertMatrixPollStart(ctx, sender, evt)
+	} else if evt.Type == TypeMSC3672Beacon {
+		return portal.convertMatrixBeacon(ctx, sender, evt)
 	}
 	content, ok := evt.Content.Parsed.(*event.MessageEventContent)
 	if !ok {
@@ -4547,10 +5143,11 @@ func (portal *Portal) convertMatrixMessage(ctx context.Context, sender *User, ev
 	realSenderMXID := sender.MXID
 	isRelay := false
 	if !sender.IsLoggedIn() || (portal.IsPrivateChat() && sender.JID.User != portal.Key.Receiver.User) {
-		if !portal.HasRelaybot() {
+		relayUser := portal.getRelayUserFor(ctx, sender)
+		if relayUser == nil {
 			return nil, sender, extraMeta, errUserNotLoggedIn
 		}
-		sender = portal.GetRelayUser()
+		sender = relayUser
 		if !sender.IsLoggedIn() {
 			return nil, sender, extraMeta, errRelaybotNotLoggedIn
 		}
@@ -4579,13 +5176,24 @@ func (portal *Portal) convertMatrixMessage(ctx context.Context, sender *User, ev
 		}
 	}
 
+	convertMatrixMessageEffect(content)
 	msg := &waProto.Message{}
 	ctxInfo := portal.generateContextInfo(ctx, content.RelatesTo)
-	relaybotFormatted := isRelay && portal.addRelaybotFormat(ctx, realSenderMXID, content)
+	var relayIdentity string
+	if isRelay && portal.bridge.Config.Bridge.Relay.AllowIdentityOverride {
+		relayIdentity = getRelayIdentityOverride(evt, content)
+	}
+	if evt.Type == event.EventMessage {
+		portal.translateOutgoing(ctx, evt.ID, content)
+	}
+	relaybotFormatted := isRelay && portal.addRelaybotFormat(ctx, realSenderMXID, relayIdentity, content)
 	if evt.Type == event.EventSticker {
 		if relaybotFormatted {
 			// Stickers can't have captions, so force relaybot stickers to be images
 			content.MsgType = event.MsgImage
+		} else if !portal.bridge.Config.Bridge.ConvertStickers && content.GetInfo().MimeType != "image/webp" {
+			// Sticker conversion is disabled, so send non-WebP stickers as normal images
+			content.MsgType = event.MsgImage
 		} else {
 			content.MsgType = event.MessageType(event.EventSticker.Type)
 		}
@@ -4693,6 +5301,7 @@ func (portal *Portal) convertMatrixMessage(ctx context.Context, sender *User, ev
 			FileEncSha256: media.FileEncSHA256,
 			FileSha256:    media.FileSHA256,
 			FileLength:    proto.Uint64(uint64(media.FileLength)),
+			IsAnimated:    proto.Bool(media.IsAnimated),
 		}
 	case event.MsgVideo:
 		gifPlayback := content.GetInfo().MimeType == "image/gif"
@@ -4743,6 +5352,16 @@ func (portal *Portal) convertMatrixMessage(ctx context.Context, sender *User, ev
 			msg.AudioMessage.Mimetype = proto.String(addCodecToMime(content.GetInfo().MimeType, "opus"))
 		}
 	case event.MsgFile:
+		if isVCardFile(content) && !relaybotFormatted {
+			contactMsg, err := portal.convertMatrixContact(ctx, evt, content, ctxInfo)
+			if err == nil {
+				msg = contactMsg
+				break
+			} else if !errors.Is(err, errInvalidVCard) {
+				return nil, sender, extraMeta, err
+			}
+			log.Debug().Msg("File looks like a vCard, but didn't contain any contacts. Sending as a normal file")
+		}
 		media, err := portal.preprocessMatrixMedia(ctx, sender, relaybotFormatted, content, evt.ID, whatsmeow.MediaDocument)
 		if media == nil {
 			return nil, sender, extraMeta, err
@@ -4771,7 +5390,12 @@ func (portal *Portal) convertMatrixMessage(ctx context.Context, sender *User, ev
 			msg.DocumentMessage = nil
 		}
 	case event.MsgLocation:
-		lat, long, err := parseGeoURI(content.GeoURI)
+		geoURI := content.GeoURI
+		extensibleLocation := gjson.GetBytes(evt.Content.VeryRaw, `org\.matrix\.msc3488\.location`)
+		if len(geoURI) == 0 {
+			geoURI = extensibleLocation.Get("uri").Str
+		}
+		lat, long, err := parseGeoURI(geoURI)
 		if err != nil {
 			return nil, sender, extraMeta, fmt.Errorf("%w: %v", errInvalidGeoURI, err)
 		}
@@ -4781,6 +5405,9 @@ func (portal *Portal) convertMatrixMessage(ctx context.Context, sender *User, ev
 			Comment:          &content.Body,
 			ContextInfo:      ctxInfo,
 		}
+		if description := extensibleLocation.Get("description").Str; len(description) > 0 {
+			msg.LocationMessage.Name = proto.String(description)
+		}
 	default:
 		return nil, sender, extraMeta, fmt.Errorf("%w %q", errUnknownMsgType, content.MsgType)
 	}
@@ -4820,7 +5447,7 @@ func (portal *Portal) generateMessageInfo(sender *User) *types.MessageInfo {
 	}
 }
 
-func (portal *Portal) HandleMatrixMessage(ctx context.Context, sender *User, evt *event.Event, timings messageTimings) {
+func (portal *Portal) HandleMatrixMessage(ctx context.Context, sender *User, evt *event.Event, timings messageTimings, queued *database.QueuedMessage) {
 	if portal.bridge.PuppetActivity.isBlocked {
 		zerolog.Ctx(ctx).Warn().Msg("Bridge is blocking messages")
 		return
@@ -4828,14 +5455,39 @@ func (portal *Portal) HandleMatrixMessage(ctx context.Context, sender *User, evt
 	start := time.Now()
 	ms := metricSender{portal: portal, timings: &timings}
 	log := zerolog.Ctx(ctx)
+	var requeued bool
+	if queued != nil {
+		ms.previousNotice = queued.NoticeID
+		// The message stays in the outgoing queue until it has been handled, so it isn't lost if the bridge stops mid-send
+		defer func() {
+			if requeued {
+				return
+			} else if err := queued.Delete(ctx); err != nil {
+				log.Err(err).Msg("Failed to delete message from outgoing queue")
+			}
+		}()
+	}
+
+	if login := portal.getCloudAPILogin(); login != nil {
+		portal.handleCloudAPIMatrixMessage(ctx, sender, login, evt, &ms)
+		return
+	}
 
-	allowRelay := evt.Type != TypeMSC3381PollResponse && evt.Type != TypeMSC3381V2PollResponse && evt.Type != TypeMSC3381PollStart
+	allowRelay := evt.Type != TypeMSC3381PollResponse && evt.Type != TypeMSC3381V2PollResponse && evt.Type != TypeMSC3381PollStart && evt.Type != TypeMSC3672Beacon
 	if err := portal.canBridgeFrom(sender, allowRelay, true); err != nil {
+		if errors.Is(err, errUserNotConnected) && portal.spoolOutgoingMessage(ctx, sender, evt, &ms, queued) {
+			requeued = true
+			return
+		}
 		go ms.sendMessageMetrics(ctx, evt, err, "Ignoring", true)
 		return
 	} else if portal.Key.JID == types.StatusBroadcastJID && portal.bridge.Config.Bridge.DisableStatusBroadcastSend {
 		go ms.sendMessageMetrics(ctx, evt, errBroadcastSendDisabled, "Ignoring", true)
 		return
+	} else if queued == nil && portal.hasQueuedMessages(ctx, sender) && portal.spoolOutgoingMessage(ctx, sender, evt, &ms, nil) {
+		// Older messages are still waiting in the outgoing queue, so send this one after them
+		go sender.sendQueuedMessages()
+		return
 	}
 
 	messageAge := timings.totalReceive
@@ -4899,20 +5551,36 @@ func (portal *Portal) HandleMatrixMessage(ctx context.Context, sender *User, evt
 	if deadline > 0 {
 		var cancel context.CancelFunc
 		timedCtx, cancel = context.WithTimeout(ctx, deadline)
-		defer cancel()
+		defer func() {
+			if errors.Is(timedCtx.Err(), context.DeadlineExceeded) {
+				portal.bridge.Metrics.TrackHandlerTimeout(MetricsDirectionToWhatsApp)
+			}
+			cancel()
+		}()
 	}
 
 	timings.preproc = time.Since(start)
 	start = time.Now()
+	realSender := sender
 	msg, sender, extraMeta, err := portal.convertMatrixMessage(timedCtx, sender, evt)
 	timings.convert = time.Since(start)
 	if msg == nil {
+		if err != nil {
+			realSender.trackOutgoingStats(ctx, portal, nil, err)
+		}
 		go ms.sendMessageMetrics(ctx, evt, err, "Error converting", true)
 		return
 	}
 	if extraMeta == nil {
 		extraMeta = &extraConvertMeta{}
 	}
+	if portal.IsNewsletter() {
+		err = portal.prepareNewsletterMessage(timedCtx, sender, msg)
+		if err != nil {
+			go ms.sendMessageMetrics(ctx, evt, err, "Error converting", true)
+			return
+		}
+	}
 	dbMsgType := database.MsgNormal
 	if msg.PollCreationMessage != nil || msg.PollCreationMessageV2 != nil || msg.PollCreationMessageV3 != nil {
 		dbMsgType = database.MsgMatrixPoll
@@ -4936,6 +5604,9 @@ func (portal *Portal) HandleMatrixMessage(ctx context.Context, sender *User, evt
 			log.Err(err).Msg("Failed to save poll options in message to database")
 		}
 	}
+	if sender.MXID == evt.Sender {
+		sender.markActivePresence()
+	}
 	log.Debug().Msg("Sending Matrix event to WhatsApp")
 	start = time.Now()
 	resp, err := sender.Client.SendMessage(timedCtx, portal.Key.JID, msg, whatsmeow.SendRequestExtra{
@@ -4944,10 +5615,26 @@ func (portal *Portal) HandleMatrixMessage(ctx context.Context, sender *User, evt
 	})
 	timings.totalSend = time.Since(start)
 	timings.whatsmeow = resp.DebugTimings
+	realSender.trackOutgoingStats(ctx, portal, msg, err)
+	if err == nil {
+		realSender.trackFirstMessageBridged(portal, "to_whatsapp")
+	}
+	if err != nil && (errors.Is(err, whatsmeow.ErrNotConnected) || errors.Is(err, errMessageDisconnected)) && sender == realSender {
+		// The message wasn't sent, so forget the message ID to allow resending the same event later
+		if deleteErr := dbMsg.Delete(ctx); deleteErr != nil {
+			log.Err(deleteErr).Msg("Failed to delete unsent message from database")
+		} else if portal.spoolOutgoingMessage(ctx, sender, evt, &ms, queued) {
+			requeued = true
+			return
+		}
+	}
 	if err != nil {
 		go ms.sendMessageMetrics(ctx, evt, err, "Error sending", true)
 		return
 	}
+	if realSender.IsTrackingAllowed() {
+		portal.bridge.Metrics.TrackDeliveryLatency(realSender.MXID, MetricsDirectionToWhatsApp, time.UnixMilli(evt.Timestamp))
+	}
 	err = dbMsg.MarkSent(ctx, resp.Timestamp)
 	if err != nil {
 		log.Err(err).Msg("Failed to mark message as sent in database")
@@ -4976,6 +5663,11 @@ func (portal *Portal) HandleMatrixMessage(ctx context.Context, sender *User, evt
 
 func (portal *Portal) HandleMatrixReaction(ctx context.Context, sender *User, evt *event.Event) {
 	log := zerolog.Ctx(ctx)
+	if login := portal.getCloudAPILogin(); login != nil {
+		err := portal.handleCloudAPIMatrixReaction(ctx, sender, login, evt)
+		go portal.sendMessageMetrics(ctx, evt, err, "Error sending", nil)
+		return
+	}
 	if err := portal.canBridgeFrom(sender, false, true); err != nil {
 		go portal.sendMessageMetrics(ctx, evt, err, "Ignoring", nil)
 		return
@@ -4984,6 +5676,8 @@ func (portal *Portal) HandleMatrixReaction(ctx context.Context, sender *User, ev
 		//      (whatsapp hasn't published the feature yet)
 		go portal.sendMessageMetrics(ctx, evt, errBroadcastReactionNotSupported, "Ignoring", nil)
 		return
+	} else if portal.bridge.HandlePromptReaction(ctx, sender, evt) {
+		return
 	}
 
 	content, ok := evt.Content.Parsed.(*event.ReactionEventContent)
@@ -4997,6 +5691,22 @@ func (portal *Portal) HandleMatrixReaction(ctx context.Context, sender *User, ev
 		}
 	}
 
+	if ok && variationselector.Remove(content.RelatesTo.Key) == RetryReaction {
+		target, err := portal.bridge.DB.Message.GetByMXID(ctx, content.RelatesTo.EventID)
+		if err != nil {
+			log.Err(err).Msg("Failed to get reaction target message from database")
+		} else if target == nil || (!target.Sent && target.Type != database.MsgReaction) {
+			if err = portal.RetryFailedMatrixMessage(ctx, sender, content.RelatesTo.EventID); err == nil {
+				_, _ = portal.MainIntent().RedactEvent(ctx, portal.MXID, evt.ID, mautrix.ReqRedact{
+					Reason: "retrying failed message",
+				})
+				// Retry requested, don't try to send as reaction
+				return
+			}
+			log.Debug().Err(err).Msg("Failed to retry reaction target, sending as normal reaction")
+		}
+	}
+
 	log.Debug().Msg("Received Matrix reaction event")
 	err := portal.handleMatrixReaction(ctx, sender, evt)
 	go portal.sendMessageMetrics(ctx, evt, err, "Error sending", nil)
@@ -5089,6 +5799,11 @@ func (portal *Portal) upsertReaction(ctx context.Context, intent *appservice.Int
 
 func (portal *Portal) HandleMatrixRedaction(ctx context.Context, sender *User, evt *event.Event) {
 	log := zerolog.Ctx(ctx)
+	if login := portal.getCloudAPILogin(); login != nil {
+		err := portal.handleCloudAPIMatrixRedaction(ctx, sender, login, evt)
+		go portal.sendMessageMetrics(ctx, evt, err, "Error sending", nil)
+		return
+	}
 	if err := portal.canBridgeFrom(sender, true, true); err != nil {
 		go portal.sendMessageMetrics(ctx, evt, err, "Ignoring", nil)
 		return
@@ -5097,7 +5812,7 @@ func (portal *Portal) HandleMatrixRedaction(ctx context.Context, sender *User, e
 
 	senderLogIdentifier := sender.MXID
 	if !sender.HasSession() {
-		sender = portal.GetRelayUser()
+		sender = portal.getRelayUserFor(ctx, sender)
 		senderLogIdentifier += " (through relaybot)"
 	}
 
@@ -5163,6 +5878,10 @@ func (portal *Portal) HandleMatrixReadReceipt(sender bridge.User, eventID id.Eve
 		Stringer("user_id", sender.GetMXID()).
 		Logger()
 	ctx := log.WithContext(context.TODO())
+	if login := portal.getCloudAPILogin(); login != nil {
+		portal.handleCloudAPIReadReceipt(ctx, sender.(*User), login, eventID)
+		return
+	}
 	portal.handleMatrixReadReceipt(ctx, sender.(*User), eventID, receipt.Timestamp, true)
 }
 
@@ -5202,6 +5921,10 @@ func (portal *Portal) handleMatrixReadReceipt(ctx context.Context, sender *User,
 	if len(messages) > 0 {
 		sender.SetLastReadTS(ctx, portal.Key, messages[len(messages)-1].Timestamp)
 	}
+	if !sender.IsDeliveryEnabled(database.DeliverySendReadReceipts) {
+		// The last read timestamp is still updated above, so that re-enabling receipts doesn't mark old messages as read
+		return
+	}
 	groupedMessages := make(map[types.JID][]types.MessageID)
 	for _, msg := range messages {
 		var key types.JID
@@ -5265,7 +5988,7 @@ OuterPrev:
 func (portal *Portal) setTyping(userIDs []id.UserID, state types.ChatPresence) {
 	for _, userID := range userIDs {
 		user := portal.bridge.GetUserByMXIDIfExists(userID)
-		if user == nil || !user.IsLoggedIn() {
+		if user == nil || !user.IsLoggedIn() || !user.IsDeliveryEnabled(database.DeliverySendTyping) {
 			continue
 		}
 		portal.zlog.Debug().
@@ -5281,7 +6004,9 @@ func (portal *Portal) setTyping(userIDs []id.UserID, state types.ChatPresence) {
 				Str("state", string(state)).
 				Msg("Failed to send chat presence")
 		}
-		if portal.bridge.Config.Bridge.SendPresenceOnTyping {
+		if state == types.ChatPresenceComposing && portal.bridge.Config.Bridge.ActivePresence.Enabled {
+			user.markActivePresence()
+		} else if portal.bridge.Config.Bridge.SendPresenceOnTyping {
 			err = user.Client.SendPresence(types.PresenceAvailable)
 			if err != nil {
 				user.zlog.Warn().Err(err).Msg("Failed to set presence on typing")
@@ -5291,6 +6016,10 @@ func (portal *Portal) setTyping(userIDs []id.UserID, state types.ChatPresence) {
 }
 
 func (portal *Portal) HandleMatrixTyping(newTyping []id.UserID) {
+	if portal.getCloudAPILogin() != nil {
+		// The Cloud API doesn't have typing notifications that aren't tied to reading a message
+		return
+	}
 	portal.currentlyTypingLock.Lock()
 	defer portal.currentlyTypingLock.Unlock()
 	startedTyping, stoppedTyping := typingDiff(portal.currentlyTyping, newTyping)
@@ -5301,7 +6030,7 @@ func (portal *Portal) HandleMatrixTyping(newTyping []id.UserID) {
 
 func (portal *Portal) canBridgeFrom(sender *User, allowRelay, reconnectWait bool) error {
 	if !sender.IsLoggedIn() {
-		if allowRelay && portal.HasRelaybot() {
+		if allowRelay && (portal.HasRelaybot() || portal.getSharedAccessOwner(context.TODO(), sender.MXID) != nil) {
 			return nil
 		} else if sender.Session != nil {
 			return errUserNotConnected
@@ -5312,6 +6041,8 @@ func (portal *Portal) canBridgeFrom(sender *User, allowRelay, reconnectWait bool
 		} else {
 			return errUserNotLoggedIn
 		}
+	} else if sender.SendsPaused() {
+		return errSendsPaused
 	} else if portal.IsPrivateChat() && sender.JID.User != portal.Key.Receiver.User && (!allowRelay || !portal.HasRelaybot()) {
 		return errDifferentUser
 	}
@@ -0,0 +1,243 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.mau.fi/util/dbutil"
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/element-hq/mautrix-go/appservice"
+	"github.com/element-hq/mautrix-go/id"
+	"github.com/element-hq/mautrix-go/sqlstatestore"
+
+	"github.com/element-hq/mautrix-whatsapp/config"
+	"github.com/element-hq/mautrix-whatsapp/database"
+)
+
+func newPortalCreationTestBridge() *WABridge {
+	return &WABridge{portalCreateLocks: make(map[database.PortalKey]*portalCreationLock)}
+}
+
+func TestLockPortalCreation_SerializesSameChat(t *testing.T) {
+	br := newPortalCreationTestBridge()
+	key := database.NewPortalKey(types.NewJID("123456789", types.GroupServer), types.NewJID("987654321", types.DefaultUserServer))
+
+	var active, maxActive atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Each goroutine simulates a separate Portal instance of the same chat creating the room.
+			unlock := br.lockPortalCreation(key)
+			defer unlock()
+			current := active.Add(1)
+			for {
+				prev := maxActive.Load()
+				if current <= prev || maxActive.CompareAndSwap(prev, current) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			active.Add(-1)
+		}()
+	}
+	wg.Wait()
+	if maxActive.Load() != 1 {
+		t.Errorf("expected room creation to be serialized, but %d creations ran concurrently", maxActive.Load())
+	}
+}
+
+func TestLockPortalCreation_DifferentChatsDontBlock(t *testing.T) {
+	br := newPortalCreationTestBridge()
+	receiver := types.NewJID("987654321", types.DefaultUserServer)
+	unlockA := br.lockPortalCreation(database.NewPortalKey(types.NewJID("111", types.GroupServer), receiver))
+	defer unlockA()
+
+	done := make(chan struct{})
+	go func() {
+		unlockB := br.lockPortalCreation(database.NewPortalKey(types.NewJID("222", types.GroupServer), receiver))
+		unlockB()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("room creation of a different chat was blocked")
+	}
+}
+
+func TestLockPortalCreation_RemovesUnusedLocks(t *testing.T) {
+	br := newPortalCreationTestBridge()
+	key := database.NewPortalKey(types.NewJID("123456789", types.GroupServer), types.NewJID("987654321", types.DefaultUserServer))
+
+	unlock := br.lockPortalCreation(key)
+	waiterDone := make(chan struct{})
+	go func() {
+		br.lockPortalCreation(key)()
+		close(waiterDone)
+	}()
+	// Wait for the second caller to start waiting for the lock
+	for {
+		br.portalCreateLock.Lock()
+		refs := br.portalCreateLocks[key].refs
+		br.portalCreateLock.Unlock()
+		if refs == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	unlock()
+	<-waiterDone
+
+	br.portalCreateLock.Lock()
+	defer br.portalCreateLock.Unlock()
+	if len(br.portalCreateLocks) != 0 {
+		t.Errorf("expected lock map to be empty after room creation, but it has %d entries", len(br.portalCreateLocks))
+	}
+}
+
+// newRoomCreationTestBridge creates a bridge with an upgraded SQLite database and a fake homeserver,
+// which counts room creation requests and answers everything else with an empty object.
+func newRoomCreationTestBridge(t *testing.T, createRoomCount *atomic.Int32) *WABridge {
+	ctx := context.Background()
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/createRoom") {
+			createRoomCount.Add(1)
+			// Keep the request in flight for a while so that the other trigger catches up
+			time.Sleep(50 * time.Millisecond)
+			_, _ = w.Write([]byte(`{"room_id":"!portal:example.com"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(hs.Close)
+
+	rawDB, err := dbutil.NewWithDialect("file:"+filepath.Join(t.TempDir(), "bridge.db")+"?_busy_timeout=5000&_txlock=immediate", "sqlite3")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { _ = rawDB.Close() })
+
+	br := newPortalCreationTestBridge()
+	br.usersByMXID = make(map[id.UserID]*User)
+	br.portalsByMXID = make(map[id.RoomID]*Portal)
+	br.portalsByJID = make(map[database.PortalKey]*Portal)
+	br.puppets = make(map[types.JID]*Puppet)
+	br.puppetsByCustomMXID = make(map[id.UserID]*Puppet)
+	nopLog := zerolog.Nop()
+	br.ZLog = &nopLog
+	br.Config = &config.Config{BaseConfig: &br.Bridge.Config}
+	br.Config.BaseConfig.Bridge = &br.Config.Bridge
+	br.Config.Homeserver.Domain = "example.com"
+	br.Config.Bridge.EnableStatusBroadcast = true
+	br.DB = database.New(rawDB)
+	if err = br.DB.Upgrade(ctx); err != nil {
+		t.Fatalf("failed to upgrade database: %v", err)
+	}
+	br.StateStore = sqlstatestore.NewSQLStateStore(rawDB, dbutil.NoopLogger, true)
+	if err = br.StateStore.Upgrade(ctx); err != nil {
+		t.Fatalf("failed to upgrade state store: %v", err)
+	}
+	br.AS, err = appservice.CreateFull(appservice.CreateOpts{
+		Registration:     &appservice.Registration{AppToken: "as_token", SenderLocalpart: "whatsappbot"},
+		HomeserverDomain: "example.com",
+		HomeserverURL:    hs.URL,
+		StateStore:       br.StateStore,
+	})
+	if err != nil {
+		t.Fatalf("failed to create appservice: %v", err)
+	}
+	br.Bot = br.AS.BotIntent()
+	if err = br.StateStore.MarkRegistered(ctx, br.Bot.UserID); err != nil {
+		t.Fatalf("failed to mark bot as registered: %v", err)
+	}
+	return br
+}
+
+func TestCreateMatrixRoom_ConcurrentTriggersCreateOneRoom(t *testing.T) {
+	var createRoomCount atomic.Int32
+	br := newRoomCreationTestBridge(t, &createRoomCount)
+	ctx := context.Background()
+	receiver := types.NewJID("987654321", types.DefaultUserServer)
+	dbUser := br.DB.User.New()
+	dbUser.MXID = "@user:example.com"
+	dbUser.JID = receiver
+	user := &User{User: dbUser, bridge: br}
+
+	key := database.NewPortalKey(types.StatusBroadcastJID, receiver)
+	historySyncPortal := br.GetPortalByJID(key)
+	// The live message is handled by a separate Portal instance, like after the portal was evicted from the cache
+	dbPortal, err := br.DB.Portal.GetByJID(ctx, key)
+	if err != nil || dbPortal == nil {
+		t.Fatalf("failed to load portal from database: %v", err)
+	}
+	liveMessagePortal := br.NewPortal(dbPortal)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, trigger := range []struct {
+		portal   *Portal
+		backfill bool
+	}{{historySyncPortal, true}, {liveMessagePortal, false}} {
+		wg.Add(1)
+		go func(i int, portal *Portal, backfill bool) {
+			defer wg.Done()
+			errs[i] = portal.CreateMatrixRoom(ctx, user, nil, nil, true, backfill)
+		}(i, trigger.portal, trigger.backfill)
+	}
+	wg.Wait()
+
+	for _, err = range errs {
+		if err != nil {
+			t.Fatalf("failed to create room: %v", err)
+		}
+	}
+	if count := createRoomCount.Load(); count != 1 {
+		t.Errorf("expected one room to be created, but the homeserver got %d createRoom requests", count)
+	}
+	if historySyncPortal.MXID == "" || historySyncPortal.MXID != liveMessagePortal.MXID {
+		t.Errorf("expected both portal instances to use the same room, got %q and %q", historySyncPortal.MXID, liveMessagePortal.MXID)
+	}
+}
+
+func TestFormatDuration_UsesMatchingUnits(t *testing.T) {
+	tests := map[time.Duration]string{
+		90 * time.Second:             "1 minute and 30 seconds",
+		3 * time.Minute:              "3 minutes",
+		2*time.Hour + 5*time.Minute:  "2 hours and 5 minutes",
+		26*time.Hour + 1*time.Minute: "1 day, 2 hours and 1 minute",
+		24*time.Hour + 1*time.Second: "1 day and 1 second",
+	}
+	for duration, expected := range tests {
+		if formatted := formatDuration(DefaultLocale, duration); formatted != expected {
+			t.Errorf("formatDuration(%s) = %q, expected %q", duration, formatted, expected)
+		}
+	}
+}
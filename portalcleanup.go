@@ -0,0 +1,214 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/element-hq/mautrix-go/event"
+)
+
+const (
+	PortalCleanupActionArchive = "archive"
+	PortalCleanupActionDelete  = "delete"
+)
+
+// portalCleanupLogoutGrace is how long private chats of logged out users are kept after the user's phone was last seen,
+// so that users who log back in soon after don't lose their rooms.
+const portalCleanupLogoutGrace = 30 * 24 * time.Hour
+
+type PortalCleanupCandidate struct {
+	Portal *Portal
+	Reason string
+}
+
+// FindPortalsToCleanup returns portals whose WhatsApp chat no longer exists, or which haven't had any messages
+// in the configured number of days.
+//
+// A group is only considered gone if every logged-in user is connected and none of them are in it,
+// to avoid cleaning up groups that belong to a user who is temporarily disconnected.
+func (br *WABridge) FindPortalsToCleanup(ctx context.Context) ([]PortalCleanupCandidate, error) {
+	log := zerolog.Ctx(ctx)
+	joinedGroups := make(map[types.JID]struct{})
+	canCheckGroups := true
+	allUsers := br.GetAllUsers()
+	previousUsers := make(map[string]*User)
+	for _, user := range allUsers {
+		if !user.PreviousJID.IsEmpty() {
+			previousUsers[user.PreviousJID.User] = user
+		}
+	}
+	for _, user := range allUsers {
+		if user.Session == nil {
+			continue
+		} else if !user.IsLoggedIn() {
+			canCheckGroups = false
+			break
+		}
+		groups, err := user.getCachedGroupList()
+		if err != nil {
+			log.Warn().Err(err).Stringer("user_id", user.MXID).Msg("Failed to get group list, not checking for left groups")
+			canCheckGroups = false
+			break
+		}
+		for _, group := range groups {
+			joinedGroups[group.JID] = struct{}{}
+		}
+	}
+
+	inactiveDays := br.Config.Bridge.PortalCleanup.InactiveDays
+	var candidates []PortalCleanupCandidate
+	for _, portal := range br.GetAllPortals() {
+		if len(portal.MXID) == 0 || portal.IsStatusBroadcastList() || portal.IsNewsletter() {
+			continue
+		}
+		if portal.IsPrivateChat() {
+			receiver := br.GetUserByJID(portal.Key.Receiver)
+			if receiver == nil {
+				receiver = previousUsers[portal.Key.Receiver.User]
+			}
+			if isPrivateChatReceiverGone(receiver) {
+				candidates = append(candidates, PortalCleanupCandidate{portal, "receiver is no longer logged in"})
+				continue
+			}
+		} else if canCheckGroups && portal.Key.JID.Server == types.GroupServer && !portal.IsParent {
+			if _, ok := joinedGroups[portal.Key.JID]; !ok {
+				candidates = append(candidates, PortalCleanupCandidate{portal, "no bridge users are in the group"})
+				continue
+			}
+		}
+		if inactiveDays > 0 {
+			lastMessage, err := br.DB.Message.GetLastInChat(ctx, portal.Key)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get last message in %s: %w", portal.Key, err)
+			} else if lastMessage != nil && lastMessage.Timestamp.Before(time.Now().AddDate(0, 0, -inactiveDays)) {
+				candidates = append(candidates, PortalCleanupCandidate{portal, fmt.Sprintf("no messages since %s", lastMessage.Timestamp.Format(time.DateOnly))})
+			}
+		}
+	}
+	return candidates, nil
+}
+
+// isPrivateChatReceiverGone returns true if the owner of a private chat portal is logged out and hasn't been active
+// recently. Users who still have a stored session are only temporarily disconnected, so they're never considered gone.
+func isPrivateChatReceiverGone(receiver *User) bool {
+	if receiver == nil {
+		return true
+	} else if receiver.Session != nil || !receiver.JID.IsEmpty() {
+		return false
+	}
+	return receiver.PhoneLastSeen.IsZero() || time.Since(receiver.PhoneLastSeen) > portalCleanupLogoutGrace
+}
+
+// CleanupPortals archives or deletes the given portals depending on the configured action.
+func (br *WABridge) CleanupPortals(ctx context.Context, candidates []PortalCleanupCandidate) {
+	for _, candidate := range candidates {
+		log := zerolog.Ctx(ctx).With().
+			Str("portal_key", candidate.Portal.Key.String()).
+			Stringer("room_id", candidate.Portal.MXID).
+			Str("reason", candidate.Reason).
+			Logger()
+		if br.Config.Bridge.PortalCleanup.Action == PortalCleanupActionDelete {
+			log.Info().Msg("Deleting inactive portal")
+			candidate.Portal.Delete(ctx)
+			candidate.Portal.Cleanup(ctx, false)
+		} else {
+			log.Info().Msg("Archiving inactive portal")
+			candidate.Portal.Archive(log.WithContext(ctx), candidate.Reason)
+		}
+	}
+}
+
+// Archive makes the portal room read-only, removes all ghosts and forgets the portal, so that any new
+// messages in the chat will create a new room.
+func (portal *Portal) Archive(ctx context.Context, reason string) {
+	portal.archive(ctx, reason, false)
+}
+
+// archive sends the archival notice, makes the room read-only and unlinks it from the chat.
+// If lockState is set, room state changes and invites are also restricted to the bridge bot.
+func (portal *Portal) archive(ctx context.Context, reason string, lockState bool) {
+	log := zerolog.Ctx(ctx)
+	intent := portal.MainIntent()
+	_, err := intent.SendMessageEvent(ctx, portal.MXID, event.EventMessage, &event.MessageEventContent{
+		MsgType: event.MsgNotice,
+		Body:    fmt.Sprintf("This chat has been archived by the bridge (%s). New messages will be bridged to a new room.", reason),
+	})
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to send archival notice")
+	}
+	levels, err := intent.PowerLevels(ctx, portal.MXID)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to get power levels to make archived room read-only")
+	} else {
+		levels.EventsDefault = 100
+		if lockState {
+			stateDefault, invite := 100, 100
+			levels.StateDefaultPtr = &stateDefault
+			levels.InvitePtr = &invite
+		}
+		_, err = intent.SetPowerLevels(ctx, portal.MXID, levels)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to make archived room read-only")
+		}
+	}
+	portal.Delete(ctx)
+	portal.leaveWithPuppets(ctx)
+}
+
+func (portal *Portal) leaveWithPuppets(ctx context.Context) {
+	members, err := portal.MainIntent().JoinedMembers(ctx, portal.MXID)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to get portal members to remove ghosts")
+		return
+	}
+	for member := range members.Joined {
+		if member == portal.MainIntent().UserID {
+			continue
+		}
+		puppet := portal.bridge.GetPuppetByMXID(member)
+		if puppet == nil {
+			continue
+		}
+		_, err = puppet.DefaultIntent().LeaveRoom(ctx, portal.MXID)
+		if err != nil {
+			zerolog.Ctx(ctx).Err(err).Stringer("puppet_mxid", puppet.MXID).Msg("Failed to leave archived room as puppet")
+		}
+	}
+}
+
+func (br *WABridge) RunPortalCleanup(ctx context.Context) {
+	if !br.Config.Bridge.PortalCleanup.Enabled || time.Since(br.lastPortalCleanup) < 24*time.Hour {
+		return
+	}
+	br.lastPortalCleanup = time.Now()
+	log := zerolog.Ctx(ctx)
+	candidates, err := br.FindPortalsToCleanup(ctx)
+	if err != nil {
+		log.Err(err).Msg("Failed to find portals to clean up")
+		return
+	}
+	if len(candidates) > 0 {
+		log.Info().Int("count", len(candidates)).Msg("Cleaning up inactive portals")
+		br.CleanupPortals(ctx, candidates)
+	}
+}
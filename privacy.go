@@ -0,0 +1,52 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// IsTrackingAllowed returns false if the user has opted out of analytics and activity tracking.
+func (user *User) IsTrackingAllowed() bool {
+	return !user.AnalyticsOptOut
+}
+
+// SetAnalyticsOptOut changes whether analytics events, per-user metrics and activity tracking are disabled
+// for the user, and saves the setting in the database.
+func (user *User) SetAnalyticsOptOut(ctx context.Context, optOut bool) error {
+	user.AnalyticsOptOut = optOut
+	Analytics.SetOptOut(user.MXID, optOut)
+	if optOut {
+		// Clear the connection uptime gauge rather than leaving a stale value around
+		user.bridge.Metrics.TrackConnectedSince(user.MXID, time.Time{})
+	} else if connectedSince := user.GetConnectedSince(); !connectedSince.IsZero() {
+		user.bridge.Metrics.TrackConnectedSince(user.MXID, connectedSince)
+	}
+	return user.Update(ctx)
+}
+
+// isActivityTrackingDisabled checks if the given WhatsApp user is logged into the bridge and has opted out of
+// activity tracking. Only users that are already loaded are checked to avoid a database query for every message.
+func (br *WABridge) isActivityTrackingDisabled(jid types.JID) bool {
+	br.usersLock.Lock()
+	user, ok := br.usersByUsername[jid.User]
+	br.usersLock.Unlock()
+	return ok && !user.IsTrackingAllowed()
+}
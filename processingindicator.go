@@ -0,0 +1,147 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/element-hq/mautrix-go/event"
+	"github.com/element-hq/mautrix-go/id"
+)
+
+const (
+	ProcessingIndicatorNone   = "none"
+	ProcessingIndicatorTyping = "typing"
+	ProcessingIndicatorNotice = "notice"
+)
+
+const processingTypingTimeout = 30 * time.Second
+const processingNoticeEditInterval = 5 * time.Second
+
+// ProcessingIndicator tells users in a portal that the bridge is busy with something slow (like a large backfill
+// or media conversion), either by showing the bridge bot as typing or by sending a notice that is edited with progress.
+type ProcessingIndicator struct {
+	portal *Portal
+	mode   string
+	lock   sync.Mutex
+
+	stopTyping chan struct{}
+
+	noticeID   id.EventID
+	lastUpdate time.Time
+}
+
+// StartProcessingIndicator starts the processing indicator configured in bridge.processing_indicator.
+// The returned indicator is always non-nil, and Finish must be called when the processing is done.
+func (portal *Portal) StartProcessingIndicator(ctx context.Context, description string) *ProcessingIndicator {
+	pi := &ProcessingIndicator{
+		portal: portal,
+		mode:   portal.bridge.Config.Bridge.ProcessingIndicator.Mode,
+	}
+	if len(portal.MXID) == 0 {
+		pi.mode = ProcessingIndicatorNone
+	}
+	switch pi.mode {
+	case ProcessingIndicatorTyping:
+		if !portal.bridge.AS.StateStore.IsInRoom(ctx, portal.MXID, portal.bridge.Bot.UserID) {
+			pi.mode = ProcessingIndicatorNone
+			return pi
+		}
+		pi.stopTyping = make(chan struct{})
+		go pi.typingLoop(ctx)
+	case ProcessingIndicatorNotice:
+		resp, err := portal.sendMainIntentMessage(ctx, &event.MessageEventContent{
+			MsgType: event.MsgNotice,
+			Body:    description,
+		})
+		if err != nil {
+			zerolog.Ctx(ctx).Err(err).Msg("Failed to send processing notice")
+			pi.mode = ProcessingIndicatorNone
+		} else {
+			pi.noticeID = resp.EventID
+			pi.lastUpdate = time.Now()
+		}
+	}
+	return pi
+}
+
+func (pi *ProcessingIndicator) typingLoop(ctx context.Context) {
+	ticker := time.NewTicker(processingTypingTimeout / 2)
+	defer ticker.Stop()
+	for {
+		_, err := pi.portal.bridge.Bot.UserTyping(ctx, pi.portal.MXID, true, processingTypingTimeout)
+		if err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to send processing typing notification")
+		}
+		select {
+		case <-ticker.C:
+		case <-pi.stopTyping:
+			_, _ = pi.portal.bridge.Bot.UserTyping(ctx, pi.portal.MXID, false, 0)
+			return
+		}
+	}
+}
+
+func (pi *ProcessingIndicator) editNotice(ctx context.Context, text string) {
+	content := event.MessageEventContent{
+		MsgType: event.MsgNotice,
+		Body:    text,
+	}
+	contentCopy := content
+	content.NewContent = &contentCopy
+	content.RelatesTo = &event.RelatesTo{
+		EventID: pi.noticeID,
+		Type:    event.RelReplace,
+	}
+	_, err := pi.portal.sendMainIntentMessage(ctx, &content)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to edit processing notice")
+	}
+	pi.lastUpdate = time.Now()
+}
+
+// Update edits the progress notice. Updates are rate-limited, so this can be called after every step.
+func (pi *ProcessingIndicator) Update(ctx context.Context, progress string) {
+	pi.lock.Lock()
+	defer pi.lock.Unlock()
+	if pi.mode != ProcessingIndicatorNotice || time.Since(pi.lastUpdate) < processingNoticeEditInterval {
+		return
+	}
+	pi.editNotice(ctx, progress)
+}
+
+// Finish stops the typing indicator or edits the progress notice to the given final text.
+// If the result is empty, the progress notice is redacted instead.
+func (pi *ProcessingIndicator) Finish(ctx context.Context, result string) {
+	pi.lock.Lock()
+	defer pi.lock.Unlock()
+	switch pi.mode {
+	case ProcessingIndicatorTyping:
+		close(pi.stopTyping)
+	case ProcessingIndicatorNotice:
+		if result != "" {
+			pi.editNotice(ctx, result)
+		} else if _, err := pi.portal.MainIntent().RedactEvent(ctx, pi.portal.MXID, pi.noticeID); err != nil {
+			zerolog.Ctx(ctx).Err(err).Msg("Failed to redact processing notice")
+		}
+	}
+	pi.mode = ProcessingIndicatorNone
+}
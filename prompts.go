@@ -0,0 +1,241 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.mau.fi/util/variationselector"
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/element-hq/mautrix-go/appservice"
+	"github.com/element-hq/mautrix-go/event"
+	"github.com/element-hq/mautrix-go/format"
+	"github.com/element-hq/mautrix-go/id"
+
+	"github.com/element-hq/mautrix-whatsapp/database"
+)
+
+// PromptHandler handles the answer to a bridge prompt. accepted is true if the user reacted with ✅ and false if
+// they reacted with ❌. If the returned text is not empty, it's sent as a reply to the prompt.
+type PromptHandler func(ctx context.Context, user *User, accepted bool) (string, error)
+
+// PromptResolver finds the handler for a prompt, so that prompts can still be answered after the bridge is
+// restarted. It returns nil if the event is not a prompt it knows about.
+type PromptResolver func(ctx context.Context, user *User, promptID id.EventID) PromptHandler
+
+// PromptTimeout is how long stored prompts can be answered.
+const PromptTimeout = 24 * time.Hour
+
+const (
+	PromptKeepDisappearing database.PromptType = "keep_disappearing"
+	PromptJoinRequest      database.PromptType = "join_request"
+	PromptRetryMessage     database.PromptType = "retry_message"
+	PromptNumberChange     database.PromptType = "number_change"
+	PromptInitialSync      database.PromptType = "initial_sync"
+)
+
+type promptRegistry struct {
+	lock      sync.Mutex
+	resolvers []PromptResolver
+}
+
+func (pr *promptRegistry) resolve(ctx context.Context, user *User, promptID id.EventID) PromptHandler {
+	pr.lock.Lock()
+	resolvers := pr.resolvers
+	pr.lock.Unlock()
+	for _, resolver := range resolvers {
+		if handler := resolver(ctx, user, promptID); handler != nil {
+			return handler
+		}
+	}
+	return nil
+}
+
+// RegisterPromptResolver adds a resolver for prompts that are persisted outside the bridge_prompt table.
+func (br *WABridge) RegisterPromptResolver(resolver PromptResolver) {
+	br.prompts.lock.Lock()
+	br.prompts.resolvers = append(br.prompts.resolvers, resolver)
+	br.prompts.lock.Unlock()
+}
+
+// resolveStoredPrompt finds the handler for a prompt stored in the bridge_prompt table. Prompts can only be
+// answered once, so the prompt is deleted when it's found.
+func (br *WABridge) resolveStoredPrompt(ctx context.Context, user *User, promptID id.EventID) PromptHandler {
+	log := zerolog.Ctx(ctx).With().Stringer("prompt_event_id", promptID).Logger()
+	prompt, err := br.DB.Prompt.Get(ctx, promptID, user.MXID)
+	if err != nil {
+		log.Err(err).Msg("Failed to get prompt")
+		return nil
+	} else if prompt == nil {
+		return nil
+	} else if err = prompt.Delete(ctx); err != nil {
+		log.Err(err).Msg("Failed to delete answered prompt")
+		return nil
+	}
+	switch prompt.Type {
+	case PromptKeepDisappearing:
+		if portal := br.GetPortalByMXID(prompt.RoomID); portal != nil {
+			return portal.answerKeepDisappearingPrompt
+		}
+	case PromptJoinRequest:
+		requester, err := types.ParseJID(prompt.Data)
+		if portal := br.GetPortalByMXID(prompt.RoomID); portal != nil && err == nil {
+			return func(ctx context.Context, user *User, accepted bool) (string, error) {
+				return portal.answerJoinRequestPrompt(ctx, user, requester, accepted)
+			}
+		}
+	case PromptRetryMessage:
+		if portal := br.GetPortalByMXID(prompt.RoomID); portal != nil {
+			return func(ctx context.Context, user *User, accepted bool) (string, error) {
+				if !accepted {
+					return "", nil
+				}
+				return "", portal.RetryFailedMatrixMessage(ctx, user, id.EventID(prompt.Data))
+			}
+		}
+	case PromptNumberChange:
+		oldJID, err := types.ParseJID(prompt.Data)
+		if err == nil {
+			return func(ctx context.Context, user *User, accepted bool) (string, error) {
+				return user.answerNumberChangePrompt(ctx, oldJID, accepted)
+			}
+		}
+	case PromptInitialSync:
+		return func(ctx context.Context, user *User, accepted bool) (string, error) {
+			choice := InitialSyncSkip
+			if accepted {
+				choice = InitialSyncFull
+			}
+			return user.ChooseInitialSync(ctx, choice)
+		}
+	}
+	log.Warn().Str("prompt_type", string(prompt.Type)).Str("prompt_data", prompt.Data).Msg("Couldn't find handler for prompt")
+	return nil
+}
+
+func parsePromptReaction(key string) (accepted, ok bool) {
+	switch variationselector.Remove(key) {
+	case "✅", "👍":
+		return true, true
+	case "❌", "👎":
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+// sendPromptNotice sends a notice that the user can answer by reacting with ✅ or ❌. The caller is responsible
+// for storing the prompt so that a resolver can find it.
+func sendPromptNotice(ctx context.Context, intent *appservice.IntentAPI, roomID id.RoomID, text string) (id.EventID, error) {
+	content := format.RenderMarkdown(text, true, false)
+	content.MsgType = event.MsgNotice
+	resp, err := intent.SendMessageEvent(ctx, roomID, event.EventMessage, &content)
+	if err != nil {
+		return "", err
+	}
+	return resp.EventID, nil
+}
+
+// SendPrompt sends a notice that the user can answer by reacting with ✅ or ❌. The answer is handled based on
+// the prompt type, and data is passed to the handler of that type.
+func (user *User) SendPrompt(ctx context.Context, intent *appservice.IntentAPI, roomID id.RoomID, text string, promptType database.PromptType, data string) (id.EventID, error) {
+	evtID, err := sendPromptNotice(ctx, intent, roomID, text)
+	if err != nil {
+		return "", err
+	}
+	return evtID, user.RegisterPrompt(ctx, roomID, evtID, promptType, data)
+}
+
+// RegisterPrompt makes an event that was already sent answerable with reactions.
+func (user *User) RegisterPrompt(ctx context.Context, roomID id.RoomID, promptID id.EventID, promptType database.PromptType, data string) error {
+	err := user.bridge.DB.Prompt.DeleteExpired(ctx)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to delete expired prompts")
+	}
+	prompt := user.bridge.DB.Prompt.New()
+	prompt.EventID = promptID
+	prompt.RoomID = roomID
+	prompt.UserMXID = user.MXID
+	prompt.Type = promptType
+	prompt.Data = data
+	prompt.ExpiresAt = time.Now().Add(PromptTimeout)
+	err = prompt.Insert(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to save prompt: %w", err)
+	}
+	return nil
+}
+
+// HandlePromptReaction answers a bridge prompt if the given reaction is a response to one.
+// It returns true if the reaction was handled and shouldn't be processed any further.
+func (br *WABridge) HandlePromptReaction(ctx context.Context, user *User, evt *event.Event) bool {
+	content, ok := evt.Content.Parsed.(*event.ReactionEventContent)
+	if !ok {
+		return false
+	}
+	accepted, ok := parsePromptReaction(content.RelatesTo.Key)
+	if !ok {
+		return false
+	}
+	promptID := content.RelatesTo.EventID
+	handler := br.prompts.resolve(ctx, user, promptID)
+	if handler == nil {
+		return false
+	}
+	intent := br.Bot
+	if !br.AS.StateStore.IsInRoom(ctx, evt.RoomID, br.Bot.UserID) {
+		// Bridge bot isn't present in unencrypted DMs
+		if portal := br.GetPortalByMXID(evt.RoomID); portal != nil {
+			intent = portal.MainIntent()
+		}
+	}
+	log := zerolog.Ctx(ctx).With().
+		Stringer("prompt_event_id", promptID).
+		Bool("accepted", accepted).
+		Logger()
+	log.Debug().Msg("Handling prompt response")
+	reply, err := handler(log.WithContext(ctx), user, accepted)
+	if err != nil {
+		log.Err(err).Msg("Failed to handle prompt response")
+		reply = fmt.Sprintf("Failed to handle response: %v", err)
+	}
+	if reply != "" {
+		replyContent := format.RenderMarkdown(reply, true, false)
+		replyContent.MsgType = event.MsgNotice
+		replyContent.RelatesTo = (&event.RelatesTo{}).SetReplyTo(promptID)
+		_, err = intent.SendMessageEvent(ctx, evt.RoomID, event.EventMessage, &replyContent)
+		if err != nil {
+			log.Err(err).Msg("Failed to send prompt response reply")
+		}
+	}
+	return true
+}
+
+// HandleManagementRoomReaction handles reactions to prompts in management rooms. Reactions in portal rooms are
+// handled by the portal.
+func (br *WABridge) HandleManagementRoomReaction(ctx context.Context, evt *event.Event) {
+	user := br.GetUserByMXIDIfExists(evt.Sender)
+	if user == nil || len(user.ManagementRoom) == 0 || evt.RoomID != user.ManagementRoom {
+		return
+	}
+	br.HandlePromptReaction(user.zlog.WithContext(ctx), user, evt)
+}
@@ -39,6 +39,8 @@ import (
 
 	"github.com/element-hq/mautrix-go/bridge/status"
 	"github.com/element-hq/mautrix-go/id"
+
+	"github.com/element-hq/mautrix-whatsapp/database"
 )
 
 type ProvisioningAPI struct {
@@ -59,6 +61,10 @@ func (prov *ProvisioningAPI) Init() {
 	r.HandleFunc("/v1/disconnect", prov.Disconnect).Methods(http.MethodPost)
 	r.HandleFunc("/v1/reconnect", prov.Reconnect).Methods(http.MethodPost)
 	r.HandleFunc("/v1/debug/appstate/{name}", prov.SyncAppState).Methods(http.MethodPost)
+	r.HandleFunc("/v1/companions", prov.ListCompanions).Methods(http.MethodGet)
+	r.HandleFunc("/v1/companions/{jid}/unlink", prov.UnlinkCompanion).Methods(http.MethodPost)
+	r.HandleFunc("/v1/management_room", prov.GetManagementRoom).Methods(http.MethodGet)
+	r.HandleFunc("/v1/management_room", prov.SetManagementRoom).Methods(http.MethodPut)
 	r.HandleFunc("/v1/contacts", prov.ListContacts).Methods(http.MethodGet)
 	r.HandleFunc("/v1/groups", prov.ListGroups).Methods(http.MethodGet, http.MethodPost)
 	r.HandleFunc("/v1/resolve_identifier/{number}", prov.ResolveIdentifier).Methods(http.MethodGet)
@@ -68,6 +74,22 @@ func (prov *ProvisioningAPI) Init() {
 	r.HandleFunc("/v1/group/open/{groupID}", prov.OpenGroup).Methods(http.MethodPost)
 	r.HandleFunc("/v1/group/resolve/{inviteCode}", prov.ResolveGroupInvite).Methods(http.MethodPost)
 	r.HandleFunc("/v1/group/join/{inviteCode}", prov.JoinGroup).Methods(http.MethodPost)
+	r.HandleFunc("/v1/portal/{roomID}/relay", prov.GetPortalRelay).Methods(http.MethodGet)
+	r.HandleFunc("/v1/portal/{roomID}/relay", prov.SetPortalRelay).Methods(http.MethodPut)
+	r.HandleFunc("/v1/portal/{roomID}/relay", prov.UnsetPortalRelay).Methods(http.MethodDelete)
+	r.HandleFunc("/v1/delivery_settings", prov.GetDeliverySettings).Methods(http.MethodGet)
+	r.HandleFunc("/v1/delivery_settings", prov.SetDeliverySettings).Methods(http.MethodPut)
+	r.HandleFunc("/v1/chat_filters", prov.GetChatFilters).Methods(http.MethodGet)
+	r.HandleFunc("/v1/chat_filters", prov.SetChatFilter).Methods(http.MethodPut)
+	r.HandleFunc("/v1/encryption/status", prov.GetEncryptionStatus).Methods(http.MethodGet)
+	r.HandleFunc("/v1/encryption/cross_signing/bootstrap", prov.BootstrapCrossSigning).Methods(http.MethodPost)
+	r.HandleFunc("/v1/encryption/recovery_key/restore", prov.RestoreFromRecoveryKey).Methods(http.MethodPost)
+	r.HandleFunc("/v1/encryption/portals", prov.GetPortalEncryptionHealth).Methods(http.MethodGet)
+	r.HandleFunc("/v1/bulk/users", prov.BulkCreateUsers).Methods(http.MethodPost)
+	r.HandleFunc("/v1/bulk/login", prov.BulkLogin).Methods(http.MethodPost)
+	r.HandleFunc("/v1/bulk/login_state", prov.BulkLoginState).Methods(http.MethodPost)
+	r.HandleFunc("/v1/bulk/logout", prov.BulkLogout).Methods(http.MethodPost)
+	r.HandleFunc("/v1/bulk/jobs/{jobID}", prov.GetBulkJob).Methods(http.MethodGet)
 	prov.bridge.AS.Router.HandleFunc("/_matrix/app/com.beeper.asmux/ping", prov.BridgeStatePing).Methods(http.MethodPost)
 	prov.bridge.AS.Router.HandleFunc("/_matrix/app/com.beeper.bridge_state", prov.BridgeStatePing).Methods(http.MethodPost)
 
@@ -195,13 +217,8 @@ func (prov *ProvisioningAPI) SyncAppState(w http.ResponseWriter, r *http.Request
 		})
 		return
 	}
-	var name appstate.WAPatchName
-	for _, existingName := range appstate.AllPatchNames {
-		if nameStr == string(existingName) {
-			name = existingName
-		}
-	}
-	if len(name) == 0 {
+	name, ok := parseAppStatePatchName(nameStr)
+	if !ok {
 		jsonResponse(w, http.StatusBadRequest, Error{
 			Error:   fmt.Sprintf("'%s' is not a valid app state patch name", nameStr),
 			ErrCode: "invalid-name-param",
@@ -218,6 +235,15 @@ func (prov *ProvisioningAPI) SyncAppState(w http.ResponseWriter, r *http.Request
 	}
 }
 
+func parseAppStatePatchName(nameStr string) (appstate.WAPatchName, bool) {
+	for _, existingName := range appstate.AllPatchNames {
+		if nameStr == string(existingName) {
+			return existingName, true
+		}
+	}
+	return "", false
+}
+
 func (prov *ProvisioningAPI) ListContacts(w http.ResponseWriter, r *http.Request) {
 	if user := r.Context().Value("user").(*User); user.Session == nil {
 		jsonResponse(w, http.StatusBadRequest, Error{
@@ -540,6 +566,212 @@ func (prov *ProvisioningAPI) JoinGroup(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type PortalRelayInfo struct {
+	RelayUserID    id.UserID         `json:"relay_user_id,omitempty"`
+	MessageFormats map[string]string `json:"message_formats,omitempty"`
+}
+
+func (prov *ProvisioningAPI) getRelayPortal(w http.ResponseWriter, r *http.Request) (*Portal, *User) {
+	user := r.Context().Value("user").(*User)
+	portal := prov.bridge.GetPortalByMXID(id.RoomID(mux.Vars(r)["roomID"]))
+	if !prov.bridge.Config.Bridge.Relay.Enabled {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   "Relay mode is not enabled on this instance of the bridge",
+			ErrCode: "relay disabled",
+		})
+	} else if prov.bridge.Config.Bridge.Relay.AdminOnly && !user.Admin {
+		jsonResponse(w, http.StatusForbidden, Error{
+			Error:   "Only bridge admins are allowed to manage relay mode on this instance of the bridge",
+			ErrCode: "M_FORBIDDEN",
+		})
+	} else if portal == nil || (!user.Admin && !prov.bridge.AS.StateStore.IsInRoom(r.Context(), portal.MXID, user.MXID)) {
+		jsonResponse(w, http.StatusNotFound, Error{
+			Error:   "Portal not found",
+			ErrCode: "M_NOT_FOUND",
+		})
+	} else {
+		return portal, user
+	}
+	return nil, nil
+}
+
+func (prov *ProvisioningAPI) GetPortalRelay(w http.ResponseWriter, r *http.Request) {
+	portal, _ := prov.getRelayPortal(w, r)
+	if portal == nil {
+		return
+	}
+	jsonResponse(w, http.StatusOK, PortalRelayInfo{
+		RelayUserID:    portal.RelayUserID,
+		MessageFormats: portal.RelayFormats,
+	})
+}
+
+func (prov *ProvisioningAPI) SetPortalRelay(w http.ResponseWriter, r *http.Request) {
+	portal, user := prov.getRelayPortal(w, r)
+	if portal == nil {
+		return
+	}
+	var req PortalRelayInfo
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   "Failed to parse request JSON",
+			ErrCode: "bad json",
+		})
+		return
+	}
+	relayUser := user
+	if req.RelayUserID != "" && req.RelayUserID != user.MXID {
+		if !user.Admin {
+			jsonResponse(w, http.StatusForbidden, Error{
+				Error:   "Only bridge admins are allowed to set other users as the relay",
+				ErrCode: "M_FORBIDDEN",
+			})
+			return
+		}
+		relayUser = prov.bridge.GetUserByMXIDIfExists(req.RelayUserID)
+	}
+	if relayUser == nil || !relayUser.IsLoggedIn() {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   "Relay user is not logged into WhatsApp",
+			ErrCode: "no session",
+		})
+		return
+	}
+	if req.MessageFormats != nil {
+		for msgType, format := range req.MessageFormats {
+			if err := portal.SetRelayFormat(r.Context(), msgType, format); err != nil {
+				jsonResponse(w, http.StatusBadRequest, Error{
+					Error:   fmt.Sprintf("Invalid message format: %v", err),
+					ErrCode: "invalid format",
+				})
+				return
+			}
+		}
+	}
+	if err := portal.SetRelayUser(r.Context(), relayUser); err != nil {
+		hlog.FromRequest(r).Err(err).Msg("Failed to save portal after setting relay user")
+		jsonResponse(w, http.StatusInternalServerError, Error{
+			Error:   "Failed to save relay user",
+			ErrCode: "M_UNKNOWN",
+		})
+		return
+	}
+	jsonResponse(w, http.StatusOK, PortalRelayInfo{
+		RelayUserID:    portal.RelayUserID,
+		MessageFormats: portal.RelayFormats,
+	})
+}
+
+func (prov *ProvisioningAPI) UnsetPortalRelay(w http.ResponseWriter, r *http.Request) {
+	portal, _ := prov.getRelayPortal(w, r)
+	if portal == nil {
+		return
+	}
+	if err := portal.SetRelayUser(r.Context(), nil); err != nil {
+		hlog.FromRequest(r).Err(err).Msg("Failed to save portal after clearing relay user")
+		jsonResponse(w, http.StatusInternalServerError, Error{
+			Error:   "Failed to clear relay user",
+			ErrCode: "M_UNKNOWN",
+		})
+		return
+	}
+	jsonResponse(w, http.StatusOK, Response{true, "Relay mode disabled"})
+}
+
+func (prov *ProvisioningAPI) GetDeliverySettings(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(*User)
+	jsonResponse(w, http.StatusOK, user.GetDeliverySettings())
+}
+
+func (prov *ProvisioningAPI) SetDeliverySettings(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(*User)
+	var req DeliverySettings
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   "Failed to parse request JSON",
+			ErrCode: "bad json",
+		})
+		return
+	}
+	for name := range req {
+		if _, ok := getDeliverySetting(name); !ok {
+			jsonResponse(w, http.StatusBadRequest, Error{
+				Error:   fmt.Sprintf("Unknown delivery setting %s", name),
+				ErrCode: "unknown setting",
+			})
+			return
+		}
+	}
+	for name, enabled := range req {
+		flag, _ := getDeliverySetting(name)
+		user.SetDeliveryEnabled(flag, enabled)
+	}
+	if err := user.Update(r.Context()); err != nil {
+		hlog.FromRequest(r).Err(err).Msg("Failed to save delivery settings")
+		jsonResponse(w, http.StatusInternalServerError, Error{
+			Error:   "Failed to save delivery settings",
+			ErrCode: "database error",
+		})
+		return
+	}
+	jsonResponse(w, http.StatusOK, user.GetDeliverySettings())
+}
+
+type ChatFiltersResponse struct {
+	BridgeOnly []types.JID `json:"bridge_only"`
+	Ignored    []types.JID `json:"ignored"`
+}
+
+func (prov *ProvisioningAPI) GetChatFilters(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(*User)
+	allowed, denied := user.GetChatFilters(r.Context())
+	jsonResponse(w, http.StatusOK, &ChatFiltersResponse{BridgeOnly: allowed, Ignored: denied})
+}
+
+type ReqSetChatFilter struct {
+	// Chat is a JID, phone number or group invite link.
+	Chat string `json:"chat"`
+	// Action is allow to only bridge this and other allowed chats, deny to ignore the chat,
+	// or empty to remove the chat from the filters.
+	Action database.ChatFilterAction `json:"action"`
+}
+
+func (prov *ProvisioningAPI) SetChatFilter(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value("user").(*User)
+	var req ReqSetChatFilter
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   "Failed to parse request JSON",
+			ErrCode: "bad json",
+		})
+		return
+	} else if req.Action != "" && req.Action != database.ChatFilterAllow && req.Action != database.ChatFilterDeny {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   fmt.Sprintf("Unknown filter action %s", req.Action),
+			ErrCode: "unknown action",
+		})
+		return
+	}
+	jid, err := user.resolveChatFilterTarget(req.Chat)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   err.Error(),
+			ErrCode: "invalid chat",
+		})
+		return
+	}
+	if err = user.SetChatFilter(r.Context(), jid, req.Action); err != nil {
+		hlog.FromRequest(r).Err(err).Msg("Failed to save chat filter")
+		jsonResponse(w, http.StatusInternalServerError, Error{
+			Error:   "Failed to save chat filter",
+			ErrCode: "database error",
+		})
+		return
+	}
+	allowed, denied := user.GetChatFilters(r.Context())
+	jsonResponse(w, http.StatusOK, &ChatFiltersResponse{BridgeOnly: allowed, Ignored: denied})
+}
+
 func (prov *ProvisioningAPI) Ping(w http.ResponseWriter, r *http.Request) {
 	user := r.Context().Value("user").(*User)
 	wa := map[string]interface{}{
@@ -579,33 +811,40 @@ func jsonResponse(w http.ResponseWriter, status int, response interface{}) {
 
 func (prov *ProvisioningAPI) Logout(w http.ResponseWriter, r *http.Request) {
 	user := r.Context().Value("user").(*User)
+	force := strings.ToLower(r.URL.Query().Get("force")) != "false"
+	if status, errResp := prov.logoutUser(r.Context(), user, force); errResp != nil {
+		jsonResponse(w, status, errResp)
+	} else {
+		jsonResponse(w, http.StatusOK, Response{true, "Logged out successfully."})
+	}
+}
+
+// logoutUser logs the user out of WhatsApp and deletes the session. If an error is returned,
+// the int is the HTTP status code that should be used in the response.
+func (prov *ProvisioningAPI) logoutUser(ctx context.Context, user *User, force bool) (int, *Error) {
 	if user.Session == nil {
-		jsonResponse(w, http.StatusOK, Error{
+		return http.StatusOK, &Error{
 			Error:   "You're not logged in",
 			ErrCode: "not logged in",
-		})
-		return
+		}
 	}
 
-	force := strings.ToLower(r.URL.Query().Get("force")) != "false"
-
 	if user.Client == nil {
 		if !force {
-			jsonResponse(w, http.StatusNotFound, Error{
+			return http.StatusNotFound, &Error{
 				Error:   "You're not connected",
 				ErrCode: "not connected",
-			})
+			}
 		}
 	} else {
 		err := user.Client.Logout()
 		if err != nil {
-			hlog.FromRequest(r).Err(err).Msg("Unknown error while logging out")
+			zerolog.Ctx(ctx).Err(err).Msg("Unknown error while logging out")
 			if !force {
-				jsonResponse(w, http.StatusInternalServerError, Error{
+				return http.StatusInternalServerError, &Error{
 					Error:   fmt.Sprintf("Unknown error while logging out: %v", err),
 					ErrCode: err.Error(),
-				})
-				return
+				}
 			}
 		} else {
 			user.Session = nil
@@ -615,8 +854,9 @@ func (prov *ProvisioningAPI) Logout(w http.ResponseWriter, r *http.Request) {
 
 	user.bridge.Metrics.TrackConnectionState(user.JID, false)
 	user.removeFromJIDMap(status.BridgeState{StateEvent: status.StateLoggedOut})
-	user.DeleteSession(r.Context())
-	jsonResponse(w, http.StatusOK, Response{true, "Logged out successfully."})
+	user.DeleteSession(ctx)
+	Analytics.Track(user.MXID, AnalyticsLogout, map[string]interface{}{"reason": "user"})
+	return http.StatusOK, nil
 }
 
 var upgrader = websocket.Upgrader{
@@ -708,7 +948,8 @@ func (prov *ProvisioningAPI) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Debug().Msg("Started login via provisioning API")
-	Analytics.Track(user.MXID, "$login_start")
+	loginEvents := newLoginAnalytics(user.MXID, AnalyticsSourceProvisioning, phoneNum)
+	loginEvents.Start()
 
 	for {
 		select {
@@ -717,7 +958,7 @@ func (prov *ProvisioningAPI) Login(w http.ResponseWriter, r *http.Request) {
 			case whatsmeow.QRChannelSuccess.Event:
 				jid := user.Client.Store.ID
 				log.Debug().Stringer("jid", jid).Msg("Successful login via provisioning API")
-				Analytics.Track(user.MXID, "$login_success")
+				loginEvents.Success(user.Client.Store.Platform)
 				_ = c.WriteJSON(map[string]interface{}{
 					"success":  true,
 					"jid":      jid,
@@ -727,15 +968,20 @@ func (prov *ProvisioningAPI) Login(w http.ResponseWriter, r *http.Request) {
 			case whatsmeow.QRChannelTimeout.Event:
 				log.Debug().Msg("Login via provisioning API timed out")
 				errCode := "login timed out"
-				Analytics.Track(user.MXID, "$login_failure", map[string]interface{}{"error": errCode})
-				_ = c.WriteJSON(Error{
-					Error:   "QR code scan timed out. Please try again.",
-					ErrCode: errCode,
+				loginEvents.Failure(errCode)
+				// WhatsApp doesn't tell the bridge if the phone refused to link because it already has the maximum
+				// number of linked devices, the scan just times out. Include the bridge's unused devices of the user,
+				// so that the client can offer to unlink them.
+				_ = c.WriteJSON(map[string]interface{}{
+					"success":    false,
+					"error":      "QR code scan timed out. Please try again.",
+					"errcode":    errCode,
+					"companions": prov.getUnusedCompanions(user),
 				})
 			case whatsmeow.QRChannelErrUnexpectedEvent.Event:
 				log.Debug().Msg("Login via provisioning API failed due to unexpected event")
 				errCode := "unexpected event"
-				Analytics.Track(user.MXID, "$login_failure", map[string]interface{}{"error": errCode})
+				loginEvents.Failure(errCode)
 				_ = c.WriteJSON(Error{
 					Error:   "Got unexpected event while waiting for QRs, perhaps you're already logged in?",
 					ErrCode: errCode,
@@ -743,14 +989,14 @@ func (prov *ProvisioningAPI) Login(w http.ResponseWriter, r *http.Request) {
 			case whatsmeow.QRChannelClientOutdated.Event:
 				log.Debug().Msg("Login via provisioning API failed due to outdated client")
 				errCode := "bridge outdated"
-				Analytics.Track(user.MXID, "$login_failure", map[string]interface{}{"error": errCode})
+				loginEvents.Failure(errCode)
 				_ = c.WriteJSON(Error{
 					Error:   "Got client outdated error while waiting for QRs. The bridge must be updated to continue.",
 					ErrCode: errCode,
 				})
 			case whatsmeow.QRChannelScannedWithoutMultidevice.Event:
 				errCode := "multidevice not enabled"
-				Analytics.Track(user.MXID, "$login_failure", map[string]interface{}{"error": errCode})
+				loginEvents.Failure(errCode)
 				_ = c.WriteJSON(Error{
 					Error:   "Please enable the WhatsApp multidevice beta and scan the QR code again.",
 					ErrCode: errCode,
@@ -758,13 +1004,13 @@ func (prov *ProvisioningAPI) Login(w http.ResponseWriter, r *http.Request) {
 				continue
 			case "error":
 				errCode := "fatal error"
-				Analytics.Track(user.MXID, "$login_failure", map[string]interface{}{"error": errCode})
+				loginEvents.Failure(errCode)
 				_ = c.WriteJSON(Error{
 					Error:   "Fatal error while logging in",
 					ErrCode: errCode,
 				})
 			case "code":
-				Analytics.Track(user.MXID, "$qrcode_retrieved")
+				loginEvents.QRCodeRetrieved()
 				_ = c.WriteJSON(map[string]interface{}{
 					"code":    evt.Code,
 					"timeout": int(evt.Timeout.Seconds()),
@@ -0,0 +1,387 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+	"go.mau.fi/util/random"
+	"go.mau.fi/whatsmeow"
+
+	"github.com/element-hq/mautrix-go/id"
+)
+
+const (
+	bulkJobParallelism = 8
+	bulkJobRetention   = 1 * time.Hour
+	bulkMaxUsers       = 1000
+	bulkLoginTimeout   = 160 * time.Second
+	// bulkFirstQRTimeout is how long a bulk login waits for the first QR code before the next user is started.
+	bulkFirstQRTimeout = 20 * time.Second
+)
+
+type BulkJobStatus string
+
+const (
+	BulkJobRunning  BulkJobStatus = "running"
+	BulkJobComplete BulkJobStatus = "complete"
+)
+
+// BulkUserResult is the result of a bulk operation for a single user.
+type BulkUserResult struct {
+	// Pending is set while a login is waiting for the user to scan the QR code or enter the pairing code.
+	Pending     bool   `json:"pending,omitempty"`
+	Success     bool   `json:"success"`
+	Error       string `json:"error,omitempty"`
+	ErrCode     string `json:"errcode,omitempty"`
+	PairingCode string `json:"pairing_code,omitempty"`
+	QRCode      string `json:"qr_code,omitempty"`
+}
+
+// BulkJob is an asynchronous provisioning operation over many users. Hosting platforms poll
+// GET /v1/bulk/jobs/{jobID} until the status is complete.
+type BulkJob struct {
+	ID          string                        `json:"id"`
+	Type        string                        `json:"type"`
+	Status      BulkJobStatus                 `json:"status"`
+	Total       int                           `json:"total"`
+	Done        int                           `json:"done"`
+	Failed      int                           `json:"failed"`
+	Results     map[id.UserID]*BulkUserResult `json:"results"`
+	CreatedAt   time.Time                     `json:"created_at"`
+	CompletedAt *time.Time                    `json:"completed_at,omitempty"`
+
+	lock sync.Mutex
+	// async tracks results that are still being updated after the user's bulk function returned.
+	async sync.WaitGroup
+}
+
+var (
+	bulkJobs     = make(map[string]*BulkJob)
+	bulkJobsLock sync.Mutex
+)
+
+func (job *BulkJob) setResult(userID id.UserID, result *BulkUserResult) {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	job.Results[userID] = result
+	job.Done++
+	if !result.Success {
+		job.Failed++
+	}
+}
+
+// setPending stores an intermediate result that is updated with updatePending until setResult is called.
+func (job *BulkJob) setPending(userID id.UserID, result *BulkUserResult) {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	result.Pending = true
+	job.Results[userID] = result
+}
+
+func (job *BulkJob) updatePending(userID id.UserID, fn func(result *BulkUserResult)) {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	if result, ok := job.Results[userID]; ok && result.Pending {
+		fn(result)
+	}
+}
+
+func (job *BulkJob) MarshalJSON() ([]byte, error) {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	type bulkJobAlias BulkJob
+	return json.Marshal((*bulkJobAlias)(job))
+}
+
+// startBulkJob runs fn for every user in the background with limited parallelism and returns the job immediately.
+// If fn returns nil, it must have called job.async.Add and will set the result later.
+func (prov *ProvisioningAPI) startBulkJob(ctx context.Context, jobType string, userIDs []id.UserID, fn func(ctx context.Context, job *BulkJob, user *User, index int) *BulkUserResult) *BulkJob {
+	job := &BulkJob{
+		ID:        random.String(24),
+		Type:      jobType,
+		Status:    BulkJobRunning,
+		Total:     len(userIDs),
+		Results:   make(map[id.UserID]*BulkUserResult, len(userIDs)),
+		CreatedAt: time.Now(),
+	}
+	bulkJobsLock.Lock()
+	for jobID, oldJob := range bulkJobs {
+		oldJob.lock.Lock()
+		expired := oldJob.CompletedAt != nil && time.Since(*oldJob.CompletedAt) > bulkJobRetention
+		oldJob.lock.Unlock()
+		if expired {
+			delete(bulkJobs, jobID)
+		}
+	}
+	bulkJobs[job.ID] = job
+	bulkJobsLock.Unlock()
+
+	log := zerolog.Ctx(ctx).With().Str("bulk_job_id", job.ID).Str("bulk_job_type", jobType).Logger()
+	ctx = log.WithContext(context.Background())
+	log.Info().Int("user_count", len(userIDs)).Msg("Starting bulk provisioning job")
+	go func() {
+		var wg sync.WaitGroup
+		sema := make(chan struct{}, bulkJobParallelism)
+		for i, userID := range userIDs {
+			wg.Add(1)
+			sema <- struct{}{}
+			go func(i int, userID id.UserID) {
+				defer func() {
+					<-sema
+					wg.Done()
+				}()
+				user := prov.bridge.GetUserByMXID(userID)
+				if user == nil {
+					job.setResult(userID, &BulkUserResult{Error: "Invalid user ID", ErrCode: "invalid user"})
+					return
+				}
+				if result := fn(ctx, job, user, i); result != nil {
+					job.setResult(userID, result)
+				}
+			}(i, userID)
+		}
+		wg.Wait()
+		job.async.Wait()
+		job.lock.Lock()
+		job.Status = BulkJobComplete
+		now := time.Now()
+		job.CompletedAt = &now
+		job.lock.Unlock()
+		log.Info().Int("failed", job.Failed).Msg("Bulk provisioning job completed")
+	}()
+	return job
+}
+
+type ReqBulkUsers struct {
+	UserIDs []id.UserID `json:"user_ids"`
+}
+
+func (prov *ProvisioningAPI) parseBulkRequest(w http.ResponseWriter, r *http.Request, req any, userIDs func() []id.UserID) bool {
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   "Failed to parse request JSON",
+			ErrCode: "bad json",
+		})
+		return false
+	} else if count := len(userIDs()); count == 0 || count > bulkMaxUsers {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   fmt.Sprintf("Bulk requests must contain between 1 and %d users", bulkMaxUsers),
+			ErrCode: "bad user count",
+		})
+		return false
+	}
+	return true
+}
+
+func (prov *ProvisioningAPI) BulkCreateUsers(w http.ResponseWriter, r *http.Request) {
+	var req ReqBulkUsers
+	if !prov.parseBulkRequest(w, r, &req, func() []id.UserID { return req.UserIDs }) {
+		return
+	}
+	job := prov.startBulkJob(r.Context(), "create_users", req.UserIDs, func(ctx context.Context, _ *BulkJob, user *User, _ int) *BulkUserResult {
+		if !user.Whitelisted {
+			return &BulkUserResult{Error: "User is not allowed to use the bridge", ErrCode: "not whitelisted"}
+		}
+		return &BulkUserResult{Success: true}
+	})
+	jsonResponse(w, http.StatusAccepted, job)
+}
+
+type ReqBulkLoginEntry struct {
+	UserID      id.UserID `json:"user_id"`
+	PhoneNumber string    `json:"phone_number,omitempty"`
+}
+
+type ReqBulkLogin struct {
+	Logins []ReqBulkLoginEntry `json:"logins"`
+}
+
+// BulkLogin starts logins for many users. Users with a phone number get a pairing code,
+// the others get a QR code. Results stay pending while the logins are running: QR codes are
+// refreshed in the job as WhatsApp rotates them, and a result only succeeds once pairing is
+// complete. The job is complete when every login has succeeded, failed or timed out.
+func (prov *ProvisioningAPI) BulkLogin(w http.ResponseWriter, r *http.Request) {
+	var req ReqBulkLogin
+	userIDs := func() []id.UserID {
+		ids := make([]id.UserID, len(req.Logins))
+		for i, login := range req.Logins {
+			ids[i] = login.UserID
+		}
+		return ids
+	}
+	if !prov.parseBulkRequest(w, r, &req, userIDs) {
+		return
+	}
+	job := prov.startBulkJob(r.Context(), "login", userIDs(), func(ctx context.Context, job *BulkJob, user *User, i int) *BulkUserResult {
+		return prov.startBulkLogin(ctx, job, user, req.Logins[i].PhoneNumber)
+	})
+	jsonResponse(w, http.StatusAccepted, job)
+}
+
+func (prov *ProvisioningAPI) startBulkLogin(ctx context.Context, job *BulkJob, user *User, phoneNumber string) *BulkUserResult {
+	log := zerolog.Ctx(ctx).With().Stringer("user_id", user.MXID).Logger()
+	if !user.Whitelisted {
+		return &BulkUserResult{Error: "User is not allowed to use the bridge", ErrCode: "not whitelisted"}
+	}
+	loginCtx, cancel := context.WithTimeout(context.Background(), bulkLoginTimeout)
+	qrChan, err := user.Login(loginCtx)
+	if err != nil {
+		cancel()
+		if errors.Is(err, ErrAlreadyLoggedIn) {
+			go user.Connect()
+			return &BulkUserResult{Error: "User is already logged into WhatsApp", ErrCode: "already logged in"}
+		}
+		log.Err(err).Msg("Failed to start bulk login")
+		return &BulkUserResult{Error: "Failed to connect to WhatsApp", ErrCode: "connection error"}
+	}
+	result := &BulkUserResult{}
+	loginEvents := newLoginAnalytics(user.MXID, AnalyticsSourceBulk, phoneNumber)
+	if phoneNumber != "" {
+		result.PairingCode, err = user.Client.PairPhone(phoneNumber, true, whatsmeow.PairClientChrome, "Chrome (Linux)")
+		if err != nil {
+			cancel()
+			log.Err(err).Msg("Failed to request pairing code for bulk login")
+			go user.DeleteConnection()
+			return &BulkUserResult{Error: "Failed to request pairing code", ErrCode: "code error"}
+		}
+	} else {
+		select {
+		case evt, ok := <-qrChan:
+			if !ok || evt.Event != "code" {
+				cancel()
+				return prov.finishBulkLogin(log, user, loginEvents, result, evt, ok)
+			}
+			result.QRCode = evt.Code
+		case <-time.After(bulkFirstQRTimeout):
+			cancel()
+			return &BulkUserResult{Error: "Didn't get a QR code from WhatsApp", ErrCode: "login timed out"}
+		}
+	}
+	loginEvents.Start()
+	job.setPending(user.MXID, result)
+	job.async.Add(1)
+	go func() {
+		defer job.async.Done()
+		defer cancel()
+		for evt := range qrChan {
+			if evt.Event == "code" {
+				if phoneNumber == "" {
+					job.updatePending(user.MXID, func(result *BulkUserResult) {
+						result.QRCode = evt.Code
+					})
+				}
+				continue
+			}
+			job.setResult(user.MXID, prov.finishBulkLogin(log, user, loginEvents, result, evt, true))
+			return
+		}
+		job.setResult(user.MXID, prov.finishBulkLogin(log, user, loginEvents, result, whatsmeow.QRChannelItem{}, false))
+	}()
+	return nil
+}
+
+// finishBulkLogin converts the final event of a bulk login QR channel into the user's result.
+func (prov *ProvisioningAPI) finishBulkLogin(log zerolog.Logger, user *User, loginEvents *loginAnalytics, result *BulkUserResult, evt whatsmeow.QRChannelItem, ok bool) *BulkUserResult {
+	if ok && evt.Event == whatsmeow.QRChannelSuccess.Event {
+		log.Info().Msg("Bulk login succeeded")
+		loginEvents.Success(user.Client.Store.Platform)
+		return &BulkUserResult{Success: true, PairingCode: result.PairingCode}
+	}
+	event := evt.Event
+	if !ok {
+		event = "channel closed"
+	}
+	log.Debug().Str("qr_event", event).Msg("Bulk login ended")
+	loginEvents.Failure(event)
+	if evt.Event == whatsmeow.QRChannelTimeout.Event || !ok {
+		return &BulkUserResult{Error: "Login timed out", ErrCode: "login timed out"}
+	}
+	return &BulkUserResult{Error: fmt.Sprintf("Login failed: %s", event), ErrCode: "login failed"}
+}
+
+type BulkLoginState struct {
+	LoggedIn  bool   `json:"logged_in"`
+	Connected bool   `json:"connected"`
+	Phone     string `json:"phone,omitempty"`
+}
+
+// BulkLoginState returns the login state of many users synchronously, as it's only an in-memory lookup.
+func (prov *ProvisioningAPI) BulkLoginState(w http.ResponseWriter, r *http.Request) {
+	var req ReqBulkUsers
+	if !prov.parseBulkRequest(w, r, &req, func() []id.UserID { return req.UserIDs }) {
+		return
+	}
+	resp := make(map[id.UserID]*BulkLoginState, len(req.UserIDs))
+	for _, userID := range req.UserIDs {
+		user := prov.bridge.GetUserByMXIDIfExists(userID)
+		if user == nil {
+			resp[userID] = &BulkLoginState{}
+			continue
+		}
+		state := &BulkLoginState{
+			LoggedIn:  user.IsLoggedIn(),
+			Connected: user.Client != nil && user.Client.IsConnected(),
+		}
+		if !user.JID.IsEmpty() {
+			state.Phone = "+" + user.JID.User
+		}
+		resp[userID] = state
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
+
+func (prov *ProvisioningAPI) BulkLogout(w http.ResponseWriter, r *http.Request) {
+	var req ReqBulkUsers
+	if !prov.parseBulkRequest(w, r, &req, func() []id.UserID { return req.UserIDs }) {
+		return
+	}
+	force := strings.ToLower(r.URL.Query().Get("force")) != "false"
+	job := prov.startBulkJob(r.Context(), "logout", req.UserIDs, func(ctx context.Context, _ *BulkJob, user *User, _ int) *BulkUserResult {
+		if _, errResp := prov.logoutUser(ctx, user, force); errResp != nil {
+			return &BulkUserResult{Error: errResp.Error, ErrCode: errResp.ErrCode}
+		}
+		return &BulkUserResult{Success: true}
+	})
+	jsonResponse(w, http.StatusAccepted, job)
+}
+
+func (prov *ProvisioningAPI) GetBulkJob(w http.ResponseWriter, r *http.Request) {
+	jobID := mux.Vars(r)["jobID"]
+	bulkJobsLock.Lock()
+	job, ok := bulkJobs[jobID]
+	bulkJobsLock.Unlock()
+	if !ok {
+		hlog.FromRequest(r).Debug().Str("bulk_job_id", jobID).Msg("Bulk job not found")
+		jsonResponse(w, http.StatusNotFound, Error{
+			Error:   "Bulk job not found",
+			ErrCode: "M_NOT_FOUND",
+		})
+		return
+	}
+	jsonResponse(w, http.StatusOK, job)
+}
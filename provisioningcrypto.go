@@ -0,0 +1,271 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/rs/zerolog/hlog"
+
+	"github.com/element-hq/mautrix-go/crypto"
+	"github.com/element-hq/mautrix-go/id"
+)
+
+// GetOlmMachine returns the olm machine of the end-to-bridge encryption helper, which is needed for
+// cross-signing, secret storage and key sharing operations. It returns nil if encryption is disabled.
+func (br *WABridge) GetOlmMachine() *crypto.OlmMachine {
+	if br.Crypto == nil {
+		return nil
+	}
+	client := br.Crypto.Client()
+	if client == nil || client.Syncer == nil {
+		return nil
+	}
+	// The crypto helper doesn't have an accessor for the machine, but the syncer it installs
+	// on the bot client embeds it.
+	syncer := reflect.ValueOf(client.Syncer)
+	if syncer.Kind() == reflect.Pointer {
+		syncer = syncer.Elem()
+	}
+	if syncer.Kind() != reflect.Struct {
+		return nil
+	}
+	field := syncer.FieldByName("OlmMachine")
+	if !field.IsValid() || !field.CanInterface() {
+		return nil
+	}
+	mach, _ := field.Interface().(*crypto.OlmMachine)
+	return mach
+}
+
+func (prov *ProvisioningAPI) getCryptoMachine(w http.ResponseWriter, r *http.Request) *crypto.OlmMachine {
+	if user := r.Context().Value("user").(*User); !user.Admin {
+		jsonResponse(w, http.StatusForbidden, Error{
+			Error:   "Only bridge admins can manage end-to-bridge encryption",
+			ErrCode: "M_FORBIDDEN",
+		})
+		return nil
+	} else if prov.bridge.Crypto == nil {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   "End-to-bridge encryption is not enabled",
+			ErrCode: "encryption disabled",
+		})
+		return nil
+	}
+	mach := prov.bridge.GetOlmMachine()
+	if mach == nil {
+		jsonResponse(w, http.StatusServiceUnavailable, Error{
+			Error:   "End-to-bridge encryption isn't initialized",
+			ErrCode: "encryption unavailable",
+		})
+		return nil
+	}
+	return mach
+}
+
+type EncryptionStatus struct {
+	DeviceID             id.DeviceID `json:"device_id"`
+	CrossSigningSetUp    bool        `json:"cross_signing_set_up"`
+	HasCrossSigningKeys  bool        `json:"has_cross_signing_private_keys"`
+	HasSecretStorage     bool        `json:"has_secret_storage"`
+	DefaultSecretStorage string      `json:"default_secret_storage_key,omitempty"`
+}
+
+func (prov *ProvisioningAPI) GetEncryptionStatus(w http.ResponseWriter, r *http.Request) {
+	mach := prov.getCryptoMachine(w, r)
+	if mach == nil {
+		return
+	}
+	resp := EncryptionStatus{
+		DeviceID:            mach.Client.DeviceID,
+		CrossSigningSetUp:   mach.GetOwnCrossSigningPublicKeys(r.Context()) != nil,
+		HasCrossSigningKeys: mach.CrossSigningKeys != nil,
+	}
+	keyID, _, err := mach.SSSS.GetDefaultKeyData(r.Context())
+	if err == nil {
+		resp.HasSecretStorage = true
+		resp.DefaultSecretStorage = keyID
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
+
+type ReqBootstrapCrossSigning struct {
+	Passphrase string `json:"passphrase,omitempty"`
+	Password   string `json:"password,omitempty"`
+}
+
+type RespBootstrapCrossSigning struct {
+	RecoveryKey string `json:"recovery_key"`
+}
+
+// BootstrapCrossSigning generates new cross-signing keys for the bridge bot, uploads them to the homeserver
+// and into secret storage (encrypted with a new recovery key), and signs the bridge bot's device with them.
+func (prov *ProvisioningAPI) BootstrapCrossSigning(w http.ResponseWriter, r *http.Request) {
+	mach := prov.getCryptoMachine(w, r)
+	if mach == nil {
+		return
+	}
+	var req ReqBootstrapCrossSigning
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonResponse(w, http.StatusBadRequest, Error{
+				Error:   "Failed to parse request JSON",
+				ErrCode: "bad json",
+			})
+			return
+		}
+	}
+	log := hlog.FromRequest(r)
+	recoveryKey, _, err := mach.GenerateAndUploadCrossSigningKeysWithPassword(r.Context(), req.Password, req.Passphrase)
+	if err != nil {
+		log.Err(err).Msg("Failed to generate and upload cross-signing keys")
+		jsonResponse(w, http.StatusInternalServerError, Error{
+			Error:   fmt.Sprintf("Failed to set up cross-signing: %v", err),
+			ErrCode: "cross-signing failed",
+		})
+		return
+	} else if err = prov.signOwnDevice(r, mach); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, Error{
+			Error:   fmt.Sprintf("Failed to sign bridge device: %v", err),
+			ErrCode: "signing failed",
+		})
+		return
+	}
+	log.Info().Msg("Bootstrapped cross-signing for bridge bot")
+	jsonResponse(w, http.StatusOK, RespBootstrapCrossSigning{RecoveryKey: recoveryKey})
+}
+
+type ReqRestoreRecoveryKey struct {
+	RecoveryKey string `json:"recovery_key"`
+}
+
+// RestoreFromRecoveryKey fetches the bridge bot's cross-signing keys from secret storage using the given
+// recovery key, and uses them to sign the current device. This is used after the bridge's crypto store is reset.
+func (prov *ProvisioningAPI) RestoreFromRecoveryKey(w http.ResponseWriter, r *http.Request) {
+	mach := prov.getCryptoMachine(w, r)
+	if mach == nil {
+		return
+	}
+	var req ReqRestoreRecoveryKey
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RecoveryKey == "" {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   "Request must contain a recovery key",
+			ErrCode: "bad json",
+		})
+		return
+	}
+	log := hlog.FromRequest(r)
+	_, keyData, err := mach.SSSS.GetDefaultKeyData(r.Context())
+	if err != nil {
+		log.Err(err).Msg("Failed to get default secret storage key")
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   fmt.Sprintf("Failed to get secret storage key: %v", err),
+			ErrCode: "no secret storage",
+		})
+		return
+	}
+	key, err := keyData.VerifyRecoveryKey(req.RecoveryKey)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, Error{
+			Error:   "Invalid recovery key",
+			ErrCode: "invalid recovery key",
+		})
+		return
+	}
+	err = mach.FetchCrossSigningKeysFromSSSS(r.Context(), key)
+	if err != nil {
+		log.Err(err).Msg("Failed to fetch cross-signing keys from secret storage")
+		jsonResponse(w, http.StatusInternalServerError, Error{
+			Error:   fmt.Sprintf("Failed to fetch cross-signing keys: %v", err),
+			ErrCode: "restore failed",
+		})
+		return
+	} else if err = prov.signOwnDevice(r, mach); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, Error{
+			Error:   fmt.Sprintf("Failed to sign bridge device: %v", err),
+			ErrCode: "signing failed",
+		})
+		return
+	}
+	log.Info().Msg("Restored cross-signing keys from secret storage")
+	jsonResponse(w, http.StatusOK, Response{true, "Cross-signing keys restored"})
+}
+
+func (prov *ProvisioningAPI) signOwnDevice(r *http.Request, mach *crypto.OlmMachine) error {
+	log := hlog.FromRequest(r)
+	err := mach.SignOwnDevice(r.Context(), mach.OwnIdentity())
+	if err != nil {
+		log.Err(err).Msg("Failed to sign own device")
+		return err
+	}
+	err = mach.SignOwnMasterKey(r.Context())
+	if err != nil {
+		log.Err(err).Msg("Failed to sign own master key")
+		return err
+	}
+	return nil
+}
+
+type PortalEncryptionHealth struct {
+	RoomID             id.RoomID `json:"room_id"`
+	JID                string    `json:"jid"`
+	Encrypted          bool      `json:"encrypted"`
+	RoomHasEncryption  bool      `json:"room_has_encryption"`
+	HasOutboundSession bool      `json:"has_outbound_session"`
+	Problem            string    `json:"problem,omitempty"`
+}
+
+// GetPortalEncryptionHealth reports whether each portal's encryption state in the bridge database matches the
+// room state, and whether the bridge has an outbound megolm session for the room.
+func (prov *ProvisioningAPI) GetPortalEncryptionHealth(w http.ResponseWriter, r *http.Request) {
+	mach := prov.getCryptoMachine(w, r)
+	if mach == nil {
+		return
+	}
+	portals := prov.bridge.GetAllPortals()
+	resp := make([]PortalEncryptionHealth, 0, len(portals))
+	for _, portal := range portals {
+		if len(portal.MXID) == 0 {
+			continue
+		}
+		health := PortalEncryptionHealth{
+			RoomID:    portal.MXID,
+			JID:       portal.Key.String(),
+			Encrypted: portal.Encrypted,
+		}
+		var err error
+		health.RoomHasEncryption, err = prov.bridge.AS.StateStore.IsEncrypted(r.Context(), portal.MXID)
+		if err != nil {
+			hlog.FromRequest(r).Warn().Err(err).Stringer("room_id", portal.MXID).Msg("Failed to check if room is encrypted")
+		}
+		session, err := mach.CryptoStore.GetOutboundGroupSession(r.Context(), portal.MXID)
+		if err != nil {
+			hlog.FromRequest(r).Warn().Err(err).Stringer("room_id", portal.MXID).Msg("Failed to get outbound group session")
+		}
+		health.HasOutboundSession = session != nil
+		if health.Encrypted && !health.RoomHasEncryption {
+			health.Problem = "portal is marked as encrypted, but the room doesn't have an encryption event"
+		} else if !health.Encrypted && health.RoomHasEncryption {
+			health.Problem = "room is encrypted, but the portal isn't marked as encrypted"
+		}
+		resp = append(resp, health)
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
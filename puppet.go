@@ -38,6 +38,8 @@ import (
 type PuppetActivity struct {
 	currentUserCount uint
 	isBlocked        bool
+	limit            uint
+	warnedThreshold  uint
 }
 
 var userIDRegex *regexp.Regexp
@@ -246,9 +248,12 @@ func (puppet *Puppet) DefaultIntent() *appservice.IntentAPI {
 
 func (puppet *Puppet) UpdateAvatar(ctx context.Context, source *User, forcePortalSync bool) bool {
 	changed := source.updateAvatar(ctx, puppet.JID, false, &puppet.Avatar, &puppet.AvatarURL, &puppet.AvatarSet, puppet.DefaultIntent())
-	if !changed || puppet.Avatar == "unauthorized" {
+	if puppet.Avatar == "unauthorized" && puppet.AvatarURL.IsEmpty() && puppet.bridge.Config.Bridge.FallbackAvatarStyle != "" {
+		changed = puppet.uploadFallbackAvatar(ctx) || changed
+	}
+	if !changed || (puppet.Avatar == "unauthorized" && puppet.AvatarURL.IsEmpty()) {
 		if forcePortalSync {
-			go puppet.updatePortalAvatar(ctx)
+			go puppet.updatePortalAvatar(context.WithoutCancel(ctx))
 		}
 		return changed
 	}
@@ -258,28 +263,34 @@ func (puppet *Puppet) UpdateAvatar(ctx context.Context, source *User, forcePorta
 	} else {
 		puppet.AvatarSet = true
 	}
-	go puppet.updatePortalAvatar(ctx)
+	go puppet.updatePortalAvatar(context.WithoutCancel(ctx))
 	return true
 }
 
-func (puppet *Puppet) UpdateName(ctx context.Context, contact types.ContactInfo, forcePortalSync bool) bool {
+func (puppet *Puppet) UpdateName(ctx context.Context, source *User, contact types.ContactInfo, forcePortalSync bool) bool {
+	// Puppets are shared by all users, so their names always use the bridge-wide template.
+	// Per-user displayname preferences only apply to the names of the user's own private chat portals.
+	templateID := puppet.bridge.Config.Bridge.DisplaynameTemplateID("")
 	newName, quality := puppet.bridge.Config.Bridge.FormatDisplayname(puppet.JID, contact)
-	if (puppet.Displayname != newName || !puppet.NameSet) && quality >= puppet.NameQuality {
+	// If the template changed, the quality heuristic is meaningless, so re-render the name unconditionally
+	templateChanged := puppet.NameTemplate != templateID
+	if (puppet.Displayname != newName || !puppet.NameSet || templateChanged) && (quality >= puppet.NameQuality || templateChanged) {
 		oldName := puppet.Displayname
 		puppet.Displayname = newName
 		puppet.NameQuality = quality
+		puppet.NameTemplate = templateID
 		puppet.NameSet = false
 		err := puppet.DefaultIntent().SetDisplayName(ctx, newName)
 		if err == nil {
 			puppet.zlog.Debug().Str("old_name", oldName).Str("new_name", newName).Msg("Updated name")
 			puppet.NameSet = true
-			go puppet.updatePortalName(ctx)
+			go puppet.updatePortalName(context.WithoutCancel(ctx))
 		} else {
 			puppet.zlog.Err(err).Msg("Failed to set displayname")
 		}
 		return true
 	} else if forcePortalSync {
-		go puppet.updatePortalName(ctx)
+		go puppet.updatePortalName(context.WithoutCancel(ctx))
 	}
 	return false
 }
@@ -349,7 +360,7 @@ func (puppet *Puppet) updatePortalAvatar(ctx context.Context) {
 
 func (puppet *Puppet) updatePortalName(ctx context.Context) {
 	puppet.updatePortalMeta(func(portal *Portal) {
-		portal.UpdateName(ctx, puppet.Displayname, types.EmptyJID, true)
+		portal.UpdateName(ctx, portal.privateChatName(portal.bridge.GetUserByJID(portal.Key.Receiver), puppet), types.EmptyJID, true)
 	})
 }
 
@@ -357,7 +368,9 @@ func (puppet *Puppet) SyncContact(ctx context.Context, source *User, onlyIfNoNam
 	if puppet == nil {
 		return
 	}
-	if onlyIfNoName && len(puppet.Displayname) > 0 && (!shouldHavePushName || puppet.NameQuality > config.NameQualityPhone) {
+	ctx = WithRequestPriority(ctx, PriorityProfile)
+	templateChanged := puppet.NameTemplate != puppet.bridge.Config.Bridge.DisplaynameTemplateID("")
+	if onlyIfNoName && len(puppet.Displayname) > 0 && !templateChanged && (!shouldHavePushName || puppet.NameQuality > config.NameQualityPhone) {
 		source.EnqueuePuppetResync(puppet)
 		return
 	}
@@ -399,7 +412,7 @@ func (puppet *Puppet) syncInternal(ctx context.Context, source *User, contact *t
 	log := zerolog.Ctx(ctx)
 	puppet.syncLock.Lock()
 	defer puppet.syncLock.Unlock()
-	err := puppet.DefaultIntent().EnsureRegistered(ctx)
+	err := puppet.bridge.Memberships.EnsureRegistered(ctx, puppet.DefaultIntent())
 	if err != nil {
 		log.Err(err).Msg("Failed to ensure registered")
 	}
@@ -411,7 +424,7 @@ func (puppet *Puppet) syncInternal(ctx context.Context, source *User, contact *t
 		if puppet.JID.User == source.JID.User {
 			contact.PushName = source.Client.Store.PushName
 		}
-		update = puppet.UpdateName(ctx, *contact, forcePortalSync) || update
+		update = puppet.UpdateName(ctx, source, *contact, forcePortalSync) || update
 	}
 	if len(puppet.Avatar) == 0 || forceAvatarSync || puppet.bridge.Config.Bridge.UserAvatarSync {
 		update = puppet.UpdateAvatar(ctx, source, forcePortalSync) || update
@@ -0,0 +1,118 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// isPuppetActive checks whether a puppet with the given activity timestamps counts towards the active puppet limit.
+func (br *WABridge) isPuppetActive(firstActivityTs, lastActivityTs, now int64) bool {
+	minActivityTime := int64(ONE_DAY_S * br.Config.Limits.MinPuppetActiveDays)
+	maxActivityTime := int64(ONE_DAY_S * br.Config.Limits.PuppetInactivityDays)
+	secondsOfActivity := lastActivityTs - firstActivityTs
+	isInactive := now-lastActivityTs > maxActivityTime
+	return !isInactive && secondsOfActivity > minActivityTime && secondsOfActivity < maxActivityTime
+}
+
+// checkPuppetLimitThresholds warns bridge admins when the active puppet count crosses one of the configured
+// warning thresholds. Each threshold is only warned about once until the usage drops below it again.
+func (br *WABridge) checkPuppetLimitThresholds(ctx context.Context, activePuppetCount uint) {
+	limit := br.Config.Limits.MaxPuppetLimit
+	if limit == 0 || len(br.Config.Limits.WarningThresholds) == 0 {
+		return
+	}
+	usagePercent := activePuppetCount * 100 / limit
+	var crossed uint
+	for _, threshold := range br.Config.Limits.WarningThresholds {
+		if usagePercent >= threshold && threshold > crossed {
+			crossed = threshold
+		}
+	}
+	previous := br.PuppetActivity.warnedThreshold
+	br.PuppetActivity.warnedThreshold = crossed
+	if crossed <= previous {
+		return
+	}
+	zerolog.Ctx(ctx).Info().
+		Uint("active_puppet_count", activePuppetCount).
+		Uint("max_puppet_limit", limit).
+		Uint("threshold", crossed).
+		Msg("Active puppet count crossed warning threshold")
+	notice := "**Warning:** %d of the %d allowed active WhatsApp users are in use (%d%% of the limit)."
+	if br.PuppetActivity.isBlocked {
+		notice += " The limit has been exceeded and new messages are not being bridged."
+	} else if br.Config.Limits.BlockOnLimitReached {
+		notice += " Messages will stop being bridged once the limit is exceeded."
+	}
+	for _, user := range br.GetAllUsers() {
+		if user.Admin && len(user.ManagementRoom) > 0 {
+			user.sendMarkdownBridgeAlert(ctx, notice, activePuppetCount, limit, usagePercent)
+		}
+	}
+}
+
+type PuppetActivityInfo struct {
+	JID             string `json:"jid"`
+	Displayname     string `json:"displayname,omitempty"`
+	FirstActivityTs int64  `json:"first_activity_ts"`
+	LastActivityTs  int64  `json:"last_activity_ts"`
+	Active          bool   `json:"active"`
+}
+
+type PuppetActivityReport struct {
+	ActivePuppetCount   uint                 `json:"active_puppet_count"`
+	MaxPuppetLimit      uint                 `json:"max_puppet_limit"`
+	RemainingPuppets    int                  `json:"remaining_puppets"`
+	UsagePercent        float64              `json:"usage_percent"`
+	Blocked             bool                 `json:"blocked"`
+	BlockOnLimitReached bool                 `json:"block_on_limit_reached"`
+	Puppets             []PuppetActivityInfo `json:"puppets"`
+}
+
+// GetPuppetActivityReport collects the activity timestamps of all puppets and how close the bridge is to the limit.
+func (br *WABridge) GetPuppetActivityReport(ctx context.Context) (*PuppetActivityReport, error) {
+	puppets, err := br.DB.Puppet.GetAllWithActivity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	report := &PuppetActivityReport{
+		ActivePuppetCount:   br.PuppetActivity.currentUserCount,
+		MaxPuppetLimit:      br.Config.Limits.MaxPuppetLimit,
+		Blocked:             br.PuppetActivity.isBlocked,
+		BlockOnLimitReached: br.Config.Limits.BlockOnLimitReached,
+		Puppets:             make([]PuppetActivityInfo, len(puppets)),
+	}
+	report.RemainingPuppets = int(report.MaxPuppetLimit) - int(report.ActivePuppetCount)
+	if report.MaxPuppetLimit > 0 {
+		report.UsagePercent = float64(report.ActivePuppetCount) * 100 / float64(report.MaxPuppetLimit)
+	}
+	for i, puppet := range puppets {
+		report.Puppets[i] = PuppetActivityInfo{
+			JID:             puppet.JID.String(),
+			Displayname:     puppet.Displayname,
+			FirstActivityTs: puppet.FirstActivityTs,
+			LastActivityTs:  puppet.LastActivityTs,
+			Active:          br.isPuppetActive(puppet.FirstActivityTs, puppet.LastActivityTs, now),
+		}
+	}
+	return report, nil
+}
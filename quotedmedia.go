@@ -0,0 +1,135 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/element-hq/mautrix-go/event"
+	"github.com/element-hq/mautrix-go/id"
+)
+
+// Images larger than this aren't downloaded just to generate a thumbnail for a quote.
+const maxQuotedThumbnailSourceSize = 5 * 1024 * 1024
+
+// generateQuotedMedia builds the quoted message for a reply to a media message, so that WhatsApp
+// shows the media type and thumbnail in the quote bubble. It returns nil if the reply target isn't
+// a media message or can't be fetched, in which case the caller should fall back to a blank quote.
+func (portal *Portal) generateQuotedMedia(ctx context.Context, eventID id.EventID) *waProto.Message {
+	log := zerolog.Ctx(ctx).With().Stringer("reply_to_mxid", eventID).Logger()
+	evt, err := portal.MainIntent().GetEvent(ctx, portal.MXID, eventID)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to get reply target event for quoted media")
+		return nil
+	}
+	_ = evt.Content.ParseRaw(evt.Type)
+	if evt.Type == event.EventEncrypted {
+		evt, err = portal.bridge.Crypto.Decrypt(ctx, evt)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to decrypt reply target event for quoted media")
+			return nil
+		}
+	}
+	content, ok := evt.Content.Parsed.(*event.MessageEventContent)
+	if !ok {
+		return nil
+	}
+	if evt.Type == event.EventSticker {
+		content.MsgType = event.MessageType(event.EventSticker.Type)
+	}
+	info := content.GetInfo()
+	var caption *string
+	if content.FileName != "" && content.Body != content.FileName {
+		caption = proto.String(content.Body)
+	}
+	var mimeType *string
+	if info.MimeType != "" {
+		mimeType = proto.String(info.MimeType)
+	}
+	switch content.MsgType {
+	case event.MsgImage:
+		return &waProto.Message{ImageMessage: &waProto.ImageMessage{
+			Mimetype:      mimeType,
+			Caption:       caption,
+			Width:         proto.Uint32(uint32(info.Width)),
+			Height:        proto.Uint32(uint32(info.Height)),
+			JpegThumbnail: portal.getQuotedThumbnail(ctx, content, true),
+		}}
+	case event.MsgVideo:
+		return &waProto.Message{VideoMessage: &waProto.VideoMessage{
+			Mimetype:      mimeType,
+			Caption:       caption,
+			Seconds:       proto.Uint32(uint32(info.Duration / 1000)),
+			Width:         proto.Uint32(uint32(info.Width)),
+			Height:        proto.Uint32(uint32(info.Height)),
+			JpegThumbnail: portal.getQuotedThumbnail(ctx, content, false),
+		}}
+	case event.MsgAudio:
+		_, isVoice := evt.Content.Raw["org.matrix.msc3245.voice"]
+		return &waProto.Message{AudioMessage: &waProto.AudioMessage{
+			Mimetype: mimeType,
+			Seconds:  proto.Uint32(uint32(info.Duration / 1000)),
+			Ptt:      proto.Bool(isVoice),
+		}}
+	case event.MsgFile:
+		fileName := content.FileName
+		if fileName == "" {
+			fileName = content.Body
+		}
+		return &waProto.Message{DocumentMessage: &waProto.DocumentMessage{
+			Mimetype: mimeType,
+			FileName: proto.String(fileName),
+			Title:    proto.String(fileName),
+			Caption:  caption,
+		}}
+	case event.MessageType(event.EventSticker.Type):
+		return &waProto.Message{StickerMessage: &waProto.StickerMessage{
+			Mimetype: mimeType,
+			Width:    proto.Uint32(uint32(info.Width)),
+			Height:   proto.Uint32(uint32(info.Height)),
+		}}
+	default:
+		return nil
+	}
+}
+
+// getQuotedThumbnail returns a JPEG thumbnail for the quoted media, preferring the thumbnail in the event.
+// Only images can fall back to generating a thumbnail from the full file.
+func (portal *Portal) getQuotedThumbnail(ctx context.Context, content *event.MessageEventContent, canUseOriginal bool) []byte {
+	info := content.GetInfo()
+	source := content
+	if info.ThumbnailURL != "" || info.ThumbnailFile != nil {
+		source = &event.MessageEventContent{URL: info.ThumbnailURL, File: info.ThumbnailFile}
+	} else if !canUseOriginal || info.Size > maxQuotedThumbnailSourceSize {
+		return nil
+	}
+	data, _, err := portal.downloadMatrixFile(ctx, source)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to download media for quoted thumbnail")
+		return nil
+	}
+	thumbnail, err := createThumbnail(data, false)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to create quoted thumbnail")
+		return nil
+	}
+	return thumbnail
+}
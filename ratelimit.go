@@ -0,0 +1,259 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.mau.fi/util/retryafter"
+)
+
+// RequestPriority is the priority class of a homeserver request. When the homeserver rate limit is enabled,
+// requests with a lower value are always sent before requests with a higher value.
+type RequestPriority int
+
+const (
+	PriorityLive RequestPriority = iota
+	PriorityReceipt
+	PriorityProfile
+	PriorityBackfill
+
+	requestPriorityCount
+)
+
+func (prio RequestPriority) String() string {
+	switch prio {
+	case PriorityLive:
+		return "live"
+	case PriorityReceipt:
+		return "receipt"
+	case PriorityProfile:
+		return "profile"
+	case PriorityBackfill:
+		return "backfill"
+	default:
+		return "unknown"
+	}
+}
+
+type requestPriorityContextKey struct{}
+
+// WithRequestPriority returns a context that makes homeserver requests use the given priority class.
+// Requests made with contexts that don't have a priority are treated as live traffic.
+func WithRequestPriority(ctx context.Context, prio RequestPriority) context.Context {
+	return context.WithValue(ctx, requestPriorityContextKey{}, prio)
+}
+
+func getRequestPriority(ctx context.Context) RequestPriority {
+	prio, ok := ctx.Value(requestPriorityContextKey{}).(RequestPriority)
+	if !ok {
+		return PriorityLive
+	}
+	return prio
+}
+
+const defaultRateLimitBackoff = 5 * time.Second
+
+type rateLimitWaiter struct {
+	ch        chan struct{}
+	cancelled bool
+}
+
+// RateLimitedTransport is a http.RoundTripper for homeserver requests that uses a token bucket shared by
+// all requests. When there aren't enough tokens, waiting requests are released in priority order.
+// 429 responses pause all requests until the Retry-After time has passed. Retrying the rate limited request
+// itself is left to the mautrix client.
+type RateLimitedTransport struct {
+	base    http.RoundTripper
+	metrics *MetricsHandler
+	log     zerolog.Logger
+	rate    float64
+	burst   float64
+
+	lock        sync.Mutex
+	tokens      float64
+	lastRefill  time.Time
+	pausedUntil time.Time
+	queues      [requestPriorityCount][]*rateLimitWaiter
+	wakeup      chan struct{}
+}
+
+func NewRateLimitedTransport(br *WABridge, base http.RoundTripper) *RateLimitedTransport {
+	cfg := br.Config.Bridge.HomeserverRateLimit
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	rate := cfg.RequestsPerSecond
+	if rate <= 0 {
+		rate = 20
+	}
+	burst := float64(cfg.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	rlt := &RateLimitedTransport{
+		base:       base,
+		metrics:    br.Metrics,
+		log:        br.ZLog.With().Str("component", "homeserver rate limit").Logger(),
+		rate:       rate,
+		burst:      burst,
+		tokens:     burst,
+		lastRefill: time.Now(),
+		wakeup:     make(chan struct{}, 1),
+	}
+	go rlt.dispatchLoop()
+	return rlt
+}
+
+func (rlt *RateLimitedTransport) refill(now time.Time) {
+	rlt.tokens += now.Sub(rlt.lastRefill).Seconds() * rlt.rate
+	if rlt.tokens > rlt.burst {
+		rlt.tokens = rlt.burst
+	}
+	rlt.lastRefill = now
+}
+
+func (rlt *RateLimitedTransport) hasWaitersUpTo(prio RequestPriority) bool {
+	for i := PriorityLive; i <= prio; i++ {
+		if len(rlt.queues[i]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (rlt *RateLimitedTransport) wake() {
+	select {
+	case rlt.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (rlt *RateLimitedTransport) acquire(ctx context.Context, prio RequestPriority) error {
+	rlt.lock.Lock()
+	now := time.Now()
+	rlt.refill(now)
+	if rlt.tokens >= 1 && now.After(rlt.pausedUntil) && !rlt.hasWaitersUpTo(prio) {
+		rlt.tokens--
+		rlt.lock.Unlock()
+		return nil
+	}
+	waiter := &rateLimitWaiter{ch: make(chan struct{})}
+	rlt.queues[prio] = append(rlt.queues[prio], waiter)
+	rlt.lock.Unlock()
+	rlt.wake()
+	select {
+	case <-waiter.ch:
+		return nil
+	case <-ctx.Done():
+		rlt.lock.Lock()
+		waiter.cancelled = true
+		select {
+		case <-waiter.ch:
+			// The dispatcher already gave this waiter a token, so return it to the bucket.
+			rlt.tokens = min(rlt.tokens+1, rlt.burst)
+			rlt.lock.Unlock()
+			rlt.wake()
+		default:
+			rlt.lock.Unlock()
+		}
+		return ctx.Err()
+	}
+}
+
+// popWaiter returns the first non-cancelled waiter with the highest priority. It must be called with the lock held.
+func (rlt *RateLimitedTransport) popWaiter() *rateLimitWaiter {
+	for prio := range rlt.queues {
+		for len(rlt.queues[prio]) > 0 {
+			waiter := rlt.queues[prio][0]
+			rlt.queues[prio] = rlt.queues[prio][1:]
+			if !waiter.cancelled {
+				return waiter
+			}
+		}
+	}
+	return nil
+}
+
+func (rlt *RateLimitedTransport) dispatchLoop() {
+	for {
+		var sleep time.Duration
+		rlt.lock.Lock()
+		now := time.Now()
+		rlt.refill(now)
+		if now.Before(rlt.pausedUntil) {
+			sleep = rlt.pausedUntil.Sub(now)
+		} else {
+			for rlt.tokens >= 1 {
+				waiter := rlt.popWaiter()
+				if waiter == nil {
+					break
+				}
+				rlt.tokens--
+				close(waiter.ch)
+			}
+			if rlt.hasWaitersUpTo(requestPriorityCount - 1) {
+				sleep = time.Duration((1 - rlt.tokens) / rlt.rate * float64(time.Second))
+			}
+		}
+		rlt.lock.Unlock()
+		if sleep > 0 {
+			select {
+			case <-time.After(sleep):
+			case <-rlt.wakeup:
+			}
+		} else {
+			<-rlt.wakeup
+		}
+	}
+}
+
+func (rlt *RateLimitedTransport) pause(until time.Time) {
+	rlt.lock.Lock()
+	if until.After(rlt.pausedUntil) {
+		rlt.pausedUntil = until
+	}
+	rlt.lock.Unlock()
+	rlt.wake()
+}
+
+func (rlt *RateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	prio := getRequestPriority(req.Context())
+	start := time.Now()
+	err := rlt.acquire(req.Context(), prio)
+	if err != nil {
+		return nil, err
+	}
+	rlt.metrics.TrackHomeserverRequestWait(prio.String(), time.Since(start))
+	resp, err := rlt.base.RoundTrip(req)
+	if err == nil && resp.StatusCode == http.StatusTooManyRequests {
+		// The mautrix client retries the request itself, so only pause the other requests here.
+		backoff := retryafter.Parse(resp.Header.Get("Retry-After"), defaultRateLimitBackoff)
+		rlt.metrics.TrackHomeserverRateLimited(prio.String())
+		rlt.log.Warn().
+			Str("priority", prio.String()).
+			Str("path", req.URL.Path).
+			Dur("retry_after", backoff).
+			Msg("Homeserver rate limited request, pausing requests")
+		rlt.pause(time.Now().Add(backoff))
+	}
+	return resp, err
+}
@@ -0,0 +1,101 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// reactionRateLimiter is a token bucket for reactions sent from Matrix to WhatsApp in a single portal.
+// The token count goes negative while reactions are queued, so -tokens is the length of the queue.
+type reactionRateLimiter struct {
+	lock   sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// reserve takes a token for a reaction and returns how long the reaction has to wait before it can be sent.
+// If the queue is already full, no token is taken and ok is false.
+func (rl *reactionRateLimiter) reserve(now time.Time, perSecond float64, burst, maxQueue int) (wait time.Duration, ok bool) {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+	if rl.last.IsZero() {
+		rl.tokens = float64(burst)
+	} else {
+		rl.tokens = min(float64(burst), rl.tokens+now.Sub(rl.last).Seconds()*perSecond)
+	}
+	rl.last = now
+	if rl.tokens-1 < -float64(maxQueue) {
+		return 0, false
+	}
+	rl.tokens--
+	if rl.tokens >= 0 {
+		return 0, true
+	}
+	return time.Duration(-rl.tokens / perSecond * float64(time.Second)), true
+}
+
+// limitReaction applies the reaction rate limit to an incoming Matrix reaction. It returns false if the reaction
+// was rejected because too many reactions are already queued in the portal.
+func (portal *Portal) limitReaction(msg *PortalMatrixMessage) bool {
+	cfg := &portal.bridge.Config.Bridge.ReactionRateLimit
+	if !cfg.Enabled || cfg.PerSecond <= 0 {
+		return true
+	}
+	wait, ok := portal.reactionLimiter.reserve(msg.receivedAt, cfg.PerSecond, max(cfg.Burst, 1), cfg.MaxQueue)
+	if !ok {
+		log := portal.zlog.With().
+			Str("action", "handle matrix event").
+			Stringer("event_id", msg.evt.ID).
+			Stringer("sender", msg.evt.Sender).
+			Logger()
+		log.Warn().Msg("Rejecting reaction as the reaction queue of the portal is full")
+		go portal.sendMessageMetrics(log.WithContext(context.TODO()), msg.evt, errReactionRateLimited, "Ignoring", nil)
+		return false
+	} else if wait > 0 {
+		msg.notBefore = msg.receivedAt.Add(wait)
+	}
+	return true
+}
+
+// queueDelayedReaction passes a reaction that was delayed by the rate limit to the portal's reaction queue,
+// which forwards it to the portal event loop once the delay is over. The event loop itself never waits
+// for the rate limit, so other events in the portal aren't delayed.
+func (portal *Portal) queueDelayedReaction(msg *PortalMatrixMessage) {
+	portal.reactionQueueLoader.Do(func() {
+		portal.reactionQueue = make(chan *PortalMatrixMessage, max(portal.bridge.Config.Bridge.ReactionRateLimit.MaxQueue, 1))
+		go portal.reactionQueueLoop()
+	})
+	portal.reactionQueue <- msg
+}
+
+func (portal *Portal) reactionQueueLoop() {
+	for msg := range portal.reactionQueue {
+		if wait := time.Until(msg.notBefore); wait > 0 {
+			portal.zlog.Debug().
+				Stringer("event_id", msg.evt.ID).
+				Dur("wait", wait).
+				Msg("Delaying reaction due to rate limit")
+			time.Sleep(wait)
+		}
+		portal.events <- &PortalEvent{
+			MatrixMessage: msg,
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"text/template"
+
+	"github.com/rs/zerolog"
+
+	"github.com/element-hq/mautrix-whatsapp/config"
+)
+
+// SetRelayUser changes the user whose WhatsApp account is used to relay messages in the portal.
+// If user is nil, relay mode is disabled for the portal.
+func (portal *Portal) SetRelayUser(ctx context.Context, user *User) error {
+	if user == nil {
+		portal.RelayUserID = ""
+	} else {
+		portal.RelayUserID = user.MXID
+	}
+	portal.relayUser = user
+	return portal.Update(ctx)
+}
+
+// SetRelayFormat overrides the relaybot message format template for the given msgtype in this portal.
+// An empty format removes the override, so the global template from the config is used again.
+func (portal *Portal) SetRelayFormat(ctx context.Context, msgType, format string) error {
+	formats := make(map[string]string, len(portal.RelayFormats)+1)
+	for key, value := range portal.RelayFormats {
+		formats[key] = value
+	}
+	if format == "" {
+		delete(formats, msgType)
+	} else {
+		formats[msgType] = format
+	}
+	tpl, err := config.ParseRelayMessageFormats(formats)
+	if err != nil {
+		return err
+	}
+	portal.RelayFormats = formats
+	portal.relayTemplates = tpl
+	return portal.Update(ctx)
+}
+
+func (portal *Portal) getRelayTemplates(ctx context.Context) *template.Template {
+	if len(portal.RelayFormats) == 0 {
+		return nil
+	} else if portal.relayTemplates == nil {
+		var err error
+		portal.relayTemplates, err = config.ParseRelayMessageFormats(portal.RelayFormats)
+		if err != nil {
+			zerolog.Ctx(ctx).Err(err).Msg("Failed to parse portal relay formats")
+			return nil
+		}
+	}
+	return portal.relayTemplates
+}
@@ -0,0 +1,288 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/element-hq/mautrix-go"
+	"github.com/element-hq/mautrix-go/bridge/commands"
+	"github.com/element-hq/mautrix-go/event"
+	"github.com/element-hq/mautrix-go/id"
+
+	"github.com/element-hq/mautrix-whatsapp/database"
+)
+
+// sharedAccessKeyShareCount is the minimum number of recent messages whose keys are shared with secondary
+// accounts when they join a portal.
+const sharedAccessKeyShareCount = 50
+
+// isOwnPortal returns true if the user is a member of the portal room.
+func (user *User) isOwnPortal(ctx context.Context, portal *Portal) bool {
+	if len(portal.MXID) == 0 {
+		return false
+	} else if portal.IsPrivateChat() && portal.Key.Receiver != user.JID.ToNonAD() {
+		return false
+	}
+	return user.bridge.StateStore.IsMembership(ctx, portal.MXID, user.MXID, event.MembershipJoin, event.MembershipInvite)
+}
+
+func (user *User) getOwnPortals(ctx context.Context) []*Portal {
+	var portals []*Portal
+	for _, portal := range user.bridge.GetAllPortals() {
+		if user.isOwnPortal(ctx, portal) {
+			portals = append(portals, portal)
+		}
+	}
+	return portals
+}
+
+// getSharedAccessGrants returns the access grants that allow the target user to use this portal.
+// The grants are cached per portal, as this is called for every Matrix event from users without bridge permissions.
+func (portal *Portal) getSharedAccessGrants(ctx context.Context, target id.UserID) ([]*database.SharedAccess, error) {
+	portal.sharedAccessCacheLock.Lock()
+	defer portal.sharedAccessCacheLock.Unlock()
+	grants, ok := portal.sharedAccessCache[target]
+	if ok {
+		return grants, nil
+	}
+	grants, err := portal.bridge.DB.SharedAccess.GetForPortal(ctx, target, portal.Key)
+	if err != nil {
+		return nil, err
+	}
+	if portal.sharedAccessCache == nil {
+		portal.sharedAccessCache = make(map[id.UserID][]*database.SharedAccess)
+	}
+	portal.sharedAccessCache[target] = grants
+	return grants, nil
+}
+
+// invalidateSharedAccessCache removes the cached grants of the grant's target user from the portals it applies to.
+func (br *WABridge) invalidateSharedAccessCache(grant *database.SharedAccess) {
+	var portals []*Portal
+	br.portalsLock.Lock()
+	if grant.IsAllPortals() {
+		portals = make([]*Portal, 0, len(br.portalsByJID))
+		for _, portal := range br.portalsByJID {
+			portals = append(portals, portal)
+		}
+	} else if portal, ok := br.portalsByJID[grant.Portal]; ok {
+		portals = []*Portal{portal}
+	}
+	br.portalsLock.Unlock()
+	for _, portal := range portals {
+		portal.sharedAccessCacheLock.Lock()
+		delete(portal.sharedAccessCache, grant.TargetMXID)
+		portal.sharedAccessCacheLock.Unlock()
+	}
+}
+
+// getSharedAccessOwner returns the logged-in user who has shared this portal with the given Matrix user, if any.
+func (portal *Portal) getSharedAccessOwner(ctx context.Context, target id.UserID) *User {
+	grants, err := portal.getSharedAccessGrants(ctx, target)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to get shared access grants")
+		return nil
+	}
+	for _, grant := range grants {
+		owner := portal.bridge.GetUserByMXIDIfExists(grant.OwnerMXID)
+		if owner != nil && owner.IsLoggedIn() && owner.isOwnPortal(ctx, portal) {
+			return owner
+		}
+	}
+	return nil
+}
+
+// getRelayUserFor returns the user whose WhatsApp session should be used to send messages from a Matrix user who
+// can't send them directly: the owner of a shared portal, or the portal's relay user.
+func (portal *Portal) getRelayUserFor(ctx context.Context, sender *User) *User {
+	if owner := portal.getSharedAccessOwner(ctx, sender.MXID); owner != nil {
+		return owner
+	}
+	return portal.GetRelayUser()
+}
+
+func (user *User) shareWithPortal(ctx context.Context, portal *Portal, target *User) {
+	if !target.ensureInvited(ctx, portal.MainIntent(), portal.MXID, portal.IsPrivateChat()) {
+		return
+	}
+	if portal.Encrypted && portal.bridge.Crypto != nil && portal.bridge.StateStore.IsInRoom(ctx, portal.MXID, target.MXID) {
+		go portal.shareRecentKeys(context.WithoutCancel(ctx), target.MXID, max(portal.getKeyShareCount(), sharedAccessKeyShareCount))
+	}
+}
+
+func (user *User) unshareWithPortal(ctx context.Context, portal *Portal, target id.UserID) {
+	if !portal.bridge.StateStore.IsMembership(ctx, portal.MXID, target, event.MembershipJoin, event.MembershipInvite) {
+		return
+	}
+	_, err := portal.MainIntent().KickUser(ctx, portal.MXID, &mautrix.ReqKickUser{
+		UserID: target,
+		Reason: fmt.Sprintf("Access revoked by %s", user.MXID),
+	})
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Stringer("room_id", portal.MXID).Msg("Failed to kick user after revoking shared access")
+	}
+}
+
+var cmdShare = &commands.FullHandler{
+	Func: wrapCommand(fnShare),
+	Name: "share",
+	Help: commands.HelpMeta{
+		Section: HelpSectionPortalManagement,
+		Description: "Give another Matrix account access to the current portal or all of your portals. " +
+			"Messages from that account are sent through your WhatsApp session.",
+		Args: "[_Matrix user ID_ [portal|all]]",
+	},
+	RequiresLogin: true,
+}
+
+var cmdUnshare = &commands.FullHandler{
+	Func: wrapCommand(fnUnshare),
+	Name: "unshare",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionPortalManagement,
+		Description: "Revoke access given to another Matrix account with the `share` command.",
+		Args:        "<_Matrix user ID_> [portal|all]",
+	},
+	RequiresLogin: true,
+}
+
+func parseShareArgs(ce *WrappedCommandEvent, usage string) (id.UserID, *database.SharedAccess, bool) {
+	target := id.UserID(ce.Args[0])
+	if _, _, err := target.Parse(); err != nil {
+		ce.Reply("**Usage:** `%s`", usage)
+		return "", nil, false
+	} else if target == ce.User.MXID {
+		ce.Reply("You can't share portals with yourself")
+		return "", nil, false
+	} else if ce.Bridge.IsGhost(target) || target == ce.Bot.UserID {
+		ce.Reply("You can't share portals with bridge users")
+		return "", nil, false
+	}
+	scope := "all"
+	if ce.Portal != nil {
+		scope = "portal"
+	}
+	if len(ce.Args) > 1 {
+		scope = strings.ToLower(ce.Args[1])
+	}
+	grant := ce.Bridge.DB.SharedAccess.New()
+	grant.OwnerMXID = ce.User.MXID
+	grant.TargetMXID = target
+	switch scope {
+	case "all":
+	case "portal":
+		if ce.Portal == nil {
+			ce.Reply("You must be in a portal room to share a single portal")
+			return "", nil, false
+		} else if !ce.User.isOwnPortal(ce.Ctx, ce.Portal) {
+			ce.Reply("You can only share your own portals")
+			return "", nil, false
+		}
+		grant.Portal = ce.Portal.Key
+	default:
+		ce.Reply("**Usage:** `%s`", usage)
+		return "", nil, false
+	}
+	return target, grant, true
+}
+
+func fnShare(ce *WrappedCommandEvent) {
+	if len(ce.Args) == 0 {
+		grants, err := ce.Bridge.DB.SharedAccess.GetAllByOwner(ce.Ctx, ce.User.MXID)
+		if err != nil {
+			ce.ZLog.Err(err).Msg("Failed to get shared access grants")
+			ce.Reply("Failed to get shared access: %v", err)
+			return
+		} else if len(grants) == 0 {
+			ce.Reply("You haven't shared any portals. **Usage:** `share <Matrix user ID> [portal|all]`")
+			return
+		}
+		var buf strings.Builder
+		buf.WriteString("You've shared portals with the following accounts:\n\n")
+		for _, grant := range grants {
+			if grant.IsAllPortals() {
+				_, _ = fmt.Fprintf(&buf, "* %s: all portals\n", grant.TargetMXID)
+			} else if portal := ce.Bridge.GetPortalByJID(grant.Portal); portal != nil && portal.MXID != "" {
+				_, _ = fmt.Fprintf(&buf, "* %s: [%s](%s)\n", grant.TargetMXID, portal.Name, portal.MXID.URI().MatrixToURL())
+			} else {
+				_, _ = fmt.Fprintf(&buf, "* %s: `%s`\n", grant.TargetMXID, grant.Portal.JID)
+			}
+		}
+		ce.Reply(buf.String())
+		return
+	}
+	target, grant, ok := parseShareArgs(ce, "share <Matrix user ID> [portal|all]")
+	if !ok {
+		return
+	}
+	err := grant.Insert(ce.Ctx)
+	if err != nil {
+		ce.ZLog.Err(err).Msg("Failed to save shared access grant")
+		ce.Reply("Failed to share portals: %v", err)
+		return
+	}
+	ce.Bridge.invalidateSharedAccessCache(grant)
+	targetUser := ce.Bridge.GetUserByMXID(target)
+	if grant.IsAllPortals() {
+		portals := ce.User.getOwnPortals(ce.Ctx)
+		for _, portal := range portals {
+			ce.User.shareWithPortal(ce.Ctx, portal, targetUser)
+		}
+		ce.Reply("Shared %d portals with %s. Their messages will be sent through your WhatsApp account.", len(portals), target)
+	} else {
+		ce.User.shareWithPortal(ce.Ctx, ce.Portal, targetUser)
+		ce.Reply("Shared this portal with %s. Their messages will be sent through your WhatsApp account.", target)
+	}
+}
+
+func fnUnshare(ce *WrappedCommandEvent) {
+	if len(ce.Args) == 0 {
+		ce.Reply("**Usage:** `unshare <Matrix user ID> [portal|all]`")
+		return
+	}
+	target, grant, ok := parseShareArgs(ce, "unshare <Matrix user ID> [portal|all]")
+	if !ok {
+		return
+	}
+	err := grant.Delete(ce.Ctx)
+	if err != nil {
+		ce.ZLog.Err(err).Msg("Failed to delete shared access grant")
+		ce.Reply("Failed to revoke access: %v", err)
+		return
+	}
+	ce.Bridge.invalidateSharedAccessCache(grant)
+	var portals []*Portal
+	if grant.IsAllPortals() {
+		portals = ce.User.getOwnPortals(ce.Ctx)
+	} else {
+		portals = []*Portal{ce.Portal}
+	}
+	removed := 0
+	for _, portal := range portals {
+		// Don't kick the user from portals that are still shared with them individually or by someone else
+		if portal.getSharedAccessOwner(ce.Ctx, target) == nil {
+			ce.User.unshareWithPortal(ce.Ctx, portal, target)
+			removed++
+		}
+	}
+	ce.Reply("Revoked access of %s to %d portals", target, removed)
+}
@@ -0,0 +1,388 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.mau.fi/util/ffmpeg"
+
+	"github.com/element-hq/mautrix-go"
+	"github.com/element-hq/mautrix-go/event"
+	"github.com/element-hq/mautrix-go/id"
+)
+
+// StateImagePack is the MSC2545 state event type for image packs that are available to everyone in a room.
+var StateImagePack = event.Type{Type: "im.ponies.room_emotes", Class: event.StateEventType}
+
+const (
+	ImagePackUsageSticker  = "sticker"
+	DefaultStickerPackID   = "mautrix-whatsapp"
+	DefaultStickerPackName = "Matrix"
+)
+
+type ImagePackImage struct {
+	URL   id.ContentURIString `json:"url"`
+	Body  string              `json:"body,omitempty"`
+	Info  *event.FileInfo     `json:"info,omitempty"`
+	Usage []string            `json:"usage,omitempty"`
+}
+
+type ImagePackInfo struct {
+	DisplayName string   `json:"display_name,omitempty"`
+	AvatarURL   string   `json:"avatar_url,omitempty"`
+	Usage       []string `json:"usage,omitempty"`
+	Attribution string   `json:"attribution,omitempty"`
+}
+
+type ImagePackEventContent struct {
+	Images map[string]*ImagePackImage `json:"images"`
+	Pack   ImagePackInfo              `json:"pack"`
+}
+
+// WhatsAppStickerMetadata is the JSON that WhatsApp clients store in the EXIF chunk of sticker WebP files.
+type WhatsAppStickerMetadata struct {
+	PackID    string   `json:"sticker-pack-id"`
+	PackName  string   `json:"sticker-pack-name"`
+	Publisher string   `json:"sticker-pack-publisher"`
+	Emojis    []string `json:"emojis,omitempty"`
+}
+
+const (
+	webpFlagAnimation = 0x02
+	webpFlagEXIF      = 0x08
+	webpFlagAlpha     = 0x10
+
+	// The sticker metadata is stored as a single undefined-type TIFF tag, 0x5741 ("WA").
+	exifStickerTag        = 0x5741
+	exifStickerDataOffset = 22
+)
+
+type webpChunk struct {
+	FourCC string
+	Data   []byte
+}
+
+func parseWebPChunks(data []byte) ([]webpChunk, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errors.New("not a webp file")
+	}
+	var chunks []webpChunk
+	data = data[12:]
+	for len(data) >= 8 {
+		size := int(binary.LittleEndian.Uint32(data[4:8]))
+		if size > len(data)-8 {
+			return nil, errors.New("truncated webp chunk")
+		}
+		chunks = append(chunks, webpChunk{FourCC: string(data[0:4]), Data: data[8 : 8+size]})
+		data = data[8+size:]
+		if size%2 == 1 && len(data) > 0 {
+			data = data[1:]
+		}
+	}
+	return chunks, nil
+}
+
+func isAnimatedWebP(data []byte) bool {
+	chunks, err := parseWebPChunks(data)
+	if err != nil {
+		return false
+	}
+	for _, chunk := range chunks {
+		if chunk.FourCC == "ANIM" || (chunk.FourCC == "VP8X" && len(chunk.Data) > 0 && chunk.Data[0]&webpFlagAnimation != 0) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseWhatsAppStickerMetadata extracts the sticker pack metadata from a WebP file, if there is any.
+func parseWhatsAppStickerMetadata(data []byte) *WhatsAppStickerMetadata {
+	chunks, err := parseWebPChunks(data)
+	if err != nil {
+		return nil
+	}
+	for _, chunk := range chunks {
+		if chunk.FourCC != "EXIF" || len(chunk.Data) < exifStickerDataOffset || string(chunk.Data[0:4]) != "II*\x00" {
+			continue
+		}
+		length := int(binary.LittleEndian.Uint32(chunk.Data[14:18]))
+		offset := int(binary.LittleEndian.Uint32(chunk.Data[18:22]))
+		if binary.LittleEndian.Uint16(chunk.Data[10:12]) != exifStickerTag || offset+length > len(chunk.Data) {
+			return nil
+		}
+		var meta WhatsAppStickerMetadata
+		if json.Unmarshal(chunk.Data[offset:offset+length], &meta) != nil {
+			return nil
+		}
+		return &meta
+	}
+	return nil
+}
+
+// addWhatsAppStickerMetadata embeds the given sticker pack metadata into a WebP file, converting it to the
+// extended format if necessary. Any existing EXIF data is replaced.
+func addWhatsAppStickerMetadata(data []byte, meta *WhatsAppStickerMetadata) ([]byte, error) {
+	chunks, err := parseWebPChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal sticker metadata: %w", err)
+	}
+	exif := make([]byte, exifStickerDataOffset, exifStickerDataOffset+len(metaJSON))
+	copy(exif, "II*\x00")
+	binary.LittleEndian.PutUint32(exif[4:8], 8)
+	binary.LittleEndian.PutUint16(exif[8:10], 1)
+	binary.LittleEndian.PutUint16(exif[10:12], exifStickerTag)
+	binary.LittleEndian.PutUint16(exif[12:14], 7)
+	binary.LittleEndian.PutUint32(exif[14:18], uint32(len(metaJSON)))
+	binary.LittleEndian.PutUint32(exif[18:22], exifStickerDataOffset)
+	exif = append(exif, metaJSON...)
+
+	var flags byte
+	var vp8x []byte
+	filtered := make([]webpChunk, 0, len(chunks)+1)
+	for _, chunk := range chunks {
+		switch chunk.FourCC {
+		case "VP8X":
+			vp8x = bytes.Clone(chunk.Data)
+			continue
+		case "EXIF":
+			continue
+		case "ALPH":
+			flags |= webpFlagAlpha
+		case "ANIM":
+			flags |= webpFlagAnimation
+		case "VP8L":
+			// Lossless images always have an alpha channel
+			flags |= webpFlagAlpha
+		}
+		filtered = append(filtered, chunk)
+	}
+	if vp8x == nil {
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read webp dimensions: %w", err)
+		}
+		vp8x = make([]byte, 10)
+		vp8x[0] = flags
+		putUint24(vp8x[4:7], uint32(cfg.Width-1))
+		putUint24(vp8x[7:10], uint32(cfg.Height-1))
+	}
+	vp8x[0] |= webpFlagEXIF
+	filtered = append([]webpChunk{{FourCC: "VP8X", Data: vp8x}}, filtered...)
+	filtered = append(filtered, webpChunk{FourCC: "EXIF", Data: exif})
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF\x00\x00\x00\x00WEBP")
+	for _, chunk := range filtered {
+		buf.WriteString(chunk.FourCC)
+		_ = binary.Write(&buf, binary.LittleEndian, uint32(len(chunk.Data)))
+		buf.Write(chunk.Data)
+		if len(chunk.Data)%2 == 1 {
+			buf.WriteByte(0)
+		}
+	}
+	out := buf.Bytes()
+	binary.LittleEndian.PutUint32(out[4:8], uint32(len(out)-8))
+	return out, nil
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+}
+
+// convertToAnimatedWhatsAppSticker converts a GIF into an animated 512x512 WebP using ffmpeg.
+func (portal *Portal) convertToAnimatedWhatsAppSticker(ctx context.Context, data []byte, mimeType string) ([]byte, error) {
+	return ffmpeg.ConvertBytes(ctx, data, ".webp", []string{"-f", "gif"}, []string{
+		"-vcodec", "libwebp", "-lossless", "0", "-q:v", "60", "-loop", "0", "-an", "-vsync", "0",
+		"-filter:v", fmt.Sprintf(
+			"scale=%[1]d:%[1]d:force_original_aspect_ratio=decrease,pad=%[1]d:%[1]d:(ow-iw)/2:(oh-ih)/2:color=0x00000000",
+			WhatsAppStickerMaxDimension,
+		),
+	}, mimeType)
+}
+
+// convertMatrixSticker converts a Matrix sticker into a WhatsApp sticker, reusing previous conversions of
+// the same file if possible. The returned data includes the sticker pack metadata.
+func (portal *Portal) convertMatrixSticker(ctx context.Context, sender *User, mxc id.ContentURIString, data []byte, content *event.MessageEventContent) ([]byte, bool, error) {
+	log := zerolog.Ctx(ctx)
+	mimeType := content.Info.MimeType
+	cached, err := portal.bridge.DB.StickerCache.Get(ctx, string(mxc))
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to get cached sticker conversion")
+	}
+	var isAnimated bool
+	if cached != nil && cached.Data != nil {
+		data = cached.Data
+		isAnimated = cached.IsAnimated
+		content.Info.MimeType = cached.MimeType
+		content.Info.Width, content.Info.Height = cached.Width, cached.Height
+	} else {
+		var convertErr error
+		switch {
+		case mimeType == "image/gif":
+			isAnimated = true
+			data, convertErr = portal.convertToAnimatedWhatsAppSticker(ctx, data, mimeType)
+		case mimeType == "image/webp" && isAnimatedWebP(data):
+			// Animated WebPs can't be re-encoded without ffmpeg support for animated WebP input,
+			// so send them as-is and hope the dimensions are acceptable.
+			isAnimated = true
+		case mimeType != "image/webp" || content.Info.Width != WhatsAppStickerMaxDimension || content.Info.Height != WhatsAppStickerMaxDimension:
+			data, convertErr = portal.convertToWhatsAppSticker(data)
+		}
+		content.Info.MimeType = "image/webp"
+		if convertErr != nil {
+			return data, isAnimated, convertErr
+		}
+		if !isAnimated || mimeType == "image/gif" {
+			content.Info.Width = WhatsAppStickerMaxDimension
+			content.Info.Height = WhatsAppStickerMaxDimension
+		}
+		cached = portal.bridge.DB.StickerCache.New()
+		cached.Source = string(mxc)
+		cached.Data = data
+		cached.MimeType = content.Info.MimeType
+		cached.Width, cached.Height = content.Info.Width, content.Info.Height
+		cached.IsAnimated = isAnimated
+		cached.CreatedAt = time.Now()
+		err = cached.Upsert(ctx)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to cache sticker conversion")
+		}
+	}
+	withMeta, err := addWhatsAppStickerMetadata(data, &WhatsAppStickerMetadata{
+		PackID:    DefaultStickerPackID,
+		PackName:  DefaultStickerPackName,
+		Publisher: sender.MXID.String(),
+	})
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to add metadata to sticker")
+		return data, isAnimated, nil
+	}
+	return withMeta, isAnimated, nil
+}
+
+// getCachedWhatsAppSticker fills the content of an incoming sticker from a previous upload of the same file.
+// Only unencrypted rooms can use the cache, as encrypted rooms need a new upload with fresh keys.
+func (portal *Portal) getCachedWhatsAppSticker(ctx context.Context, fileSHA256 []byte, content *event.MessageEventContent) *WhatsAppStickerMetadata {
+	if portal.Encrypted || len(fileSHA256) == 0 {
+		return nil
+	}
+	cached, err := portal.bridge.DB.StickerCache.Get(ctx, hex.EncodeToString(fileSHA256))
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to get cached sticker")
+		return nil
+	} else if cached == nil || cached.MXC == "" {
+		return nil
+	}
+	content.URL = cached.MXC
+	content.Info.MimeType = cached.MimeType
+	content.Info.Width, content.Info.Height = cached.Width, cached.Height
+	infoCopy := *content.Info
+	content.Info.ThumbnailInfo = &infoCopy
+	content.Info.ThumbnailURL = content.URL
+	var meta WhatsAppStickerMetadata
+	if cached.Metadata != "" && json.Unmarshal([]byte(cached.Metadata), &meta) == nil {
+		return &meta
+	}
+	return &WhatsAppStickerMetadata{}
+}
+
+func (portal *Portal) cacheWhatsAppSticker(ctx context.Context, fileSHA256 []byte, content *event.MessageEventContent, meta *WhatsAppStickerMetadata) {
+	if content.URL == "" || len(fileSHA256) == 0 {
+		return
+	}
+	cached := portal.bridge.DB.StickerCache.New()
+	cached.Source = hex.EncodeToString(fileSHA256)
+	cached.MXC = content.URL
+	cached.MimeType = content.Info.MimeType
+	cached.Width, cached.Height = content.Info.Width, content.Info.Height
+	cached.CreatedAt = time.Now()
+	if meta != nil {
+		metaJSON, _ := json.Marshal(meta)
+		cached.Metadata = string(metaJSON)
+	}
+	err := cached.Upsert(ctx)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to cache sticker")
+	}
+}
+
+// addToStickerPack adds an incoming sticker to the MSC2545 image pack of its WhatsApp sticker pack in the portal room.
+func (portal *Portal) addToStickerPack(ctx context.Context, fileSHA256 []byte, content *event.MessageEventContent, meta *WhatsAppStickerMetadata) {
+	if !portal.bridge.Config.Bridge.StickerPacks || meta == nil || meta.PackID == "" || content.URL == "" || len(fileSHA256) < 6 {
+		return
+	}
+	log := zerolog.Ctx(ctx).With().Str("sticker_pack_id", meta.PackID).Logger()
+	portal.stickerPackLock.Lock()
+	defer portal.stickerPackLock.Unlock()
+	var pack ImagePackEventContent
+	err := portal.MainIntent().StateEvent(ctx, portal.MXID, StateImagePack, meta.PackID, &pack)
+	if err != nil && !errors.Is(err, mautrix.MNotFound) {
+		log.Warn().Err(err).Msg("Failed to get existing sticker pack")
+		return
+	}
+	if pack.Images == nil {
+		pack.Images = make(map[string]*ImagePackImage)
+	}
+	shortcode := "wa_" + hex.EncodeToString(fileSHA256)[:12]
+	if _, exists := pack.Images[shortcode]; exists {
+		return
+	}
+	body := content.Body
+	if len(meta.Emojis) > 0 {
+		body = meta.Emojis[0]
+	}
+	infoCopy := *content.Info
+	infoCopy.ThumbnailInfo = nil
+	infoCopy.ThumbnailURL = ""
+	pack.Images[shortcode] = &ImagePackImage{
+		URL:   content.URL,
+		Body:  body,
+		Info:  &infoCopy,
+		Usage: []string{ImagePackUsageSticker},
+	}
+	pack.Pack.Usage = []string{ImagePackUsageSticker}
+	if meta.PackName != "" {
+		pack.Pack.DisplayName = meta.PackName
+	} else if pack.Pack.DisplayName == "" {
+		pack.Pack.DisplayName = "WhatsApp stickers"
+	}
+	if meta.Publisher != "" {
+		pack.Pack.Attribution = meta.Publisher
+	}
+	_, err = portal.MainIntent().SendStateEvent(ctx, portal.MXID, StateImagePack, meta.PackID, &pack)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to update sticker pack")
+	} else {
+		log.Debug().Str("shortcode", shortcode).Msg("Added sticker to sticker pack")
+	}
+}
@@ -0,0 +1,120 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+
+	"github.com/element-hq/mautrix-go/bridge/status"
+)
+
+// StreamErrorCategory is a coarse classification of WhatsApp stream errors and connect failures,
+// which decides how the bridge tries to recover from them.
+type StreamErrorCategory string
+
+const (
+	StreamErrorTemporaryBan        StreamErrorCategory = "temporary-ban"
+	StreamErrorInternalServerError StreamErrorCategory = "internal-server-error"
+	StreamErrorServiceUnavailable  StreamErrorCategory = "service-unavailable"
+	StreamErrorConflict            StreamErrorCategory = "conflict"
+	StreamErrorLoggedOut           StreamErrorCategory = "logged-out"
+	StreamErrorClientOutdated      StreamErrorCategory = "client-outdated"
+	StreamErrorUnknown             StreamErrorCategory = "unknown"
+)
+
+const (
+	internalServerErrorMinBackoff = 5 * time.Second
+	internalServerErrorMaxBackoff = 5 * time.Minute
+)
+
+// classifyConnectFailure classifies the connect failures that whatsmeow passes through as ConnectFailure events.
+// Logouts, temporary bans and outdated clients are dispatched as their own events, so they never get here.
+func classifyConnectFailure(reason events.ConnectFailureReason) StreamErrorCategory {
+	switch reason {
+	case events.ConnectFailureInternalServerError:
+		return StreamErrorInternalServerError
+	case events.ConnectFailureServiceUnavailable:
+		return StreamErrorServiceUnavailable
+	default:
+		return StreamErrorUnknown
+	}
+}
+
+// SendsPaused returns true if outgoing messages shouldn't be sent to WhatsApp right now,
+// because the account is temporarily banned.
+func (user *User) SendsPaused() bool {
+	user.streamErrorLock.Lock()
+	defer user.streamErrorLock.Unlock()
+	return time.Now().Before(user.sendsPausedUntil)
+}
+
+func (user *User) handleStreamErrorCategory(category StreamErrorCategory, message string) {
+	user.bridge.Metrics.TrackStreamError(category)
+	user.zlog.Warn().Str("category", string(category)).Str("message", message).Msg("Handling WhatsApp stream error")
+	switch category {
+	case StreamErrorInternalServerError:
+		user.reconnectWithBackoff()
+	case StreamErrorServiceUnavailable:
+		// whatsmeow reconnects automatically after 503s
+		user.BridgeState.Send(status.BridgeState{StateEvent: status.StateTransientDisconnect, Error: WAServiceDown})
+	default:
+		user.BridgeState.Send(status.BridgeState{StateEvent: status.StateUnknownError, Message: message})
+	}
+}
+
+func (user *User) pauseSends(ctx context.Context, expire time.Duration) {
+	until := time.Now().Add(expire)
+	user.streamErrorLock.Lock()
+	user.sendsPausedUntil = until
+	user.streamErrorLock.Unlock()
+	user.zlog.Warn().Time("until", until).Msg("Pausing outgoing messages due to temporary ban")
+	user.sendMarkdownBridgeAlert(ctx, "Your WhatsApp account is temporarily banned. "+
+		"Sending messages is paused until %s.", until.UTC().Format(time.RFC1123))
+}
+
+// reconnectWithBackoff drops the current connection and reconnects after an exponentially increasing delay.
+// It's only used for connect failures after which whatsmeow doesn't reconnect automatically, so it can't race with
+// whatsmeow's own auto-reconnect.
+func (user *User) reconnectWithBackoff() {
+	user.streamErrorLock.Lock()
+	backoff := internalServerErrorMinBackoff << user.internalServerErrorCount
+	if backoff > internalServerErrorMaxBackoff || backoff <= 0 {
+		backoff = internalServerErrorMaxBackoff
+	} else {
+		user.internalServerErrorCount++
+	}
+	if user.internalServerErrorTimer != nil {
+		user.internalServerErrorTimer.Stop()
+	}
+	user.internalServerErrorTimer = time.AfterFunc(backoff, func() {
+		user.zlog.Info().Msg("Reconnecting after WhatsApp internal server error backoff")
+		user.Connect()
+	})
+	user.streamErrorLock.Unlock()
+	user.zlog.Info().Dur("backoff", backoff).Msg("WhatsApp internal server error, reconnecting after backoff")
+	user.BridgeState.Send(status.BridgeState{StateEvent: status.StateTransientDisconnect, Error: WAServiceDown})
+	go user.DeleteConnection()
+}
+
+func (user *User) resetStreamErrorBackoff() {
+	user.streamErrorLock.Lock()
+	user.internalServerErrorCount = 0
+	user.streamErrorLock.Unlock()
+}
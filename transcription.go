@@ -0,0 +1,215 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+
+	"github.com/element-hq/mautrix-go/appservice"
+	"github.com/element-hq/mautrix-go/event"
+	"github.com/element-hq/mautrix-go/id"
+)
+
+const (
+	defaultTranscriptionTimeout        = 2 * time.Minute
+	defaultMaxConcurrentTranscriptions = 2
+	transcriptionQueueSize             = 32
+)
+
+// TranscriptionClient sends voice messages to an OpenAI-compatible speech-to-text API.
+type TranscriptionClient struct {
+	url    string
+	apiKey string
+	model  string
+	client *http.Client
+	queue  chan func()
+}
+
+// NewTranscriptionClient creates a transcription client from the config, or returns nil if transcription is disabled.
+func NewTranscriptionClient(br *WABridge) *TranscriptionClient {
+	cfg := br.Config.Bridge.Transcription
+	if cfg.URL == "" {
+		return nil
+	}
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultTranscriptionTimeout
+	}
+	workers := cfg.MaxConcurrent
+	if workers <= 0 {
+		workers = defaultMaxConcurrentTranscriptions
+	}
+	tc := &TranscriptionClient{
+		url:    strings.TrimSuffix(cfg.URL, "/") + "/v1/audio/transcriptions",
+		apiKey: cfg.APIKey,
+		model:  cfg.Model,
+		client: &http.Client{Timeout: timeout},
+		queue:  make(chan func(), transcriptionQueueSize),
+	}
+	for i := 0; i < workers; i++ {
+		go tc.worker()
+	}
+	return tc
+}
+
+func (tc *TranscriptionClient) worker() {
+	for fn := range tc.queue {
+		fn()
+	}
+}
+
+// enqueue schedules fn on one of the transcription workers. It returns false if the queue is full.
+func (tc *TranscriptionClient) enqueue(fn func()) bool {
+	select {
+	case tc.queue <- fn:
+		return true
+	default:
+		return false
+	}
+}
+
+type transcriptionResponse struct {
+	Text string `json:"text"`
+}
+
+// Transcribe converts the given audio to text. The language is an optional ISO-639-1 hint.
+func (tc *TranscriptionClient) Transcribe(ctx context.Context, data []byte, mimeType, language string) (string, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	fileName := "voice.ogg"
+	if !strings.HasPrefix(mimeType, "audio/ogg") {
+		if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+			fileName = "voice" + exts[0]
+		}
+	}
+	part, err := writer.CreateFormFile("file", fileName)
+	if err != nil {
+		return "", err
+	}
+	_, err = part.Write(data)
+	if err != nil {
+		return "", err
+	}
+	if tc.model != "" {
+		_ = writer.WriteField("model", tc.model)
+	}
+	if language != "" {
+		_ = writer.WriteField("language", language)
+	}
+	_ = writer.WriteField("response_format", "json")
+	err = writer.Close()
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tc.url, &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if tc.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+tc.apiKey)
+	}
+	resp, err := tc.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	var respData transcriptionResponse
+	err = json.NewDecoder(resp.Body).Decode(&respData)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+	return strings.TrimSpace(respData.Text), nil
+}
+
+// VoiceMessageData is the downloaded audio of a voice message that will be transcribed after it's bridged.
+type VoiceMessageData struct {
+	Data     []byte
+	MimeType string
+}
+
+// shouldTranscribe checks whether the given incoming audio message should be transcribed for the user.
+func (portal *Portal) shouldTranscribe(source *User, msg MediaMessage, isBackfill bool) bool {
+	audioMsg, ok := msg.(*waProto.AudioMessage)
+	if !ok || isBackfill || !audioMsg.GetPtt() || portal.bridge.Transcriber == nil || !source.TranscribeVoice {
+		return false
+	}
+	maxDuration := portal.bridge.Config.Bridge.Transcription.MaxDuration
+	return maxDuration == 0 || audioMsg.GetSeconds() <= maxDuration
+}
+
+// queueTranscription schedules a bridged voice message to be transcribed by the bridge-wide transcription workers.
+func (portal *Portal) queueTranscription(ctx context.Context, source *User, eventID id.EventID, voice *VoiceMessageData) {
+	ok := portal.bridge.Transcriber.enqueue(func() {
+		portal.transcribeVoiceMessage(ctx, source, eventID, voice)
+	})
+	if !ok {
+		zerolog.Ctx(ctx).Warn().Stringer("voice_event_id", eventID).Msg("Transcription queue is full, not transcribing voice message")
+	}
+}
+
+// transcribeVoiceMessage transcribes a bridged voice message and posts the result as a bot notice replying to it.
+// If transcribing with the user's language hint fails, it's retried once with automatic language detection.
+func (portal *Portal) transcribeVoiceMessage(ctx context.Context, source *User, eventID id.EventID, voice *VoiceMessageData) {
+	log := zerolog.Ctx(ctx).With().Stringer("voice_event_id", eventID).Logger()
+	text, err := portal.bridge.Transcriber.Transcribe(ctx, voice.Data, voice.MimeType, source.TranscriptionLanguage)
+	if err != nil && source.TranscriptionLanguage != "" {
+		log.Debug().Err(err).Msg("Failed to transcribe voice message with language hint, retrying without it")
+		text, err = portal.bridge.Transcriber.Transcribe(ctx, voice.Data, voice.MimeType, "")
+	}
+	failed := err != nil
+	content := &event.MessageEventContent{MsgType: event.MsgNotice}
+	if failed {
+		log.Warn().Err(err).Msg("Failed to transcribe voice message")
+		if !portal.bridge.Config.Bridge.Transcription.NotifyFailures {
+			return
+		}
+		content.Body = "Failed to transcribe voice message"
+	} else if len(text) == 0 {
+		log.Debug().Msg("Transcription of voice message was empty")
+		return
+	} else {
+		content.Body = "🎙️ " + text
+	}
+	content.RelatesTo = (&event.RelatesTo{}).SetReplyTo(eventID)
+	// The bot isn't always in DMs, so let the DM ghost invite it if necessary.
+	err = portal.bridge.Bot.EnsureJoined(ctx, portal.MXID, appservice.EnsureJoinedParams{BotOverride: portal.MainIntent().Client})
+	if err != nil {
+		log.Err(err).Msg("Failed to ensure bridge bot is joined to send voice message transcription")
+		return
+	}
+	_, err = portal.sendMessage(ctx, portal.bridge.Bot, event.EventMessage, content, map[string]any{
+		"fi.mau.whatsapp.transcription": map[string]any{"source_event_id": eventID, "failed": failed},
+	}, 0)
+	if err != nil {
+		log.Err(err).Msg("Failed to send voice message transcription")
+	}
+}
@@ -0,0 +1,313 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/element-hq/mautrix-go/event"
+	"github.com/element-hq/mautrix-go/format"
+	"github.com/element-hq/mautrix-go/id"
+)
+
+const (
+	TranslationProviderLibreTranslate = "libretranslate"
+	TranslationProviderDeepL          = "deepl"
+
+	defaultDeepLURL           = "https://api-free.deepl.com"
+	defaultTranslationTimeout = 10 * time.Second
+)
+
+// outgoingTranslationExpiry is how long finished outgoing translations are kept if the message is never sent.
+const outgoingTranslationExpiry = 1 * time.Minute
+
+// Translator translates text into the given target language using an external translation API.
+// If isHTML is true, the text is HTML and the markup is preserved in the translation.
+type Translator interface {
+	Translate(ctx context.Context, text, targetLang string, isHTML bool) (string, error)
+}
+
+func (br *WABridge) getTranslationTimeout() time.Duration {
+	if br.Config.Bridge.Translation.Timeout == 0 {
+		return defaultTranslationTimeout
+	}
+	return br.Config.Bridge.Translation.Timeout
+}
+
+// NewTranslator creates a translator for the configured provider, or returns nil if translation is disabled.
+func NewTranslator(br *WABridge) (Translator, error) {
+	cfg := br.Config.Bridge.Translation
+	client := &http.Client{Timeout: br.getTranslationTimeout()}
+	switch strings.ToLower(cfg.Provider) {
+	case "":
+		return nil, nil
+	case TranslationProviderLibreTranslate:
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("translation URL is required for %s", TranslationProviderLibreTranslate)
+		}
+		return &libreTranslateClient{url: strings.TrimSuffix(cfg.URL, "/"), apiKey: cfg.APIKey, client: client}, nil
+	case TranslationProviderDeepL:
+		url := cfg.URL
+		if url == "" {
+			url = defaultDeepLURL
+		}
+		return &deepLClient{url: strings.TrimSuffix(url, "/"), apiKey: cfg.APIKey, client: client}, nil
+	default:
+		return nil, fmt.Errorf("unknown translation provider %q", cfg.Provider)
+	}
+}
+
+func doTranslationRequest(ctx context.Context, client *http.Client, req *http.Request, respData any) error {
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	err = json.NewDecoder(resp.Body).Decode(respData)
+	if err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+type libreTranslateClient struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+type libreTranslateRequest struct {
+	Query  string `json:"q"`
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Format string `json:"format"`
+	APIKey string `json:"api_key,omitempty"`
+}
+
+type libreTranslateResponse struct {
+	TranslatedText string `json:"translatedText"`
+}
+
+func (lt *libreTranslateClient) Translate(ctx context.Context, text, targetLang string, isHTML bool) (string, error) {
+	textFormat := "text"
+	if isHTML {
+		textFormat = "html"
+	}
+	reqBody, err := json.Marshal(&libreTranslateRequest{
+		Query:  text,
+		Source: "auto",
+		Target: strings.ToLower(targetLang),
+		Format: textFormat,
+		APIKey: lt.apiKey,
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, lt.url+"/translate", bytes.NewReader(reqBody))
+	if err != nil {
+		return "", err
+	}
+	var resp libreTranslateResponse
+	err = doTranslationRequest(ctx, lt.client, req, &resp)
+	return resp.TranslatedText, err
+}
+
+type deepLClient struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+type deepLRequest struct {
+	Text        []string `json:"text"`
+	TargetLang  string   `json:"target_lang"`
+	TagHandling string   `json:"tag_handling,omitempty"`
+}
+
+type deepLResponse struct {
+	Translations []struct {
+		Text string `json:"text"`
+	} `json:"translations"`
+}
+
+func (dl *deepLClient) Translate(ctx context.Context, text, targetLang string, isHTML bool) (string, error) {
+	var tagHandling string
+	if isHTML {
+		tagHandling = "html"
+	}
+	reqBody, err := json.Marshal(&deepLRequest{
+		Text:        []string{text},
+		TargetLang:  strings.ToUpper(targetLang),
+		TagHandling: tagHandling,
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, dl.url+"/v2/translate", bytes.NewReader(reqBody))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "DeepL-Auth-Key "+dl.apiKey)
+	var resp deepLResponse
+	err = doTranslationRequest(ctx, dl.client, req, &resp)
+	if err != nil {
+		return "", err
+	} else if len(resp.Translations) == 0 {
+		return "", fmt.Errorf("no translations in response")
+	}
+	return resp.Translations[0].Text, nil
+}
+
+func isTranslatableContent(content *event.MessageEventContent) bool {
+	switch content.MsgType {
+	case event.MsgText, event.MsgNotice, event.MsgEmote:
+		return len(strings.TrimSpace(content.Body)) > 0
+	default:
+		return false
+	}
+}
+
+// addIncomingTranslation appends a translation of an incoming WhatsApp message (or its caption)
+// in the portal's incoming translation language.
+func (portal *Portal) addIncomingTranslation(ctx context.Context, converted *ConvertedMessage) {
+	content := converted.Content
+	if converted.Caption != nil {
+		content = converted.Caption
+	}
+	if portal.bridge.Translator == nil || !isTranslatableContent(content) {
+		return
+	}
+	translated, err := portal.bridge.Translator.Translate(ctx, content.Body, portal.TranslateIncoming, false)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Str("target_lang", portal.TranslateIncoming).Msg("Failed to translate incoming message")
+		return
+	} else if len(translated) == 0 || translated == content.Body {
+		return
+	}
+	content.EnsureHasHTML()
+	content.Body += "\n\n🌐 " + translated
+	content.FormattedBody += "<br><br>🌐 <em>" + strings.ReplaceAll(html.EscapeString(translated), "\n", "<br>") + "</em>"
+}
+
+type outgoingTranslation struct {
+	done       chan struct{}
+	sourceBody string
+	isHTML     bool
+	translated string
+	err        error
+}
+
+// startOutgoingTranslation starts translating an outgoing Matrix message in the background as soon as it's received,
+// so that the translation API request doesn't block the portal's event loop. The result is picked up by
+// translateOutgoing when the message is converted.
+func (portal *Portal) startOutgoingTranslation(evt *event.Event) {
+	targetLang := portal.TranslateOutgoing
+	if portal.bridge.Translator == nil || len(targetLang) == 0 || evt.Type != event.EventMessage {
+		return
+	}
+	msgContent, ok := evt.Content.Parsed.(*event.MessageEventContent)
+	if !ok {
+		return
+	} else if msgContent.NewContent != nil {
+		msgContent = msgContent.NewContent
+	}
+	// Translate a copy with the relay identity override removed, as that's what's left when the message is converted.
+	content := *msgContent
+	getRelayIdentityOverride(evt, &content)
+	if !isTranslatableContent(&content) {
+		return
+	}
+	tr := &outgoingTranslation{
+		done:       make(chan struct{}),
+		sourceBody: content.Body,
+		isHTML:     content.Format == event.FormatHTML,
+	}
+	portal.outgoingTranslationsLock.Lock()
+	if portal.outgoingTranslations == nil {
+		portal.outgoingTranslations = make(map[id.EventID]*outgoingTranslation)
+	}
+	portal.outgoingTranslations[evt.ID] = tr
+	portal.outgoingTranslationsLock.Unlock()
+	go func() {
+		defer close(tr.done)
+		ctx, cancel := context.WithTimeout(context.Background(), portal.bridge.getTranslationTimeout())
+		defer cancel()
+		text := content.Body
+		if tr.isHTML {
+			text = content.FormattedBody
+		}
+		tr.translated, tr.err = portal.bridge.Translator.Translate(ctx, text, targetLang, tr.isHTML)
+		time.AfterFunc(outgoingTranslationExpiry, func() {
+			portal.outgoingTranslationsLock.Lock()
+			if portal.outgoingTranslations[evt.ID] == tr {
+				delete(portal.outgoingTranslations, evt.ID)
+			}
+			portal.outgoingTranslationsLock.Unlock()
+		})
+	}()
+}
+
+// translateOutgoing replaces the text of an outgoing Matrix message with the translation started by
+// startOutgoingTranslation. Formatting and mentions are kept. The original is sent if translation fails.
+func (portal *Portal) translateOutgoing(ctx context.Context, evtID id.EventID, content *event.MessageEventContent) {
+	portal.outgoingTranslationsLock.Lock()
+	tr, ok := portal.outgoingTranslations[evtID]
+	delete(portal.outgoingTranslations, evtID)
+	portal.outgoingTranslationsLock.Unlock()
+	if !ok {
+		return
+	}
+	log := zerolog.Ctx(ctx)
+	timeout := time.NewTimer(portal.bridge.getTranslationTimeout())
+	defer timeout.Stop()
+	select {
+	case <-tr.done:
+	case <-timeout.C:
+		log.Warn().Msg("Timed out waiting for outgoing message translation")
+		return
+	case <-ctx.Done():
+		return
+	}
+	if tr.err != nil {
+		log.Warn().Err(tr.err).Str("target_lang", portal.TranslateOutgoing).Msg("Failed to translate outgoing message")
+		return
+	} else if len(tr.translated) == 0 {
+		return
+	} else if content.Body != tr.sourceBody {
+		log.Debug().Msg("Message content changed after translation was started, not using translation")
+		return
+	}
+	if tr.isHTML {
+		content.FormattedBody = tr.translated
+		content.Body = format.HTMLToText(tr.translated)
+	} else {
+		content.Body = tr.translated
+	}
+}
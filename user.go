@@ -18,9 +18,6 @@ package main
 
 import (
 	"context"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -30,6 +27,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -69,19 +67,46 @@ type User struct {
 	RelayWhitelisted bool
 	PermissionLevel  bridgeconfig.PermissionLevel
 
-	mgmtCreateLock  sync.Mutex
-	spaceCreateLock sync.Mutex
-	connLock        sync.Mutex
+	mgmtCreateLock         sync.Mutex
+	spaceCreateLock        sync.Mutex
+	archiveSpaceCreateLock sync.Mutex
+	connLock               sync.Mutex
+
+	connectedSince     time.Time
+	disconnectedAt     time.Time
+	connectedSinceLock sync.Mutex
+	groupResyncRunning atomic.Bool
+
+	firstMessagePending atomic.Bool
+
+	outgoingQueueLock sync.Mutex
 
 	historySyncs chan *events.HistorySync
+	initialSync  initialSyncStatus
 	lastPresence types.Presence
 
+	activePresenceTimer *time.Timer
+	activePresenceLock  sync.Mutex
+
+	lastSeenCache      map[types.JID]lastSeenInfo
+	lastSeenWaiters    map[types.JID][]chan struct{}
+	lastSeenLoopCancel context.CancelFunc
+	lastSeenLock       sync.Mutex
+
 	mediaRetryLock *semaphore.Weighted
 
 	historySyncLoopsStarted bool
 	enqueueBackfillsTimer   *time.Timer
 	spaceMembershipChecked  bool
 	lastPhoneOfflineWarning time.Time
+	keepAliveLock           sync.Mutex
+	lastKeepAliveSuccess    time.Time
+	keepAliveErrorCount     int
+
+	streamErrorLock          sync.Mutex
+	sendsPausedUntil         time.Time
+	internalServerErrorCount uint
+	internalServerErrorTimer *time.Timer
 
 	groupListCache     []*types.GroupInfo
 	groupListCacheLock sync.Mutex
@@ -97,6 +122,12 @@ type User struct {
 	createKeyDedup       string
 	skipGroupCreateDelay types.JID
 	groupJoinLock        sync.Mutex
+
+	chatFilters     map[types.JID]database.ChatFilterAction
+	chatFiltersLock sync.Mutex
+
+	pendingGroupInvites     map[types.JID]struct{}
+	pendingGroupInvitesLock sync.Mutex
 }
 
 type resyncQueueItem struct {
@@ -191,6 +222,12 @@ func (user *User) removeFromJIDMap(state status.BridgeState) {
 	user.bridge.usersLock.Unlock()
 	user.bridge.Metrics.TrackLoginState(user.JID, false)
 	user.BridgeState.Send(state)
+	user.bridge.Webhooks.Send(WebhookUserLoggedOut, map[string]any{
+		"user_id": user.MXID,
+		"jid":     user.JID,
+		"state":   state.StateEvent,
+		"reason":  state.Error,
+	})
 }
 
 func (br *WABridge) GetAllUsers() []*User {
@@ -220,6 +257,8 @@ func (br *WABridge) loadDBUser(ctx context.Context, dbUser *database.User, mxid
 		}
 		dbUser = br.DB.User.New()
 		dbUser.MXID = *mxid
+		// New users have never had their raw user ID sent to analytics
+		dbUser.AnalyticsAliased = true
 		err := dbUser.Insert(ctx)
 		if err != nil {
 			br.ZLog.Error().Err(err).Msg("Failed to insert new user into database")
@@ -228,6 +267,9 @@ func (br *WABridge) loadDBUser(ctx context.Context, dbUser *database.User, mxid
 	}
 	user := br.NewUser(dbUser)
 	br.usersByMXID[user.MXID] = user
+	if user.AnalyticsOptOut {
+		Analytics.SetOptOut(user.MXID, true)
+	}
 	if !user.JID.IsEmpty() {
 		var err error
 		user.Session, err = br.WAContainer.GetDevice(user.JID)
@@ -246,7 +288,7 @@ func (br *WABridge) loadDBUser(ctx context.Context, dbUser *database.User, mxid
 		}
 	}
 	if len(user.ManagementRoom) > 0 {
-		br.managementRooms[user.ManagementRoom] = user
+		br.managementRooms[user.ManagementRoom] = append(br.managementRooms[user.ManagementRoom], user)
 	}
 	return user
 }
@@ -262,6 +304,9 @@ func (br *WABridge) NewUser(dbUser *database.User) *User {
 
 		resyncQueue: make(map[types.JID]resyncQueueItem),
 
+		lastSeenCache:   make(map[types.JID]lastSeenInfo),
+		lastSeenWaiters: make(map[types.JID][]chan struct{}),
+
 		mediaRetryLock: semaphore.NewWeighted(br.Config.Bridge.HistorySync.MediaRequests.MaxAsyncHandle),
 	}
 
@@ -328,7 +373,7 @@ func (user *User) doPuppetResync() {
 		return
 	}
 	log := user.zlog.With().Str("action", "puppet resync").Logger()
-	ctx := log.WithContext(context.TODO())
+	ctx := WithRequestPriority(log.WithContext(context.TODO()), PriorityProfile)
 	queue := user.resyncQueue
 	user.resyncQueue = make(map[types.JID]resyncQueueItem)
 	user.resyncQueueLock.Unlock()
@@ -428,7 +473,7 @@ func (user *User) ensureInvited(ctx context.Context, intent *appservice.IntentAP
 }
 
 func (user *User) GetSpaceRoom(ctx context.Context) id.RoomID {
-	if !user.bridge.Config.Bridge.PersonalFilteringSpaces {
+	if !user.bridge.Config.Bridge.PersonalSpacesEnabled() {
 		return ""
 	}
 
@@ -439,18 +484,23 @@ func (user *User) GetSpaceRoom(ctx context.Context) id.RoomID {
 			return user.SpaceRoom
 		}
 
-		resp, err := user.bridge.Bot.CreateRoom(ctx, &mautrix.ReqCreateRoom{
-			Visibility: "private",
-			Name:       "WhatsApp",
-			Topic:      "Your WhatsApp bridged chats",
-			InitialState: []*event.Event{{
-				Type: event.StateRoomAvatar,
-				Content: event.Content{
-					Parsed: &event.RoomAvatarEventContent{
-						URL: user.bridge.Config.AppService.Bot.ParsedAvatar,
-					},
+		name, topic, avatar := user.bridge.getPersonalSpaceMeta()
+		initialState := []*event.Event{{
+			Type: event.StateRoomAvatar,
+			Content: event.Content{
+				Parsed: &event.RoomAvatarEventContent{
+					URL: avatar,
 				},
-			}},
+			},
+		}}
+		if user.bridge.Config.Bridge.WelcomeSpace.Enabled && user.ManagementRoom != "" {
+			initialState = append(initialState, user.bridge.managementRoomSpaceChild(user.ManagementRoom))
+		}
+		resp, err := user.bridge.Bot.CreateRoom(ctx, &mautrix.ReqCreateRoom{
+			Visibility:   "private",
+			Name:         name,
+			Topic:        topic,
+			InitialState: initialState,
 			CreationContent: map[string]interface{}{
 				"type": event.RoomTypeSpace,
 			},
@@ -508,8 +558,18 @@ func (user *User) GetManagementRoom(ctx context.Context) id.RoomID {
 func (user *User) SetManagementRoom(roomID id.RoomID) {
 	ctx := context.TODO()
 
-	existingUser, ok := user.bridge.managementRooms[roomID]
-	if ok {
+	user.bridge.managementRoomsLock.Lock()
+	oldRoomID := user.ManagementRoom
+	if user.ManagementRoom != "" {
+		user.bridge.removeManagementRoomUser(user.ManagementRoom, user)
+	}
+	existingUsers := user.bridge.managementRooms[roomID]
+	keptUsers := make([]*User, 0, len(existingUsers)+1)
+	for _, existingUser := range existingUsers {
+		if user.canShareManagementRoom(existingUser) {
+			keptUsers = append(keptUsers, existingUser)
+			continue
+		}
 		existingUser.ManagementRoom = ""
 		err := existingUser.Update(ctx)
 		if err != nil {
@@ -518,23 +578,20 @@ func (user *User) SetManagementRoom(roomID id.RoomID) {
 				Msg("Failed to save previous user after removing from old management room")
 		}
 	}
-
 	user.ManagementRoom = roomID
-	user.bridge.managementRooms[user.ManagementRoom] = user
+	user.bridge.managementRooms[roomID] = append(keptUsers, user)
+	user.bridge.managementRoomsLock.Unlock()
 	err := user.Update(ctx)
 	if err != nil {
 		user.zlog.Err(err).Msg("Failed to save user after setting management room")
 	}
+	if user.bridge.Config.Bridge.WelcomeSpace.Enabled && oldRoomID != roomID {
+		go user.updateWelcomeSpace(ctx, oldRoomID, roomID)
+	}
 }
 
 var ErrAlreadyLoggedIn = errors.New("already logged in")
 
-func (user *User) obfuscateJID(jid types.JID) string {
-	// Turn the first 4 bytes of HMAC-SHA256(hs_token, phone) into a number and replace the middle of the actual phone with that deterministic random number.
-	randomNumber := binary.BigEndian.Uint32(hmac.New(sha256.New, []byte(user.bridge.Config.AppService.HSToken)).Sum([]byte(jid.User))[:4])
-	return fmt.Sprintf("+%s-%d-%s:%d", jid.User[:1], randomNumber, jid.User[len(jid.User)-2:], jid.Device)
-}
-
 func (user *User) createClient(sess *store.Device) {
 	user.Client = whatsmeow.NewClient(sess, waLog.Zerolog(user.zlog.With().Str("component", "whatsmeow").Logger()))
 	user.Client.AddEventHandler(user.HandleEvent)
@@ -542,7 +599,7 @@ func (user *User) createClient(sess *store.Device) {
 	user.Client.AutomaticMessageRerequestFromPhone = true
 	user.Client.GetMessageForRetry = func(requester, to types.JID, id types.MessageID) *waProto.Message {
 		Analytics.Track(user.MXID, "WhatsApp incoming retry (message not found)", map[string]interface{}{
-			"requester": user.obfuscateJID(requester),
+			"requester": Analytics.PseudonymizeJID(requester),
 			"messageID": id,
 		})
 		user.bridge.Metrics.TrackRetryReceipt(0, false)
@@ -550,7 +607,7 @@ func (user *User) createClient(sess *store.Device) {
 	}
 	user.Client.PreRetryCallback = func(receipt *events.Receipt, messageID types.MessageID, retryCount int, msg *waProto.Message) bool {
 		Analytics.Track(user.MXID, "WhatsApp incoming retry (accepted)", map[string]interface{}{
-			"requester":  user.obfuscateJID(receipt.Sender),
+			"requester":  Analytics.PseudonymizeJID(receipt.Sender),
 			"messageID":  messageID,
 			"retryCount": retryCount,
 		})
@@ -615,6 +672,7 @@ func (user *User) unlockedDeleteConnection() {
 	user.Client.RemoveEventHandlers()
 	user.Client = nil
 	user.bridge.Metrics.TrackConnectionState(user.JID, false)
+	user.trackConnectionUptime(false)
 }
 
 func (user *User) DeleteConnection() {
@@ -629,6 +687,7 @@ func (user *User) HasSession() bool {
 
 func (user *User) DeleteSession(ctx context.Context) {
 	log := zerolog.Ctx(ctx)
+	user.stopLastSeenRefreshLoop()
 	if user.Session != nil {
 		err := user.Session.Delete()
 		if err != nil {
@@ -637,6 +696,7 @@ func (user *User) DeleteSession(ctx context.Context) {
 		user.Session = nil
 	}
 	if !user.JID.IsEmpty() {
+		user.PreviousJID = user.JID.ToNonAD()
 		user.JID = types.EmptyJID
 		err := user.Update(ctx)
 		if err != nil {
@@ -683,31 +743,6 @@ func (user *User) sendMarkdownBridgeAlert(ctx context.Context, formatString stri
 	}
 }
 
-const callEventMaxAge = 15 * time.Minute
-
-func (user *User) handleCallStart(sender types.JID, id, callType string, ts time.Time) {
-	if !user.bridge.Config.Bridge.CallStartNotices || ts.Add(callEventMaxAge).Before(time.Now()) {
-		return
-	}
-	portal := user.GetPortalByJID(sender)
-	text := "Incoming call. Use the WhatsApp app to answer."
-	if callType != "" {
-		text = fmt.Sprintf("Incoming %s call. Use the WhatsApp app to answer.", callType)
-	}
-	portal.events <- &PortalEvent{
-		Message: &PortalMessage{
-			fake: &fakeMessage{
-				Sender:    sender,
-				Text:      text,
-				ID:        id,
-				Time:      ts,
-				Important: true,
-			},
-			source: user,
-		},
-	}
-}
-
 const PhoneDisconnectWarningTime = 12 * 24 * time.Hour // 12 days
 const PhoneDisconnectPingTime = 10 * 24 * time.Hour
 const PhoneMinPingInterval = 24 * time.Hour
@@ -812,9 +847,12 @@ func (user *User) HandleEvent(event interface{}) {
 		WithContext(context.TODO())
 	switch v := event.(type) {
 	case *events.LoggedOut:
+		user.bridge.Metrics.TrackStreamError(StreamErrorLoggedOut)
 		go user.handleLoggedOut(ctx, v.OnConnect, v.Reason)
 	case *events.Connected:
+		user.resetStreamErrorBackoff()
 		user.bridge.Metrics.TrackConnectionState(user.JID, true)
+		user.trackConnectionUptime(true)
 		user.bridge.Metrics.TrackLoginState(user.JID, true)
 		if len(user.Client.Store.PushName) > 0 {
 			go func() {
@@ -825,11 +863,17 @@ func (user *User) HandleEvent(event interface{}) {
 			}()
 		}
 		go user.tryAutomaticDoublePuppeting()
+		go user.resyncOutdatedPuppetNames()
+		go user.startGroupResync()
+		go user.sendQueuedMessages()
 
 		if user.bridge.Config.Bridge.HistorySync.Backfill && !user.historySyncLoopsStarted {
 			go user.handleHistorySyncsLoop()
 			user.historySyncLoopsStarted = true
 		}
+		if user.bridge.Config.Bridge.LastSeenTopic.Enabled {
+			user.startLastSeenRefreshLoop()
+		}
 	case *events.OfflineSyncPreview:
 		user.zlog.Info().
 			Int("message_count", v.Messages).
@@ -883,11 +927,24 @@ func (user *User) HandleEvent(event interface{}) {
 		user.PhoneLastSeen = time.Now()
 		user.Session = user.Client.Store
 		user.JID = v.ID
+		if user.PreviousJID.User == v.ID.User {
+			user.PreviousJID = types.EmptyJID
+		}
+		user.firstMessagePending.Store(true)
+		if user.bridge.Config.Bridge.HistorySync.InitialSyncSummary.Enabled {
+			user.markInitialSyncPending()
+		}
 		user.addToJIDMap()
 		err := user.Update(ctx)
 		if err != nil {
 			user.zlog.Err(err).Msg("Failed to save user after pair success")
 		}
+		go user.checkNumberChange(ctx, v.ID)
+		user.bridge.Webhooks.Send(WebhookUserLoggedIn, map[string]any{
+			"user_id":  user.MXID,
+			"jid":      v.ID,
+			"platform": v.Platform,
+		})
 	case *events.StreamError:
 		var message string
 		if v.Code != "" {
@@ -897,30 +954,37 @@ func (user *User) HandleEvent(event interface{}) {
 		} else {
 			message = "Unknown stream error"
 		}
-		user.BridgeState.Send(status.BridgeState{StateEvent: status.StateUnknownError, Message: message})
 		user.bridge.Metrics.TrackConnectionState(user.JID, false)
+		go user.handleStreamErrorCategory(StreamErrorUnknown, message)
 	case *events.StreamReplaced:
+		user.bridge.Metrics.TrackStreamError(StreamErrorConflict)
 		if user.bridge.Config.Bridge.CrashOnStreamReplaced {
 			user.zlog.Info().Msg("Stopping bridge due to StreamReplaced event")
 			user.bridge.ManualStop(60)
 		} else {
 			user.BridgeState.Send(status.BridgeState{StateEvent: status.StateUnknownError, Message: "Stream replaced"})
+			Analytics.Track(user.MXID, AnalyticsPermanentDisconnect, map[string]interface{}{"category": string(StreamErrorConflict)})
 			user.bridge.Metrics.TrackConnectionState(user.JID, false)
+			user.trackConnectionUptime(false)
 			user.sendMarkdownBridgeAlert(ctx, "The bridge was started in another location. Use `reconnect` to reconnect this one.")
 		}
 	case *events.ConnectFailure:
-		user.BridgeState.Send(status.BridgeState{StateEvent: status.StateUnknownError, Message: fmt.Sprintf("Unknown connection failure: %s (%s)", v.Reason, v.Message)})
 		user.bridge.Metrics.TrackConnectionState(user.JID, false)
 		user.bridge.Metrics.TrackConnectionFailure(fmt.Sprintf("status-%d", v.Reason))
+		go user.handleStreamErrorCategory(classifyConnectFailure(v.Reason), fmt.Sprintf("Unknown connection failure: %s (%s)", v.Reason, v.Message))
 	case *events.ClientOutdated:
 		user.zlog.Error().Msg("Got a client outdated connect failure. The bridge is likely out of date, please update immediately.")
 		user.BridgeState.Send(status.BridgeState{StateEvent: status.StateUnknownError, Message: "Connect failure: 405 client outdated"})
 		user.bridge.Metrics.TrackConnectionState(user.JID, false)
 		user.bridge.Metrics.TrackConnectionFailure("client-outdated")
+		user.bridge.Metrics.TrackStreamError(StreamErrorClientOutdated)
+		Analytics.Track(user.MXID, AnalyticsPermanentDisconnect, map[string]interface{}{"category": string(StreamErrorClientOutdated)})
 	case *events.TemporaryBan:
-		user.BridgeState.Send(status.BridgeState{StateEvent: status.StateBadCredentials, Message: v.String()})
+		user.BridgeState.Send(status.BridgeState{StateEvent: status.StateBadCredentials, Error: WATemporaryBan, Message: v.String()})
 		user.bridge.Metrics.TrackConnectionState(user.JID, false)
 		user.bridge.Metrics.TrackConnectionFailure("temporary-ban")
+		user.bridge.Metrics.TrackStreamError(StreamErrorTemporaryBan)
+		go user.pauseSends(ctx, v.Expire)
 	case *events.Disconnected:
 		// Don't send the normal transient disconnect state if we're already in a different transient disconnect state.
 		// TODO remove this if/when the phone offline state is moved to a sub-state of CONNECTED
@@ -928,6 +992,11 @@ func (user *User) HandleEvent(event interface{}) {
 			user.BridgeState.Send(status.BridgeState{StateEvent: status.StateTransientDisconnect, Error: WADisconnected})
 		}
 		user.bridge.Metrics.TrackConnectionState(user.JID, false)
+		user.trackConnectionUptime(false)
+		user.bridge.Webhooks.Send(WebhookUserDisconnected, map[string]any{
+			"user_id": user.MXID,
+			"jid":     user.JID,
+		})
 	case *events.Contact:
 		go user.syncPuppet(v.JID, "contact event")
 	case *events.PushName:
@@ -951,9 +1020,15 @@ func (user *User) HandleEvent(event interface{}) {
 			user.phoneSeen(v.Timestamp)
 		}
 		go user.handleReceipt(v)
+	case *events.Presence:
+		go user.handlePresence(ctx, v)
 	case *events.ChatPresence:
 		go user.handleChatPresence(ctx, v)
 	case *events.Message:
+		if user.IsChatFiltered(ctx, v.Info.Chat) {
+			zerolog.Ctx(ctx).Debug().Stringer("chat_jid", v.Info.Chat).Msg("Ignoring message in filtered chat")
+			return
+		}
 		portal := user.GetPortalByMessageSource(v.Info.MessageSource)
 		portal.events <- &PortalEvent{
 			Message: &PortalMessage{evt: v, source: user},
@@ -963,9 +1038,13 @@ func (user *User) HandleEvent(event interface{}) {
 		portal := user.GetPortalByJID(v.ChatID)
 		go portal.handleMediaRetry(v, user)
 	case *events.CallOffer:
-		user.handleCallStart(v.CallCreator, v.CallID, "", v.Timestamp)
+		user.handleCallStart(v.BasicCallMeta, getCallMedia(v), "")
 	case *events.CallOfferNotice:
-		user.handleCallStart(v.CallCreator, v.CallID, v.Type, v.Timestamp)
+		user.handleCallStart(v.BasicCallMeta, v.Media, v.Type)
+	case *events.CallAccept:
+		user.handleCallAccept(v.BasicCallMeta)
+	case *events.CallTerminate:
+		user.handleCallEnd(v.BasicCallMeta, v.Reason)
 	case *events.IdentityChange:
 		puppet := user.bridge.GetPuppetByJID(v.JID)
 		if puppet == nil {
@@ -990,9 +1069,12 @@ func (user *User) HandleEvent(event interface{}) {
 				},
 			}
 		}
-	case *events.CallTerminate, *events.CallRelayLatency, *events.CallAccept, *events.UnknownCallEvent:
+	case *events.CallRelayLatency, *events.UnknownCallEvent:
 		// ignore
 	case *events.UndecryptableMessage:
+		if user.IsChatFiltered(ctx, v.Info.Chat) {
+			return
+		}
 		portal := user.GetPortalByMessageSource(v.Info.MessageSource)
 		portal.events <- &PortalEvent{
 			Message: &PortalMessage{undecryptable: v, source: user},
@@ -1020,23 +1102,41 @@ func (user *User) HandleEvent(event interface{}) {
 		if portal != nil {
 			go user.updateChatTag(ctx, nil, portal, user.bridge.Config.Bridge.PinnedTag, v.Action.GetPinned())
 		}
+	case *events.LabelEdit:
+		user.handleLabelEdit(ctx, v)
+	case *events.LabelAssociationChat:
+		user.handleLabelAssociation(ctx, v)
 	case *events.AppState:
 		// Ignore
 	case *events.KeepAliveTimeout:
+		user.keepAliveLock.Lock()
+		user.keepAliveErrorCount = v.ErrorCount
+		user.lastKeepAliveSuccess = v.LastSuccess
+		user.keepAliveLock.Unlock()
 		user.BridgeState.Send(status.BridgeState{StateEvent: status.StateTransientDisconnect, Error: WAKeepaliveTimeout})
 	case *events.KeepAliveRestored:
+		user.keepAliveLock.Lock()
+		user.keepAliveErrorCount = 0
+		user.lastKeepAliveSuccess = time.Now()
+		user.keepAliveLock.Unlock()
 		user.zlog.Info().Msg("Keepalive restored after timeouts, sending connected event")
 		user.BridgeState.Send(status.BridgeState{StateEvent: status.StateConnected})
 	case *events.MarkChatAsRead:
+		ctx, done := user.bridge.withWhatsAppDeadline(ctx)
+		defer done()
 		if user.bridge.Config.Bridge.SyncManualMarkedUnread {
 			user.markUnread(ctx, user.GetPortalByJID(v.JID), !v.Action.GetRead())
 		}
 	case *events.DeleteForMe:
+		ctx, done := user.bridge.withWhatsAppDeadline(ctx)
+		defer done()
 		portal := user.GetPortalByJID(v.ChatJID)
 		if portal != nil {
 			portal.deleteForMe(ctx, user, v)
 		}
 	case *events.DeleteChat:
+		ctx, done := user.bridge.withWhatsAppDeadline(ctx)
+		defer done()
 		portal := user.GetPortalByJID(v.JID)
 		if portal != nil {
 			portal.HandleWhatsAppDeleteChat(ctx, user)
@@ -1157,6 +1257,7 @@ func (user *User) syncChatDoublePuppetDetails(ctx context.Context, portal *Porta
 		user.updateChatMute(ctx, intent, portal, chat.MutedUntil)
 		user.updateChatTag(ctx, intent, portal, user.bridge.Config.Bridge.ArchiveTag, chat.Archived)
 		user.updateChatTag(ctx, intent, portal, user.bridge.Config.Bridge.PinnedTag, chat.Pinned)
+		user.syncPortalLabelTags(ctx, portal)
 	}
 }
 
@@ -1230,8 +1331,10 @@ func (user *User) handleLoggedOut(ctx context.Context, onConnect bool, reason ev
 		errorCode = WAMainDeviceGone
 	}
 	user.removeFromJIDMap(status.BridgeState{StateEvent: status.StateBadCredentials, Error: errorCode})
+	Analytics.Track(user.MXID, AnalyticsLogout, map[string]interface{}{"reason": string(errorCode)})
 	user.DeleteConnection()
 	user.Session = nil
+	user.PreviousJID = user.JID.ToNonAD()
 	user.JID = types.EmptyJID
 	err := user.Update(ctx)
 	if err != nil {
@@ -1264,7 +1367,9 @@ func (user *User) GetPortalByJID(jid types.JID) *Portal {
 }
 
 func (user *User) syncPuppet(jid types.JID, reason string) {
-	user.bridge.GetPuppetByJID(jid).SyncContact(user.zlog.WithContext(context.TODO()), user, false, false, reason)
+	ctx, done := user.bridge.withWhatsAppDeadline(user.zlog.WithContext(context.TODO()))
+	defer done()
+	user.bridge.GetPuppetByJID(jid).SyncContact(ctx, user, false, false, reason)
 }
 
 func (user *User) ResyncContacts(forceAvatarSync bool) error {
@@ -1285,6 +1390,48 @@ func (user *User) ResyncContacts(forceAvatarSync bool) error {
 	return nil
 }
 
+// resyncOutdatedPuppetNames re-renders the displaynames of puppets which were named using a different template
+// than the bridge-wide displayname template that is currently configured.
+func (user *User) resyncOutdatedPuppetNames() {
+	contacts, err := user.Client.Store.Contacts.GetAllContacts()
+	if err != nil {
+		user.zlog.Err(err).Msg("Failed to get cached contacts to check for outdated puppet names")
+		return
+	}
+	templateID := user.bridge.Config.Bridge.DisplaynameTemplateID("")
+	ctx := user.zlog.With().Str("action", "resync outdated puppet names").Logger().WithContext(context.TODO())
+	count := 0
+	for jid, contact := range contacts {
+		puppet := user.bridge.GetPuppetByJID(jid)
+		if puppet == nil || puppet.NameTemplate == templateID {
+			continue
+		}
+		puppet.Sync(ctx, user, &contact, false, true)
+		count++
+	}
+	if count > 0 {
+		user.zlog.Info().Int("puppet_count", count).Msg("Re-rendered puppet displaynames after template change")
+	}
+}
+
+// resyncPrivateChatNames re-renders the names of the user's private chat portals after the user's
+// displayname preference has changed.
+func (user *User) resyncPrivateChatNames() {
+	ctx := user.zlog.With().Str("action", "resync private chat names").Logger().WithContext(context.TODO())
+	for _, portal := range user.bridge.GetAllPortals() {
+		if !portal.IsPrivateChat() || portal.Key.Receiver != user.JID.ToNonAD() || len(portal.MXID) == 0 {
+			continue
+		}
+		puppet := user.bridge.GetPuppetByJID(portal.Key.JID)
+		if puppet == nil {
+			continue
+		}
+		portal.roomCreateLock.Lock()
+		portal.UpdateName(ctx, portal.privateChatName(user, puppet), types.EmptyJID, true)
+		portal.roomCreateLock.Unlock()
+	}
+}
+
 func (user *User) ResyncGroups(createPortals bool) error {
 	groups, err := user.Client.GetJoinedGroups()
 	if err != nil {
@@ -1298,7 +1445,7 @@ func (user *User) ResyncGroups(createPortals bool) error {
 	for _, group := range groups {
 		portal := user.GetPortalByJID(group.JID)
 		if len(portal.MXID) == 0 {
-			if createPortals {
+			if createPortals && !user.IsChatFiltered(ctx, group.JID) {
 				err = portal.CreateMatrixRoom(ctx, user, group, nil, true, true)
 				if err != nil {
 					return fmt.Errorf("failed to create room for %s: %w", group.JID, err)
@@ -1314,6 +1461,9 @@ func (user *User) ResyncGroups(createPortals bool) error {
 const WATypingTimeout = 15 * time.Second
 
 func (user *User) handleChatPresence(ctx context.Context, presence *events.ChatPresence) {
+	if !user.IsDeliveryEnabled(database.DeliveryReceiveTyping) {
+		return
+	}
 	puppet := user.bridge.GetPuppetByJID(presence.Sender)
 	if puppet == nil {
 		return
@@ -1339,7 +1489,22 @@ func (user *User) handleChatPresence(ctx context.Context, presence *events.ChatP
 }
 
 func (user *User) handleReceipt(receipt *events.Receipt) {
-	if receipt.Type != types.ReceiptTypeRead && receipt.Type != types.ReceiptTypeReadSelf && receipt.Type != types.ReceiptTypeDelivered {
+	switch receipt.Type {
+	case types.ReceiptTypeReadSelf:
+		// Own read receipts from other devices are always bridged
+	case types.ReceiptTypeRead:
+		if !user.IsDeliveryEnabled(database.DeliveryReceiveReadReceipts) {
+			return
+		}
+	case types.ReceiptTypeDelivered:
+		if !user.IsDeliveryEnabled(database.DeliveryReceiveDeliveryReceipts) {
+			return
+		}
+	case types.ReceiptTypePlayed:
+		if !user.IsDeliveryEnabled(database.DeliveryReceivePlayedReceipts) && !user.IsDeliveryEnabled(database.DeliveryReceiveReadReceipts) {
+			return
+		}
+	default:
 		return
 	}
 	portal := user.GetPortalByMessageSource(receipt.MessageSource)
@@ -1418,7 +1583,8 @@ func (user *User) markUnread(ctx context.Context, portal *Portal, unread bool) {
 
 func (user *User) handleGroupCreate(evt *events.JoinedGroup) {
 	log := user.zlog.With().Str("whatsapp_event", "JoinedGroup").Logger()
-	ctx := log.WithContext(context.TODO())
+	ctx, done := user.bridge.withWhatsAppDeadline(log.WithContext(context.TODO()))
+	defer done()
 	portal := user.GetPortalByJID(evt.JID)
 	if evt.CreateKey == "" && len(portal.MXID) == 0 && portal.Key.JID != user.skipGroupCreateDelay {
 		log.Debug().Msg("Delaying handling group create with empty key to avoid race conditions")
@@ -1428,6 +1594,13 @@ func (user *User) handleGroupCreate(evt *events.JoinedGroup) {
 		if user.createKeyDedup != "" && evt.CreateKey == user.createKeyDedup {
 			log.Debug().Str("create_key", evt.CreateKey).Msg("Ignoring group create event with cached create key")
 			return
+		} else if user.IsChatFiltered(ctx, evt.JID) {
+			log.Debug().Msg("Not creating room for joined group: chat is filtered")
+			return
+		} else if evt.Reason != "invite" && user.GetGroupInvitePolicy() != database.GroupInviteAlways {
+			// Groups joined with an invite link were joined by the user themselves, so there's no need to ask
+			user.applyGroupInvitePolicy(ctx, &evt.GroupInfo)
+			return
 		}
 		err := portal.CreateMatrixRoom(ctx, user, &evt.GroupInfo, nil, true, true)
 		if err != nil {
@@ -1455,7 +1628,9 @@ func (user *User) handleGroupUpdate(evt *events.GroupInfo) {
 		log.Debug().Str("sender", evt.Sender.String()).Msg("Ignoring group info update from @lid user")
 		return
 	}
-	ctx := log.WithContext(context.TODO())
+	ctx, done := user.bridge.withWhatsAppDeadline(log.WithContext(context.TODO()))
+	defer done()
+	user.bridge.SendToModerationFeed(ctx, portal, evt)
 	switch {
 	case evt.Announce != nil:
 		log.Debug().Msg("Group announcement mode (message send permission) changed")
@@ -1485,30 +1660,47 @@ func (user *User) handleGroupUpdate(evt *events.GroupInfo) {
 		portal.ChangeAdminStatus(ctx, evt.Demote, false)
 	case evt.Ephemeral != nil:
 		log.Debug().Msg("Group ephemeral mode (disappearing message timer) changed")
-		portal.UpdateGroupDisappearingMessages(ctx, evt.Sender, evt.Timestamp, evt.Ephemeral.DisappearingTimer)
+		portal.UpdateGroupDisappearingMessages(ctx, user, evt.Sender, evt.Timestamp, evt.Ephemeral.DisappearingTimer)
+		portal.promptKeepDisappearing(ctx, user)
 	case evt.Link != nil:
 		log.Debug().Msg("Group parent changed")
 		if evt.Link.Type == types.GroupLinkChangeTypeParent {
 			portal.UpdateParentGroup(ctx, user, evt.Link.Group.JID, true)
+		} else if evt.Link.Type == types.GroupLinkChangeTypeSub {
+			child := user.GetPortalByJID(evt.Link.Group.JID)
+			if child != nil && len(child.MXID) > 0 {
+				child.UpdateParentGroup(ctx, user, portal.Key.JID, true)
+			}
 		}
 	case evt.Unlink != nil:
 		log.Debug().Msg("Group parent removed")
 		if evt.Unlink.Type == types.GroupLinkChangeTypeParent && portal.ParentGroup == evt.Unlink.Group.JID {
 			portal.UpdateParentGroup(ctx, user, types.EmptyJID, true)
+		} else if evt.Unlink.Type == types.GroupLinkChangeTypeSub {
+			child := user.GetPortalByJID(evt.Unlink.Group.JID)
+			if child != nil && child.ParentGroup == portal.Key.JID {
+				child.UpdateParentGroup(ctx, user, types.EmptyJID, true)
+			}
 		}
 	case evt.Delete != nil:
 		log.Debug().Msg("Group deleted")
 		portal.Delete(ctx)
 		portal.Cleanup(ctx, false)
+	case evt.NewInviteLink != nil:
+		log.Debug().Msg("Group invite link changed")
 	default:
 		log.Warn().Msg("Unhandled group info update")
 	}
 }
 
 func (user *User) handleNewsletterJoin(evt *events.NewsletterJoin) {
-	ctx := user.zlog.With().Str("whatsapp_event", "NewsletterJoin").Logger().WithContext(context.TODO())
+	ctx, done := user.bridge.withWhatsAppDeadline(user.zlog.With().Str("whatsapp_event", "NewsletterJoin").Logger().WithContext(context.TODO()))
+	defer done()
 	portal := user.GetPortalByJID(evt.ID)
 	if portal.MXID == "" {
+		if user.IsChatFiltered(ctx, evt.ID) {
+			return
+		}
 		err := portal.CreateMatrixRoom(ctx, user, nil, &evt.NewsletterMetadata, true, false)
 		if err != nil {
 			user.zlog.Err(err).Msg("Failed to create room on newsletter join event")
@@ -1519,7 +1711,8 @@ func (user *User) handleNewsletterJoin(evt *events.NewsletterJoin) {
 }
 
 func (user *User) handleNewsletterLeave(evt *events.NewsletterLeave) {
-	ctx := user.zlog.With().Str("whatsapp_event", "NewsletterLeave").Logger().WithContext(context.TODO())
+	ctx, done := user.bridge.withWhatsAppDeadline(user.zlog.With().Str("whatsapp_event", "NewsletterLeave").Logger().WithContext(context.TODO()))
+	defer done()
 	portal := user.GetPortalByJID(evt.ID)
 	if portal.MXID != "" {
 		portal.HandleWhatsAppKick(ctx, user, user.JID, []types.JID{user.JID})
@@ -1527,6 +1720,8 @@ func (user *User) handleNewsletterLeave(evt *events.NewsletterLeave) {
 }
 
 func (user *User) handlePictureUpdate(ctx context.Context, evt *events.Picture) {
+	ctx, done := user.bridge.withWhatsAppDeadline(ctx)
+	defer done()
 	if evt.JID.Server == types.DefaultUserServer {
 		puppet := user.bridge.GetPuppetByJID(evt.JID)
 		user.zlog.Debug().
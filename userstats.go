@@ -0,0 +1,114 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+
+	"github.com/element-hq/mautrix-whatsapp/database"
+)
+
+func (user *User) addStats(ctx context.Context, stats *database.UserStats) {
+	if user.JID.IsEmpty() {
+		return
+	}
+	err := stats.Add(ctx)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to update usage statistics")
+	}
+}
+
+// trackIncomingStats counts a message bridged from WhatsApp to Matrix.
+func (user *User) trackIncomingStats(ctx context.Context, portal *Portal, converted *ConvertedMessage) {
+	if !user.IsTrackingAllowed() {
+		return
+	}
+	stats := user.bridge.DB.UserStats.New(user.MXID, portal.Key)
+	stats.MessagesIn = 1
+	if converted.Content != nil && (converted.Content.URL != "" || converted.Content.File != nil) {
+		stats.MediaBytes = int64(converted.Content.GetInfo().Size)
+	}
+	user.addStats(ctx, stats)
+}
+
+// trackOutgoingStats counts a message bridged from Matrix to WhatsApp, or a failed send if err is non-nil.
+func (user *User) trackOutgoingStats(ctx context.Context, portal *Portal, msg *waProto.Message, err error) {
+	if !user.IsTrackingAllowed() {
+		return
+	}
+	stats := user.bridge.DB.UserStats.New(user.MXID, portal.Key)
+	if err != nil {
+		stats.FailedSends = 1
+	} else {
+		stats.MessagesOut = 1
+		stats.MediaBytes = int64(getMediaLength(msg))
+	}
+	user.addStats(ctx, stats)
+}
+
+func getMediaLength(msg *waProto.Message) uint64 {
+	switch {
+	case msg.GetImageMessage() != nil:
+		return msg.GetImageMessage().GetFileLength()
+	case msg.GetVideoMessage() != nil:
+		return msg.GetVideoMessage().GetFileLength()
+	case msg.GetAudioMessage() != nil:
+		return msg.GetAudioMessage().GetFileLength()
+	case msg.GetDocumentMessage() != nil:
+		return msg.GetDocumentMessage().GetFileLength()
+	case msg.GetStickerMessage() != nil:
+		return msg.GetStickerMessage().GetFileLength()
+	default:
+		return 0
+	}
+}
+
+// trackConnectionUptime should be called whenever the WhatsApp connection is established or lost.
+// The time spent connected is stored in the usage statistics when the connection is lost.
+func (user *User) trackConnectionUptime(connected bool) {
+	user.connectedSinceLock.Lock()
+	defer user.connectedSinceLock.Unlock()
+	if connected {
+		if user.connectedSince.IsZero() {
+			user.connectedSince = time.Now()
+			if user.IsTrackingAllowed() {
+				user.bridge.Metrics.TrackConnectedSince(user.MXID, user.connectedSince)
+			}
+		}
+		return
+	} else if user.connectedSince.IsZero() {
+		return
+	}
+	stats := user.bridge.DB.UserStats.New(user.MXID, database.PortalKey{})
+	stats.ConnectedSecs = int64(time.Since(user.connectedSince).Seconds())
+	user.connectedSince = time.Time{}
+	user.disconnectedAt = time.Now()
+	user.bridge.Metrics.TrackConnectedSince(user.MXID, user.connectedSince)
+	user.addStats(user.zlog.WithContext(context.TODO()), stats)
+}
+
+// GetConnectedSince returns the time when the current WhatsApp connection was established,
+// or a zero time if the user isn't connected.
+func (user *User) GetConnectedSince() time.Time {
+	user.connectedSinceLock.Lock()
+	defer user.connectedSinceLock.Unlock()
+	return user.connectedSince
+}
@@ -0,0 +1,170 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.mau.fi/util/jsontime"
+	"golang.org/x/exp/slices"
+
+	"github.com/element-hq/mautrix-go"
+
+	"github.com/element-hq/mautrix-whatsapp/config"
+)
+
+type WebhookEventType string
+
+const (
+	WebhookUserLoggedIn        WebhookEventType = "user_logged_in"
+	WebhookUserLoggedOut       WebhookEventType = "user_logged_out"
+	WebhookUserDisconnected    WebhookEventType = "user_disconnected"
+	WebhookMessageBridgeFailed WebhookEventType = "message_bridge_failed"
+	WebhookPuppetLimitReached  WebhookEventType = "puppet_limit_reached"
+	WebhookBackfillComplete    WebhookEventType = "backfill_complete"
+)
+
+const (
+	webhookQueueSize   = 256
+	webhookMaxAttempts = 3
+	webhookTimeout     = 10 * time.Second
+	// WebhookSignatureHeader contains the hex-encoded HMAC-SHA256 of the request body, prefixed with "sha256=".
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookEventHeader     = "X-Webhook-Event"
+)
+
+type WebhookPayload struct {
+	Event     WebhookEventType   `json:"event"`
+	Timestamp jsontime.UnixMilli `json:"timestamp"`
+	BridgeBot string             `json:"bridge_bot"`
+	Data      any                `json:"data"`
+}
+
+type webhookDelivery struct {
+	target *config.WebhookConfig
+	event  WebhookEventType
+	body   []byte
+}
+
+// WebhookSender posts bridge lifecycle events to the webhooks configured by the bridge operator.
+// Deliveries happen in the background in the order they were queued, and are dropped if the queue is full.
+type WebhookSender struct {
+	bridge *WABridge
+	log    zerolog.Logger
+	client *http.Client
+	queue  chan *webhookDelivery
+}
+
+func NewWebhookSender(br *WABridge) *WebhookSender {
+	ws := &WebhookSender{
+		bridge: br,
+		log:    br.ZLog.With().Str("component", "webhooks").Logger(),
+		client: &http.Client{Timeout: webhookTimeout},
+	}
+	if len(br.Config.Webhooks) > 0 {
+		ws.queue = make(chan *webhookDelivery, webhookQueueSize)
+	}
+	return ws
+}
+
+func (ws *WebhookSender) Start() {
+	if ws.queue == nil {
+		return
+	}
+	ws.log.Info().Int("webhook_count", len(ws.bridge.Config.Webhooks)).Msg("Starting webhook sender")
+	for delivery := range ws.queue {
+		ws.deliver(delivery)
+	}
+}
+
+// Send queues the given event for all webhooks that are subscribed to it.
+func (ws *WebhookSender) Send(evtType WebhookEventType, data any) {
+	if ws == nil || ws.queue == nil {
+		return
+	}
+	body, err := json.Marshal(&WebhookPayload{
+		Event:     evtType,
+		Timestamp: jsontime.UM(time.Now()),
+		BridgeBot: ws.bridge.Bot.UserID.String(),
+		Data:      data,
+	})
+	if err != nil {
+		ws.log.Err(err).Str("webhook_event", string(evtType)).Msg("Failed to marshal webhook payload")
+		return
+	}
+	for i := range ws.bridge.Config.Webhooks {
+		target := &ws.bridge.Config.Webhooks[i]
+		if len(target.Events) > 0 && !slices.Contains(target.Events, string(evtType)) {
+			continue
+		}
+		select {
+		case ws.queue <- &webhookDelivery{target: target, event: evtType, body: body}:
+		default:
+			ws.log.Warn().Str("webhook_event", string(evtType)).Str("url", target.URL).Msg("Webhook queue is full, dropping event")
+		}
+	}
+}
+
+func (ws *WebhookSender) deliver(delivery *webhookDelivery) {
+	log := ws.log.With().Str("webhook_event", string(delivery.event)).Str("url", delivery.target.URL).Logger()
+	var err error
+	for attempt := 1; attempt <= webhookMaxAttempts; attempt++ {
+		err = ws.post(delivery)
+		if err == nil {
+			log.Debug().Int("attempt", attempt).Msg("Delivered webhook")
+			return
+		}
+		log.Warn().Err(err).Int("attempt", attempt).Msg("Failed to deliver webhook")
+		if attempt < webhookMaxAttempts {
+			time.Sleep(time.Duration(attempt) * 5 * time.Second)
+		}
+	}
+	log.Err(err).Msg("Giving up on delivering webhook")
+}
+
+func (ws *WebhookSender) post(delivery *webhookDelivery) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, delivery.target.URL, bytes.NewReader(delivery.body))
+	if err != nil {
+		return fmt.Errorf("failed to prepare request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", mautrix.DefaultUserAgent)
+	req.Header.Set(WebhookEventHeader, string(delivery.event))
+	if delivery.target.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(delivery.target.Secret))
+		mac.Write(delivery.body)
+		req.Header.Set(WebhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := ws.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2026 New Vector Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+
+	"github.com/element-hq/mautrix-go/event"
+	"github.com/element-hq/mautrix-go/id"
+)
+
+// getPersonalSpaceMeta returns the name, topic and avatar for new personal spaces,
+// using the welcome space branding from the config if it's enabled.
+func (br *WABridge) getPersonalSpaceMeta() (name, topic string, avatar id.ContentURI) {
+	name, topic, avatar = "WhatsApp", "Your WhatsApp bridged chats", br.Config.AppService.Bot.ParsedAvatar
+	welcomeSpace := br.Config.Bridge.WelcomeSpace
+	if !welcomeSpace.Enabled {
+		return
+	}
+	if welcomeSpace.Name != "" {
+		name = welcomeSpace.Name
+	}
+	if welcomeSpace.Topic != "" {
+		topic = welcomeSpace.Topic
+	}
+	if customAvatar := welcomeSpace.Avatar.ParseOrIgnore(); !customAvatar.IsEmpty() {
+		avatar = customAvatar
+	}
+	return
+}
+
+func (br *WABridge) managementRoomSpaceChild(roomID id.RoomID) *event.Event {
+	stateKey := roomID.String()
+	return &event.Event{
+		Type:     event.StateSpaceChild,
+		StateKey: &stateKey,
+		Content: event.Content{
+			Parsed: &event.SpaceChildEventContent{
+				Via: []string{br.Config.Homeserver.Domain},
+				// Sort the management room before portals, which don't have an order.
+				Order:     "0",
+				Suggested: true,
+			},
+		},
+	}
+}
+
+// updateWelcomeSpace creates the user's welcome space if it doesn't exist yet
+// and moves the management room entry from the old room to the new one.
+func (user *User) updateWelcomeSpace(ctx context.Context, oldRoomID, newRoomID id.RoomID) {
+	hadSpace := user.SpaceRoom != ""
+	spaceID := user.GetSpaceRoom(ctx)
+	if spaceID == "" || !hadSpace {
+		// A newly created space already contains the current management room.
+		return
+	}
+	if oldRoomID != "" {
+		_, err := user.bridge.Bot.SendStateEvent(ctx, spaceID, event.StateSpaceChild, oldRoomID.String(), &event.SpaceChildEventContent{})
+		if err != nil {
+			user.zlog.Warn().Err(err).Stringer("room_id", oldRoomID).Msg("Failed to remove old management room from welcome space")
+		}
+	}
+	if newRoomID != "" {
+		child := user.bridge.managementRoomSpaceChild(newRoomID)
+		_, err := user.bridge.Bot.SendStateEvent(ctx, spaceID, event.StateSpaceChild, newRoomID.String(), child.Content.Parsed)
+		if err != nil {
+			user.zlog.Err(err).Stringer("room_id", newRoomID).Msg("Failed to add management room to welcome space")
+		} else {
+			user.zlog.Debug().Stringer("space_id", spaceID).Msg("Added management room to welcome space")
+		}
+	}
+}